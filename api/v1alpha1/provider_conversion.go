@@ -21,6 +21,7 @@ import (
 
 	apimachineryconversion "k8s.io/apimachinery/pkg/conversion"
 	"k8s.io/utils/pointer"
+	utilconversion "sigs.k8s.io/cluster-api/util/conversion"
 	ctrlconfigv1 "sigs.k8s.io/controller-runtime/pkg/config/v1alpha1"
 	"sigs.k8s.io/controller-runtime/pkg/conversion"
 
@@ -34,7 +35,20 @@ func (src *BootstrapProvider) ConvertTo(dstRaw conversion.Hub) error {
 		panic("expected to get an of object of type v1alpha2.BootstrapProvider")
 	}
 
-	return Convert_v1alpha1_BootstrapProvider_To_v1alpha2_BootstrapProvider(src, dst, nil)
+	if err := Convert_v1alpha1_BootstrapProvider_To_v1alpha2_BootstrapProvider(src, dst, nil); err != nil {
+		return err
+	}
+
+	// Manually restore data.
+	restored := &operatorv1.BootstrapProvider{}
+	if ok, err := utilconversion.UnmarshalData(src, restored); err != nil || !ok {
+		return err
+	}
+
+	restoreProviderSpec(&restored.Spec.ProviderSpec, &dst.Spec.ProviderSpec)
+	restoreProviderStatus(&restored.Status.ProviderStatus, &dst.Status.ProviderStatus)
+
+	return nil
 }
 
 // ConvertFrom converts from the BootstrapProvider version (v1alpha2) to this version.
@@ -44,7 +58,12 @@ func (dst *BootstrapProvider) ConvertFrom(srcRaw conversion.Hub) error {
 		panic("expected to get an of object of type v1alpha2.BootstrapProvider")
 	}
 
-	return Convert_v1alpha2_BootstrapProvider_To_v1alpha1_BootstrapProvider(src, dst, nil)
+	if err := Convert_v1alpha2_BootstrapProvider_To_v1alpha1_BootstrapProvider(src, dst, nil); err != nil {
+		return err
+	}
+
+	// Preserve Hub data on down-conversion.
+	return utilconversion.MarshalData(src, dst)
 }
 
 // ConvertTo converts this BootstrapProviderList to the Hub version (v1alpha2).
@@ -54,7 +73,23 @@ func (src *BootstrapProviderList) ConvertTo(dstRaw conversion.Hub) error {
 		panic("expected to get an of object of type v1alpha2.BootstrapProviderList")
 	}
 
-	return Convert_v1alpha1_BootstrapProviderList_To_v1alpha2_BootstrapProviderList(src, dst, nil)
+	dst.ListMeta = src.ListMeta
+
+	if src.Items == nil {
+		dst.Items = nil
+
+		return nil
+	}
+
+	// Convert the items one by one, so the data preserved on down-conversion is restored.
+	dst.Items = make([]operatorv1.BootstrapProvider, len(src.Items))
+	for i := range src.Items {
+		if err := src.Items[i].ConvertTo(&dst.Items[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
 // ConvertFrom converts from the BootstrapProviderList version (v1alpha2) to this version.
@@ -64,7 +99,23 @@ func (dst *BootstrapProviderList) ConvertFrom(srcRaw conversion.Hub) error {
 		panic("expected to get an of object of type v1alpha2.BootstrapProviderList")
 	}
 
-	return Convert_v1alpha2_BootstrapProviderList_To_v1alpha1_BootstrapProviderList(src, dst, nil)
+	dst.ListMeta = src.ListMeta
+
+	if src.Items == nil {
+		dst.Items = nil
+
+		return nil
+	}
+
+	// Convert the items one by one, so the Hub data is preserved on down-conversion.
+	dst.Items = make([]BootstrapProvider, len(src.Items))
+	for i := range src.Items {
+		if err := dst.Items[i].ConvertFrom(&src.Items[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
 // ConvertTo converts this ControlPlaneProvider to the Hub version (v1alpha2).
@@ -74,7 +125,20 @@ func (src *ControlPlaneProvider) ConvertTo(dstRaw conversion.Hub) error {
 		panic("expected to get an of object of type v1alpha2.ControlPlaneProvider")
 	}
 
-	return Convert_v1alpha1_ControlPlaneProvider_To_v1alpha2_ControlPlaneProvider(src, dst, nil)
+	if err := Convert_v1alpha1_ControlPlaneProvider_To_v1alpha2_ControlPlaneProvider(src, dst, nil); err != nil {
+		return err
+	}
+
+	// Manually restore data.
+	restored := &operatorv1.ControlPlaneProvider{}
+	if ok, err := utilconversion.UnmarshalData(src, restored); err != nil || !ok {
+		return err
+	}
+
+	restoreProviderSpec(&restored.Spec.ProviderSpec, &dst.Spec.ProviderSpec)
+	restoreProviderStatus(&restored.Status.ProviderStatus, &dst.Status.ProviderStatus)
+
+	return nil
 }
 
 // ConvertFrom converts from the ControlPlaneProvider version (v1alpha2) to this version.
@@ -84,7 +148,12 @@ func (dst *ControlPlaneProvider) ConvertFrom(srcRaw conversion.Hub) error {
 		panic("expected to get an of object of type v1alpha2.ControlPlaneProvider")
 	}
 
-	return Convert_v1alpha2_ControlPlaneProvider_To_v1alpha1_ControlPlaneProvider(src, dst, nil)
+	if err := Convert_v1alpha2_ControlPlaneProvider_To_v1alpha1_ControlPlaneProvider(src, dst, nil); err != nil {
+		return err
+	}
+
+	// Preserve Hub data on down-conversion.
+	return utilconversion.MarshalData(src, dst)
 }
 
 // ConvertTo converts this ControlPlaneProviderList to the Hub version (v1alpha2).
@@ -94,7 +163,23 @@ func (src *ControlPlaneProviderList) ConvertTo(dstRaw conversion.Hub) error {
 		panic("expected to get an of object of type v1alpha2.ControlPlaneProviderList")
 	}
 
-	return Convert_v1alpha1_ControlPlaneProviderList_To_v1alpha2_ControlPlaneProviderList(src, dst, nil)
+	dst.ListMeta = src.ListMeta
+
+	if src.Items == nil {
+		dst.Items = nil
+
+		return nil
+	}
+
+	// Convert the items one by one, so the data preserved on down-conversion is restored.
+	dst.Items = make([]operatorv1.ControlPlaneProvider, len(src.Items))
+	for i := range src.Items {
+		if err := src.Items[i].ConvertTo(&dst.Items[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
 // ConvertFrom converts from the ControlPlaneProviderList version (v1alpha2) to this version.
@@ -104,7 +189,23 @@ func (dst *ControlPlaneProviderList) ConvertFrom(srcRaw conversion.Hub) error {
 		panic("expected to get an of object of type v1alpha2.ControlPlaneProviderList")
 	}
 
-	return Convert_v1alpha2_ControlPlaneProviderList_To_v1alpha1_ControlPlaneProviderList(src, dst, nil)
+	dst.ListMeta = src.ListMeta
+
+	if src.Items == nil {
+		dst.Items = nil
+
+		return nil
+	}
+
+	// Convert the items one by one, so the Hub data is preserved on down-conversion.
+	dst.Items = make([]ControlPlaneProvider, len(src.Items))
+	for i := range src.Items {
+		if err := dst.Items[i].ConvertFrom(&src.Items[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
 // ConvertTo converts this CoreProvider to the Hub version (v1alpha2).
@@ -114,7 +215,20 @@ func (src *CoreProvider) ConvertTo(dstRaw conversion.Hub) error {
 		panic("expected to get an of object of type v1alpha2.CoreProvider")
 	}
 
-	return Convert_v1alpha1_CoreProvider_To_v1alpha2_CoreProvider(src, dst, nil)
+	if err := Convert_v1alpha1_CoreProvider_To_v1alpha2_CoreProvider(src, dst, nil); err != nil {
+		return err
+	}
+
+	// Manually restore data.
+	restored := &operatorv1.CoreProvider{}
+	if ok, err := utilconversion.UnmarshalData(src, restored); err != nil || !ok {
+		return err
+	}
+
+	restoreProviderSpec(&restored.Spec.ProviderSpec, &dst.Spec.ProviderSpec)
+	restoreProviderStatus(&restored.Status.ProviderStatus, &dst.Status.ProviderStatus)
+
+	return nil
 }
 
 // ConvertFrom converts from the CoreProvider version (v1alpha2) to this version.
@@ -124,7 +238,12 @@ func (dst *CoreProvider) ConvertFrom(srcRaw conversion.Hub) error {
 		panic("expected to get an of object of type v1alpha2.CoreProvider")
 	}
 
-	return Convert_v1alpha2_CoreProvider_To_v1alpha1_CoreProvider(src, dst, nil)
+	if err := Convert_v1alpha2_CoreProvider_To_v1alpha1_CoreProvider(src, dst, nil); err != nil {
+		return err
+	}
+
+	// Preserve Hub data on down-conversion.
+	return utilconversion.MarshalData(src, dst)
 }
 
 // ConvertTo converts this CoreProviderList to the Hub version (v1alpha2).
@@ -134,7 +253,23 @@ func (src *CoreProviderList) ConvertTo(dstRaw conversion.Hub) error {
 		panic("expected to get an of object of type v1alpha2.CoreProviderList")
 	}
 
-	return Convert_v1alpha1_CoreProviderList_To_v1alpha2_CoreProviderList(src, dst, nil)
+	dst.ListMeta = src.ListMeta
+
+	if src.Items == nil {
+		dst.Items = nil
+
+		return nil
+	}
+
+	// Convert the items one by one, so the data preserved on down-conversion is restored.
+	dst.Items = make([]operatorv1.CoreProvider, len(src.Items))
+	for i := range src.Items {
+		if err := src.Items[i].ConvertTo(&dst.Items[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
 // ConvertFrom converts from the CoreProviderList version (v1alpha2) to this version.
@@ -144,7 +279,23 @@ func (dst *CoreProviderList) ConvertFrom(srcRaw conversion.Hub) error {
 		panic("expected to get an of object of type v1alpha2.CoreProviderList")
 	}
 
-	return Convert_v1alpha2_CoreProviderList_To_v1alpha1_CoreProviderList(src, dst, nil)
+	dst.ListMeta = src.ListMeta
+
+	if src.Items == nil {
+		dst.Items = nil
+
+		return nil
+	}
+
+	// Convert the items one by one, so the Hub data is preserved on down-conversion.
+	dst.Items = make([]CoreProvider, len(src.Items))
+	for i := range src.Items {
+		if err := dst.Items[i].ConvertFrom(&src.Items[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
 // ConvertTo converts this InfrastructureProvider to the Hub version (v1alpha2).
@@ -154,7 +305,20 @@ func (src *InfrastructureProvider) ConvertTo(dstRaw conversion.Hub) error {
 		panic("expected to get an of object of type v1alpha2.InfrastructureProvider")
 	}
 
-	return Convert_v1alpha1_InfrastructureProvider_To_v1alpha2_InfrastructureProvider(src, dst, nil)
+	if err := Convert_v1alpha1_InfrastructureProvider_To_v1alpha2_InfrastructureProvider(src, dst, nil); err != nil {
+		return err
+	}
+
+	// Manually restore data.
+	restored := &operatorv1.InfrastructureProvider{}
+	if ok, err := utilconversion.UnmarshalData(src, restored); err != nil || !ok {
+		return err
+	}
+
+	restoreProviderSpec(&restored.Spec.ProviderSpec, &dst.Spec.ProviderSpec)
+	restoreProviderStatus(&restored.Status.ProviderStatus, &dst.Status.ProviderStatus)
+
+	return nil
 }
 
 // ConvertFrom converts from the InfrastructureProvider version (v1alpha2) to this version.
@@ -164,7 +328,12 @@ func (dst *InfrastructureProvider) ConvertFrom(srcRaw conversion.Hub) error {
 		panic("expected to get an of object of type v1alpha2.InfrastructureProvider")
 	}
 
-	return Convert_v1alpha2_InfrastructureProvider_To_v1alpha1_InfrastructureProvider(src, dst, nil)
+	if err := Convert_v1alpha2_InfrastructureProvider_To_v1alpha1_InfrastructureProvider(src, dst, nil); err != nil {
+		return err
+	}
+
+	// Preserve Hub data on down-conversion.
+	return utilconversion.MarshalData(src, dst)
 }
 
 // ConvertTo converts this InfrastructureProviderList to the Hub version (v1alpha2).
@@ -174,7 +343,23 @@ func (src *InfrastructureProviderList) ConvertTo(dstRaw conversion.Hub) error {
 		panic("expected to get an of object of type v1alpha2.InfrastructureProviderList")
 	}
 
-	return Convert_v1alpha1_InfrastructureProviderList_To_v1alpha2_InfrastructureProviderList(src, dst, nil)
+	dst.ListMeta = src.ListMeta
+
+	if src.Items == nil {
+		dst.Items = nil
+
+		return nil
+	}
+
+	// Convert the items one by one, so the data preserved on down-conversion is restored.
+	dst.Items = make([]operatorv1.InfrastructureProvider, len(src.Items))
+	for i := range src.Items {
+		if err := src.Items[i].ConvertTo(&dst.Items[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
 // ConvertFrom converts from the InfrastructureProviderList version (v1alpha2) to this version.
@@ -184,7 +369,23 @@ func (dst *InfrastructureProviderList) ConvertFrom(srcRaw conversion.Hub) error
 		panic("expected to get an of object of type v1alpha2.InfrastructureProviderList")
 	}
 
-	return Convert_v1alpha2_InfrastructureProviderList_To_v1alpha1_InfrastructureProviderList(src, dst, nil)
+	dst.ListMeta = src.ListMeta
+
+	if src.Items == nil {
+		dst.Items = nil
+
+		return nil
+	}
+
+	// Convert the items one by one, so the Hub data is preserved on down-conversion.
+	dst.Items = make([]InfrastructureProvider, len(src.Items))
+	for i := range src.Items {
+		if err := dst.Items[i].ConvertFrom(&src.Items[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
 func Convert_v1alpha1_ManagerSpec_To_v1alpha2_ManagerSpec(in *ManagerSpec, out *operatorv1.ManagerSpec, s apimachineryconversion.Scope) error {
@@ -365,6 +566,18 @@ func Convert_v1alpha2_ProviderSpec_To_v1alpha1_ProviderSpec(in *operatorv1.Provi
 	return nil
 }
 
+func Convert_v1alpha2_DeploymentSpec_To_v1alpha1_DeploymentSpec(in *operatorv1.DeploymentSpec, out *DeploymentSpec, s apimachineryconversion.Scope) error {
+	return autoConvert_v1alpha2_DeploymentSpec_To_v1alpha1_DeploymentSpec(in, out, s)
+}
+
+func Convert_v1alpha2_FetchConfiguration_To_v1alpha1_FetchConfiguration(in *operatorv1.FetchConfiguration, out *FetchConfiguration, s apimachineryconversion.Scope) error {
+	return autoConvert_v1alpha2_FetchConfiguration_To_v1alpha1_FetchConfiguration(in, out, s)
+}
+
+func Convert_v1alpha2_ProviderStatus_To_v1alpha1_ProviderStatus(in *operatorv1.ProviderStatus, out *ProviderStatus, s apimachineryconversion.Scope) error {
+	return autoConvert_v1alpha2_ProviderStatus_To_v1alpha1_ProviderStatus(in, out, s)
+}
+
 func Convert_v1alpha1_ContainerSpec_To_v1alpha2_ContainerSpec(in *ContainerSpec, out *operatorv1.ContainerSpec, s apimachineryconversion.Scope) error {
 	if in == nil {
 		return nil
@@ -407,6 +620,93 @@ func Convert_v1alpha2_ContainerSpec_To_v1alpha1_ContainerSpec(in *operatorv1.Con
 	return nil
 }
 
+// restoreProviderSpec restores the ProviderSpec fields that don't exist in v1alpha1
+// from the data preserved on down-conversion.
+func restoreProviderSpec(restored, dst *operatorv1.ProviderSpec) {
+	if restored.FetchConfig != nil {
+		if dst.FetchConfig == nil {
+			dst.FetchConfig = &operatorv1.FetchConfiguration{}
+		}
+
+		dst.FetchConfig.OverridesConfigMapRef = restored.FetchConfig.OverridesConfigMapRef
+		dst.FetchConfig.MetadataOverrideRef = restored.FetchConfig.MetadataOverrideRef
+		dst.FetchConfig.ConfigMapNamespace = restored.FetchConfig.ConfigMapNamespace
+		dst.FetchConfig.CABundleRef = restored.FetchConfig.CABundleRef
+		dst.FetchConfig.ComponentsPath = restored.FetchConfig.ComponentsPath
+		dst.FetchConfig.MetadataPath = restored.FetchConfig.MetadataPath
+		dst.FetchConfig.Git = restored.FetchConfig.Git
+		dst.FetchConfig.Helm = restored.FetchConfig.Helm
+	}
+
+	if restored.Deployment != nil {
+		if dst.Deployment == nil {
+			dst.Deployment = &operatorv1.DeploymentSpec{}
+		}
+
+		dst.Deployment.ServiceAccountAnnotations = restored.Deployment.ServiceAccountAnnotations
+		dst.Deployment.SecurityContext = restored.Deployment.SecurityContext
+		dst.Deployment.ContainerSecurityContext = restored.Deployment.ContainerSecurityContext
+		dst.Deployment.Image = restored.Deployment.Image
+		dst.Deployment.AdditionalVolumes = restored.Deployment.AdditionalVolumes
+		dst.Deployment.PriorityClassName = restored.Deployment.PriorityClassName
+		dst.Deployment.InitContainers = restored.Deployment.InitContainers
+		dst.Deployment.TerminationGracePeriodSeconds = restored.Deployment.TerminationGracePeriodSeconds
+		dst.Deployment.AdditionalPorts = restored.Deployment.AdditionalPorts
+
+		// Containers keep their order on conversion, so restore their volume mounts by index.
+		if len(restored.Deployment.Containers) == len(dst.Deployment.Containers) {
+			for i := range dst.Deployment.Containers {
+				dst.Deployment.Containers[i].VolumeMounts = restored.Deployment.Containers[i].VolumeMounts
+			}
+		}
+	}
+
+	if restored.Manager != nil {
+		if dst.Manager == nil {
+			dst.Manager = &operatorv1.ManagerSpec{}
+		}
+
+		dst.Manager.LogFormat = restored.Manager.LogFormat
+	}
+
+	dst.ConfigSecretRef = restored.ConfigSecretRef
+	dst.Channel = restored.Channel
+	dst.VersionConstraint = restored.VersionConstraint
+	dst.AutoUpgrade = restored.AutoUpgrade
+	dst.UpgradeStrategy = restored.UpgradeStrategy
+	dst.ReconcileInterval = restored.ReconcileInterval
+	dst.Upgrade = restored.Upgrade
+	dst.SkipCRDs = restored.SkipCRDs
+	dst.ComponentSelector = restored.ComponentSelector
+	dst.ExcludeObjects = restored.ExcludeObjects
+	dst.EnforceNoDrift = restored.EnforceNoDrift
+	dst.RequireDigest = restored.RequireDigest
+	dst.ManifestTransformWebhook = restored.ManifestTransformWebhook
+	dst.RetainManifestHistory = restored.RetainManifestHistory
+	dst.DeletionPolicy = restored.DeletionPolicy
+	dst.ContractPolicy = restored.ContractPolicy
+	dst.DependsOn = restored.DependsOn
+	dst.Hooks = restored.Hooks
+	dst.ApplyOrder = restored.ApplyOrder
+	dst.InstallTimeout = restored.InstallTimeout
+	dst.AdditionalRBAC = restored.AdditionalRBAC
+}
+
+// restoreProviderStatus restores the ProviderStatus fields that don't exist in v1alpha1
+// from the data preserved on down-conversion.
+func restoreProviderStatus(restored, dst *operatorv1.ProviderStatus) {
+	dst.LatestVersion = restored.LatestVersion
+	dst.ResolvedVersion = restored.ResolvedVersion
+	dst.FetchedFrom = restored.FetchedFrom
+	dst.InstalledComponents = restored.InstalledComponents
+	dst.AppliedComponentsHash = restored.AppliedComponentsHash
+	dst.LastReconcileTime = restored.LastReconcileTime
+	dst.LastSuccessfulReconcileTime = restored.LastSuccessfulReconcileTime
+	dst.LastUpgradeCheckTime = restored.LastUpgradeCheckTime
+	dst.InstallAttempt = restored.InstallAttempt
+	dst.PinnedImages = restored.PinnedImages
+}
+
 func toImageMeta(imageURL string) *ImageMeta {
 	im := ImageMeta{}
 
@@ -24,10 +24,12 @@ import (
 
 	fuzz "github.com/google/gofuzz"
 	"k8s.io/apimachinery/pkg/api/apitesting/fuzzer"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	runtimeserializer "k8s.io/apimachinery/pkg/runtime/serializer"
 	operatorv1 "sigs.k8s.io/cluster-api-operator/api/v1alpha2"
 	utilconversion "sigs.k8s.io/cluster-api/util/conversion"
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
 )
 
 func TestFuzzyConversion(t *testing.T) {
@@ -63,6 +65,64 @@ func TestFuzzyConversion(t *testing.T) {
 		Spoke:       &InfrastructureProvider{},
 		FuzzerFuncs: []fuzzer.FuzzerFuncs{imageMetaFuzzFunc, imageURLFuzzFunc, secretConfigFuzzFunc},
 	}))
+
+	t.Run("for CoreProviderList", utilconversion.FuzzTestFunc(utilconversion.FuzzTestFuncInput{
+		Scheme:                     scheme,
+		Hub:                        &operatorv1.CoreProviderList{},
+		Spoke:                      &CoreProviderList{},
+		FuzzerFuncs:                []fuzzer.FuzzerFuncs{imageMetaFuzzFunc, imageURLFuzzFunc, secretConfigFuzzFunc},
+		SkipSpokeAnnotationCleanup: true,
+		SpokeAfterMutation: func(c conversion.Convertible) {
+			for i := range c.(*CoreProviderList).Items {
+				removeDataAnnotation(&c.(*CoreProviderList).Items[i])
+			}
+		},
+	}))
+
+	t.Run("for ControlPlaneProviderList", utilconversion.FuzzTestFunc(utilconversion.FuzzTestFuncInput{
+		Scheme:                     scheme,
+		Hub:                        &operatorv1.ControlPlaneProviderList{},
+		Spoke:                      &ControlPlaneProviderList{},
+		FuzzerFuncs:                []fuzzer.FuzzerFuncs{imageMetaFuzzFunc, imageURLFuzzFunc, secretConfigFuzzFunc},
+		SkipSpokeAnnotationCleanup: true,
+		SpokeAfterMutation: func(c conversion.Convertible) {
+			for i := range c.(*ControlPlaneProviderList).Items {
+				removeDataAnnotation(&c.(*ControlPlaneProviderList).Items[i])
+			}
+		},
+	}))
+
+	t.Run("for BootstrapProviderList", utilconversion.FuzzTestFunc(utilconversion.FuzzTestFuncInput{
+		Scheme:                     scheme,
+		Hub:                        &operatorv1.BootstrapProviderList{},
+		Spoke:                      &BootstrapProviderList{},
+		FuzzerFuncs:                []fuzzer.FuzzerFuncs{imageMetaFuzzFunc, imageURLFuzzFunc, secretConfigFuzzFunc},
+		SkipSpokeAnnotationCleanup: true,
+		SpokeAfterMutation: func(c conversion.Convertible) {
+			for i := range c.(*BootstrapProviderList).Items {
+				removeDataAnnotation(&c.(*BootstrapProviderList).Items[i])
+			}
+		},
+	}))
+
+	t.Run("for InfrastructureProviderList", utilconversion.FuzzTestFunc(utilconversion.FuzzTestFuncInput{
+		Scheme:                     scheme,
+		Hub:                        &operatorv1.InfrastructureProviderList{},
+		Spoke:                      &InfrastructureProviderList{},
+		FuzzerFuncs:                []fuzzer.FuzzerFuncs{imageMetaFuzzFunc, imageURLFuzzFunc, secretConfigFuzzFunc},
+		SkipSpokeAnnotationCleanup: true,
+		SpokeAfterMutation: func(c conversion.Convertible) {
+			for i := range c.(*InfrastructureProviderList).Items {
+				removeDataAnnotation(&c.(*InfrastructureProviderList).Items[i])
+			}
+		},
+	}))
+}
+
+// removeDataAnnotation removes the annotation added by ConvertFrom to preserve the Hub data,
+// which the spoke list items didn't have before the round trip.
+func removeDataAnnotation(obj metav1.Object) {
+	delete(obj.GetAnnotations(), utilconversion.DataAnnotation)
 }
 
 func secretConfigFuzzFunc(_ runtimeserializer.CodecFactory) []interface{} {
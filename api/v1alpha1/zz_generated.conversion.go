@@ -174,21 +174,11 @@ func RegisterConversions(s *runtime.Scheme) error {
 	}); err != nil {
 		return err
 	}
-	if err := s.AddGeneratedConversionFunc((*v1alpha2.DeploymentSpec)(nil), (*DeploymentSpec)(nil), func(a, b interface{}, scope conversion.Scope) error {
-		return Convert_v1alpha2_DeploymentSpec_To_v1alpha1_DeploymentSpec(a.(*v1alpha2.DeploymentSpec), b.(*DeploymentSpec), scope)
-	}); err != nil {
-		return err
-	}
 	if err := s.AddGeneratedConversionFunc((*FetchConfiguration)(nil), (*v1alpha2.FetchConfiguration)(nil), func(a, b interface{}, scope conversion.Scope) error {
 		return Convert_v1alpha1_FetchConfiguration_To_v1alpha2_FetchConfiguration(a.(*FetchConfiguration), b.(*v1alpha2.FetchConfiguration), scope)
 	}); err != nil {
 		return err
 	}
-	if err := s.AddGeneratedConversionFunc((*v1alpha2.FetchConfiguration)(nil), (*FetchConfiguration)(nil), func(a, b interface{}, scope conversion.Scope) error {
-		return Convert_v1alpha2_FetchConfiguration_To_v1alpha1_FetchConfiguration(a.(*v1alpha2.FetchConfiguration), b.(*FetchConfiguration), scope)
-	}); err != nil {
-		return err
-	}
 	if err := s.AddGeneratedConversionFunc((*InfrastructureProvider)(nil), (*v1alpha2.InfrastructureProvider)(nil), func(a, b interface{}, scope conversion.Scope) error {
 		return Convert_v1alpha1_InfrastructureProvider_To_v1alpha2_InfrastructureProvider(a.(*InfrastructureProvider), b.(*v1alpha2.InfrastructureProvider), scope)
 	}); err != nil {
@@ -234,11 +224,6 @@ func RegisterConversions(s *runtime.Scheme) error {
 	}); err != nil {
 		return err
 	}
-	if err := s.AddGeneratedConversionFunc((*v1alpha2.ProviderStatus)(nil), (*ProviderStatus)(nil), func(a, b interface{}, scope conversion.Scope) error {
-		return Convert_v1alpha2_ProviderStatus_To_v1alpha1_ProviderStatus(a.(*v1alpha2.ProviderStatus), b.(*ProviderStatus), scope)
-	}); err != nil {
-		return err
-	}
 	if err := s.AddConversionFunc((*ContainerSpec)(nil), (*v1alpha2.ContainerSpec)(nil), func(a, b interface{}, scope conversion.Scope) error {
 		return Convert_v1alpha1_ContainerSpec_To_v1alpha2_ContainerSpec(a.(*ContainerSpec), b.(*v1alpha2.ContainerSpec), scope)
 	}); err != nil {
@@ -259,6 +244,16 @@ func RegisterConversions(s *runtime.Scheme) error {
 	}); err != nil {
 		return err
 	}
+	if err := s.AddConversionFunc((*v1alpha2.DeploymentSpec)(nil), (*DeploymentSpec)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1alpha2_DeploymentSpec_To_v1alpha1_DeploymentSpec(a.(*v1alpha2.DeploymentSpec), b.(*DeploymentSpec), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddConversionFunc((*v1alpha2.FetchConfiguration)(nil), (*FetchConfiguration)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1alpha2_FetchConfiguration_To_v1alpha1_FetchConfiguration(a.(*v1alpha2.FetchConfiguration), b.(*FetchConfiguration), scope)
+	}); err != nil {
+		return err
+	}
 	if err := s.AddConversionFunc((*v1alpha2.ManagerSpec)(nil), (*ManagerSpec)(nil), func(a, b interface{}, scope conversion.Scope) error {
 		return Convert_v1alpha2_ManagerSpec_To_v1alpha1_ManagerSpec(a.(*v1alpha2.ManagerSpec), b.(*ManagerSpec), scope)
 	}); err != nil {
@@ -269,6 +264,11 @@ func RegisterConversions(s *runtime.Scheme) error {
 	}); err != nil {
 		return err
 	}
+	if err := s.AddConversionFunc((*v1alpha2.ProviderStatus)(nil), (*ProviderStatus)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1alpha2_ProviderStatus_To_v1alpha1_ProviderStatus(a.(*v1alpha2.ProviderStatus), b.(*ProviderStatus), scope)
+	}); err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -433,6 +433,7 @@ func autoConvert_v1alpha2_ContainerSpec_To_v1alpha1_ContainerSpec(in *v1alpha2.C
 	out.Env = *(*[]v1.EnvVar)(unsafe.Pointer(&in.Env))
 	out.Resources = (*v1.ResourceRequirements)(unsafe.Pointer(in.Resources))
 	out.Command = *(*[]string)(unsafe.Pointer(&in.Command))
+	// WARNING: in.VolumeMounts requires manual conversion: does not exist in peer-type
 	return nil
 }
 
@@ -723,15 +724,19 @@ func autoConvert_v1alpha2_DeploymentSpec_To_v1alpha1_DeploymentSpec(in *v1alpha2
 		out.Containers = nil
 	}
 	out.ServiceAccountName = in.ServiceAccountName
+	// WARNING: in.ServiceAccountAnnotations requires manual conversion: does not exist in peer-type
 	out.ImagePullSecrets = *(*[]v1.LocalObjectReference)(unsafe.Pointer(&in.ImagePullSecrets))
+	// WARNING: in.SecurityContext requires manual conversion: does not exist in peer-type
+	// WARNING: in.ContainerSecurityContext requires manual conversion: does not exist in peer-type
+	// WARNING: in.Image requires manual conversion: does not exist in peer-type
+	// WARNING: in.AdditionalVolumes requires manual conversion: does not exist in peer-type
+	// WARNING: in.PriorityClassName requires manual conversion: does not exist in peer-type
+	// WARNING: in.InitContainers requires manual conversion: does not exist in peer-type
+	// WARNING: in.TerminationGracePeriodSeconds requires manual conversion: does not exist in peer-type
+	// WARNING: in.AdditionalPorts requires manual conversion: does not exist in peer-type
 	return nil
 }
 
-// Convert_v1alpha2_DeploymentSpec_To_v1alpha1_DeploymentSpec is an autogenerated conversion function.
-func Convert_v1alpha2_DeploymentSpec_To_v1alpha1_DeploymentSpec(in *v1alpha2.DeploymentSpec, out *DeploymentSpec, s conversion.Scope) error {
-	return autoConvert_v1alpha2_DeploymentSpec_To_v1alpha1_DeploymentSpec(in, out, s)
-}
-
 func autoConvert_v1alpha1_FetchConfiguration_To_v1alpha2_FetchConfiguration(in *FetchConfiguration, out *v1alpha2.FetchConfiguration, s conversion.Scope) error {
 	out.URL = in.URL
 	out.Selector = (*metav1.LabelSelector)(unsafe.Pointer(in.Selector))
@@ -746,14 +751,17 @@ func Convert_v1alpha1_FetchConfiguration_To_v1alpha2_FetchConfiguration(in *Fetc
 func autoConvert_v1alpha2_FetchConfiguration_To_v1alpha1_FetchConfiguration(in *v1alpha2.FetchConfiguration, out *FetchConfiguration, s conversion.Scope) error {
 	out.URL = in.URL
 	out.Selector = (*metav1.LabelSelector)(unsafe.Pointer(in.Selector))
+	// WARNING: in.OverridesConfigMapRef requires manual conversion: does not exist in peer-type
+	// WARNING: in.MetadataOverrideRef requires manual conversion: does not exist in peer-type
+	// WARNING: in.ConfigMapNamespace requires manual conversion: does not exist in peer-type
+	// WARNING: in.CABundleRef requires manual conversion: does not exist in peer-type
+	// WARNING: in.ComponentsPath requires manual conversion: does not exist in peer-type
+	// WARNING: in.MetadataPath requires manual conversion: does not exist in peer-type
+	// WARNING: in.Git requires manual conversion: does not exist in peer-type
+	// WARNING: in.Helm requires manual conversion: does not exist in peer-type
 	return nil
 }
 
-// Convert_v1alpha2_FetchConfiguration_To_v1alpha1_FetchConfiguration is an autogenerated conversion function.
-func Convert_v1alpha2_FetchConfiguration_To_v1alpha1_FetchConfiguration(in *v1alpha2.FetchConfiguration, out *FetchConfiguration, s conversion.Scope) error {
-	return autoConvert_v1alpha2_FetchConfiguration_To_v1alpha1_FetchConfiguration(in, out, s)
-}
-
 func autoConvert_v1alpha1_InfrastructureProvider_To_v1alpha2_InfrastructureProvider(in *InfrastructureProvider, out *v1alpha2.InfrastructureProvider, s conversion.Scope) error {
 	out.ObjectMeta = in.ObjectMeta
 	if err := Convert_v1alpha1_InfrastructureProviderSpec_To_v1alpha2_InfrastructureProviderSpec(&in.Spec, &out.Spec, s); err != nil {
@@ -890,6 +898,7 @@ func autoConvert_v1alpha2_ManagerSpec_To_v1alpha1_ManagerSpec(in *v1alpha2.Manag
 	out.ProfilerAddress = in.ProfilerAddress
 	out.MaxConcurrentReconciles = in.MaxConcurrentReconciles
 	out.Verbosity = in.Verbosity
+	// WARNING: in.LogFormat requires manual conversion: does not exist in peer-type
 	out.FeatureGates = *(*map[string]bool)(unsafe.Pointer(&in.FeatureGates))
 	return nil
 }
@@ -916,7 +925,15 @@ func autoConvert_v1alpha1_ProviderSpec_To_v1alpha2_ProviderSpec(in *ProviderSpec
 	}
 	// WARNING: in.SecretName requires manual conversion: does not exist in peer-type
 	// WARNING: in.SecretNamespace requires manual conversion: does not exist in peer-type
-	out.FetchConfig = (*v1alpha2.FetchConfiguration)(unsafe.Pointer(in.FetchConfig))
+	if in.FetchConfig != nil {
+		in, out := &in.FetchConfig, &out.FetchConfig
+		*out = new(v1alpha2.FetchConfiguration)
+		if err := Convert_v1alpha1_FetchConfiguration_To_v1alpha2_FetchConfiguration(*in, *out, s); err != nil {
+			return err
+		}
+	} else {
+		out.FetchConfig = nil
+	}
 	out.AdditionalManifestsRef = (*v1alpha2.ConfigmapReference)(unsafe.Pointer(in.AdditionalManifestsRef))
 	return nil
 }
@@ -942,8 +959,37 @@ func autoConvert_v1alpha2_ProviderSpec_To_v1alpha1_ProviderSpec(in *v1alpha2.Pro
 		out.Deployment = nil
 	}
 	// WARNING: in.ConfigSecret requires manual conversion: does not exist in peer-type
-	out.FetchConfig = (*FetchConfiguration)(unsafe.Pointer(in.FetchConfig))
+	// WARNING: in.ConfigSecretRef requires manual conversion: does not exist in peer-type
+	if in.FetchConfig != nil {
+		in, out := &in.FetchConfig, &out.FetchConfig
+		*out = new(FetchConfiguration)
+		if err := Convert_v1alpha2_FetchConfiguration_To_v1alpha1_FetchConfiguration(*in, *out, s); err != nil {
+			return err
+		}
+	} else {
+		out.FetchConfig = nil
+	}
 	out.AdditionalManifestsRef = (*ConfigmapReference)(unsafe.Pointer(in.AdditionalManifestsRef))
+	// WARNING: in.AdditionalRBAC requires manual conversion: does not exist in peer-type
+	// WARNING: in.Channel requires manual conversion: does not exist in peer-type
+	// WARNING: in.VersionConstraint requires manual conversion: does not exist in peer-type
+	// WARNING: in.AutoUpgrade requires manual conversion: does not exist in peer-type
+	// WARNING: in.UpgradeStrategy requires manual conversion: does not exist in peer-type
+	// WARNING: in.ReconcileInterval requires manual conversion: does not exist in peer-type
+	// WARNING: in.Upgrade requires manual conversion: does not exist in peer-type
+	// WARNING: in.SkipCRDs requires manual conversion: does not exist in peer-type
+	// WARNING: in.ComponentSelector requires manual conversion: does not exist in peer-type
+	// WARNING: in.ExcludeObjects requires manual conversion: does not exist in peer-type
+	// WARNING: in.EnforceNoDrift requires manual conversion: does not exist in peer-type
+	// WARNING: in.RequireDigest requires manual conversion: does not exist in peer-type
+	// WARNING: in.ManifestTransformWebhook requires manual conversion: does not exist in peer-type
+	// WARNING: in.RetainManifestHistory requires manual conversion: does not exist in peer-type
+	// WARNING: in.DeletionPolicy requires manual conversion: does not exist in peer-type
+	// WARNING: in.ContractPolicy requires manual conversion: does not exist in peer-type
+	// WARNING: in.DependsOn requires manual conversion: does not exist in peer-type
+	// WARNING: in.Hooks requires manual conversion: does not exist in peer-type
+	// WARNING: in.ApplyOrder requires manual conversion: does not exist in peer-type
+	// WARNING: in.InstallTimeout requires manual conversion: does not exist in peer-type
 	return nil
 }
 
@@ -965,10 +1011,15 @@ func autoConvert_v1alpha2_ProviderStatus_To_v1alpha1_ProviderStatus(in *v1alpha2
 	out.Conditions = *(*v1beta1.Conditions)(unsafe.Pointer(&in.Conditions))
 	out.ObservedGeneration = in.ObservedGeneration
 	out.InstalledVersion = (*string)(unsafe.Pointer(in.InstalledVersion))
+	// WARNING: in.LatestVersion requires manual conversion: does not exist in peer-type
+	// WARNING: in.ResolvedVersion requires manual conversion: does not exist in peer-type
+	// WARNING: in.FetchedFrom requires manual conversion: does not exist in peer-type
+	// WARNING: in.InstalledComponents requires manual conversion: does not exist in peer-type
+	// WARNING: in.AppliedComponentsHash requires manual conversion: does not exist in peer-type
+	// WARNING: in.LastReconcileTime requires manual conversion: does not exist in peer-type
+	// WARNING: in.LastSuccessfulReconcileTime requires manual conversion: does not exist in peer-type
+	// WARNING: in.LastUpgradeCheckTime requires manual conversion: does not exist in peer-type
+	// WARNING: in.InstallAttempt requires manual conversion: does not exist in peer-type
+	// WARNING: in.PinnedImages requires manual conversion: does not exist in peer-type
 	return nil
 }
-
-// Convert_v1alpha2_ProviderStatus_To_v1alpha1_ProviderStatus is an autogenerated conversion function.
-func Convert_v1alpha2_ProviderStatus_To_v1alpha1_ProviderStatus(in *v1alpha2.ProviderStatus, out *ProviderStatus, s conversion.Scope) error {
-	return autoConvert_v1alpha2_ProviderStatus_To_v1alpha1_ProviderStatus(in, out, s)
-}
@@ -33,6 +33,7 @@ type BootstrapProviderStatus struct {
 // +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
 // +kubebuilder:printcolumn:name="InstalledVersion",type="string",JSONPath=".status.installedVersion"
+// +kubebuilder:printcolumn:name="Contract",type="string",JSONPath=".status.contract"
 // +kubebuilder:printcolumn:name="Ready",type="string",JSONPath=".status.conditions[?(@.type=='Ready')].status"
 // +kubebuilder:storageversion
 
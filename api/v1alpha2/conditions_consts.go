@@ -38,26 +38,393 @@ const (
 	// FetchConfigValidationError documents that the FetchConfig is configured incorrectly.
 	FetchConfigValidationErrorReason = "FetchConfigValidationError"
 
+	// InvalidMetadataOverrideReason documents that the ConfigMap referenced by spec.fetchConfig.metadataOverrideRef
+	// doesn't exist or doesn't hold valid clusterctl metadata.
+	InvalidMetadataOverrideReason = "InvalidMetadataOverride"
+
 	// UnknownProviderReason documents that the provider name is not the name of a known provider.
 	UnknownProviderReason = "UnknownProvider"
 
+	// ProviderTypeMismatchReason documents that the provider name is the name of a known provider of another type.
+	ProviderTypeMismatchReason = "ProviderTypeMismatch"
+
 	// CAPIVersionIncompatibilityReason documents that the provider version is incompatible with operator.
+	//
+	// Deprecated: ContractMismatchReason is reported instead.
 	CAPIVersionIncompatibilityReason = "CAPIVersionIncompatibility"
 
 	// ComponentsFetchErrorReason documents that an error occurred fetching the componets.
+	//
+	// Deprecated: DownloadFailedReason or DecodeFailedReason are reported instead.
 	ComponentsFetchErrorReason = "ComponentsFetchError"
 
 	// OldComponentsDeletionErrorReason documents that an error occurred deleting the old components prior to upgrading.
 	OldComponentsDeletionErrorReason = "OldComponentsDeletionError"
 
+	// InventoryUpdateErrorReason documents that an error occurred reflecting the provider into the clusterctl inventory.
+	InventoryUpdateErrorReason = "InventoryUpdateError"
+
+	// WaitingForCoreProviderReason documents that the provider is waiting for the core provider to be created.
+	WaitingForCoreProviderReason = "WaitingForCoreProvider"
+
 	// WaitingForCoreProviderReadyReason documents that the provider is waiting for the core provider to be ready.
 	WaitingForCoreProviderReadyReason = "WaitingForCoreProviderReady"
 
 	// InvalidGithubTokenReason documents that the provided github token is invalid.
 	InvalidGithubTokenReason = "InvalidGithubTokenError"
+
+	// TarballExtractionErrorReason documents that the provider release tarball could not be extracted,
+	// or doesn't contain the provider metadata and components files.
+	TarballExtractionErrorReason = "TarballExtractionError"
+
+	// GitFetchErrorReason documents that the provider components and metadata could not be fetched
+	// from the Git repository, e.g. because of invalid credentials or a missing ref.
+	GitFetchErrorReason = "GitFetchError"
+
+	// HelmTemplateErrorReason documents that the provider components could not be rendered from
+	// the Helm chart, e.g. because the chart could not be pulled or its templates are invalid.
+	HelmTemplateErrorReason = "HelmTemplateError"
+
+	// InvalidReconcileIntervalReason documents that the provider reconcile interval is too short.
+	InvalidReconcileIntervalReason = "InvalidReconcileInterval"
+
+	// InvalidLeaderElectionReason documents that the provider leader election configuration is invalid.
+	InvalidLeaderElectionReason = "InvalidLeaderElection"
+
+	// InvalidReplicasReason documents that the provider deployment replicas are lower than 1.
+	InvalidReplicasReason = "InvalidReplicas"
+
+	// InvalidImageReferenceReason documents that the provider manager image override is not a valid image reference.
+	InvalidImageReferenceReason = "InvalidImageReference"
+
+	// VolumeMountConflictReason documents that the provider additional volumes or volume mounts collide
+	// with each other or with the ones from the fetched manifests.
+	VolumeMountConflictReason = "VolumeMountConflict"
+
+	// InitContainerConflictReason documents that the provider init containers are invalid, or collide with
+	// each other or with the containers from the fetched manifests.
+	InitContainerConflictReason = "InitContainerConflict"
+
+	// PortConflictReason documents that the provider additional ports are invalid, or collide with each
+	// other or with the ports of the containers from the fetched manifests.
+	PortConflictReason = "PortConflict"
+
+	// InvalidBindAddressReason documents that the provider manager metrics or health probe bind address
+	// is not in the host:port format.
+	InvalidBindAddressReason = "InvalidBindAddress"
+
+	// MissingPermissionsReason documents that the operator is not allowed to create some of the
+	// provider components.
+	MissingPermissionsReason = "MissingPermissions"
+
+	// ServiceAccountNotFoundReason documents that the ServiceAccount set by spec.deployment.serviceAccountName
+	// doesn't exist, and isn't part of the provider components.
+	ServiceAccountNotFoundReason = "ServiceAccountNotFound"
+
+	// ServiceAccountAnnotationFailedReason documents that the spec.deployment.serviceAccountAnnotations couldn't
+	// be set on the external ServiceAccount set by spec.deployment.serviceAccountName.
+	ServiceAccountAnnotationFailedReason = "ServiceAccountAnnotationFailed"
+
+	// MissingCRDsReason documents that CustomResourceDefinitions of a provider installed without its CRDs
+	// don't exist in the cluster.
+	MissingCRDsReason = "MissingCRDs"
+
+	// InvalidComponentSelectorReason documents that the provider component selector is malformed.
+	InvalidComponentSelectorReason = "InvalidComponentSelector"
+
+	// InvalidExcludeObjectsReason documents that a pattern of the provider excluded objects is malformed.
+	InvalidExcludeObjectsReason = "InvalidExcludeObjects"
+
+	// InvalidManifestTransformWebhookReason documents that the manifest transform webhook configuration is
+	// invalid, e.g. its URL doesn't use https.
+	InvalidManifestTransformWebhookReason = "InvalidManifestTransformWebhook"
+
+	// WaitingForDependenciesReason documents that the provider is waiting for the providers it depends on
+	// to be ready.
+	WaitingForDependenciesReason = "WaitingForDependencies"
+
+	// DependencyCycleReason documents that the provider depends on itself through its dependencies.
+	DependencyCycleReason = "DependencyCycle"
+
+	// ReferenceOutsideWatchNamespaceReason documents that the provider references objects outside of the namespace
+	// watched by the operator.
+	ReferenceOutsideWatchNamespaceReason = "ReferenceOutsideWatchNamespace"
 )
 
 const (
 	// ProviderInstalledCondition documents a Provider that has been installed.
 	ProviderInstalledCondition clusterv1.ConditionType = "ProviderInstalled"
+
+	// DownloadFailedReason documents that the provider metadata or components could not be downloaded,
+	// e.g. because the repository is unreachable or doesn't have the requested version.
+	DownloadFailedReason = "DownloadFailed"
+
+	// VersionNotFoundReason documents that the provider repository doesn't have the requested version, e.g.
+	// because a just tagged release is not published yet.
+	VersionNotFoundReason = "VersionNotFound"
+
+	// DecodeFailedReason documents that the provider metadata or components could not be decoded or
+	// processed, e.g. because the download is corrupt or truncated.
+	DecodeFailedReason = "DecodeFailed"
+
+	// ApplyFailedReason documents that the provider components could not be applied to the cluster.
+	ApplyFailedReason = "ApplyFailed"
+
+	// InsufficientPermissionsReason (Severity=Error) documents that the operator was forbidden to apply a
+	// CustomResourceDefinition of the provider components. The install is retried until it's allowed.
+	InsufficientPermissionsReason = "InsufficientPermissions"
+
+	// NamespaceNotFoundReason documents that the namespace the provider components are installed in doesn't
+	// exist, and the operator is not allowed to create it.
+	NamespaceNotFoundReason = "NamespaceNotFound"
+
+	// NamespaceCreationFailedReason documents that the namespace the provider components are installed in
+	// could not be created.
+	NamespaceCreationFailedReason = "NamespaceCreationFailed"
+
+	// ApplyConflictReason documents that applying the provider components with server-side apply conflicts
+	// with fields owned by another field manager.
+	ApplyConflictReason = "ApplyConflict"
+
+	// ReadinessTimeoutReason documents that the provider components didn't become ready in time
+	// after being applied.
+	ReadinessTimeoutReason = "ReadinessTimeout"
+
+	// ContractMismatchReason documents that the provider version doesn't abide by a contract supported
+	// by the operator, or by the contract of the core provider.
+	ContractMismatchReason = "ContractMismatch"
+
+	// OperatorVersionTooOldReason documents that the provider version requires a newer operator than the
+	// running one, with the minimum operator version annotation of its metadata.
+	OperatorVersionTooOldReason = "OperatorVersionTooOld"
+
+	// UpgradeRolledBackReason documents that installing the target version of an upgrade failed, and the
+	// previously installed version was installed again.
+	UpgradeRolledBackReason = "UpgradeRolledBack"
+
+	// RollbackFailedReason documents that installing the target version of an upgrade failed, and installing
+	// the previously installed version again failed too.
+	RollbackFailedReason = "RollbackFailed"
+
+	// ManifestTransformFailedReason documents that the manifest transform webhook could not be called,
+	// timed out, or returned an error or invalid objects.
+	ManifestTransformFailedReason = "ManifestTransformFailed"
+
+	// ImageDigestResolutionFailedReason documents that the tag of a manager image could not be resolved to a
+	// digest with spec.requireDigest, e.g. because the registry is unreachable.
+	ImageDigestResolutionFailedReason = "ImageDigestResolutionFailed"
+
+	// WaitingForPodsDeletionReason documents that the pods of the previously installed version are still
+	// running or terminating, so the provider components are not installed again yet.
+	WaitingForPodsDeletionReason = "WaitingForPodsDeletion"
+
+	// DependentProvidersExistReason documents that the deletion of the core provider is blocked until the
+	// other providers, which depend on it, are deleted.
+	DependentProvidersExistReason = "DependentProvidersExist"
+)
+
+const (
+	// AdditionalManifestsAppliedCondition documents a Provider whose additional manifests have been applied.
+	AdditionalManifestsAppliedCondition clusterv1.ConditionType = "AdditionalManifestsApplied"
+
+	// AdditionalManifestsApplyFailedReason (Severity=Error) documents that the additional manifests
+	// referenced by the provider could not be loaded or applied.
+	AdditionalManifestsApplyFailedReason = "AdditionalManifestsApplyFailed"
+)
+
+const (
+	// AdditionalRBACAppliedCondition documents a Provider whose additional RBAC has been applied.
+	AdditionalRBACAppliedCondition clusterv1.ConditionType = "AdditionalRBACApplied"
+
+	// InvalidAdditionalRBACReason (Severity=Error) documents that the additional RBAC of the provider has
+	// invalid rules, or manifests of other kinds than the RBAC ones.
+	InvalidAdditionalRBACReason = "InvalidAdditionalRBAC"
+
+	// AdditionalRBACApplyFailedReason (Severity=Error) documents that the additional RBAC of the provider
+	// could not be loaded or applied.
+	AdditionalRBACApplyFailedReason = "AdditionalRBACApplyFailed"
+)
+
+const (
+	// CRDsEstablishedCondition documents a Provider with all its CustomResourceDefinitions established.
+	CRDsEstablishedCondition clusterv1.ConditionType = "CRDsEstablished"
+
+	// WaitingForCRDsEstablishedReason (Severity=Info) documents that some provider CustomResourceDefinitions
+	// are not established yet.
+	WaitingForCRDsEstablishedReason = "WaitingForCRDsEstablished"
+
+	// CRDsEstablishTimeoutReason (Severity=Error) documents that some provider CustomResourceDefinitions
+	// failed to become established in time.
+	CRDsEstablishTimeoutReason = "CRDsEstablishTimeout"
+)
+
+const (
+	// ProviderAvailableCondition documents a Provider with all its Deployments available.
+	ProviderAvailableCondition clusterv1.ConditionType = "ProviderAvailable"
+
+	// DeploymentUnavailableReason (Severity=Warning) documents that a provider Deployment is not available yet.
+	DeploymentUnavailableReason = "DeploymentUnavailable"
+
+	// DeploymentProgressDeadlineExceededReason (Severity=Error) documents that a provider Deployment
+	// failed to become available within its progress deadline.
+	DeploymentProgressDeadlineExceededReason = "DeploymentProgressDeadlineExceeded"
+)
+
+const (
+	// ImageOverriddenCondition documents a Provider whose manager image is overridden by spec.deployment.image.
+	ImageOverriddenCondition clusterv1.ConditionType = "ImageOverridden"
+
+	// ImageOverrideAppliedReason documents that the manager image override is applied to the provider Deployment.
+	ImageOverrideAppliedReason = "ImageOverrideApplied"
+)
+
+const (
+	// ContractSkewToleratedCondition documents a Provider abiding by a contract that doesn't match the one
+	// of the core provider, but is tolerated by spec.contractPolicy.
+	ContractSkewToleratedCondition clusterv1.ConditionType = "ContractSkewTolerated"
+
+	// ToleratedContractReason documents that the provider contract is in spec.contractPolicy.toleratedContracts.
+	ToleratedContractReason = "ToleratedContract"
+)
+
+const (
+	// UpgradeAvailableCondition documents a Provider with the manual upgrade strategy for which a newer
+	// version is available.
+	UpgradeAvailableCondition clusterv1.ConditionType = "UpgradeAvailable"
+
+	// NewerVersionAvailableReason documents that a newer version is available in the provider channel
+	// or version constraint.
+	NewerVersionAvailableReason = "NewerVersionAvailable"
+)
+
+const (
+	// UpgradeAwaitingApprovalCondition documents a Provider with spec.upgrade.requireApproval whose upgrade to a
+	// new version is prepared, and waiting for the approve upgrade annotation to be applied. It's removed once the
+	// approved upgrade is applied, or if the target version is the installed one again.
+	UpgradeAwaitingApprovalCondition clusterv1.ConditionType = "UpgradeAwaitingApproval"
+
+	// WaitingForApprovalReason documents that the upgrade is waiting for the approve upgrade annotation
+	// to be set to the target version.
+	WaitingForApprovalReason = "WaitingForApproval"
+
+	// UpgradeApprovedReason documents that the upgrade is approved and being applied.
+	UpgradeApprovedReason = "UpgradeApproved"
+)
+
+const (
+	// UpgradeQueuedCondition documents a Provider whose upgrade waits for the providers of the earlier upgrade
+	// stages, in the Core, Bootstrap, ControlPlane, Infrastructure, Addon order, to be upgraded and Ready.
+	UpgradeQueuedCondition clusterv1.ConditionType = "UpgradeQueued"
+
+	// WaitingForEarlierStagesReason documents that the upgrade waits for providers of earlier stages that have
+	// a pending upgrade or aren't Ready.
+	WaitingForEarlierStagesReason = "WaitingForEarlierStages"
+)
+
+const (
+	// PostInstallHookCompletedCondition documents a Provider with spec.hooks.postInstall whose post-install Job
+	// completed for the installed version. The provider isn't Ready until it does.
+	PostInstallHookCompletedCondition clusterv1.ConditionType = "PostInstallHookCompleted"
+
+	// PostInstallHookRunningReason (Severity=Info) documents that the post-install Job is running.
+	PostInstallHookRunningReason = "PostInstallHookRunning"
+
+	// PostInstallHookFailedReason (Severity=Error) documents that the post-install Job failed. It isn't retried
+	// until its template or the installed version change.
+	PostInstallHookFailedReason = "PostInstallHookFailed"
+
+	// PostInstallHookTimeoutReason (Severity=Error) documents that the post-install Job didn't complete within
+	// its timeout.
+	PostInstallHookTimeoutReason = "PostInstallHookTimeout"
+)
+
+const (
+	// AutoUpgradePendingCondition documents a Provider with an automatic upgrade that is being held back.
+	AutoUpgradePendingCondition clusterv1.ConditionType = "AutoUpgradePending"
+
+	// ContractChangeHeldBackReason documents that an automatic upgrade is held back because it would change
+	// the provider contract without the core provider also moving to the new contract.
+	ContractChangeHeldBackReason = "ContractChangeHeldBack"
+)
+
+const (
+	// UpgradeTargetUnavailableCondition documents a Provider for which no version in the channel or version
+	// constraint can be installed, as none of them abides by the contract of the core provider.
+	UpgradeTargetUnavailableCondition clusterv1.ConditionType = "UpgradeTargetUnavailable"
+
+	// NoMatchingReleaseSeriesReason documents that no release series of the provider metadata matching
+	// the candidate versions has a contract allowed with the one of the core provider.
+	NoMatchingReleaseSeriesReason = "NoMatchingReleaseSeries"
+)
+
+const (
+	// UpgradeCheckFailedCondition documents an installed Provider for which the periodic check for a newer version
+	// failed, e.g. because its repository can't be reached. The installed version keeps running, and the check is
+	// retried on the next resync. The condition reason is the one of the failed phase, e.g. DownloadFailed.
+	UpgradeCheckFailedCondition clusterv1.ConditionType = "UpgradeCheckFailed"
+
+	// UpgradeCheckErrorReason documents that the versions were listed but no candidate could be picked, e.g.
+	// because none matches the channel and version constraint.
+	UpgradeCheckErrorReason = "UpgradeCheckError"
+)
+
+const (
+	// ComponentsDriftedCondition documents a Provider whose installed components differ from the ones
+	// last applied, as rendered from its manifests, e.g. after manual edits.
+	ComponentsDriftedCondition clusterv1.ConditionType = "ComponentsDrifted"
+
+	// DriftDetectedReason documents that installed components differ from the ones last applied.
+	DriftDetectedReason = "DriftDetected"
+
+	// DriftCorrectedReason documents that the drifted components were applied again, as spec.enforceNoDrift is set
+	// or they were deleted Deployments.
+	DriftCorrectedReason = "DriftCorrected"
+
+	// ImageDigestMismatchReason documents that Deployments run other images than the ones pinned to digests
+	// with spec.requireDigest.
+	ImageDigestMismatchReason = "ImageDigestMismatch"
+)
+
+const (
+	// InstallFailedCondition documents a Provider whose desired version couldn't be installed within
+	// spec.installTimeout. The operator stops retrying until spec.version or spec.installTimeout change.
+	InstallFailedCondition clusterv1.ConditionType = "InstallFailed"
+
+	// InstallTimeoutExceededReason documents that the install of the desired version didn't complete
+	// within spec.installTimeout.
+	InstallTimeoutExceededReason = "InstallTimeoutExceeded"
+)
+
+const (
+	// ProvidersSyncedCondition documents a ProviderBundle whose providers are created and in sync with the bundle.
+	ProvidersSyncedCondition clusterv1.ConditionType = "ProvidersSynced"
+
+	// WaitingForEarlierProvidersReason documents that the providers of a bundle wait for the providers of the
+	// earlier install stages, in the Core, Bootstrap, ControlPlane, Infrastructure order, to be Ready.
+	WaitingForEarlierProvidersReason = "WaitingForEarlierProviders"
+
+	// ProvidersSyncFailedReason documents a failure creating or updating the providers of a bundle.
+	ProvidersSyncFailedReason = "ProvidersSyncFailed"
+
+	// ProvidersNotReadyReason documents that some providers of a bundle aren't Ready.
+	ProvidersNotReadyReason = "ProvidersNotReady"
+)
+
+const (
+	// PendingChangesCondition documents the changes the operator would make to the cluster when running in
+	// audit mode, where it doesn't make any.
+	PendingChangesCondition clusterv1.ConditionType = "PendingChanges"
+
+	// AuditModeReason documents that the operator runs in audit mode, so the changes are computed but not applied.
+	AuditModeReason = "AuditMode"
+)
+
+const (
+	// ConventionalNamespaceCondition documents whether a Provider is installed in the namespace its components
+	// default to, e.g. capa-system for the AWS infrastructure provider, when the namespace conventions are checked.
+	ConventionalNamespaceCondition clusterv1.ConditionType = "ConventionalNamespace"
+
+	// NonConventionalNamespaceReason documents a Provider installed in another namespace than the one its
+	// components default to. The provider is still installed.
+	NonConventionalNamespaceReason = "NonConventionalNamespace"
 )
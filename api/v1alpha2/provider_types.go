@@ -17,7 +17,9 @@ limitations under the License.
 package v1alpha2
 
 import (
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
 )
@@ -25,11 +27,53 @@ import (
 const (
 	ProviderFinalizer         = "provider.cluster.x-k8s.io"
 	ConfigMapVersionLabelName = "provider.cluster.x-k8s.io/version"
+
+	// SkipContractValidationAnnotation, when set to "true" on a provider, makes the admission webhook accept,
+	// and the operator install, the provider even if its contract doesn't match the one of the core provider.
+	SkipContractValidationAnnotation = "operator.cluster.x-k8s.io/skip-contract-validation"
+
+	// ForceDeleteAnnotation, when set to "true" on the core provider, lets it be deleted while other providers
+	// still exist, e.g. in emergencies, leaving them without the core provider components.
+	ForceDeleteAnnotation = "operator.cluster.x-k8s.io/force-delete"
+
+	// ApproveUpgradeAnnotation approves the upgrade of a provider with spec.upgrade.requireApproval to the
+	// version it is set to. The operator removes it once the upgrade is applied.
+	ApproveUpgradeAnnotation = "operator.cluster.x-k8s.io/approve-upgrade"
+
+	// MinimumOperatorVersionAnnotation is set in the metadata of the metadata.yaml file of a provider release to
+	// the minimum operator version its manifests require, e.g. v0.5.0. Older operators refuse to install it.
+	MinimumOperatorVersionAnnotation = "operator.cluster.x-k8s.io/minimum-operator-version"
+)
+
+const (
+	// StableChannel is the release channel that only includes stable versions.
+	StableChannel = "stable"
+
+	// BetaChannel is the release channel that includes pre-release versions too.
+	BetaChannel = "beta"
+)
+
+const (
+	// AutoUpgradeStrategy lets the operator move the provider version as configured by `AutoUpgrade`.
+	AutoUpgradeStrategy UpgradeStrategyType = "Auto"
+
+	// ManualUpgradeStrategy freezes the provider version until `Version` is changed explicitly.
+	ManualUpgradeStrategy UpgradeStrategyType = "Manual"
+)
+
+const (
+	// ForegroundDeletionPolicy removes the provider CustomResourceDefinitions together with the provider.
+	ForegroundDeletionPolicy DeletionPolicyType = "Foreground"
+
+	// OrphanDeletionPolicy leaves the provider CustomResourceDefinitions in place when the provider is deleted.
+	OrphanDeletionPolicy DeletionPolicyType = "Orphan"
 )
 
 // ProviderSpec is the desired state of the Provider.
 type ProviderSpec struct {
-	// Version indicates the provider version.
+	// Version indicates the provider version. A patch wildcard, e.g. `v0.4.x`, keeps the provider on the newest
+	// patch release of the minor version, excluding pre-releases unless the `Channel` is `beta`, and upgrades it
+	// whenever a new patch release is found on resync.
 	// +optional
 	Version string `json:"version,omitempty"`
 
@@ -51,6 +95,12 @@ type ProviderSpec struct {
 	// +optional
 	ConfigSecret *SecretReference `json:"configSecret,omitempty"`
 
+	// ConfigSecretRef references a Secret holding a clusterctl configuration file, whose variables are
+	// used for the current provider instance only, as an alternative to listing them one by one in
+	// `ConfigSecret`. Variables set in `ConfigSecret` take precedence over the ones of the file.
+	// +optional
+	ConfigSecretRef *ClusterctlConfigReference `json:"configSecretRef,omitempty"`
+
 	// FetchConfig determines how the operator will fetch the components and metadata for the provider.
 	// If nil, the operator will try to fetch components according to default
 	// embedded fetch configuration for the given kind and `ObjectMeta.Name`.
@@ -60,11 +110,276 @@ type ProviderSpec struct {
 	FetchConfig *FetchConfiguration `json:"fetchConfig,omitempty"`
 
 	// AdditionalManifests is reference to configmap that contains additional manifests that will be applied
-	// together with the provider components. The key for storing these manifests has to be `manifests`.
-	// The manifests are applied only once when a certain release is installed/upgraded. If namespace is not specified, the
-	// namespace of the provider will be used. There is no validation of the yaml content inside the configmap.
+	// after the provider components are installed. Every key of the configmap holds manifests, and the keys are
+	// applied in lexical order. The manifests are applied only once when a certain release is installed/upgraded.
+	// If namespace is not specified, the namespace of the provider will be used, both for the configmap and for the
+	// namespaced manifests. The objects in the provider namespace are owned by the provider. There is no validation
+	// of the yaml content inside the configmap.
 	// +optional
 	AdditionalManifestsRef *ConfigmapReference `json:"additionalManifests,omitempty"`
+
+	// AdditionalRBAC grants the provider controllers permissions on top of the ones of the provider components,
+	// without forking the provider manifests. It's applied after the components are installed, and the objects
+	// created for it are deleted with the provider.
+	// +optional
+	AdditionalRBAC *AdditionalRBAC `json:"additionalRBAC,omitempty"`
+
+	// Channel is the release channel used for picking the provider version when `Version` is not set,
+	// or when `AutoUpgrade` is enabled. The newest version available in the channel is selected:
+	// `stable` excludes pre-releases, while `beta` includes them.
+	// +optional
+	// +kubebuilder:validation:Enum=stable;beta
+	Channel string `json:"channel,omitempty"`
+
+	// VersionConstraint is a semver constraint, e.g. `~1.5` or `>= 1.4.0, < 1.6.0`, restricting the
+	// versions picked when `Version` is not set, or when `AutoUpgrade` is enabled.
+	// +optional
+	VersionConstraint string `json:"versionConstraint,omitempty"`
+
+	// AutoUpgrade enables automatic upgrades of the provider to the newest version available in
+	// its `Channel` and satisfying its `VersionConstraint`. New versions are checked for on every resync.
+	// Upgrades that would change the provider contract are held back until the core provider moves to
+	// the new contract.
+	// +optional
+	AutoUpgrade bool `json:"autoUpgrade,omitempty"`
+
+	// UpgradeStrategy defines whether the operator may move the provider version. With `Manual`, the version
+	// is never changed once set, even if `AutoUpgrade` is enabled, and the newer versions available in the
+	// `Channel` or satisfying the `VersionConstraint` are reported in the `UpgradeAvailable` condition instead.
+	// Defaults to `Auto`.
+	// +optional
+	// +kubebuilder:validation:Enum=Manual;Auto
+	UpgradeStrategy UpgradeStrategyType `json:"upgradeStrategy,omitempty"`
+
+	// ReconcileInterval is how long to wait before reconciling the provider again while it's waiting
+	// for the core provider or for its components to become ready. Defaults to the operator
+	// `--reconcile-interval` flag. It must be at least 5s.
+	// +optional
+	ReconcileInterval *metav1.Duration `json:"reconcileInterval,omitempty"`
+
+	// Upgrade defines how the provider is upgraded to a new version.
+	// +optional
+	Upgrade *UpgradeOptions `json:"upgrade,omitempty"`
+
+	// SkipCRDs makes the operator install the provider components without their CustomResourceDefinitions,
+	// e.g. when the CRDs are managed centrally with GitOps. The CRDs must already exist: the provider is not
+	// installed until they do. The CRDs are then never updated nor deleted, whatever the deletion policy.
+	// +optional
+	SkipCRDs bool `json:"skipCRDs,omitempty"`
+
+	// ComponentSelector restricts the provider components installed by the operator to the ones matching it,
+	// e.g. only the CustomResourceDefinitions, so the components of a provider can be split between providers
+	// managed by different teams. When not set, all the components are installed.
+	// +optional
+	ComponentSelector *ComponentSelector `json:"componentSelector,omitempty"`
+
+	// ExcludeObjects lists the provider components that are never installed, e.g. a sample ClusterClass or a
+	// PodDisruptionBudget shipped with the manifests. They are removed right after the manifests are decoded.
+	// +optional
+	ExcludeObjects []ExcludedObject `json:"excludeObjects,omitempty"`
+
+	// EnforceNoDrift makes the operator apply the installed components again when they differ from the ones
+	// last applied, e.g. after manual edits, instead of only reporting the drift in the `ComponentsDrifted`
+	// condition. The deleted Deployments are created again regardless.
+	// +optional
+	EnforceNoDrift bool `json:"enforceNoDrift,omitempty"`
+
+	// RequireDigest makes the operator resolve the tags of the manager images of the provider Deployments to
+	// digests when installing a version, and pin the images to them, recording them in `status.pinnedImages`.
+	// The recorded digests are kept for the installed version, so the same images keep running when the tags
+	// move, and a Deployment running another image is reported in the `ComponentsDrifted` condition.
+	// +optional
+	RequireDigest bool `json:"requireDigest,omitempty"`
+
+	// ManifestTransformWebhook is a webhook the operator calls with the processed provider components, and whose
+	// returned objects are installed instead, e.g. to run the policy mutations of the organization on them.
+	// +optional
+	ManifestTransformWebhook *ManifestTransformWebhook `json:"manifestTransformWebhook,omitempty"`
+
+	// RetainManifestHistory is the number of ConfigMaps with the manifests downloaded for previous
+	// versions that are kept, e.g. for auditing which manifests were deployed at each version.
+	// Once the current version is installed, the oldest ConfigMaps beyond this number are deleted.
+	// When not set, the ConfigMaps of all the previous versions are kept.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	RetainManifestHistory *int `json:"retainManifestHistory,omitempty"`
+
+	// DeletionPolicy defines what happens to the provider CustomResourceDefinitions when the provider is
+	// deleted. The other installed components are always removed. With `Foreground` the CRDs are removed too,
+	// which deletes all the objects of those kinds, while `Orphan` leaves them in place like `clusterctl delete`
+	// does by default. Defaults to `Orphan`.
+	// +optional
+	// +kubebuilder:validation:Enum=Foreground;Orphan
+	DeletionPolicy DeletionPolicyType `json:"deletionPolicy,omitempty"`
+
+	// ContractPolicy defines the Cluster API contracts the provider may abide by. By default the
+	// provider contract must match the one of the core provider.
+	// +optional
+	ContractPolicy *ContractPolicy `json:"contractPolicy,omitempty"`
+
+	// DependsOn lists the providers that must be Ready before this provider is installed, e.g. a bootstrap
+	// provider whose webhooks the provider relies on. Non-core providers always wait for the core provider.
+	// +optional
+	DependsOn []ProviderDependency `json:"dependsOn,omitempty"`
+
+	// Hooks defines the Jobs the operator runs at points of the provider lifecycle.
+	// +optional
+	Hooks *ProviderHooks `json:"hooks,omitempty"`
+
+	// ApplyOrder lists kinds of the provider components, e.g. CustomResourceDefinition, in the order they are
+	// applied, replacing the default order: Namespaces, CustomResourceDefinitions, RBAC, the other components,
+	// then the custom resources of the provider CRDs. Components of the kinds not listed are applied last.
+	// Components of the same rank keep the order of the manifests.
+	// +optional
+	// +listType=set
+	ApplyOrder []string `json:"applyOrder,omitempty"`
+
+	// InstallTimeout is how long the operator retries installing the desired version, counting from the first
+	// reconcile of that version, before it stops and sets the `InstallFailed` condition. It's reset when
+	// `spec.version` changes. When not set, the operator retries indefinitely.
+	// +optional
+	InstallTimeout *metav1.Duration `json:"installTimeout,omitempty"`
+}
+
+// AdditionalRBAC defines the permissions granted to the provider controllers in addition to the ones
+// of the provider components.
+type AdditionalRBAC struct {
+	// Rules are granted to the service accounts of the provider Deployments with a ClusterRole and
+	// a ClusterRoleBinding managed by the operator.
+	// +optional
+	Rules []rbacv1.PolicyRule `json:"rules,omitempty"`
+
+	// ManifestsRef is a reference to a configmap holding RBAC manifests, i.e. Roles, ClusterRoles, RoleBindings
+	// and ClusterRoleBindings, processed as the additional manifests. Other kinds are rejected, and so are
+	// bindings with subjects other than the service accounts of the provider Deployments.
+	// +optional
+	ManifestsRef *ConfigmapReference `json:"manifestsRef,omitempty"`
+}
+
+// ComponentSelector selects provider components by kind and labels. Components must match both to be selected.
+type ComponentSelector struct {
+	// Kinds lists the kinds of the selected components, e.g. CustomResourceDefinition. When empty, components
+	// of all kinds are selected.
+	// +optional
+	Kinds []string `json:"kinds,omitempty"`
+
+	// LabelSelector selects the components by their labels. When not set, components with any labels are selected.
+	// +optional
+	LabelSelector *metav1.LabelSelector `json:"labelSelector,omitempty"`
+}
+
+// ExcludedObject matches provider components by API version, kind and name. Components must match all of them
+// to be excluded.
+type ExcludedObject struct {
+	// APIVersion of the excluded components, e.g. cluster.x-k8s.io/v1beta1. When empty, components of all API
+	// versions are excluded.
+	// +optional
+	APIVersion string `json:"apiVersion,omitempty"`
+
+	// Kind of the excluded components, e.g. ClusterClass.
+	// +kubebuilder:validation:MinLength=1
+	Kind string `json:"kind"`
+
+	// Name of the excluded components, or a shell pattern matching it, e.g. quick-start-*.
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+}
+
+// ManifestTransformWebhook defines a webhook transforming the provider components before they are installed.
+type ManifestTransformWebhook struct {
+	// URL is the https URL the components are posted to.
+	URL string `json:"url"`
+
+	// CABundleRef references the CA bundle trusted for the webhook server certificate, in addition to the
+	// system roots.
+	// +optional
+	CABundleRef *CABundleReference `json:"caBundleRef,omitempty"`
+
+	// Timeout is how long to wait for the webhook to respond. Defaults to 10s.
+	// +optional
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+}
+
+// ProviderDependency references a provider another one depends on.
+type ProviderDependency struct {
+	// Kind of the provider, e.g. BootstrapProvider.
+	// +kubebuilder:validation:Enum=CoreProvider;BootstrapProvider;ControlPlaneProvider;InfrastructureProvider;AddonProvider
+	Kind string `json:"kind"`
+
+	// Name of the provider.
+	Name string `json:"name"`
+
+	// Namespace of the provider. Defaults to the namespace of the dependent provider.
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// ProviderHooks defines the Jobs run at points of the provider lifecycle.
+type ProviderHooks struct {
+	// PostInstall is a Job run once the provider components are installed and available, e.g. to migrate
+	// data or bootstrap credentials. It runs once per installed version and Job template.
+	// +optional
+	PostInstall *JobHook `json:"postInstall,omitempty"`
+}
+
+// JobHook defines a Job run by the operator in the provider namespace.
+type JobHook struct {
+	// Template is the template of the Job. The operator names it after the provider, and owns it.
+	// The template isn't validated by the provider CRDs, which would otherwise embed the whole pod schema,
+	// but by the API server when the Job is created.
+	// +kubebuilder:validation:Schemaless
+	// +kubebuilder:validation:Type=object
+	// +kubebuilder:pruning:PreserveUnknownFields
+	Template batchv1.JobTemplateSpec `json:"template"`
+
+	// Timeout is how long the Job may run before it's failed, unless the template sets
+	// activeDeadlineSeconds. Defaults to 10m.
+	// +optional
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+
+	// RetentionPeriod is how long finished Jobs are kept before they are deleted, along with
+	// their pods. Defaults to 24h.
+	// +optional
+	RetentionPeriod *metav1.Duration `json:"retentionPeriod,omitempty"`
+}
+
+// ContractPolicy defines the Cluster API contracts a provider may abide by, besides the one of the core provider.
+type ContractPolicy struct {
+	// ToleratedContracts lists the contracts the provider may abide by when they don't match the one of
+	// the core provider, e.g. the next contract while the providers of a fleet are upgraded one by one.
+	// The contract must still be supported by the operator.
+	// +optional
+	ToleratedContracts []string `json:"toleratedContracts,omitempty"`
+}
+
+// DeletionPolicyType defines what happens to the provider CustomResourceDefinitions when the provider is deleted.
+type DeletionPolicyType string
+
+// UpgradeStrategyType defines whether the operator may move the provider version.
+type UpgradeStrategyType string
+
+// UpgradeOptions defines how the provider is upgraded to a new version.
+type UpgradeOptions struct {
+	// SkipCRDs makes upgrades, and any other reinstall of the provider components, leave the installed
+	// CustomResourceDefinitions untouched, and only reinstall the other provider components. CRDs that are
+	// new in the target version are still installed.
+	// This is only safe when the CRD schemas are unchanged between the installed and the target version,
+	// e.g. between patch versions: otherwise the new provider version runs against outdated CRDs.
+	// +optional
+	SkipCRDs bool `json:"skipCRDs,omitempty"`
+
+	// RollbackOnFailure makes the operator install the previously installed version again, on a best-effort basis,
+	// when installing the target version fails, so the provider doesn't remain without components. The CRDs of
+	// the target version that were already applied are not reverted.
+	// +optional
+	RollbackOnFailure bool `json:"rollbackOnFailure,omitempty"`
+
+	// RequireApproval makes the operator prepare upgrades to a new version, downloading and checking the
+	// manifests of the target version and setting the UpgradeAwaitingApproval condition, without applying them
+	// until the operator.cluster.x-k8s.io/approve-upgrade annotation is set to the target version. The installed
+	// components are kept meanwhile. Reinstalls of the same version don't require approval.
+	// +optional
+	RequireApproval bool `json:"requireApproval,omitempty"`
 }
 
 // ConfigmapReference contains enough information to locate the configmap.
@@ -87,6 +402,20 @@ type SecretReference struct {
 	Namespace string `json:"namespace,omitempty"`
 }
 
+// ClusterctlConfigReference contains enough information to locate a clusterctl configuration file.
+type ClusterctlConfigReference struct {
+	// Name defines the name of the secret.
+	Name string `json:"name"`
+
+	// Namespace defines the namespace of the secret. Defaults to the namespace of the provider.
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+
+	// Key is the key in the secret data that holds the configuration file. Defaults to `clusterctl.yaml`.
+	// +optional
+	Key string `json:"key,omitempty"`
+}
+
 // ManagerSpec defines the properties that can be enabled on the controller manager for the provider.
 type ManagerSpec struct {
 	// ControllerManagerConfiguration defines the desired state of GenericControllerManagerConfiguration.
@@ -105,12 +434,19 @@ type ManagerSpec struct {
 	MaxConcurrentReconciles int `json:"maxConcurrentReconciles,omitempty"`
 
 	// Verbosity set the logs verbosity. Defaults to 1.
-	// Controller Manager flag is --verbosity.
+	// Controller Manager flag is --v.
 	// +optional
 	// +kubebuilder:default=1
 	// +kubebuilder:validation:Minimum=0
 	Verbosity int `json:"verbosity,omitempty"`
 
+	// LogFormat sets the logs format, either text or json, overriding the one set in
+	// the fetched manifests. Defaults to the format of the fetched manifests, usually text.
+	// Controller Manager flag is --logging-format.
+	// +optional
+	// +kubebuilder:validation:Enum=text;json
+	LogFormat string `json:"logFormat,omitempty"`
+
 	// FeatureGates define provider specific feature flags that will be passed
 	// in as container args to the provider's controller manager.
 	// Controller Manager flag is --feature-gates.
@@ -119,9 +455,11 @@ type ManagerSpec struct {
 
 // DeploymentSpec defines the properties that can be enabled on the Deployment for the provider.
 type DeploymentSpec struct {
-	// Number of desired pods. This is a pointer to distinguish between explicit zero and not specified. Defaults to 1.
+	// Number of desired pods. The Deployment is rendered with it on install and upgrade, so
+	// highly available providers don't have to be scaled after they are installed. It must be
+	// at least 1. Defaults to the replicas in the fetched manifests, usually 1.
 	// +optional
-	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Minimum=1
 	Replicas *int `json:"replicas,omitempty"`
 
 	// NodeSelector is a selector which must be true for the pod to fit on a node.
@@ -142,13 +480,89 @@ type DeploymentSpec struct {
 	// +optional
 	Containers []ContainerSpec `json:"containers"`
 
-	// If specified, the pod's service account
+	// If specified, the pod's service account. When it differs from the one of the
+	// manifests, the ServiceAccount of the manifests isn't created and its bindings
+	// are granted to this one, which must exist in the provider namespace.
 	// +optional
 	ServiceAccountName string `json:"serviceAccountName,omitempty"`
 
-	// List of image pull secrets specified in the Deployment
+	// ServiceAccountAnnotations are added to the ServiceAccount the provider pods run as,
+	// e.g. eks.amazonaws.com/role-arn for IRSA or iam.gke.io/gcp-service-account for
+	// Workload Identity. They are set on the ServiceAccount of the manifests, or on the
+	// external one referenced by ServiceAccountName, overriding the existing values.
+	// +optional
+	ServiceAccountAnnotations map[string]string `json:"serviceAccountAnnotations,omitempty"`
+
+	// List of image pull secrets specified in the Deployment. They are added to the
+	// image pull secrets of the Deployment and of the provider ServiceAccounts it uses.
 	// +optional
 	ImagePullSecrets []corev1.LocalObjectReference `json:"imagePullSecrets,omitempty"`
+
+	// SecurityContext holds pod-level security attributes. Set fields are merged
+	// into the security context from the fetched manifests, overriding it.
+	// +optional
+	SecurityContext *corev1.PodSecurityContext `json:"securityContext,omitempty"`
+
+	// ContainerSecurityContext holds security attributes applied to all the
+	// containers in the Deployment. Set fields are merged into the container
+	// security contexts from the fetched manifests, overriding them.
+	// +optional
+	ContainerSecurityContext *corev1.SecurityContext `json:"containerSecurityContext,omitempty"`
+
+	// Image overrides the image of the manager container independently of the
+	// provider version. It takes precedence over the image in the fetched manifests
+	// and over the ImageURL of the manager container in Containers.
+	// +optional
+	Image *ImageReference `json:"image,omitempty"`
+
+	// AdditionalVolumes are added to the volumes of the Deployment, e.g. to provide
+	// a credentials file or a projected service account token to the provider.
+	// Mount them into containers with ContainerSpec.VolumeMounts. Their names must not
+	// collide with the volumes from the fetched manifests.
+	// +optional
+	AdditionalVolumes []corev1.Volume `json:"additionalVolumes,omitempty"`
+
+	// PriorityClassName is the priority class of the provider pods, e.g. system-cluster-critical
+	// so the provider controllers are not evicted before the workloads on node pressure.
+	// The priority class must exist, which is verified by the API server.
+	// +optional
+	// +kubebuilder:validation:MinLength=1
+	PriorityClassName string `json:"priorityClassName,omitempty"`
+
+	// InitContainers are appended to the init containers of the Deployment, e.g. to fetch
+	// credentials or run migrations before the provider starts. Their names must be unique
+	// and must not collide with the containers from the fetched manifests.
+	// +optional
+	InitContainers []corev1.Container `json:"initContainers,omitempty"`
+
+	// TerminationGracePeriodSeconds is how long the provider pods are given to shut down gracefully
+	// once deleted, e.g. for controllers draining long running operations. The pods of the previous
+	// version are waited for during upgrades, however long it takes.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	TerminationGracePeriodSeconds *int64 `json:"terminationGracePeriodSeconds,omitempty"`
+
+	// AdditionalPorts are added to the ports of the manager container, e.g. to expose a profiling
+	// endpoint to an observability add-on. Their names and numbers must be unique and must not
+	// collide with the ports of the containers from the fetched manifests.
+	// +optional
+	AdditionalPorts []corev1.ContainerPort `json:"additionalPorts,omitempty"`
+}
+
+// ImageReference defines a container image by repository, tag and digest.
+type ImageReference struct {
+	// Repository is the fully qualified image repository including the registry and
+	// the image name, e.g. registry.k8s.io/cluster-api/cluster-api-controller.
+	Repository string `json:"repository"`
+
+	// Tag is the image tag, e.g. v1.5.1.
+	// +optional
+	Tag string `json:"tag,omitempty"`
+
+	// Digest is the image digest, e.g. sha256:<hex>. When both Tag and Digest
+	// are set the digest is what the container runtime pulls.
+	// +optional
+	Digest string `json:"digest,omitempty"`
 }
 
 // ContainerSpec defines the properties available to override for each
@@ -181,6 +595,12 @@ type ContainerSpec struct {
 
 	// Command allows override container's entrypoint array.
 	Command []string `json:"command,omitempty"`
+
+	// VolumeMounts are added to the volume mounts of the container. They can reference
+	// DeploymentSpec.AdditionalVolumes or the volumes from the fetched manifests. Their
+	// mount paths must not collide with the mounts from the fetched manifests.
+	// +optional
+	VolumeMounts []corev1.VolumeMount `json:"volumeMounts,omitempty"`
 }
 
 // FetchConfiguration determines the way to fetch the components and metadata for the provider.
@@ -189,6 +609,8 @@ type FetchConfiguration struct {
 	// For example, https://github.com/{owner}/{repository}/releases
 	// You must set `providerSpec.Version` field for operator to pick up
 	// desired version of the release from GitHub.
+	// It can also point to a release tarball (`.tar.gz`, `.tgz` or `.tar`) containing the
+	// metadata and components files, in which case `providerSpec.Version` is required.
 	// +optional
 	URL string `json:"url,omitempty"`
 
@@ -199,12 +621,152 @@ type FetchConfiguration struct {
 	// add a label like the following: provider.cluster.x-k8s.io/version=v1.4.3
 	// +optional
 	Selector *metav1.LabelSelector `json:"selector,omitempty"`
+
+	// OverridesConfigMapRef references a ConfigMap overriding the `components` and `metadata` files of
+	// `providerSpec.Version`, in the format of the `Selector` ConfigMaps, like the clusterctl overrides layer
+	// (`~/.cluster-api/overrides`), e.g. to test modified manifests during development. Each file present in
+	// the ConfigMap takes precedence over the one of the `Selector` ConfigMaps, which takes precedence over
+	// the one fetched from the remote repository, and nothing is downloaded when both files are overridden.
+	// `providerSpec.Version` is required. If namespace is not specified, the namespace of the provider will be used.
+	// +optional
+	OverridesConfigMapRef *ConfigmapReference `json:"overridesConfigMapRef,omitempty"`
+
+	// MetadataOverrideRef references a ConfigMap whose `metadata` key replaces the metadata file of
+	// every version of the provider, e.g. to add a release series missing from the published metadata,
+	// which blocks the contract resolution, without waiting for a new release. The `metadata` file of
+	// `OverridesConfigMapRef` still takes precedence for `providerSpec.Version`.
+	// If namespace is not specified, the namespace of the provider will be used.
+	// +optional
+	MetadataOverrideRef *ConfigmapReference `json:"metadataOverrideRef,omitempty"`
+
+	// ConfigMapNamespace is the namespace the ConfigMaps with the downloaded manifests are stored in,
+	// and the only one `Selector` looks ConfigMaps up in, e.g. to keep the manifests of all the providers
+	// in a central namespace. Defaults to the provider namespace, with `Selector` looking up all the namespaces.
+	// Owner references can't cross namespaces, so ConfigMaps stored in another namespace are deleted
+	// with the provider, rather than garbage collected, and are left behind if its finalizer is removed manually.
+	// +optional
+	ConfigMapNamespace string `json:"configMapNamespace,omitempty"`
+
+	// CABundleRef references a PEM encoded CA bundle that is added to the trusted roots
+	// when fetching the provider's components and metadata from `URL`, e.g. when the
+	// manifests are hosted on a GitLab instance signed by a private CA.
+	// +optional
+	CABundleRef *CABundleReference `json:"caBundleRef,omitempty"`
+
+	// ComponentsPath overrides the name of the components file fetched from `URL`, for releases
+	// publishing it under a non-default name. Defaults to the components file of the repository,
+	// e.g. `infrastructure-components.yaml`.
+	// +optional
+	ComponentsPath string `json:"componentsPath,omitempty"`
+
+	// MetadataPath overrides the name of the metadata file fetched from `URL`, for releases
+	// publishing it under a non-default name. Defaults to `metadata.yaml`.
+	// +optional
+	MetadataPath string `json:"metadataPath,omitempty"`
+
+	// Git to be used for fetching the provider's components and metadata from a Git repository,
+	// for providers publishing them in the repository rather than as releases.
+	// `providerSpec.Version` is required, and `ComponentsPath` and `MetadataPath` are looked up
+	// relative to `Git.Path`.
+	// +optional
+	Git *GitSource `json:"git,omitempty"`
+
+	// Helm to be used for rendering the provider's components from a Helm chart, for providers
+	// distributed as charts. The chart must contain the provider `metadata.yaml`, or the file set
+	// by `MetadataPath`, at its root.
+	// +optional
+	Helm *HelmSource `json:"helm,omitempty"`
+}
+
+// HelmSource defines a Helm chart the provider's components are rendered from.
+// The chart is rendered with `helm template`, so it requires the `helm` executable in the operator image.
+type HelmSource struct {
+	// RepoURL is the URL of the chart repository, e.g. https://kubernetes-sigs.github.io/cluster-api-provider-aws,
+	// or of an OCI registry, e.g. oci://ghcr.io/owner/charts. Only HTTPS and OCI URLs are allowed.
+	RepoURL string `json:"repoURL"`
+
+	// Chart is the name of the chart in the repository.
+	Chart string `json:"chart"`
+
+	// Version is the chart version. Defaults to the provider version.
+	// +optional
+	Version string `json:"version,omitempty"`
+
+	// ValuesFrom references the values the chart is rendered with. Defaults to the chart values.
+	// +optional
+	ValuesFrom *HelmValuesReference `json:"valuesFrom,omitempty"`
+}
+
+// HelmValuesReference contains enough information to locate Helm chart values.
+// Exactly one of ConfigMap or Secret must be specified.
+type HelmValuesReference struct {
+	// ConfigMap is the config map containing the values. If namespace is not specified,
+	// the namespace of the provider will be used.
+	// +optional
+	ConfigMap *ConfigmapReference `json:"configMap,omitempty"`
+
+	// Secret is the secret containing the values, e.g. when they hold credentials. If namespace
+	// is not specified, the namespace of the provider will be used.
+	// +optional
+	Secret *SecretReference `json:"secret,omitempty"`
+
+	// Key is the key in the config map or secret data that holds the values. Defaults to `values.yaml`.
+	// +optional
+	Key string `json:"key,omitempty"`
+}
+
+// GitSource defines a Git repository the provider's components and metadata are fetched from.
+// Only the requested ref is fetched, without its history.
+type GitSource struct {
+	// URL of the repository, e.g. https://github.com/owner/repo.git or ssh://git@github.com/owner/repo.git.
+	// Only HTTPS and SSH URLs are allowed.
+	URL string `json:"url"`
+
+	// Ref is the branch, tag or commit to fetch. Defaults to the provider version, for repositories
+	// tagging their releases.
+	// +optional
+	Ref string `json:"ref,omitempty"`
+
+	// Path is the directory of the repository containing the components and metadata files.
+	// Defaults to the repository root.
+	// +optional
+	Path string `json:"path,omitempty"`
+
+	// SecretRef references a secret with the credentials for the repository. For SSH URLs it must
+	// contain an `ssh-privatekey` and the `known_hosts` of the server, for HTTPS URLs a `token` and
+	// optionally a `username`, which defaults to `git`. If namespace is not specified, the namespace
+	// of the provider will be used.
+	// +optional
+	SecretRef *SecretReference `json:"secretRef,omitempty"`
+}
+
+// CABundleReference contains enough information to locate a PEM encoded CA bundle.
+// Exactly one of ConfigMap or PEM must be specified.
+type CABundleReference struct {
+	// ConfigMap is the config map containing the CA bundle. If namespace is not specified,
+	// the namespace of the provider will be used.
+	// +optional
+	ConfigMap *ConfigmapReference `json:"configMap,omitempty"`
+
+	// Key is the key in the config map data that holds the CA bundle. Defaults to `ca.crt`.
+	// +optional
+	Key string `json:"key,omitempty"`
+
+	// PEM is an inline CA bundle. It may contain multiple concatenated certificates.
+	// +optional
+	PEM string `json:"pem,omitempty"`
+
+	// MountIntoDeployment defines whether the CA bundle should also be mounted into the provider
+	// controller Deployment, so the controller trusts it too. Only supported when the bundle is
+	// stored in a ConfigMap in the provider namespace.
+	// +optional
+	MountIntoDeployment bool `json:"mountIntoDeployment,omitempty"`
 }
 
 // ProviderStatus defines the observed state of the Provider.
 type ProviderStatus struct {
-	// Contract will contain the core provider contract that the provider is
-	// abiding by, like e.g. v1alpha4.
+	// Contract is the Cluster API contract the installed provider version is
+	// abiding by, like e.g. v1beta1, as declared in the provider metadata.
 	// +optional
 	Contract *string `json:"contract,omitempty"`
 
@@ -219,4 +781,88 @@ type ProviderStatus struct {
 	// InstalledVersion is the version of the provider that is installed.
 	// +optional
 	InstalledVersion *string `json:"installedVersion,omitempty"`
+
+	// FetchedFrom is the repository URL, or the ConfigMap, the installed provider components
+	// were fetched from.
+	// +optional
+	FetchedFrom *string `json:"fetchedFrom,omitempty"`
+
+	// LatestVersion is the newest version available in the provider's channel.
+	// +optional
+	LatestVersion *string `json:"latestVersion,omitempty"`
+
+	// ResolvedVersion is the version a `spec.version` wildcard, e.g. `v0.4.x`, resolves to.
+	// +optional
+	ResolvedVersion *string `json:"resolvedVersion,omitempty"`
+
+	// InstalledComponents is the list of objects installed for the provider, sorted by
+	// group, kind, namespace and name.
+	// +optional
+	InstalledComponents []ComponentReference `json:"installedComponents,omitempty"`
+
+	// AppliedComponentsHash is the SHA-256 hash of the provider components last applied, as customized
+	// by the provider spec, e.g. for GitOps tools to tell whether applying the components again changed them.
+	// +optional
+	AppliedComponentsHash *string `json:"appliedComponentsHash,omitempty"`
+
+	// LastReconcileTime is the time the operator last reconciled the provider, whatever the outcome.
+	// +optional
+	LastReconcileTime *metav1.Time `json:"lastReconcileTime,omitempty"`
+
+	// LastSuccessfulReconcileTime is the time the operator last completed all the reconciliation
+	// phases of the provider without error.
+	// +optional
+	LastSuccessfulReconcileTime *metav1.Time `json:"lastSuccessfulReconcileTime,omitempty"`
+
+	// LastUpgradeCheckTime is the time the operator last listed the provider versions to check for a newer
+	// one, whatever the outcome. The installed providers are checked again once every 10 minutes.
+	// +optional
+	LastUpgradeCheckTime *metav1.Time `json:"lastUpgradeCheckTime,omitempty"`
+
+	// InstallAttempt is the install of the desired version in progress, tracked if `spec.installTimeout` is set.
+	// +optional
+	InstallAttempt *InstallAttempt `json:"installAttempt,omitempty"`
+
+	// PinnedImages are the manager images of the installed version pinned to digests, with `spec.requireDigest`.
+	// +optional
+	PinnedImages []PinnedImage `json:"pinnedImages,omitempty"`
+}
+
+// PinnedImage is an image reference pinned to the digest its tag resolved to.
+type PinnedImage struct {
+	// Image is the image reference from the provider components, e.g. registry.k8s.io/cluster-api/cluster-api-controller:v1.5.1.
+	Image string `json:"image"`
+
+	// Digest is the digest the image tag resolved to, e.g. sha256:4d1c5....
+	Digest string `json:"digest"`
+}
+
+// InstallAttempt is an install of a provider version in progress.
+type InstallAttempt struct {
+	// Version is the `spec.version` being installed.
+	// +optional
+	Version string `json:"version,omitempty"`
+
+	// StartTime is the time of the first reconcile of the version.
+	StartTime metav1.Time `json:"startTime"`
+}
+
+// ComponentReference contains enough information to locate an installed provider component.
+type ComponentReference struct {
+	// Group is the API group of the component.
+	// +optional
+	Group string `json:"group,omitempty"`
+
+	// Version is the API version of the component.
+	Version string `json:"version"`
+
+	// Kind is the kind of the component.
+	Kind string `json:"kind"`
+
+	// Namespace is the namespace of the component, empty for cluster scoped components.
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+
+	// Name is the name of the component.
+	Name string `json:"name"`
 }
@@ -0,0 +1,138 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha2
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+)
+
+// ProviderBundleLabel is the label set on the providers created from a ProviderBundle, with the name of the bundle.
+const ProviderBundleLabel = "operator.cluster.x-k8s.io/provider-bundle"
+
+// ProviderBundleSpec defines the desired state of ProviderBundle.
+type ProviderBundleSpec struct {
+	// Core is the core provider of the bundle.
+	// +optional
+	Core *BundledProvider `json:"core,omitempty"`
+
+	// Bootstrap are the bootstrap providers of the bundle.
+	// +optional
+	Bootstrap []BundledProvider `json:"bootstrap,omitempty"`
+
+	// ControlPlane are the control plane providers of the bundle.
+	// +optional
+	ControlPlane []BundledProvider `json:"controlPlane,omitempty"`
+
+	// Infrastructure are the infrastructure providers of the bundle.
+	// +optional
+	Infrastructure []BundledProvider `json:"infrastructure,omitempty"`
+}
+
+// BundledProvider defines a provider of a ProviderBundle.
+type BundledProvider struct {
+	// Name of the provider, e.g. aws.
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+
+	// Namespace of the provider. It's created if it doesn't exist.
+	// +kubebuilder:validation:MinLength=1
+	Namespace string `json:"namespace"`
+
+	// Spec of the provider. The spec isn't validated by the ProviderBundle CRD, which would otherwise embed the
+	// provider schema for each type of provider and exceed the size limit of the API server objects, but by the
+	// ProviderBundle webhook, and by the provider CRD when the provider is created.
+	// +optional
+	// +kubebuilder:validation:Schemaless
+	// +kubebuilder:validation:Type=object
+	// +kubebuilder:pruning:PreserveUnknownFields
+	Spec ProviderSpec `json:"spec,omitempty"`
+}
+
+// ProviderBundleStatus defines the observed state of ProviderBundle.
+type ProviderBundleStatus struct {
+	// Providers reports the providers of the bundle, in install order.
+	// +optional
+	Providers []BundledProviderStatus `json:"providers,omitempty"`
+
+	// Conditions define the current service state of the bundle.
+	// +optional
+	Conditions clusterv1.Conditions `json:"conditions,omitempty"`
+
+	// ObservedGeneration is the latest generation observed by the controller.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+}
+
+// BundledProviderStatus reports a provider of a ProviderBundle.
+type BundledProviderStatus struct {
+	// Kind of the provider, e.g. BootstrapProvider.
+	Kind string `json:"kind"`
+
+	// Name of the provider.
+	Name string `json:"name"`
+
+	// Namespace of the provider.
+	Namespace string `json:"namespace"`
+
+	// InstalledVersion is the version of the provider that is installed.
+	// +optional
+	InstalledVersion *string `json:"installedVersion,omitempty"`
+
+	// Ready is the status of the Ready condition of the provider, Unknown until the provider is created.
+	Ready corev1.ConditionStatus `json:"ready"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:scope=Cluster
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Ready",type="string",JSONPath=".status.conditions[?(@.type=='Ready')].status"
+// +kubebuilder:storageversion
+
+// ProviderBundle is the Schema for the providerbundles API. It declares a set of providers, e.g. the ones of a
+// management cluster, which are created in install order and kept in sync with the bundle.
+type ProviderBundle struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ProviderBundleSpec   `json:"spec,omitempty"`
+	Status ProviderBundleStatus `json:"status,omitempty"`
+}
+
+// GetConditions returns the conditions of the bundle.
+func (b *ProviderBundle) GetConditions() clusterv1.Conditions {
+	return b.Status.Conditions
+}
+
+// SetConditions sets the conditions of the bundle.
+func (b *ProviderBundle) SetConditions(conditions clusterv1.Conditions) {
+	b.Status.Conditions = conditions
+}
+
+// +kubebuilder:object:root=true
+
+// ProviderBundleList contains a list of ProviderBundle.
+type ProviderBundleList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ProviderBundle `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&ProviderBundle{}, &ProviderBundleList{})
+}
@@ -23,6 +23,7 @@ package v1alpha2
 
 import (
 	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/component-base/config/v1alpha1"
@@ -30,6 +31,33 @@ import (
 	timex "time"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AdditionalRBAC) DeepCopyInto(out *AdditionalRBAC) {
+	*out = *in
+	if in.Rules != nil {
+		in, out := &in.Rules, &out.Rules
+		*out = make([]rbacv1.PolicyRule, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.ManifestsRef != nil {
+		in, out := &in.ManifestsRef, &out.ManifestsRef
+		*out = new(ConfigmapReference)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AdditionalRBAC.
+func (in *AdditionalRBAC) DeepCopy() *AdditionalRBAC {
+	if in == nil {
+		return nil
+	}
+	out := new(AdditionalRBAC)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *AddonProvider) DeepCopyInto(out *AddonProvider) {
 	*out = *in
@@ -212,6 +240,117 @@ func (in *BootstrapProviderStatus) DeepCopy() *BootstrapProviderStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BundledProvider) DeepCopyInto(out *BundledProvider) {
+	*out = *in
+	in.Spec.DeepCopyInto(&out.Spec)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BundledProvider.
+func (in *BundledProvider) DeepCopy() *BundledProvider {
+	if in == nil {
+		return nil
+	}
+	out := new(BundledProvider)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BundledProviderStatus) DeepCopyInto(out *BundledProviderStatus) {
+	*out = *in
+	if in.InstalledVersion != nil {
+		in, out := &in.InstalledVersion, &out.InstalledVersion
+		*out = new(string)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BundledProviderStatus.
+func (in *BundledProviderStatus) DeepCopy() *BundledProviderStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(BundledProviderStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CABundleReference) DeepCopyInto(out *CABundleReference) {
+	*out = *in
+	if in.ConfigMap != nil {
+		in, out := &in.ConfigMap, &out.ConfigMap
+		*out = new(ConfigmapReference)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CABundleReference.
+func (in *CABundleReference) DeepCopy() *CABundleReference {
+	if in == nil {
+		return nil
+	}
+	out := new(CABundleReference)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterctlConfigReference) DeepCopyInto(out *ClusterctlConfigReference) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterctlConfigReference.
+func (in *ClusterctlConfigReference) DeepCopy() *ClusterctlConfigReference {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterctlConfigReference)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ComponentReference) DeepCopyInto(out *ComponentReference) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ComponentReference.
+func (in *ComponentReference) DeepCopy() *ComponentReference {
+	if in == nil {
+		return nil
+	}
+	out := new(ComponentReference)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ComponentSelector) DeepCopyInto(out *ComponentSelector) {
+	*out = *in
+	if in.Kinds != nil {
+		in, out := &in.Kinds, &out.Kinds
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.LabelSelector != nil {
+		in, out := &in.LabelSelector, &out.LabelSelector
+		*out = new(v1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ComponentSelector.
+func (in *ComponentSelector) DeepCopy() *ComponentSelector {
+	if in == nil {
+		return nil
+	}
+	out := new(ComponentSelector)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ConfigmapReference) DeepCopyInto(out *ConfigmapReference) {
 	*out = *in
@@ -259,6 +398,13 @@ func (in *ContainerSpec) DeepCopyInto(out *ContainerSpec) {
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.VolumeMounts != nil {
+		in, out := &in.VolumeMounts, &out.VolumeMounts
+		*out = make([]corev1.VolumeMount, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ContainerSpec.
@@ -271,6 +417,26 @@ func (in *ContainerSpec) DeepCopy() *ContainerSpec {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ContractPolicy) DeepCopyInto(out *ContractPolicy) {
+	*out = *in
+	if in.ToleratedContracts != nil {
+		in, out := &in.ToleratedContracts, &out.ToleratedContracts
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ContractPolicy.
+func (in *ContractPolicy) DeepCopy() *ContractPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(ContractPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ControlPlaneProvider) DeepCopyInto(out *ControlPlaneProvider) {
 	*out = *in
@@ -607,11 +773,57 @@ func (in *DeploymentSpec) DeepCopyInto(out *DeploymentSpec) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.ServiceAccountAnnotations != nil {
+		in, out := &in.ServiceAccountAnnotations, &out.ServiceAccountAnnotations
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
 	if in.ImagePullSecrets != nil {
 		in, out := &in.ImagePullSecrets, &out.ImagePullSecrets
 		*out = make([]corev1.LocalObjectReference, len(*in))
 		copy(*out, *in)
 	}
+	if in.SecurityContext != nil {
+		in, out := &in.SecurityContext, &out.SecurityContext
+		*out = new(corev1.PodSecurityContext)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ContainerSecurityContext != nil {
+		in, out := &in.ContainerSecurityContext, &out.ContainerSecurityContext
+		*out = new(corev1.SecurityContext)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Image != nil {
+		in, out := &in.Image, &out.Image
+		*out = new(ImageReference)
+		**out = **in
+	}
+	if in.AdditionalVolumes != nil {
+		in, out := &in.AdditionalVolumes, &out.AdditionalVolumes
+		*out = make([]corev1.Volume, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.InitContainers != nil {
+		in, out := &in.InitContainers, &out.InitContainers
+		*out = make([]corev1.Container, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.TerminationGracePeriodSeconds != nil {
+		in, out := &in.TerminationGracePeriodSeconds, &out.TerminationGracePeriodSeconds
+		*out = new(int64)
+		**out = **in
+	}
+	if in.AdditionalPorts != nil {
+		in, out := &in.AdditionalPorts, &out.AdditionalPorts
+		*out = make([]corev1.ContainerPort, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DeploymentSpec.
@@ -624,6 +836,21 @@ func (in *DeploymentSpec) DeepCopy() *DeploymentSpec {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ExcludedObject) DeepCopyInto(out *ExcludedObject) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExcludedObject.
+func (in *ExcludedObject) DeepCopy() *ExcludedObject {
+	if in == nil {
+		return nil
+	}
+	out := new(ExcludedObject)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *FetchConfiguration) DeepCopyInto(out *FetchConfiguration) {
 	*out = *in
@@ -632,6 +859,31 @@ func (in *FetchConfiguration) DeepCopyInto(out *FetchConfiguration) {
 		*out = new(v1.LabelSelector)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.OverridesConfigMapRef != nil {
+		in, out := &in.OverridesConfigMapRef, &out.OverridesConfigMapRef
+		*out = new(ConfigmapReference)
+		**out = **in
+	}
+	if in.MetadataOverrideRef != nil {
+		in, out := &in.MetadataOverrideRef, &out.MetadataOverrideRef
+		*out = new(ConfigmapReference)
+		**out = **in
+	}
+	if in.CABundleRef != nil {
+		in, out := &in.CABundleRef, &out.CABundleRef
+		*out = new(CABundleReference)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Git != nil {
+		in, out := &in.Git, &out.Git
+		*out = new(GitSource)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Helm != nil {
+		in, out := &in.Helm, &out.Helm
+		*out = new(HelmSource)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FetchConfiguration.
@@ -644,6 +896,86 @@ func (in *FetchConfiguration) DeepCopy() *FetchConfiguration {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GitSource) DeepCopyInto(out *GitSource) {
+	*out = *in
+	if in.SecretRef != nil {
+		in, out := &in.SecretRef, &out.SecretRef
+		*out = new(SecretReference)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GitSource.
+func (in *GitSource) DeepCopy() *GitSource {
+	if in == nil {
+		return nil
+	}
+	out := new(GitSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HelmSource) DeepCopyInto(out *HelmSource) {
+	*out = *in
+	if in.ValuesFrom != nil {
+		in, out := &in.ValuesFrom, &out.ValuesFrom
+		*out = new(HelmValuesReference)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HelmSource.
+func (in *HelmSource) DeepCopy() *HelmSource {
+	if in == nil {
+		return nil
+	}
+	out := new(HelmSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HelmValuesReference) DeepCopyInto(out *HelmValuesReference) {
+	*out = *in
+	if in.ConfigMap != nil {
+		in, out := &in.ConfigMap, &out.ConfigMap
+		*out = new(ConfigmapReference)
+		**out = **in
+	}
+	if in.Secret != nil {
+		in, out := &in.Secret, &out.Secret
+		*out = new(SecretReference)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HelmValuesReference.
+func (in *HelmValuesReference) DeepCopy() *HelmValuesReference {
+	if in == nil {
+		return nil
+	}
+	out := new(HelmValuesReference)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ImageReference) DeepCopyInto(out *ImageReference) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ImageReference.
+func (in *ImageReference) DeepCopy() *ImageReference {
+	if in == nil {
+		return nil
+	}
+	out := new(ImageReference)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *InfrastructureProvider) DeepCopyInto(out *InfrastructureProvider) {
 	*out = *in
@@ -735,6 +1067,48 @@ func (in *InfrastructureProviderStatus) DeepCopy() *InfrastructureProviderStatus
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *InstallAttempt) DeepCopyInto(out *InstallAttempt) {
+	*out = *in
+	in.StartTime.DeepCopyInto(&out.StartTime)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new InstallAttempt.
+func (in *InstallAttempt) DeepCopy() *InstallAttempt {
+	if in == nil {
+		return nil
+	}
+	out := new(InstallAttempt)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *JobHook) DeepCopyInto(out *JobHook) {
+	*out = *in
+	in.Template.DeepCopyInto(&out.Template)
+	if in.Timeout != nil {
+		in, out := &in.Timeout, &out.Timeout
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.RetentionPeriod != nil {
+		in, out := &in.RetentionPeriod, &out.RetentionPeriod
+		*out = new(v1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new JobHook.
+func (in *JobHook) DeepCopy() *JobHook {
+	if in == nil {
+		return nil
+	}
+	out := new(JobHook)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ManagerSpec) DeepCopyInto(out *ManagerSpec) {
 	*out = *in
@@ -758,6 +1132,210 @@ func (in *ManagerSpec) DeepCopy() *ManagerSpec {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ManifestTransformWebhook) DeepCopyInto(out *ManifestTransformWebhook) {
+	*out = *in
+	if in.CABundleRef != nil {
+		in, out := &in.CABundleRef, &out.CABundleRef
+		*out = new(CABundleReference)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Timeout != nil {
+		in, out := &in.Timeout, &out.Timeout
+		*out = new(v1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ManifestTransformWebhook.
+func (in *ManifestTransformWebhook) DeepCopy() *ManifestTransformWebhook {
+	if in == nil {
+		return nil
+	}
+	out := new(ManifestTransformWebhook)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PinnedImage) DeepCopyInto(out *PinnedImage) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PinnedImage.
+func (in *PinnedImage) DeepCopy() *PinnedImage {
+	if in == nil {
+		return nil
+	}
+	out := new(PinnedImage)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ProviderBundle) DeepCopyInto(out *ProviderBundle) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ProviderBundle.
+func (in *ProviderBundle) DeepCopy() *ProviderBundle {
+	if in == nil {
+		return nil
+	}
+	out := new(ProviderBundle)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ProviderBundle) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ProviderBundleList) DeepCopyInto(out *ProviderBundleList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]ProviderBundle, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ProviderBundleList.
+func (in *ProviderBundleList) DeepCopy() *ProviderBundleList {
+	if in == nil {
+		return nil
+	}
+	out := new(ProviderBundleList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ProviderBundleList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ProviderBundleSpec) DeepCopyInto(out *ProviderBundleSpec) {
+	*out = *in
+	if in.Core != nil {
+		in, out := &in.Core, &out.Core
+		*out = new(BundledProvider)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Bootstrap != nil {
+		in, out := &in.Bootstrap, &out.Bootstrap
+		*out = make([]BundledProvider, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.ControlPlane != nil {
+		in, out := &in.ControlPlane, &out.ControlPlane
+		*out = make([]BundledProvider, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Infrastructure != nil {
+		in, out := &in.Infrastructure, &out.Infrastructure
+		*out = make([]BundledProvider, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ProviderBundleSpec.
+func (in *ProviderBundleSpec) DeepCopy() *ProviderBundleSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ProviderBundleSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ProviderBundleStatus) DeepCopyInto(out *ProviderBundleStatus) {
+	*out = *in
+	if in.Providers != nil {
+		in, out := &in.Providers, &out.Providers
+		*out = make([]BundledProviderStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make(v1beta1.Conditions, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ProviderBundleStatus.
+func (in *ProviderBundleStatus) DeepCopy() *ProviderBundleStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ProviderBundleStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ProviderDependency) DeepCopyInto(out *ProviderDependency) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ProviderDependency.
+func (in *ProviderDependency) DeepCopy() *ProviderDependency {
+	if in == nil {
+		return nil
+	}
+	out := new(ProviderDependency)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ProviderHooks) DeepCopyInto(out *ProviderHooks) {
+	*out = *in
+	if in.PostInstall != nil {
+		in, out := &in.PostInstall, &out.PostInstall
+		*out = new(JobHook)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ProviderHooks.
+func (in *ProviderHooks) DeepCopy() *ProviderHooks {
+	if in == nil {
+		return nil
+	}
+	out := new(ProviderHooks)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ProviderSpec) DeepCopyInto(out *ProviderSpec) {
 	*out = *in
@@ -776,6 +1354,11 @@ func (in *ProviderSpec) DeepCopyInto(out *ProviderSpec) {
 		*out = new(SecretReference)
 		**out = **in
 	}
+	if in.ConfigSecretRef != nil {
+		in, out := &in.ConfigSecretRef, &out.ConfigSecretRef
+		*out = new(ClusterctlConfigReference)
+		**out = **in
+	}
 	if in.FetchConfig != nil {
 		in, out := &in.FetchConfig, &out.FetchConfig
 		*out = new(FetchConfiguration)
@@ -786,6 +1369,66 @@ func (in *ProviderSpec) DeepCopyInto(out *ProviderSpec) {
 		*out = new(ConfigmapReference)
 		**out = **in
 	}
+	if in.AdditionalRBAC != nil {
+		in, out := &in.AdditionalRBAC, &out.AdditionalRBAC
+		*out = new(AdditionalRBAC)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ReconcileInterval != nil {
+		in, out := &in.ReconcileInterval, &out.ReconcileInterval
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.Upgrade != nil {
+		in, out := &in.Upgrade, &out.Upgrade
+		*out = new(UpgradeOptions)
+		**out = **in
+	}
+	if in.ComponentSelector != nil {
+		in, out := &in.ComponentSelector, &out.ComponentSelector
+		*out = new(ComponentSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ExcludeObjects != nil {
+		in, out := &in.ExcludeObjects, &out.ExcludeObjects
+		*out = make([]ExcludedObject, len(*in))
+		copy(*out, *in)
+	}
+	if in.ManifestTransformWebhook != nil {
+		in, out := &in.ManifestTransformWebhook, &out.ManifestTransformWebhook
+		*out = new(ManifestTransformWebhook)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.RetainManifestHistory != nil {
+		in, out := &in.RetainManifestHistory, &out.RetainManifestHistory
+		*out = new(int)
+		**out = **in
+	}
+	if in.ContractPolicy != nil {
+		in, out := &in.ContractPolicy, &out.ContractPolicy
+		*out = new(ContractPolicy)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.DependsOn != nil {
+		in, out := &in.DependsOn, &out.DependsOn
+		*out = make([]ProviderDependency, len(*in))
+		copy(*out, *in)
+	}
+	if in.Hooks != nil {
+		in, out := &in.Hooks, &out.Hooks
+		*out = new(ProviderHooks)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ApplyOrder != nil {
+		in, out := &in.ApplyOrder, &out.ApplyOrder
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.InstallTimeout != nil {
+		in, out := &in.InstallTimeout, &out.InstallTimeout
+		*out = new(v1.Duration)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ProviderSpec.
@@ -818,6 +1461,53 @@ func (in *ProviderStatus) DeepCopyInto(out *ProviderStatus) {
 		*out = new(string)
 		**out = **in
 	}
+	if in.FetchedFrom != nil {
+		in, out := &in.FetchedFrom, &out.FetchedFrom
+		*out = new(string)
+		**out = **in
+	}
+	if in.LatestVersion != nil {
+		in, out := &in.LatestVersion, &out.LatestVersion
+		*out = new(string)
+		**out = **in
+	}
+	if in.ResolvedVersion != nil {
+		in, out := &in.ResolvedVersion, &out.ResolvedVersion
+		*out = new(string)
+		**out = **in
+	}
+	if in.InstalledComponents != nil {
+		in, out := &in.InstalledComponents, &out.InstalledComponents
+		*out = make([]ComponentReference, len(*in))
+		copy(*out, *in)
+	}
+	if in.AppliedComponentsHash != nil {
+		in, out := &in.AppliedComponentsHash, &out.AppliedComponentsHash
+		*out = new(string)
+		**out = **in
+	}
+	if in.LastReconcileTime != nil {
+		in, out := &in.LastReconcileTime, &out.LastReconcileTime
+		*out = (*in).DeepCopy()
+	}
+	if in.LastSuccessfulReconcileTime != nil {
+		in, out := &in.LastSuccessfulReconcileTime, &out.LastSuccessfulReconcileTime
+		*out = (*in).DeepCopy()
+	}
+	if in.LastUpgradeCheckTime != nil {
+		in, out := &in.LastUpgradeCheckTime, &out.LastUpgradeCheckTime
+		*out = (*in).DeepCopy()
+	}
+	if in.InstallAttempt != nil {
+		in, out := &in.InstallAttempt, &out.InstallAttempt
+		*out = new(InstallAttempt)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.PinnedImages != nil {
+		in, out := &in.PinnedImages, &out.PinnedImages
+		*out = make([]PinnedImage, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ProviderStatus.
@@ -844,3 +1534,18 @@ func (in *SecretReference) DeepCopy() *SecretReference {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *UpgradeOptions) DeepCopyInto(out *UpgradeOptions) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new UpgradeOptions.
+func (in *UpgradeOptions) DeepCopy() *UpgradeOptions {
+	if in == nil {
+		return nil
+	}
+	out := new(UpgradeOptions)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -21,12 +21,15 @@ import (
 	"fmt"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/spf13/pflag"
+	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/klog/v2"
@@ -36,6 +39,7 @@ import (
 	clusterctlv1 "sigs.k8s.io/cluster-api/cmd/clusterctl/api/v1alpha3"
 	"sigs.k8s.io/cluster-api/version"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
@@ -43,6 +47,7 @@ import (
 	operatorv1alpha1 "sigs.k8s.io/cluster-api-operator/api/v1alpha1"
 	operatorv1 "sigs.k8s.io/cluster-api-operator/api/v1alpha2"
 	providercontroller "sigs.k8s.io/cluster-api-operator/internal/controller"
+	"sigs.k8s.io/cluster-api-operator/internal/feature"
 )
 
 var (
@@ -59,9 +64,21 @@ var (
 	profilerAddress             string
 	concurrencyNumber           int
 	syncPeriod                  time.Duration
+	reconcileInterval           time.Duration
 	webhookPort                 int
 	webhookCertDir              string
 	healthAddr                  string
+	providerSummaryConfigMap    string
+	verifyPermissions           bool
+	skipSingleInstanceCheck     bool
+	maxConcurrentDownloads      int
+	serverSideApply             bool
+	fieldManager                string
+	registryMirror              string
+	watchNamespace              string
+	disableNamespaceCreation    bool
+	auditMode                   bool
+	checkNamespaceConventions   bool
 )
 
 func init() {
@@ -92,6 +109,9 @@ func InitFlags(fs *pflag.FlagSet) {
 	fs.DurationVar(&leaderElectionRetryPeriod, "leader-elect-retry-period", 2*time.Second,
 		"Duration the LeaderElector clients should wait between tries of actions (duration string)")
 
+	fs.StringVar(&watchNamespace, "namespace", "",
+		"Namespace that the operator watches to reconcile providers, e.g. to run one operator per tenant. Providers in other namespaces are ignored, and the ones in the namespace can't reference objects in other namespaces. If unspecified, the operator watches all the namespaces.")
+
 	fs.StringVar(&watchFilterValue, "watch-filter", "",
 		fmt.Sprintf("Label value that the controller watches to reconcile cluster-api objects. Label key is always %s. If unspecified, the controller watches for all cluster-api objects.", clusterv1.WatchLabel))
 
@@ -104,6 +124,9 @@ func InitFlags(fs *pflag.FlagSet) {
 	fs.DurationVar(&syncPeriod, "sync-period", 10*time.Minute,
 		"The minimum interval at which watched resources are reconciled (e.g. 15m)")
 
+	fs.DurationVar(&reconcileInterval, "reconcile-interval", 0,
+		"The interval at which providers waiting for the core provider or for their components to become ready are reconciled again (e.g. 30s). It can be overridden by each provider, and must be at least 5s. If unset, 30s is used while waiting for the core provider, and 10s while waiting for the components.")
+
 	fs.IntVar(&webhookPort, "webhook-port", 9443, "Webhook Server port")
 
 	fs.StringVar(&webhookCertDir, "webhook-cert-dir", "/tmp/k8s-webhook-server/serving-certs/",
@@ -111,6 +134,38 @@ func InitFlags(fs *pflag.FlagSet) {
 
 	fs.StringVar(&healthAddr, "health-addr", ":9440",
 		"The address the health endpoint binds to.")
+
+	fs.StringVar(&providerSummaryConfigMap, "provider-summary-configmap", "",
+		"The namespace/name of a ConfigMap the operator maintains with the type, version, contract and readiness of all the providers. Disabled if empty.")
+
+	fs.BoolVar(&verifyPermissions, "verify-permissions", false,
+		"Review that the operator is allowed to create all the provider components before installing them, reporting the missing permissions in the provider preflight condition.")
+
+	fs.BoolVar(&skipSingleInstanceCheck, "skip-single-instance-check", false,
+		"Allow providers of the same type and name in different namespaces, for topologies known to support several instances of a provider. Only one CoreProvider is allowed regardless.")
+
+	fs.IntVar(&maxConcurrentDownloads, "max-concurrent-downloads", 5,
+		"The maximum number of provider manifests downloads running at the same time across all the providers. The other providers retry after a jittered delay. Unlimited if 0.")
+
+	fs.BoolVar(&serverSideApply, "server-side-apply", false,
+		"Apply the provider components and additional manifests with server-side apply instead of creating or updating them, so that the fields also managed by other tools, e.g. GitOps ones, are reported as conflicts.")
+
+	fs.StringVar(&fieldManager, "field-manager", providercontroller.DefaultFieldManager,
+		"The field manager owning the fields applied with server-side apply.")
+
+	fs.StringVar(&registryMirror, "registry-mirror", "",
+		"A registry, e.g. mirror.example.com, replacing the registry of the images of all the providers, e.g. in air-gapped environments. The images overridden in the provider spec take precedence.")
+
+	fs.BoolVar(&disableNamespaceCreation, "disable-namespace-creation", false,
+		"Don't create nor update the namespaces the provider components are installed in, e.g. in clusters forbidding it. The namespaces must exist.")
+
+	fs.BoolVar(&auditMode, "audit-mode", false,
+		"Compute the changes the operator would make, e.g. the provider components to apply, without making them. The changes are reported in the PendingChanges condition of the providers, and only their status is updated.")
+
+	fs.BoolVar(&checkNamespaceConventions, "check-namespace-conventions", false,
+		"Report in the ConventionalNamespace condition of the providers whether they are installed in the namespace their components default to, e.g. capa-system. The providers are installed in other namespaces regardless.")
+
+	feature.MutableGates.AddFlag(fs)
 }
 
 func main() {
@@ -120,6 +175,9 @@ func main() {
 
 	ctrl.SetLogger(klogr.New())
 
+	// Record the rate limits reported by GitHub and GitLab when downloading the provider manifests.
+	http.DefaultTransport = providercontroller.NewRateLimitTransport(http.DefaultTransport)
+
 	if profilerAddress != "" {
 		klog.Infof("Profiler listening for requests at %s", profilerAddress)
 
@@ -133,19 +191,38 @@ func main() {
 		}()
 	}
 
+	leaderElectionID := "controller-leader-election-capi-operator"
+	cacheOptions := cache.Options{}
+	uncachedObjects := []client.Object{
+		&corev1.ConfigMap{},
+		&corev1.Secret{},
+		// Pods are only listed during upgrades, so they are not worth caching cluster-wide.
+		&corev1.Pod{},
+	}
+
+	// Restrict the cache to the namespaced objects of the watched namespace, cluster scoped ones such as CRDs are
+	// still watched. The core provider, usually in another namespace, is read from the API server instead, so
+	// the providers of the namespace can check it. Operators watching different namespaces elect their leaders
+	// separately.
+	if watchNamespace != "" {
+		setupLog.Info("Watching providers in a single namespace", "namespace", watchNamespace)
+
+		leaderElectionID = fmt.Sprintf("%s-%s", leaderElectionID, watchNamespace)
+		cacheOptions.Namespaces = []string{watchNamespace}
+		uncachedObjects = append(uncachedObjects, &operatorv1.CoreProvider{})
+	}
+
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
-		Scheme:             scheme,
-		MetricsBindAddress: metricsBindAddr,
-		LeaderElection:     enableLeaderElection,
-		LeaderElectionID:   "controller-leader-election-capi-operator",
-		LeaseDuration:      &leaderElectionLeaseDuration,
-		RenewDeadline:      &leaderElectionRenewDeadline,
-		RetryPeriod:        &leaderElectionRetryPeriod,
-		SyncPeriod:         &syncPeriod,
-		ClientDisableCacheFor: []client.Object{
-			&corev1.ConfigMap{},
-			&corev1.Secret{},
-		},
+		Scheme:                 scheme,
+		MetricsBindAddress:     metricsBindAddr,
+		LeaderElection:         enableLeaderElection,
+		LeaderElectionID:       leaderElectionID,
+		Cache:                  cacheOptions,
+		LeaseDuration:          &leaderElectionLeaseDuration,
+		RenewDeadline:          &leaderElectionRenewDeadline,
+		RetryPeriod:            &leaderElectionRetryPeriod,
+		SyncPeriod:             &syncPeriod,
+		ClientDisableCacheFor:  uncachedObjects,
 		Port:                   webhookPort,
 		CertDir:                webhookCertDir,
 		HealthProbeBindAddress: healthAddr,
@@ -158,8 +235,15 @@ func main() {
 	// Setup the context that's going to be used in controllers and for the manager.
 	ctx := ctrl.SetupSignalHandler()
 
-	setupChecks(mgr)
-	setupReconcilers(mgr)
+	cacheSync := setupCacheSync(mgr)
+	setupChecks(mgr, cacheSync)
+	summaryConfigMap, err := parseNamespacedName(providerSummaryConfigMap)
+	if err != nil {
+		setupLog.Error(err, "invalid provider summary ConfigMap")
+		os.Exit(1)
+	}
+
+	setupReconcilers(mgr, summaryConfigMap, cacheSync)
 	setupWebhooks(mgr)
 
 	// +kubebuilder:scaffold:builder
@@ -171,72 +255,196 @@ func main() {
 	}
 }
 
-func setupChecks(mgr ctrl.Manager) {
+// setupCacheSync adds a gate waiting for the informers of the objects read by the reconcilers to sync. The core
+// provider isn't cached when watching a single namespace.
+func setupCacheSync(mgr ctrl.Manager) *providercontroller.CacheSyncGate {
+	objects := []client.Object{
+		&operatorv1.BootstrapProvider{},
+		&operatorv1.ControlPlaneProvider{},
+		&operatorv1.InfrastructureProvider{},
+		&operatorv1.AddonProvider{},
+		&operatorv1.ProviderBundle{},
+		&appsv1.Deployment{},
+		&apiextensionsv1.CustomResourceDefinition{},
+	}
+
+	if watchNamespace == "" {
+		objects = append(objects, &operatorv1.CoreProvider{})
+	}
+
+	cacheSync := providercontroller.NewCacheSyncGate(mgr.GetCache(), objects...)
+	if err := mgr.Add(cacheSync); err != nil {
+		setupLog.Error(err, "unable to add cache sync gate")
+		os.Exit(1)
+	}
+
+	return cacheSync
+}
+
+func setupChecks(mgr ctrl.Manager, cacheSync *providercontroller.CacheSyncGate) {
 	if err := mgr.AddReadyzCheck("ping", healthz.Ping); err != nil {
 		setupLog.Error(err, "unable to create ready check")
 		os.Exit(1)
 	}
 
+	if err := mgr.AddReadyzCheck("cache-sync", cacheSync.Check); err != nil {
+		setupLog.Error(err, "unable to create cache sync ready check")
+		os.Exit(1)
+	}
+
 	if err := mgr.AddHealthzCheck("ping", healthz.Ping); err != nil {
 		setupLog.Error(err, "unable to create health check")
 		os.Exit(1)
 	}
 }
 
-func setupReconcilers(mgr ctrl.Manager) {
+func setupReconcilers(mgr ctrl.Manager, summaryConfigMap types.NamespacedName, cacheSync *providercontroller.CacheSyncGate) {
+	// All the provider types share the same download slots.
+	downloadLimiter := providercontroller.NewDownloadLimiter(maxConcurrentDownloads)
+
 	if err := (&providercontroller.GenericProviderReconciler{
-		Provider:     &operatorv1.CoreProvider{},
-		ProviderList: &operatorv1.CoreProviderList{},
-		Client:       mgr.GetClient(),
-		Config:       mgr.GetConfig(),
+		Provider:          &operatorv1.CoreProvider{},
+		ProviderList:      &operatorv1.CoreProviderList{},
+		Client:            mgr.GetClient(),
+		Config:            mgr.GetConfig(),
+		ReconcileInterval: reconcileInterval,
+		SummaryConfigMap:  summaryConfigMap,
+		VerifyPermissions: verifyPermissions,
+		DownloadLimiter:   downloadLimiter,
+		ServerSideApply:   serverSideApply,
+		FieldManager:      fieldManager,
+		RegistryMirror:    registryMirror,
+		WatchNamespace:    watchNamespace,
+		FeatureGates:      feature.Gates,
+		OperatorVersion:   version.Get().GitVersion,
+
+		DisableNamespaceCreation:  disableNamespaceCreation,
+		SkipSingleInstanceCheck:   skipSingleInstanceCheck,
+		AuditMode:                 auditMode,
+		CacheSync:                 cacheSync,
+		CheckNamespaceConventions: checkNamespaceConventions,
 	}).SetupWithManager(mgr, concurrency(concurrencyNumber)); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "CoreProvider")
 		os.Exit(1)
 	}
 
 	if err := (&providercontroller.GenericProviderReconciler{
-		Provider:     &operatorv1.InfrastructureProvider{},
-		ProviderList: &operatorv1.InfrastructureProviderList{},
-		Client:       mgr.GetClient(),
-		Config:       mgr.GetConfig(),
+		Provider:          &operatorv1.InfrastructureProvider{},
+		ProviderList:      &operatorv1.InfrastructureProviderList{},
+		Client:            mgr.GetClient(),
+		Config:            mgr.GetConfig(),
+		ReconcileInterval: reconcileInterval,
+		SummaryConfigMap:  summaryConfigMap,
+		VerifyPermissions: verifyPermissions,
+		DownloadLimiter:   downloadLimiter,
+		ServerSideApply:   serverSideApply,
+		FieldManager:      fieldManager,
+		RegistryMirror:    registryMirror,
+		WatchNamespace:    watchNamespace,
+		FeatureGates:      feature.Gates,
+		OperatorVersion:   version.Get().GitVersion,
+
+		DisableNamespaceCreation:  disableNamespaceCreation,
+		SkipSingleInstanceCheck:   skipSingleInstanceCheck,
+		AuditMode:                 auditMode,
+		CacheSync:                 cacheSync,
+		CheckNamespaceConventions: checkNamespaceConventions,
 	}).SetupWithManager(mgr, concurrency(concurrencyNumber)); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "InfrastructureProvider")
 		os.Exit(1)
 	}
 
 	if err := (&providercontroller.GenericProviderReconciler{
-		Provider:     &operatorv1.BootstrapProvider{},
-		ProviderList: &operatorv1.BootstrapProviderList{},
-		Client:       mgr.GetClient(),
-		Config:       mgr.GetConfig(),
+		Provider:          &operatorv1.BootstrapProvider{},
+		ProviderList:      &operatorv1.BootstrapProviderList{},
+		Client:            mgr.GetClient(),
+		Config:            mgr.GetConfig(),
+		ReconcileInterval: reconcileInterval,
+		SummaryConfigMap:  summaryConfigMap,
+		VerifyPermissions: verifyPermissions,
+		DownloadLimiter:   downloadLimiter,
+		ServerSideApply:   serverSideApply,
+		FieldManager:      fieldManager,
+		RegistryMirror:    registryMirror,
+		WatchNamespace:    watchNamespace,
+		FeatureGates:      feature.Gates,
+		OperatorVersion:   version.Get().GitVersion,
+
+		DisableNamespaceCreation:  disableNamespaceCreation,
+		SkipSingleInstanceCheck:   skipSingleInstanceCheck,
+		AuditMode:                 auditMode,
+		CacheSync:                 cacheSync,
+		CheckNamespaceConventions: checkNamespaceConventions,
 	}).SetupWithManager(mgr, concurrency(concurrencyNumber)); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "BootstrapProvider")
 		os.Exit(1)
 	}
 
 	if err := (&providercontroller.GenericProviderReconciler{
-		Provider:     &operatorv1.ControlPlaneProvider{},
-		ProviderList: &operatorv1.ControlPlaneProviderList{},
-		Client:       mgr.GetClient(),
-		Config:       mgr.GetConfig(),
+		Provider:          &operatorv1.ControlPlaneProvider{},
+		ProviderList:      &operatorv1.ControlPlaneProviderList{},
+		Client:            mgr.GetClient(),
+		Config:            mgr.GetConfig(),
+		ReconcileInterval: reconcileInterval,
+		SummaryConfigMap:  summaryConfigMap,
+		VerifyPermissions: verifyPermissions,
+		DownloadLimiter:   downloadLimiter,
+		ServerSideApply:   serverSideApply,
+		FieldManager:      fieldManager,
+		RegistryMirror:    registryMirror,
+		WatchNamespace:    watchNamespace,
+		FeatureGates:      feature.Gates,
+		OperatorVersion:   version.Get().GitVersion,
+
+		DisableNamespaceCreation:  disableNamespaceCreation,
+		SkipSingleInstanceCheck:   skipSingleInstanceCheck,
+		AuditMode:                 auditMode,
+		CacheSync:                 cacheSync,
+		CheckNamespaceConventions: checkNamespaceConventions,
 	}).SetupWithManager(mgr, concurrency(concurrencyNumber)); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "ControlPlaneProvider")
 		os.Exit(1)
 	}
 
 	if err := (&providercontroller.GenericProviderReconciler{
-		Provider:     &operatorv1.AddonProvider{},
-		ProviderList: &operatorv1.AddonProviderList{},
-		Client:       mgr.GetClient(),
-		Config:       mgr.GetConfig(),
+		Provider:          &operatorv1.AddonProvider{},
+		ProviderList:      &operatorv1.AddonProviderList{},
+		Client:            mgr.GetClient(),
+		Config:            mgr.GetConfig(),
+		ReconcileInterval: reconcileInterval,
+		SummaryConfigMap:  summaryConfigMap,
+		VerifyPermissions: verifyPermissions,
+		DownloadLimiter:   downloadLimiter,
+		ServerSideApply:   serverSideApply,
+		FieldManager:      fieldManager,
+		RegistryMirror:    registryMirror,
+		WatchNamespace:    watchNamespace,
+		FeatureGates:      feature.Gates,
+		OperatorVersion:   version.Get().GitVersion,
+
+		DisableNamespaceCreation:  disableNamespaceCreation,
+		SkipSingleInstanceCheck:   skipSingleInstanceCheck,
+		AuditMode:                 auditMode,
+		CacheSync:                 cacheSync,
+		CheckNamespaceConventions: checkNamespaceConventions,
 	}).SetupWithManager(mgr, concurrency(concurrencyNumber)); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "AddonProvider")
 		os.Exit(1)
 	}
+
+	if err := (&providercontroller.ProviderBundleReconciler{
+		Client:                   mgr.GetClient(),
+		DisableNamespaceCreation: disableNamespaceCreation,
+		AuditMode:                auditMode,
+		CacheSync:                cacheSync,
+	}).SetupWithManager(mgr, concurrency(concurrencyNumber)); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "ProviderBundle")
+		os.Exit(1)
+	}
 }
 
 func setupWebhooks(mgr ctrl.Manager) {
-	if err := (&webhook.CoreProviderWebhook{}).SetupWebhookWithManager(mgr); err != nil {
+	if err := (&webhook.CoreProviderWebhook{WatchNamespace: watchNamespace}).SetupWebhookWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create webhook", "webhook", "CoreProvider")
 		os.Exit(1)
 	}
@@ -260,6 +468,25 @@ func setupWebhooks(mgr ctrl.Manager) {
 		setupLog.Error(err, "unable to create webhook", "webhook", "AddonProvider")
 		os.Exit(1)
 	}
+
+	if err := (&webhook.ProviderBundleWebhook{}).SetupWebhookWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create webhook", "webhook", "ProviderBundle")
+		os.Exit(1)
+	}
+}
+
+// parseNamespacedName parses a namespace/name reference, returning an empty one if the reference is empty.
+func parseNamespacedName(ref string) (types.NamespacedName, error) {
+	if ref == "" {
+		return types.NamespacedName{}, nil
+	}
+
+	namespace, name, ok := strings.Cut(ref, "/")
+	if !ok || namespace == "" || name == "" {
+		return types.NamespacedName{}, fmt.Errorf("%q must be in the namespace/name format", ref)
+	}
+
+	return types.NamespacedName{Namespace: namespace, Name: name}, nil
 }
 
 func concurrency(c int) controller.Options {
@@ -0,0 +1,172 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	operatorv1 "sigs.k8s.io/cluster-api-operator/api/v1alpha2"
+	providercontroller "sigs.k8s.io/cluster-api-operator/internal/controller"
+)
+
+type upgradePlanOptions struct {
+	kubeconfig        string
+	kubeconfigContext string
+}
+
+var upgradePlanOpts = &upgradePlanOptions{}
+
+var upgradePlanCmd = &cobra.Command{
+	Use:   "plan",
+	Short: "Provide a list of recommended target versions for upgrading the providers managed by the Cluster API Operator.",
+	Long: LongDesc(`
+		The upgrade plan command provides a list of recommended target versions for upgrading the
+		providers managed by the Cluster API Operator in a management cluster.
+
+		For each provider, the newest version available for each Cluster API contract is listed, using
+		the release series of the provider metadata, as with clusterctl upgrade plan. Pre-releases are
+		only listed for the providers following the beta channel.
+
+		Contracts that don't match the one of the core provider, nor are tolerated by the contract
+		policy of the provider, are marked as held back, as the operator doesn't upgrade to them.`),
+
+	Example: Examples(`
+		# Gets the recommended target versions for upgrading the providers managed by the operator.
+		clusterctl operator upgrade plan`),
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runUpgradePlan(cmd.Context(), os.Stdout)
+	},
+}
+
+func init() {
+	upgradePlanCmd.Flags().StringVar(&upgradePlanOpts.kubeconfig, "kubeconfig", "",
+		"Path to the kubeconfig file to use for accessing the management cluster. If empty, default discovery rules apply.")
+	upgradePlanCmd.Flags().StringVar(&upgradePlanOpts.kubeconfigContext, "kubeconfig-context", "",
+		"Context to be used within the kubeconfig file. If empty, current context will be used.")
+
+	upgradeCmd.AddCommand(upgradePlanCmd)
+}
+
+func runUpgradePlan(ctx context.Context, out io.Writer) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	c, err := newManagementClusterClient(upgradePlanOpts.kubeconfig, upgradePlanOpts.kubeconfigContext)
+	if err != nil {
+		return err
+	}
+
+	plans, coreContract, err := providercontroller.UpgradePlans(ctx, c)
+	if err != nil {
+		return err
+	}
+
+	return printUpgradePlans(out, plans, coreContract)
+}
+
+// newManagementClusterClient returns a client for the management cluster the providers are managed in.
+func newManagementClusterClient(kubeconfig, kubeconfigContext string) (client.Client, error) {
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	loadingRules.ExplicitPath = kubeconfig
+
+	config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules,
+		&clientcmd.ConfigOverrides{CurrentContext: kubeconfigContext}).ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the kubeconfig: %w", err)
+	}
+
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		return nil, err
+	}
+
+	if err := operatorv1.AddToScheme(scheme); err != nil {
+		return nil, err
+	}
+
+	c, err := client.New(config, client.Options{Scheme: scheme})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create a client for the management cluster: %w", err)
+	}
+
+	return c, nil
+}
+
+// printUpgradePlans prints a line for each target version of each provider, or a single line for the providers
+// that are up to date or whose plan couldn't be computed.
+func printUpgradePlans(out io.Writer, plans []providercontroller.ProviderUpgradePlan, coreContract string) error {
+	if len(plans) == 0 {
+		_, err := fmt.Fprintln(out, "No providers are managed by the Cluster API Operator.")
+
+		return err
+	}
+
+	if coreContract == "" {
+		coreContract = "none, the core provider is not installed"
+	}
+
+	if _, err := fmt.Fprintf(out, "Core provider contract: %s\n\n", coreContract); err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+
+	fmt.Fprintln(w, "KIND\tNAMESPACE\tNAME\tCURRENT VERSION\tCURRENT CONTRACT\tTARGET CONTRACT\tTARGET VERSION")
+
+	for _, plan := range plans {
+		current, currentContract := valueOr(plan.CurrentVersion, "-"), valueOr(plan.CurrentContract, "-")
+		prefix := fmt.Sprintf("%s\t%s\t%s\t%s\t%s", plan.Kind, plan.Namespace, plan.Name, current, currentContract)
+
+		switch {
+		case plan.Err != nil:
+			fmt.Fprintf(w, "%s\t-\tError: %v\n", prefix, plan.Err)
+		case len(plan.Targets) == 0:
+			fmt.Fprintf(w, "%s\t-\tAlready up to date\n", prefix)
+		default:
+			for _, target := range plan.Targets {
+				version := target.Version
+				if !target.Allowed {
+					version += " (held back)"
+				}
+
+				fmt.Fprintf(w, "%s\t%s\t%s\n", prefix, target.Contract, version)
+			}
+		}
+	}
+
+	return w.Flush()
+}
+
+func valueOr(value, defaultValue string) string {
+	if value == "" {
+		return defaultValue
+	}
+
+	return value
+}
@@ -17,6 +17,8 @@ limitations under the License.
 package controllers
 
 import (
+	"time"
+
 	"k8s.io/client-go/rest"
 	providercontroller "sigs.k8s.io/cluster-api-operator/internal/controller"
 	ctrl "sigs.k8s.io/controller-runtime"
@@ -29,13 +31,18 @@ type GenericProviderReconciler struct {
 	ProviderList client.ObjectList
 	Client       client.Client
 	Config       *rest.Config
+
+	// ReconcileInterval is how long to wait before reconciling a provider again while it's waiting,
+	// unless the provider overrides it. If zero, a default interval is picked for each wait.
+	ReconcileInterval time.Duration
 }
 
 func (r *GenericProviderReconciler) SetupWithManager(mgr ctrl.Manager, options controller.Options) error {
 	return (&providercontroller.GenericProviderReconciler{
-		Provider:     r.Provider,
-		ProviderList: r.ProviderList,
-		Client:       r.Client,
-		Config:       r.Config,
+		Provider:          r.Provider,
+		ProviderList:      r.ProviderList,
+		Client:            r.Client,
+		Config:            r.Config,
+		ReconcileInterval: r.ReconcileInterval,
 	}).SetupWithManager(mgr, options)
 }
@@ -0,0 +1,226 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	operatorv1 "sigs.k8s.io/cluster-api-operator/api/v1alpha2"
+	"sigs.k8s.io/cluster-api-operator/internal/controller/genericprovider"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/cmd/clusterctl/client/yamlprocessor"
+	"sigs.k8s.io/cluster-api/util"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	utilyaml "sigs.k8s.io/cluster-api/util/yaml"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// applyAdditionalManifests applies the manifests from the ConfigMap referenced by spec.additionalManifests.
+// It runs after the provider components are installed, so the manifests can use the provider CRDs.
+// Every key of the ConfigMap holds YAML documents, and the keys are applied in lexical order.
+func (p *phaseReconciler) applyAdditionalManifests(ctx context.Context) (reconcile.Result, error) {
+	log := ctrl.LoggerFrom(ctx)
+
+	ref := p.provider.GetSpec().AdditionalManifestsRef
+	if ref == nil {
+		conditions.Delete(p.provider, operatorv1.AdditionalManifestsAppliedCondition)
+
+		return reconcile.Result{}, nil
+	}
+
+	log.Info("Applying additional manifests")
+
+	objs, err := p.additionalManifestsObjects(ctx, ref)
+	if err != nil {
+		return reconcile.Result{}, wrapAdditionalManifestsError(err)
+	}
+
+	if p.serverSideApply {
+		if err := applyObjects(ctx, p.ctrlClient, p.fieldManager, objs); err != nil {
+			return reconcile.Result{}, wrapAdditionalManifestsError(err)
+		}
+	} else {
+		for i := range objs {
+			if err := createOrUpdateObject(ctx, p.ctrlClient, &objs[i]); err != nil {
+				return reconcile.Result{}, wrapAdditionalManifestsError(err)
+			}
+		}
+	}
+
+	conditions.MarkTrue(p.provider, operatorv1.AdditionalManifestsAppliedCondition)
+
+	return reconcile.Result{}, nil
+}
+
+// additionalManifestsObjects returns the objects from the referenced ConfigMap, with the clusterctl variables
+// substituted, the provider namespace set on the namespaced objects that have none, and the provider set
+// as owner of the objects in its namespace.
+func (p *phaseReconciler) additionalManifestsObjects(ctx context.Context, ref *operatorv1.ConfigmapReference) ([]unstructured.Unstructured, error) {
+	key := types.NamespacedName{Namespace: ref.Namespace, Name: ref.Name}
+	if key.Namespace == "" {
+		key.Namespace = p.provider.GetNamespace()
+	}
+
+	cm := &corev1.ConfigMap{}
+	if err := p.ctrlClient.Get(ctx, key, cm); err != nil {
+		return nil, fmt.Errorf("failed to get ConfigMap %s/%s: %w", key.Namespace, key.Name, err)
+	}
+
+	keys := make([]string, 0, len(cm.Data))
+	for k := range cm.Data {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	objs := []unstructured.Unstructured{}
+
+	for _, k := range keys {
+		data := []byte(cm.Data[k])
+
+		if p.configClient != nil {
+			missing, err := missingVariables(data, p.configClient.Variables().Get)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get the variables of key %q of ConfigMap %s/%s: %w", k, key.Namespace, key.Name, err)
+			}
+
+			if len(missing) > 0 {
+				return nil, fmt.Errorf("variables %s referenced by key %q of ConfigMap %s/%s are not set, set them in spec.configSecret or spec.configSecretRef",
+					strings.Join(missing, ", "), k, key.Namespace, key.Name)
+			}
+
+			processed, err := yamlprocessor.NewSimpleProcessor().Process(data, p.configClient.Variables().Get)
+			if err != nil {
+				return nil, fmt.Errorf("failed to process key %q of ConfigMap %s/%s: %w", k, key.Namespace, key.Name, err)
+			}
+
+			data = processed
+		}
+
+		keyObjs, err := utilyaml.ToUnstructured(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse key %q of ConfigMap %s/%s: %w", k, key.Namespace, key.Name, err)
+		}
+
+		objs = append(objs, keyObjs...)
+	}
+
+	for i := range objs {
+		obj := &objs[i]
+
+		namespaced, err := p.ctrlClient.IsObjectNamespaced(obj)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get the scope of %s %q: %w", obj.GetKind(), obj.GetName(), err)
+		}
+
+		if !namespaced {
+			continue
+		}
+
+		if obj.GetNamespace() == "" {
+			obj.SetNamespace(p.provider.GetNamespace())
+		}
+
+		// Owner references can't cross namespaces.
+		if obj.GetNamespace() == p.provider.GetNamespace() {
+			obj.SetOwnerReferences(util.EnsureOwnerRef(obj.GetOwnerReferences(),
+				metav1.OwnerReference{
+					APIVersion: operatorv1.GroupVersion.String(),
+					Kind:       p.provider.GetObjectKind().GroupVersionKind().Kind,
+					Name:       p.provider.GetName(),
+					UID:        p.provider.GetUID(),
+				}))
+		}
+	}
+
+	return objs, nil
+}
+
+// missingVariables returns the sorted variables referenced by the manifests that have neither a value nor a default.
+func missingVariables(data []byte, get func(string) (string, error)) ([]string, error) {
+	variables, err := yamlprocessor.NewSimpleProcessor().GetVariableMap(data)
+	if err != nil {
+		return nil, err
+	}
+
+	missing := []string{}
+
+	for name, defaultValue := range variables {
+		if _, err := get(name); err != nil && defaultValue == nil {
+			missing = append(missing, name)
+		}
+	}
+
+	sort.Strings(missing)
+
+	return missing, nil
+}
+
+// providerVariables returns the variables describing the provider, available to its components and additional
+// manifests, e.g. ${PROVIDER_NAMESPACE}.
+func providerVariables(provider genericprovider.GenericProvider) map[string]string {
+	return map[string]string{
+		providerNameVariable:      provider.GetName(),
+		providerNamespaceVariable: provider.GetNamespace(),
+	}
+}
+
+// createOrUpdateObject creates the object, or updates it if it already exists.
+func createOrUpdateObject(ctx context.Context, c client.Client, obj *unstructured.Unstructured) error {
+	current := &unstructured.Unstructured{}
+	current.SetGroupVersionKind(obj.GroupVersionKind())
+
+	err := c.Get(ctx, client.ObjectKeyFromObject(obj), current)
+	if apierrors.IsNotFound(err) {
+		if err := c.Create(ctx, obj); err != nil {
+			return fmt.Errorf("failed to create %s %q: %w", obj.GetKind(), obj.GetName(), err)
+		}
+
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to get %s %q: %w", obj.GetKind(), obj.GetName(), err)
+	}
+
+	obj.SetResourceVersion(current.GetResourceVersion())
+
+	if err := c.Update(ctx, obj); err != nil {
+		return fmt.Errorf("failed to update %s %q: %w", obj.GetKind(), obj.GetName(), err)
+	}
+
+	return nil
+}
+
+func wrapAdditionalManifestsError(err error) error {
+	return &PhaseError{
+		Err:      err,
+		Type:     operatorv1.AdditionalManifestsAppliedCondition,
+		Reason:   operatorv1.AdditionalManifestsApplyFailedReason,
+		Severity: clusterv1.ConditionSeverityError,
+	}
+}
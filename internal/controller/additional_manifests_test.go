@@ -0,0 +1,287 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	configclient "sigs.k8s.io/cluster-api/cmd/clusterctl/client/config"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	operatorv1 "sigs.k8s.io/cluster-api-operator/api/v1alpha2"
+	"sigs.k8s.io/cluster-api-operator/internal/controller/genericprovider"
+)
+
+func TestApplyAdditionalManifests(t *testing.T) {
+	serviceAccount := `
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: extra
+`
+	clusterRole := `
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: extra
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRoleBinding
+metadata:
+  name: extra
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: ClusterRole
+  name: extra
+`
+	configMap := `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: extra
+  namespace: other-namespace
+data:
+  key: value
+`
+
+	templated := `
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: ${PROVIDER_NAME}-extra
+  namespace: ${PROVIDER_NAMESPACE}
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: ${CONFIG_NAME:=extra}
+  namespace: ${CONFIG_NAMESPACE}
+`
+
+	tests := []struct {
+		name           string
+		ref            *operatorv1.ConfigmapReference
+		data           map[string]string
+		variables      map[string][]byte
+		existing       []client.Object
+		wantObjects    []string
+		wantErr        bool
+		wantErrMessage string
+		wantCondition  *corev1.ConditionStatus
+	}{
+		{
+			name: "no additional manifests",
+		},
+		{
+			name: "keys are applied in lexical order",
+			ref:  &operatorv1.ConfigmapReference{Name: "additional-manifests"},
+			data: map[string]string{
+				"b-service-account": serviceAccount,
+				"a-rbac":            clusterRole,
+				"c-config":          configMap,
+			},
+			wantObjects: []string{
+				"ClusterRole /extra",
+				"ClusterRoleBinding /extra",
+				"ServiceAccount capi-system/extra",
+				"ConfigMap other-namespace/extra",
+			},
+			wantCondition: statusPtr(corev1.ConditionTrue),
+		},
+		{
+			name: "existing objects are updated",
+			ref:  &operatorv1.ConfigmapReference{Name: "additional-manifests", Namespace: "capi-system"},
+			data: map[string]string{"manifests": clusterRole},
+			existing: []client.Object{
+				&rbacv1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "extra", Labels: map[string]string{"old": "true"}}},
+			},
+			wantObjects: []string{
+				"ClusterRole /extra",
+				"ClusterRoleBinding /extra",
+			},
+			wantCondition: statusPtr(corev1.ConditionTrue),
+		},
+		{
+			name:      "provider variables are substituted",
+			ref:       &operatorv1.ConfigmapReference{Name: "additional-manifests"},
+			data:      map[string]string{"manifests": templated},
+			variables: map[string][]byte{"CONFIG_NAMESPACE": []byte("other-namespace")},
+			wantObjects: []string{
+				"ServiceAccount capi-system/cluster-api-extra",
+				"ConfigMap other-namespace/extra",
+			},
+			wantCondition: statusPtr(corev1.ConditionTrue),
+		},
+		{
+			name:    "unresolved variables",
+			ref:     &operatorv1.ConfigmapReference{Name: "additional-manifests"},
+			data:    map[string]string{"manifests": templated + "  labels:\n    team: ${TEAM}\n"},
+			wantErr: true,
+			wantErrMessage: "variables CONFIG_NAMESPACE, TEAM referenced by key \"manifests\" of ConfigMap capi-system/additional-manifests are not set," +
+				" set them in spec.configSecret or spec.configSecretRef",
+			wantCondition: statusPtr(corev1.ConditionFalse),
+		},
+		{
+			name:          "missing ConfigMap",
+			ref:           &operatorv1.ConfigmapReference{Name: "missing"},
+			wantErr:       true,
+			wantCondition: statusPtr(corev1.ConditionFalse),
+		},
+		{
+			name:          "invalid manifests",
+			ref:           &operatorv1.ConfigmapReference{Name: "additional-manifests"},
+			data:          map[string]string{"manifests": "kind: ["},
+			wantErr:       true,
+			wantCondition: statusPtr(corev1.ConditionFalse),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			ctx := context.Background()
+
+			provider := &genericprovider.CoreProviderWrapper{
+				CoreProvider: &operatorv1.CoreProvider{
+					TypeMeta: metav1.TypeMeta{
+						Kind:       "CoreProvider",
+						APIVersion: operatorv1.GroupVersion.String(),
+					},
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "cluster-api",
+						Namespace: "capi-system",
+						UID:       "provider-uid",
+					},
+					Spec: operatorv1.CoreProviderSpec{
+						ProviderSpec: operatorv1.ProviderSpec{
+							AdditionalManifestsRef: tt.ref,
+							ConfigSecret:           &operatorv1.SecretReference{Name: "variables", Namespace: "capi-system"},
+						},
+					},
+				},
+			}
+
+			// Set a stale condition to check it's cleaned up when there are no additional manifests.
+			conditions.MarkTrue(provider, operatorv1.AdditionalManifestsAppliedCondition)
+
+			objs := append([]client.Object{
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{Name: "variables", Namespace: "capi-system"},
+					Data:       tt.variables,
+				},
+				&corev1.ConfigMap{
+					ObjectMeta: metav1.ObjectMeta{Name: "additional-manifests", Namespace: "capi-system"},
+					Data:       tt.data,
+				},
+			}, tt.existing...)
+
+			scheme := setupScheme()
+			utilruntime.Must(rbacv1.AddToScheme(scheme))
+
+			fakeclient := fake.NewClientBuilder().
+				WithScheme(scheme).
+				WithRESTMapper(additionalManifestsRESTMapper()).
+				WithObjects(objs...).
+				Build()
+
+			p := &phaseReconciler{
+				ctrlClient: fakeclient,
+				provider:   provider,
+			}
+
+			reader, err := p.secretReader(ctx)
+			g.Expect(err).NotTo(HaveOccurred())
+
+			p.configClient, err = configclient.New("", configclient.InjectReader(reader))
+			g.Expect(err).NotTo(HaveOccurred())
+
+			_, err = p.applyAdditionalManifests(ctx)
+			if tt.wantErr {
+				g.Expect(err).To(HaveOccurred())
+
+				if tt.wantErrMessage != "" {
+					g.Expect(err.Error()).To(Equal(tt.wantErrMessage))
+				}
+
+				var pe *PhaseError
+				g.Expect(errors.As(err, &pe)).To(BeTrue())
+				g.Expect(pe.Type).To(Equal(operatorv1.AdditionalManifestsAppliedCondition))
+				g.Expect(pe.Reason).To(Equal(operatorv1.AdditionalManifestsApplyFailedReason))
+
+				return
+			}
+
+			g.Expect(err).NotTo(HaveOccurred())
+
+			if tt.wantCondition == nil {
+				g.Expect(conditions.Has(provider, operatorv1.AdditionalManifestsAppliedCondition)).To(BeFalse())
+
+				return
+			}
+
+			g.Expect(conditions.Get(provider, operatorv1.AdditionalManifestsAppliedCondition).Status).To(Equal(*tt.wantCondition))
+
+			applied, err := p.additionalManifestsObjects(ctx, tt.ref)
+			g.Expect(err).NotTo(HaveOccurred())
+
+			got := []string{}
+			for i := range applied {
+				obj := &applied[i]
+				got = append(got, obj.GetKind()+" "+obj.GetNamespace()+"/"+obj.GetName())
+
+				if obj.GetNamespace() == provider.GetNamespace() {
+					g.Expect(obj.GetOwnerReferences()).To(HaveLen(1))
+					g.Expect(obj.GetOwnerReferences()[0].Kind).To(Equal("CoreProvider"))
+					g.Expect(obj.GetOwnerReferences()[0].UID).To(Equal(provider.GetUID()))
+				} else {
+					g.Expect(obj.GetOwnerReferences()).To(BeEmpty())
+				}
+
+				current := obj.DeepCopy()
+				g.Expect(fakeclient.Get(ctx, client.ObjectKeyFromObject(obj), current)).To(Succeed())
+				g.Expect(current.GetLabels()).NotTo(HaveKey("old"))
+			}
+
+			g.Expect(got).To(Equal(tt.wantObjects))
+		})
+	}
+}
+
+func statusPtr(s corev1.ConditionStatus) *corev1.ConditionStatus {
+	return &s
+}
+
+func additionalManifestsRESTMapper() meta.RESTMapper {
+	mapper := meta.NewDefaultRESTMapper([]schema.GroupVersion{corev1.SchemeGroupVersion, rbacv1.SchemeGroupVersion})
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "ServiceAccount"}, meta.RESTScopeNamespace)
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}, meta.RESTScopeNamespace)
+	mapper.Add(rbacv1.SchemeGroupVersion.WithKind("ClusterRole"), meta.RESTScopeRoot)
+	mapper.Add(rbacv1.SchemeGroupVersion.WithKind("ClusterRoleBinding"), meta.RESTScopeRoot)
+
+	return mapper
+}
@@ -0,0 +1,380 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	appsv1 "k8s.io/api/apps/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	operatorv1 "sigs.k8s.io/cluster-api-operator/api/v1alpha2"
+)
+
+// additionalRBACLabel marks the objects applied for the additional RBAC of a provider with the provider UID,
+// so the ones no longer needed are deleted, including the cluster scoped ones the provider can't own.
+const additionalRBACLabel = "operator.cluster.x-k8s.io/additional-rbac-of"
+
+// additionalRBACKinds are the kinds of objects allowed in the additional RBAC manifests.
+var additionalRBACKinds = []schema.GroupVersionKind{
+	rbacv1.SchemeGroupVersion.WithKind("Role"),
+	rbacv1.SchemeGroupVersion.WithKind("ClusterRole"),
+	rbacv1.SchemeGroupVersion.WithKind("RoleBinding"),
+	rbacv1.SchemeGroupVersion.WithKind("ClusterRoleBinding"),
+}
+
+// applyAdditionalRBAC applies the additional RBAC of the provider, i.e. a ClusterRole with its rules bound to
+// the service accounts of the provider Deployments and the RBAC manifests referenced by the provider, then
+// deletes the objects applied for a previous spec that are no longer needed.
+func (p *phaseReconciler) applyAdditionalRBAC(ctx context.Context) (reconcile.Result, error) {
+	log := ctrl.LoggerFrom(ctx)
+
+	additionalRBAC := p.provider.GetSpec().AdditionalRBAC
+	if additionalRBAC == nil || len(additionalRBAC.Rules) == 0 && additionalRBAC.ManifestsRef == nil {
+		if err := p.pruneAdditionalRBAC(ctx, nil); err != nil {
+			return reconcile.Result{}, wrapAdditionalRBACError(err, operatorv1.AdditionalRBACApplyFailedReason)
+		}
+
+		conditions.Delete(p.provider, operatorv1.AdditionalRBACAppliedCondition)
+
+		return reconcile.Result{}, nil
+	}
+
+	if msg := validatePolicyRules(additionalRBAC.Rules); msg != "" {
+		return reconcile.Result{}, wrapAdditionalRBACError(fmt.Errorf("invalid additional RBAC rules: %s", msg), operatorv1.InvalidAdditionalRBACReason)
+	}
+
+	log.Info("Applying additional RBAC")
+
+	objs, err := p.additionalRBACObjects(ctx, additionalRBAC)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+
+	if p.serverSideApply {
+		err = applyObjects(ctx, p.ctrlClient, p.fieldManager, objs)
+	} else {
+		for i := range objs {
+			if err = createOrUpdateObject(ctx, p.ctrlClient, &objs[i]); err != nil {
+				break
+			}
+		}
+	}
+
+	if err != nil {
+		return reconcile.Result{}, wrapAdditionalRBACError(err, operatorv1.AdditionalRBACApplyFailedReason)
+	}
+
+	if err := p.pruneAdditionalRBAC(ctx, objs); err != nil {
+		return reconcile.Result{}, wrapAdditionalRBACError(err, operatorv1.AdditionalRBACApplyFailedReason)
+	}
+
+	conditions.MarkTrue(p.provider, operatorv1.AdditionalRBACAppliedCondition)
+
+	return reconcile.Result{}, nil
+}
+
+// deleteAdditionalRBAC deletes the objects applied for the additional RBAC of the provider.
+func (p *phaseReconciler) deleteAdditionalRBAC(ctx context.Context) (reconcile.Result, error) {
+	if err := p.pruneAdditionalRBAC(ctx, nil); err != nil {
+		return reconcile.Result{}, wrapAdditionalRBACError(err, operatorv1.AdditionalRBACApplyFailedReason)
+	}
+
+	return reconcile.Result{}, nil
+}
+
+// additionalRBACObjects returns the objects to apply for the additional RBAC, labeled with the provider UID.
+func (p *phaseReconciler) additionalRBACObjects(ctx context.Context, additionalRBAC *operatorv1.AdditionalRBAC) ([]unstructured.Unstructured, error) {
+	objs := []unstructured.Unstructured{}
+
+	if len(additionalRBAC.Rules) > 0 {
+		rbacObjs, err := p.additionalRBACRulesObjects(additionalRBAC.Rules)
+		if err != nil {
+			return nil, wrapAdditionalRBACError(err, operatorv1.AdditionalRBACApplyFailedReason)
+		}
+
+		objs = append(objs, rbacObjs...)
+	}
+
+	if additionalRBAC.ManifestsRef != nil {
+		manifestsObjs, err := p.additionalManifestsObjects(ctx, additionalRBAC.ManifestsRef)
+		if err != nil {
+			return nil, wrapAdditionalRBACError(err, operatorv1.AdditionalRBACApplyFailedReason)
+		}
+
+		for _, obj := range manifestsObjs {
+			if !isAdditionalRBACKind(obj.GroupVersionKind()) {
+				err := fmt.Errorf("%s %q is not an RBAC object, only Roles, ClusterRoles, RoleBindings and ClusterRoleBindings are allowed", obj.GetKind(), obj.GetName())
+
+				return nil, wrapAdditionalRBACError(err, operatorv1.InvalidAdditionalRBACReason)
+			}
+		}
+
+		if err := p.validateBindingSubjects(manifestsObjs); err != nil {
+			return nil, err
+		}
+
+		objs = append(objs, manifestsObjs...)
+	}
+
+	for i := range objs {
+		labels := objs[i].GetLabels()
+		if labels == nil {
+			labels = map[string]string{}
+		}
+
+		labels[additionalRBACLabel] = string(p.provider.GetUID())
+		objs[i].SetLabels(labels)
+	}
+
+	return objs, nil
+}
+
+// additionalRBACRulesObjects returns a ClusterRole with the rules, and a ClusterRoleBinding granting it to the
+// service accounts of the provider Deployments. Their name is prefixed with the provider namespace, as for
+// the cluster scoped components of the provider instances.
+func (p *phaseReconciler) additionalRBACRulesObjects(rules []rbacv1.PolicyRule) ([]unstructured.Unstructured, error) {
+	name := fmt.Sprintf("%s-%s-additional-rbac", p.provider.GetNamespace(), clusterctlProviderName(p.provider).Name)
+
+	subjects, err := p.serviceAccountSubjects()
+	if err != nil {
+		return nil, err
+	}
+
+	clusterRole := &rbacv1.ClusterRole{
+		TypeMeta:   metav1.TypeMeta{APIVersion: rbacv1.SchemeGroupVersion.String(), Kind: "ClusterRole"},
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Rules:      rules,
+	}
+
+	clusterRoleBinding := &rbacv1.ClusterRoleBinding{
+		TypeMeta:   metav1.TypeMeta{APIVersion: rbacv1.SchemeGroupVersion.String(), Kind: "ClusterRoleBinding"},
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		RoleRef: rbacv1.RoleRef{
+			APIGroup: rbacv1.GroupName,
+			Kind:     "ClusterRole",
+			Name:     name,
+		},
+		Subjects: subjects,
+	}
+
+	objs := []unstructured.Unstructured{}
+
+	for _, obj := range []runtime.Object{clusterRole, clusterRoleBinding} {
+		content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+		if err != nil {
+			return nil, err
+		}
+
+		objs = append(objs, unstructured.Unstructured{Object: content})
+	}
+
+	return objs, nil
+}
+
+// serviceAccountSubjects returns the service accounts the provider Deployments run with, sorted by namespace and name.
+func (p *phaseReconciler) serviceAccountSubjects() ([]rbacv1.Subject, error) {
+	seen := map[rbacv1.Subject]bool{}
+	subjects := []rbacv1.Subject{}
+
+	for _, obj := range p.componentsToInstall() {
+		if obj.GroupVersionKind().GroupKind() != appsv1.SchemeGroupVersion.WithKind("Deployment").GroupKind() {
+			continue
+		}
+
+		deployment := &appsv1.Deployment{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, deployment); err != nil {
+			return nil, fmt.Errorf("failed to convert Deployment %q: %w", obj.GetName(), err)
+		}
+
+		serviceAccount := deployment.Spec.Template.Spec.ServiceAccountName
+		if serviceAccount == "" {
+			serviceAccount = "default"
+		}
+
+		subject := rbacv1.Subject{Kind: rbacv1.ServiceAccountKind, Namespace: deployment.Namespace, Name: serviceAccount}
+		if !seen[subject] {
+			seen[subject] = true
+			subjects = append(subjects, subject)
+		}
+	}
+
+	if len(subjects) == 0 {
+		return nil, fmt.Errorf("provider %q has no Deployment to grant the additional RBAC rules to", p.provider.GetName())
+	}
+
+	sort.Slice(subjects, func(i, j int) bool {
+		if subjects[i].Namespace != subjects[j].Namespace {
+			return subjects[i].Namespace < subjects[j].Namespace
+		}
+
+		return subjects[i].Name < subjects[j].Name
+	})
+
+	return subjects, nil
+}
+
+// validateBindingSubjects rejects the RoleBindings and ClusterRoleBindings of the RBAC manifests that bind anything
+// but the service accounts of the provider Deployments, so the manifests can't grant permissions to other users.
+func (p *phaseReconciler) validateBindingSubjects(objs []unstructured.Unstructured) error {
+	var allowed map[rbacv1.Subject]bool
+
+	for _, obj := range objs {
+		kind := obj.GetKind()
+		if kind != "RoleBinding" && kind != "ClusterRoleBinding" {
+			continue
+		}
+
+		if allowed == nil {
+			subjects, err := p.serviceAccountSubjects()
+			if err != nil {
+				return wrapAdditionalRBACError(err, operatorv1.InvalidAdditionalRBACReason)
+			}
+
+			allowed = map[rbacv1.Subject]bool{}
+			for _, subject := range subjects {
+				allowed[subject] = true
+			}
+		}
+
+		binding := &rbacv1.RoleBinding{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, binding); err != nil {
+			return wrapAdditionalRBACError(fmt.Errorf("failed to convert %s %q: %w", kind, obj.GetName(), err), operatorv1.InvalidAdditionalRBACReason)
+		}
+
+		for _, subject := range binding.Subjects {
+			// Service accounts bound by a RoleBinding default to its namespace.
+			namespace := subject.Namespace
+			if namespace == "" && kind == "RoleBinding" {
+				namespace = obj.GetNamespace()
+			}
+
+			if subject.Kind == rbacv1.ServiceAccountKind && allowed[rbacv1.Subject{Kind: subject.Kind, Namespace: namespace, Name: subject.Name}] {
+				continue
+			}
+
+			err := fmt.Errorf("%s %q binds %s %q, only the service accounts of the provider Deployments are allowed",
+				kind, obj.GetName(), subject.Kind, subjectName(subject.Namespace, subject.Name))
+
+			return wrapAdditionalRBACError(err, operatorv1.InvalidAdditionalRBACReason)
+		}
+	}
+
+	return nil
+}
+
+// subjectName returns the name of an RBAC subject, prefixed with its namespace if any.
+func subjectName(namespace, name string) string {
+	if namespace == "" {
+		return name
+	}
+
+	return namespace + "/" + name
+}
+
+// pruneAdditionalRBAC deletes the objects labeled for the additional RBAC of the provider that are not in keep.
+func (p *phaseReconciler) pruneAdditionalRBAC(ctx context.Context, keep []unstructured.Unstructured) error {
+	kept := map[string]bool{}
+	for _, obj := range keep {
+		kept[objectID(obj.GroupVersionKind(), obj.GetNamespace(), obj.GetName())] = true
+	}
+
+	for _, gvk := range additionalRBACKinds {
+		list := &unstructured.UnstructuredList{}
+		list.SetGroupVersionKind(gvk.GroupVersion().WithKind(gvk.Kind + "List"))
+
+		if err := p.ctrlClient.List(ctx, list, client.MatchingLabels{additionalRBACLabel: string(p.provider.GetUID())}); err != nil {
+			return fmt.Errorf("failed to list the %s objects of the additional RBAC: %w", gvk.Kind, err)
+		}
+
+		for i := range list.Items {
+			obj := &list.Items[i]
+			if kept[objectID(gvk, obj.GetNamespace(), obj.GetName())] {
+				continue
+			}
+
+			if err := p.ctrlClient.Delete(ctx, obj); err != nil && !apierrors.IsNotFound(err) {
+				return fmt.Errorf("failed to delete %s %q of the additional RBAC: %w", gvk.Kind, obj.GetName(), err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// objectID identifies an object by its kind, namespace and name.
+func objectID(gvk schema.GroupVersionKind, namespace, name string) string {
+	return fmt.Sprintf("%s/%s/%s", gvk.GroupKind(), namespace, name)
+}
+
+// isAdditionalRBACKind returns true if the object kind is allowed in the additional RBAC manifests.
+func isAdditionalRBACKind(gvk schema.GroupVersionKind) bool {
+	for _, k := range additionalRBACKinds {
+		if gvk.GroupKind() == k.GroupKind() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// validatePolicyRules checks the rules as the API server does for ClusterRoles, returning a message describing
+// the first problem found, if any, so it's reported before anything is applied.
+func validatePolicyRules(rules []rbacv1.PolicyRule) string {
+	for i, rule := range rules {
+		if len(rule.Verbs) == 0 {
+			return fmt.Sprintf("rule %d has no verbs", i)
+		}
+
+		if len(rule.NonResourceURLs) > 0 {
+			if len(rule.APIGroups) > 0 || len(rule.Resources) > 0 || len(rule.ResourceNames) > 0 {
+				return fmt.Sprintf("rule %d can't apply to both resources and non-resource URLs", i)
+			}
+
+			continue
+		}
+
+		if len(rule.APIGroups) == 0 || len(rule.Resources) == 0 {
+			return fmt.Sprintf("rule %d must set both apiGroups and resources, or nonResourceURLs", i)
+		}
+	}
+
+	return ""
+}
+
+// wrapAdditionalRBACError wraps an error validating or applying the additional RBAC so it's reported in the
+// additional RBAC applied condition with the given reason.
+func wrapAdditionalRBACError(err error, reason string) error {
+	return &PhaseError{
+		Err:      err,
+		Type:     operatorv1.AdditionalRBACAppliedCondition,
+		Reason:   reason,
+		Severity: clusterv1.ConditionSeverityError,
+	}
+}
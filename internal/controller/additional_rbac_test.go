@@ -0,0 +1,278 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	operatorv1 "sigs.k8s.io/cluster-api-operator/api/v1alpha2"
+	"sigs.k8s.io/cluster-api-operator/internal/controller/genericprovider"
+)
+
+func TestApplyAdditionalRBAC(t *testing.T) {
+	rules := []rbacv1.PolicyRule{
+		{APIGroups: []string{""}, Resources: []string{"secrets"}, Verbs: []string{"get", "list", "watch"}},
+	}
+
+	roleManifests := `
+apiVersion: rbac.authorization.k8s.io/v1
+kind: Role
+metadata:
+  name: extra
+rules:
+- apiGroups: [""]
+  resources: ["configmaps"]
+  verbs: ["get"]
+`
+
+	bindingManifests := func(kind, name string) string {
+		return `
+apiVersion: rbac.authorization.k8s.io/v1
+kind: RoleBinding
+metadata:
+  name: extra
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: Role
+  name: extra
+subjects:
+- kind: ` + kind + `
+  name: ` + name + `
+`
+	}
+
+	// staleRole was applied for a previous spec of the provider.
+	staleRole := &rbacv1.Role{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "stale",
+			Namespace: "capd-system",
+			Labels:    map[string]string{additionalRBACLabel: "provider-uid"},
+		},
+	}
+
+	tests := []struct {
+		name           string
+		additionalRBAC *operatorv1.AdditionalRBAC
+		data           map[string]string
+		wantObjects    []string
+		wantSubjects   []rbacv1.Subject
+		wantReason     string
+	}{
+		{
+			name: "no additional RBAC",
+		},
+		{
+			name:           "rules are bound to the provider service accounts",
+			additionalRBAC: &operatorv1.AdditionalRBAC{Rules: rules},
+			wantObjects: []string{
+				"ClusterRole /capd-system-infrastructure-docker-additional-rbac",
+				"ClusterRoleBinding /capd-system-infrastructure-docker-additional-rbac",
+			},
+			wantSubjects: []rbacv1.Subject{
+				{Kind: rbacv1.ServiceAccountKind, Namespace: "capd-system", Name: "capd-manager"},
+				{Kind: rbacv1.ServiceAccountKind, Namespace: "capd-system", Name: "default"},
+			},
+		},
+		{
+			name:           "RBAC manifests are applied",
+			additionalRBAC: &operatorv1.AdditionalRBAC{ManifestsRef: &operatorv1.ConfigmapReference{Name: "additional-rbac"}},
+			data:           map[string]string{"manifests": roleManifests},
+			wantObjects:    []string{"Role capd-system/extra"},
+		},
+		{
+			name:           "RBAC manifests binding the provider service accounts are applied",
+			additionalRBAC: &operatorv1.AdditionalRBAC{ManifestsRef: &operatorv1.ConfigmapReference{Name: "additional-rbac"}},
+			data:           map[string]string{"manifests": roleManifests + "---\n" + bindingManifests("ServiceAccount", "capd-manager")},
+			wantObjects:    []string{"Role capd-system/extra", "RoleBinding capd-system/extra"},
+		},
+		{
+			name:           "RBAC manifests binding other service accounts",
+			additionalRBAC: &operatorv1.AdditionalRBAC{ManifestsRef: &operatorv1.ConfigmapReference{Name: "additional-rbac"}},
+			data:           map[string]string{"manifests": roleManifests + "---\n" + bindingManifests("ServiceAccount", "other")},
+			wantReason:     operatorv1.InvalidAdditionalRBACReason,
+		},
+		{
+			name:           "RBAC manifests binding users",
+			additionalRBAC: &operatorv1.AdditionalRBAC{ManifestsRef: &operatorv1.ConfigmapReference{Name: "additional-rbac"}},
+			data:           map[string]string{"manifests": roleManifests + "---\n" + bindingManifests("User", "capd-manager")},
+			wantReason:     operatorv1.InvalidAdditionalRBACReason,
+		},
+		{
+			name: "rules without verbs",
+			additionalRBAC: &operatorv1.AdditionalRBAC{Rules: []rbacv1.PolicyRule{
+				{APIGroups: []string{""}, Resources: []string{"secrets"}},
+			}},
+			wantReason: operatorv1.InvalidAdditionalRBACReason,
+		},
+		{
+			name: "rules for both resources and non-resource URLs",
+			additionalRBAC: &operatorv1.AdditionalRBAC{Rules: []rbacv1.PolicyRule{
+				{APIGroups: []string{""}, Resources: []string{"secrets"}, NonResourceURLs: []string{"/metrics"}, Verbs: []string{"get"}},
+			}},
+			wantReason: operatorv1.InvalidAdditionalRBACReason,
+		},
+		{
+			name:           "manifests with objects other than RBAC",
+			additionalRBAC: &operatorv1.AdditionalRBAC{ManifestsRef: &operatorv1.ConfigmapReference{Name: "additional-rbac"}},
+			data:           map[string]string{"manifests": "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: extra\n"},
+			wantReason:     operatorv1.InvalidAdditionalRBACReason,
+		},
+		{
+			name:           "missing ConfigMap",
+			additionalRBAC: &operatorv1.AdditionalRBAC{ManifestsRef: &operatorv1.ConfigmapReference{Name: "missing"}},
+			wantReason:     operatorv1.AdditionalRBACApplyFailedReason,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			ctx := context.Background()
+
+			provider := &genericprovider.InfrastructureProviderWrapper{
+				InfrastructureProvider: &operatorv1.InfrastructureProvider{
+					TypeMeta: metav1.TypeMeta{
+						Kind:       "InfrastructureProvider",
+						APIVersion: operatorv1.GroupVersion.String(),
+					},
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "docker",
+						Namespace: "capd-system",
+						UID:       "provider-uid",
+					},
+					Spec: operatorv1.InfrastructureProviderSpec{
+						ProviderSpec: operatorv1.ProviderSpec{
+							AdditionalRBAC: tt.additionalRBAC,
+						},
+					},
+				},
+			}
+
+			// Set a stale condition to check it's cleaned up when there is no additional RBAC.
+			conditions.MarkTrue(provider, operatorv1.AdditionalRBACAppliedCondition)
+
+			scheme := setupScheme()
+			utilruntime.Must(rbacv1.AddToScheme(scheme))
+
+			fakeclient := fake.NewClientBuilder().
+				WithScheme(scheme).
+				WithRESTMapper(additionalRBACRESTMapper()).
+				WithObjects(
+					&corev1.ConfigMap{
+						ObjectMeta: metav1.ObjectMeta{Name: "additional-rbac", Namespace: "capd-system"},
+						Data:       tt.data,
+					},
+					staleRole.DeepCopy(),
+				).
+				Build()
+
+			manager := newUnstructured(appsv1.SchemeGroupVersion.WithKind("Deployment"), "capd-system", "capd-controller-manager")
+			g.Expect(unstructured.SetNestedField(manager.Object, "capd-manager", "spec", "template", "spec", "serviceAccountName")).To(Succeed())
+
+			p := &phaseReconciler{
+				ctrlClient: fakeclient,
+				provider:   provider,
+				components: &fakeComponents{objs: []unstructured.Unstructured{
+					manager,
+					newUnstructured(appsv1.SchemeGroupVersion.WithKind("Deployment"), "capd-system", "capd-webhook"),
+					newUnstructured(corev1.SchemeGroupVersion.WithKind("ServiceAccount"), "capd-system", "capd-manager"),
+				}},
+			}
+
+			_, err := p.applyAdditionalRBAC(ctx)
+			if tt.wantReason != "" {
+				var pe *PhaseError
+				g.Expect(errors.As(err, &pe)).To(BeTrue())
+				g.Expect(pe.Type).To(Equal(operatorv1.AdditionalRBACAppliedCondition))
+				g.Expect(pe.Reason).To(Equal(tt.wantReason))
+
+				return
+			}
+
+			g.Expect(err).NotTo(HaveOccurred())
+
+			// Objects applied for a previous spec are always deleted.
+			err = fakeclient.Get(ctx, client.ObjectKeyFromObject(staleRole), &rbacv1.Role{})
+			g.Expect(err).To(HaveOccurred())
+
+			if tt.additionalRBAC == nil {
+				g.Expect(conditions.Has(provider, operatorv1.AdditionalRBACAppliedCondition)).To(BeFalse())
+
+				return
+			}
+
+			g.Expect(conditions.IsTrue(provider, operatorv1.AdditionalRBACAppliedCondition)).To(BeTrue())
+
+			got := []string{}
+
+			for _, gvk := range additionalRBACKinds {
+				list := &unstructured.UnstructuredList{}
+				list.SetGroupVersionKind(gvk.GroupVersion().WithKind(gvk.Kind + "List"))
+				g.Expect(fakeclient.List(ctx, list, client.MatchingLabels{additionalRBACLabel: "provider-uid"})).To(Succeed())
+
+				for _, obj := range list.Items {
+					got = append(got, obj.GetKind()+" "+obj.GetNamespace()+"/"+obj.GetName())
+				}
+			}
+
+			g.Expect(got).To(ConsistOf(tt.wantObjects))
+
+			if tt.wantSubjects != nil {
+				binding := &rbacv1.ClusterRoleBinding{}
+				g.Expect(fakeclient.Get(ctx, client.ObjectKey{Name: "capd-system-infrastructure-docker-additional-rbac"}, binding)).To(Succeed())
+				g.Expect(binding.Subjects).To(Equal(tt.wantSubjects))
+			}
+
+			// The objects are deleted with the provider.
+			_, err = p.deleteAdditionalRBAC(ctx)
+			g.Expect(err).NotTo(HaveOccurred())
+
+			for _, gvk := range additionalRBACKinds {
+				list := &unstructured.UnstructuredList{}
+				list.SetGroupVersionKind(gvk.GroupVersion().WithKind(gvk.Kind + "List"))
+				g.Expect(fakeclient.List(ctx, list, client.MatchingLabels{additionalRBACLabel: "provider-uid"})).To(Succeed())
+				g.Expect(list.Items).To(BeEmpty())
+			}
+		})
+	}
+}
+
+func additionalRBACRESTMapper() meta.RESTMapper {
+	mapper := meta.NewDefaultRESTMapper([]schema.GroupVersion{corev1.SchemeGroupVersion, rbacv1.SchemeGroupVersion})
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}, meta.RESTScopeNamespace)
+	mapper.Add(rbacv1.SchemeGroupVersion.WithKind("Role"), meta.RESTScopeNamespace)
+	mapper.Add(rbacv1.SchemeGroupVersion.WithKind("RoleBinding"), meta.RESTScopeNamespace)
+	mapper.Add(rbacv1.SchemeGroupVersion.WithKind("ClusterRole"), meta.RESTScopeRoot)
+	mapper.Add(rbacv1.SchemeGroupVersion.WithKind("ClusterRoleBinding"), meta.RESTScopeRoot)
+
+	return mapper
+}
@@ -0,0 +1,172 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	utiljson "k8s.io/apimachinery/pkg/util/json"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// appliedComponentsKey is the key of the applied components secret holding the gzipped JSON list of the objects.
+	appliedComponentsKey = "components"
+
+	// appliedComponentsHashAnnotation records the hash of the components stored in the applied components secret,
+	// so they are only used while they are the ones reported in status.appliedComponentsHash.
+	appliedComponentsHashAnnotation = "operator.cluster.x-k8s.io/applied-components-hash"
+
+	// appliedComponentsSecretType is the type of the applied components secrets.
+	appliedComponentsSecretType corev1.SecretType = "operator.cluster.x-k8s.io/applied-components"
+)
+
+// appliedComponentsSecretKey returns the key of the secret holding the components last applied for the provider.
+// The components are stored in a secret, as they contain the values of the provider variables, e.g. credentials.
+func (p *phaseReconciler) appliedComponentsSecretKey() client.ObjectKey {
+	return client.ObjectKey{
+		Namespace: p.provider.GetNamespace(),
+		Name:      clusterctlProviderName(p.provider).Name + "-applied-components",
+	}
+}
+
+// storeAppliedComponents stores the components applied for the provider, as rendered from its manifests, so the
+// drift detection compares the live objects with them instead of rendering the components again.
+func (p *phaseReconciler) storeAppliedComponents(ctx context.Context, objs []unstructured.Unstructured, hash string) error {
+	contents := make([]map[string]interface{}, 0, len(objs))
+	for _, obj := range objs {
+		contents = append(contents, obj.Object)
+	}
+
+	data, err := json.Marshal(contents)
+	if err != nil {
+		return fmt.Errorf("failed to marshal the applied components: %w", err)
+	}
+
+	var buf bytes.Buffer
+
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		return fmt.Errorf("failed to compress the applied components: %w", err)
+	}
+
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("failed to compress the applied components: %w", err)
+	}
+
+	key := p.appliedComponentsSecretKey()
+	gvk := p.provider.GetObjectKind().GroupVersionKind()
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        key.Name,
+			Namespace:   key.Namespace,
+			Annotations: map[string]string{appliedComponentsHashAnnotation: hash},
+			OwnerReferences: []metav1.OwnerReference{
+				{
+					APIVersion: gvk.GroupVersion().String(),
+					Kind:       gvk.Kind,
+					Name:       p.provider.GetName(),
+					UID:        p.provider.GetUID(),
+				},
+			},
+		},
+		Type: appliedComponentsSecretType,
+		Data: map[string][]byte{appliedComponentsKey: buf.Bytes()},
+	}
+
+	err = p.ctrlClient.Create(ctx, secret)
+	if err == nil || !apierrors.IsAlreadyExists(err) {
+		return err
+	}
+
+	existing := &corev1.Secret{}
+	if err := p.ctrlClient.Get(ctx, key, existing); err != nil {
+		return err
+	}
+
+	if existing.Type != appliedComponentsSecretType {
+		return fmt.Errorf("secret %s already exists and doesn't hold the applied components of provider %s", key, p.provider.GetName())
+	}
+
+	patchBase := client.MergeFrom(existing.DeepCopy())
+
+	existing.Annotations = secret.Annotations
+	existing.OwnerReferences = secret.OwnerReferences
+	existing.Data = secret.Data
+
+	return p.ctrlClient.Patch(ctx, existing, patchBase)
+}
+
+// appliedComponents returns the components last applied for the provider, or nil if they weren't stored, e.g. for
+// providers installed by a previous version of the operator, or if they aren't the ones last applied anymore.
+func (p *phaseReconciler) appliedComponents(ctx context.Context) ([]unstructured.Unstructured, error) {
+	hash := p.provider.GetStatus().AppliedComponentsHash
+	if hash == nil {
+		return nil, nil
+	}
+
+	secret := &corev1.Secret{}
+	if err := p.ctrlClient.Get(ctx, p.appliedComponentsSecretKey(), secret); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("failed to get the applied components: %w", err)
+	}
+
+	if secret.Type != appliedComponentsSecretType || secret.Annotations[appliedComponentsHashAnnotation] != *hash {
+		return nil, nil
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader(secret.Data[appliedComponentsKey]))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress the applied components: %w", err)
+	}
+
+	data, err := io.ReadAll(zr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress the applied components: %w", err)
+	}
+
+	// The numbers are decoded to int64 where possible, as for the objects decoded from the manifests.
+	contents := []interface{}{}
+	if err := utiljson.Unmarshal(data, &contents); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal the applied components: %w", err)
+	}
+
+	objs := make([]unstructured.Unstructured, 0, len(contents))
+	for _, content := range contents {
+		obj, ok := content.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("failed to unmarshal the applied components: %T is not an object", content)
+		}
+
+		objs = append(objs, unstructured.Unstructured{Object: obj})
+	}
+
+	return objs, nil
+}
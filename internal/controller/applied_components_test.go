@@ -0,0 +1,178 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	operatorv1 "sigs.k8s.io/cluster-api-operator/api/v1alpha2"
+	"sigs.k8s.io/cluster-api-operator/internal/controller/genericprovider"
+)
+
+func TestAppliedComponents(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	deployment := newUnstructured(appsv1.SchemeGroupVersion.WithKind("Deployment"), "capa-system", "capa-controller-manager")
+	g.Expect(unstructured.SetNestedField(deployment.Object, int64(1), "spec", "replicas")).To(Succeed())
+
+	objs := []unstructured.Unstructured{deployment}
+
+	hash, err := componentsHash(objs)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	provider := &genericprovider.InfrastructureProviderWrapper{
+		InfrastructureProvider: &operatorv1.InfrastructureProvider{
+			ObjectMeta: metav1.ObjectMeta{Name: "aws", Namespace: "capa-system", UID: "provider-uid"},
+			Status: operatorv1.InfrastructureProviderStatus{
+				ProviderStatus: operatorv1.ProviderStatus{AppliedComponentsHash: &hash},
+			},
+		},
+	}
+
+	p := &phaseReconciler{ctrlClient: fake.NewClientBuilder().Build(), provider: provider}
+
+	// Nothing is stored for the providers installed by a previous version of the operator.
+	stored, err := p.appliedComponents(ctx)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(stored).To(BeNil())
+
+	g.Expect(p.storeAppliedComponents(ctx, objs, hash)).To(Succeed())
+
+	secret := &corev1.Secret{}
+	g.Expect(p.ctrlClient.Get(ctx, client.ObjectKey{Namespace: "capa-system", Name: "infrastructure-aws-applied-components"}, secret)).To(Succeed())
+	g.Expect(secret.Type).To(Equal(appliedComponentsSecretType))
+	g.Expect(secret.OwnerReferences).To(HaveLen(1))
+	g.Expect(secret.OwnerReferences[0].UID).To(BeEquivalentTo("provider-uid"))
+
+	stored, err = p.appliedComponents(ctx)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(stored).To(Equal(objs))
+
+	// Storing the components again updates the secret.
+	g.Expect(unstructured.SetNestedField(deployment.Object, int64(2), "spec", "replicas")).To(Succeed())
+
+	newHash, err := componentsHash(objs)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(p.storeAppliedComponents(ctx, objs, newHash)).To(Succeed())
+
+	// The stored components are ignored until the hash in the status matches them.
+	stored, err = p.appliedComponents(ctx)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(stored).To(BeNil())
+
+	provider.Status.AppliedComponentsHash = &newHash
+
+	stored, err = p.appliedComponents(ctx)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(stored).To(Equal(objs))
+}
+
+func TestStoreAppliedComponentsDoesNotOverwriteOtherSecrets(t *testing.T) {
+	g := NewWithT(t)
+
+	existing := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "infrastructure-aws-applied-components", Namespace: "capa-system"},
+		Data:       map[string][]byte{"password": []byte("secret")},
+	}
+
+	p := &phaseReconciler{
+		ctrlClient: fake.NewClientBuilder().WithObjects(existing).Build(),
+		provider: &genericprovider.InfrastructureProviderWrapper{
+			InfrastructureProvider: &operatorv1.InfrastructureProvider{
+				ObjectMeta: metav1.ObjectMeta{Name: "aws", Namespace: "capa-system"},
+			},
+		},
+	}
+
+	g.Expect(p.storeAppliedComponents(context.Background(), nil, "hash")).ToNot(Succeed())
+
+	secret := &corev1.Secret{}
+	g.Expect(p.ctrlClient.Get(context.Background(), client.ObjectKeyFromObject(existing), secret)).To(Succeed())
+	g.Expect(secret.Data).To(Equal(existing.Data))
+}
+
+func TestReconcileDriftComparesAppliedComponents(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	desired := newUnstructured(appsv1.SchemeGroupVersion.WithKind("Deployment"), "capa-system", "capa-controller-manager")
+	g.Expect(unstructured.SetNestedField(desired.Object, int64(1), "spec", "replicas")).To(Succeed())
+
+	hash, err := componentsHash([]unstructured.Unstructured{desired})
+	g.Expect(err).ToNot(HaveOccurred())
+
+	version := "v2.1.4"
+
+	provider := &operatorv1.InfrastructureProvider{
+		ObjectMeta: metav1.ObjectMeta{Name: "aws", Namespace: "capa-system"},
+		Status: operatorv1.InfrastructureProviderStatus{
+			ProviderStatus: operatorv1.ProviderStatus{InstalledVersion: &version, AppliedComponentsHash: &hash},
+		},
+	}
+
+	live := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "capa-controller-manager", Namespace: "capa-system"},
+		Spec:       appsv1.DeploymentSpec{Replicas: pointer.Int32(0)},
+	}
+
+	scheme := setupScheme()
+	utilruntime.Must(appsv1.AddToScheme(scheme))
+
+	// There are no manifests to render the components from, only the stored ones are compared.
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(live).WithInterceptorFuncs(interceptor.Funcs{
+		Patch: func(ctx context.Context, c client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+			return nil
+		},
+	}).Build()
+
+	r := &GenericProviderReconciler{
+		Provider:     &operatorv1.InfrastructureProvider{},
+		ProviderList: &operatorv1.InfrastructureProviderList{},
+		Client:       c,
+	}
+
+	wrapper := &genericprovider.InfrastructureProviderWrapper{InfrastructureProvider: provider}
+
+	// The drift detection is skipped until the applied components are stored.
+	_, err = r.reconcileDrift(ctx, wrapper)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(conditions.Has(wrapper, operatorv1.ComponentsDriftedCondition)).To(BeFalse())
+
+	g.Expect(newPhaseReconciler(*r, wrapper, nil).storeAppliedComponents(ctx, []unstructured.Unstructured{desired}, hash)).To(Succeed())
+
+	_, err = r.reconcileDrift(ctx, wrapper)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(conditions.GetReason(wrapper, operatorv1.ComponentsDriftedCondition)).To(Equal(operatorv1.DriftDetectedReason))
+	g.Expect(conditions.GetMessage(wrapper, operatorv1.ComponentsDriftedCondition)).To(ContainSubstring("Deployment capa-system/capa-controller-manager (spec.replicas)"))
+
+	// Fetching the provider manifests would have reported the provider conditions again.
+	g.Expect(conditions.Has(wrapper, operatorv1.ProviderInstalledCondition)).To(BeFalse())
+}
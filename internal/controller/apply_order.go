@@ -0,0 +1,85 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"sort"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// defaultApplyOrder lists the kinds applied before the other components, so that the objects they depend on
+// exist first, like `kubectl apply` and Helm order them.
+var defaultApplyOrder = []string{
+	"Namespace",
+	"CustomResourceDefinition",
+	"ServiceAccount",
+	"ClusterRole",
+	"Role",
+	"ClusterRoleBinding",
+	"RoleBinding",
+}
+
+// sortForApply returns the objects in the order they are applied. The kinds of the apply order, or of the
+// default one if empty, come first in that order, then the other components. With the default order, the
+// custom resources of the CustomResourceDefinitions among the objects come last. Objects of the same rank
+// keep their order.
+func sortForApply(objs []unstructured.Unstructured, applyOrder []string) []unstructured.Unstructured {
+	order := applyOrder
+	if len(order) == 0 {
+		order = defaultApplyOrder
+	}
+
+	ranks := make(map[string]int, len(order))
+	for i, kind := range order {
+		ranks[kind] = i
+	}
+
+	customResources := map[schema.GroupKind]bool{}
+
+	if len(applyOrder) == 0 {
+		for _, obj := range objs {
+			if !isCRD(obj) {
+				continue
+			}
+
+			group, _, _ := unstructured.NestedString(obj.Object, "spec", "group")
+			kind, _, _ := unstructured.NestedString(obj.Object, "spec", "names", "kind")
+			customResources[schema.GroupKind{Group: group, Kind: kind}] = true
+		}
+	}
+
+	rank := func(obj unstructured.Unstructured) int {
+		if r, ok := ranks[obj.GetKind()]; ok {
+			return r
+		}
+
+		if customResources[obj.GroupVersionKind().GroupKind()] {
+			return len(order) + 1
+		}
+
+		return len(order)
+	}
+
+	sorted := append([]unstructured.Unstructured{}, objs...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return rank(sorted[i]) < rank(sorted[j])
+	})
+
+	return sorted
+}
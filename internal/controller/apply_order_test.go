@@ -0,0 +1,104 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	operatorv1 "sigs.k8s.io/cluster-api-operator/api/v1alpha2"
+	"sigs.k8s.io/cluster-api-operator/internal/controller/genericprovider"
+)
+
+func TestApplyComponentsOrder(t *testing.T) {
+	crd := newUnstructured(apiextensionsv1.SchemeGroupVersion.WithKind("CustomResourceDefinition"), "", "awsclustercontrolleridentities.infrastructure.cluster.x-k8s.io")
+	crd.Object["spec"] = map[string]interface{}{
+		"group": "infrastructure.cluster.x-k8s.io",
+		"names": map[string]interface{}{"kind": "AWSClusterControllerIdentity"},
+	}
+
+	// The manifests list the custom resource before its CRD, and the RBAC after the Deployment using it.
+	misordered := []unstructured.Unstructured{
+		newUnstructured(schema.GroupVersionKind{Group: "infrastructure.cluster.x-k8s.io", Version: "v1beta2", Kind: "AWSClusterControllerIdentity"}, "", "default"),
+		newUnstructured(appsv1.SchemeGroupVersion.WithKind("Deployment"), "capa-system", "capa-controller-manager"),
+		newUnstructured(rbacv1.SchemeGroupVersion.WithKind("ClusterRoleBinding"), "", "capa-manager-rolebinding"),
+		newUnstructured(rbacv1.SchemeGroupVersion.WithKind("ClusterRole"), "", "capa-manager-role"),
+		crd,
+		newUnstructured(corev1.SchemeGroupVersion.WithKind("Namespace"), "", "capa-system"),
+	}
+
+	testCases := []struct {
+		name          string
+		applyOrder    []string
+		expectedKinds []string
+	}{
+		{
+			name:          "default order",
+			expectedKinds: []string{"Namespace", "CustomResourceDefinition", "ClusterRole", "ClusterRoleBinding", "Deployment", "AWSClusterControllerIdentity"},
+		},
+		{
+			name:          "apply order of the provider",
+			applyOrder:    []string{"CustomResourceDefinition", "Namespace"},
+			expectedKinds: []string{"CustomResourceDefinition", "Namespace", "AWSClusterControllerIdentity", "Deployment", "ClusterRoleBinding", "ClusterRole"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			applied := []string{}
+
+			p := &phaseReconciler{
+				ctrlClient: fake.NewClientBuilder().WithInterceptorFuncs(interceptor.Funcs{
+					Patch: func(ctx context.Context, c client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+						applied = append(applied, obj.GetObjectKind().GroupVersionKind().Kind)
+
+						return nil
+					},
+				}).Build(),
+				provider: &genericprovider.InfrastructureProviderWrapper{
+					InfrastructureProvider: &operatorv1.InfrastructureProvider{
+						ObjectMeta: metav1.ObjectMeta{Name: "aws", Namespace: "capa-system"},
+						Spec: operatorv1.InfrastructureProviderSpec{
+							ProviderSpec: operatorv1.ProviderSpec{ApplyOrder: tc.applyOrder},
+						},
+					},
+				},
+				serverSideApply: true,
+			}
+
+			g.Expect(p.applyComponents(context.Background(), misordered)).To(Succeed())
+			g.Expect(applied).To(Equal(tc.expectedKinds))
+
+			// The components themselves are left in the order of the manifests.
+			g.Expect(misordered[0].GetKind()).To(Equal("AWSClusterControllerIdentity"))
+		})
+	}
+}
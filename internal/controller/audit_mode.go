@@ -0,0 +1,261 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	operatorv1 "sigs.k8s.io/cluster-api-operator/api/v1alpha2"
+)
+
+// maxPendingChangesInMessage is the number of changes listed in the PendingChanges condition message.
+const maxPendingChangesInMessage = 5
+
+// auditClient is the client of the reconcilers in audit mode. The reads reach the cluster, while the writes are
+// recorded as pending changes and dropped. The objects it would have created are returned by the later lists,
+// e.g. the ConfigMap storing the downloaded manifests, so the phases relying on them can run.
+type auditClient struct {
+	client.Client
+
+	lock    sync.Mutex
+	changes []string
+	created []client.Object
+}
+
+var _ client.Client = &auditClient{}
+
+// newAuditClient returns an audit client reading with the given client.
+func newAuditClient(c client.Client) *auditClient {
+	return &auditClient{Client: c}
+}
+
+// record adds the change to the pending ones, unless it's already pending.
+func (c *auditClient) record(change string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if !slices.Contains(c.changes, change) {
+		c.changes = append(c.changes, change)
+	}
+}
+
+// pendingChanges returns the changes recorded, in the order they would have been made.
+func (c *auditClient) pendingChanges() []string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return slices.Clone(c.changes)
+}
+
+// describe returns the verb, kind, namespace and name of a change, e.g. "create Namespace /capi-system".
+func (c *auditClient) describe(verb string, obj runtime.Object) string {
+	kind := obj.GetObjectKind().GroupVersionKind().Kind
+	if gvk, err := apiutil.GVKForObject(obj, c.Scheme()); err == nil {
+		kind = gvk.Kind
+	}
+
+	if o, ok := obj.(client.Object); ok {
+		return fmt.Sprintf("%s %s %s", verb, kind, client.ObjectKeyFromObject(o))
+	}
+
+	return fmt.Sprintf("%s %s", verb, kind)
+}
+
+// Create records the creation of the object. The access reviews are sent, as they are not persisted and the
+// operator permissions may be checked in audit mode too.
+func (c *auditClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	if gvk, err := apiutil.GVKForObject(obj, c.Scheme()); err == nil && gvk.Group == "authorization.k8s.io" {
+		return c.Client.Create(ctx, obj, opts...)
+	}
+
+	c.record(c.describe("create", obj))
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.created = append(c.created, obj.DeepCopyObject().(client.Object))
+
+	return nil
+}
+
+// Update records the update of the object.
+func (c *auditClient) Update(_ context.Context, obj client.Object, _ ...client.UpdateOption) error {
+	c.record(c.describe("update", obj))
+
+	return nil
+}
+
+// Patch records the patch of the object, e.g. a server-side apply.
+func (c *auditClient) Patch(_ context.Context, obj client.Object, patch client.Patch, _ ...client.PatchOption) error {
+	verb := "patch"
+	if patch.Type() == client.Apply.Type() {
+		verb = "apply"
+	}
+
+	c.record(c.describe(verb, obj))
+
+	return nil
+}
+
+// Delete records the deletion of the object.
+func (c *auditClient) Delete(_ context.Context, obj client.Object, _ ...client.DeleteOption) error {
+	c.record(c.describe("delete", obj))
+
+	return nil
+}
+
+// DeleteAllOf records the deletion of the objects of the kind.
+func (c *auditClient) DeleteAllOf(_ context.Context, obj client.Object, _ ...client.DeleteAllOfOption) error {
+	c.record(c.describe("delete all", obj))
+
+	return nil
+}
+
+// Status returns a writer recording the status updates.
+func (c *auditClient) Status() client.SubResourceWriter {
+	return c.SubResource("status")
+}
+
+// SubResource returns a writer recording the subresource updates.
+func (c *auditClient) SubResource(subResource string) client.SubResourceClient {
+	return &auditSubResourceClient{SubResourceClient: c.Client.SubResource(subResource), audit: c, subResource: subResource}
+}
+
+// List lists the objects in the cluster, along with the matching ones the client would have created.
+func (c *auditClient) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	if err := c.Client.List(ctx, list, opts...); err != nil {
+		return err
+	}
+
+	listGVK, err := apiutil.GVKForObject(list, c.Scheme())
+	if err != nil {
+		return err
+	}
+
+	listOpts := (&client.ListOptions{}).ApplyOptions(opts)
+
+	items, err := meta.ExtractList(list)
+	if err != nil {
+		return err
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for _, obj := range c.created {
+		gvk, err := apiutil.GVKForObject(obj, c.Scheme())
+		if err != nil || gvk.GroupVersion() != listGVK.GroupVersion() || gvk.Kind+"List" != listGVK.Kind {
+			continue
+		}
+
+		if listOpts.Namespace != "" && obj.GetNamespace() != listOpts.Namespace {
+			continue
+		}
+
+		if listOpts.LabelSelector != nil && !listOpts.LabelSelector.Matches(labels.Set(obj.GetLabels())) {
+			continue
+		}
+
+		items = append(items, obj.DeepCopyObject())
+	}
+
+	// The list is left as is if the created objects are of another type than its items, e.g. unstructured ones.
+	_ = meta.SetList(list, items)
+
+	return nil
+}
+
+// auditSubResourceClient records the subresource updates of an audit client.
+type auditSubResourceClient struct {
+	client.SubResourceClient
+
+	audit       *auditClient
+	subResource string
+}
+
+func (c *auditSubResourceClient) Create(_ context.Context, obj client.Object, _ client.Object, _ ...client.SubResourceCreateOption) error {
+	c.audit.record(c.audit.describe("create "+c.subResource+" of", obj))
+
+	return nil
+}
+
+func (c *auditSubResourceClient) Update(_ context.Context, obj client.Object, _ ...client.SubResourceUpdateOption) error {
+	c.audit.record(c.audit.describe("update "+c.subResource+" of", obj))
+
+	return nil
+}
+
+func (c *auditSubResourceClient) Patch(_ context.Context, obj client.Object, _ client.Patch, _ ...client.SubResourcePatchOption) error {
+	c.audit.record(c.audit.describe("patch "+c.subResource+" of", obj))
+
+	return nil
+}
+
+// auditInstall records the components differing from the live ones, or missing, as pending changes, instead of
+// applying them. The provider components are reported as not installed.
+func (p *phaseReconciler) auditInstall(ctx context.Context, objs []unstructured.Unstructured) (reconcile.Result, error) {
+	drifts, err := componentsDrift(ctx, p.ctrlClient, objs)
+	if err != nil {
+		return reconcile.Result{}, wrapPhaseError(err, operatorv1.ApplyFailedReason)
+	}
+
+	for _, drift := range drifts {
+		p.audit.record("apply " + drift.String())
+	}
+
+	conditions.Set(p.provider, conditions.FalseCondition(operatorv1.ProviderInstalledCondition, operatorv1.AuditModeReason,
+		clusterv1.ConditionSeverityInfo, "Audit mode, %d of the %d components differ from the live ones and are not applied", len(drifts), len(objs)))
+
+	return reconcile.Result{}, nil
+}
+
+// setPendingChanges reports the changes recorded in audit mode in the PendingChanges condition, which is removed
+// if there are none.
+func setPendingChanges(obj conditions.Setter, changes []string) {
+	if len(changes) == 0 {
+		conditions.Delete(obj, operatorv1.PendingChangesCondition)
+
+		return
+	}
+
+	msg := strings.Join(changes[:min(len(changes), maxPendingChangesInMessage)], ", ")
+	if len(changes) > maxPendingChangesInMessage {
+		msg += fmt.Sprintf(" and %d more", len(changes)-maxPendingChangesInMessage)
+	}
+
+	conditions.Set(obj, &clusterv1.Condition{
+		Type:    operatorv1.PendingChangesCondition,
+		Status:  corev1.ConditionTrue,
+		Reason:  operatorv1.AuditModeReason,
+		Message: fmt.Sprintf("Audit mode, %d changes not applied: %s", len(changes), msg),
+	})
+}
@@ -0,0 +1,195 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	operatorv1 "sigs.k8s.io/cluster-api-operator/api/v1alpha2"
+	"sigs.k8s.io/cluster-api-operator/internal/controller/genericprovider"
+)
+
+func TestAuditMode(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	metadata := `apiVersion: clusterctl.cluster.x-k8s.io/v1alpha3
+kind: Metadata
+releaseSeries:
+- major: 1
+  minor: 5
+  contract: v1beta1
+`
+
+	components := `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: capi-controller-manager
+  namespace: capi-system
+spec:
+  selector:
+    matchLabels:
+      control-plane: controller-manager
+  template:
+    metadata:
+      labels:
+        control-plane: controller-manager
+    spec:
+      containers:
+      - name: manager
+        image: registry.k8s.io/cluster-api/cluster-api-controller:v1.5.1
+`
+
+	provider := &operatorv1.CoreProvider{
+		ObjectMeta: metav1.ObjectMeta{Name: "cluster-api", Namespace: "capi-system"},
+		Spec: operatorv1.CoreProviderSpec{
+			ProviderSpec: operatorv1.ProviderSpec{
+				FetchConfig: &operatorv1.FetchConfiguration{
+					Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"provider-components": "core"}},
+				},
+			},
+		},
+	}
+
+	manifests := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "v1.5.1",
+			Namespace: "capi-system",
+			Labels:    map[string]string{"provider-components": "core"},
+		},
+		Data: map[string]string{metadataConfigMapKey: metadata, componentsConfigMapKey: components},
+	}
+
+	scheme := setupScheme()
+	utilruntime.Must(appsv1.AddToScheme(scheme))
+	utilruntime.Must(apiextensionsv1.AddToScheme(scheme))
+
+	writes := []string{}
+
+	fakeClient := fake.NewClientBuilder().WithScheme(scheme).
+		WithObjects(provider, manifests).
+		WithStatusSubresource(provider).
+		WithInterceptorFuncs(interceptor.Funcs{
+			Create: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.CreateOption) error {
+				writes = append(writes, "create "+obj.GetName())
+
+				return c.Create(ctx, obj, opts...)
+			},
+			Update: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.UpdateOption) error {
+				writes = append(writes, "update "+obj.GetName())
+
+				return c.Update(ctx, obj, opts...)
+			},
+			Patch: func(ctx context.Context, c client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+				writes = append(writes, "patch "+obj.GetName())
+
+				return c.Patch(ctx, obj, patch, opts...)
+			},
+			Delete: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.DeleteOption) error {
+				writes = append(writes, "delete "+obj.GetName())
+
+				return c.Delete(ctx, obj, opts...)
+			},
+			SubResourcePatch: func(ctx context.Context, c client.Client, subResourceName string, obj client.Object, patch client.Patch, opts ...client.SubResourcePatchOption) error {
+				writes = append(writes, "patch "+subResourceName+" "+obj.GetName())
+
+				return c.SubResource(subResourceName).Patch(ctx, obj, patch, opts...)
+			},
+		}).
+		Build()
+
+	r := &GenericProviderReconciler{
+		Provider:     &operatorv1.CoreProvider{},
+		ProviderList: &operatorv1.CoreProviderList{},
+		Client:       fakeClient,
+		AuditMode:    true,
+	}
+
+	_, err := r.Reconcile(ctx, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(provider)})
+	g.Expect(err).ToNot(HaveOccurred())
+
+	// Only the provider status is patched.
+	g.Expect(writes).To(Equal([]string{"patch status cluster-api"}))
+
+	g.Expect(fakeClient.Get(ctx, client.ObjectKeyFromObject(provider), provider)).To(Succeed())
+	g.Expect(provider.Finalizers).To(BeEmpty())
+	g.Expect(provider.Annotations).ToNot(HaveKey(appliedSpecHashAnnotation))
+	g.Expect(provider.Spec.Version).To(BeEmpty())
+	g.Expect(provider.Status.InstalledVersion).To(BeNil())
+	g.Expect(fakeClient.Get(ctx, client.ObjectKey{Namespace: "capi-system", Name: "capi-controller-manager"}, &appsv1.Deployment{})).ToNot(Succeed())
+
+	wrapper := &genericprovider.CoreProviderWrapper{CoreProvider: provider}
+
+	g.Expect(conditions.GetReason(wrapper, operatorv1.ProviderInstalledCondition)).To(Equal(operatorv1.AuditModeReason))
+	g.Expect(conditions.GetMessage(wrapper, operatorv1.ProviderInstalledCondition)).To(Equal(
+		"Audit mode, 1 of the 1 components differ from the live ones and are not applied"))
+	g.Expect(conditions.IsFalse(wrapper, clusterv1.ReadyCondition)).To(BeTrue())
+
+	g.Expect(conditions.IsTrue(wrapper, operatorv1.PendingChangesCondition)).To(BeTrue())
+	g.Expect(conditions.GetMessage(wrapper, operatorv1.PendingChangesCondition)).To(Equal(
+		"Audit mode, 2 changes not applied: create Namespace /capi-system, apply Deployment capi-system/capi-controller-manager (missing)"))
+}
+
+func TestAuditClient(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	existing := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "existing", Namespace: "capi-system", Labels: map[string]string{"app": "capi"}},
+	}
+
+	fakeClient := fake.NewClientBuilder().WithScheme(setupScheme()).WithObjects(existing).Build()
+	c := newAuditClient(fakeClient)
+
+	created := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "created", Namespace: "capi-system", Labels: map[string]string{"app": "capi"}},
+	}
+	g.Expect(c.Create(ctx, created)).To(Succeed())
+	g.Expect(c.Create(ctx, &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "capi-system"}})).To(Succeed())
+	g.Expect(c.Delete(ctx, existing)).To(Succeed())
+	g.Expect(c.Status().Update(ctx, existing)).To(Succeed())
+
+	// Nothing is written, but the created objects are listed.
+	configMaps := &corev1.ConfigMapList{}
+	g.Expect(fakeClient.List(ctx, configMaps)).To(Succeed())
+	g.Expect(configMaps.Items).To(HaveLen(1))
+
+	g.Expect(c.List(ctx, configMaps, client.InNamespace("capi-system"), client.MatchingLabels{"app": "capi"})).To(Succeed())
+	g.Expect(configMaps.Items).To(HaveLen(2))
+	g.Expect(configMaps.Items[1].Name).To(Equal("created"))
+
+	g.Expect(c.pendingChanges()).To(Equal([]string{
+		"create ConfigMap capi-system/created",
+		"create ConfigMap capi-system/other",
+		"delete ConfigMap capi-system/existing",
+		"update status of ConfigMap capi-system/existing",
+	}))
+}
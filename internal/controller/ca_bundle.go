@@ -0,0 +1,170 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	operatorv1 "sigs.k8s.io/cluster-api-operator/api/v1alpha2"
+)
+
+const (
+	defaultCABundleKey = "ca.crt"
+
+	caBundleVolumeName = "operator-ca-bundle"
+	caBundleMountPath  = "/etc/ssl/certs/operator-ca-bundle.crt"
+)
+
+// validateCABundleRef returns a message describing why the CA bundle reference is invalid,
+// or an empty string if it is valid.
+func validateCABundleRef(ref *operatorv1.CABundleReference, providerNamespace string) string {
+	if (ref.ConfigMap == nil) == (ref.PEM == "") {
+		return "Exactly one of ConfigMap and PEM must be provided for the CA bundle"
+	}
+
+	if ref.MountIntoDeployment {
+		if ref.ConfigMap == nil {
+			return "CA bundle can only be mounted into the deployment when it is stored in a ConfigMap"
+		}
+
+		if ref.ConfigMap.Namespace != "" && ref.ConfigMap.Namespace != providerNamespace {
+			return "CA bundle can only be mounted into the deployment when the ConfigMap is in the provider namespace"
+		}
+	}
+
+	return ""
+}
+
+// caBundleKey returns the config map key holding the CA bundle.
+func caBundleKey(ref *operatorv1.CABundleReference) string {
+	if ref.Key != "" {
+		return ref.Key
+	}
+
+	return defaultCABundleKey
+}
+
+// getCABundle returns the PEM encoded CA bundle configured for fetching the provider manifests,
+// or nil if no CA bundle is configured.
+func (p *phaseReconciler) getCABundle(ctx context.Context) ([]byte, error) {
+	fetchConfig := p.provider.GetSpec().FetchConfig
+	if fetchConfig == nil || fetchConfig.CABundleRef == nil {
+		return nil, nil
+	}
+
+	return p.readCABundle(ctx, fetchConfig.CABundleRef)
+}
+
+// readCABundle returns the PEM encoded CA bundle the reference points to.
+func (p *phaseReconciler) readCABundle(ctx context.Context, ref *operatorv1.CABundleReference) ([]byte, error) {
+	if ref.ConfigMap == nil {
+		return []byte(ref.PEM), nil
+	}
+
+	namespace := ref.ConfigMap.Namespace
+	if namespace == "" {
+		namespace = p.provider.GetNamespace()
+	}
+
+	cm := &corev1.ConfigMap{}
+	key := types.NamespacedName{Namespace: namespace, Name: ref.ConfigMap.Name}
+
+	if err := p.ctrlClient.Get(ctx, key, cm); err != nil {
+		return nil, fmt.Errorf("failed to get CA bundle config map %s: %w", key, err)
+	}
+
+	bundle, ok := cm.Data[caBundleKey(ref)]
+	if !ok {
+		return nil, fmt.Errorf("CA bundle config map %s doesn't contain key %q", key, caBundleKey(ref))
+	}
+
+	return []byte(bundle), nil
+}
+
+// parseCABundle parses all PEM encoded certificates in the bundle.
+func parseCABundle(bundle []byte) ([]*x509.Certificate, error) {
+	certs := []*x509.Certificate{}
+
+	for {
+		var block *pem.Block
+
+		block, bundle = pem.Decode(bundle)
+		if block == nil {
+			break
+		}
+
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse CA bundle certificate: %w", err)
+		}
+
+		certs = append(certs, cert)
+	}
+
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("CA bundle doesn't contain any PEM encoded certificate")
+	}
+
+	return certs, nil
+}
+
+// newHTTPClientWithCABundle returns an http client trusting the system roots and the certificates in the bundle.
+func newHTTPClientWithCABundle(bundle []byte) (*http.Client, error) {
+	certs, err := parseCABundle(bundle)
+	if err != nil {
+		return nil, err
+	}
+
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+
+	for _, cert := range certs {
+		pool.AddCert(cert)
+	}
+
+	transport := defaultTransport()
+	transport.TLSClientConfig = &tls.Config{
+		RootCAs:    pool,
+		MinVersion: tls.VersionTLS12,
+	}
+
+	return &http.Client{Transport: NewRateLimitTransport(transport)}, nil
+}
+
+// newRepositoryHTTPClient returns the http client to use for fetching the provider manifests,
+// or nil if the default one should be used.
+func (p *phaseReconciler) newRepositoryHTTPClient(ctx context.Context) (*http.Client, error) {
+	bundle, err := p.getCABundle(ctx)
+	if err != nil || bundle == nil {
+		return nil, err
+	}
+
+	return newHTTPClientWithCABundle(bundle)
+}
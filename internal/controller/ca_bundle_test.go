@@ -0,0 +1,189 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+
+	operatorv1 "sigs.k8s.io/cluster-api-operator/api/v1alpha2"
+	clusterctlv1 "sigs.k8s.io/cluster-api/cmd/clusterctl/api/v1alpha3"
+	configclient "sigs.k8s.io/cluster-api/cmd/clusterctl/client/config"
+)
+
+func TestValidateCABundleRef(t *testing.T) {
+	testCases := []struct {
+		name          string
+		ref           *operatorv1.CABundleReference
+		expectedValid bool
+	}{
+		{
+			name: "config map",
+			ref: &operatorv1.CABundleReference{
+				ConfigMap: &operatorv1.ConfigmapReference{Name: "ca", Namespace: "other"},
+			},
+			expectedValid: true,
+		},
+		{
+			name:          "inline PEM",
+			ref:           &operatorv1.CABundleReference{PEM: "pem"},
+			expectedValid: true,
+		},
+		{
+			name:          "neither config map nor PEM",
+			ref:           &operatorv1.CABundleReference{},
+			expectedValid: false,
+		},
+		{
+			name: "both config map and PEM",
+			ref: &operatorv1.CABundleReference{
+				ConfigMap: &operatorv1.ConfigmapReference{Name: "ca"},
+				PEM:       "pem",
+			},
+			expectedValid: false,
+		},
+		{
+			name: "mount config map from provider namespace",
+			ref: &operatorv1.CABundleReference{
+				ConfigMap:           &operatorv1.ConfigmapReference{Name: "ca", Namespace: "provider"},
+				MountIntoDeployment: true,
+			},
+			expectedValid: true,
+		},
+		{
+			name: "mount config map from another namespace",
+			ref: &operatorv1.CABundleReference{
+				ConfigMap:           &operatorv1.ConfigmapReference{Name: "ca", Namespace: "other"},
+				MountIntoDeployment: true,
+			},
+			expectedValid: false,
+		},
+		{
+			name:          "mount inline PEM",
+			ref:           &operatorv1.CABundleReference{PEM: "pem", MountIntoDeployment: true},
+			expectedValid: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			g.Expect(validateCABundleRef(tc.ref, "provider") == "").To(Equal(tc.expectedValid))
+		})
+	}
+}
+
+func TestParseCABundle(t *testing.T) {
+	g := NewWithT(t)
+
+	bundle := append(generateTestCertPEM(t, "first"), generateTestCertPEM(t, "second")...)
+
+	certs, err := parseCABundle(bundle)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(certs).To(HaveLen(2))
+	g.Expect(certs[0].Subject.CommonName).To(Equal("first"))
+	g.Expect(certs[1].Subject.CommonName).To(Equal("second"))
+
+	_, err = parseCABundle([]byte("not a certificate"))
+	g.Expect(err).To(HaveOccurred())
+
+	_, err = parseCABundle(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: []byte("invalid")}))
+	g.Expect(err).To(HaveOccurred())
+}
+
+func TestGitLabRepositoryWithCABundle(t *testing.T) {
+	g := NewWithT(t)
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.EscapedPath() != "/api/v4/projects/group%2Fproject/packages/generic/my-provider/v1.0.0/components.yaml" {
+			w.WriteHeader(http.StatusNotFound)
+
+			return
+		}
+
+		_, _ = w.Write([]byte("components"))
+	}))
+	defer server.Close()
+
+	serverCertPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	httpClient, err := newHTTPClientWithCABundle(append(generateTestCertPEM(t, "other"), serverCertPEM...))
+	g.Expect(err).ToNot(HaveOccurred())
+
+	providerConfig := configclient.NewProvider("my-provider",
+		server.URL+"/api/v4/projects/group%2Fproject/packages/generic/my-provider/v1.0.0/components.yaml",
+		clusterctlv1.InfrastructureProviderType)
+
+	repo, err := newGitLabRepository(providerConfig, httpClient)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(repo.DefaultVersion()).To(Equal("v1.0.0"))
+	g.Expect(repo.ComponentsPath()).To(Equal("components.yaml"))
+
+	content, err := repo.GetFile("v1.0.0", "components.yaml")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(string(content)).To(Equal("components"))
+
+	_, err = repo.GetFile("v1.0.0", "metadata.yaml")
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(isVersionNotFound(err)).To(BeTrue())
+
+	// Without the server certificate the TLS handshake must fail.
+	httpClient, err = newHTTPClientWithCABundle(generateTestCertPEM(t, "other"))
+	g.Expect(err).ToNot(HaveOccurred())
+
+	repo, err = newGitLabRepository(providerConfig, httpClient)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	_, err = repo.GetFile("v1.0.0", "components.yaml")
+	g.Expect(err).To(HaveOccurred())
+}
+
+func generateTestCertPEM(t *testing.T, commonName string) []byte {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
@@ -0,0 +1,89 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+// CacheSyncGate waits for the informers of the objects read by the reconcilers to sync, so that the providers
+// aren't reconciled against a partial cache on startup, e.g. reporting their Deployments or CRDs as missing.
+// It's started by the manager, also on the replicas not elected as leader, and reflects the sync in the
+// readiness checks.
+type CacheSyncGate struct {
+	cache   cache.Informers
+	objects []client.Object
+	synced  atomic.Bool
+}
+
+var (
+	_ manager.Runnable               = &CacheSyncGate{}
+	_ manager.LeaderElectionRunnable = &CacheSyncGate{}
+)
+
+// NewCacheSyncGate returns a gate waiting for the informers of the given objects, created if needed, to sync.
+func NewCacheSyncGate(c cache.Informers, objects ...client.Object) *CacheSyncGate {
+	return &CacheSyncGate{cache: c, objects: objects}
+}
+
+// Start waits for the informers to sync. It returns once they are synced, or with an error if the context is
+// cancelled first.
+func (g *CacheSyncGate) Start(ctx context.Context) error {
+	for _, obj := range g.objects {
+		if _, err := g.cache.GetInformer(ctx, obj); err != nil {
+			return fmt.Errorf("failed to get informer for %T: %w", obj, err)
+		}
+	}
+
+	if !g.cache.WaitForCacheSync(ctx) {
+		return errors.New("failed to wait for the caches to sync")
+	}
+
+	g.synced.Store(true)
+
+	return nil
+}
+
+// NeedLeaderElection returns false, as the readiness of all the replicas reflects their cache sync.
+func (g *CacheSyncGate) NeedLeaderElection() bool {
+	return false
+}
+
+// Synced returns whether the informers are synced. A nil gate is always synced.
+func (g *CacheSyncGate) Synced() bool {
+	return g == nil || g.synced.Load()
+}
+
+// Check is a health check failing until the informers are synced.
+func (g *CacheSyncGate) Check(_ *http.Request) error {
+	if !g.Synced() {
+		return errors.New("caches not synced")
+	}
+
+	return nil
+}
+
+var _ healthz.Checker = (&CacheSyncGate{}).Check
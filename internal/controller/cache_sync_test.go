@@ -0,0 +1,116 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	operatorv1 "sigs.k8s.io/cluster-api-operator/api/v1alpha2"
+)
+
+// fakeInformers records the informers requested, and reports them synced once allowed.
+type fakeInformers struct {
+	cache.Informers
+
+	requested []client.Object
+	sync      chan struct{}
+}
+
+func (f *fakeInformers) GetInformer(_ context.Context, obj client.Object) (cache.Informer, error) {
+	f.requested = append(f.requested, obj)
+
+	return nil, nil
+}
+
+func (f *fakeInformers) WaitForCacheSync(ctx context.Context) bool {
+	select {
+	case <-f.sync:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func TestCacheSyncGate(t *testing.T) {
+	g := NewWithT(t)
+
+	informers := &fakeInformers{sync: make(chan struct{})}
+	gate := NewCacheSyncGate(informers, &operatorv1.CoreProvider{}, &appsv1.Deployment{})
+
+	g.Expect(gate.NeedLeaderElection()).To(BeFalse())
+	g.Expect(gate.Synced()).To(BeFalse())
+	g.Expect(gate.Check(nil)).ToNot(Succeed())
+
+	done := make(chan error)
+	go func() {
+		done <- gate.Start(context.Background())
+	}()
+
+	close(informers.sync)
+	g.Expect(<-done).To(Succeed())
+
+	g.Expect(informers.requested).To(HaveLen(2))
+	g.Expect(gate.Synced()).To(BeTrue())
+	g.Expect(gate.Check(nil)).To(Succeed())
+
+	// The gate isn't synced if the manager stops before the caches sync.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	gate = NewCacheSyncGate(&fakeInformers{sync: make(chan struct{})})
+	g.Expect(gate.Start(ctx)).ToNot(Succeed())
+	g.Expect(gate.Synced()).To(BeFalse())
+
+	// Without a gate the caches are assumed synced.
+	g.Expect((*CacheSyncGate)(nil).Synced()).To(BeTrue())
+}
+
+func TestReconcileWaitsForCacheSync(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	provider := &operatorv1.CoreProvider{
+		ObjectMeta: metav1.ObjectMeta{Name: "cluster-api", Namespace: "capi-system"},
+	}
+
+	fakeClient := fake.NewClientBuilder().WithScheme(setupScheme()).WithObjects(provider).Build()
+
+	r := &GenericProviderReconciler{
+		Provider:     &operatorv1.CoreProvider{},
+		ProviderList: &operatorv1.CoreProviderList{},
+		Client:       fakeClient,
+		CacheSync:    NewCacheSyncGate(&fakeInformers{sync: make(chan struct{})}),
+	}
+
+	result, err := r.Reconcile(ctx, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(provider)})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(result.RequeueAfter).To(Equal(cacheSyncRequeueAfter))
+
+	// The provider is left untouched until the caches are synced.
+	g.Expect(fakeClient.Get(ctx, client.ObjectKeyFromObject(provider), provider)).To(Succeed())
+	g.Expect(provider.Finalizers).To(BeEmpty())
+	g.Expect(provider.Status.Conditions).To(BeEmpty())
+}
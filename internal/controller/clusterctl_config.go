@@ -0,0 +1,105 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/yaml"
+)
+
+const defaultClusterctlConfigKey = "clusterctl.yaml"
+
+// clusterctlConfigReservedKeys are the clusterctl configuration keys that aren't variables. The provider
+// repositories are configured with the fetch configuration instead, and image overrides aren't used.
+var clusterctlConfigReservedKeys = map[string]bool{
+	"providers": true,
+	"images":    true,
+}
+
+// clusterctlConfigVariables returns the variables of the clusterctl configuration file referenced by
+// the provider, or nil if there is none.
+func (p *phaseReconciler) clusterctlConfigVariables(ctx context.Context) (map[string]string, error) {
+	ref := p.provider.GetSpec().ConfigSecretRef
+	if ref == nil {
+		return nil, nil
+	}
+
+	key := types.NamespacedName{Namespace: ref.Namespace, Name: ref.Name}
+	if key.Namespace == "" {
+		key.Namespace = p.provider.GetNamespace()
+	}
+
+	configKey := ref.Key
+	if configKey == "" {
+		configKey = defaultClusterctlConfigKey
+	}
+
+	secret := &corev1.Secret{}
+	if err := p.ctrlClient.Get(ctx, key, secret); err != nil {
+		return nil, fmt.Errorf("failed to get clusterctl config secret %s: %w", key, err)
+	}
+
+	data, ok := secret.Data[configKey]
+	if !ok {
+		return nil, fmt.Errorf("key %q not found in clusterctl config secret %s", configKey, key)
+	}
+
+	variables, err := parseClusterctlConfig(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid clusterctl config in secret %s: %w", key, err)
+	}
+
+	return variables, nil
+}
+
+// parseClusterctlConfig returns the variables set in a clusterctl configuration file. Scalar values are
+// returned as written, while lists and maps are returned as YAML.
+func parseClusterctlConfig(data []byte) (map[string]string, error) {
+	config := map[string]interface{}{}
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, err
+	}
+
+	variables := map[string]string{}
+
+	for k, v := range config {
+		if clusterctlConfigReservedKeys[k] || v == nil {
+			continue
+		}
+
+		switch value := v.(type) {
+		case string:
+			variables[k] = value
+		case map[string]interface{}, []interface{}:
+			out, err := yaml.Marshal(value)
+			if err != nil {
+				return nil, fmt.Errorf("failed to encode variable %q: %w", k, err)
+			}
+
+			variables[k] = strings.TrimSuffix(string(out), "\n")
+		default:
+			variables[k] = fmt.Sprint(value)
+		}
+	}
+
+	return variables, nil
+}
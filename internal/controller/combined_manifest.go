@@ -0,0 +1,104 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	clusterctlv1 "sigs.k8s.io/cluster-api/cmd/clusterctl/api/v1alpha3"
+	"sigs.k8s.io/yaml"
+)
+
+// splitManifest splits a release combined in a single multi-document YAML into its metadata and components. The
+// metadata is the clusterctl Metadata document, which must be present exactly once, and the components are all the
+// other documents, kept as is so their variables are still processed. The empty documents are dropped.
+func splitManifest(manifest string) (string, string, error) {
+	reader := utilyaml.NewYAMLReader(bufio.NewReader(strings.NewReader(manifest)))
+
+	metadata := ""
+	components := []string{}
+
+	for {
+		doc, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			return "", "", fmt.Errorf("failed to read document: %w", err)
+		}
+
+		if isEmptyDocument(doc) {
+			continue
+		}
+
+		if !isMetadataDocument(doc) {
+			components = append(components, strings.TrimSuffix(string(doc), "\n"))
+
+			continue
+		}
+
+		if metadata != "" {
+			return "", "", errors.New("more than one metadata document")
+		}
+
+		metadata = string(doc)
+	}
+
+	if metadata == "" {
+		return "", "", errors.New("no metadata document")
+	}
+
+	if len(components) == 0 {
+		return "", "", errors.New("no components document")
+	}
+
+	return metadata, strings.Join(components, "\n---\n") + "\n", nil
+}
+
+// isMetadataDocument returns whether the YAML document is a clusterctl Metadata. The documents that can't be
+// decoded, e.g. because of a variable, are components.
+func isMetadataDocument(doc []byte) bool {
+	typeMeta := metav1.TypeMeta{}
+	if err := yaml.Unmarshal(doc, &typeMeta); err != nil {
+		return false
+	}
+
+	gv, err := schema.ParseGroupVersion(typeMeta.APIVersion)
+	if err != nil {
+		return false
+	}
+
+	return gv.Group == clusterctlv1.GroupVersion.Group && typeMeta.Kind == "Metadata"
+}
+
+// isEmptyDocument returns whether the YAML document only has comments.
+func isEmptyDocument(doc []byte) bool {
+	obj := map[string]interface{}{}
+	if err := yaml.Unmarshal(doc, &obj); err != nil {
+		return false
+	}
+
+	return len(obj) == 0
+}
@@ -0,0 +1,176 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	operatorv1 "sigs.k8s.io/cluster-api-operator/api/v1alpha2"
+	"sigs.k8s.io/cluster-api-operator/internal/controller/genericprovider"
+)
+
+const (
+	combinedMetadata = `apiVersion: clusterctl.cluster.x-k8s.io/v1alpha3
+kind: Metadata
+releaseSeries:
+- major: 1
+  minor: 5
+  contract: v1beta1
+`
+
+	combinedComponents = `apiVersion: v1
+kind: Namespace
+metadata:
+  name: ${NAMESPACE}
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: capa-controller-manager
+  namespace: ${NAMESPACE}
+`
+)
+
+func TestSplitManifest(t *testing.T) {
+	tests := []struct {
+		name               string
+		manifest           string
+		wantErr            string
+		expectedComponents string
+	}{
+		{
+			name:               "metadata first",
+			manifest:           combinedMetadata + "---\n" + combinedComponents,
+			expectedComponents: combinedComponents,
+		},
+		{
+			name: "metadata between the components, with empty documents",
+			manifest: "---\n# Release v1.5.0\n---\n" + `apiVersion: v1
+kind: Namespace
+metadata:
+  name: ${NAMESPACE}
+---
+` + combinedMetadata + `---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: capa-controller-manager
+  namespace: ${NAMESPACE}
+---
+`,
+			expectedComponents: combinedComponents,
+		},
+		{
+			name:     "missing metadata",
+			manifest: combinedComponents,
+			wantErr:  "no metadata document",
+		},
+		{
+			name:     "missing components",
+			manifest: combinedMetadata,
+			wantErr:  "no components document",
+		},
+		{
+			name:     "metadata twice",
+			manifest: combinedMetadata + "---\n" + combinedMetadata + "---\n" + combinedComponents,
+			wantErr:  "more than one metadata document",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			metadata, components, err := splitManifest(tt.manifest)
+			if tt.wantErr != "" {
+				g.Expect(err).To(MatchError(tt.wantErr))
+
+				return
+			}
+
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(metadata).To(Equal(combinedMetadata))
+			g.Expect(components).To(Equal(tt.expectedComponents))
+		})
+	}
+}
+
+func TestConfigmapRepositoryCombinedManifest(t *testing.T) {
+	g := NewWithT(t)
+
+	provider := &genericprovider.InfrastructureProviderWrapper{
+		InfrastructureProvider: &operatorv1.InfrastructureProvider{
+			ObjectMeta: metav1.ObjectMeta{Name: "aws", Namespace: "capa-system"},
+			Spec: operatorv1.InfrastructureProviderSpec{
+				ProviderSpec: operatorv1.ProviderSpec{
+					FetchConfig: &operatorv1.FetchConfiguration{
+						Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"provider-components": "aws"}},
+					},
+				},
+			},
+		},
+	}
+
+	configMaps := []corev1.ConfigMap{
+		{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "v1.5.0",
+				Namespace: "capa-system",
+				Labels:    map[string]string{"provider-components": "aws"},
+			},
+			Data: map[string]string{manifestConfigMapKey: combinedMetadata + "---\n" + combinedComponents},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "v1.4.0",
+				Namespace: "capa-system",
+				Labels:    map[string]string{"provider-components": "aws"},
+			},
+			Data: map[string]string{metadataConfigMapKey: combinedMetadata, componentsConfigMapKey: combinedComponents},
+		},
+	}
+
+	fakeClient := fake.NewClientBuilder().WithScheme(setupScheme()).WithObjects(&configMaps[0], &configMaps[1]).Build()
+	p := &phaseReconciler{ctrlClient: fakeClient, provider: provider}
+
+	repo, err := p.configmapRepository(context.Background(), provider.GetSpec().FetchConfig.Selector)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	// The combined and split ConfigMaps provide the same files.
+	for _, version := range []string{"v1.5.0", "v1.4.0"} {
+		metadata, err := repo.GetFile(version, metadataFile)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(string(metadata)).To(Equal(combinedMetadata))
+
+		components, err := repo.GetFile(version, repo.ComponentsPath())
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(string(components)).To(Equal(combinedComponents))
+	}
+
+	// A combined manifest without components is rejected.
+	configMaps[0].Data[manifestConfigMapKey] = combinedMetadata
+	g.Expect(fakeClient.Update(context.Background(), &configMaps[0])).To(Succeed())
+
+	_, err = p.configmapRepository(context.Background(), provider.GetSpec().FetchConfig.Selector)
+	g.Expect(err).To(MatchError("invalid manifest in ConfigMap capa-system/v1.5.0: no components document"))
+}
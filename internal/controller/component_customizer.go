@@ -18,7 +18,9 @@ package controller
 
 import (
 	"fmt"
+	"net"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -26,6 +28,7 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/client-go/kubernetes/scheme"
 	configv1alpha1 "k8s.io/component-base/config/v1alpha1"
 	"k8s.io/utils/pointer"
@@ -35,10 +38,18 @@ import (
 )
 
 const (
-	deploymentKind       = "Deployment"
-	namespaceKind        = "Namespace"
-	managerContainerName = "manager"
-	defaultVerbosity     = 1
+	deploymentKind         = "Deployment"
+	namespaceKind          = "Namespace"
+	serviceAccountKind     = "ServiceAccount"
+	roleBindingKind        = "RoleBinding"
+	clusterRoleBindingKind = "ClusterRoleBinding"
+	managerContainerName   = "manager"
+	defaultVerbosity       = 1
+
+	// healthzPortName and metricsPortName are the names of the health probe and metrics container
+	// ports in the Cluster API provider manifests.
+	healthzPortName = "healthz"
+	metricsPortName = "metrics"
 )
 
 var bool2Str = map[bool]string{true: "true", false: "false"}
@@ -48,6 +59,9 @@ func customizeObjectsFn(provider genericprovider.GenericProvider) func(objs []un
 	return func(objs []unstructured.Unstructured) ([]unstructured.Unstructured, error) {
 		results := []unstructured.Unstructured{}
 
+		// replacedServiceAccounts are the ServiceAccounts of the Deployments replaced by spec.deployment.serviceAccountName.
+		replacedServiceAccounts := map[string]bool{}
+
 		for i := range objs {
 			o := objs[i]
 
@@ -73,6 +87,11 @@ func customizeObjectsFn(provider genericprovider.GenericProvider) func(objs []un
 					return nil, err
 				}
 
+				if name := serviceAccountName(d); provider.GetSpec().Deployment != nil &&
+					provider.GetSpec().Deployment.ServiceAccountName != "" && provider.GetSpec().Deployment.ServiceAccountName != name {
+					replacedServiceAccounts[d.Namespace+"/"+name] = true
+				}
+
 				if err := customizeDeployment(provider.GetSpec(), d); err != nil {
 					return nil, err
 				}
@@ -85,10 +104,166 @@ func customizeObjectsFn(provider genericprovider.GenericProvider) func(objs []un
 			results = append(results, o)
 		}
 
+		if len(replacedServiceAccounts) > 0 {
+			var err error
+
+			results, err = replaceServiceAccounts(results, replacedServiceAccounts, provider.GetSpec().Deployment.ServiceAccountName)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if dSpec := provider.GetSpec().Deployment; dSpec != nil && (len(dSpec.ImagePullSecrets) > 0 || len(dSpec.ServiceAccountAnnotations) > 0) {
+			if err := customizeServiceAccounts(results, dSpec); err != nil {
+				return nil, err
+			}
+		}
+
 		return results, nil
 	}
 }
 
+// serviceAccountName returns the ServiceAccount the deployment pods run as, defaulting to "default" as in the pod spec.
+func serviceAccountName(d *appsv1.Deployment) string {
+	if d.Spec.Template.Spec.ServiceAccountName != "" {
+		return d.Spec.Template.Spec.ServiceAccountName
+	}
+
+	return "default"
+}
+
+// replaceServiceAccounts drops the replaced ServiceAccounts of the provider, as the pods run as the external one
+// instead, and binds the roles they were bound to to the external ServiceAccount, so it gets the same permissions.
+func replaceServiceAccounts(objs []unstructured.Unstructured, replaced map[string]bool, name string) ([]unstructured.Unstructured, error) {
+	results := make([]unstructured.Unstructured, 0, len(objs))
+
+	for i := range objs {
+		o := objs[i]
+
+		switch o.GetKind() {
+		case serviceAccountKind:
+			if replaced[o.GetNamespace()+"/"+o.GetName()] {
+				continue
+			}
+		case roleBindingKind, clusterRoleBindingKind:
+			subjects, found, err := unstructured.NestedSlice(o.Object, "subjects")
+			if err != nil {
+				return nil, err
+			}
+
+			if !found {
+				break
+			}
+
+			for _, s := range subjects {
+				subject, ok := s.(map[string]interface{})
+				if !ok || subject["kind"] != serviceAccountKind {
+					continue
+				}
+
+				namespace, _ := subject["namespace"].(string)
+				if namespace == "" {
+					namespace = o.GetNamespace()
+				}
+
+				if subjectName, _ := subject["name"].(string); replaced[namespace+"/"+subjectName] {
+					subject["name"] = name
+				}
+			}
+
+			if err := unstructured.SetNestedSlice(o.Object, subjects, "subjects"); err != nil {
+				return nil, err
+			}
+		}
+
+		results = append(results, o)
+	}
+
+	return results, nil
+}
+
+// customizeServiceAccounts adds the image pull secrets and the annotations of the deployment spec to the provider
+// ServiceAccounts that are used by the provider deployments, so pods created with them can pull from private
+// registries too, and the cloud IAM annotations are part of the applied manifests.
+func customizeServiceAccounts(objs []unstructured.Unstructured, dSpec *operatorv1.DeploymentSpec) error {
+	serviceAccounts := map[string]bool{}
+
+	for i := range objs {
+		if objs[i].GetKind() != deploymentKind {
+			continue
+		}
+
+		name, _, err := unstructured.NestedString(objs[i].Object, "spec", "template", "spec", "serviceAccountName")
+		if err != nil {
+			return err
+		}
+
+		if name != "" {
+			serviceAccounts[objs[i].GetNamespace()+"/"+name] = true
+		}
+	}
+
+	for i := range objs {
+		o := &objs[i]
+
+		if o.GetKind() != serviceAccountKind || !serviceAccounts[o.GetNamespace()+"/"+o.GetName()] {
+			continue
+		}
+
+		sa := &corev1.ServiceAccount{}
+		if err := scheme.Scheme.Convert(o, sa, nil); err != nil {
+			return err
+		}
+
+		sa.ImagePullSecrets = mergeImagePullSecrets(sa.ImagePullSecrets, dSpec.ImagePullSecrets)
+		sa.Annotations = mergeAnnotations(sa.Annotations, dSpec.ServiceAccountAnnotations)
+
+		if err := scheme.Scheme.Convert(sa, o, nil); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// mergeAnnotations sets the annotations on base, overriding the existing values, and returns it.
+func mergeAnnotations(base, annotations map[string]string) map[string]string {
+	if len(annotations) == 0 {
+		return base
+	}
+
+	if base == nil {
+		base = map[string]string{}
+	}
+
+	for k, v := range annotations {
+		base[k] = v
+	}
+
+	return base
+}
+
+// mergeImagePullSecrets appends the image pull secrets that are not in base yet.
+func mergeImagePullSecrets(base, secrets []corev1.LocalObjectReference) []corev1.LocalObjectReference {
+	for _, s := range secrets {
+		found := false
+
+		for _, b := range base {
+			if b.Name == s.Name {
+				found = true
+
+				break
+			}
+		}
+
+		if !found {
+			base = append(base, s)
+		}
+	}
+
+	return base
+}
+
 // customizeDeployment customize provider deployment base on provider spec input.
 func customizeDeployment(pSpec operatorv1.ProviderSpec, d *appsv1.Deployment) error {
 	// Customize deployment spec first.
@@ -96,6 +271,31 @@ func customizeDeployment(pSpec operatorv1.ProviderSpec, d *appsv1.Deployment) er
 		customizeDeploymentSpec(pSpec, d)
 	}
 
+	// Add the additional volumes and mounts after the containers were customized.
+	if pSpec.Deployment != nil {
+		if err := addVolumes(pSpec.Deployment, d); err != nil {
+			return err
+		}
+
+		if err := addInitContainers(pSpec.Deployment, d); err != nil {
+			return err
+		}
+
+		if err := addPorts(pSpec.Deployment, d); err != nil {
+			return err
+		}
+	}
+
+	// Override the manager image after the containers were customized, so it wins over their ImageURL.
+	if pSpec.Deployment != nil && pSpec.Deployment.Image != nil {
+		container := findManagerContainer(&d.Spec)
+		if container == nil {
+			return fmt.Errorf("cannot find %q container in deployment %q", managerContainerName, d.Name)
+		}
+
+		container.Image = imageReference(pSpec.Deployment.Image)
+	}
+
 	// Run the customizeManagerContainer after so it overrides anything in the deploymentSpec.
 	if pSpec.Manager != nil {
 		container := findManagerContainer(&d.Spec)
@@ -106,6 +306,13 @@ func customizeDeployment(pSpec operatorv1.ProviderSpec, d *appsv1.Deployment) er
 		customizeManagerContainer(pSpec.Manager, container)
 	}
 
+	// Mount the CA bundle used for fetching the manifests into the manager container if requested.
+	if pSpec.FetchConfig != nil && pSpec.FetchConfig.CABundleRef != nil && pSpec.FetchConfig.CABundleRef.MountIntoDeployment {
+		if err := mountCABundle(pSpec.FetchConfig.CABundleRef, d); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -132,8 +339,27 @@ func customizeDeploymentSpec(pSpec operatorv1.ProviderSpec, d *appsv1.Deployment
 		d.Spec.Template.Spec.ServiceAccountName = dSpec.ServiceAccountName
 	}
 
+	if dSpec.PriorityClassName != "" {
+		d.Spec.Template.Spec.PriorityClassName = dSpec.PriorityClassName
+	}
+
+	if dSpec.TerminationGracePeriodSeconds != nil {
+		d.Spec.Template.Spec.TerminationGracePeriodSeconds = pointer.Int64(*dSpec.TerminationGracePeriodSeconds)
+	}
+
 	if dSpec.ImagePullSecrets != nil {
-		d.Spec.Template.Spec.ImagePullSecrets = dSpec.ImagePullSecrets
+		d.Spec.Template.Spec.ImagePullSecrets = mergeImagePullSecrets(d.Spec.Template.Spec.ImagePullSecrets, dSpec.ImagePullSecrets)
+	}
+
+	if dSpec.SecurityContext != nil {
+		d.Spec.Template.Spec.SecurityContext = mergePodSecurityContext(d.Spec.Template.Spec.SecurityContext, dSpec.SecurityContext)
+	}
+
+	if dSpec.ContainerSecurityContext != nil {
+		for i := range d.Spec.Template.Spec.Containers {
+			c := &d.Spec.Template.Spec.Containers[i]
+			c.SecurityContext = mergeSecurityContext(c.SecurityContext, dSpec.ContainerSecurityContext)
+		}
 	}
 
 	for _, pc := range dSpec.Containers {
@@ -176,6 +402,7 @@ func customizeManagerContainer(mSpec *operatorv1.ManagerSpec, c *corev1.Containe
 
 	if mSpec.Health.HealthProbeBindAddress != "" {
 		c.Args = setArgs(c.Args, "--health-addr", mSpec.Health.HealthProbeBindAddress)
+		setContainerPort(c, healthzPortName, mSpec.Health.HealthProbeBindAddress)
 	}
 
 	if mSpec.Health.LivenessEndpointName != "" && c.LivenessProbe != nil && c.LivenessProbe.HTTPGet != nil {
@@ -186,12 +413,13 @@ func customizeManagerContainer(mSpec *operatorv1.ManagerSpec, c *corev1.Containe
 		c.ReadinessProbe.HTTPGet.Path = "/" + mSpec.Health.ReadinessEndpointName
 	}
 
-	if mSpec.LeaderElection != nil && mSpec.LeaderElection.LeaderElect != nil {
+	if mSpec.LeaderElection != nil {
 		c.Args = leaderElectionArgs(mSpec.LeaderElection, c.Args)
 	}
 
 	if mSpec.Metrics.BindAddress != "" {
 		c.Args = setArgs(c.Args, "--metrics-bind-addr", mSpec.Metrics.BindAddress)
+		setContainerPort(c, metricsPortName, mSpec.Metrics.BindAddress)
 	}
 
 	// webhooks
@@ -223,6 +451,10 @@ func customizeManagerContainer(mSpec *operatorv1.ManagerSpec, c *corev1.Containe
 		c.Args = setArgs(c.Args, "--v", fmt.Sprint(mSpec.Verbosity))
 	}
 
+	if mSpec.LogFormat != "" {
+		c.Args = setArgs(c.Args, "--logging-format", mSpec.LogFormat)
+	}
+
 	if len(mSpec.FeatureGates) > 0 {
 		fgValue := []string{}
 
@@ -270,6 +502,378 @@ func customizeContainer(cSpec operatorv1.ContainerSpec, d *appsv1.Deployment) {
 	}
 }
 
+// mergePodSecurityContext returns the base pod security context with the fields set in the
+// override replacing the base ones.
+func mergePodSecurityContext(base, override *corev1.PodSecurityContext) *corev1.PodSecurityContext {
+	merged := &corev1.PodSecurityContext{}
+	if base != nil {
+		merged = base.DeepCopy()
+	}
+
+	o := override.DeepCopy()
+
+	if o.SELinuxOptions != nil {
+		merged.SELinuxOptions = o.SELinuxOptions
+	}
+
+	if o.WindowsOptions != nil {
+		merged.WindowsOptions = o.WindowsOptions
+	}
+
+	if o.RunAsUser != nil {
+		merged.RunAsUser = o.RunAsUser
+	}
+
+	if o.RunAsGroup != nil {
+		merged.RunAsGroup = o.RunAsGroup
+	}
+
+	if o.RunAsNonRoot != nil {
+		merged.RunAsNonRoot = o.RunAsNonRoot
+	}
+
+	if o.SupplementalGroups != nil {
+		merged.SupplementalGroups = o.SupplementalGroups
+	}
+
+	if o.FSGroup != nil {
+		merged.FSGroup = o.FSGroup
+	}
+
+	if o.Sysctls != nil {
+		merged.Sysctls = o.Sysctls
+	}
+
+	if o.FSGroupChangePolicy != nil {
+		merged.FSGroupChangePolicy = o.FSGroupChangePolicy
+	}
+
+	if o.SeccompProfile != nil {
+		merged.SeccompProfile = o.SeccompProfile
+	}
+
+	return merged
+}
+
+// mergeSecurityContext returns the base container security context with the fields set in the
+// override replacing the base ones.
+func mergeSecurityContext(base, override *corev1.SecurityContext) *corev1.SecurityContext {
+	merged := &corev1.SecurityContext{}
+	if base != nil {
+		merged = base.DeepCopy()
+	}
+
+	o := override.DeepCopy()
+
+	if o.Capabilities != nil {
+		merged.Capabilities = o.Capabilities
+	}
+
+	if o.Privileged != nil {
+		merged.Privileged = o.Privileged
+	}
+
+	if o.SELinuxOptions != nil {
+		merged.SELinuxOptions = o.SELinuxOptions
+	}
+
+	if o.WindowsOptions != nil {
+		merged.WindowsOptions = o.WindowsOptions
+	}
+
+	if o.RunAsUser != nil {
+		merged.RunAsUser = o.RunAsUser
+	}
+
+	if o.RunAsGroup != nil {
+		merged.RunAsGroup = o.RunAsGroup
+	}
+
+	if o.RunAsNonRoot != nil {
+		merged.RunAsNonRoot = o.RunAsNonRoot
+	}
+
+	if o.ReadOnlyRootFilesystem != nil {
+		merged.ReadOnlyRootFilesystem = o.ReadOnlyRootFilesystem
+	}
+
+	if o.AllowPrivilegeEscalation != nil {
+		merged.AllowPrivilegeEscalation = o.AllowPrivilegeEscalation
+	}
+
+	if o.ProcMount != nil {
+		merged.ProcMount = o.ProcMount
+	}
+
+	if o.SeccompProfile != nil {
+		merged.SeccompProfile = o.SeccompProfile
+	}
+
+	return merged
+}
+
+// volumeConflictError is returned when the additional volumes or volume mounts of a provider
+// collide with the ones in its deployment.
+type volumeConflictError struct {
+	msg string
+}
+
+func (e *volumeConflictError) Error() string {
+	return e.msg
+}
+
+// addVolumes adds the additional volumes and the container volume mounts from the deployment spec
+// to the provider deployment, failing if they collide with the existing ones.
+func addVolumes(dSpec *operatorv1.DeploymentSpec, d *appsv1.Deployment) error {
+	for _, v := range dSpec.AdditionalVolumes {
+		for _, existing := range d.Spec.Template.Spec.Volumes {
+			if existing.Name == v.Name {
+				return &volumeConflictError{fmt.Sprintf("volume %q already exists in deployment %q", v.Name, d.Name)}
+			}
+		}
+
+		d.Spec.Template.Spec.Volumes = append(d.Spec.Template.Spec.Volumes, v)
+	}
+
+	for _, cSpec := range dSpec.Containers {
+		for i := range d.Spec.Template.Spec.Containers {
+			c := &d.Spec.Template.Spec.Containers[i]
+			if c.Name != cSpec.Name {
+				continue
+			}
+
+			for _, vm := range cSpec.VolumeMounts {
+				for _, existing := range c.VolumeMounts {
+					if existing.MountPath == vm.MountPath {
+						return &volumeConflictError{fmt.Sprintf("mount path %q of volume %q collides with volume %q in container %q of deployment %q",
+							vm.MountPath, vm.Name, existing.Name, c.Name, d.Name)}
+					}
+				}
+
+				c.VolumeMounts = append(c.VolumeMounts, vm)
+			}
+		}
+	}
+
+	return nil
+}
+
+// validateVolumes checks that the additional volumes and the container volume mounts in the
+// deployment spec don't collide with each other, returning a message describing the problem otherwise.
+func validateVolumes(dSpec *operatorv1.DeploymentSpec) string {
+	volumes := map[string]bool{}
+
+	for _, v := range dSpec.AdditionalVolumes {
+		if volumes[v.Name] {
+			return fmt.Sprintf("additional volume %q is defined more than once", v.Name)
+		}
+
+		volumes[v.Name] = true
+	}
+
+	for _, cSpec := range dSpec.Containers {
+		mountPaths := map[string]string{}
+
+		for _, vm := range cSpec.VolumeMounts {
+			if name, ok := mountPaths[vm.MountPath]; ok {
+				return fmt.Sprintf("mount path %q of volume %q collides with volume %q in container %q", vm.MountPath, vm.Name, name, cSpec.Name)
+			}
+
+			mountPaths[vm.MountPath] = vm.Name
+		}
+	}
+
+	return ""
+}
+
+// initContainerConflictError is returned when the init containers of a provider collide with the
+// containers in its deployment.
+type initContainerConflictError struct {
+	msg string
+}
+
+func (e *initContainerConflictError) Error() string {
+	return e.msg
+}
+
+// addInitContainers appends the init containers from the deployment spec to the provider deployment,
+// failing if their names collide with the existing init containers or containers.
+func addInitContainers(dSpec *operatorv1.DeploymentSpec, d *appsv1.Deployment) error {
+	existing := map[string]bool{}
+
+	for _, c := range d.Spec.Template.Spec.InitContainers {
+		existing[c.Name] = true
+	}
+
+	for _, c := range d.Spec.Template.Spec.Containers {
+		existing[c.Name] = true
+	}
+
+	for _, ic := range dSpec.InitContainers {
+		if existing[ic.Name] {
+			return &initContainerConflictError{fmt.Sprintf("container %q already exists in deployment %q", ic.Name, d.Name)}
+		}
+
+		d.Spec.Template.Spec.InitContainers = append(d.Spec.Template.Spec.InitContainers, ic)
+	}
+
+	return nil
+}
+
+// validateInitContainers checks that the init containers in the deployment spec have an image and
+// unique names, returning a message describing the problem otherwise.
+func validateInitContainers(dSpec *operatorv1.DeploymentSpec) string {
+	names := map[string]bool{}
+
+	for _, ic := range dSpec.InitContainers {
+		if names[ic.Name] {
+			return fmt.Sprintf("init container %q is defined more than once", ic.Name)
+		}
+
+		names[ic.Name] = true
+
+		if ic.Image == "" {
+			return fmt.Sprintf("init container %q has no image", ic.Name)
+		}
+	}
+
+	return ""
+}
+
+// portConflictError is returned when the additional ports of a provider collide with the ports of the
+// containers in its deployment.
+type portConflictError struct {
+	msg string
+}
+
+func (e *portConflictError) Error() string {
+	return e.msg
+}
+
+// addPorts appends the additional ports from the deployment spec to the manager container, failing if their
+// names collide with the manager container ports, or their numbers with the ports of any container, as the
+// containers of a pod share its network namespace.
+func addPorts(dSpec *operatorv1.DeploymentSpec, d *appsv1.Deployment) error {
+	if len(dSpec.AdditionalPorts) == 0 {
+		return nil
+	}
+
+	container := findManagerContainer(&d.Spec)
+	if container == nil {
+		return fmt.Errorf("cannot find %q container in deployment %q", managerContainerName, d.Name)
+	}
+
+	for _, port := range dSpec.AdditionalPorts {
+		for _, c := range d.Spec.Template.Spec.Containers {
+			for _, existing := range c.Ports {
+				if port.Name != "" && port.Name == existing.Name && c.Name == container.Name {
+					return &portConflictError{fmt.Sprintf("port %q already exists in container %q of deployment %q", port.Name, c.Name, d.Name)}
+				}
+
+				if port.ContainerPort == existing.ContainerPort && portProtocol(port) == portProtocol(existing) {
+					return &portConflictError{fmt.Sprintf("port %d/%s is already used by container %q of deployment %q",
+						port.ContainerPort, portProtocol(port), c.Name, d.Name)}
+				}
+			}
+		}
+
+		container.Ports = append(container.Ports, port)
+	}
+
+	return nil
+}
+
+// validateAdditionalPorts checks that the additional ports in the deployment spec have a valid number and
+// unique names and numbers, returning a message describing the problem otherwise.
+func validateAdditionalPorts(dSpec *operatorv1.DeploymentSpec) string {
+	names := map[string]bool{}
+	numbers := map[string]bool{}
+
+	for _, port := range dSpec.AdditionalPorts {
+		if port.ContainerPort < 1 || port.ContainerPort > 65535 {
+			return fmt.Sprintf("additional port %d is not between 1 and 65535", port.ContainerPort)
+		}
+
+		if port.Name != "" {
+			if names[port.Name] {
+				return fmt.Sprintf("additional port %q is defined more than once", port.Name)
+			}
+
+			names[port.Name] = true
+		}
+
+		number := fmt.Sprintf("%d/%s", port.ContainerPort, portProtocol(port))
+		if numbers[number] {
+			return fmt.Sprintf("additional port %s is defined more than once", number)
+		}
+
+		numbers[number] = true
+	}
+
+	return ""
+}
+
+// portProtocol returns the protocol of the port, TCP if unset.
+func portProtocol(port corev1.ContainerPort) corev1.Protocol {
+	if port.Protocol == "" {
+		return corev1.ProtocolTCP
+	}
+
+	return port.Protocol
+}
+
+// mountCABundle mounts the CA bundle config map into the manager container, so it is trusted by the provider.
+func mountCABundle(ref *operatorv1.CABundleReference, d *appsv1.Deployment) error {
+	if ref.ConfigMap == nil {
+		return fmt.Errorf("cannot mount CA bundle into deployment %q: config map is not specified", d.Name)
+	}
+
+	container := findManagerContainer(&d.Spec)
+	if container == nil {
+		return fmt.Errorf("cannot find %q container in deployment %q", managerContainerName, d.Name)
+	}
+
+	volume := corev1.Volume{
+		Name: caBundleVolumeName,
+		VolumeSource: corev1.VolumeSource{
+			ConfigMap: &corev1.ConfigMapVolumeSource{
+				LocalObjectReference: corev1.LocalObjectReference{Name: ref.ConfigMap.Name},
+				Items: []corev1.KeyToPath{{
+					Key:  caBundleKey(ref),
+					Path: defaultCABundleKey,
+				}},
+			},
+		},
+	}
+
+	volumes := []corev1.Volume{}
+
+	for _, v := range d.Spec.Template.Spec.Volumes {
+		if v.Name != caBundleVolumeName {
+			volumes = append(volumes, v)
+		}
+	}
+
+	d.Spec.Template.Spec.Volumes = append(volumes, volume)
+
+	volumeMounts := []corev1.VolumeMount{}
+
+	for _, vm := range container.VolumeMounts {
+		if vm.Name != caBundleVolumeName {
+			volumeMounts = append(volumeMounts, vm)
+		}
+	}
+
+	container.VolumeMounts = append(volumeMounts, corev1.VolumeMount{
+		Name:      caBundleVolumeName,
+		MountPath: caBundleMountPath,
+		SubPath:   defaultCABundleKey,
+		ReadOnly:  true,
+	})
+
+	return nil
+}
+
 // setArg set container arguments.
 func setArgs(args []string, name, value string) []string {
 	for i, a := range args {
@@ -298,9 +902,12 @@ func removeEnv(envs []corev1.EnvVar, name string) []corev1.EnvVar {
 
 // leaderElectionArgs set leader election flags.
 func leaderElectionArgs(lec *configv1alpha1.LeaderElectionConfiguration, args []string) []string {
-	args = setArgs(args, "--leader-elect", bool2Str[*lec.LeaderElect])
+	// Without an explicit LeaderElect the manifest default is kept, and only the lease settings are tuned.
+	if lec.LeaderElect != nil {
+		args = setArgs(args, "--leader-elect", bool2Str[*lec.LeaderElect])
+	}
 
-	if *lec.LeaderElect {
+	if lec.LeaderElect == nil || *lec.LeaderElect {
 		if lec.ResourceName != "" && lec.ResourceNamespace != "" {
 			args = setArgs(args, "--leader-election-id", lec.ResourceNamespace+"/"+lec.ResourceName)
 		}
@@ -326,3 +933,88 @@ func leaderElectionArgs(lec *configv1alpha1.LeaderElectionConfiguration, args []
 
 	return args
 }
+
+// validateLeaderElection returns a message describing why the leader election configuration is invalid,
+// or an empty string if it is valid. Zero durations are left unset, so they keep the manifest values.
+func validateLeaderElection(lec *configv1alpha1.LeaderElectionConfiguration) string {
+	durations := []struct {
+		name  string
+		value time.Duration
+	}{
+		{"leaseDuration", lec.LeaseDuration.Duration},
+		{"renewDeadline", lec.RenewDeadline.Duration},
+		{"retryPeriod", lec.RetryPeriod.Duration},
+	}
+
+	for _, d := range durations {
+		if d.value < 0 {
+			return fmt.Sprintf("Leader election %s must be positive, got %s", d.name, d.value)
+		}
+	}
+
+	if lec.LeaseDuration.Duration > 0 && lec.RenewDeadline.Duration >= lec.LeaseDuration.Duration {
+		return fmt.Sprintf("Leader election renewDeadline %s must be shorter than leaseDuration %s", lec.RenewDeadline.Duration, lec.LeaseDuration.Duration)
+	}
+
+	return ""
+}
+
+// setContainerPort sets the container port with the given name to the port of the bind address, so the
+// Deployment keeps exposing the port the manager listens on. Probes referring to the previous port by
+// number are updated too, while the ones referring to it by name follow the port.
+func setContainerPort(c *corev1.Container, name, address string) {
+	port, ok := bindAddressPort(address)
+	if !ok {
+		return
+	}
+
+	for i := range c.Ports {
+		if c.Ports[i].Name != name {
+			continue
+		}
+
+		previous := c.Ports[i].ContainerPort
+		c.Ports[i].ContainerPort = port
+
+		for _, probe := range []*corev1.Probe{c.LivenessProbe, c.ReadinessProbe, c.StartupProbe} {
+			if probe != nil && probe.HTTPGet != nil && probe.HTTPGet.Port.Type == intstr.Int && probe.HTTPGet.Port.IntVal == previous {
+				probe.HTTPGet.Port = intstr.FromInt(int(port))
+			}
+		}
+	}
+}
+
+// bindAddressPort returns the port of a bind address like ":8080" or "localhost:8080", or false if the
+// address doesn't bind a fixed port, e.g. because it is "0" and disables the endpoint.
+func bindAddressPort(address string) (int32, bool) {
+	_, p, err := net.SplitHostPort(address)
+	if err != nil {
+		return 0, false
+	}
+
+	port, err := strconv.ParseInt(p, 10, 32)
+	if err != nil || port < 1 || port > 65535 {
+		return 0, false
+	}
+
+	return int32(port), true
+}
+
+// validateBindAddress returns a message describing why the bind address is invalid, or an empty string
+// if it is valid. Besides host:port addresses, "0" is accepted as it disables the endpoint.
+func validateBindAddress(name, address string) string {
+	if address == "" || address == "0" {
+		return ""
+	}
+
+	_, p, err := net.SplitHostPort(address)
+	if err != nil {
+		return fmt.Sprintf("%s %q must be in the host:port format, e.g. \":8080\"", name, address)
+	}
+
+	if port, err := strconv.Atoi(p); err != nil || port < 0 || port > 65535 {
+		return fmt.Sprintf("%s %q must have a port between 0 and 65535", name, address)
+	}
+
+	return ""
+}
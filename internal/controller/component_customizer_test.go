@@ -17,6 +17,7 @@ limitations under the License.
 package controller
 
 import (
+	"errors"
 	"reflect"
 	"testing"
 	"time"
@@ -24,13 +25,17 @@ import (
 	"github.com/google/go-cmp/cmp"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/util/intstr"
 	configv1alpha1 "k8s.io/component-base/config/v1alpha1"
 	"k8s.io/utils/pointer"
 
 	operatorv1 "sigs.k8s.io/cluster-api-operator/api/v1alpha2"
+	"sigs.k8s.io/cluster-api-operator/internal/controller/genericprovider"
 )
 
 func TestCustomizeDeployment(t *testing.T) {
@@ -82,6 +87,7 @@ func TestCustomizeDeployment(t *testing.T) {
 		name                   string
 		inputDeploymentSpec    *operatorv1.DeploymentSpec
 		inputManagerSpec       *operatorv1.ManagerSpec
+		inputFetchConfig       *operatorv1.FetchConfiguration
 		expectedDeploymentSpec func(*appsv1.DeploymentSpec) (*appsv1.DeploymentSpec, bool)
 	}{
 		{
@@ -218,6 +224,40 @@ func TestCustomizeDeployment(t *testing.T) {
 				return expectedDS, reflect.DeepEqual(inputDS.Template.Spec.ServiceAccountName, expectedDS.Template.Spec.ServiceAccountName)
 			},
 		},
+		{
+			name: "only priorityClassName modified",
+			inputDeploymentSpec: &operatorv1.DeploymentSpec{
+				PriorityClassName: "system-cluster-critical",
+			},
+			expectedDeploymentSpec: func(inputDS *appsv1.DeploymentSpec) (*appsv1.DeploymentSpec, bool) {
+				expectedDS := &appsv1.DeploymentSpec{
+					Template: corev1.PodTemplateSpec{
+						Spec: corev1.PodSpec{
+							PriorityClassName: "system-cluster-critical",
+						},
+					},
+				}
+
+				return expectedDS, reflect.DeepEqual(inputDS.Template.Spec.PriorityClassName, expectedDS.Template.Spec.PriorityClassName)
+			},
+		},
+		{
+			name: "only terminationGracePeriodSeconds modified",
+			inputDeploymentSpec: &operatorv1.DeploymentSpec{
+				TerminationGracePeriodSeconds: pointer.Int64(3600),
+			},
+			expectedDeploymentSpec: func(inputDS *appsv1.DeploymentSpec) (*appsv1.DeploymentSpec, bool) {
+				expectedDS := &appsv1.DeploymentSpec{
+					Template: corev1.PodTemplateSpec{
+						Spec: corev1.PodSpec{
+							TerminationGracePeriodSeconds: pointer.Int64(3600),
+						},
+					},
+				}
+
+				return expectedDS, reflect.DeepEqual(inputDS.Template.Spec.TerminationGracePeriodSeconds, expectedDS.Template.Spec.TerminationGracePeriodSeconds)
+			},
+		},
 		{
 			name: "only image pull secrets modified",
 			inputDeploymentSpec: &operatorv1.DeploymentSpec{
@@ -467,6 +507,7 @@ func TestCustomizeDeployment(t *testing.T) {
 				FeatureGates:    map[string]bool{"TEST": true, "ANOTHER": false},
 				ProfilerAddress: "localhost:1234",
 				Verbosity:       5,
+				LogFormat:       "json",
 				ControllerManagerConfiguration: operatorv1.ControllerManagerConfiguration{
 					CacheNamespace: "testNS",
 					SyncPeriod:     &metav1.Duration{Duration: sevenHours},
@@ -523,6 +564,7 @@ func TestCustomizeDeployment(t *testing.T) {
 										"--sync-period=25200s",
 										"--profiler-address=localhost:1234",
 										"--v=5",
+										"--logging-format=json",
 										"--feature-gates=ANOTHER=false,TEST=true",
 									},
 									LivenessProbe: &corev1.Probe{
@@ -550,14 +592,181 @@ func TestCustomizeDeployment(t *testing.T) {
 				return expectedDS, reflect.DeepEqual(inputDS.Template.Spec.Containers[0], expectedDS.Template.Spec.Containers[0])
 			},
 		},
+		{
+			name: "leader election disabled",
+			inputManagerSpec: &operatorv1.ManagerSpec{
+				Verbosity: 1,
+				ControllerManagerConfiguration: operatorv1.ControllerManagerConfiguration{
+					LeaderElection: &configv1alpha1.LeaderElectionConfiguration{
+						LeaderElect:   pointer.Bool(false),
+						LeaseDuration: metav1.Duration{Duration: 30 * time.Second},
+					},
+				},
+			},
+			expectedDeploymentSpec: func(inputDS *appsv1.DeploymentSpec) (*appsv1.DeploymentSpec, bool) {
+				expectedDS := managerDepl.Spec.DeepCopy()
+				expectedDS.Template.Spec.Containers[0].Args = []string{
+					"--webhook-port=2345",
+					"--leader-elect=false",
+				}
+
+				return expectedDS, reflect.DeepEqual(inputDS.Template.Spec.Containers[0], expectedDS.Template.Spec.Containers[0])
+			},
+		},
+		{
+			name: "leader election lease tuned",
+			inputManagerSpec: &operatorv1.ManagerSpec{
+				Verbosity: 1,
+				ControllerManagerConfiguration: operatorv1.ControllerManagerConfiguration{
+					LeaderElection: &configv1alpha1.LeaderElectionConfiguration{
+						LeaseDuration: metav1.Duration{Duration: 60 * time.Second},
+						RenewDeadline: metav1.Duration{Duration: 40 * time.Second},
+						RetryPeriod:   metav1.Duration{Duration: 5 * time.Second},
+					},
+				},
+			},
+			expectedDeploymentSpec: func(inputDS *appsv1.DeploymentSpec) (*appsv1.DeploymentSpec, bool) {
+				expectedDS := managerDepl.Spec.DeepCopy()
+				expectedDS.Template.Spec.Containers[0].Args = []string{
+					"--webhook-port=2345",
+					"--leader-elect-lease-duration=60s",
+					"--leader-elect-renew-deadline=40s",
+					"--leader-elect-retry-period=5s",
+				}
+
+				return expectedDS, reflect.DeepEqual(inputDS.Template.Spec.Containers[0], expectedDS.Template.Spec.Containers[0])
+			},
+		},
+		{
+			name: "manager image overridden",
+			inputDeploymentSpec: &operatorv1.DeploymentSpec{
+				Containers: []operatorv1.ContainerSpec{
+					{
+						Name:     "manager",
+						ImageURL: pointer.String("quay.io/dev/a-manager:v3.4.2"),
+					},
+				},
+				Image: &operatorv1.ImageReference{
+					Repository: "registry.k8s.io/a-manager",
+					Tag:        "1.6.3",
+					Digest:     testImageDigest,
+				},
+			},
+			expectedDeploymentSpec: func(inputDS *appsv1.DeploymentSpec) (*appsv1.DeploymentSpec, bool) {
+				expectedDS := managerDepl.Spec.DeepCopy()
+				expectedDS.Template.Spec.Containers[0].Image = "registry.k8s.io/a-manager:1.6.3@" + testImageDigest
+
+				return expectedDS, reflect.DeepEqual(inputDS.Template.Spec.Containers[0], expectedDS.Template.Spec.Containers[0])
+			},
+		},
+		{
+			name: "security contexts applied",
+			inputDeploymentSpec: &operatorv1.DeploymentSpec{
+				SecurityContext: &corev1.PodSecurityContext{
+					RunAsNonRoot:   pointer.Bool(true),
+					SeccompProfile: &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeRuntimeDefault},
+				},
+				ContainerSecurityContext: &corev1.SecurityContext{
+					AllowPrivilegeEscalation: pointer.Bool(false),
+					Capabilities:             &corev1.Capabilities{Drop: []corev1.Capability{"ALL"}},
+				},
+			},
+			expectedDeploymentSpec: func(inputDS *appsv1.DeploymentSpec) (*appsv1.DeploymentSpec, bool) {
+				expectedDS := managerDepl.Spec.DeepCopy()
+				expectedDS.Template.Spec.SecurityContext = &corev1.PodSecurityContext{
+					RunAsNonRoot:   pointer.Bool(true),
+					SeccompProfile: &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeRuntimeDefault},
+				}
+				expectedDS.Template.Spec.Containers[0].SecurityContext = &corev1.SecurityContext{
+					AllowPrivilegeEscalation: pointer.Bool(false),
+					Capabilities:             &corev1.Capabilities{Drop: []corev1.Capability{"ALL"}},
+				}
+
+				return expectedDS, reflect.DeepEqual(inputDS.Template.Spec, expectedDS.Template.Spec)
+			},
+		},
+		{
+			name: "additional volumes mounted into containers",
+			inputDeploymentSpec: &operatorv1.DeploymentSpec{
+				AdditionalVolumes: []corev1.Volume{{
+					Name: "credentials",
+					VolumeSource: corev1.VolumeSource{
+						Secret: &corev1.SecretVolumeSource{SecretName: "provider-credentials"},
+					},
+				}},
+				Containers: []operatorv1.ContainerSpec{{
+					Name: "manager",
+					VolumeMounts: []corev1.VolumeMount{{
+						Name:      "credentials",
+						MountPath: "/home/.provider",
+						ReadOnly:  true,
+					}},
+				}},
+			},
+			expectedDeploymentSpec: func(inputDS *appsv1.DeploymentSpec) (*appsv1.DeploymentSpec, bool) {
+				expectedDS := managerDepl.Spec.DeepCopy()
+				expectedDS.Template.Spec.Volumes = []corev1.Volume{{
+					Name: "credentials",
+					VolumeSource: corev1.VolumeSource{
+						Secret: &corev1.SecretVolumeSource{SecretName: "provider-credentials"},
+					},
+				}}
+				expectedDS.Template.Spec.Containers[0].VolumeMounts = []corev1.VolumeMount{{
+					Name:      "credentials",
+					MountPath: "/home/.provider",
+					ReadOnly:  true,
+				}}
+
+				return expectedDS, reflect.DeepEqual(inputDS.Template.Spec, expectedDS.Template.Spec)
+			},
+		},
+		{
+			name: "CA bundle mounted into deployment",
+			inputFetchConfig: &operatorv1.FetchConfiguration{
+				CABundleRef: &operatorv1.CABundleReference{
+					ConfigMap:           &operatorv1.ConfigmapReference{Name: "my-ca"},
+					Key:                 "bundle.pem",
+					MountIntoDeployment: true,
+				},
+			},
+			expectedDeploymentSpec: func(inputDS *appsv1.DeploymentSpec) (*appsv1.DeploymentSpec, bool) {
+				expectedDS := &appsv1.DeploymentSpec{
+					Template: corev1.PodTemplateSpec{
+						Spec: corev1.PodSpec{
+							Volumes: []corev1.Volume{{
+								Name: "operator-ca-bundle",
+								VolumeSource: corev1.VolumeSource{
+									ConfigMap: &corev1.ConfigMapVolumeSource{
+										LocalObjectReference: corev1.LocalObjectReference{Name: "my-ca"},
+										Items:                []corev1.KeyToPath{{Key: "bundle.pem", Path: "ca.crt"}},
+									},
+								},
+							}},
+							Containers: []corev1.Container{{
+								VolumeMounts: []corev1.VolumeMount{{
+									Name:      "operator-ca-bundle",
+									MountPath: "/etc/ssl/certs/operator-ca-bundle.crt",
+									SubPath:   "ca.crt",
+									ReadOnly:  true,
+								}},
+							}},
+						},
+					},
+				}
+
+				return expectedDS, reflect.DeepEqual(inputDS.Template.Spec.Volumes, expectedDS.Template.Spec.Volumes) &&
+					reflect.DeepEqual(inputDS.Template.Spec.Containers[0].VolumeMounts, expectedDS.Template.Spec.Containers[0].VolumeMounts)
+			},
+		},
 	}
 
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
 			deployment := managerDepl.DeepCopy()
 			if err := customizeDeployment(operatorv1.ProviderSpec{
-				Deployment: tc.inputDeploymentSpec,
-				Manager:    tc.inputManagerSpec,
+				Deployment:  tc.inputDeploymentSpec,
+				Manager:     tc.inputManagerSpec,
+				FetchConfig: tc.inputFetchConfig,
 			}, deployment); err != nil {
 				t.Error(err)
 			}
@@ -568,3 +777,797 @@ func TestCustomizeDeployment(t *testing.T) {
 		})
 	}
 }
+
+func TestMergePodSecurityContext(t *testing.T) {
+	tests := []struct {
+		name     string
+		base     *corev1.PodSecurityContext
+		override *corev1.PodSecurityContext
+		expected *corev1.PodSecurityContext
+	}{
+		{
+			name: "no base",
+			override: &corev1.PodSecurityContext{
+				RunAsNonRoot:   pointer.Bool(true),
+				SeccompProfile: &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeRuntimeDefault},
+			},
+			expected: &corev1.PodSecurityContext{
+				RunAsNonRoot:   pointer.Bool(true),
+				SeccompProfile: &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeRuntimeDefault},
+			},
+		},
+		{
+			name: "base fields are kept",
+			base: &corev1.PodSecurityContext{
+				RunAsUser: pointer.Int64(65532),
+				FSGroup:   pointer.Int64(2000),
+			},
+			override: &corev1.PodSecurityContext{
+				SeccompProfile: &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeRuntimeDefault},
+			},
+			expected: &corev1.PodSecurityContext{
+				RunAsUser:      pointer.Int64(65532),
+				FSGroup:        pointer.Int64(2000),
+				SeccompProfile: &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeRuntimeDefault},
+			},
+		},
+		{
+			name: "override wins",
+			base: &corev1.PodSecurityContext{
+				RunAsNonRoot:   pointer.Bool(false),
+				RunAsUser:      pointer.Int64(0),
+				SeccompProfile: &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeUnconfined},
+			},
+			override: &corev1.PodSecurityContext{
+				RunAsNonRoot: pointer.Bool(true),
+				RunAsUser:    pointer.Int64(65532),
+				SeccompProfile: &corev1.SeccompProfile{
+					Type:             corev1.SeccompProfileTypeLocalhost,
+					LocalhostProfile: pointer.String("profiles/manager.json"),
+				},
+			},
+			expected: &corev1.PodSecurityContext{
+				RunAsNonRoot: pointer.Bool(true),
+				RunAsUser:    pointer.Int64(65532),
+				SeccompProfile: &corev1.SeccompProfile{
+					Type:             corev1.SeccompProfileTypeLocalhost,
+					LocalhostProfile: pointer.String("profiles/manager.json"),
+				},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			base := tc.base.DeepCopy()
+
+			merged := mergePodSecurityContext(tc.base, tc.override)
+			if !reflect.DeepEqual(merged, tc.expected) {
+				t.Error(cmp.Diff(tc.expected, merged))
+			}
+
+			if !reflect.DeepEqual(tc.base, base) {
+				t.Error("base security context was modified")
+			}
+		})
+	}
+}
+
+func TestMergeSecurityContext(t *testing.T) {
+	tests := []struct {
+		name     string
+		base     *corev1.SecurityContext
+		override *corev1.SecurityContext
+		expected *corev1.SecurityContext
+	}{
+		{
+			name: "no base",
+			override: &corev1.SecurityContext{
+				AllowPrivilegeEscalation: pointer.Bool(false),
+				SeccompProfile:           &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeRuntimeDefault},
+			},
+			expected: &corev1.SecurityContext{
+				AllowPrivilegeEscalation: pointer.Bool(false),
+				SeccompProfile:           &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeRuntimeDefault},
+			},
+		},
+		{
+			name: "base fields are kept and override wins",
+			base: &corev1.SecurityContext{
+				ReadOnlyRootFilesystem:   pointer.Bool(true),
+				AllowPrivilegeEscalation: pointer.Bool(true),
+				Capabilities:             &corev1.Capabilities{Add: []corev1.Capability{"NET_ADMIN"}},
+			},
+			override: &corev1.SecurityContext{
+				AllowPrivilegeEscalation: pointer.Bool(false),
+				Capabilities:             &corev1.Capabilities{Drop: []corev1.Capability{"ALL"}},
+				SeccompProfile:           &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeRuntimeDefault},
+			},
+			expected: &corev1.SecurityContext{
+				ReadOnlyRootFilesystem:   pointer.Bool(true),
+				AllowPrivilegeEscalation: pointer.Bool(false),
+				Capabilities:             &corev1.Capabilities{Drop: []corev1.Capability{"ALL"}},
+				SeccompProfile:           &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeRuntimeDefault},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			merged := mergeSecurityContext(tc.base, tc.override)
+			if !reflect.DeepEqual(merged, tc.expected) {
+				t.Error(cmp.Diff(tc.expected, merged))
+			}
+		})
+	}
+}
+
+func TestValidateLeaderElection(t *testing.T) {
+	tests := []struct {
+		name          string
+		lec           *configv1alpha1.LeaderElectionConfiguration
+		expectedValid bool
+	}{
+		{
+			name:          "empty",
+			lec:           &configv1alpha1.LeaderElectionConfiguration{},
+			expectedValid: true,
+		},
+		{
+			name: "valid durations",
+			lec: &configv1alpha1.LeaderElectionConfiguration{
+				LeaseDuration: metav1.Duration{Duration: 60 * time.Second},
+				RenewDeadline: metav1.Duration{Duration: 40 * time.Second},
+				RetryPeriod:   metav1.Duration{Duration: 5 * time.Second},
+			},
+			expectedValid: true,
+		},
+		{
+			name: "negative lease duration",
+			lec: &configv1alpha1.LeaderElectionConfiguration{
+				LeaseDuration: metav1.Duration{Duration: -time.Second},
+			},
+			expectedValid: false,
+		},
+		{
+			name: "negative retry period",
+			lec: &configv1alpha1.LeaderElectionConfiguration{
+				RetryPeriod: metav1.Duration{Duration: -time.Second},
+			},
+			expectedValid: false,
+		},
+		{
+			name: "renew deadline not shorter than lease duration",
+			lec: &configv1alpha1.LeaderElectionConfiguration{
+				LeaseDuration: metav1.Duration{Duration: 15 * time.Second},
+				RenewDeadline: metav1.Duration{Duration: 15 * time.Second},
+			},
+			expectedValid: false,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if valid := validateLeaderElection(tc.lec) == ""; valid != tc.expectedValid {
+				t.Errorf("expected valid %t, got %t", tc.expectedValid, valid)
+			}
+		})
+	}
+}
+
+func TestValidateBindAddress(t *testing.T) {
+	tests := []struct {
+		name          string
+		address       string
+		expectedValid bool
+	}{
+		{
+			name:          "empty",
+			expectedValid: true,
+		},
+		{
+			name:          "disabled",
+			address:       "0",
+			expectedValid: true,
+		},
+		{
+			name:          "port only",
+			address:       ":8080",
+			expectedValid: true,
+		},
+		{
+			name:          "host and port",
+			address:       "localhost:8080",
+			expectedValid: true,
+		},
+		{
+			name:          "ipv6 host and port",
+			address:       "[::1]:9440",
+			expectedValid: true,
+		},
+		{
+			name:    "missing port",
+			address: "8080",
+		},
+		{
+			name:    "non numeric port",
+			address: ":metrics",
+		},
+		{
+			name:    "port out of range",
+			address: ":65536",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if valid := validateBindAddress("Metrics bind address", tc.address) == ""; valid != tc.expectedValid {
+				t.Errorf("expected valid %t, got %t", tc.expectedValid, valid)
+			}
+		})
+	}
+}
+
+func TestCustomizeManagerContainerPorts(t *testing.T) {
+	container := corev1.Container{
+		Name: "manager",
+		Ports: []corev1.ContainerPort{
+			{Name: "webhook-server", ContainerPort: 9443},
+			{Name: "healthz", ContainerPort: 9440},
+			{Name: "metrics", ContainerPort: 8080},
+		},
+		LivenessProbe: &corev1.Probe{
+			ProbeHandler: corev1.ProbeHandler{
+				HTTPGet: &corev1.HTTPGetAction{Path: "/healthz", Port: intstr.FromString("healthz")},
+			},
+		},
+		ReadinessProbe: &corev1.Probe{
+			ProbeHandler: corev1.ProbeHandler{
+				HTTPGet: &corev1.HTTPGetAction{Path: "/readyz", Port: intstr.FromInt(9440)},
+			},
+		},
+	}
+
+	tests := []struct {
+		name                   string
+		managerSpec            *operatorv1.ManagerSpec
+		expectedPorts          []int32
+		expectedReadinessProbe intstr.IntOrString
+	}{
+		{
+			name:                   "bind addresses not set",
+			managerSpec:            &operatorv1.ManagerSpec{},
+			expectedPorts:          []int32{9443, 9440, 8080},
+			expectedReadinessProbe: intstr.FromInt(9440),
+		},
+		{
+			name: "bind addresses set",
+			managerSpec: &operatorv1.ManagerSpec{
+				ControllerManagerConfiguration: operatorv1.ControllerManagerConfiguration{
+					Metrics: operatorv1.ControllerMetrics{BindAddress: "localhost:18080"},
+					Health:  operatorv1.ControllerHealth{HealthProbeBindAddress: ":19440"},
+				},
+			},
+			expectedPorts:          []int32{9443, 19440, 18080},
+			expectedReadinessProbe: intstr.FromInt(19440),
+		},
+		{
+			name: "metrics disabled",
+			managerSpec: &operatorv1.ManagerSpec{
+				ControllerManagerConfiguration: operatorv1.ControllerManagerConfiguration{
+					Metrics: operatorv1.ControllerMetrics{BindAddress: "0"},
+				},
+			},
+			expectedPorts:          []int32{9443, 9440, 8080},
+			expectedReadinessProbe: intstr.FromInt(9440),
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			c := container.DeepCopy()
+			customizeManagerContainer(tc.managerSpec, c)
+
+			ports := []int32{}
+			for _, p := range c.Ports {
+				ports = append(ports, p.ContainerPort)
+			}
+
+			if !reflect.DeepEqual(ports, tc.expectedPorts) {
+				t.Error(cmp.Diff(tc.expectedPorts, ports))
+			}
+
+			if c.ReadinessProbe.HTTPGet.Port != tc.expectedReadinessProbe {
+				t.Error(cmp.Diff(tc.expectedReadinessProbe, c.ReadinessProbe.HTTPGet.Port))
+			}
+
+			if c.LivenessProbe.HTTPGet.Port != intstr.FromString("healthz") {
+				t.Errorf("expected the liveness probe to keep the named port, got %s", c.LivenessProbe.HTTPGet.Port.String())
+			}
+		})
+	}
+}
+
+func TestAddVolumesConflicts(t *testing.T) {
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "manager"},
+		Spec: appsv1.DeploymentSpec{
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					Volumes: []corev1.Volume{{Name: "cert"}},
+					Containers: []corev1.Container{{
+						Name:         "manager",
+						VolumeMounts: []corev1.VolumeMount{{Name: "cert", MountPath: "/tmp/k8s-webhook-server/serving-certs"}},
+					}},
+				},
+			},
+		},
+	}
+
+	tests := []struct {
+		name  string
+		dSpec *operatorv1.DeploymentSpec
+	}{
+		{
+			name: "volume name already exists",
+			dSpec: &operatorv1.DeploymentSpec{
+				AdditionalVolumes: []corev1.Volume{{Name: "cert"}},
+			},
+		},
+		{
+			name: "mount path already used",
+			dSpec: &operatorv1.DeploymentSpec{
+				AdditionalVolumes: []corev1.Volume{{Name: "credentials"}},
+				Containers: []operatorv1.ContainerSpec{{
+					Name:         "manager",
+					VolumeMounts: []corev1.VolumeMount{{Name: "credentials", MountPath: "/tmp/k8s-webhook-server/serving-certs"}},
+				}},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var conflictErr *volumeConflictError
+			if err := addVolumes(tc.dSpec, deployment.DeepCopy()); !errors.As(err, &conflictErr) {
+				t.Errorf("expected a volume conflict error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestValidateVolumes(t *testing.T) {
+	tests := []struct {
+		name          string
+		dSpec         *operatorv1.DeploymentSpec
+		expectedValid bool
+	}{
+		{
+			name:          "empty",
+			dSpec:         &operatorv1.DeploymentSpec{},
+			expectedValid: true,
+		},
+		{
+			name: "distinct volumes and mount paths",
+			dSpec: &operatorv1.DeploymentSpec{
+				AdditionalVolumes: []corev1.Volume{{Name: "credentials"}, {Name: "token"}},
+				Containers: []operatorv1.ContainerSpec{{
+					Name: "manager",
+					VolumeMounts: []corev1.VolumeMount{
+						{Name: "credentials", MountPath: "/home/.provider"},
+						{Name: "token", MountPath: "/var/run/secrets/provider"},
+					},
+				}},
+			},
+			expectedValid: true,
+		},
+		{
+			name: "duplicate volume name",
+			dSpec: &operatorv1.DeploymentSpec{
+				AdditionalVolumes: []corev1.Volume{{Name: "credentials"}, {Name: "credentials"}},
+			},
+			expectedValid: false,
+		},
+		{
+			name: "duplicate mount path",
+			dSpec: &operatorv1.DeploymentSpec{
+				Containers: []operatorv1.ContainerSpec{{
+					Name: "manager",
+					VolumeMounts: []corev1.VolumeMount{
+						{Name: "credentials", MountPath: "/home/.provider"},
+						{Name: "token", MountPath: "/home/.provider"},
+					},
+				}},
+			},
+			expectedValid: false,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if valid := validateVolumes(tc.dSpec) == ""; valid != tc.expectedValid {
+				t.Errorf("expected valid %t, got %t", tc.expectedValid, valid)
+			}
+		})
+	}
+}
+
+func TestAddInitContainers(t *testing.T) {
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "manager"},
+		Spec: appsv1.DeploymentSpec{
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					InitContainers: []corev1.Container{{Name: "wait-for-crds", Image: "busybox"}},
+					Containers:     []corev1.Container{{Name: "manager", Image: "registry.k8s.io/a-manager:1.6.2"}},
+				},
+			},
+		},
+	}
+
+	fetchCredentials := corev1.Container{
+		Name:    "fetch-credentials",
+		Image:   "example.com/credentials-fetcher:v1",
+		Command: []string{"/fetch", "--output=/home/.provider/credentials"},
+	}
+
+	d := deployment.DeepCopy()
+	if err := addInitContainers(&operatorv1.DeploymentSpec{InitContainers: []corev1.Container{fetchCredentials}}, d); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []corev1.Container{deployment.Spec.Template.Spec.InitContainers[0], fetchCredentials}
+	if !reflect.DeepEqual(d.Spec.Template.Spec.InitContainers, expected) {
+		t.Errorf("expected init containers %v, got %v", expected, d.Spec.Template.Spec.InitContainers)
+	}
+
+	for _, name := range []string{"wait-for-crds", "manager"} {
+		var conflictErr *initContainerConflictError
+
+		dSpec := &operatorv1.DeploymentSpec{InitContainers: []corev1.Container{{Name: name, Image: "busybox"}}}
+		if err := addInitContainers(dSpec, deployment.DeepCopy()); !errors.As(err, &conflictErr) {
+			t.Errorf("expected an init container conflict error for %q, got %v", name, err)
+		}
+	}
+}
+
+func TestValidateInitContainers(t *testing.T) {
+	tests := []struct {
+		name          string
+		dSpec         *operatorv1.DeploymentSpec
+		expectedValid bool
+	}{
+		{
+			name:          "empty",
+			dSpec:         &operatorv1.DeploymentSpec{},
+			expectedValid: true,
+		},
+		{
+			name: "distinct init containers",
+			dSpec: &operatorv1.DeploymentSpec{
+				InitContainers: []corev1.Container{{Name: "fetch-credentials", Image: "busybox"}, {Name: "migrate", Image: "busybox"}},
+			},
+			expectedValid: true,
+		},
+		{
+			name: "duplicate init container name",
+			dSpec: &operatorv1.DeploymentSpec{
+				InitContainers: []corev1.Container{{Name: "migrate", Image: "busybox"}, {Name: "migrate", Image: "busybox"}},
+			},
+			expectedValid: false,
+		},
+		{
+			name: "missing image",
+			dSpec: &operatorv1.DeploymentSpec{
+				InitContainers: []corev1.Container{{Name: "migrate"}},
+			},
+			expectedValid: false,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if valid := validateInitContainers(tc.dSpec) == ""; valid != tc.expectedValid {
+				t.Errorf("expected valid %t, got %t", tc.expectedValid, valid)
+			}
+		})
+	}
+}
+
+func TestAddPorts(t *testing.T) {
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "manager"},
+		Spec: appsv1.DeploymentSpec{
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{
+						{Name: "manager", Ports: []corev1.ContainerPort{{Name: "webhook-server", ContainerPort: 9443}}},
+						{Name: "kube-rbac-proxy", Ports: []corev1.ContainerPort{{Name: "https", ContainerPort: 8443}}},
+					},
+				},
+			},
+		},
+	}
+
+	pprof := corev1.ContainerPort{Name: "pprof", ContainerPort: 6060}
+
+	d := deployment.DeepCopy()
+	if err := addPorts(&operatorv1.DeploymentSpec{AdditionalPorts: []corev1.ContainerPort{pprof}}, d); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []corev1.ContainerPort{deployment.Spec.Template.Spec.Containers[0].Ports[0], pprof}
+	if !reflect.DeepEqual(d.Spec.Template.Spec.Containers[0].Ports, expected) {
+		t.Errorf("expected ports %v, got %v", expected, d.Spec.Template.Spec.Containers[0].Ports)
+	}
+
+	// Only the names of the manager container ports are reserved, but the numbers of all the containers are.
+	d = deployment.DeepCopy()
+	if err := addPorts(&operatorv1.DeploymentSpec{AdditionalPorts: []corev1.ContainerPort{{Name: "https", ContainerPort: 6443}}}, d); err != nil {
+		t.Errorf("unexpected error for a port named as a port of another container: %v", err)
+	}
+
+	// The same number with another protocol doesn't collide.
+	d = deployment.DeepCopy()
+	if err := addPorts(&operatorv1.DeploymentSpec{AdditionalPorts: []corev1.ContainerPort{{ContainerPort: 9443, Protocol: corev1.ProtocolUDP}}}, d); err != nil {
+		t.Errorf("unexpected error for a port with another protocol: %v", err)
+	}
+
+	collisions := map[string]corev1.ContainerPort{
+		"name of a manager port":      {Name: "webhook-server", ContainerPort: 6060},
+		"number of a manager port":    {Name: "pprof", ContainerPort: 9443},
+		"number of another container": {Name: "pprof", ContainerPort: 8443, Protocol: corev1.ProtocolTCP},
+	}
+
+	for name, port := range collisions {
+		var conflictErr *portConflictError
+
+		dSpec := &operatorv1.DeploymentSpec{AdditionalPorts: []corev1.ContainerPort{port}}
+		if err := addPorts(dSpec, deployment.DeepCopy()); !errors.As(err, &conflictErr) {
+			t.Errorf("expected a port conflict error for the %s, got %v", name, err)
+		}
+	}
+}
+
+func TestValidateAdditionalPorts(t *testing.T) {
+	tests := []struct {
+		name          string
+		dSpec         *operatorv1.DeploymentSpec
+		expectedValid bool
+	}{
+		{
+			name:          "empty",
+			dSpec:         &operatorv1.DeploymentSpec{},
+			expectedValid: true,
+		},
+		{
+			name: "distinct ports",
+			dSpec: &operatorv1.DeploymentSpec{
+				AdditionalPorts: []corev1.ContainerPort{{Name: "pprof", ContainerPort: 6060}, {ContainerPort: 6060, Protocol: corev1.ProtocolUDP}},
+			},
+			expectedValid: true,
+		},
+		{
+			name: "duplicate port name",
+			dSpec: &operatorv1.DeploymentSpec{
+				AdditionalPorts: []corev1.ContainerPort{{Name: "pprof", ContainerPort: 6060}, {Name: "pprof", ContainerPort: 6061}},
+			},
+			expectedValid: false,
+		},
+		{
+			name: "duplicate port number",
+			dSpec: &operatorv1.DeploymentSpec{
+				AdditionalPorts: []corev1.ContainerPort{{Name: "pprof", ContainerPort: 6060}, {Name: "debug", ContainerPort: 6060, Protocol: corev1.ProtocolTCP}},
+			},
+			expectedValid: false,
+		},
+		{
+			name: "invalid port number",
+			dSpec: &operatorv1.DeploymentSpec{
+				AdditionalPorts: []corev1.ContainerPort{{Name: "pprof"}},
+			},
+			expectedValid: false,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if valid := validateAdditionalPorts(tc.dSpec) == ""; valid != tc.expectedValid {
+				t.Errorf("expected valid %t, got %t", tc.expectedValid, valid)
+			}
+		})
+	}
+}
+
+func TestCustomizeObjectsImagePullSecrets(t *testing.T) {
+	toUnstructured := func(obj runtime.Object) unstructured.Unstructured {
+		u, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return unstructured.Unstructured{Object: u}
+	}
+
+	provider := &genericprovider.InfrastructureProviderWrapper{
+		InfrastructureProvider: &operatorv1.InfrastructureProvider{
+			ObjectMeta: metav1.ObjectMeta{Name: "aws", Namespace: "capa-system"},
+			Spec: operatorv1.InfrastructureProviderSpec{
+				ProviderSpec: operatorv1.ProviderSpec{
+					Deployment: &operatorv1.DeploymentSpec{
+						ImagePullSecrets:          []corev1.LocalObjectReference{{Name: "registry-credentials"}},
+						ServiceAccountAnnotations: map[string]string{"eks.amazonaws.com/role-arn": "arn:aws:iam::123456789012:role/capa"},
+					},
+				},
+			},
+		},
+	}
+
+	objs := []unstructured.Unstructured{
+		toUnstructured(&appsv1.Deployment{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "apps/v1", Kind: "Deployment"},
+			ObjectMeta: metav1.ObjectMeta{Name: "capa-controller-manager", Namespace: "capa-system"},
+			Spec: appsv1.DeploymentSpec{
+				Template: corev1.PodTemplateSpec{
+					Spec: corev1.PodSpec{
+						ServiceAccountName: "capa-controller-manager",
+						ImagePullSecrets:   []corev1.LocalObjectReference{{Name: "existing"}},
+						Containers:         []corev1.Container{{Name: "manager"}},
+					},
+				},
+			},
+		}),
+		toUnstructured(&corev1.ServiceAccount{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "ServiceAccount"},
+			ObjectMeta: metav1.ObjectMeta{Name: "capa-controller-manager", Namespace: "capa-system"},
+		}),
+		toUnstructured(&corev1.ServiceAccount{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "ServiceAccount"},
+			ObjectMeta: metav1.ObjectMeta{Name: "unused", Namespace: "capa-system"},
+		}),
+	}
+
+	results, err := customizeObjectsFn(provider)(objs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := &appsv1.Deployment{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(results[0].Object, d); err != nil {
+		t.Fatal(err)
+	}
+
+	expectedDeploymentSecrets := []corev1.LocalObjectReference{{Name: "existing"}, {Name: "registry-credentials"}}
+	if !reflect.DeepEqual(d.Spec.Template.Spec.ImagePullSecrets, expectedDeploymentSecrets) {
+		t.Error(cmp.Diff(expectedDeploymentSecrets, d.Spec.Template.Spec.ImagePullSecrets))
+	}
+
+	sa := &corev1.ServiceAccount{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(results[1].Object, sa); err != nil {
+		t.Fatal(err)
+	}
+
+	expectedServiceAccountSecrets := []corev1.LocalObjectReference{{Name: "registry-credentials"}}
+	if !reflect.DeepEqual(sa.ImagePullSecrets, expectedServiceAccountSecrets) {
+		t.Error(cmp.Diff(expectedServiceAccountSecrets, sa.ImagePullSecrets))
+	}
+
+	expectedServiceAccountAnnotations := map[string]string{"eks.amazonaws.com/role-arn": "arn:aws:iam::123456789012:role/capa"}
+	if !reflect.DeepEqual(sa.Annotations, expectedServiceAccountAnnotations) {
+		t.Error(cmp.Diff(expectedServiceAccountAnnotations, sa.Annotations))
+	}
+
+	unused := &corev1.ServiceAccount{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(results[2].Object, unused); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(unused.ImagePullSecrets) != 0 {
+		t.Errorf("expected no image pull secrets on an unused ServiceAccount, got %v", unused.ImagePullSecrets)
+	}
+
+	if len(unused.Annotations) != 0 {
+		t.Errorf("expected no annotations on an unused ServiceAccount, got %v", unused.Annotations)
+	}
+}
+
+func TestCustomizeObjectsServiceAccount(t *testing.T) {
+	toUnstructured := func(obj runtime.Object) unstructured.Unstructured {
+		u, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return unstructured.Unstructured{Object: u}
+	}
+
+	provider := &genericprovider.InfrastructureProviderWrapper{
+		InfrastructureProvider: &operatorv1.InfrastructureProvider{
+			ObjectMeta: metav1.ObjectMeta{Name: "aws", Namespace: "capa-system"},
+			Spec: operatorv1.InfrastructureProviderSpec{
+				ProviderSpec: operatorv1.ProviderSpec{
+					Deployment: &operatorv1.DeploymentSpec{ServiceAccountName: "capa-irsa"},
+				},
+			},
+		},
+	}
+
+	otherSubject := rbacv1.Subject{Kind: "ServiceAccount", Name: "other", Namespace: "capa-system"}
+
+	objs := []unstructured.Unstructured{
+		toUnstructured(&appsv1.Deployment{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "apps/v1", Kind: "Deployment"},
+			ObjectMeta: metav1.ObjectMeta{Name: "capa-controller-manager", Namespace: "capa-system"},
+			Spec: appsv1.DeploymentSpec{
+				Template: corev1.PodTemplateSpec{
+					Spec: corev1.PodSpec{
+						ServiceAccountName: "capa-controller-manager",
+						Containers:         []corev1.Container{{Name: "manager"}},
+					},
+				},
+			},
+		}),
+		toUnstructured(&corev1.ServiceAccount{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "ServiceAccount"},
+			ObjectMeta: metav1.ObjectMeta{Name: "capa-controller-manager", Namespace: "capa-system"},
+		}),
+		toUnstructured(&corev1.ServiceAccount{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "ServiceAccount"},
+			ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "capa-system"},
+		}),
+		toUnstructured(&rbacv1.ClusterRoleBinding{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "rbac.authorization.k8s.io/v1", Kind: "ClusterRoleBinding"},
+			ObjectMeta: metav1.ObjectMeta{Name: "capa-manager-rolebinding"},
+			RoleRef:    rbacv1.RoleRef{APIGroup: "rbac.authorization.k8s.io", Kind: "ClusterRole", Name: "capa-manager-role"},
+			Subjects: []rbacv1.Subject{
+				{Kind: "ServiceAccount", Name: "capa-controller-manager", Namespace: "capa-system"},
+				otherSubject,
+			},
+		}),
+		toUnstructured(&rbacv1.RoleBinding{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "rbac.authorization.k8s.io/v1", Kind: "RoleBinding"},
+			ObjectMeta: metav1.ObjectMeta{Name: "capa-leader-election-rolebinding", Namespace: "capa-system"},
+			RoleRef:    rbacv1.RoleRef{APIGroup: "rbac.authorization.k8s.io", Kind: "Role", Name: "capa-leader-election-role"},
+			Subjects:   []rbacv1.Subject{{Kind: "ServiceAccount", Name: "capa-controller-manager"}},
+		}),
+	}
+
+	results, err := customizeObjectsFn(provider)(objs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The replaced ServiceAccount is dropped, the other ones are kept.
+	if len(results) != 4 || results[1].GetName() != "other" {
+		t.Fatalf("expected the capa-controller-manager ServiceAccount to be dropped, got %d objects", len(results))
+	}
+
+	d := &appsv1.Deployment{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(results[0].Object, d); err != nil {
+		t.Fatal(err)
+	}
+
+	if d.Spec.Template.Spec.ServiceAccountName != "capa-irsa" {
+		t.Errorf("expected the capa-irsa service account, got %s", d.Spec.Template.Spec.ServiceAccountName)
+	}
+
+	crb := &rbacv1.ClusterRoleBinding{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(results[2].Object, crb); err != nil {
+		t.Fatal(err)
+	}
+
+	expectedClusterRoleBindingSubjects := []rbacv1.Subject{{Kind: "ServiceAccount", Name: "capa-irsa", Namespace: "capa-system"}, otherSubject}
+	if !reflect.DeepEqual(crb.Subjects, expectedClusterRoleBindingSubjects) {
+		t.Error(cmp.Diff(expectedClusterRoleBindingSubjects, crb.Subjects))
+	}
+
+	rb := &rbacv1.RoleBinding{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(results[3].Object, rb); err != nil {
+		t.Fatal(err)
+	}
+
+	expectedRoleBindingSubjects := []rbacv1.Subject{{Kind: "ServiceAccount", Name: "capa-irsa"}}
+	if !reflect.DeepEqual(rb.Subjects, expectedRoleBindingSubjects) {
+		t.Error(cmp.Diff(expectedRoleBindingSubjects, rb.Subjects))
+	}
+}
@@ -0,0 +1,76 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"slices"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+
+	operatorv1 "sigs.k8s.io/cluster-api-operator/api/v1alpha2"
+)
+
+// validateComponentSelector checks the component selector, returning a message describing the first
+// problem found, if any.
+func validateComponentSelector(selector *operatorv1.ComponentSelector) string {
+	for _, kind := range selector.Kinds {
+		if kind == "" {
+			return "Component selector kinds can't be empty"
+		}
+	}
+
+	if selector.LabelSelector != nil {
+		if _, err := metav1.LabelSelectorAsSelector(selector.LabelSelector); err != nil {
+			return fmt.Sprintf("Invalid label selector in the component selector: %v", err)
+		}
+	}
+
+	return ""
+}
+
+// selectComponents returns the objects matching the component selector. The selector must be valid.
+func selectComponents(objs []unstructured.Unstructured, selector *operatorv1.ComponentSelector) []unstructured.Unstructured {
+	labelSelector := labels.Everything()
+
+	if selector.LabelSelector != nil {
+		var err error
+
+		labelSelector, err = metav1.LabelSelectorAsSelector(selector.LabelSelector)
+		if err != nil {
+			return nil
+		}
+	}
+
+	selected := make([]unstructured.Unstructured, 0, len(objs))
+
+	for _, obj := range objs {
+		if len(selector.Kinds) > 0 && !slices.Contains(selector.Kinds, obj.GetKind()) {
+			continue
+		}
+
+		if !labelSelector.Matches(labels.Set(obj.GetLabels())) {
+			continue
+		}
+
+		selected = append(selected, obj)
+	}
+
+	return selected
+}
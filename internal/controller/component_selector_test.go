@@ -0,0 +1,113 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	operatorv1 "sigs.k8s.io/cluster-api-operator/api/v1alpha2"
+	"sigs.k8s.io/cluster-api-operator/internal/controller/genericprovider"
+)
+
+func TestComponentSelector(t *testing.T) {
+	crd := newUnstructured(apiextensionsv1.SchemeGroupVersion.WithKind("CustomResourceDefinition"), "", "awsclusters.infrastructure.cluster.x-k8s.io")
+	deployment := newUnstructured(appsv1.SchemeGroupVersion.WithKind("Deployment"), "capa-system", "capa-controller-manager")
+	deployment.SetLabels(map[string]string{"control-plane": "controller-manager"})
+	serviceAccount := newUnstructured(corev1.SchemeGroupVersion.WithKind("ServiceAccount"), "capa-system", "capa-manager")
+
+	objs := []unstructured.Unstructured{crd, deployment, serviceAccount}
+
+	testCases := []struct {
+		name         string
+		selector     *operatorv1.ComponentSelector
+		skipCRDs     bool
+		expectedObjs []string
+	}{
+		{
+			name:         "all components without a selector",
+			expectedObjs: []string{"awsclusters.infrastructure.cluster.x-k8s.io", "capa-controller-manager", "capa-manager"},
+		},
+		{
+			name:         "components of the selected kinds",
+			selector:     &operatorv1.ComponentSelector{Kinds: []string{"CustomResourceDefinition"}},
+			expectedObjs: []string{"awsclusters.infrastructure.cluster.x-k8s.io"},
+		},
+		{
+			name: "components with the selected labels",
+			selector: &operatorv1.ComponentSelector{
+				LabelSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"control-plane": "controller-manager"}},
+			},
+			expectedObjs: []string{"capa-controller-manager"},
+		},
+		{
+			name: "components matching both the kinds and the labels",
+			selector: &operatorv1.ComponentSelector{
+				Kinds:         []string{"Deployment", "ServiceAccount"},
+				LabelSelector: &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{{Key: "control-plane", Operator: metav1.LabelSelectorOpDoesNotExist}}},
+			},
+			expectedObjs: []string{"capa-manager"},
+		},
+		{
+			name:         "skipped CRDs are not installed even if selected",
+			selector:     &operatorv1.ComponentSelector{Kinds: []string{"CustomResourceDefinition", "Deployment"}},
+			skipCRDs:     true,
+			expectedObjs: []string{"capa-controller-manager"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			p := &phaseReconciler{
+				components: &fakeComponents{objs: objs},
+				provider: &genericprovider.InfrastructureProviderWrapper{
+					InfrastructureProvider: &operatorv1.InfrastructureProvider{
+						ObjectMeta: metav1.ObjectMeta{Name: "aws", Namespace: "capa-system"},
+						Spec: operatorv1.InfrastructureProviderSpec{
+							ProviderSpec: operatorv1.ProviderSpec{ComponentSelector: tc.selector, SkipCRDs: tc.skipCRDs},
+						},
+					},
+				},
+			}
+
+			names := []string{}
+			for _, obj := range p.componentsToInstall() {
+				names = append(names, obj.GetName())
+			}
+
+			g.Expect(names).To(Equal(tc.expectedObjs))
+		})
+	}
+}
+
+func TestValidateComponentSelector(t *testing.T) {
+	g := NewWithT(t)
+
+	g.Expect(validateComponentSelector(&operatorv1.ComponentSelector{Kinds: []string{"Deployment"}})).To(BeEmpty())
+	g.Expect(validateComponentSelector(&operatorv1.ComponentSelector{Kinds: []string{""}})).To(Equal("Component selector kinds can't be empty"))
+	g.Expect(validateComponentSelector(&operatorv1.ComponentSelector{
+		LabelSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"invalid key!": "value"}},
+	})).To(HavePrefix("Invalid label selector in the component selector: "))
+}
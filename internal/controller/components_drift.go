@@ -0,0 +1,462 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	clusterctlv1 "sigs.k8s.io/cluster-api/cmd/clusterctl/api/v1alpha3"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	operatorv1 "sigs.k8s.io/cluster-api-operator/api/v1alpha2"
+	"sigs.k8s.io/cluster-api-operator/internal/controller/genericprovider"
+)
+
+// maxDriftedComponentsInMessage is the number of drifted components listed in the condition message,
+// so it stays readable for providers with many components.
+const maxDriftedComponentsInMessage = 5
+
+// componentDrift describes an installed component differing from the one rendered from the provider manifests.
+type componentDrift struct {
+	// Object is the kind, namespace and name of the component.
+	Object string
+	// Path is the first field differing, or empty if the component doesn't exist.
+	Path string
+}
+
+func (d componentDrift) String() string {
+	if d.Path == "" {
+		return d.Object + " (missing)"
+	}
+
+	return fmt.Sprintf("%s (%s)", d.Object, d.Path)
+}
+
+// reconcileDrift compares the installed components of the provider with the ones last applied, as stored at
+// install time, reporting the differences in the ComponentsDrifted condition, and applies the drifted ones
+// again if spec.enforceNoDrift is set, or only the deleted Deployments otherwise. The components aren't rendered
+// again, so neither the manifests nor the manifest transform webhook are involved. Failing to read the applied
+// components, or not having them, e.g. for providers installed by a previous version of the operator, only skips
+// the comparison, so it doesn't prevent the health checks.
+func (r *GenericProviderReconciler) reconcileDrift(ctx context.Context, provider genericprovider.GenericProvider) (ctrl.Result, error) {
+	log := ctrl.LoggerFrom(ctx)
+
+	if provider.GetStatus().InstalledVersion == nil {
+		return ctrl.Result{}, nil
+	}
+
+	reconciler := newPhaseReconciler(*r, provider, nil)
+
+	objs, err := reconciler.appliedComponents(ctx)
+	if err != nil {
+		log.Error(err, "Failed to read the applied components, skipping the drift detection")
+
+		return ctrl.Result{}, nil
+	}
+
+	if objs == nil {
+		log.V(5).Info("Applied components are not stored, skipping the drift detection until the next install")
+
+		return ctrl.Result{}, nil
+	}
+
+	return reconciler.detectDrift(ctx, objs)
+}
+
+// deploymentToProvider maps a provider Deployment, e.g. deleted or edited, to the provider it belongs to, so the
+// drift is detected right away instead of on the next resync. A deleted Deployment is created again from the
+// stored applied components, without rendering the provider manifests again.
+func (r *GenericProviderReconciler) deploymentToProvider(ctx context.Context, deployment client.Object) []reconcile.Request {
+	providers, err := r.newGenericProviderList()
+	if err != nil {
+		return nil
+	}
+
+	if err := r.Client.List(ctx, providers.GetObject(), client.InNamespace(deployment.GetNamespace())); err != nil {
+		ctrl.LoggerFrom(ctx).Error(err, "Failed to list the providers of deployment", "deployment", client.ObjectKeyFromObject(deployment))
+
+		return nil
+	}
+
+	for _, provider := range providers.GetItems() {
+		if clusterctlProviderName(provider).Name == deployment.GetLabels()[clusterv1.ProviderNameLabel] {
+			return []reconcile.Request{{NamespacedName: client.ObjectKeyFromObject(provider)}}
+		}
+	}
+
+	return nil
+}
+
+// providerDeploymentPredicate filters the Deployments installed by the operator, labeled with the clusterctl and
+// provider labels.
+func providerDeploymentPredicate() predicate.Predicate {
+	return predicate.NewPredicateFuncs(func(obj client.Object) bool {
+		_, managed := obj.GetLabels()[clusterctlv1.ClusterctlLabel]
+
+		return managed && obj.GetLabels()[clusterv1.ProviderNameLabel] != ""
+	})
+}
+
+// detectDrift compares the applied components with the live ones.
+func (p *phaseReconciler) detectDrift(ctx context.Context, objs []unstructured.Unstructured) (reconcile.Result, error) {
+	log := ctrl.LoggerFrom(ctx)
+
+	// The drift is only reported in audit mode, and recorded as pending changes if it would be corrected.
+	enforceNoDrift := p.provider.GetSpec().EnforceNoDrift && p.audit == nil
+
+	// The images pinned to digests are reported as such, unless the drift is corrected anyway.
+	if !enforceNoDrift {
+		mismatches, err := pinnedImageMismatches(ctx, p.ctrlClient, objs)
+		if err != nil {
+			return reconcile.Result{}, err
+		}
+
+		if len(mismatches) > 0 {
+			log.Info("Installed images differ from the pinned digests", "deployments", mismatches)
+			conditions.Set(p.provider, &clusterv1.Condition{
+				Type:    operatorv1.ComponentsDriftedCondition,
+				Status:  corev1.ConditionTrue,
+				Reason:  operatorv1.ImageDigestMismatchReason,
+				Message: "Images differ from the pinned digests: " + strings.Join(mismatches, ", "),
+			})
+
+			return reconcile.Result{}, nil
+		}
+	}
+
+	drifts, err := componentsDrift(ctx, p.ctrlClient, objs)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+
+	if len(drifts) == 0 {
+		conditions.Delete(p.provider, operatorv1.ComponentsDriftedCondition)
+
+		return reconcile.Result{}, nil
+	}
+
+	log.Info("Installed components differ from the provider manifests", "components", drifts)
+
+	drifted := map[string]componentDrift{}
+	for _, drift := range drifts {
+		drifted[drift.Object] = drift
+	}
+
+	// The drifted components are applied again if spec.enforceNoDrift is set. The deleted Deployments are created
+	// again regardless, as the provider doesn't run without them.
+	toApply := []unstructured.Unstructured{}
+	restored := []componentDrift{}
+
+	for _, obj := range objs {
+		drift, ok := drifted[describeObject(obj)]
+		if !ok || !p.provider.GetSpec().EnforceNoDrift && (drift.Path != "" || obj.GetKind() != deploymentKind) {
+			continue
+		}
+
+		toApply = append(toApply, obj)
+		restored = append(restored, drift)
+	}
+
+	// In audit mode, the components that would be applied again are recorded as pending changes instead.
+	if p.audit != nil {
+		for _, drift := range restored {
+			p.audit.record("apply " + drift.String())
+		}
+
+		toApply, restored = nil, nil
+	}
+
+	if len(toApply) > 0 {
+		if err := p.applyComponents(ctx, toApply); err != nil {
+			return reconcile.Result{}, fmt.Errorf("failed to apply the drifted components of provider %q: %w", p.provider.GetName(), err)
+		}
+
+		log.Info("Applied drifted components again", "components", restored)
+	}
+
+	if len(restored) < len(drifts) {
+		remaining := []componentDrift{}
+
+		for _, drift := range drifts {
+			if !slices.Contains(restored, drift) {
+				remaining = append(remaining, drift)
+			}
+		}
+
+		conditions.Set(p.provider, &clusterv1.Condition{
+			Type:    operatorv1.ComponentsDriftedCondition,
+			Status:  corev1.ConditionTrue,
+			Reason:  operatorv1.DriftDetectedReason,
+			Message: "Components differ from the provider manifests: " + driftMessage(remaining),
+		})
+
+		return reconcile.Result{}, nil
+	}
+
+	// The other components already match, so all the components are now the applied ones.
+	hash, err := componentsHash(objs)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+
+	status := p.provider.GetStatus()
+	status.AppliedComponentsHash = &hash
+	p.provider.SetStatus(status)
+
+	conditions.Set(p.provider, &clusterv1.Condition{
+		Type:    operatorv1.ComponentsDriftedCondition,
+		Status:  corev1.ConditionTrue,
+		Reason:  operatorv1.DriftCorrectedReason,
+		Message: "Components applied again after differing from the provider manifests: " + driftMessage(drifts),
+	})
+
+	return reconcile.Result{}, nil
+}
+
+// driftMessage lists the first drifted components, followed by the number of the other ones.
+func driftMessage(drifts []componentDrift) string {
+	listed := make([]string, 0, maxDriftedComponentsInMessage)
+
+	for i, drift := range drifts {
+		if i == maxDriftedComponentsInMessage {
+			break
+		}
+
+		listed = append(listed, drift.String())
+	}
+
+	msg := strings.Join(listed, ", ")
+	if len(drifts) > maxDriftedComponentsInMessage {
+		msg += fmt.Sprintf(" and %d more", len(drifts)-maxDriftedComponentsInMessage)
+	}
+
+	return msg
+}
+
+// describeObject returns the kind, namespace and name of the object, e.g. "Deployment capi-system/capi-controller-manager".
+func describeObject(obj unstructured.Unstructured) string {
+	return fmt.Sprintf("%s %s", obj.GetKind(), client.ObjectKeyFromObject(&obj))
+}
+
+// componentsDrift returns the desired components that don't exist in the cluster or differ from the live ones,
+// sorted by object.
+func componentsDrift(ctx context.Context, c client.Client, desired []unstructured.Unstructured) ([]componentDrift, error) {
+	drifts := []componentDrift{}
+
+	for i := range desired {
+		obj := &desired[i]
+
+		live := &unstructured.Unstructured{}
+		live.SetGroupVersionKind(obj.GroupVersionKind())
+
+		if err := c.Get(ctx, client.ObjectKeyFromObject(obj), live); err != nil {
+			// The custom resources are missing too if their CRD isn't installed yet.
+			if apierrors.IsNotFound(err) || meta.IsNoMatchError(err) {
+				drifts = append(drifts, componentDrift{Object: describeObject(*obj)})
+
+				continue
+			}
+
+			return nil, fmt.Errorf("failed to get %s: %w", describeObject(*obj), err)
+		}
+
+		if path := componentDiff(*obj, *live); path != "" {
+			drifts = append(drifts, componentDrift{Object: describeObject(*obj), Path: path})
+		}
+	}
+
+	sort.Slice(drifts, func(i, j int) bool { return drifts[i].Object < drifts[j].Object })
+
+	return drifts, nil
+}
+
+// componentDiff returns the path of the first field set in the desired object with a different value in the live
+// one, or an empty string if there's none. The fields only set in the live object, e.g. defaulted by the API server,
+// are ignored, as well as the status, the metadata other than labels and annotations, the CA bundles injected
+// by cert-manager and the lists left empty in the desired object. Resource quantities are compared by value.
+func componentDiff(desired, live unstructured.Unstructured) string {
+	filter := func(obj unstructured.Unstructured) map[string]interface{} {
+		fields := map[string]interface{}{}
+
+		for k, v := range obj.Object {
+			if k != "metadata" && k != "status" {
+				fields[k] = v
+			}
+		}
+
+		metadata := map[string]interface{}{}
+		if labels := obj.GetLabels(); len(labels) > 0 {
+			metadata["labels"] = toInterfaceMap(labels)
+		}
+
+		if annotations := obj.GetAnnotations(); len(annotations) > 0 {
+			metadata["annotations"] = toInterfaceMap(annotations)
+		}
+
+		fields["metadata"] = metadata
+
+		return fields
+	}
+
+	return fieldDiff(filter(desired), filter(live), "")
+}
+
+// fieldDiff returns the path of the first field of desired with a different value in live.
+func fieldDiff(desired, live interface{}, path string) string {
+	switch d := desired.(type) {
+	case nil:
+		return ""
+	case map[string]interface{}:
+		l, _ := live.(map[string]interface{})
+		if l == nil && len(d) > 0 {
+			return path
+		}
+
+		keys := make([]string, 0, len(d))
+		for k := range d {
+			keys = append(keys, k)
+		}
+
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			if k == "caBundle" {
+				continue
+			}
+
+			fieldPath := k
+			if path != "" {
+				fieldPath = path + "." + k
+			}
+
+			if diff := fieldDiff(d[k], l[k], fieldPath); diff != "" {
+				return diff
+			}
+		}
+
+		return ""
+	case []interface{}:
+		// An empty list is left to be filled in, e.g. the rules of an aggregated ClusterRole by the aggregation
+		// controller, as a field that isn't set.
+		if len(d) == 0 {
+			return ""
+		}
+
+		l, _ := live.([]interface{})
+		if len(l) != len(d) {
+			return path
+		}
+
+		for i := range d {
+			if diff := fieldDiff(d[i], l[i], fmt.Sprintf("%s[%d]", path, i)); diff != "" {
+				return diff
+			}
+		}
+
+		return ""
+	default:
+		if dv, ok := toFloat(desired); ok {
+			if lv, ok := toFloat(live); ok {
+				if dv == lv {
+					return ""
+				}
+
+				return path
+			}
+		}
+
+		if !reflect.DeepEqual(desired, live) && !quantitiesEqual(desired, live) {
+			return path
+		}
+
+		return ""
+	}
+}
+
+// quantitiesEqual returns true if both values are resource quantities with the same value, e.g. the number 1
+// from YAML and the "1" the API server serializes it to, or 0.5 and "500m".
+func quantitiesEqual(desired, live interface{}) bool {
+	toQuantity := func(v interface{}) (resource.Quantity, bool) {
+		var s string
+
+		switch n := v.(type) {
+		case string:
+			s = n
+		default:
+			f, ok := toFloat(v)
+			if !ok {
+				return resource.Quantity{}, false
+			}
+
+			s = strconv.FormatFloat(f, 'f', -1, 64)
+		}
+
+		q, err := resource.ParseQuantity(s)
+
+		return q, err == nil
+	}
+
+	dq, ok := toQuantity(desired)
+	if !ok {
+		return false
+	}
+
+	lq, ok := toQuantity(live)
+
+	return ok && dq.Cmp(lq) == 0
+}
+
+// toFloat converts numbers decoded from YAML or JSON to float64, as they may be decoded to different types.
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	default:
+		return 0, false
+	}
+}
+
+func toInterfaceMap(m map[string]string) map[string]interface{} {
+	out := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		out[k] = v
+	}
+
+	return out
+}
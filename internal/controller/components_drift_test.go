@@ -0,0 +1,378 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/utils/pointer"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	clusterctlv1 "sigs.k8s.io/cluster-api/cmd/clusterctl/api/v1alpha3"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	operatorv1 "sigs.k8s.io/cluster-api-operator/api/v1alpha2"
+	"sigs.k8s.io/cluster-api-operator/internal/controller/genericprovider"
+)
+
+func TestComponentDiff(t *testing.T) {
+	newDeployment := func(image string, replicas interface{}) unstructured.Unstructured {
+		u := unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "apps/v1",
+			"kind":       "Deployment",
+			"metadata": map[string]interface{}{
+				"name":      "capa-controller-manager",
+				"namespace": "capa-system",
+				"labels":    map[string]interface{}{"cluster.x-k8s.io/provider": "infrastructure-aws"},
+			},
+			"spec": map[string]interface{}{
+				"replicas": replicas,
+				"template": map[string]interface{}{
+					"spec": map[string]interface{}{
+						"containers": []interface{}{
+							map[string]interface{}{"name": "manager", "image": image},
+						},
+					},
+				},
+			},
+		}}
+
+		return u
+	}
+
+	newResources := func(limitsCPU, requestsCPU, memory interface{}) unstructured.Unstructured {
+		u := newDeployment("capa:v2.1.4", int64(1))
+		NewWithT(t).Expect(unstructured.SetNestedSlice(u.Object, []interface{}{
+			map[string]interface{}{
+				"name":  "manager",
+				"image": "capa:v2.1.4",
+				"resources": map[string]interface{}{
+					"limits":   map[string]interface{}{"cpu": limitsCPU, "memory": memory},
+					"requests": map[string]interface{}{"cpu": requestsCPU},
+				},
+			},
+		}, "spec", "template", "spec", "containers")).To(Succeed())
+
+		return u
+	}
+
+	testCases := []struct {
+		name         string
+		desired      unstructured.Unstructured
+		live         func() unstructured.Unstructured
+		expectedPath string
+	}{
+		{
+			name:    "identical objects",
+			desired: newDeployment("capa:v2.1.4", int64(1)),
+			live:    func() unstructured.Unstructured { return newDeployment("capa:v2.1.4", int64(1)) },
+		},
+		{
+			name:    "fields defaulted in the live object and metadata set by the API server are ignored",
+			desired: newDeployment("capa:v2.1.4", int64(1)),
+			live: func() unstructured.Unstructured {
+				u := newDeployment("capa:v2.1.4", float64(1))
+				u.SetResourceVersion("42")
+				u.SetUID("uid")
+				g := NewWithT(t)
+				g.Expect(unstructured.SetNestedField(u.Object, "RollingUpdate", "spec", "strategy", "type")).To(Succeed())
+				g.Expect(unstructured.SetNestedField(u.Object, int64(1), "status", "availableReplicas")).To(Succeed())
+
+				return u
+			},
+		},
+		{
+			name:         "changed image",
+			desired:      newDeployment("capa:v2.1.4", int64(1)),
+			live:         func() unstructured.Unstructured { return newDeployment("capa:dev", int64(1)) },
+			expectedPath: "spec.template.spec.containers[0].image",
+		},
+		{
+			name:         "changed replicas",
+			desired:      newDeployment("capa:v2.1.4", int64(1)),
+			live:         func() unstructured.Unstructured { return newDeployment("capa:v2.1.4", int64(3)) },
+			expectedPath: "spec.replicas",
+		},
+		{
+			name:    "removed label",
+			desired: newDeployment("capa:v2.1.4", int64(1)),
+			live: func() unstructured.Unstructured {
+				u := newDeployment("capa:v2.1.4", int64(1))
+				u.SetLabels(nil)
+
+				return u
+			},
+			expectedPath: "metadata.labels",
+		},
+		{
+			name:    "added container",
+			desired: newDeployment("capa:v2.1.4", int64(1)),
+			live: func() unstructured.Unstructured {
+				u := newDeployment("capa:v2.1.4", int64(1))
+				g := NewWithT(t)
+				g.Expect(unstructured.SetNestedSlice(u.Object, []interface{}{
+					map[string]interface{}{"name": "manager", "image": "capa:v2.1.4"},
+					map[string]interface{}{"name": "sidecar", "image": "sidecar:v1"},
+				}, "spec", "template", "spec", "containers")).To(Succeed())
+
+				return u
+			},
+			expectedPath: "spec.template.spec.containers",
+		},
+		{
+			name: "empty lists filled in by the cluster are ignored",
+			desired: unstructured.Unstructured{Object: map[string]interface{}{
+				"kind":            "ClusterRole",
+				"aggregationRule": map[string]interface{}{"clusterRoleSelectors": []interface{}{map[string]interface{}{"matchLabels": map[string]interface{}{"cluster.x-k8s.io/aggregate-to-manager": "true"}}}},
+				"rules":           []interface{}{},
+			}},
+			live: func() unstructured.Unstructured {
+				return unstructured.Unstructured{Object: map[string]interface{}{
+					"kind":            "ClusterRole",
+					"aggregationRule": map[string]interface{}{"clusterRoleSelectors": []interface{}{map[string]interface{}{"matchLabels": map[string]interface{}{"cluster.x-k8s.io/aggregate-to-manager": "true"}}}},
+					"rules":           []interface{}{map[string]interface{}{"apiGroups": []interface{}{""}, "resources": []interface{}{"secrets"}, "verbs": []interface{}{"get"}}},
+				}}
+			},
+		},
+		{
+			name:    "quantities serialized by the API server are compared by value",
+			desired: newResources(int64(1), 0.5, "1Gi"),
+			live:    func() unstructured.Unstructured { return newResources("1", "500m", "1024Mi") },
+		},
+		{
+			name:         "changed quantity",
+			desired:      newResources(int64(1), 0.5, "1Gi"),
+			live:         func() unstructured.Unstructured { return newResources("2", "500m", "1Gi") },
+			expectedPath: "spec.template.spec.containers[0].resources.limits.cpu",
+		},
+		{
+			name: "injected CA bundles are ignored",
+			desired: unstructured.Unstructured{Object: map[string]interface{}{
+				"kind":     "ValidatingWebhookConfiguration",
+				"webhooks": []interface{}{map[string]interface{}{"clientConfig": map[string]interface{}{"caBundle": "Cg=="}}},
+			}},
+			live: func() unstructured.Unstructured {
+				return unstructured.Unstructured{Object: map[string]interface{}{
+					"kind":     "ValidatingWebhookConfiguration",
+					"webhooks": []interface{}{map[string]interface{}{"clientConfig": map[string]interface{}{"caBundle": "LS0tLS1CRUdJTi..."}}},
+				}}
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			g.Expect(componentDiff(tc.desired, tc.live())).To(Equal(tc.expectedPath))
+		})
+	}
+}
+
+func TestDetectDrift(t *testing.T) {
+	deploymentGVK := appsv1.SchemeGroupVersion.WithKind("Deployment")
+
+	desiredDeployment := newUnstructured(deploymentGVK, "capa-system", "capa-controller-manager")
+	desiredDeployment.SetLabels(map[string]string{"cluster.x-k8s.io/provider": "infrastructure-aws"})
+	NewWithT(t).Expect(unstructured.SetNestedField(desiredDeployment.Object, int64(1), "spec", "replicas")).To(Succeed())
+
+	desiredServiceAccount := newUnstructured(corev1.SchemeGroupVersion.WithKind("ServiceAccount"), "capa-system", "capa-manager")
+
+	objs := []unstructured.Unstructured{desiredDeployment, desiredServiceAccount}
+
+	liveDeployment := func(replicas int32) *appsv1.Deployment {
+		return &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "capa-controller-manager",
+				Namespace: "capa-system",
+				Labels:    map[string]string{"cluster.x-k8s.io/provider": "infrastructure-aws"},
+			},
+			Spec: appsv1.DeploymentSpec{Replicas: pointer.Int32(replicas)},
+		}
+	}
+
+	liveServiceAccount := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "capa-manager", Namespace: "capa-system"}}
+
+	testCases := []struct {
+		name            string
+		enforceNoDrift  bool
+		liveObjs        []client.Object
+		expectedReason  string
+		expectedMessage string
+		expectedApplied []string
+	}{
+		{
+			name:     "no drift",
+			liveObjs: []client.Object{liveDeployment(1), liveServiceAccount},
+		},
+		{
+			name:            "drift is reported",
+			liveObjs:        []client.Object{liveDeployment(0)},
+			expectedReason:  operatorv1.DriftDetectedReason,
+			expectedMessage: "Components differ from the provider manifests: Deployment capa-system/capa-controller-manager (spec.replicas), ServiceAccount capa-system/capa-manager (missing)",
+		},
+		{
+			name:            "drifted components are applied again",
+			enforceNoDrift:  true,
+			liveObjs:        []client.Object{liveDeployment(0), liveServiceAccount},
+			expectedReason:  operatorv1.DriftCorrectedReason,
+			expectedMessage: "Components applied again after differing from the provider manifests: Deployment capa-system/capa-controller-manager (spec.replicas)",
+			expectedApplied: []string{"capa-controller-manager"},
+		},
+		{
+			name:            "deleted deployments are created again",
+			liveObjs:        []client.Object{liveServiceAccount},
+			expectedReason:  operatorv1.DriftCorrectedReason,
+			expectedMessage: "Components applied again after differing from the provider manifests: Deployment capa-system/capa-controller-manager (missing)",
+			expectedApplied: []string{"capa-controller-manager"},
+		},
+		{
+			name:            "other drift is still reported once deleted deployments are created again",
+			expectedReason:  operatorv1.DriftDetectedReason,
+			expectedMessage: "Components differ from the provider manifests: ServiceAccount capa-system/capa-manager (missing)",
+			expectedApplied: []string{"capa-controller-manager"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			applied := []string{}
+
+			p := &phaseReconciler{
+				ctrlClient: fake.NewClientBuilder().WithObjects(tc.liveObjs...).WithInterceptorFuncs(interceptor.Funcs{
+					Patch: func(ctx context.Context, c client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+						applied = append(applied, obj.GetName())
+
+						return nil
+					},
+				}).Build(),
+				serverSideApply: true,
+				provider: &genericprovider.InfrastructureProviderWrapper{
+					InfrastructureProvider: &operatorv1.InfrastructureProvider{
+						ObjectMeta: metav1.ObjectMeta{Name: "aws", Namespace: "capa-system"},
+						Spec: operatorv1.InfrastructureProviderSpec{
+							ProviderSpec: operatorv1.ProviderSpec{EnforceNoDrift: tc.enforceNoDrift},
+						},
+					},
+				},
+			}
+
+			_, err := p.detectDrift(context.Background(), objs)
+			g.Expect(err).ToNot(HaveOccurred())
+
+			if tc.expectedReason == "" {
+				g.Expect(conditions.Has(p.provider, operatorv1.ComponentsDriftedCondition)).To(BeFalse())
+			} else {
+				g.Expect(conditions.IsTrue(p.provider, operatorv1.ComponentsDriftedCondition)).To(BeTrue())
+				g.Expect(conditions.GetReason(p.provider, operatorv1.ComponentsDriftedCondition)).To(Equal(tc.expectedReason))
+				g.Expect(conditions.GetMessage(p.provider, operatorv1.ComponentsDriftedCondition)).To(Equal(tc.expectedMessage))
+			}
+
+			g.Expect(applied).To(Equal(append([]string{}, tc.expectedApplied...)))
+		})
+	}
+}
+
+func TestDeletedDeploymentIsCreatedAgain(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	desired := newUnstructured(appsv1.SchemeGroupVersion.WithKind("Deployment"), "capa-system", "capa-controller-manager")
+	desired.SetLabels(map[string]string{clusterctlv1.ClusterctlLabel: "", clusterv1.ProviderNameLabel: "infrastructure-aws"})
+
+	hash, err := componentsHash([]unstructured.Unstructured{desired})
+	g.Expect(err).ToNot(HaveOccurred())
+
+	version := "v2.1.4"
+
+	// The components are not rendered again, so neither the manifests nor the transform webhook are needed.
+	provider := &operatorv1.InfrastructureProvider{
+		ObjectMeta: metav1.ObjectMeta{Name: "aws", Namespace: "capa-system"},
+		Spec: operatorv1.InfrastructureProviderSpec{
+			ProviderSpec: operatorv1.ProviderSpec{
+				ManifestTransformWebhook: &operatorv1.ManifestTransformWebhook{URL: "https://127.0.0.1:1/transform"},
+			},
+		},
+		Status: operatorv1.InfrastructureProviderStatus{
+			ProviderStatus: operatorv1.ProviderStatus{InstalledVersion: &version, AppliedComponentsHash: &hash},
+		},
+	}
+
+	scheme := setupScheme()
+	utilruntime.Must(appsv1.AddToScheme(scheme))
+
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(provider, desired.DeepCopy()).WithInterceptorFuncs(interceptor.Funcs{
+		// The fake client doesn't support server-side apply, so the applied components are created instead.
+		Patch: func(ctx context.Context, c client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+			return c.Create(ctx, obj)
+		},
+	}).Build()
+
+	r := &GenericProviderReconciler{
+		Provider:        &operatorv1.InfrastructureProvider{},
+		ProviderList:    &operatorv1.InfrastructureProviderList{},
+		Client:          c,
+		ServerSideApply: true,
+	}
+
+	wrapper := &genericprovider.InfrastructureProviderWrapper{InfrastructureProvider: provider}
+	g.Expect(newPhaseReconciler(*r, wrapper, nil).storeAppliedComponents(ctx, []unstructured.Unstructured{desired}, hash)).To(Succeed())
+
+	deployment := &appsv1.Deployment{}
+	g.Expect(c.Get(ctx, client.ObjectKeyFromObject(&desired), deployment)).To(Succeed())
+	g.Expect(c.Delete(ctx, deployment)).To(Succeed())
+
+	// The deletion of the provider Deployment reconciles the provider.
+	g.Expect(providerDeploymentPredicate().Delete(event.DeleteEvent{Object: deployment})).To(BeTrue())
+	g.Expect(r.deploymentToProvider(ctx, deployment)).To(Equal([]reconcile.Request{
+		{NamespacedName: client.ObjectKeyFromObject(provider)},
+	}))
+
+	// Other Deployments are ignored.
+	g.Expect(providerDeploymentPredicate().Delete(event.DeleteEvent{Object: &appsv1.Deployment{}})).To(BeFalse())
+
+	_, err = r.reconcileDrift(ctx, wrapper)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(c.Get(ctx, client.ObjectKeyFromObject(&desired), &appsv1.Deployment{})).To(Succeed())
+	g.Expect(conditions.GetReason(wrapper, operatorv1.ComponentsDriftedCondition)).To(Equal(operatorv1.DriftCorrectedReason))
+}
+
+func TestDriftMessage(t *testing.T) {
+	g := NewWithT(t)
+
+	drifts := []componentDrift{}
+	for _, name := range []string{"a", "b", "c", "d", "e", "f", "g"} {
+		drifts = append(drifts, componentDrift{Object: "ConfigMap capi-system/" + name, Path: "data"})
+	}
+
+	g.Expect(driftMessage(drifts[:1])).To(Equal("ConfigMap capi-system/a (data)"))
+	g.Expect(driftMessage(drifts)).To(Equal("ConfigMap capi-system/a (data), ConfigMap capi-system/b (data), ConfigMap capi-system/c (data), " +
+		"ConfigMap capi-system/d (data), ConfigMap capi-system/e (data) and 2 more"))
+}
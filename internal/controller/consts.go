@@ -19,10 +19,64 @@ package controller
 import "time"
 
 const (
+	// MinReconcileInterval is the shortest interval providers can be requeued after.
+	MinReconcileInterval = 5 * time.Second
+
 	// preflightFailedRequeueAfter is how long to wait before trying to reconcile
 	// if some preflight check has failed.
 	preflightFailedRequeueAfter = 30 * time.Second
 
+	// cacheSyncRequeueAfter is how long to wait before reconciling a provider again if the operator caches
+	// are not synced yet.
+	cacheSyncRequeueAfter = 2 * time.Second
+
+	// healthCheckRequeueAfter is how long to wait before checking again if the provider
+	// deployments are available.
+	healthCheckRequeueAfter = 10 * time.Second
+
+	// podsDeletionRequeueAfter is how long to wait before checking again if the pods of the
+	// previously installed version are gone.
+	podsDeletionRequeueAfter = 5 * time.Second
+
+	// dependentProvidersRequeueAfter is how long to wait before checking again if the providers
+	// blocking the deletion of the core provider are gone.
+	dependentProvidersRequeueAfter = 5 * time.Second
+
+	// upgradeOrderRequeueAfter is how long to wait before checking again if the providers of the
+	// earlier upgrade stages are upgraded and Ready.
+	upgradeOrderRequeueAfter = 10 * time.Second
+
+	// insufficientPermissionsRequeueAfter is how long to wait before trying to install the provider again
+	// if the operator was forbidden to apply its CRDs.
+	insufficientPermissionsRequeueAfter = 30 * time.Second
+
+	// crdsEstablishedTimeout is how long to wait for the provider CRDs to become established
+	// before reporting an error.
+	crdsEstablishedTimeout = 2 * time.Minute
+
+	// downloadThrottledRequeueAfter is how long to wait, before jitter, before trying to download the
+	// provider manifests again if the maximum number of concurrent downloads is reached.
+	downloadThrottledRequeueAfter = 5 * time.Second
+
+	// manifestsCacheTTL is how long the downloaded provider manifests are cached for.
+	manifestsCacheTTL = 1 * time.Hour
+
+	// postInstallHookDefaultTimeout is how long the post-install Job may run if the hook doesn't set a timeout.
+	postInstallHookDefaultTimeout = 10 * time.Minute
+
+	// postInstallHookDefaultRetention is how long finished post-install Jobs are kept if the hook doesn't set
+	// a retention period.
+	postInstallHookDefaultRetention = 24 * time.Hour
+
+	// autoUpgradeResyncPeriod is how often to check for new provider versions
+	// if auto upgrade is enabled.
+	autoUpgradeResyncPeriod = 10 * time.Minute
+
+	// providerNameVariable and providerNamespaceVariable are the variables set to the name and namespace of the
+	// provider when rendering its manifests.
+	providerNameVariable      = "PROVIDER_NAME"
+	providerNamespaceVariable = "PROVIDER_NAMESPACE"
+
 	httpsScheme             = "https"
 	githubDomain            = "github.com"
 	gitlabHostPrefix        = "gitlab."
@@ -0,0 +1,86 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	operatorv1 "sigs.k8s.io/cluster-api-operator/api/v1alpha2"
+	"sigs.k8s.io/cluster-api-operator/internal/controller/genericprovider"
+	"sigs.k8s.io/cluster-api-operator/util"
+)
+
+// checkDependentProviders keeps the finalizer of the core provider, requeueing, until no other provider remains,
+// as their controllers can't work without the core provider components, like clusterctl refuses to delete the
+// core provider alone. The force delete annotation skips the check.
+func (p *phaseReconciler) checkDependentProviders(ctx context.Context) (reconcile.Result, error) {
+	if !util.IsCoreProvider(p.provider) || p.provider.GetAnnotations()[operatorv1.ForceDeleteAnnotation] == "true" {
+		return reconcile.Result{}, nil
+	}
+
+	dependents, err := dependentProviders(ctx, p.ctrlClient)
+	if err != nil {
+		return reconcile.Result{}, wrapPhaseError(err, operatorv1.DependentProvidersExistReason)
+	}
+
+	if len(dependents) == 0 {
+		return reconcile.Result{}, nil
+	}
+
+	ctrl.LoggerFrom(ctx).Info("Waiting for the providers depending on the core provider to be deleted", "providers", dependents)
+	conditions.Set(p.provider, conditions.FalseCondition(operatorv1.ProviderInstalledCondition, operatorv1.DependentProvidersExistReason,
+		clusterv1.ConditionSeverityWarning, "Deletion is blocked until the providers depending on the core provider are deleted: %s."+
+			" Set the %s annotation to \"true\" to delete it anyway", strings.Join(dependents, ", "), operatorv1.ForceDeleteAnnotation))
+
+	return reconcile.Result{RequeueAfter: dependentProvidersRequeueAfter}, nil
+}
+
+// dependentProviders returns the sorted descriptions of the providers other than the core provider, in all the
+// namespaces, including the ones being deleted.
+func dependentProviders(ctx context.Context, c client.Client) ([]string, error) {
+	lists := []genericprovider.GenericProviderList{
+		&genericprovider.BootstrapProviderListWrapper{BootstrapProviderList: &operatorv1.BootstrapProviderList{}},
+		&genericprovider.ControlPlaneProviderListWrapper{ControlPlaneProviderList: &operatorv1.ControlPlaneProviderList{}},
+		&genericprovider.InfrastructureProviderListWrapper{InfrastructureProviderList: &operatorv1.InfrastructureProviderList{}},
+		&genericprovider.AddonProviderListWrapper{AddonProviderList: &operatorv1.AddonProviderList{}},
+	}
+
+	dependents := []string{}
+
+	for _, list := range lists {
+		if err := c.List(ctx, list.GetObject()); err != nil {
+			return nil, fmt.Errorf("failed to list providers: %w", err)
+		}
+
+		for _, provider := range list.GetItems() {
+			dependents = append(dependents, describeProvider(providerKind(provider), client.ObjectKeyFromObject(provider.GetObject())))
+		}
+	}
+
+	sort.Strings(dependents)
+
+	return dependents, nil
+}
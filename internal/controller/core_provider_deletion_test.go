@@ -0,0 +1,103 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	operatorv1 "sigs.k8s.io/cluster-api-operator/api/v1alpha2"
+	"sigs.k8s.io/cluster-api-operator/internal/controller/genericprovider"
+)
+
+func TestCheckDependentProviders(t *testing.T) {
+	newCoreProvider := func(annotations map[string]string) genericprovider.GenericProvider {
+		return &genericprovider.CoreProviderWrapper{
+			CoreProvider: &operatorv1.CoreProvider{
+				ObjectMeta: metav1.ObjectMeta{Name: "cluster-api", Namespace: "capi-system", Annotations: annotations},
+			},
+		}
+	}
+
+	awsProvider := &operatorv1.InfrastructureProvider{ObjectMeta: metav1.ObjectMeta{Name: "aws", Namespace: "capa-system"}}
+	kubeadmProvider := &operatorv1.BootstrapProvider{ObjectMeta: metav1.ObjectMeta{Name: "kubeadm", Namespace: "capi-kubeadm-bootstrap-system"}}
+
+	testCases := []struct {
+		name            string
+		provider        genericprovider.GenericProvider
+		objs            []client.Object
+		expectedMessage string
+	}{
+		{
+			name:     "no other provider",
+			provider: newCoreProvider(nil),
+		},
+		{
+			name:     "other providers remain",
+			provider: newCoreProvider(nil),
+			objs:     []client.Object{awsProvider, kubeadmProvider},
+			expectedMessage: "Deletion is blocked until the providers depending on the core provider are deleted: " +
+				"BootstrapProvider capi-kubeadm-bootstrap-system/kubeadm, InfrastructureProvider capa-system/aws." +
+				" Set the operator.cluster.x-k8s.io/force-delete annotation to \"true\" to delete it anyway",
+		},
+		{
+			name:     "force delete annotation",
+			provider: newCoreProvider(map[string]string{operatorv1.ForceDeleteAnnotation: "true"}),
+			objs:     []client.Object{awsProvider},
+		},
+		{
+			name: "other provider types are not blocked",
+			provider: &genericprovider.BootstrapProviderWrapper{
+				BootstrapProvider: kubeadmProvider.DeepCopy(),
+			},
+			objs: []client.Object{awsProvider},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			p := &phaseReconciler{
+				ctrlClient: fake.NewClientBuilder().WithScheme(setupScheme()).WithObjects(tc.objs...).Build(),
+				provider:   tc.provider,
+			}
+
+			res, err := p.checkDependentProviders(context.Background())
+			g.Expect(err).ToNot(HaveOccurred())
+
+			if tc.expectedMessage == "" {
+				g.Expect(res.IsZero()).To(BeTrue())
+				g.Expect(conditions.Has(p.provider, operatorv1.ProviderInstalledCondition)).To(BeFalse())
+
+				return
+			}
+
+			g.Expect(res.RequeueAfter).To(Equal(dependentProvidersRequeueAfter))
+			g.Expect(conditions.GetReason(p.provider, operatorv1.ProviderInstalledCondition)).To(Equal(operatorv1.DependentProvidersExistReason))
+			g.Expect(conditions.GetSeverity(p.provider, operatorv1.ProviderInstalledCondition)).To(HaveValue(Equal(clusterv1.ConditionSeverityWarning)))
+			g.Expect(conditions.GetMessage(p.provider, operatorv1.ProviderInstalledCondition)).To(Equal(tc.expectedMessage))
+		})
+	}
+}
@@ -0,0 +1,133 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	operatorv1 "sigs.k8s.io/cluster-api-operator/api/v1alpha2"
+)
+
+const (
+	// downloadRetryBaseDelay is the delay before retrying the first failed download of a provider, doubled after
+	// each consecutive failure up to downloadRetryMaxDelay.
+	downloadRetryBaseDelay = 10 * time.Second
+	downloadRetryMaxDelay  = 10 * time.Minute
+
+	// versionNotFoundMaxRetries is the number of consecutive failed downloads after which a version missing from
+	// the repository is reported as an error instead of being retried, about half an hour with the backoff.
+	versionNotFoundMaxRetries = 8
+)
+
+// sharedDownloadBackoff is shared by the reconcilers of all the provider types, as the download limiter.
+var sharedDownloadBackoff = &downloadBackoff{failures: map[string]int{}}
+
+// downloadBackoff counts the consecutive failed downloads of each provider, so the retries are spaced out
+// exponentially and the failing condition can tell when the next one happens.
+type downloadBackoff struct {
+	mu       sync.Mutex
+	failures map[string]int
+}
+
+// next records a failed download of the provider identified by key, returning the delay before the next attempt.
+func (b *downloadBackoff) next(key string) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures[key]++
+
+	delay := downloadRetryBaseDelay
+	for i := 1; i < b.failures[key] && delay < downloadRetryMaxDelay; i++ {
+		delay *= 2
+	}
+
+	if delay > downloadRetryMaxDelay {
+		delay = downloadRetryMaxDelay
+	}
+
+	return delay
+}
+
+// attempts returns the number of consecutive failed downloads of the provider identified by key.
+func (b *downloadBackoff) attempts(key string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.failures[key]
+}
+
+// reset forgets the failed downloads of the provider identified by key, e.g. when a download succeeds.
+func (b *downloadBackoff) reset(key string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	delete(b.failures, key)
+}
+
+// scheduleDownloadRetry requeues the provider after the current backoff when downloading its manifests failed,
+// instead of returning the error, and reports when the retry is scheduled in the failing condition.
+func (p *phaseReconciler) scheduleDownloadRetry(ctx context.Context, res reconcile.Result, err error) (reconcile.Result, error) {
+	key := providerKey(p.provider)
+
+	var pe *PhaseError
+	if err == nil || !errors.As(err, &pe) {
+		if err == nil && res.IsZero() {
+			sharedDownloadBackoff.reset(key)
+		}
+
+		return res, err
+	}
+
+	// The version may be about to be published, e.g. a just tagged release, but a wrong version must not be
+	// retried forever.
+	if pe.Reason == operatorv1.VersionNotFoundReason && sharedDownloadBackoff.attempts(key) >= versionNotFoundMaxRetries {
+		return res, &PhaseError{
+			Err:      fmt.Errorf("%w, giving up after %d retries", pe.Err, versionNotFoundMaxRetries),
+			Type:     pe.Type,
+			Reason:   pe.Reason,
+			Severity: clusterv1.ConditionSeverityError,
+		}
+	}
+
+	delay := sharedDownloadBackoff.next(key)
+
+	message := err.Error()
+
+	// Tell when the quota resets if the download was rejected by the repository rate limit, e.g. so operators
+	// can decide to configure a token.
+	if p.providerConfig != nil {
+		host := rateLimitHost(p.providerConfig.URL())
+		if limit, ok := sharedRateLimits.exceeded(host); ok {
+			message = fmt.Sprintf("%s, rate limit of %s exceeded: %s", message, host, limit)
+		}
+	}
+
+	ctrl.LoggerFrom(ctx).Error(err, "Failed to download provider manifests", "retryAfter", delay)
+
+	conditions.Set(p.provider, conditions.FalseCondition(pe.Type, pe.Reason, pe.Severity, "%s, retry scheduled in %s", message, delay))
+
+	return reconcile.Result{RequeueAfter: delay}, nil
+}
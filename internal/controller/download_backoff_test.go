@@ -0,0 +1,149 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	operatorv1 "sigs.k8s.io/cluster-api-operator/api/v1alpha2"
+	"sigs.k8s.io/cluster-api-operator/internal/controller/genericprovider"
+)
+
+func TestDownloadBackoff(t *testing.T) {
+	g := NewWithT(t)
+
+	b := &downloadBackoff{failures: map[string]int{}}
+
+	g.Expect(b.next("a")).To(Equal(10 * time.Second))
+	g.Expect(b.next("a")).To(Equal(20 * time.Second))
+	g.Expect(b.next("a")).To(Equal(40 * time.Second))
+
+	// Providers back off independently.
+	g.Expect(b.next("b")).To(Equal(10 * time.Second))
+
+	for i := 0; i < 10; i++ {
+		b.next("a")
+	}
+
+	g.Expect(b.next("a")).To(Equal(downloadRetryMaxDelay))
+
+	b.reset("a")
+	g.Expect(b.next("a")).To(Equal(10 * time.Second))
+}
+
+func TestScheduleDownloadRetry(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	p := &phaseReconciler{
+		provider: &genericprovider.InfrastructureProviderWrapper{
+			InfrastructureProvider: &operatorv1.InfrastructureProvider{
+				ObjectMeta: metav1.ObjectMeta{Name: "download-backoff", Namespace: "capa-system"},
+			},
+		},
+	}
+
+	defer sharedDownloadBackoff.reset(providerKey(p.provider))
+
+	downloadErr := &PhaseError{
+		Err:      errors.New("failed to download"),
+		Type:     operatorv1.ProviderInstalledCondition,
+		Reason:   operatorv1.DownloadFailedReason,
+		Severity: clusterv1.ConditionSeverityWarning,
+	}
+
+	// Each failure is retried after a longer delay, reported in the condition message.
+	res, err := p.scheduleDownloadRetry(ctx, reconcile.Result{}, downloadErr)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(res.RequeueAfter).To(Equal(10 * time.Second))
+	g.Expect(conditions.GetReason(p.provider, operatorv1.ProviderInstalledCondition)).To(Equal(operatorv1.DownloadFailedReason))
+	g.Expect(conditions.GetMessage(p.provider, operatorv1.ProviderInstalledCondition)).To(Equal("failed to download, retry scheduled in 10s"))
+
+	res, err = p.scheduleDownloadRetry(ctx, reconcile.Result{}, downloadErr)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(res.RequeueAfter).To(Equal(20 * time.Second))
+	g.Expect(conditions.GetMessage(p.provider, operatorv1.ProviderInstalledCondition)).To(Equal("failed to download, retry scheduled in 20s"))
+
+	// Waiting for a download slot doesn't reset the backoff, while a successful download does.
+	res, err = p.scheduleDownloadRetry(ctx, reconcile.Result{RequeueAfter: time.Second}, nil)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(res.RequeueAfter).To(Equal(time.Second))
+
+	res, err = p.scheduleDownloadRetry(ctx, reconcile.Result{}, downloadErr)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(res.RequeueAfter).To(Equal(40 * time.Second))
+
+	_, err = p.scheduleDownloadRetry(ctx, reconcile.Result{}, nil)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	res, _ = p.scheduleDownloadRetry(ctx, reconcile.Result{}, downloadErr)
+	g.Expect(res.RequeueAfter).To(Equal(10 * time.Second))
+
+	// Other errors are returned as they are.
+	_, err = p.scheduleDownloadRetry(ctx, reconcile.Result{}, errors.New("unexpected"))
+	g.Expect(err).To(MatchError("unexpected"))
+}
+
+func TestScheduleDownloadRetryVersionNotFound(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	p := &phaseReconciler{
+		provider: &genericprovider.InfrastructureProviderWrapper{
+			InfrastructureProvider: &operatorv1.InfrastructureProvider{
+				ObjectMeta: metav1.ObjectMeta{Name: "version-not-found", Namespace: "capa-system"},
+			},
+		},
+	}
+
+	defer sharedDownloadBackoff.reset(providerKey(p.provider))
+
+	notFoundErr := &PhaseError{
+		Err:      errors.New("version v2.2.0 not found"),
+		Type:     operatorv1.ProviderInstalledCondition,
+		Reason:   operatorv1.VersionNotFoundReason,
+		Severity: clusterv1.ConditionSeverityWarning,
+	}
+
+	// The version may be published shortly, so it's retried with the backoff.
+	for i := 0; i < versionNotFoundMaxRetries; i++ {
+		res, err := p.scheduleDownloadRetry(ctx, reconcile.Result{}, notFoundErr)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(res.RequeueAfter).ToNot(BeZero())
+		g.Expect(conditions.GetReason(p.provider, operatorv1.ProviderInstalledCondition)).To(Equal(operatorv1.VersionNotFoundReason))
+		g.Expect(conditions.GetSeverity(p.provider, operatorv1.ProviderInstalledCondition)).To(HaveValue(Equal(clusterv1.ConditionSeverityWarning)))
+	}
+
+	// Until it's reported as an error.
+	res, err := p.scheduleDownloadRetry(ctx, reconcile.Result{}, notFoundErr)
+	g.Expect(res.IsZero()).To(BeTrue())
+	g.Expect(err).To(MatchError("version v2.2.0 not found, giving up after 8 retries"))
+
+	var pe *PhaseError
+	g.Expect(errors.As(err, &pe)).To(BeTrue())
+	g.Expect(pe.Reason).To(Equal(operatorv1.VersionNotFoundReason))
+	g.Expect(pe.Severity).To(Equal(clusterv1.ConditionSeverityError))
+}
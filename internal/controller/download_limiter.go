@@ -0,0 +1,113 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	"sigs.k8s.io/cluster-api-operator/internal/controller/genericprovider"
+)
+
+var queuedDownloads = prometheus.NewGauge(prometheus.GaugeOpts{
+	Name: "capi_operator_queued_downloads",
+	Help: "Number of providers waiting for a download slot to download their manifests.",
+})
+
+func init() {
+	metrics.Registry.MustRegister(queuedDownloads)
+}
+
+// DownloadLimiter limits the number of provider manifests downloads running concurrently across all the
+// providers managed by the operator, e.g. so they don't hit the GitHub rate limits when the operator starts.
+// A nil limiter doesn't limit the downloads.
+type DownloadLimiter struct {
+	slots chan struct{}
+
+	mu      sync.Mutex
+	waiting map[string]bool
+}
+
+// NewDownloadLimiter returns a limiter allowing up to max concurrent downloads, or nil if max is not positive.
+func NewDownloadLimiter(max int) *DownloadLimiter {
+	if max <= 0 {
+		return nil
+	}
+
+	return &DownloadLimiter{
+		slots:   make(chan struct{}, max),
+		waiting: map[string]bool{},
+	}
+}
+
+// tryAcquire takes a download slot for the provider identified by key without blocking, returning false
+// if all of them are in use. The provider is then reported as queued until it gets a slot, or is forgotten.
+func (l *DownloadLimiter) tryAcquire(key string) bool {
+	if l == nil {
+		return true
+	}
+
+	select {
+	case l.slots <- struct{}{}:
+		l.setWaiting(key, false)
+
+		return true
+	default:
+		l.setWaiting(key, true)
+
+		return false
+	}
+}
+
+// release frees a download slot taken with tryAcquire.
+func (l *DownloadLimiter) release() {
+	if l == nil {
+		return
+	}
+
+	<-l.slots
+}
+
+// forget stops reporting the provider identified by key as queued, e.g. when it is deleted.
+func (l *DownloadLimiter) forget(key string) {
+	if l == nil {
+		return
+	}
+
+	l.setWaiting(key, false)
+}
+
+// providerKey returns the key identifying the provider in the download limiter.
+func providerKey(provider genericprovider.GenericProvider) string {
+	return fmt.Sprintf("%s/%s/%s", provider.GetType(), provider.GetNamespace(), provider.GetName())
+}
+
+func (l *DownloadLimiter) setWaiting(key string, waiting bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if waiting {
+		l.waiting[key] = true
+	} else {
+		delete(l.waiting, key)
+	}
+
+	queuedDownloads.Set(float64(len(l.waiting)))
+}
@@ -0,0 +1,69 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func queuedDownloadsValue(g *WithT) float64 {
+	m := &dto.Metric{}
+	g.Expect(queuedDownloads.Write(m)).To(Succeed())
+
+	return m.GetGauge().GetValue()
+}
+
+func TestDownloadLimiter(t *testing.T) {
+	g := NewWithT(t)
+
+	l := NewDownloadLimiter(2)
+
+	g.Expect(l.tryAcquire("core/capi-system/cluster-api")).To(BeTrue())
+	g.Expect(l.tryAcquire("infrastructure/capa-system/aws")).To(BeTrue())
+
+	// All the slots are taken, so the next providers are queued, once each.
+	g.Expect(l.tryAcquire("infrastructure/capz-system/azure")).To(BeFalse())
+	g.Expect(l.tryAcquire("infrastructure/capz-system/azure")).To(BeFalse())
+	g.Expect(l.tryAcquire("bootstrap/kubeadm-system/kubeadm")).To(BeFalse())
+	g.Expect(queuedDownloadsValue(g)).To(Equal(2.0))
+
+	// A released slot goes to the next provider trying, which is no longer queued.
+	l.release()
+	g.Expect(l.tryAcquire("infrastructure/capz-system/azure")).To(BeTrue())
+	g.Expect(queuedDownloadsValue(g)).To(Equal(1.0))
+
+	// Deleted providers are no longer queued.
+	l.forget("bootstrap/kubeadm-system/kubeadm")
+	g.Expect(queuedDownloadsValue(g)).To(Equal(0.0))
+}
+
+func TestDownloadLimiterUnlimited(t *testing.T) {
+	g := NewWithT(t)
+
+	l := NewDownloadLimiter(0)
+	g.Expect(l).To(BeNil())
+
+	for i := 0; i < 10; i++ {
+		g.Expect(l.tryAcquire("core/capi-system/cluster-api")).To(BeTrue())
+	}
+
+	l.release()
+	l.forget("core/capi-system/cluster-api")
+}
@@ -0,0 +1,91 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"path"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	operatorv1 "sigs.k8s.io/cluster-api-operator/api/v1alpha2"
+)
+
+// validateExcludedObjects checks the excluded object patterns, returning a message describing the first
+// problem found, if any.
+func validateExcludedObjects(patterns []operatorv1.ExcludedObject) string {
+	for i, pattern := range patterns {
+		if pattern.Kind == "" || pattern.Name == "" {
+			return fmt.Sprintf("Excluded object %d must set both a kind and a name", i)
+		}
+
+		if pattern.APIVersion != "" {
+			if _, err := schema.ParseGroupVersion(pattern.APIVersion); err != nil {
+				return fmt.Sprintf("Invalid API version %q of excluded object %d: %v", pattern.APIVersion, i, err)
+			}
+		}
+
+		if _, err := path.Match(pattern.Name, ""); err != nil {
+			return fmt.Sprintf("Invalid name pattern %q of excluded object %d: %v", pattern.Name, i, err)
+		}
+	}
+
+	return ""
+}
+
+// excludeObjectsFn removes the objects matching any of the excluded object patterns. The patterns must be valid.
+func excludeObjectsFn(ctx context.Context, patterns []operatorv1.ExcludedObject) func(objs []unstructured.Unstructured) ([]unstructured.Unstructured, error) {
+	log := ctrl.LoggerFrom(ctx)
+
+	return func(objs []unstructured.Unstructured) ([]unstructured.Unstructured, error) {
+		kept := make([]unstructured.Unstructured, 0, len(objs))
+
+		for _, obj := range objs {
+			if isExcluded(obj, patterns) {
+				log.V(5).Info("Excluding provider component", "component", describeObject(obj))
+
+				continue
+			}
+
+			kept = append(kept, obj)
+		}
+
+		return kept, nil
+	}
+}
+
+// isExcluded returns true if the object matches any of the excluded object patterns.
+func isExcluded(obj unstructured.Unstructured, patterns []operatorv1.ExcludedObject) bool {
+	for _, pattern := range patterns {
+		if pattern.Kind != obj.GetKind() {
+			continue
+		}
+
+		if pattern.APIVersion != "" && pattern.APIVersion != obj.GetAPIVersion() {
+			continue
+		}
+
+		if matched, _ := path.Match(pattern.Name, obj.GetName()); matched {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,167 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterctlv1 "sigs.k8s.io/cluster-api/cmd/clusterctl/api/v1alpha3"
+	configclient "sigs.k8s.io/cluster-api/cmd/clusterctl/client/config"
+	"sigs.k8s.io/cluster-api/cmd/clusterctl/client/repository"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	operatorv1 "sigs.k8s.io/cluster-api-operator/api/v1alpha2"
+	"sigs.k8s.io/cluster-api-operator/internal/controller/genericprovider"
+)
+
+func TestExcludeObjects(t *testing.T) {
+	components := `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: capa-controller-manager
+  namespace: capa-system
+---
+apiVersion: policy/v1
+kind: PodDisruptionBudget
+metadata:
+  name: capa-controller-manager
+  namespace: capa-system
+---
+apiVersion: cluster.x-k8s.io/v1beta1
+kind: ClusterClass
+metadata:
+  name: quick-start-aws
+  namespace: capa-system
+---
+apiVersion: cluster.x-k8s.io/v1beta1
+kind: ClusterClass
+metadata:
+  name: eks
+  namespace: capa-system
+`
+
+	testCases := []struct {
+		name            string
+		excludeObjects  []operatorv1.ExcludedObject
+		expectedApplied []string
+	}{
+		{
+			name: "no excluded objects",
+			expectedApplied: []string{
+				"Deployment capa-system/capa-controller-manager",
+				"PodDisruptionBudget capa-system/capa-controller-manager",
+				"ClusterClass capa-system/quick-start-aws",
+				"ClusterClass capa-system/eks",
+			},
+		},
+		{
+			name: "excluded named object",
+			excludeObjects: []operatorv1.ExcludedObject{
+				{APIVersion: "policy/v1", Kind: "PodDisruptionBudget", Name: "capa-controller-manager"},
+			},
+			expectedApplied: []string{
+				"Deployment capa-system/capa-controller-manager",
+				"ClusterClass capa-system/quick-start-aws",
+				"ClusterClass capa-system/eks",
+			},
+		},
+		{
+			name: "excluded name pattern",
+			excludeObjects: []operatorv1.ExcludedObject{
+				{Kind: "ClusterClass", Name: "quick-start-*"},
+			},
+			expectedApplied: []string{
+				"Deployment capa-system/capa-controller-manager",
+				"PodDisruptionBudget capa-system/capa-controller-manager",
+				"ClusterClass capa-system/eks",
+			},
+		},
+		{
+			name: "other API versions are not excluded",
+			excludeObjects: []operatorv1.ExcludedObject{
+				{APIVersion: "policy/v1beta1", Kind: "PodDisruptionBudget", Name: "*"},
+			},
+			expectedApplied: []string{
+				"Deployment capa-system/capa-controller-manager",
+				"PodDisruptionBudget capa-system/capa-controller-manager",
+				"ClusterClass capa-system/quick-start-aws",
+				"ClusterClass capa-system/eks",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			configClient, err := configclient.New("", configclient.InjectReader(configclient.NewMemoryReader()))
+			g.Expect(err).ToNot(HaveOccurred())
+
+			repo := repository.NewMemoryRepository().WithPaths("", "components.yaml").WithDefaultVersion("v2.2.0").
+				WithFile("v2.2.0", "components.yaml", []byte(components))
+
+			applied := []string{}
+
+			p := &phaseReconciler{
+				ctrlClient: fake.NewClientBuilder().WithInterceptorFuncs(interceptor.Funcs{
+					Patch: func(ctx context.Context, c client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+						applied = append(applied, obj.GetObjectKind().GroupVersionKind().Kind+" "+client.ObjectKeyFromObject(obj).String())
+
+						return nil
+					},
+				}).Build(),
+				provider: &genericprovider.InfrastructureProviderWrapper{
+					InfrastructureProvider: &operatorv1.InfrastructureProvider{
+						ObjectMeta: metav1.ObjectMeta{Name: "aws", Namespace: "capa-system"},
+						Spec: operatorv1.InfrastructureProviderSpec{
+							ProviderSpec: operatorv1.ProviderSpec{ExcludeObjects: tc.excludeObjects},
+						},
+					},
+				},
+				providerConfig:  configclient.NewProvider("aws", "https://example.com/components.yaml", clusterctlv1.InfrastructureProviderType),
+				configClient:    configClient,
+				options:         repository.ComponentsOptions{Version: "v2.2.0", TargetNamespace: "capa-system"},
+				serverSideApply: true,
+			}
+
+			p.components, err = p.newComponents(context.Background(), repo, "v2.2.0")
+			g.Expect(err).ToNot(HaveOccurred())
+
+			g.Expect(p.applyComponents(context.Background(), p.componentsToInstall())).To(Succeed())
+			g.Expect(applied).To(Equal(tc.expectedApplied))
+		})
+	}
+}
+
+func TestValidateExcludedObjects(t *testing.T) {
+	g := NewWithT(t)
+
+	g.Expect(validateExcludedObjects([]operatorv1.ExcludedObject{
+		{APIVersion: "cluster.x-k8s.io/v1beta1", Kind: "ClusterClass", Name: "quick-start-*"},
+	})).To(BeEmpty())
+	g.Expect(validateExcludedObjects([]operatorv1.ExcludedObject{{Name: "capa-controller-manager"}})).
+		To(Equal("Excluded object 0 must set both a kind and a name"))
+	g.Expect(validateExcludedObjects([]operatorv1.ExcludedObject{{APIVersion: "a/b/c", Kind: "ClusterClass", Name: "eks"}})).
+		To(HavePrefix(`Invalid API version "a/b/c" of excluded object 0: `))
+	g.Expect(validateExcludedObjects([]operatorv1.ExcludedObject{{Kind: "ClusterClass", Name: "[eks"}})).
+		To(Equal(`Invalid name pattern "[eks" of excluded object 0: syntax error in pattern`))
+}
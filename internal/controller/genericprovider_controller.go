@@ -23,19 +23,30 @@ import (
 	"errors"
 	"fmt"
 	"reflect"
+	"time"
 
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 	kerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/rest"
+	"k8s.io/component-base/featuregate"
 	operatorv1 "sigs.k8s.io/cluster-api-operator/api/v1alpha2"
 	"sigs.k8s.io/cluster-api-operator/internal/controller/genericprovider"
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
 	"sigs.k8s.io/cluster-api/util/conditions"
 	"sigs.k8s.io/cluster-api/util/patch"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
 
@@ -44,6 +55,72 @@ type GenericProviderReconciler struct {
 	ProviderList client.ObjectList
 	Client       client.Client
 	Config       *rest.Config
+
+	// ReconcileInterval is how long to wait before reconciling a provider again while it's waiting,
+	// unless the provider overrides it. If zero, a default interval is picked for each wait.
+	ReconcileInterval time.Duration
+
+	// SummaryConfigMap is the ConfigMap listing all the providers with their type, version, contract and
+	// readiness, updated on each provider reconcile. The summary is disabled if the name is empty.
+	SummaryConfigMap types.NamespacedName
+
+	// VerifyPermissions enables reviewing that the operator is allowed to create the provider components
+	// before installing them, at the cost of an access review per kind and namespace.
+	VerifyPermissions bool
+
+	// SkipSingleInstanceCheck allows several providers of the same type and name in different namespaces, for
+	// topologies known to support them. Only one core provider is allowed regardless.
+	SkipSingleInstanceCheck bool
+
+	// DownloadLimiter limits the provider manifests downloads running concurrently. It is shared by the
+	// reconcilers of all the provider types, and the downloads are not limited if it is nil.
+	DownloadLimiter *DownloadLimiter
+
+	// ServerSideApply enables applying the provider components and additional manifests with server-side apply,
+	// so that the fields co-managed by other tools, e.g. GitOps ones, are reported as conflicts.
+	ServerSideApply bool
+
+	// FieldManager is the field manager used with server-side apply, DefaultFieldManager if empty.
+	FieldManager string
+
+	// RegistryMirror replaces the registry of the images of all the provider components, e.g. in air-gapped
+	// environments. The images overridden by the provider spec are used as is.
+	RegistryMirror string
+
+	// DisableNamespaceCreation prevents the operator from creating or updating the namespace the provider
+	// components are installed in, e.g. in clusters forbidding it. The namespace must exist then.
+	DisableNamespaceCreation bool
+
+	// WatchNamespace restricts the reconciliation to the providers in this namespace, which can't reference
+	// objects in other namespaces then. All the namespaces are watched if empty. The manager cache is expected
+	// to be restricted to the same namespace.
+	WatchNamespace string
+
+	// FeatureGates are checked by the phases guarding behaviors that are rolled out gradually.
+	// feature.Gates is used if nil.
+	FeatureGates featuregate.FeatureGate
+
+	// OperatorVersion is the version of the running operator, checked against the minimum operator version
+	// required by the provider metadata. The check is skipped if it isn't a semantic version, e.g. in
+	// development builds.
+	OperatorVersion string
+
+	// AuditMode makes the reconciler compute the changes to the cluster without making them, e.g. to validate
+	// an operator deployment before granting it write access. The changes are reported in the PendingChanges
+	// condition, and only the provider status is updated.
+	AuditMode bool
+
+	// CheckNamespaceConventions reports in the ConventionalNamespace condition whether the providers are
+	// installed in the namespace their components default to, e.g. to catch an infrastructure provider
+	// installed in the wrong namespace. The providers are installed regardless.
+	CheckNamespaceConventions bool
+
+	// CacheSync delays the reconciliation of the providers until the operator caches are synced, so they aren't
+	// reconciled against a partial cache on startup. The providers are reconciled right away if nil.
+	CacheSync *CacheSyncGate
+
+	// audit is the client recording the changes in audit mode, set for each reconciliation.
+	audit *auditClient
 }
 
 const (
@@ -51,16 +128,81 @@ const (
 )
 
 func (r *GenericProviderReconciler) SetupWithManager(mgr ctrl.Manager, options controller.Options) error {
+	if r.ReconcileInterval != 0 && r.ReconcileInterval < MinReconcileInterval {
+		return fmt.Errorf("reconcile interval %s is shorter than the minimum %s", r.ReconcileInterval, MinReconcileInterval)
+	}
+
+	if err := validateSummaryConfigMapNamespace(r.SummaryConfigMap, r.WatchNamespace); err != nil {
+		return err
+	}
+
+	if err := validateRegistryMirror(r.RegistryMirror); err != nil {
+		return err
+	}
+
+	// Only the metadata of the secrets is watched, their data is read when the referencing providers are reconciled.
+	// The provider Deployments are watched so they are created again right away once deleted, and their edits
+	// reported, ignoring their status updates.
 	return ctrl.NewControllerManagedBy(mgr).
-		For(r.Provider).
+		For(r.Provider, builder.WithPredicates(inWatchNamespacePredicate(r.WatchNamespace), providerChangedPredicate())).
+		Watches(&corev1.Secret{}, handler.EnqueueRequestsFromMapFunc(r.secretToProviders), builder.OnlyMetadata).
+		Watches(&appsv1.Deployment{}, handler.EnqueueRequestsFromMapFunc(r.deploymentToProvider), builder.WithPredicates(
+			providerDeploymentPredicate(),
+			predicate.Or(predicate.GenerationChangedPredicate{}, predicate.LabelChangedPredicate{}),
+		)).
 		WithOptions(options).
 		Complete(r)
 }
 
+// providerChangedPredicate filters out the provider updates that don't need a reconciliation, i.e. label and
+// annotation changes, and the status updates made by the operator itself. Spec changes bump the generation, so
+// they still trigger a reconciliation, as do the start of the deletion, clearing the applied spec hash
+// annotation to force a reinstall, and changing the approve upgrade annotation. Periodic checks don't rely on
+// events, as they requeue the provider.
+func providerChangedPredicate() predicate.Predicate {
+	return predicate.Or(
+		predicate.GenerationChangedPredicate{},
+		predicate.Funcs{
+			UpdateFunc: func(e event.UpdateEvent) bool {
+				if e.ObjectOld == nil || e.ObjectNew == nil {
+					return true
+				}
+
+				if e.ObjectOld.GetDeletionTimestamp().IsZero() != e.ObjectNew.GetDeletionTimestamp().IsZero() {
+					return true
+				}
+
+				if e.ObjectOld.GetAnnotations()[operatorv1.ApproveUpgradeAnnotation] != e.ObjectNew.GetAnnotations()[operatorv1.ApproveUpgradeAnnotation] {
+					return true
+				}
+
+				return e.ObjectOld.GetAnnotations()[appliedSpecHashAnnotation] != "" &&
+					e.ObjectNew.GetAnnotations()[appliedSpecHashAnnotation] == ""
+			},
+		},
+	)
+}
+
+// reportProviderSummary updates the provider summary ConfigMap, if enabled. Failing to update it doesn't fail
+// the reconciliation, as the summary is rebuilt on the next reconcile of any provider.
+func (r *GenericProviderReconciler) reportProviderSummary(ctx context.Context, reconciled genericprovider.GenericProvider) {
+	if r.SummaryConfigMap.Name == "" {
+		return
+	}
+
+	if err := updateProviderSummary(ctx, r.Client, r.SummaryConfigMap, reconciled); err != nil {
+		ctrl.LoggerFrom(ctx).Error(err, "Failed to update the provider summary", "configMap", r.SummaryConfigMap)
+	}
+}
+
 func (r *GenericProviderReconciler) Reconcile(ctx context.Context, req reconcile.Request) (_ reconcile.Result, reterr error) {
 	log := ctrl.LoggerFrom(ctx)
 
-	log.Info("Reconciling provider")
+	if !r.CacheSync.Synced() {
+		log.V(5).Info("Waiting for the caches to sync before reconciling provider")
+
+		return ctrl.Result{RequeueAfter: cacheSyncRequeueAfter}, nil
+	}
 
 	typedProvider, err := r.newGenericProvider()
 	if err != nil {
@@ -76,19 +218,62 @@ func (r *GenericProviderReconciler) Reconcile(ctx context.Context, req reconcile
 		if apierrors.IsNotFound(err) {
 			// Object not found, return. Created objects are automatically garbage collected.
 			// For additional cleanup logic use finalizers.
+			r.reportProviderSummary(ctx, nil)
+
 			return ctrl.Result{}, nil
 		}
 		// Error reading the object - requeue the request.
 		return ctrl.Result{}, err
 	}
 
+	// Attach the provider identity to the logger once, so that every log line
+	// of this reconciliation, including the ones from the phases, carries it.
+	log = log.WithValues(
+		"providerType", typedProvider.GetType(),
+		"providerName", typedProvider.GetName(),
+		"version", typedProvider.GetSpec().Version,
+	)
+	ctx = ctrl.LoggerInto(ctx, log)
+
+	log.Info("Reconciling provider")
+
 	// Initialize the patch helper
 	patchHelper, err := patch.NewHelper(typedProvider.GetObject(), r.Client)
 	if err != nil {
 		return ctrl.Result{}, err
 	}
 
+	// In audit mode, the changes are recorded by the client instead of being made. The provider is still
+	// patched with the original client, but only its status changes.
+	var auditedSpec *operatorv1.ProviderSpec
+
+	if r.AuditMode {
+		spec := typedProvider.GetSpec()
+		auditedSpec = spec.DeepCopy()
+
+		audited := *r
+		audited.audit = newAuditClient(r.Client)
+		audited.Client = audited.audit
+		r = &audited
+	}
+
+	// A patch wildcard in spec.version is reconciled as the version it resolves to, and kept in the stored spec.
+	restoreVersionWildcard := resolveVersionWildcard(typedProvider)
+
+	// completed is set once all the reconciliation phases are done, as opposed to returning
+	// early, e.g. after adding the finalizer or while waiting for the preflight checks.
+	completed := false
+
 	defer func() {
+		// The spec completed by the phases in audit mode, e.g. with the latest version, is not persisted either.
+		if r.AuditMode {
+			typedProvider.SetSpec(*auditedSpec)
+			setPendingChanges(typedProvider, r.audit.pendingChanges())
+		}
+
+		restoreVersionWildcard()
+		setReconcileTimes(typedProvider, metav1.Now(), completed && reterr == nil)
+
 		// Always attempt to patch the object and status after each reconciliation.
 		// Patch ObservedGeneration only if the reconciliation completed successfully
 		patchOpts := []patch.Option{}
@@ -99,10 +284,12 @@ func (r *GenericProviderReconciler) Reconcile(ctx context.Context, req reconcile
 		if err := patchProvider(ctx, typedProvider, patchHelper, patchOpts...); err != nil {
 			reterr = kerrors.NewAggregate([]error{reterr, err})
 		}
+
+		r.reportProviderSummary(ctx, typedProvider)
 	}()
 
 	// Add finalizer first if not exist to avoid the race condition between init and delete
-	if !controllerutil.ContainsFinalizer(typedProvider.GetObject(), operatorv1.ProviderFinalizer) {
+	if !r.AuditMode && !controllerutil.ContainsFinalizer(typedProvider.GetObject(), operatorv1.ProviderFinalizer) {
 		controllerutil.AddFinalizer(typedProvider.GetObject(), operatorv1.ProviderFinalizer)
 		return ctrl.Result{}, nil
 	}
@@ -118,10 +305,87 @@ func (r *GenericProviderReconciler) Reconcile(ctx context.Context, req reconcile
 		return ctrl.Result{}, err
 	}
 
-	if typedProvider.GetAnnotations()[appliedSpecHashAnnotation] == specHash {
+	specChanged := typedProvider.GetAnnotations()[appliedSpecHashAnnotation] != specHash
+
+	if !specChanged && isUpgradeCheckEnabled(typedProvider) {
+		// Check if a newer version is available in the provider channel or version constraint.
+		r.checkVersionUpgrade(ctx, typedProvider, time.Now())
+
+		newSpecHash, err := calculateHash(typedProvider.GetSpec())
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+
+		if newSpecHash != specHash {
+			log.Info("Newer version available, upgrading provider", "targetVersion", typedProvider.GetSpec().Version)
+
+			specChanged = true
+		}
+	}
+
+	// The components are applied again in place with the variables of the rotated secrets, restarting the provider
+	// Deployments to pick them up, at most once per secretRotationRestartInterval. A spec change reinstalls them anyway.
+	secretsHash, err := referencedSecretsHash(ctx, r.Client, typedProvider)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	appliedSecretsHash, secretsApplied := typedProvider.GetAnnotations()[appliedSecretsHashAnnotation]
+	secretsRotated := secretsApplied && appliedSecretsHash != secretsHash
+
+	if !specChanged && secretsRotated {
+		delay, err := secretRotationDelay(ctx, r.Client, typedProvider, time.Now())
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+
+		if delay > 0 {
+			log.Info("Referenced secrets changed, waiting before restarting provider", "after", delay)
+
+			return ctrl.Result{RequeueAfter: delay}, nil
+		}
+
+		log.Info("Referenced secrets changed, applying provider components again")
+
+		res, err := r.reconcileSecretRotation(ctx, typedProvider, typedProviderList)
+		if !res.IsZero() || err != nil {
+			return res, err
+		}
+
+		if !r.AuditMode {
+			setSecretsHashAnnotation(typedProvider, secretsHash)
+		}
+
+		completed = true
+
+		return r.reconcileInstalled(ctx, typedProvider)
+	}
+
+	if !specChanged {
 		log.Info("No changes detected, skipping further steps")
 
-		return ctrl.Result{}, nil
+		// The secrets of the providers installed before their hash was recorded are assumed to be the ones in use.
+		if !secretsApplied && secretsHash != "" && !r.AuditMode {
+			setSecretsHashAnnotation(typedProvider, secretsHash)
+		}
+
+		// The installed components may still have been changed since they were applied.
+		if res, err := r.reconcileDrift(ctx, typedProvider); !res.IsZero() || err != nil {
+			return res, err
+		}
+
+		completed = true
+
+		return r.reconcileInstalled(ctx, typedProvider)
+	}
+
+	// Nothing is installed in audit mode, so there is no install attempt to time out nor installed version to check.
+	if r.AuditMode {
+		return r.reconcile(ctx, typedProvider, typedProviderList)
+	}
+
+	if !startInstallAttempt(typedProvider, time.Now()) {
+		return failInstall(ctx, typedProvider, nil)
 	}
 
 	res, err := r.reconcile(ctx, typedProvider, typedProviderList)
@@ -146,19 +410,98 @@ func (r *GenericProviderReconciler) Reconcile(ctx context.Context, req reconcile
 
 	typedProvider.SetAnnotations(annotations)
 
-	return res, err
+	// The reinstalled Deployments already run new pods, so they aren't restarted for the rotated secrets.
+	if res.IsZero() && err == nil {
+		setSecretsHashAnnotation(typedProvider, secretsHash)
+	}
+
+	if !res.IsZero() || err != nil {
+		if installTimeoutExceeded(typedProvider, time.Now()) {
+			return failInstall(ctx, typedProvider, err)
+		}
+
+		return res, err
+	}
+
+	finishInstallAttempt(typedProvider)
+
+	completed = true
+
+	return r.reconcileInstalled(ctx, typedProvider)
+}
+
+// setReconcileTimes records the time of the reconciliation in the provider status, and also as the last
+// successful one if all the phases completed without error.
+func setReconcileTimes(provider genericprovider.GenericProvider, now metav1.Time, succeeded bool) {
+	status := provider.GetStatus()
+
+	status.LastReconcileTime = &now
+	if succeeded {
+		status.LastSuccessfulReconcileTime = &now
+	}
+
+	provider.SetStatus(status)
+}
+
+// reconcileInstalled checks the health of an installed provider, runs its post-install hook, and schedules the
+// next check for new versions if auto upgrade or the manual upgrade strategy is enabled.
+func (r *GenericProviderReconciler) reconcileInstalled(ctx context.Context, provider genericprovider.GenericProvider) (ctrl.Result, error) {
+	checks := []func(context.Context, genericprovider.GenericProvider) (ctrl.Result, error){
+		r.reconcileCRDsEstablished,
+		r.reconcileHealth,
+		r.reconcilePostInstallHook,
+	}
+
+	for _, check := range checks {
+		res, err := check(ctx, provider)
+		if !res.IsZero() || err != nil {
+			return res, err
+		}
+	}
+
+	// Periodically check for new versions if auto upgrade or the manual upgrade strategy is enabled. A check
+	// postponed for lack of a download slot is retried shortly.
+	if isUpgradeCheckEnabled(provider) {
+		delay := upgradeCheckDelay(provider, time.Now())
+		if delay == 0 {
+			delay = wait.Jitter(downloadThrottledRequeueAfter, 1.0)
+		}
+
+		return ctrl.Result{RequeueAfter: delay}, nil
+	}
+
+	return ctrl.Result{}, nil
 }
 
 func patchProvider(ctx context.Context, provider genericprovider.GenericProvider, patchHelper *patch.Helper, options ...patch.Option) error {
 	conds := []clusterv1.ConditionType{
 		operatorv1.PreflightCheckCondition,
 		operatorv1.ProviderInstalledCondition,
+		operatorv1.AdditionalManifestsAppliedCondition,
+		operatorv1.AdditionalRBACAppliedCondition,
+		operatorv1.CRDsEstablishedCondition,
+		operatorv1.ProviderAvailableCondition,
+		operatorv1.PostInstallHookCompletedCondition,
 	}
 
 	conditions.SetSummary(provider, conditions.WithConditions(conds...))
 
 	options = append(options,
-		patch.WithOwnedConditions{Conditions: append(conds, clusterv1.ReadyCondition)},
+		patch.WithOwnedConditions{Conditions: append(conds,
+			clusterv1.ReadyCondition,
+			operatorv1.AutoUpgradePendingCondition,
+			operatorv1.UpgradeAvailableCondition,
+			operatorv1.UpgradeAwaitingApprovalCondition,
+			operatorv1.UpgradeQueuedCondition,
+			operatorv1.UpgradeTargetUnavailableCondition,
+			operatorv1.UpgradeCheckFailedCondition,
+			operatorv1.ImageOverriddenCondition,
+			operatorv1.ContractSkewToleratedCondition,
+			operatorv1.ComponentsDriftedCondition,
+			operatorv1.InstallFailedCondition,
+			operatorv1.PendingChangesCondition,
+			operatorv1.ConventionalNamespaceCondition,
+		)},
 	)
 
 	return patchHelper.Patch(ctx, provider.GetObject(), options...)
@@ -169,11 +512,21 @@ func (r *GenericProviderReconciler) reconcile(ctx context.Context, provider gene
 	phases := []reconcilePhaseFn{
 		reconciler.preflightChecks,
 		reconciler.initializePhaseReconciler,
+		reconciler.resolveVersion,
 		reconciler.downloadManifests,
 		reconciler.load,
 		reconciler.fetch,
+		reconciler.checkSkippedCRDs,
+		reconciler.checkPermissions,
+		reconciler.checkServiceAccount,
+		reconciler.checkUpgradeApproval,
+		reconciler.checkUpgradeOrder,
+		reconciler.ensureNamespace,
 		reconciler.preInstall,
 		reconciler.install,
+		reconciler.applyAdditionalRBAC,
+		reconciler.applyAdditionalManifests,
+		reconciler.pruneManifestHistory,
 	}
 
 	res := reconcile.Result{}
@@ -203,9 +556,15 @@ func (r *GenericProviderReconciler) reconcileDelete(ctx context.Context, provide
 
 	log.Info("Deleting provider resources")
 
+	r.DownloadLimiter.forget(providerKey(provider))
+	sharedDownloadBackoff.reset(providerKey(provider))
+
 	reconciler := newPhaseReconciler(*r, provider, nil)
 	phases := []reconcilePhaseFn{
+		reconciler.checkDependentProviders,
 		reconciler.delete,
+		reconciler.deleteAdditionalRBAC,
+		reconciler.deleteManifestsConfigMaps,
 	}
 
 	res := reconcile.Result{}
@@ -227,6 +586,11 @@ func (r *GenericProviderReconciler) reconcileDelete(ctx context.Context, provide
 		}
 	}
 
+	// The components are not deleted in audit mode, so they are left to the operator once it may delete them.
+	if r.AuditMode {
+		return res, nil
+	}
+
 	controllerutil.RemoveFinalizer(provider.GetObject(), operatorv1.ProviderFinalizer)
 
 	return res, nil
@@ -286,3 +650,17 @@ func calculateHash(object interface{}) (string, error) {
 
 	return fmt.Sprintf("%x", hash.Sum(nil)), nil
 }
+
+// reconcileInterval returns how long to wait before reconciling the provider again: the provider
+// interval if set, otherwise the default one, falling back to the given interval if neither is set.
+func reconcileInterval(provider genericprovider.GenericProvider, defaultInterval, fallback time.Duration) time.Duration {
+	if interval := provider.GetSpec().ReconcileInterval; interval != nil {
+		return interval.Duration
+	}
+
+	if defaultInterval != 0 {
+		return defaultInterval
+	}
+
+	return fallback
+}
@@ -17,11 +17,16 @@ limitations under the License.
 package controller
 
 import (
+	"context"
+	"errors"
 	"reflect"
 	"testing"
+	"time"
 
 	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
@@ -29,6 +34,10 @@ import (
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
 	clusterctlv1 "sigs.k8s.io/cluster-api/cmd/clusterctl/api/v1alpha3"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	operatorv1 "sigs.k8s.io/cluster-api-operator/api/v1alpha2"
 	"sigs.k8s.io/cluster-api-operator/internal/controller/genericprovider"
@@ -324,6 +333,15 @@ func TestUpgradeDowngradeProvider(t *testing.T) {
 					return false
 				}
 
+				inventory := &clusterctlv1.Provider{}
+				if err := env.Get(ctx, clusterctlProviderName(provider), inventory); err != nil {
+					return false
+				}
+
+				if inventory.Version != tc.newVersion || inventory.Type != string(clusterctlv1.CoreProviderType) {
+					return false
+				}
+
 				for _, cond := range provider.GetStatus().Conditions {
 					if cond.Type == operatorv1.PreflightCheckCondition {
 						t.Log(t.Name(), provider.GetName(), cond)
@@ -646,3 +664,232 @@ func setupScheme() *runtime.Scheme {
 
 	return scheme
 }
+
+func TestReconcileInterval(t *testing.T) {
+	testCases := []struct {
+		name             string
+		providerInterval *metav1.Duration
+		defaultInterval  time.Duration
+		expectedInterval time.Duration
+	}{
+		{
+			name:             "nothing set, use fallback",
+			expectedInterval: preflightFailedRequeueAfter,
+		},
+		{
+			name:             "default set",
+			defaultInterval:  time.Minute,
+			expectedInterval: time.Minute,
+		},
+		{
+			name:             "provider overrides default",
+			providerInterval: &metav1.Duration{Duration: 5 * time.Minute},
+			defaultInterval:  time.Minute,
+			expectedInterval: 5 * time.Minute,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			provider := &genericprovider.CoreProviderWrapper{
+				CoreProvider: &operatorv1.CoreProvider{
+					Spec: operatorv1.CoreProviderSpec{
+						ProviderSpec: operatorv1.ProviderSpec{
+							ReconcileInterval: tc.providerInterval,
+						},
+					},
+				},
+			}
+
+			g.Expect(reconcileInterval(provider, tc.defaultInterval, preflightFailedRequeueAfter)).To(Equal(tc.expectedInterval))
+		})
+	}
+}
+
+func TestProviderChangedPredicate(t *testing.T) {
+	now := metav1.Now()
+
+	base := &operatorv1.CoreProvider{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "cluster-api",
+			Namespace:   "capi-system",
+			Generation:  1,
+			Labels:      map[string]string{"team": "a"},
+			Annotations: map[string]string{appliedSpecHashAnnotation: "hash"},
+		},
+	}
+
+	testCases := []struct {
+		name     string
+		mutate   func(*operatorv1.CoreProvider)
+		expected bool
+	}{
+		{
+			name: "label change is ignored",
+			mutate: func(p *operatorv1.CoreProvider) {
+				p.Labels["team"] = "b"
+			},
+		},
+		{
+			name: "annotation change is ignored",
+			mutate: func(p *operatorv1.CoreProvider) {
+				p.Annotations["note"] = "value"
+			},
+		},
+		{
+			name: "status change is ignored",
+			mutate: func(p *operatorv1.CoreProvider) {
+				p.Status.InstalledVersion = pointer.String("v1.4.3")
+			},
+		},
+		{
+			name: "applied spec hash update is ignored",
+			mutate: func(p *operatorv1.CoreProvider) {
+				p.Annotations[appliedSpecHashAnnotation] = "new-hash"
+			},
+		},
+		{
+			name: "spec change is reconciled",
+			mutate: func(p *operatorv1.CoreProvider) {
+				p.Spec.Version = "v1.4.3"
+				p.Generation++
+			},
+			expected: true,
+		},
+		{
+			name: "deletion is reconciled",
+			mutate: func(p *operatorv1.CoreProvider) {
+				p.DeletionTimestamp = &now
+			},
+			expected: true,
+		},
+		{
+			name: "approve upgrade annotation change is reconciled",
+			mutate: func(p *operatorv1.CoreProvider) {
+				p.Annotations[operatorv1.ApproveUpgradeAnnotation] = "v1.4.3"
+			},
+			expected: true,
+		},
+		{
+			name: "clearing the applied spec hash is reconciled",
+			mutate: func(p *operatorv1.CoreProvider) {
+				delete(p.Annotations, appliedSpecHashAnnotation)
+			},
+			expected: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			updated := base.DeepCopy()
+			tc.mutate(updated)
+
+			g.Expect(providerChangedPredicate().Update(event.UpdateEvent{ObjectOld: base, ObjectNew: updated})).To(Equal(tc.expected))
+		})
+	}
+
+	g := NewWithT(t)
+
+	g.Expect(providerChangedPredicate().Create(event.CreateEvent{Object: base})).To(BeTrue())
+	g.Expect(providerChangedPredicate().Delete(event.DeleteEvent{Object: base})).To(BeTrue())
+}
+
+func TestReconcileTimes(t *testing.T) {
+	lastSuccess := metav1.NewTime(time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	spec := operatorv1.CoreProviderSpec{
+		ProviderSpec: operatorv1.ProviderSpec{
+			Version: testCurrentVersion,
+		},
+	}
+
+	specHash, err := calculateHash(spec.ProviderSpec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name               string
+		finalizers         []string
+		failHealthCheck    bool
+		expectedSuccessful bool
+	}{
+		{
+			name:               "finalizer added, the phases are not completed",
+			expectedSuccessful: false,
+		},
+		{
+			name:               "provider installed, all the phases completed",
+			finalizers:         []string{operatorv1.ProviderFinalizer},
+			expectedSuccessful: true,
+		},
+		{
+			name:               "health check failed",
+			finalizers:         []string{operatorv1.ProviderFinalizer},
+			failHealthCheck:    true,
+			expectedSuccessful: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			provider := &operatorv1.CoreProvider{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "cluster-api",
+					Namespace:   "capi-system",
+					Finalizers:  tc.finalizers,
+					Annotations: map[string]string{appliedSpecHashAnnotation: specHash},
+				},
+				Spec: spec,
+				Status: operatorv1.CoreProviderStatus{
+					ProviderStatus: operatorv1.ProviderStatus{
+						LastSuccessfulReconcileTime: &lastSuccess,
+					},
+				},
+			}
+
+			scheme := setupScheme()
+			utilruntime.Must(apiextensionsv1.AddToScheme(scheme))
+			utilruntime.Must(appsv1.AddToScheme(scheme))
+
+			builder := fake.NewClientBuilder().WithScheme(scheme).WithObjects(provider).WithStatusSubresource(provider)
+			if tc.failHealthCheck {
+				builder = builder.WithInterceptorFuncs(interceptor.Funcs{
+					List: func(ctx context.Context, c client.WithWatch, list client.ObjectList, opts ...client.ListOption) error {
+						if _, ok := list.(*appsv1.DeploymentList); ok {
+							return errors.New("list failed")
+						}
+
+						return c.List(ctx, list, opts...)
+					},
+				})
+			}
+
+			fakeclient := builder.Build()
+
+			r := &GenericProviderReconciler{
+				Provider:     &operatorv1.CoreProvider{},
+				ProviderList: &operatorv1.CoreProviderList{},
+				Client:       fakeclient,
+			}
+
+			_, err = r.Reconcile(context.Background(), reconcile.Request{NamespacedName: client.ObjectKeyFromObject(provider)})
+			g.Expect(err != nil).To(Equal(tc.failHealthCheck), "%v", err)
+
+			g.Expect(fakeclient.Get(context.Background(), client.ObjectKeyFromObject(provider), provider)).To(Succeed())
+			g.Expect(provider.Status.LastReconcileTime).ToNot(BeNil())
+
+			if tc.expectedSuccessful {
+				g.Expect(provider.Status.LastSuccessfulReconcileTime).To(Equal(provider.Status.LastReconcileTime))
+			} else {
+				g.Expect(provider.Status.LastSuccessfulReconcileTime.Equal(&lastSuccess)).To(BeTrue())
+			}
+		})
+	}
+}
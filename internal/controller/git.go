@@ -0,0 +1,281 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	operatorv1 "sigs.k8s.io/cluster-api-operator/api/v1alpha2"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+)
+
+const (
+	// gitExecutable is the git binary used for fetching manifests from Git repositories.
+	gitExecutable = "git"
+
+	gitKnownHostsKey = "known_hosts"
+	gitTokenKey      = "token"
+
+	defaultGitUsername = "git"
+)
+
+// gitAllowedProtocols are the protocols git is allowed to fetch the provider repositories with.
+var gitAllowedProtocols = []string{"https", "ssh"}
+
+// isGitSource returns true if the provider components and metadata are fetched from a Git repository.
+func isGitSource(spec operatorv1.ProviderSpec) bool {
+	return spec.FetchConfig != nil && spec.FetchConfig.Git != nil
+}
+
+// gitRef returns the ref fetched from the Git repository, which defaults to the provider version.
+func gitRef(spec operatorv1.ProviderSpec) string {
+	if spec.FetchConfig.Git.Ref != "" {
+		return spec.FetchConfig.Git.Ref
+	}
+
+	return spec.Version
+}
+
+// ValidateGitSource checks that the Git source of the provider spec can be safely passed to git: the URL uses
+// one of the allowed protocols, and neither the URL nor the ref can be mistaken for an option. It returns the
+// message describing the problem, or an empty string if the source is valid.
+func ValidateGitSource(spec operatorv1.ProviderSpec) string {
+	source := spec.FetchConfig.Git
+
+	if strings.HasPrefix(source.URL, "-") {
+		return fmt.Sprintf("Git URL %q can't start with \"-\"", source.URL)
+	}
+
+	if ref := gitRef(spec); strings.HasPrefix(ref, "-") {
+		return fmt.Sprintf("Git ref %q can't start with \"-\"", ref)
+	}
+
+	protocol := gitURLProtocol(source.URL)
+	for _, allowed := range gitAllowedProtocols {
+		if protocol == allowed {
+			return ""
+		}
+	}
+
+	return fmt.Sprintf("Git URL %q uses protocol %q, only %s are allowed", source.URL, protocol, strings.Join(gitAllowedProtocols, " and "))
+}
+
+// gitURLProtocol returns the protocol git uses to fetch the URL: the transport of a transport::address URL,
+// the scheme of a URL, ssh for the scp-like syntax such as git@github.com:owner/repo.git, or file for a path.
+func gitURLProtocol(url string) string {
+	if transport, _, ok := strings.Cut(url, "::"); ok {
+		return transport
+	}
+
+	if scheme, _, ok := strings.Cut(url, "://"); ok {
+		return strings.ToLower(scheme)
+	}
+
+	// Like git, only treat the URL as scp-like if there's no slash before the colon.
+	if host, _, ok := strings.Cut(url, ":"); ok && host != "" && !strings.Contains(host, "/") {
+		return "ssh"
+	}
+
+	return "file"
+}
+
+// fetchGitManifests fetches the ref of the provider Git repository without its history, and reads the
+// metadata and components files from it. Fetch errors are reported in the preflight check condition.
+func (p *phaseReconciler) fetchGitManifests(ctx context.Context) ([]byte, []byte, error) {
+	spec := p.provider.GetSpec()
+	source := spec.FetchConfig.Git
+	ref := gitRef(spec)
+
+	// The preflight checks already rejected an invalid source, check it again before running git.
+	if msg := ValidateGitSource(spec); msg != "" {
+		return nil, nil, wrapGitError(fmt.Errorf("invalid Git source for provider %q: %s", p.provider.GetName(), msg))
+	}
+
+	if _, err := exec.LookPath(gitExecutable); err != nil {
+		return nil, nil, wrapGitError(fmt.Errorf("cannot fetch provider %q from Git: %w", p.provider.GetName(), err))
+	}
+
+	dir, err := os.MkdirTemp("", "provider-git-")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	env, err := p.gitEnv(ctx, dir)
+	if err != nil {
+		return nil, nil, wrapGitError(fmt.Errorf("failed to load Git credentials for provider %q: %w", p.provider.GetName(), err))
+	}
+
+	repoDir := filepath.Join(dir, "repo")
+
+	if _, err := runGit(ctx, "", env, "init", "--quiet", repoDir); err != nil {
+		return nil, nil, wrapGitError(fmt.Errorf("failed to initialize Git repository for provider %q: %w", p.provider.GetName(), err))
+	}
+
+	if _, err := runGit(ctx, repoDir, env, "fetch", "--quiet", "--depth=1", "--no-tags", "--", source.URL, ref); err != nil {
+		return nil, nil, wrapGitError(fmt.Errorf("failed to fetch ref %q from %q for provider %q: %w", ref, source.URL, p.provider.GetName(), err))
+	}
+
+	componentsNames := []string{tarballComponentsFileName(p.provider), defaultComponentsFileName}
+	if spec.FetchConfig.ComponentsPath != "" {
+		componentsNames = []string{spec.FetchConfig.ComponentsPath}
+	}
+
+	metadata, err := readGitFile(ctx, repoDir, env, source.Path, []string{p.metadataPath()})
+	if err != nil {
+		return nil, nil, wrapGitError(fmt.Errorf("failed to read metadata from %q at ref %q for provider %q: %w", source.URL, ref, p.provider.GetName(), err))
+	}
+
+	components, err := readGitFile(ctx, repoDir, env, source.Path, componentsNames)
+	if err != nil {
+		return nil, nil, wrapGitError(fmt.Errorf("failed to read components from %q at ref %q for provider %q: %w", source.URL, ref, p.provider.GetName(), err))
+	}
+
+	return metadata, components, nil
+}
+
+// gitEnv returns the environment for the git commands, configuring the credentials from the secret
+// referenced by the Git source. Files holding the credentials are written to dir.
+func (p *phaseReconciler) gitEnv(ctx context.Context, dir string) ([]string, error) {
+	env := []string{
+		// Never wait for credentials to be typed in.
+		"GIT_TERMINAL_PROMPT=0",
+		// Whatever the URL, never fetch with other protocols, e.g. ext or file.
+		"GIT_ALLOW_PROTOCOL=" + strings.Join(gitAllowedProtocols, ":"),
+		"HOME=" + dir,
+	}
+
+	source := p.provider.GetSpec().FetchConfig.Git
+	if source.SecretRef == nil {
+		return env, nil
+	}
+
+	secret := &corev1.Secret{}
+	key := types.NamespacedName{Namespace: source.SecretRef.Namespace, Name: source.SecretRef.Name}
+
+	if key.Namespace == "" {
+		key.Namespace = p.provider.GetNamespace()
+	}
+
+	if err := p.ctrlClient.Get(ctx, key, secret); err != nil {
+		return nil, fmt.Errorf("failed to get secret %s: %w", key, err)
+	}
+
+	credentialsEnv, err := gitCredentialsEnv(secret.Data, dir)
+	if err != nil {
+		return nil, fmt.Errorf("invalid secret %s: %w", key, err)
+	}
+
+	return append(env, credentialsEnv...), nil
+}
+
+// gitCredentialsEnv returns the environment configuring git to authenticate with an SSH key, or with
+// a token sent as basic auth credentials over HTTPS.
+func gitCredentialsEnv(data map[string][]byte, dir string) ([]string, error) {
+	if privateKey, ok := data[corev1.SSHAuthPrivateKey]; ok {
+		knownHosts, ok := data[gitKnownHostsKey]
+		if !ok {
+			return nil, fmt.Errorf("%q must be set together with %q to verify the server", gitKnownHostsKey, corev1.SSHAuthPrivateKey)
+		}
+
+		keyFile := filepath.Join(dir, "id")
+		if err := os.WriteFile(keyFile, privateKey, 0o600); err != nil {
+			return nil, err
+		}
+
+		knownHostsFile := filepath.Join(dir, gitKnownHostsKey)
+		if err := os.WriteFile(knownHostsFile, knownHosts, 0o600); err != nil {
+			return nil, err
+		}
+
+		return []string{
+			fmt.Sprintf("GIT_SSH_COMMAND=ssh -i %s -o IdentitiesOnly=yes -o UserKnownHostsFile=%s -o StrictHostKeyChecking=yes", keyFile, knownHostsFile),
+		}, nil
+	}
+
+	if token, ok := data[gitTokenKey]; ok {
+		username := defaultGitUsername
+		if u, ok := data[corev1.BasicAuthUsernameKey]; ok {
+			username = string(u)
+		}
+
+		credentials := base64.StdEncoding.EncodeToString([]byte(username + ":" + strings.TrimSpace(string(token))))
+
+		// Pass the header through the environment, so it doesn't show up in the command line.
+		return []string{
+			"GIT_CONFIG_COUNT=1",
+			"GIT_CONFIG_KEY_0=http.extraHeader",
+			"GIT_CONFIG_VALUE_0=Authorization: Basic " + credentials,
+		}, nil
+	}
+
+	return nil, fmt.Errorf("either %q or %q must be set", corev1.SSHAuthPrivateKey, gitTokenKey)
+}
+
+// readGitFile reads the first of the named files that exists in the directory of the fetched ref.
+func readGitFile(ctx context.Context, repoDir string, env []string, dir string, names []string) ([]byte, error) {
+	for _, name := range names {
+		content, err := runGit(ctx, repoDir, env, "cat-file", "blob", "FETCH_HEAD:"+path.Join(dir, name))
+		if err == nil {
+			return content, nil
+		}
+	}
+
+	return nil, fmt.Errorf("none of %q found in %q", names, path.Join("/", dir))
+}
+
+// runGit runs a git command in dir, returning its output. Errors include what git wrote to stderr.
+func runGit(ctx context.Context, dir string, env []string, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, gitExecutable, args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), env...)
+
+	var stdout, stderr bytes.Buffer
+
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%w: %s", err, msg)
+		}
+
+		return nil, err
+	}
+
+	return stdout.Bytes(), nil
+}
+
+// wrapGitError wraps a Git fetch error so it's reported in the preflight check condition.
+func wrapGitError(err error) error {
+	return &PhaseError{
+		Err:      err,
+		Type:     operatorv1.PreflightCheckCondition,
+		Reason:   operatorv1.GitFetchErrorReason,
+		Severity: clusterv1.ConditionSeverityError,
+	}
+}
@@ -0,0 +1,148 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	configclient "sigs.k8s.io/cluster-api/cmd/clusterctl/client/config"
+	"sigs.k8s.io/cluster-api/cmd/clusterctl/client/repository"
+)
+
+const (
+	gitlabPackagesAPIPackages = "packages"
+	gitlabPackagesAPIGeneric  = "generic"
+
+	gitlabGetFileTimeout = 30 * time.Second
+)
+
+// gitLabRepository provides support for providers hosted on GitLab using an injected http client,
+// so that custom CA bundles can be trusted when fetching the provider artifacts.
+// inspired by https://github.com/kubernetes-sigs/cluster-api/blob/v1.5.1/cmd/clusterctl/client/repository/repository_gitlab.go
+type gitLabRepository struct {
+	httpClient     *http.Client
+	host           string
+	projectSlug    string
+	packageName    string
+	defaultVersion string
+	rootPath       string
+	componentsPath string
+}
+
+var _ repository.Repository = &gitLabRepository{}
+
+// newGitLabRepository returns a gitLabRepository implementation using the given http client.
+func newGitLabRepository(providerConfig configclient.Provider, httpClient *http.Client) (repository.Repository, error) {
+	if httpClient == nil {
+		return nil, fmt.Errorf("invalid arguments: httpClient can't be nil")
+	}
+
+	rURL, err := url.Parse(providerConfig.URL())
+	if err != nil {
+		return nil, fmt.Errorf("invalid url: %w", err)
+	}
+
+	urlSplit := strings.Split(strings.TrimPrefix(rURL.RawPath, "/"), "/")
+
+	// Check if the url is a GitLab repository.
+	if rURL.Scheme != httpsScheme ||
+		len(urlSplit) != 9 ||
+		!strings.HasPrefix(rURL.RawPath, gitlabPackagesAPIPrefix) ||
+		urlSplit[4] != gitlabPackagesAPIPackages ||
+		urlSplit[5] != gitlabPackagesAPIGeneric {
+		return nil, fmt.Errorf("invalid url: a GitLab repository url should be in the form https://{host}/api/v4/projects/{projectSlug}/packages/generic/{packageName}/{defaultVersion}/{componentsPath}")
+	}
+
+	return &gitLabRepository{
+		httpClient:     httpClient,
+		host:           rURL.Host,
+		projectSlug:    urlSplit[3],
+		packageName:    urlSplit[6],
+		defaultVersion: urlSplit[7],
+		rootPath:       ".",
+		componentsPath: urlSplit[8],
+	}, nil
+}
+
+// DefaultVersion returns defaultVersion field of gitLabRepository struct.
+func (g *gitLabRepository) DefaultVersion() string {
+	return g.defaultVersion
+}
+
+// GetVersions returns the list of versions that are available in a provider repository.
+func (g *gitLabRepository) GetVersions() ([]string, error) {
+	return []string{g.defaultVersion}, nil
+}
+
+// RootPath returns rootPath field of gitLabRepository struct.
+func (g *gitLabRepository) RootPath() string {
+	return g.rootPath
+}
+
+// ComponentsPath returns componentsPath field of gitLabRepository struct.
+func (g *gitLabRepository) ComponentsPath() string {
+	return g.componentsPath
+}
+
+// GetFile returns a file for a given provider version.
+func (g *gitLabRepository) GetFile(version, path string) ([]byte, error) {
+	url := fmt.Sprintf(
+		"https://%s/api/v4/projects/%s/packages/generic/%s/%s/%s",
+		g.host,
+		g.projectSlug,
+		g.packageName,
+		version,
+		path,
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), gitlabGetFileTimeout)
+	defer cancel()
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, http.NoBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file %q with version %q from %q: failed to create request: %w", path, version, url, err)
+	}
+
+	response, err := g.httpClient.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file %q with version %q from %q: %w", path, version, url, err)
+	}
+
+	defer response.Body.Close()
+
+	// The generic packages are published per version, so a missing file usually means a missing version.
+	if response.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("failed to get file %q with version %q from %q, got %d: %w", path, version, url, response.StatusCode, errVersionNotFound)
+	}
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to get file %q with version %q from %q, got %d", path, version, url, response.StatusCode)
+	}
+
+	content, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file %q with version %q from %q: %w", path, version, url, err)
+	}
+
+	return content, nil
+}
@@ -0,0 +1,209 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	operatorv1 "sigs.k8s.io/cluster-api-operator/api/v1alpha2"
+	"sigs.k8s.io/cluster-api-operator/internal/controller/genericprovider"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// reconcileCRDsEstablished reflects whether all the provider CustomResourceDefinitions are established into the
+// CRDsEstablished condition, requeuing until all of them are.
+func (r *GenericProviderReconciler) reconcileCRDsEstablished(ctx context.Context, provider genericprovider.GenericProvider) (ctrl.Result, error) {
+	log := ctrl.LoggerFrom(ctx)
+
+	crds := &apiextensionsv1.CustomResourceDefinitionList{}
+	if err := r.Client.List(ctx, crds,
+		client.MatchingLabels{clusterv1.ProviderNameLabel: clusterctlProviderName(provider).Name},
+	); err != nil {
+		return ctrl.Result{}, fmt.Errorf("failed to list provider CRDs: %w", err)
+	}
+
+	notEstablished := []string{}
+	timedOut := false
+
+	for _, crd := range crds.Items {
+		if isCRDEstablished(&crd) {
+			continue
+		}
+
+		notEstablished = append(notEstablished, crd.Name)
+
+		if time.Since(crd.CreationTimestamp.Time) > crdsEstablishedTimeout {
+			timedOut = true
+		}
+	}
+
+	if len(notEstablished) == 0 {
+		conditions.MarkTrue(provider, operatorv1.CRDsEstablishedCondition)
+
+		return ctrl.Result{}, nil
+	}
+
+	sort.Strings(notEstablished)
+
+	reason, severity := operatorv1.WaitingForCRDsEstablishedReason, clusterv1.ConditionSeverityInfo
+	if timedOut {
+		reason, severity = operatorv1.CRDsEstablishTimeoutReason, clusterv1.ConditionSeverityError
+	}
+
+	log.Info("Waiting for provider CRDs to become established", "crds", notEstablished)
+	conditions.Set(provider, conditions.FalseCondition(operatorv1.CRDsEstablishedCondition, reason, severity,
+		"CustomResourceDefinitions not established: %s", strings.Join(notEstablished, ", ")))
+
+	return ctrl.Result{RequeueAfter: reconcileInterval(provider, r.ReconcileInterval, healthCheckRequeueAfter)}, nil
+}
+
+// isCRDEstablished returns true if the CustomResourceDefinition has the Established condition.
+func isCRDEstablished(crd *apiextensionsv1.CustomResourceDefinition) bool {
+	for _, cond := range crd.Status.Conditions {
+		if cond.Type == apiextensionsv1.Established && cond.Status == apiextensionsv1.ConditionTrue {
+			return true
+		}
+	}
+
+	return false
+}
+
+// reconcileHealth reflects the availability of the provider Deployments into the ProviderAvailable condition,
+// requeuing until all of them are available.
+func (r *GenericProviderReconciler) reconcileHealth(ctx context.Context, provider genericprovider.GenericProvider) (ctrl.Result, error) {
+	log := ctrl.LoggerFrom(ctx)
+
+	deployments := &appsv1.DeploymentList{}
+	if err := r.Client.List(ctx, deployments,
+		client.InNamespace(provider.GetNamespace()),
+		client.MatchingLabels{clusterv1.ProviderNameLabel: clusterctlProviderName(provider).Name},
+	); err != nil {
+		return ctrl.Result{}, fmt.Errorf("failed to list provider deployments: %w", err)
+	}
+
+	for i := range deployments.Items {
+		deployment := &deployments.Items[i]
+
+		if isDeploymentAvailable(deployment) {
+			continue
+		}
+
+		reason, severity := operatorv1.DeploymentUnavailableReason, clusterv1.ConditionSeverityWarning
+		if isDeploymentProgressDeadlineExceeded(deployment) {
+			reason, severity = operatorv1.DeploymentProgressDeadlineExceededReason, clusterv1.ConditionSeverityError
+		}
+
+		message := fmt.Sprintf("Deployment %s is not available (%d/%d replicas available)",
+			client.ObjectKeyFromObject(deployment), deployment.Status.AvailableReplicas, desiredReplicas(deployment))
+
+		containerStatus, err := r.lastContainerStatus(ctx, deployment)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+
+		if containerStatus != "" {
+			message += ": " + containerStatus
+		}
+
+		log.Info("Waiting for provider deployment to become available", "deployment", client.ObjectKeyFromObject(deployment))
+		conditions.Set(provider, conditions.FalseCondition(operatorv1.ProviderAvailableCondition, reason, severity, message))
+
+		return ctrl.Result{RequeueAfter: reconcileInterval(provider, r.ReconcileInterval, healthCheckRequeueAfter)}, nil
+	}
+
+	conditions.MarkTrue(provider, operatorv1.ProviderAvailableCondition)
+
+	return ctrl.Result{}, nil
+}
+
+// lastContainerStatus returns a description of the last known state of the first failing container of the
+// Deployment pods, or an empty string if there are none.
+func (r *GenericProviderReconciler) lastContainerStatus(ctx context.Context, deployment *appsv1.Deployment) (string, error) {
+	selector, err := metav1.LabelSelectorAsSelector(deployment.Spec.Selector)
+	if err != nil {
+		return "", fmt.Errorf("invalid selector for deployment %s: %w", client.ObjectKeyFromObject(deployment), err)
+	}
+
+	pods := &corev1.PodList{}
+	if err := r.Client.List(ctx, pods, client.InNamespace(deployment.Namespace), client.MatchingLabelsSelector{Selector: selector}); err != nil {
+		return "", fmt.Errorf("failed to list pods for deployment %s: %w", client.ObjectKeyFromObject(deployment), err)
+	}
+
+	for _, pod := range pods.Items {
+		for _, cs := range pod.Status.ContainerStatuses {
+			if cs.State.Waiting != nil && cs.State.Waiting.Reason != "" {
+				if cs.LastTerminationState.Terminated != nil {
+					return fmt.Sprintf("pod %s container %s is waiting: %s, last terminated: %s (exit code %d)",
+						pod.Name, cs.Name, cs.State.Waiting.Reason,
+						cs.LastTerminationState.Terminated.Reason, cs.LastTerminationState.Terminated.ExitCode), nil
+				}
+
+				return fmt.Sprintf("pod %s container %s is waiting: %s %s", pod.Name, cs.Name, cs.State.Waiting.Reason, cs.State.Waiting.Message), nil
+			}
+
+			if cs.State.Terminated != nil {
+				return fmt.Sprintf("pod %s container %s terminated: %s (exit code %d)",
+					pod.Name, cs.Name, cs.State.Terminated.Reason, cs.State.Terminated.ExitCode), nil
+			}
+		}
+
+		for _, cond := range pod.Status.Conditions {
+			if cond.Type == corev1.PodScheduled && cond.Status == corev1.ConditionFalse {
+				return fmt.Sprintf("pod %s is not scheduled: %s", pod.Name, cond.Message), nil
+			}
+		}
+	}
+
+	return "", nil
+}
+
+// isDeploymentAvailable returns true if the latest Deployment generation has all the desired replicas available.
+func isDeploymentAvailable(deployment *appsv1.Deployment) bool {
+	return deployment.Status.ObservedGeneration >= deployment.Generation &&
+		deployment.Status.AvailableReplicas >= desiredReplicas(deployment)
+}
+
+// isDeploymentProgressDeadlineExceeded returns true if the Deployment failed to progress within its deadline.
+func isDeploymentProgressDeadlineExceeded(deployment *appsv1.Deployment) bool {
+	for _, cond := range deployment.Status.Conditions {
+		if cond.Type == appsv1.DeploymentProgressing && cond.Status == corev1.ConditionFalse && cond.Reason == "ProgressDeadlineExceeded" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// desiredReplicas returns the number of desired Deployment replicas, which defaults to 1.
+func desiredReplicas(deployment *appsv1.Deployment) int32 {
+	if deployment.Spec.Replicas == nil {
+		return 1
+	}
+
+	return *deployment.Spec.Replicas
+}
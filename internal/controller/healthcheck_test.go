@@ -0,0 +1,261 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/utils/pointer"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	operatorv1 "sigs.k8s.io/cluster-api-operator/api/v1alpha2"
+	"sigs.k8s.io/cluster-api-operator/internal/controller/genericprovider"
+)
+
+func TestReconcileHealth(t *testing.T) {
+	labels := map[string]string{
+		clusterv1.ProviderNameLabel: "infrastructure-docker",
+		"control-plane":             "controller-manager",
+	}
+
+	newDeployment := func(availableReplicas int32, conds ...appsv1.DeploymentCondition) *appsv1.Deployment {
+		return &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "capd-controller-manager",
+				Namespace: "capd-system",
+				Labels:    labels,
+			},
+			Spec: appsv1.DeploymentSpec{
+				Replicas: pointer.Int32(1),
+				Selector: &metav1.LabelSelector{MatchLabels: labels},
+			},
+			Status: appsv1.DeploymentStatus{
+				AvailableReplicas: availableReplicas,
+				Conditions:        conds,
+			},
+		}
+	}
+
+	crashingPod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "capd-controller-manager-1234",
+			Namespace: "capd-system",
+			Labels:    labels,
+		},
+		Status: corev1.PodStatus{
+			ContainerStatuses: []corev1.ContainerStatus{{
+				Name: "manager",
+				State: corev1.ContainerState{
+					Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"},
+				},
+				LastTerminationState: corev1.ContainerState{
+					Terminated: &corev1.ContainerStateTerminated{Reason: "Error", ExitCode: 1},
+				},
+			}},
+		},
+	}
+
+	testCases := []struct {
+		name             string
+		objs             []client.Object
+		expectedRequeue  bool
+		expectedStatus   corev1.ConditionStatus
+		expectedReason   string
+		expectedSeverity clusterv1.ConditionSeverity
+		expectedMessage  string
+	}{
+		{
+			name:           "no deployments",
+			expectedStatus: corev1.ConditionTrue,
+		},
+		{
+			name:           "deployment available",
+			objs:           []client.Object{newDeployment(1)},
+			expectedStatus: corev1.ConditionTrue,
+		},
+		{
+			name:             "deployment not available",
+			objs:             []client.Object{newDeployment(0)},
+			expectedRequeue:  true,
+			expectedStatus:   corev1.ConditionFalse,
+			expectedReason:   operatorv1.DeploymentUnavailableReason,
+			expectedSeverity: clusterv1.ConditionSeverityWarning,
+			expectedMessage:  "Deployment capd-system/capd-controller-manager is not available (0/1 replicas available)",
+		},
+		{
+			name: "deployment never becomes available",
+			objs: []client.Object{
+				newDeployment(0, appsv1.DeploymentCondition{
+					Type:   appsv1.DeploymentProgressing,
+					Status: corev1.ConditionFalse,
+					Reason: "ProgressDeadlineExceeded",
+				}),
+				crashingPod,
+			},
+			expectedRequeue:  true,
+			expectedStatus:   corev1.ConditionFalse,
+			expectedReason:   operatorv1.DeploymentProgressDeadlineExceededReason,
+			expectedSeverity: clusterv1.ConditionSeverityError,
+			expectedMessage: "Deployment capd-system/capd-controller-manager is not available (0/1 replicas available): " +
+				"pod capd-controller-manager-1234 container manager is waiting: CrashLoopBackOff, last terminated: Error (exit code 1)",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			provider := &genericprovider.InfrastructureProviderWrapper{
+				InfrastructureProvider: &operatorv1.InfrastructureProvider{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "docker",
+						Namespace: "capd-system",
+					},
+				},
+			}
+
+			r := &GenericProviderReconciler{
+				Client: fake.NewClientBuilder().WithObjects(tc.objs...).Build(),
+			}
+
+			res, err := r.reconcileHealth(context.TODO(), provider)
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(res.RequeueAfter > 0).To(Equal(tc.expectedRequeue))
+
+			cond := conditions.Get(provider, operatorv1.ProviderAvailableCondition)
+			g.Expect(cond).ToNot(BeNil())
+			g.Expect(cond.Status).To(Equal(tc.expectedStatus))
+			g.Expect(cond.Reason).To(Equal(tc.expectedReason))
+			g.Expect(cond.Severity).To(Equal(tc.expectedSeverity))
+			g.Expect(cond.Message).To(Equal(tc.expectedMessage))
+		})
+	}
+}
+
+func TestReconcileCRDsEstablished(t *testing.T) {
+	newCRD := func(name string, age time.Duration, established bool) *apiextensionsv1.CustomResourceDefinition {
+		crd := &apiextensionsv1.CustomResourceDefinition{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              name,
+				Labels:            map[string]string{clusterv1.ProviderNameLabel: "infrastructure-docker"},
+				CreationTimestamp: metav1.NewTime(time.Now().Add(-age)),
+			},
+		}
+
+		if established {
+			crd.Status.Conditions = []apiextensionsv1.CustomResourceDefinitionCondition{{
+				Type:   apiextensionsv1.Established,
+				Status: apiextensionsv1.ConditionTrue,
+			}}
+		}
+
+		return crd
+	}
+
+	testCases := []struct {
+		name             string
+		objs             []client.Object
+		expectedRequeue  bool
+		expectedStatus   corev1.ConditionStatus
+		expectedReason   string
+		expectedSeverity clusterv1.ConditionSeverity
+		expectedMessage  string
+	}{
+		{
+			name:           "no CRDs",
+			expectedStatus: corev1.ConditionTrue,
+		},
+		{
+			name: "all CRDs established",
+			objs: []client.Object{
+				newCRD("dockerclusters.infrastructure.cluster.x-k8s.io", time.Second, true),
+				newCRD("dockermachines.infrastructure.cluster.x-k8s.io", time.Second, true),
+			},
+			expectedStatus: corev1.ConditionTrue,
+		},
+		{
+			name: "CRDs not established yet",
+			objs: []client.Object{
+				newCRD("dockermachines.infrastructure.cluster.x-k8s.io", time.Second, false),
+				newCRD("dockerclusters.infrastructure.cluster.x-k8s.io", time.Second, false),
+				newCRD("dockermachinepools.infrastructure.cluster.x-k8s.io", time.Second, true),
+			},
+			expectedRequeue:  true,
+			expectedStatus:   corev1.ConditionFalse,
+			expectedReason:   operatorv1.WaitingForCRDsEstablishedReason,
+			expectedSeverity: clusterv1.ConditionSeverityInfo,
+			expectedMessage: "CustomResourceDefinitions not established: " +
+				"dockerclusters.infrastructure.cluster.x-k8s.io, dockermachines.infrastructure.cluster.x-k8s.io",
+		},
+		{
+			name: "CRD not established in time",
+			objs: []client.Object{
+				newCRD("dockerclusters.infrastructure.cluster.x-k8s.io", time.Hour, false),
+			},
+			expectedRequeue:  true,
+			expectedStatus:   corev1.ConditionFalse,
+			expectedReason:   operatorv1.CRDsEstablishTimeoutReason,
+			expectedSeverity: clusterv1.ConditionSeverityError,
+			expectedMessage:  "CustomResourceDefinitions not established: dockerclusters.infrastructure.cluster.x-k8s.io",
+		},
+	}
+
+	scheme := runtime.NewScheme()
+	utilruntime.Must(apiextensionsv1.AddToScheme(scheme))
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			provider := &genericprovider.InfrastructureProviderWrapper{
+				InfrastructureProvider: &operatorv1.InfrastructureProvider{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "docker",
+						Namespace: "capd-system",
+					},
+				},
+			}
+
+			r := &GenericProviderReconciler{
+				Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(tc.objs...).Build(),
+			}
+
+			res, err := r.reconcileCRDsEstablished(context.TODO(), provider)
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(res.RequeueAfter > 0).To(Equal(tc.expectedRequeue))
+
+			cond := conditions.Get(provider, operatorv1.CRDsEstablishedCondition)
+			g.Expect(cond).ToNot(BeNil())
+			g.Expect(cond.Status).To(Equal(tc.expectedStatus))
+			g.Expect(cond.Reason).To(Equal(tc.expectedReason))
+			g.Expect(cond.Severity).To(Equal(tc.expectedSeverity))
+			g.Expect(cond.Message).To(Equal(tc.expectedMessage))
+		})
+	}
+}
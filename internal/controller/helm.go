@@ -0,0 +1,262 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	operatorv1 "sigs.k8s.io/cluster-api-operator/api/v1alpha2"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+)
+
+const (
+	// helmExecutable is the helm binary used for rendering the components from Helm charts.
+	helmExecutable = "helm"
+
+	defaultHelmValuesKey = "values.yaml"
+
+	ociScheme = "oci://"
+)
+
+// isHelmSource returns true if the provider components are rendered from a Helm chart.
+func isHelmSource(spec operatorv1.ProviderSpec) bool {
+	return spec.FetchConfig != nil && spec.FetchConfig.Helm != nil
+}
+
+// helmChartVersion returns the version of the Helm chart, which defaults to the provider version.
+func helmChartVersion(spec operatorv1.ProviderSpec) string {
+	if spec.FetchConfig.Helm.Version != "" {
+		return spec.FetchConfig.Helm.Version
+	}
+
+	return spec.Version
+}
+
+// validateHelmSource checks the Helm source of the fetch configuration, returning a message
+// describing the first problem found, if any.
+func validateHelmSource(fetchConfig *operatorv1.FetchConfiguration) string {
+	source := fetchConfig.Helm
+
+	if source.RepoURL == "" || source.Chart == "" {
+		return "RepoURL and Chart must be provided for the Helm chart"
+	}
+
+	// The components are the rendered templates, there's no file to look up in the chart.
+	if fetchConfig.ComponentsPath != "" {
+		return "ComponentsPath can't be used with Helm"
+	}
+
+	if source.ValuesFrom != nil && (source.ValuesFrom.ConfigMap == nil) == (source.ValuesFrom.Secret == nil) {
+		return "Exactly one of ConfigMap and Secret must be provided for the Helm values"
+	}
+
+	return ""
+}
+
+// ValidateHelmSource checks that the Helm source of the provider spec can be safely passed to helm: the repository
+// URL is an HTTPS or OCI one, and neither the URL, the chart nor the version can be mistaken for an option. It
+// returns the message describing the problem, or an empty string if the source is valid.
+func ValidateHelmSource(spec operatorv1.ProviderSpec) string {
+	source := spec.FetchConfig.Helm
+
+	for _, arg := range []struct{ name, value string }{
+		{"Helm repository URL", source.RepoURL},
+		{"Helm chart", source.Chart},
+		{"Helm chart version", helmChartVersion(spec)},
+	} {
+		if strings.HasPrefix(arg.value, "-") {
+			return fmt.Sprintf("%s %q can't start with \"-\"", arg.name, arg.value)
+		}
+	}
+
+	if !strings.HasPrefix(source.RepoURL, httpsScheme+"://") && !strings.HasPrefix(source.RepoURL, ociScheme) {
+		return fmt.Sprintf("Helm repository URL %q must start with %s:// or %s", source.RepoURL, httpsScheme, ociScheme)
+	}
+
+	return ""
+}
+
+// fetchHelmManifests pulls the provider Helm chart, reads the metadata file from its root and renders
+// its templates with the referenced values into the components. Pull and templating errors are
+// reported in the preflight check condition.
+func (p *phaseReconciler) fetchHelmManifests(ctx context.Context) ([]byte, []byte, error) {
+	spec := p.provider.GetSpec()
+	source := spec.FetchConfig.Helm
+	version := helmChartVersion(spec)
+
+	// The preflight checks already rejected an invalid source, check it again before running helm.
+	if msg := ValidateHelmSource(spec); msg != "" {
+		return nil, nil, wrapHelmError(fmt.Errorf("invalid Helm source for provider %q: %s", p.provider.GetName(), msg))
+	}
+
+	if _, err := exec.LookPath(helmExecutable); err != nil {
+		return nil, nil, wrapHelmError(fmt.Errorf("cannot render provider %q from a Helm chart: %w", p.provider.GetName(), err))
+	}
+
+	dir, err := os.MkdirTemp("", "provider-helm-")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	// Keep the helm configuration and caches away from the, possibly read-only, operator home.
+	env := []string{"HOME=" + dir}
+
+	chartsDir := filepath.Join(dir, "charts")
+
+	if _, err := runHelm(ctx, env, helmPullArgs(source, version, chartsDir)...); err != nil {
+		return nil, nil, wrapHelmError(fmt.Errorf("failed to pull chart %q version %q from %q for provider %q: %w", source.Chart, version, source.RepoURL, p.provider.GetName(), err))
+	}
+
+	chartDir := filepath.Join(chartsDir, path.Base(source.Chart))
+
+	metadata, err := os.ReadFile(filepath.Join(chartDir, filepath.FromSlash(p.metadataPath())))
+	if err != nil {
+		return nil, nil, wrapHelmError(fmt.Errorf("failed to read metadata from chart %q version %q for provider %q: %w", source.Chart, version, p.provider.GetName(), err))
+	}
+
+	args := []string{"template", p.provider.GetName(), chartDir, "--namespace", p.provider.GetNamespace(), "--include-crds"}
+
+	if source.ValuesFrom != nil {
+		values, err := p.helmValues(ctx)
+		if err != nil {
+			return nil, nil, wrapHelmError(fmt.Errorf("failed to load Helm values for provider %q: %w", p.provider.GetName(), err))
+		}
+
+		valuesFile := filepath.Join(dir, defaultHelmValuesKey)
+		if err := os.WriteFile(valuesFile, values, 0o600); err != nil {
+			return nil, nil, err
+		}
+
+		args = append(args, "--values", valuesFile)
+	}
+
+	components, err := runHelm(ctx, env, args...)
+	if err != nil {
+		return nil, nil, wrapHelmError(fmt.Errorf("failed to render chart %q version %q for provider %q: %w", source.Chart, version, p.provider.GetName(), err))
+	}
+
+	return metadata, components, nil
+}
+
+// helmPullArgs returns the arguments for pulling and unpacking the chart into dir, either from
+// a chart repository or from an OCI registry. The chart is passed after "--", so it's never parsed
+// as an option.
+func helmPullArgs(source *operatorv1.HelmSource, version, dir string) []string {
+	args := []string{"pull", "--version", version, "--untar", "--untardir", dir}
+
+	if strings.HasPrefix(source.RepoURL, ociScheme) {
+		return append(args, "--", strings.TrimSuffix(source.RepoURL, "/")+"/"+source.Chart)
+	}
+
+	return append(args, "--repo", source.RepoURL, "--", source.Chart)
+}
+
+// helmValues returns the values referenced by the Helm source, from a config map or a secret.
+func (p *phaseReconciler) helmValues(ctx context.Context) ([]byte, error) {
+	ref := p.provider.GetSpec().FetchConfig.Helm.ValuesFrom
+
+	valuesKey := ref.Key
+	if valuesKey == "" {
+		valuesKey = defaultHelmValuesKey
+	}
+
+	var (
+		key  types.NamespacedName
+		data map[string][]byte
+	)
+
+	switch {
+	case ref.ConfigMap != nil:
+		key = types.NamespacedName{Namespace: ref.ConfigMap.Namespace, Name: ref.ConfigMap.Name}
+		if key.Namespace == "" {
+			key.Namespace = p.provider.GetNamespace()
+		}
+
+		configMap := &corev1.ConfigMap{}
+		if err := p.ctrlClient.Get(ctx, key, configMap); err != nil {
+			return nil, fmt.Errorf("failed to get config map %s: %w", key, err)
+		}
+
+		data = map[string][]byte{}
+		for k, v := range configMap.Data {
+			data[k] = []byte(v)
+		}
+	case ref.Secret != nil:
+		key = types.NamespacedName{Namespace: ref.Secret.Namespace, Name: ref.Secret.Name}
+		if key.Namespace == "" {
+			key.Namespace = p.provider.GetNamespace()
+		}
+
+		secret := &corev1.Secret{}
+		if err := p.ctrlClient.Get(ctx, key, secret); err != nil {
+			return nil, fmt.Errorf("failed to get secret %s: %w", key, err)
+		}
+
+		data = secret.Data
+	default:
+		return nil, fmt.Errorf("either a config map or a secret must be referenced")
+	}
+
+	values, ok := data[valuesKey]
+	if !ok {
+		return nil, fmt.Errorf("key %q not found in %s", valuesKey, key)
+	}
+
+	return values, nil
+}
+
+// runHelm runs a helm command, returning its output. Errors include what helm wrote to stderr,
+// e.g. the templating errors.
+func runHelm(ctx context.Context, env []string, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, helmExecutable, args...)
+	cmd.Env = append(os.Environ(), env...)
+
+	var stdout, stderr bytes.Buffer
+
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%w: %s", err, msg)
+		}
+
+		return nil, err
+	}
+
+	return stdout.Bytes(), nil
+}
+
+// wrapHelmError wraps a Helm pull or templating error so it's reported in the preflight check condition.
+func wrapHelmError(err error) error {
+	return &PhaseError{
+		Err:      err,
+		Type:     operatorv1.PreflightCheckCondition,
+		Reason:   operatorv1.HelmTemplateErrorReason,
+		Severity: clusterv1.ConditionSeverityError,
+	}
+}
@@ -0,0 +1,256 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	operatorv1 "sigs.k8s.io/cluster-api-operator/api/v1alpha2"
+	"sigs.k8s.io/cluster-api-operator/internal/controller/genericprovider"
+)
+
+// fakeHelmScript pulls a chart containing a metadata file, and renders the values file it is given,
+// failing if the values contain "fail".
+const fakeHelmScript = `#!/bin/sh
+case "$1" in
+pull)
+	while [ $# -gt 0 ]; do
+		if [ "$1" = "--untardir" ]; then
+			mkdir -p "$2/my-chart" && echo "metadata" > "$2/my-chart/metadata.yaml"
+		fi
+		shift
+	done
+	;;
+template)
+	values=""
+	while [ $# -gt 0 ]; do
+		if [ "$1" = "--values" ]; then
+			values="$2"
+		fi
+		shift
+	done
+	if [ -z "$values" ]; then
+		echo "default components"
+	elif grep -q fail "$values"; then
+		echo "Error: template: my-chart/templates/deployment.yaml:1: bad value" >&2
+		exit 1
+	else
+		cat "$values"
+	fi
+	;;
+esac
+`
+
+// installFakeHelm puts a fake helm executable first in the PATH.
+func installFakeHelm(t *testing.T) {
+	t.Helper()
+
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake helm is a shell script")
+	}
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, helmExecutable), []byte(fakeHelmScript), 0o755); err != nil { //nolint:gosec
+		t.Fatal(err)
+	}
+
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestFetchHelmManifests(t *testing.T) {
+	installFakeHelm(t)
+
+	values := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "values", Namespace: "capd-system"},
+		Data: map[string]string{
+			"values.yaml": "custom components\n",
+			"broken.yaml": "fail",
+		},
+	}
+
+	testCases := []struct {
+		name               string
+		valuesFrom         *operatorv1.HelmValuesReference
+		metadataPath       string
+		expectedComponents string
+		expectedError      bool
+	}{
+		{
+			name:               "default values",
+			expectedComponents: "default components",
+		},
+		{
+			name:               "values from a config map",
+			valuesFrom:         &operatorv1.HelmValuesReference{ConfigMap: &operatorv1.ConfigmapReference{Name: "values"}},
+			expectedComponents: "custom components",
+		},
+		{
+			name:          "templating error",
+			valuesFrom:    &operatorv1.HelmValuesReference{ConfigMap: &operatorv1.ConfigmapReference{Name: "values"}, Key: "broken.yaml"},
+			expectedError: true,
+		},
+		{
+			name:          "missing values key",
+			valuesFrom:    &operatorv1.HelmValuesReference{ConfigMap: &operatorv1.ConfigmapReference{Name: "values"}, Key: "missing.yaml"},
+			expectedError: true,
+		},
+		{
+			name:          "missing values secret",
+			valuesFrom:    &operatorv1.HelmValuesReference{Secret: &operatorv1.SecretReference{Name: "values"}},
+			expectedError: true,
+		},
+		{
+			name:          "missing metadata",
+			metadataPath:  "custom-metadata.yaml",
+			expectedError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			p := &phaseReconciler{
+				ctrlClient: fake.NewClientBuilder().WithObjects(values).Build(),
+				provider: &genericprovider.InfrastructureProviderWrapper{
+					InfrastructureProvider: &operatorv1.InfrastructureProvider{
+						ObjectMeta: metav1.ObjectMeta{Name: "docker", Namespace: "capd-system"},
+						Spec: operatorv1.InfrastructureProviderSpec{
+							ProviderSpec: operatorv1.ProviderSpec{
+								Version: "v1.0.0",
+								FetchConfig: &operatorv1.FetchConfiguration{
+									Helm: &operatorv1.HelmSource{
+										RepoURL:    "https://owner.github.io/charts",
+										Chart:      "my-chart",
+										ValuesFrom: tc.valuesFrom,
+									},
+									MetadataPath: tc.metadataPath,
+								},
+							},
+						},
+					},
+				},
+			}
+
+			metadata, components, err := p.fetchHelmManifests(context.Background())
+			if tc.expectedError {
+				var pe *PhaseError
+				g.Expect(errors.As(err, &pe)).To(BeTrue())
+				g.Expect(pe.Type).To(Equal(operatorv1.PreflightCheckCondition))
+				g.Expect(pe.Reason).To(Equal(operatorv1.HelmTemplateErrorReason))
+
+				return
+			}
+
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(string(metadata)).To(Equal("metadata\n"))
+			g.Expect(string(components)).To(Equal(tc.expectedComponents + "\n"))
+		})
+	}
+}
+
+func TestHelmPullArgs(t *testing.T) {
+	testCases := []struct {
+		name         string
+		source       *operatorv1.HelmSource
+		expectedArgs []string
+	}{
+		{
+			name:         "chart repository",
+			source:       &operatorv1.HelmSource{RepoURL: "https://owner.github.io/charts", Chart: "my-chart"},
+			expectedArgs: []string{"pull", "--version", "v1.0.0", "--untar", "--untardir", "dir", "--repo", "https://owner.github.io/charts", "--", "my-chart"},
+		},
+		{
+			name:         "OCI registry",
+			source:       &operatorv1.HelmSource{RepoURL: "oci://ghcr.io/owner/charts/", Chart: "my-chart"},
+			expectedArgs: []string{"pull", "--version", "v1.0.0", "--untar", "--untardir", "dir", "--", "oci://ghcr.io/owner/charts/my-chart"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			g.Expect(helmPullArgs(tc.source, "v1.0.0", "dir")).To(Equal(tc.expectedArgs))
+		})
+	}
+}
+
+func TestValidateHelmSource(t *testing.T) {
+	testCases := []struct {
+		name          string
+		helm          *operatorv1.HelmSource
+		expectedError string
+	}{
+		{
+			name: "chart repository",
+			helm: &operatorv1.HelmSource{RepoURL: "https://owner.github.io/charts", Chart: "my-chart"},
+		},
+		{
+			name: "OCI registry",
+			helm: &operatorv1.HelmSource{RepoURL: "oci://ghcr.io/owner/charts", Chart: "my-chart", Version: "1.0.0"},
+		},
+		{
+			name:          "repository URL mistaken for an option",
+			helm:          &operatorv1.HelmSource{RepoURL: "--kubeconfig=/tmp/config", Chart: "my-chart"},
+			expectedError: `Helm repository URL "--kubeconfig=/tmp/config" can't start with "-"`,
+		},
+		{
+			name:          "chart mistaken for an option",
+			helm:          &operatorv1.HelmSource{RepoURL: "https://owner.github.io/charts", Chart: "--post-renderer=/bin/sh"},
+			expectedError: `Helm chart "--post-renderer=/bin/sh" can't start with "-"`,
+		},
+		{
+			name:          "version mistaken for an option",
+			helm:          &operatorv1.HelmSource{RepoURL: "https://owner.github.io/charts", Chart: "my-chart", Version: "--devel"},
+			expectedError: `Helm chart version "--devel" can't start with "-"`,
+		},
+		{
+			name:          "plain http repository",
+			helm:          &operatorv1.HelmSource{RepoURL: "http://owner.github.io/charts", Chart: "my-chart"},
+			expectedError: `Helm repository URL "http://owner.github.io/charts" must start with https:// or oci://`,
+		},
+		{
+			name:          "local path",
+			helm:          &operatorv1.HelmSource{RepoURL: "/var/run/secrets", Chart: "my-chart"},
+			expectedError: `Helm repository URL "/var/run/secrets" must start with https:// or oci://`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			spec := operatorv1.ProviderSpec{
+				Version:     "v1.0.0",
+				FetchConfig: &operatorv1.FetchConfiguration{Helm: tc.helm},
+			}
+
+			g.Expect(ValidateHelmSource(spec)).To(Equal(tc.expectedError))
+		})
+	}
+}
@@ -0,0 +1,306 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/docker/distribution/reference"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	operatorv1 "sigs.k8s.io/cluster-api-operator/api/v1alpha2"
+)
+
+// manifestMediaTypes are the manifest media types accepted when resolving a tag, the image indexes first so
+// multi-architecture images resolve to the digest of the index rather than of one of its images.
+var manifestMediaTypes = []string{
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+}
+
+// bearerParamRegexp matches the parameters of a Bearer WWW-Authenticate challenge, e.g. realm="https://auth.docker.io/token".
+var bearerParamRegexp = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+var (
+	// imageDigestResolver resolves the tag of an image to a digest. It's a variable so tests don't reach registries.
+	imageDigestResolver = resolveImageDigest
+
+	// registryHTTPClient is the client the registries are requested with.
+	registryHTTPClient = http.DefaultClient
+)
+
+// pinImagesFn pins the manager images of the Deployments to the digests their tags resolve to, reusing the digests
+// recorded in the status if the version is the installed one, so the images don't change when the tags move. The
+// pinned images are kept in the phase reconciler, to be recorded in the status once the version is installed.
+func (p *phaseReconciler) pinImagesFn(ctx context.Context, version string) func(objs []unstructured.Unstructured) ([]unstructured.Unstructured, error) {
+	recorded := map[string]string{}
+
+	status := p.provider.GetStatus()
+	if status.InstalledVersion != nil && *status.InstalledVersion == version {
+		for _, pinned := range status.PinnedImages {
+			recorded[pinned.Image] = pinned.Digest
+		}
+	}
+
+	return func(objs []unstructured.Unstructured) ([]unstructured.Unstructured, error) {
+		pinned := map[string]string{}
+
+		for i := range objs {
+			if objs[i].GetKind() != deploymentKind {
+				continue
+			}
+
+			containers, _, err := unstructured.NestedSlice(objs[i].Object, "spec", "template", "spec", "containers")
+			if err != nil {
+				return nil, fmt.Errorf("failed to get the containers of Deployment %s: %w", objs[i].GetName(), err)
+			}
+
+			for _, c := range containers {
+				container, ok := c.(map[string]interface{})
+				if !ok || container["name"] != managerContainerName {
+					continue
+				}
+
+				image, _ := container["image"].(string)
+				if image == "" || strings.Contains(image, "@") {
+					continue
+				}
+
+				digest, ok := pinned[image]
+				if !ok {
+					digest, ok = recorded[image]
+				}
+
+				if !ok {
+					digest, err = imageDigestResolver(ctx, image)
+					if err != nil {
+						return nil, fmt.Errorf("failed to resolve the digest of image %q of Deployment %s: %w", image, objs[i].GetName(), err)
+					}
+
+					ctrl.LoggerFrom(ctx).Info("Resolved image digest", "image", image, "digest", digest)
+				}
+
+				pinned[image] = digest
+				container["image"] = image + "@" + digest
+			}
+
+			if err := unstructured.SetNestedSlice(objs[i].Object, containers, "spec", "template", "spec", "containers"); err != nil {
+				return nil, fmt.Errorf("failed to set the containers of Deployment %s: %w", objs[i].GetName(), err)
+			}
+		}
+
+		p.pinnedImages = make([]operatorv1.PinnedImage, 0, len(pinned))
+		for image, digest := range pinned {
+			p.pinnedImages = append(p.pinnedImages, operatorv1.PinnedImage{Image: image, Digest: digest})
+		}
+
+		sort.Slice(p.pinnedImages, func(i, j int) bool {
+			return p.pinnedImages[i].Image < p.pinnedImages[j].Image
+		})
+
+		return objs, nil
+	}
+}
+
+// pinnedImageMismatches returns the sorted descriptions of the Deployments whose manager container doesn't run the
+// image pinned in the desired components.
+func pinnedImageMismatches(ctx context.Context, c client.Client, desired []unstructured.Unstructured) ([]string, error) {
+	mismatches := []string{}
+
+	for i := range desired {
+		obj := &desired[i]
+		if obj.GetKind() != deploymentKind {
+			continue
+		}
+
+		image := managerImage(obj)
+		if !strings.Contains(image, "@") {
+			continue
+		}
+
+		live := &unstructured.Unstructured{}
+		live.SetGroupVersionKind(obj.GroupVersionKind())
+
+		if err := c.Get(ctx, client.ObjectKeyFromObject(obj), live); err != nil {
+			if client.IgnoreNotFound(err) == nil {
+				continue
+			}
+
+			return nil, fmt.Errorf("failed to get %s: %w", describeObject(*obj), err)
+		}
+
+		if liveImage := managerImage(live); liveImage != image {
+			mismatches = append(mismatches, fmt.Sprintf("%s runs %s instead of %s", describeObject(*obj), liveImage, image))
+		}
+	}
+
+	sort.Strings(mismatches)
+
+	return mismatches, nil
+}
+
+// managerImage returns the image of the manager container of the Deployment, or an empty string if it has none.
+func managerImage(deployment *unstructured.Unstructured) string {
+	containers, _, _ := unstructured.NestedSlice(deployment.Object, "spec", "template", "spec", "containers")
+
+	for _, c := range containers {
+		if container, ok := c.(map[string]interface{}); ok && container["name"] == managerContainerName {
+			image, _ := container["image"].(string)
+
+			return image
+		}
+	}
+
+	return ""
+}
+
+// resolveImageDigest returns the digest of the manifest the image tag points to, with the OCI distribution API,
+// anonymously or with the token of a Bearer challenge, as the provider images are public.
+func resolveImageDigest(ctx context.Context, image string) (string, error) {
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return "", err
+	}
+
+	tag := "latest"
+	if tagged, ok := named.(reference.Tagged); ok {
+		tag = tagged.Tag()
+	}
+
+	registry := reference.Domain(named)
+	if registry == "docker.io" {
+		registry = "registry-1.docker.io"
+	}
+
+	manifestURL := fmt.Sprintf("%s://%s/v2/%s/manifests/%s", httpsScheme, registry, reference.Path(named), tag)
+
+	response, err := headManifest(ctx, manifestURL, "")
+	if err != nil {
+		return "", err
+	}
+
+	if response.StatusCode == http.StatusUnauthorized {
+		token, err := registryToken(ctx, response.Header.Get("WWW-Authenticate"))
+		if err != nil {
+			return "", err
+		}
+
+		if response, err = headManifest(ctx, manifestURL, token); err != nil {
+			return "", err
+		}
+	}
+
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status %q getting the manifest of %s", response.Status, image)
+	}
+
+	digest := response.Header.Get("Docker-Content-Digest")
+	if digest == "" {
+		return "", fmt.Errorf("the registry didn't return the digest of %s", image)
+	}
+
+	return digest, nil
+}
+
+// headManifest requests the headers of the manifest, with the Bearer token if set.
+func headManifest(ctx context.Context, manifestURL, token string) (*http.Response, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodHead, manifestURL, http.NoBody)
+	if err != nil {
+		return nil, err
+	}
+
+	request.Header.Set("Accept", strings.Join(manifestMediaTypes, ", "))
+
+	if token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	response, err := registryHTTPClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+
+	response.Body.Close()
+
+	return response, nil
+}
+
+// registryToken gets an anonymous token from the realm of the Bearer challenge, for the service and scope it sets.
+func registryToken(ctx context.Context, challenge string) (string, error) {
+	scheme, params, _ := strings.Cut(challenge, " ")
+	if !strings.EqualFold(scheme, "Bearer") {
+		return "", fmt.Errorf("unsupported registry authentication challenge %q", challenge)
+	}
+
+	values := url.Values{}
+	realm := ""
+
+	for _, match := range bearerParamRegexp.FindAllStringSubmatch(params, -1) {
+		if match[1] == "realm" {
+			realm = match[2]
+
+			continue
+		}
+
+		values.Set(match[1], match[2])
+	}
+
+	if realm == "" {
+		return "", fmt.Errorf("registry authentication challenge %q has no realm", challenge)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, realm+"?"+values.Encode(), http.NoBody)
+	if err != nil {
+		return "", err
+	}
+
+	response, err := registryHTTPClient.Do(request)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status %q getting a registry token from %s", response.Status, realm)
+	}
+
+	token := struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}{}
+
+	if err := json.NewDecoder(response.Body).Decode(&token); err != nil {
+		return "", fmt.Errorf("failed to decode the registry token: %w", err)
+	}
+
+	if token.Token != "" {
+		return token.Token, nil
+	}
+
+	return token.AccessToken, nil
+}
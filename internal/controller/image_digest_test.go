@@ -0,0 +1,185 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	operatorv1 "sigs.k8s.io/cluster-api-operator/api/v1alpha2"
+	"sigs.k8s.io/cluster-api-operator/internal/controller/genericprovider"
+)
+
+func newDeployment(g *WithT, name string, containers ...corev1.Container) unstructured.Unstructured {
+	deployment := &appsv1.Deployment{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "apps/v1", Kind: deploymentKind},
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "capa-system"},
+		Spec: appsv1.DeploymentSpec{
+			Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{Containers: containers}},
+		},
+	}
+
+	obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(deployment)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	return unstructured.Unstructured{Object: obj}
+}
+
+func TestPinImagesFn(t *testing.T) {
+	g := NewWithT(t)
+
+	resolved := []string{}
+	imageDigestResolver = func(_ context.Context, image string) (string, error) {
+		resolved = append(resolved, image)
+
+		return "sha256:" + strings.Repeat("a", 64), nil
+	}
+
+	defer func() { imageDigestResolver = resolveImageDigest }()
+
+	manager := "registry.k8s.io/cluster-api-aws/cluster-api-aws-controller:v2.2.0"
+	recorded := "sha256:" + strings.Repeat("b", 64)
+
+	newObjs := func() []unstructured.Unstructured {
+		return []unstructured.Unstructured{
+			newDeployment(g, "capa-controller-manager",
+				corev1.Container{Name: "manager", Image: manager},
+				corev1.Container{Name: "kube-rbac-proxy", Image: "gcr.io/kubebuilder/kube-rbac-proxy:v0.13.1"}),
+			newDeployment(g, "capa-webhook",
+				corev1.Container{Name: "manager", Image: manager}),
+			newDeployment(g, "capa-pinned",
+				corev1.Container{Name: "manager", Image: "registry.k8s.io/capa/pinned@sha256:" + strings.Repeat("c", 64)}),
+		}
+	}
+
+	p := &phaseReconciler{
+		provider: &genericprovider.InfrastructureProviderWrapper{
+			InfrastructureProvider: &operatorv1.InfrastructureProvider{
+				ObjectMeta: metav1.ObjectMeta{Name: "aws", Namespace: "capa-system"},
+				Status: operatorv1.InfrastructureProviderStatus{
+					ProviderStatus: operatorv1.ProviderStatus{
+						InstalledVersion: pointer.String("v2.2.0"),
+						PinnedImages:     []operatorv1.PinnedImage{{Image: manager, Digest: recorded}},
+					},
+				},
+			},
+		},
+	}
+
+	// The digests recorded for the installed version are kept.
+	objs, err := p.pinImagesFn(context.Background(), "v2.2.0")(newObjs())
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(resolved).To(BeEmpty())
+	g.Expect(managerImage(&objs[0])).To(Equal(manager + "@" + recorded))
+	g.Expect(managerImage(&objs[1])).To(Equal(manager + "@" + recorded))
+	g.Expect(managerImage(&objs[2])).To(Equal("registry.k8s.io/capa/pinned@sha256:" + strings.Repeat("c", 64)))
+	g.Expect(p.pinnedImages).To(Equal([]operatorv1.PinnedImage{{Image: manager, Digest: recorded}}))
+
+	containers, _, _ := unstructured.NestedSlice(objs[0].Object, "spec", "template", "spec", "containers")
+	g.Expect(containers[1].(map[string]interface{})["image"]).To(Equal("gcr.io/kubebuilder/kube-rbac-proxy:v0.13.1"))
+
+	// Other versions are resolved again, once per image.
+	objs, err = p.pinImagesFn(context.Background(), "v2.2.1")(newObjs())
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(resolved).To(Equal([]string{manager}))
+	g.Expect(managerImage(&objs[1])).To(Equal(manager + "@sha256:" + strings.Repeat("a", 64)))
+}
+
+func TestPinnedImageMismatches(t *testing.T) {
+	g := NewWithT(t)
+
+	pinned := "registry.k8s.io/cluster-api-aws/cluster-api-aws-controller:v2.2.0@sha256:" + strings.Repeat("a", 64)
+
+	live := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "capa-controller-manager", Namespace: "capa-system"},
+		Spec: appsv1.DeploymentSpec{
+			Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{Containers: []corev1.Container{
+				{Name: "manager", Image: "registry.k8s.io/cluster-api-aws/cluster-api-aws-controller:v2.2.0"},
+			}}},
+		},
+	}
+
+	scheme := setupScheme()
+	utilruntime.Must(appsv1.AddToScheme(scheme))
+
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(live).Build()
+
+	mismatches, err := pinnedImageMismatches(context.Background(), c, []unstructured.Unstructured{
+		newDeployment(g, "capa-controller-manager", corev1.Container{Name: "manager", Image: pinned}),
+		newDeployment(g, "capa-missing", corev1.Container{Name: "manager", Image: pinned}),
+	})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(mismatches).To(Equal([]string{
+		"Deployment capa-system/capa-controller-manager runs registry.k8s.io/cluster-api-aws/cluster-api-aws-controller:v2.2.0 instead of " + pinned,
+	}))
+}
+
+func TestResolveImageDigest(t *testing.T) {
+	g := NewWithT(t)
+
+	digest := "sha256:" + strings.Repeat("d", 64)
+
+	var server *httptest.Server
+	server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/token":
+			g.Expect(r.URL.Query().Get("scope")).To(Equal("repository:cluster-api/manager:pull"))
+			fmt.Fprint(w, `{"token": "secret"}`)
+		case "/v2/cluster-api/manager/manifests/v1.5.1":
+			if r.Header.Get("Authorization") != "Bearer secret" {
+				w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="registry",scope="repository:cluster-api/manager:pull"`, server.URL))
+				w.WriteHeader(http.StatusUnauthorized)
+
+				return
+			}
+
+			g.Expect(r.Method).To(Equal(http.MethodHead))
+			g.Expect(r.Header.Get("Accept")).To(ContainSubstring("application/vnd.oci.image.index.v1+json"))
+			w.Header().Set("Docker-Content-Digest", digest)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	registryHTTPClient = server.Client()
+
+	defer func() { registryHTTPClient = http.DefaultClient }()
+
+	host := server.Listener.Addr().String()
+
+	resolved, err := resolveImageDigest(context.Background(), host+"/cluster-api/manager:v1.5.1")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(resolved).To(Equal(digest))
+
+	_, err = resolveImageDigest(context.Background(), host+"/cluster-api/missing:v1.5.1")
+	g.Expect(err).To(MatchError(ContainSubstring("404 Not Found")))
+}
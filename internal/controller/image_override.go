@@ -0,0 +1,82 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	operatorv1 "sigs.k8s.io/cluster-api-operator/api/v1alpha2"
+	"sigs.k8s.io/cluster-api-operator/internal/controller/genericprovider"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/cluster-api/util/container"
+)
+
+const imageOverriddenMessage = "Manager image is overridden with %s"
+
+// validateImageReference returns a message describing why the image reference is invalid,
+// or an empty string if it is valid.
+func validateImageReference(ref *operatorv1.ImageReference) string {
+	if ref.Repository == "" {
+		return "Image repository must be provided"
+	}
+
+	if ref.Tag == "" && ref.Digest == "" {
+		return "At least one of image tag and digest must be provided"
+	}
+
+	image := imageReference(ref)
+	if _, err := container.ImageFromString(image); err != nil {
+		return fmt.Sprintf("Invalid image reference %q: %v", image, err)
+	}
+
+	return ""
+}
+
+// imageReference returns the image reference in the repository[:tag][@digest] format.
+func imageReference(ref *operatorv1.ImageReference) string {
+	image := ref.Repository
+
+	if ref.Tag != "" {
+		image += ":" + ref.Tag
+	}
+
+	if ref.Digest != "" {
+		image += "@" + ref.Digest
+	}
+
+	return image
+}
+
+// setImageOverriddenCondition reports whether the manager image of the provider is overridden.
+func setImageOverriddenCondition(provider genericprovider.GenericProvider) {
+	spec := provider.GetSpec()
+
+	if spec.Deployment == nil || spec.Deployment.Image == nil {
+		conditions.Delete(provider, operatorv1.ImageOverriddenCondition)
+
+		return
+	}
+
+	conditions.Set(provider, &clusterv1.Condition{
+		Type:    operatorv1.ImageOverriddenCondition,
+		Status:  corev1.ConditionTrue,
+		Reason:  operatorv1.ImageOverrideAppliedReason,
+		Message: fmt.Sprintf(imageOverriddenMessage, imageReference(spec.Deployment.Image)),
+	})
+}
@@ -0,0 +1,127 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+
+	operatorv1 "sigs.k8s.io/cluster-api-operator/api/v1alpha2"
+	"sigs.k8s.io/cluster-api-operator/internal/controller/genericprovider"
+)
+
+const testImageDigest = "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+func TestValidateImageReference(t *testing.T) {
+	testCases := []struct {
+		name          string
+		ref           *operatorv1.ImageReference
+		expectedImage string
+		expectedValid bool
+	}{
+		{
+			name:          "tag",
+			ref:           &operatorv1.ImageReference{Repository: "registry.k8s.io/cluster-api/cluster-api-controller", Tag: "v1.5.1"},
+			expectedImage: "registry.k8s.io/cluster-api/cluster-api-controller:v1.5.1",
+			expectedValid: true,
+		},
+		{
+			name:          "digest",
+			ref:           &operatorv1.ImageReference{Repository: "registry.k8s.io/cluster-api/cluster-api-controller", Digest: testImageDigest},
+			expectedImage: "registry.k8s.io/cluster-api/cluster-api-controller@" + testImageDigest,
+			expectedValid: true,
+		},
+		{
+			name:          "tag and digest",
+			ref:           &operatorv1.ImageReference{Repository: "registry.k8s.io/cluster-api/cluster-api-controller", Tag: "v1.5.1", Digest: testImageDigest},
+			expectedImage: "registry.k8s.io/cluster-api/cluster-api-controller:v1.5.1@" + testImageDigest,
+			expectedValid: true,
+		},
+		{
+			name:          "no repository",
+			ref:           &operatorv1.ImageReference{Tag: "v1.5.1"},
+			expectedImage: ":v1.5.1",
+			expectedValid: false,
+		},
+		{
+			name:          "neither tag nor digest",
+			ref:           &operatorv1.ImageReference{Repository: "registry.k8s.io/cluster-api/cluster-api-controller"},
+			expectedImage: "registry.k8s.io/cluster-api/cluster-api-controller",
+			expectedValid: false,
+		},
+		{
+			name:          "invalid tag",
+			ref:           &operatorv1.ImageReference{Repository: "registry.k8s.io/cluster-api/cluster-api-controller", Tag: "v1.5.1:latest"},
+			expectedImage: "registry.k8s.io/cluster-api/cluster-api-controller:v1.5.1:latest",
+			expectedValid: false,
+		},
+		{
+			name:          "invalid digest",
+			ref:           &operatorv1.ImageReference{Repository: "registry.k8s.io/cluster-api/cluster-api-controller", Digest: "sha256:abc"},
+			expectedImage: "registry.k8s.io/cluster-api/cluster-api-controller@sha256:abc",
+			expectedValid: false,
+		},
+		{
+			name:          "upper case repository",
+			ref:           &operatorv1.ImageReference{Repository: "registry.k8s.io/Cluster-API/controller", Tag: "v1.5.1"},
+			expectedImage: "registry.k8s.io/Cluster-API/controller:v1.5.1",
+			expectedValid: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			g.Expect(imageReference(tc.ref)).To(Equal(tc.expectedImage))
+			g.Expect(validateImageReference(tc.ref) == "").To(Equal(tc.expectedValid))
+		})
+	}
+}
+
+func TestSetImageOverriddenCondition(t *testing.T) {
+	g := NewWithT(t)
+
+	provider := &genericprovider.CoreProviderWrapper{
+		CoreProvider: &operatorv1.CoreProvider{
+			Spec: operatorv1.CoreProviderSpec{
+				ProviderSpec: operatorv1.ProviderSpec{
+					Deployment: &operatorv1.DeploymentSpec{
+						Image: &operatorv1.ImageReference{Repository: "registry.k8s.io/cluster-api/cluster-api-controller", Tag: "v1.5.2"},
+					},
+				},
+			},
+		},
+	}
+
+	setImageOverriddenCondition(provider)
+
+	condition := conditions.Get(provider, operatorv1.ImageOverriddenCondition)
+	g.Expect(condition).ToNot(BeNil())
+	g.Expect(condition.Status).To(Equal(corev1.ConditionTrue))
+	g.Expect(condition.Reason).To(Equal(operatorv1.ImageOverrideAppliedReason))
+	g.Expect(condition.Message).To(ContainSubstring("registry.k8s.io/cluster-api/cluster-api-controller:v1.5.2"))
+
+	provider.Spec.ProviderSpec.Deployment.Image = nil
+
+	setImageOverriddenCondition(provider)
+
+	g.Expect(conditions.Has(provider, operatorv1.ImageOverriddenCondition)).To(BeFalse())
+}
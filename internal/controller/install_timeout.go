@@ -0,0 +1,105 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	operatorv1 "sigs.k8s.io/cluster-api-operator/api/v1alpha2"
+	"sigs.k8s.io/cluster-api-operator/internal/controller/genericprovider"
+)
+
+const installTimeoutExceededMessage = "Install of version %s didn't complete within %s: %s"
+
+// startInstallAttempt tracks the install of spec.version in the provider status if spec.installTimeout is set,
+// starting a new attempt when the version changes. It returns false if the attempt exceeded the timeout, in
+// which case the provider isn't reconciled anymore until the version or the timeout change.
+func startInstallAttempt(provider genericprovider.GenericProvider, now time.Time) bool {
+	status := provider.GetStatus()
+	version := provider.GetSpec().Version
+
+	switch {
+	case provider.GetSpec().InstallTimeout == nil:
+		status.InstallAttempt = nil
+	case status.InstallAttempt == nil || status.InstallAttempt.Version != version:
+		status.InstallAttempt = &operatorv1.InstallAttempt{Version: version, StartTime: metav1.NewTime(now)}
+	}
+
+	provider.SetStatus(status)
+
+	if installTimeoutExceeded(provider, now) {
+		return false
+	}
+
+	conditions.Delete(provider, operatorv1.InstallFailedCondition)
+
+	return true
+}
+
+// finishInstallAttempt stops tracking the install attempt once the desired version is installed.
+func finishInstallAttempt(provider genericprovider.GenericProvider) {
+	status := provider.GetStatus()
+	status.InstallAttempt = nil
+	provider.SetStatus(status)
+}
+
+// installTimeoutExceeded returns true if the tracked install attempt started longer than spec.installTimeout ago.
+func installTimeoutExceeded(provider genericprovider.GenericProvider, now time.Time) bool {
+	timeout := provider.GetSpec().InstallTimeout
+	attempt := provider.GetStatus().InstallAttempt
+
+	return timeout != nil && attempt != nil && now.Sub(attempt.StartTime.Time) > timeout.Duration
+}
+
+// failInstall sets the terminal InstallFailed condition with the last error of the install, or the message of
+// the condition it was waiting on, and returns an empty result so the provider stops being requeued.
+func failInstall(ctx context.Context, provider genericprovider.GenericProvider, reconcileErr error) (ctrl.Result, error) {
+	lastError := "the install was still in progress"
+
+	if reconcileErr != nil {
+		lastError = reconcileErr.Error()
+	} else {
+		for _, t := range []clusterv1.ConditionType{operatorv1.PreflightCheckCondition, operatorv1.ProviderInstalledCondition} {
+			if conditions.IsFalse(provider, t) && conditions.GetMessage(provider, t) != "" {
+				lastError = conditions.GetMessage(provider, t)
+
+				break
+			}
+		}
+	}
+
+	attempt := provider.GetStatus().InstallAttempt
+	timeout := provider.GetSpec().InstallTimeout
+
+	ctrl.LoggerFrom(ctx).Info("Install timeout exceeded, not retrying", "startTime", attempt.StartTime, "timeout", timeout.Duration, "lastError", lastError)
+	conditions.Set(provider, &clusterv1.Condition{
+		Type:    operatorv1.InstallFailedCondition,
+		Status:  corev1.ConditionTrue,
+		Reason:  operatorv1.InstallTimeoutExceededReason,
+		Message: fmt.Sprintf(installTimeoutExceededMessage, attempt.Version, timeout.Duration, lastError),
+	})
+
+	return ctrl.Result{}, nil
+}
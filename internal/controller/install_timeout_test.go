@@ -0,0 +1,81 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+
+	operatorv1 "sigs.k8s.io/cluster-api-operator/api/v1alpha2"
+	"sigs.k8s.io/cluster-api-operator/internal/controller/genericprovider"
+)
+
+func TestInstallAttempt(t *testing.T) {
+	g := NewWithT(t)
+
+	start := time.Date(2023, 10, 2, 8, 0, 0, 0, time.UTC)
+
+	provider := &genericprovider.InfrastructureProviderWrapper{
+		InfrastructureProvider: &operatorv1.InfrastructureProvider{
+			ObjectMeta: metav1.ObjectMeta{Name: "aws", Namespace: "capa-system"},
+			Spec: operatorv1.InfrastructureProviderSpec{
+				ProviderSpec: operatorv1.ProviderSpec{Version: "v2.2.0", InstallTimeout: &metav1.Duration{Duration: 10 * time.Minute}},
+			},
+		},
+	}
+
+	// The first reconcile of the version starts the attempt, which later reconciles keep.
+	g.Expect(startInstallAttempt(provider, start)).To(BeTrue())
+	g.Expect(startInstallAttempt(provider, start.Add(5*time.Minute))).To(BeTrue())
+	g.Expect(provider.Status.InstallAttempt).To(Equal(&operatorv1.InstallAttempt{Version: "v2.2.0", StartTime: metav1.NewTime(start)}))
+
+	// Past the timeout, the install fails with the last error and isn't retried.
+	g.Expect(installTimeoutExceeded(provider, start.Add(11*time.Minute))).To(BeTrue())
+
+	res, err := failInstall(context.Background(), provider, errors.New("failed to download: 404 Not Found"))
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(res.IsZero()).To(BeTrue())
+	g.Expect(conditions.IsTrue(provider, operatorv1.InstallFailedCondition)).To(BeTrue())
+	g.Expect(conditions.GetReason(provider, operatorv1.InstallFailedCondition)).To(Equal(operatorv1.InstallTimeoutExceededReason))
+	g.Expect(conditions.GetMessage(provider, operatorv1.InstallFailedCondition)).To(Equal(
+		"Install of version v2.2.0 didn't complete within 10m0s: failed to download: 404 Not Found"))
+
+	g.Expect(startInstallAttempt(provider, start.Add(12*time.Minute))).To(BeFalse())
+	g.Expect(conditions.Has(provider, operatorv1.InstallFailedCondition)).To(BeTrue())
+
+	// Changing the version starts a new attempt.
+	provider.Spec.Version = "v2.2.1"
+
+	g.Expect(startInstallAttempt(provider, start.Add(13*time.Minute))).To(BeTrue())
+	g.Expect(provider.Status.InstallAttempt.StartTime.Time).To(Equal(start.Add(13 * time.Minute)))
+	g.Expect(conditions.Has(provider, operatorv1.InstallFailedCondition)).To(BeFalse())
+
+	finishInstallAttempt(provider)
+	g.Expect(provider.Status.InstallAttempt).To(BeNil())
+
+	// Without a timeout, no attempt is tracked.
+	provider.Spec.InstallTimeout = nil
+
+	g.Expect(startInstallAttempt(provider, start.Add(14*time.Minute))).To(BeTrue())
+	g.Expect(provider.Status.InstallAttempt).To(BeNil())
+}
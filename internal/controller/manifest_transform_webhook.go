@@ -0,0 +1,234 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	operatorv1 "sigs.k8s.io/cluster-api-operator/api/v1alpha2"
+)
+
+const (
+	// defaultManifestTransformTimeout is how long to wait for the manifest transform webhook when no timeout is set.
+	defaultManifestTransformTimeout = 10 * time.Second
+
+	// maxManifestTransformResponseSize bounds the response read from the webhook, as for the downloaded components.
+	maxManifestTransformResponseSize = 10 * maxConfigMapSize
+
+	// maxManifestTransformErrorSize bounds the part of an error response reported in the condition.
+	maxManifestTransformErrorSize = 256
+)
+
+// manifestTransformProvider identifies the provider whose components are transformed.
+type manifestTransformProvider struct {
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Version   string `json:"version"`
+}
+
+// manifestTransformRequest is the body posted to the manifest transform webhook.
+type manifestTransformRequest struct {
+	Provider manifestTransformProvider `json:"provider"`
+	Objects  []map[string]interface{}  `json:"objects"`
+}
+
+// manifestTransformResponse is the body returned by the manifest transform webhook.
+type manifestTransformResponse struct {
+	Objects []map[string]interface{} `json:"objects"`
+}
+
+// validateManifestTransformWebhook checks the manifest transform webhook, returning a message describing
+// the first problem found, if any.
+func validateManifestTransformWebhook(webhook *operatorv1.ManifestTransformWebhook, providerNamespace string) string {
+	u, err := url.Parse(webhook.URL)
+	if err != nil || u.Host == "" {
+		return fmt.Sprintf("Invalid manifest transform webhook URL %q", webhook.URL)
+	}
+
+	if u.Scheme != "https" {
+		return fmt.Sprintf("Manifest transform webhook URL %q must use https", webhook.URL)
+	}
+
+	if webhook.Timeout != nil && webhook.Timeout.Duration <= 0 {
+		return "Manifest transform webhook timeout must be positive"
+	}
+
+	if ref := webhook.CABundleRef; ref != nil {
+		if ref.MountIntoDeployment {
+			return "The manifest transform webhook CA bundle can't be mounted into the deployment"
+		}
+
+		return validateCABundleRef(ref, providerNamespace)
+	}
+
+	return ""
+}
+
+// transformObjectsFn returns a function passing the objects to the manifest transform webhook of the provider,
+// if any, and returning the objects it responds with.
+func (p *phaseReconciler) transformObjectsFn(ctx context.Context, version string) func(objs []unstructured.Unstructured) ([]unstructured.Unstructured, error) {
+	return func(objs []unstructured.Unstructured) ([]unstructured.Unstructured, error) {
+		webhook := p.provider.GetSpec().ManifestTransformWebhook
+		if webhook == nil {
+			return objs, nil
+		}
+
+		httpClient, err := p.newManifestTransformHTTPClient(ctx, webhook)
+		if err != nil {
+			return nil, fmt.Errorf("failed to configure the manifest transform webhook %s: %w", webhook.URL, err)
+		}
+
+		transformed, err := callManifestTransformWebhook(ctx, httpClient, webhook.URL, manifestTransformRequest{
+			Provider: manifestTransformProvider{
+				Kind:      providerKind(p.provider),
+				Namespace: p.provider.GetNamespace(),
+				Name:      p.provider.GetName(),
+				Version:   version,
+			},
+			Objects: objectsContent(objs),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("manifest transform webhook %s failed: %w", webhook.URL, err)
+		}
+
+		return transformed, nil
+	}
+}
+
+// newManifestTransformHTTPClient returns the http client calling the webhook, trusting its CA bundle if any.
+func (p *phaseReconciler) newManifestTransformHTTPClient(ctx context.Context, webhook *operatorv1.ManifestTransformWebhook) (*http.Client, error) {
+	httpClient := &http.Client{}
+
+	if webhook.CABundleRef != nil {
+		bundle, err := p.readCABundle(ctx, webhook.CABundleRef)
+		if err != nil {
+			return nil, err
+		}
+
+		httpClient, err = newHTTPClientWithCABundle(bundle)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	httpClient.Timeout = defaultManifestTransformTimeout
+	if webhook.Timeout != nil {
+		httpClient.Timeout = webhook.Timeout.Duration
+	}
+
+	// Redirects could lead to a plain http URL.
+	httpClient.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	return httpClient, nil
+}
+
+// callManifestTransformWebhook posts the request to the webhook and returns the objects of its response.
+func callManifestTransformWebhook(ctx context.Context, httpClient *http.Client, webhookURL string, transformRequest manifestTransformRequest) ([]unstructured.Unstructured, error) {
+	body, err := json.Marshal(transformRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("Accept", "application/json")
+
+	response, err := httpClient.Do(request)
+	if err != nil {
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			return nil, fmt.Errorf("no response within %s", httpClient.Timeout)
+		}
+
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(response.Body, maxManifestTransformResponseSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the response: %w", err)
+	}
+
+	if response.StatusCode != http.StatusOK {
+		msg := strings.TrimSpace(string(data))
+		if len(msg) > maxManifestTransformErrorSize {
+			msg = msg[:maxManifestTransformErrorSize] + "..."
+		}
+
+		if msg == "" {
+			return nil, fmt.Errorf("unexpected status %s", response.Status)
+		}
+
+		return nil, fmt.Errorf("unexpected status %s: %s", response.Status, msg)
+	}
+
+	if len(data) > maxManifestTransformResponseSize {
+		return nil, fmt.Errorf("response is larger than %d bytes", maxManifestTransformResponseSize)
+	}
+
+	transformResponse := manifestTransformResponse{}
+	if err := json.Unmarshal(data, &transformResponse); err != nil {
+		return nil, fmt.Errorf("failed to decode the response: %w", err)
+	}
+
+	if len(transformResponse.Objects) == 0 {
+		return nil, fmt.Errorf("response doesn't contain any object")
+	}
+
+	objs := make([]unstructured.Unstructured, 0, len(transformResponse.Objects))
+
+	for i, content := range transformResponse.Objects {
+		obj := unstructured.Unstructured{Object: content}
+
+		if obj.GetAPIVersion() == "" || obj.GetKind() == "" || obj.GetName() == "" {
+			return nil, fmt.Errorf("object %d of the response must have an apiVersion, a kind and a name", i)
+		}
+
+		objs = append(objs, obj)
+	}
+
+	return objs, nil
+}
+
+// objectsContent returns the content of the objects, for encoding them.
+func objectsContent(objs []unstructured.Unstructured) []map[string]interface{} {
+	contents := make([]map[string]interface{}, 0, len(objs))
+	for _, obj := range objs {
+		contents = append(contents, obj.Object)
+	}
+
+	return contents
+}
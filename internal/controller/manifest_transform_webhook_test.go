@@ -0,0 +1,220 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	operatorv1 "sigs.k8s.io/cluster-api-operator/api/v1alpha2"
+	"sigs.k8s.io/cluster-api-operator/internal/controller/genericprovider"
+)
+
+// stubManifestTransformHandler labels all the objects it receives, after checking the request.
+func stubManifestTransformHandler(t *testing.T) http.HandlerFunc {
+	t.Helper()
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		g := NewWithT(t)
+
+		g.Expect(r.Method).To(Equal(http.MethodPost))
+		g.Expect(r.Header.Get("Content-Type")).To(Equal("application/json"))
+
+		request := manifestTransformRequest{}
+		g.Expect(json.NewDecoder(r.Body).Decode(&request)).To(Succeed())
+		g.Expect(request.Provider).To(Equal(manifestTransformProvider{Kind: "InfrastructureProvider", Namespace: "capa-system", Name: "aws", Version: "v2.1.4"}))
+
+		for _, content := range request.Objects {
+			obj := unstructured.Unstructured{Object: content}
+			obj.SetLabels(map[string]string{"policy.example.com/enforced": "true"})
+		}
+
+		g.Expect(json.NewEncoder(w).Encode(manifestTransformResponse{Objects: request.Objects})).To(Succeed())
+	}
+}
+
+func TestTransformObjects(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.Handle("/transform", stubManifestTransformHandler(t))
+	mux.HandleFunc("/deny", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "sidecar injection is not allowed in capa-system", http.StatusForbidden)
+	})
+	mux.HandleFunc("/empty", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"objects": []}`))
+	})
+	mux.HandleFunc("/invalid", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"objects": [{"kind": "Deployment"}]}`))
+	})
+
+	release := make(chan struct{})
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	})
+
+	server := httptest.NewTLSServer(mux)
+	defer server.Close()
+	defer close(release)
+
+	caBundle := &operatorv1.CABundleReference{
+		PEM: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})),
+	}
+
+	objs := []unstructured.Unstructured{
+		newUnstructured(appsv1.SchemeGroupVersion.WithKind("Deployment"), "capa-system", "capa-controller-manager"),
+		newUnstructured(corev1.SchemeGroupVersion.WithKind("ServiceAccount"), "capa-system", "capa-manager"),
+	}
+
+	testCases := []struct {
+		name          string
+		webhook       *operatorv1.ManifestTransformWebhook
+		expectedError string
+	}{
+		{
+			name: "objects are left unchanged without a webhook",
+		},
+		{
+			name:    "objects are transformed by the webhook",
+			webhook: &operatorv1.ManifestTransformWebhook{URL: server.URL + "/transform", CABundleRef: caBundle},
+		},
+		{
+			name:          "webhook server certificate is not trusted",
+			webhook:       &operatorv1.ManifestTransformWebhook{URL: server.URL + "/transform"},
+			expectedError: "certificate signed by unknown authority",
+		},
+		{
+			name:          "webhook returns an error",
+			webhook:       &operatorv1.ManifestTransformWebhook{URL: server.URL + "/deny", CABundleRef: caBundle},
+			expectedError: "manifest transform webhook " + server.URL + "/deny failed: unexpected status 403 Forbidden: sidecar injection is not allowed in capa-system",
+		},
+		{
+			name:          "webhook returns no objects",
+			webhook:       &operatorv1.ManifestTransformWebhook{URL: server.URL + "/empty", CABundleRef: caBundle},
+			expectedError: "response doesn't contain any object",
+		},
+		{
+			name:          "webhook returns invalid objects",
+			webhook:       &operatorv1.ManifestTransformWebhook{URL: server.URL + "/invalid", CABundleRef: caBundle},
+			expectedError: "object 0 of the response must have an apiVersion, a kind and a name",
+		},
+		{
+			name: "webhook times out",
+			webhook: &operatorv1.ManifestTransformWebhook{
+				URL:         server.URL + "/slow",
+				CABundleRef: caBundle,
+				Timeout:     &metav1.Duration{Duration: 100 * time.Millisecond},
+			},
+			expectedError: "manifest transform webhook " + server.URL + "/slow failed: no response within 100ms",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			p := &phaseReconciler{
+				provider: &genericprovider.InfrastructureProviderWrapper{
+					InfrastructureProvider: &operatorv1.InfrastructureProvider{
+						ObjectMeta: metav1.ObjectMeta{Name: "aws", Namespace: "capa-system"},
+						Spec: operatorv1.InfrastructureProviderSpec{
+							ProviderSpec: operatorv1.ProviderSpec{ManifestTransformWebhook: tc.webhook},
+						},
+					},
+				},
+			}
+
+			input := []unstructured.Unstructured{}
+			for _, obj := range objs {
+				input = append(input, *obj.DeepCopy())
+			}
+
+			transformed, err := p.transformObjectsFn(context.Background(), "v2.1.4")(input)
+			if tc.expectedError != "" {
+				g.Expect(err).To(MatchError(ContainSubstring(tc.expectedError)))
+
+				return
+			}
+
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(transformed).To(HaveLen(len(objs)))
+
+			for i, obj := range transformed {
+				g.Expect(obj.GetName()).To(Equal(objs[i].GetName()))
+
+				if tc.webhook == nil {
+					g.Expect(obj.GetLabels()).To(BeEmpty())
+				} else {
+					g.Expect(obj.GetLabels()).To(HaveKeyWithValue("policy.example.com/enforced", "true"))
+				}
+			}
+		})
+	}
+}
+
+func TestValidateManifestTransformWebhook(t *testing.T) {
+	testCases := []struct {
+		name        string
+		webhook     *operatorv1.ManifestTransformWebhook
+		expectedMsg string
+	}{
+		{
+			name:    "valid webhook",
+			webhook: &operatorv1.ManifestTransformWebhook{URL: "https://policy.example.com/transform"},
+		},
+		{
+			name:        "plain http URL",
+			webhook:     &operatorv1.ManifestTransformWebhook{URL: "http://policy.example.com/transform"},
+			expectedMsg: `Manifest transform webhook URL "http://policy.example.com/transform" must use https`,
+		},
+		{
+			name:        "URL without a host",
+			webhook:     &operatorv1.ManifestTransformWebhook{URL: "policy"},
+			expectedMsg: `Invalid manifest transform webhook URL "policy"`,
+		},
+		{
+			name:        "negative timeout",
+			webhook:     &operatorv1.ManifestTransformWebhook{URL: "https://policy.example.com/transform", Timeout: &metav1.Duration{Duration: -time.Second}},
+			expectedMsg: "Manifest transform webhook timeout must be positive",
+		},
+		{
+			name: "CA bundle mounted into the deployment",
+			webhook: &operatorv1.ManifestTransformWebhook{
+				URL:         "https://policy.example.com/transform",
+				CABundleRef: &operatorv1.CABundleReference{ConfigMap: &operatorv1.ConfigmapReference{Name: "ca"}, MountIntoDeployment: true},
+			},
+			expectedMsg: "The manifest transform webhook CA bundle can't be mounted into the deployment",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			g.Expect(validateManifestTransformWebhook(tc.webhook, "capa-system")).To(Equal(tc.expectedMsg))
+		})
+	}
+}
@@ -0,0 +1,185 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	// sharedManifestsCache caches the downloaded manifests across all the providers managed by the operator.
+	sharedManifestsCache = newManifestsCache(manifestsCacheTTL)
+
+	manifestsCacheRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "capi_operator_manifests_cache_requests_total",
+		Help: "Total number of lookups of downloaded provider manifests in the operator cache, by result (hit or miss).",
+	}, []string{"result"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(manifestsCacheRequests)
+}
+
+// manifestsCacheEntry holds the manifests downloaded for a provider version.
+type manifestsCacheEntry struct {
+	metadata   []byte
+	components []byte
+	expiresAt  time.Time
+}
+
+// manifestsCache is an in-memory cache of downloaded provider manifests, so providers sharing the same
+// version don't download them again within the cache TTL.
+type manifestsCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	now     func() time.Time
+	entries map[string]manifestsCacheEntry
+}
+
+// newManifestsCache returns an empty manifests cache whose entries expire after the given TTL.
+func newManifestsCache(ttl time.Duration) *manifestsCache {
+	return &manifestsCache{
+		ttl:     ttl,
+		now:     time.Now,
+		entries: map[string]manifestsCacheEntry{},
+	}
+}
+
+// get returns the manifests cached for the given key, if they haven't expired yet.
+func (c *manifestsCache) get(key string) ([]byte, []byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if ok && c.now().After(entry.expiresAt) {
+		delete(c.entries, key)
+
+		ok = false
+	}
+
+	if !ok {
+		manifestsCacheRequests.WithLabelValues("miss").Inc()
+
+		return nil, nil, false
+	}
+
+	manifestsCacheRequests.WithLabelValues("hit").Inc()
+
+	return entry.metadata, entry.components, true
+}
+
+// set caches the manifests for the given key, dropping the expired entries.
+func (c *manifestsCache) set(key string, metadata, components []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+
+	for k, entry := range c.entries {
+		if now.After(entry.expiresAt) {
+			delete(c.entries, k)
+		}
+	}
+
+	c.entries[key] = manifestsCacheEntry{
+		metadata:   metadata,
+		components: components,
+		expiresAt:  now.Add(c.ttl),
+	}
+}
+
+// manifestsCacheKey returns the key identifying the manifests of the provider version.
+// The fetch source is part of the key, as providers with the same name can be fetched from different URLs,
+// and so are the credentials they are fetched with.
+func (p *phaseReconciler) manifestsCacheKey() string {
+	spec := p.provider.GetSpec()
+
+	key := fmt.Sprintf("%s/%s/%s/%s", p.provider.GetType(), p.provider.GetName(), spec.Version, p.providerConfig.URL())
+
+	if spec.FetchConfig != nil {
+		key = fmt.Sprintf("%s/%s/%s", key, spec.FetchConfig.MetadataPath, spec.FetchConfig.ComponentsPath)
+	}
+
+	// All the Git sources share the same fake repository URL.
+	if isGitSource(spec) {
+		key = fmt.Sprintf("%s/%s@%s/%s", key, spec.FetchConfig.Git.URL, gitRef(spec), spec.FetchConfig.Git.Path)
+	}
+
+	// Charts are rendered into the provider namespace with its own values, so don't share them across namespaces.
+	// The source hash covers the values data, so the chart is rendered again when the values change.
+	if isHelmSource(spec) {
+		key = fmt.Sprintf("%s/%s/%s@%s/%s/%s", key, spec.FetchConfig.Helm.RepoURL, spec.FetchConfig.Helm.Chart,
+			helmChartVersion(spec), p.provider.GetNamespace(), p.sourceHash)
+	}
+
+	// Manifests fetched with credentials, e.g. from a private repository, are only shared with the providers
+	// using the same credentials, so a provider can't get manifests it has no access to.
+	if credentials := p.fetchCredentialsRefs(); len(credentials) > 0 {
+		key = fmt.Sprintf("%s/credentials=%s", key, strings.Join(credentials, ","))
+	}
+
+	return key
+}
+
+// fetchCredentialsRefs returns the references to the secrets and CA bundles the manifests are fetched with: the
+// clusterctl variables, e.g. GITHUB_TOKEN or GITLAB_ACCESS_TOKEN, the Git credentials and the CA bundle.
+func (p *phaseReconciler) fetchCredentialsRefs() []string {
+	spec := p.provider.GetSpec()
+	refs := []string{}
+
+	ref := func(kind, namespace, name string) string {
+		if namespace == "" {
+			namespace = p.provider.GetNamespace()
+		}
+
+		return fmt.Sprintf("%s:%s/%s", kind, namespace, name)
+	}
+
+	if spec.ConfigSecret != nil {
+		refs = append(refs, ref("secret", spec.ConfigSecret.Namespace, spec.ConfigSecret.Name))
+	}
+
+	if spec.ConfigSecretRef != nil {
+		refs = append(refs, ref("secret", spec.ConfigSecretRef.Namespace, spec.ConfigSecretRef.Name)+"#"+spec.ConfigSecretRef.Key)
+	}
+
+	if spec.FetchConfig == nil {
+		return refs
+	}
+
+	if isGitSource(spec) && spec.FetchConfig.Git.SecretRef != nil {
+		refs = append(refs, ref("secret", spec.FetchConfig.Git.SecretRef.Namespace, spec.FetchConfig.Git.SecretRef.Name))
+	}
+
+	if caBundleRef := spec.FetchConfig.CABundleRef; caBundleRef != nil {
+		switch {
+		case caBundleRef.ConfigMap != nil:
+			refs = append(refs, ref("configmap", caBundleRef.ConfigMap.Namespace, caBundleRef.ConfigMap.Name)+"#"+caBundleRef.Key)
+		case caBundleRef.PEM != "":
+			refs = append(refs, fmt.Sprintf("pem:%x", sha256.Sum256([]byte(caBundleRef.PEM))))
+		}
+	}
+
+	return refs
+}
@@ -0,0 +1,130 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterctlv1 "sigs.k8s.io/cluster-api/cmd/clusterctl/api/v1alpha3"
+	configclient "sigs.k8s.io/cluster-api/cmd/clusterctl/client/config"
+
+	operatorv1 "sigs.k8s.io/cluster-api-operator/api/v1alpha2"
+	"sigs.k8s.io/cluster-api-operator/internal/controller/genericprovider"
+)
+
+func TestManifestsCache(t *testing.T) {
+	g := NewWithT(t)
+
+	now := time.Now()
+	cache := newManifestsCache(time.Hour)
+	cache.now = func() time.Time { return now }
+
+	_, _, ok := cache.get("infrastructure/aws/v2.2.1")
+	g.Expect(ok).To(BeFalse())
+
+	cache.set("infrastructure/aws/v2.2.1", []byte("metadata"), []byte("components"))
+
+	metadata, components, ok := cache.get("infrastructure/aws/v2.2.1")
+	g.Expect(ok).To(BeTrue())
+	g.Expect(string(metadata)).To(Equal("metadata"))
+	g.Expect(string(components)).To(Equal("components"))
+
+	_, _, ok = cache.get("infrastructure/aws/v2.2.0")
+	g.Expect(ok).To(BeFalse())
+
+	now = now.Add(2 * time.Hour)
+
+	_, _, ok = cache.get("infrastructure/aws/v2.2.1")
+	g.Expect(ok).To(BeFalse())
+	g.Expect(cache.entries).To(BeEmpty())
+}
+
+func TestManifestsCacheKey(t *testing.T) {
+	g := NewWithT(t)
+
+	newReconciler := func(namespace, url string) *phaseReconciler {
+		return &phaseReconciler{
+			provider: &genericprovider.InfrastructureProviderWrapper{
+				InfrastructureProvider: &operatorv1.InfrastructureProvider{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "aws",
+						Namespace: namespace,
+					},
+					Spec: operatorv1.InfrastructureProviderSpec{
+						ProviderSpec: operatorv1.ProviderSpec{
+							Version: "v2.2.1",
+						},
+					},
+				},
+			},
+			providerConfig: configclient.NewProvider("aws", url, clusterctlv1.InfrastructureProviderType),
+		}
+	}
+
+	defaultURL := "https://github.com/kubernetes-sigs/cluster-api-provider-aws/releases/latest/infrastructure-components.yaml"
+	mirrorURL := "https://github.com/my-org/cluster-api-provider-aws/releases/latest/infrastructure-components.yaml"
+
+	// Providers in different namespaces share the manifests of the same version.
+	g.Expect(newReconciler("tenant-1", defaultURL).manifestsCacheKey()).To(Equal(newReconciler("tenant-2", defaultURL).manifestsCacheKey()))
+
+	// Providers fetched from different URLs don't.
+	g.Expect(newReconciler("tenant-1", defaultURL).manifestsCacheKey()).ToNot(Equal(newReconciler("tenant-2", mirrorURL).manifestsCacheKey()))
+
+	withCredentials := func(p *phaseReconciler, configSecret *operatorv1.SecretReference, caBundleRef *operatorv1.CABundleReference) *phaseReconciler {
+		spec := p.provider.GetSpec()
+		spec.ConfigSecret = configSecret
+		spec.FetchConfig = &operatorv1.FetchConfiguration{CABundleRef: caBundleRef}
+		p.provider.SetSpec(spec)
+
+		return p
+	}
+
+	tokenSecret := &operatorv1.SecretReference{Name: "github-token"}
+	privateCA := &operatorv1.CABundleReference{ConfigMap: &operatorv1.ConfigmapReference{Name: "private-ca"}}
+
+	// Providers fetched with credentials don't share the manifests with the providers fetched without them...
+	g.Expect(withCredentials(newReconciler("tenant-1", mirrorURL), tokenSecret, nil).manifestsCacheKey()).
+		ToNot(Equal(newReconciler("tenant-1", mirrorURL).manifestsCacheKey()))
+
+	// ...nor with the ones fetched with other credentials, e.g. the secret of the same name in another namespace...
+	g.Expect(withCredentials(newReconciler("tenant-1", mirrorURL), tokenSecret, nil).manifestsCacheKey()).
+		ToNot(Equal(withCredentials(newReconciler("tenant-2", mirrorURL), tokenSecret, nil).manifestsCacheKey()))
+	g.Expect(withCredentials(newReconciler("tenant-1", mirrorURL), nil, privateCA).manifestsCacheKey()).
+		ToNot(Equal(withCredentials(newReconciler("tenant-2", mirrorURL), nil, privateCA).manifestsCacheKey()))
+	g.Expect(withCredentials(newReconciler("tenant-1", mirrorURL), nil, &operatorv1.CABundleReference{PEM: "ca-1"}).manifestsCacheKey()).
+		ToNot(Equal(withCredentials(newReconciler("tenant-2", mirrorURL), nil, &operatorv1.CABundleReference{PEM: "ca-2"}).manifestsCacheKey()))
+
+	// ...but do with the ones fetched with the same credentials.
+	sharedSecret := &operatorv1.SecretReference{Name: "github-token", Namespace: "shared"}
+	g.Expect(withCredentials(newReconciler("tenant-1", mirrorURL), sharedSecret, nil).manifestsCacheKey()).
+		To(Equal(withCredentials(newReconciler("tenant-2", mirrorURL), sharedSecret, nil).manifestsCacheKey()))
+
+	// The Git credentials are part of the key too.
+	withGitSecret := func(p *phaseReconciler, secretRef *operatorv1.SecretReference) *phaseReconciler {
+		spec := p.provider.GetSpec()
+		spec.FetchConfig = &operatorv1.FetchConfiguration{Git: &operatorv1.GitSource{URL: "https://github.com/my-org/private.git", SecretRef: secretRef}}
+		p.provider.SetSpec(spec)
+
+		return p
+	}
+
+	g.Expect(withGitSecret(newReconciler("tenant-1", mirrorURL), &operatorv1.SecretReference{Name: "git-credentials"}).manifestsCacheKey()).
+		ToNot(Equal(withGitSecret(newReconciler("tenant-2", mirrorURL), nil).manifestsCacheKey()))
+}
@@ -20,16 +20,27 @@ import (
 	"bytes"
 	"compress/gzip"
 	"context"
+	"errors"
 	"fmt"
+	"net/http"
+	"sort"
+	"strings"
 
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
 	operatorv1 "sigs.k8s.io/cluster-api-operator/api/v1alpha2"
+	"sigs.k8s.io/cluster-api-operator/internal/controller/genericprovider"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/cmd/clusterctl/client/repository"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/yaml"
 )
 
 const (
@@ -38,19 +49,66 @@ const (
 	configMapNameLabel    = "provider.cluster.x-k8s.io/name"
 	operatorManagedLabel  = "managed-by.operator.cluster.x-k8s.io"
 
+	// configMapNamespaceLabel is only set on the ConfigMaps stored outside of the provider namespace, to tell
+	// apart the providers with the same name in different namespaces.
+	configMapNamespaceLabel = "provider.cluster.x-k8s.io/namespace"
+
 	compressedAnnotation = "provider.cluster.x-k8s.io/compressed"
 
-	metadataConfigMapKey            = "metadata"
-	componentsConfigMapKey          = "components"
-	additionalManifestsConfigMapKey = "manifests"
+	// etagAnnotation and sourceURLAnnotation record the ETag of a downloaded release tarball and its URL, so the
+	// next download from the same URL only gets it if it changed. Only tarballs are revalidated.
+	etagAnnotation      = "provider.cluster.x-k8s.io/etag"
+	sourceURLAnnotation = "provider.cluster.x-k8s.io/source-url"
+
+	// sourceHashAnnotation records the hash of the source the manifests were fetched from, e.g. the Git ref or the
+	// Helm chart and values, so they are fetched again when the source changes for the same provider version.
+	sourceHashAnnotation = "provider.cluster.x-k8s.io/source-hash"
+
+	metadataConfigMapKey   = "metadata"
+	componentsConfigMapKey = "components"
+
+	// manifestConfigMapKey holds the metadata and components of a release in a single multi-document YAML, for
+	// the ConfigMaps created by users instead of the metadata and components keys.
+	manifestConfigMapKey = "manifest"
 
 	maxConfigMapSize = 1 * 1024 * 1024
+
+	// gitHubReleaseNotFoundMessage is part of the error returned by the clusterctl GitHub repository for a
+	// version without a release.
+	gitHubReleaseNotFoundMessage = "release not found for version"
 )
 
-// downloadManifests downloads CAPI manifests from a url.
+var (
+	// errVersionNotFound is returned by the repositories implemented by the operator for a missing version.
+	errVersionNotFound = errors.New("version not found")
+
+	// errNotModified is returned by the conditional downloads if the manifests didn't change.
+	errNotModified = errors.New("not modified")
+)
+
+// downloadManifests downloads CAPI manifests from a url, retrying with an exponential backoff on failure.
 func (p *phaseReconciler) downloadManifests(ctx context.Context) (reconcile.Result, error) {
+	res, err := p.downloadProviderManifests(ctx)
+
+	return p.scheduleDownloadRetry(ctx, res, err)
+}
+
+// downloadProviderManifests downloads the provider manifests and stores them in a ConfigMap, unless they
+// are already stored.
+func (p *phaseReconciler) downloadProviderManifests(ctx context.Context) (reconcile.Result, error) {
 	log := ctrl.LoggerFrom(ctx)
 
+	// The overrides take precedence over the custom config map and the url.
+	if err := p.loadOverrides(ctx); err != nil {
+		return reconcile.Result{}, wrapPhaseError(err, operatorv1.DownloadFailedReason)
+	}
+
+	if p.overrides.complete() {
+		log.V(5).Info("All the provider manifests are overridden, skip downloading provider manifests")
+
+		return reconcile.Result{}, nil
+	}
+
 	// Return immediately if a custom config map is used instead of a url.
 	if p.provider.GetSpec().FetchConfig != nil && p.provider.GetSpec().FetchConfig.Selector != nil {
 		log.V(5).Info("Custom config map is used, skip downloading provider manifests")
@@ -58,6 +116,23 @@ func (p *phaseReconciler) downloadManifests(ctx context.Context) (reconcile.Resu
 		return reconcile.Result{}, nil
 	}
 
+	p.fetchedFrom = p.providerConfig.URL()
+	if isGitSource(p.provider.GetSpec()) {
+		p.fetchedFrom = fmt.Sprintf("Git %s@%s", p.provider.GetSpec().FetchConfig.Git.URL, gitRef(p.provider.GetSpec()))
+	}
+
+	if isHelmSource(p.provider.GetSpec()) {
+		helm := p.provider.GetSpec().FetchConfig.Helm
+		p.fetchedFrom = fmt.Sprintf("Helm chart %s %s from %s", helm.Chart, helmChartVersion(p.provider.GetSpec()), helm.RepoURL)
+	}
+
+	var err error
+
+	p.sourceHash, err = p.manifestsSourceHash(ctx)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+
 	// Check if manifests are already downloaded and stored in a configmap
 	labelSelector := metav1.LabelSelector{
 		MatchLabels: p.prepareConfigMapLabels(),
@@ -74,13 +149,135 @@ func (p *phaseReconciler) downloadManifests(ctx context.Context) (reconcile.Resu
 		return reconcile.Result{}, nil
 	}
 
-	log.Info("Downloading provider manifests")
+	var (
+		metadata, components []byte
+		cached               bool
+	)
+
+	// The same provider version can be installed several times, e.g. in multi-tenant setups, so try to reuse
+	// the manifests downloaded for another provider first. The repository picks the version if it's not set.
+	if p.provider.GetSpec().Version != "" {
+		metadata, components, cached = sharedManifestsCache.get(p.manifestsCacheKey())
+	}
+
+	if cached {
+		log.Info("Using cached provider manifests")
+	} else {
+		// Don't let all the providers download at once, e.g. when the operator starts. The jitter spreads
+		// the retries of the providers waiting for a slot.
+		if !p.downloadLimiter.tryAcquire(providerKey(p.provider)) {
+			log.Info("Too many concurrent downloads, waiting for a download slot")
+
+			return reconcile.Result{RequeueAfter: wait.Jitter(downloadThrottledRequeueAfter, 1.0)}, nil
+		}
+		defer p.downloadLimiter.release()
+
+		log.Info("Downloading provider manifests")
+
+		httpClient, err := p.newRepositoryHTTPClient(ctx)
+		if err != nil {
+			err = fmt.Errorf("failed to load CA bundle for provider %q: %w", p.provider.GetName(), err)
+
+			return reconcile.Result{}, wrapPhaseError(err, operatorv1.DownloadFailedReason)
+		}
+
+		switch {
+		case isGitSource(p.provider.GetSpec()):
+			metadata, components, err = p.fetchGitManifests(ctx)
+		case isHelmSource(p.provider.GetSpec()):
+			metadata, components, err = p.fetchHelmManifests(ctx)
+		case isTarballURL(p.providerConfig.URL()):
+			metadata, components, err = p.fetchTarballManifests(ctx, httpClient)
+		default:
+			metadata, components, err = p.fetchRepositoryManifests(httpClient)
+		}
+
+		if err != nil {
+			return reconcile.Result{}, err
+		}
+
+		// Catch corrupt or truncated downloads here, before they are stored and applied.
+		if err := validateComponents(components); err != nil {
+			return reconcile.Result{}, &PhaseError{
+				Err:      fmt.Errorf("invalid components for provider %q: %w", p.provider.GetName(), err),
+				Type:     operatorv1.PreflightCheckCondition,
+				Reason:   operatorv1.DecodeFailedReason,
+				Severity: clusterv1.ConditionSeverityError,
+			}
+		}
+
+		sharedManifestsCache.set(p.manifestsCacheKey(), metadata, components)
+	}
+
+	withCompression := needToCompress(metadata, components)
+
+	if err := p.createManifestsConfigMap(ctx, metadata, components, withCompression); err != nil {
+		err = fmt.Errorf("failed to create config map for provider %q: %w", p.provider.GetName(), err)
+
+		return reconcile.Result{}, wrapPhaseError(err, operatorv1.DownloadFailedReason)
+	}
+
+	return reconcile.Result{}, nil
+}
+
+// validateComponents checks that every document of the components YAML decodes into a Kubernetes object,
+// reporting the line the first invalid document starts at.
+func validateComponents(components []byte) error {
+	var doc []byte
+
+	docStart := 1
+
+	for i, line := range bytes.SplitAfter(components, []byte("\n")) {
+		if isYAMLDocumentSeparator(line) {
+			if err := validateComponentsDocument(doc, docStart); err != nil {
+				return err
+			}
+
+			doc = nil
+			docStart = i + 2
+
+			continue
+		}
+
+		doc = append(doc, line...)
+	}
+
+	return validateComponentsDocument(doc, docStart)
+}
+
+// isYAMLDocumentSeparator returns true if the line separates two YAML documents,
+// following the same rules as the YAML reader used for applying the components.
+func isYAMLDocumentSeparator(line []byte) bool {
+	return bytes.HasPrefix(line, []byte("---")) && len(bytes.TrimSpace(line[3:])) == 0
+}
+
+// validateComponentsDocument checks that a single YAML document is empty or decodes into a Kubernetes object.
+func validateComponentsDocument(doc []byte, line int) error {
+	obj := map[string]interface{}{}
+	if err := yaml.Unmarshal(doc, &obj); err != nil {
+		return fmt.Errorf("failed to parse the document starting at line %d: %w", line, err)
+	}
+
+	// Documents with only comments or whitespace are skipped on apply too.
+	if len(obj) == 0 {
+		return nil
+	}
+
+	u := unstructured.Unstructured{Object: obj}
+	if u.GetAPIVersion() == "" || u.GetKind() == "" {
+		return fmt.Errorf("the document starting at line %d is not a Kubernetes object: apiVersion and kind must be set", line)
+	}
 
-	repo, err := repositoryFactory(p.providerConfig, p.configClient.Variables())
+	return nil
+}
+
+// fetchRepositoryManifests fetches the provider metadata and components files from the provider repository.
+func (p *phaseReconciler) fetchRepositoryManifests(httpClient *http.Client) ([]byte, []byte, error) {
+	repo, err := repositoryFactory(p.providerConfig, p.configClient.Variables(), httpClient)
 	if err != nil {
 		err = fmt.Errorf("failed to create repo from provider url for provider %q: %w", p.provider.GetName(), err)
 
-		return reconcile.Result{}, wrapPhaseError(err, operatorv1.ComponentsFetchErrorReason)
+		return nil, nil, wrapPhaseError(err, operatorv1.DownloadFailedReason)
 	}
 
 	spec := p.provider.GetSpec()
@@ -94,35 +291,120 @@ func (p *phaseReconciler) downloadManifests(ctx context.Context) (reconcile.Resu
 	}
 
 	// Fetch the provider metadata and components yaml files from the provided repository GitHub/GitLab.
-	metadataFile, err := repo.GetFile(spec.Version, metadataFile)
+	metadataPath := p.metadataPath()
+
+	metadata, err := repo.GetFile(spec.Version, metadataPath)
+	if err != nil && isVersionNotFound(err) {
+		return nil, nil, &PhaseError{
+			Err:      fmt.Errorf("version %s not found in the repository for provider %q, it may not be published yet: %w", spec.Version, p.provider.GetName(), err),
+			Type:     operatorv1.ProviderInstalledCondition,
+			Reason:   operatorv1.VersionNotFoundReason,
+			Severity: clusterv1.ConditionSeverityWarning,
+		}
+	}
+
 	if err != nil {
-		err = fmt.Errorf("failed to read %q from the repository for provider %q: %w", metadataFile, p.provider.GetName(), err)
+		err = fmt.Errorf("failed to read metadata file %q from the repository for provider %q: %w", metadataPath, p.provider.GetName(), err)
 
-		return reconcile.Result{}, wrapPhaseError(err, operatorv1.ComponentsFetchErrorReason)
+		return nil, nil, wrapPhaseError(err, operatorv1.DownloadFailedReason)
 	}
 
-	componentsFile, err := repo.GetFile(spec.Version, repo.ComponentsPath())
+	componentsPath := p.componentsPath(repo)
+
+	components, err := repo.GetFile(spec.Version, componentsPath)
 	if err != nil {
-		err = fmt.Errorf("failed to read %q from the repository for provider %q: %w", componentsFile, p.provider.GetName(), err)
+		err = fmt.Errorf("failed to read components file %q from the repository for provider %q: %w", componentsPath, p.provider.GetName(), err)
 
-		return reconcile.Result{}, wrapPhaseError(err, operatorv1.ComponentsFetchErrorReason)
+		return nil, nil, wrapPhaseError(err, operatorv1.DownloadFailedReason)
 	}
 
-	withCompression := needToCompress(metadataFile, componentsFile)
+	return metadata, components, nil
+}
 
-	if err := p.createManifestsConfigMap(ctx, metadataFile, componentsFile, withCompression); err != nil {
-		err = fmt.Errorf("failed to create config map for provider %q: %w", p.provider.GetName(), err)
+// isVersionNotFound returns true if the repository doesn't have the requested version. The clusterctl GitHub
+// repository doesn't export its not found error, so its message is matched instead.
+func isVersionNotFound(err error) bool {
+	return errors.Is(err, errVersionNotFound) || strings.Contains(err.Error(), gitHubReleaseNotFoundMessage)
+}
 
-		return reconcile.Result{}, wrapPhaseError(err, operatorv1.ComponentsFetchErrorReason)
+// metadataPath returns the name of the metadata file to fetch from the provider repository.
+func (p *phaseReconciler) metadataPath() string {
+	if fetchConfig := p.provider.GetSpec().FetchConfig; fetchConfig != nil && fetchConfig.MetadataPath != "" {
+		return fetchConfig.MetadataPath
 	}
 
-	return reconcile.Result{}, nil
+	return metadataFile
+}
+
+// componentsPath returns the name of the components file to fetch from the provider repository.
+func (p *phaseReconciler) componentsPath(repo repository.Repository) string {
+	if fetchConfig := p.provider.GetSpec().FetchConfig; fetchConfig != nil && fetchConfig.ComponentsPath != "" {
+		return fetchConfig.ComponentsPath
+	}
+
+	return repo.ComponentsPath()
+}
+
+// manifestsSource identifies the source the manifests of the provider version are fetched from.
+type manifestsSource struct {
+	URL            string `json:"url,omitempty"`
+	MetadataPath   string `json:"metadataPath,omitempty"`
+	ComponentsPath string `json:"componentsPath,omitempty"`
+	GitURL         string `json:"gitURL,omitempty"`
+	GitRef         string `json:"gitRef,omitempty"`
+	GitPath        string `json:"gitPath,omitempty"`
+	HelmRepoURL    string `json:"helmRepoURL,omitempty"`
+	HelmChart      string `json:"helmChart,omitempty"`
+	HelmVersion    string `json:"helmVersion,omitempty"`
+	HelmValues     []byte `json:"helmValues,omitempty"`
+}
+
+// manifestsSourceHash returns the hash of the source the manifests of the provider version are fetched from: the
+// URL, the Git URL, ref and path, or the Helm chart, its repository, version and values, read from the referenced
+// ConfigMap or Secret.
+func (p *phaseReconciler) manifestsSourceHash(ctx context.Context) (string, error) {
+	spec := p.provider.GetSpec()
+	source := manifestsSource{}
+
+	if spec.FetchConfig != nil {
+		source.MetadataPath = spec.FetchConfig.MetadataPath
+		source.ComponentsPath = spec.FetchConfig.ComponentsPath
+	}
+
+	switch {
+	case isGitSource(spec):
+		source.GitURL = spec.FetchConfig.Git.URL
+		source.GitRef = gitRef(spec)
+		source.GitPath = spec.FetchConfig.Git.Path
+	case isHelmSource(spec):
+		source.HelmRepoURL = spec.FetchConfig.Helm.RepoURL
+		source.HelmChart = spec.FetchConfig.Helm.Chart
+		source.HelmVersion = helmChartVersion(spec)
+
+		if spec.FetchConfig.Helm.ValuesFrom != nil {
+			values, err := p.helmValues(ctx)
+			if err != nil {
+				return "", wrapHelmError(fmt.Errorf("failed to load Helm values for provider %q: %w", p.provider.GetName(), err))
+			}
+
+			source.HelmValues = values
+		}
+	default:
+		source.URL = p.providerConfig.URL()
+	}
+
+	return calculateHash(source)
 }
 
 // checkConfigMapExists checks if a config map exists in Kubernetes with the given LabelSelector.
+// The manifests ConfigMaps are created in the manifests namespace, so only that namespace is looked up,
+// and instances of the provider in other namespaces don't get in the way. Once the source hash is known, a
+// config map holding manifests fetched from another source, or stored before the hash was recorded, doesn't
+// count, so the manifests are fetched again.
 func (p *phaseReconciler) checkConfigMapExists(ctx context.Context, labelSelector metav1.LabelSelector) (bool, error) {
 	labelSet := labels.Set(labelSelector.MatchLabels)
 	listOpts := []client.ListOption{
+		client.InNamespace(manifestsNamespace(p.provider)),
 		client.MatchingLabelsSelector{Selector: labels.SelectorFromSet(labelSet)},
 	}
 
@@ -136,27 +418,149 @@ func (p *phaseReconciler) checkConfigMapExists(ctx context.Context, labelSelecto
 		return false, fmt.Errorf("more than one config maps were found for given selector: %v", labelSelector.String())
 	}
 
-	return len(configMapList.Items) == 1, nil
+	if len(configMapList.Items) == 0 {
+		return false, nil
+	}
+
+	if p.sourceHash != "" && configMapList.Items[0].Annotations[sourceHashAnnotation] != p.sourceHash {
+		ctrl.LoggerFrom(ctx).Info("Config map with downloaded manifests was fetched from another source",
+			"configMap", client.ObjectKeyFromObject(&configMapList.Items[0]))
+
+		return false, nil
+	}
+
+	return true, nil
 }
 
 // prepareConfigMapLabels returns labels that identify a config map with downloaded manifests.
 func (p *phaseReconciler) prepareConfigMapLabels() map[string]string {
-	return map[string]string{
-		configMapVersionLabel: p.provider.GetSpec().Version,
-		configMapTypeLabel:    p.provider.GetType(),
-		configMapNameLabel:    p.provider.GetName(),
-		operatorManagedLabel:  "true",
+	labels := manifestsConfigMapLabels(p.provider)
+	labels[configMapVersionLabel] = p.provider.GetSpec().Version
+
+	return labels
+}
+
+// manifestsConfigMapLabels returns the labels identifying the config maps with manifests downloaded for the
+// provider, whatever their version.
+func manifestsConfigMapLabels(provider genericprovider.GenericProvider) map[string]string {
+	labels := map[string]string{
+		configMapTypeLabel:   provider.GetType(),
+		configMapNameLabel:   provider.GetName(),
+		operatorManagedLabel: "true",
+	}
+
+	if isCrossNamespaceManifests(provider) {
+		labels[configMapNamespaceLabel] = provider.GetNamespace()
+	}
+
+	return labels
+}
+
+// manifestsNamespace returns the namespace the config maps with downloaded manifests are stored in.
+func manifestsNamespace(provider genericprovider.GenericProvider) string {
+	if fetchConfig := provider.GetSpec().FetchConfig; fetchConfig != nil && fetchConfig.ConfigMapNamespace != "" {
+		return fetchConfig.ConfigMapNamespace
+	}
+
+	return provider.GetNamespace()
+}
+
+// isCrossNamespaceManifests returns true if the config maps with downloaded manifests are stored outside of
+// the provider namespace, so they can't be owned by the provider.
+func isCrossNamespaceManifests(provider genericprovider.GenericProvider) bool {
+	return manifestsNamespace(provider) != provider.GetNamespace()
+}
+
+// pruneManifestHistory deletes the oldest ConfigMaps with manifests downloaded for previous versions
+// of the provider, keeping as many of them as requested by the provider spec.
+func (p *phaseReconciler) pruneManifestHistory(ctx context.Context) (reconcile.Result, error) {
+	log := ctrl.LoggerFrom(ctx)
+
+	retain := p.provider.GetSpec().RetainManifestHistory
+	if retain == nil {
+		return reconcile.Result{}, nil
+	}
+
+	var configMapList corev1.ConfigMapList
+
+	if err := p.ctrlClient.List(ctx, &configMapList, client.InNamespace(manifestsNamespace(p.provider)),
+		client.MatchingLabels(manifestsConfigMapLabels(p.provider))); err != nil {
+		return reconcile.Result{}, fmt.Errorf("failed to list ConfigMaps with downloaded manifests: %w", err)
+	}
+
+	history := []corev1.ConfigMap{}
+
+	for _, cm := range configMapList.Items {
+		if cm.Labels[configMapVersionLabel] != p.provider.GetSpec().Version {
+			history = append(history, cm)
+		}
+	}
+
+	if len(history) <= *retain {
+		return reconcile.Result{}, nil
+	}
+
+	// Keep the most recently downloaded manifests.
+	sort.Slice(history, func(i, j int) bool {
+		return history[j].CreationTimestamp.Before(&history[i].CreationTimestamp)
+	})
+
+	for i := *retain; i < len(history); i++ {
+		cm := &history[i]
+
+		log.Info("Deleting manifests of a previous version", "configMap", cm.Name, "previousVersion", cm.Labels[configMapVersionLabel])
+
+		if err := p.ctrlClient.Delete(ctx, cm); err != nil && !apierrors.IsNotFound(err) {
+			return reconcile.Result{}, fmt.Errorf("failed to delete ConfigMap %q with downloaded manifests: %w", cm.Name, err)
+		}
+	}
+
+	return reconcile.Result{}, nil
+}
+
+// deleteManifestsConfigMaps deletes the config maps with manifests downloaded for the provider when they are stored
+// in another namespace, as they can't be garbage collected with the provider. The ones in the provider namespace
+// are owned by the provider.
+func (p *phaseReconciler) deleteManifestsConfigMaps(ctx context.Context) (reconcile.Result, error) {
+	log := ctrl.LoggerFrom(ctx)
+
+	if !isCrossNamespaceManifests(p.provider) {
+		return reconcile.Result{}, nil
+	}
+
+	var configMapList corev1.ConfigMapList
+
+	if err := p.ctrlClient.List(ctx, &configMapList, client.InNamespace(manifestsNamespace(p.provider)),
+		client.MatchingLabels(manifestsConfigMapLabels(p.provider))); err != nil {
+		return reconcile.Result{}, fmt.Errorf("failed to list ConfigMaps with downloaded manifests: %w", err)
+	}
+
+	for i := range configMapList.Items {
+		cm := &configMapList.Items[i]
+
+		log.Info("Deleting downloaded manifests", "configMap", client.ObjectKeyFromObject(cm))
+
+		if err := p.ctrlClient.Delete(ctx, cm); err != nil && !apierrors.IsNotFound(err) {
+			return reconcile.Result{}, fmt.Errorf("failed to delete ConfigMap %s with downloaded manifests: %w", client.ObjectKeyFromObject(cm), err)
+		}
 	}
+
+	return reconcile.Result{}, nil
 }
 
-// createManifestsConfigMap creates a config map with downloaded manifests.
+// createManifestsConfigMap creates or updates the config map with downloaded manifests.
 func (p *phaseReconciler) createManifestsConfigMap(ctx context.Context, metadata, components []byte, compress bool) error {
 	configMapName := fmt.Sprintf("%s-%s-%s", p.provider.GetType(), p.provider.GetName(), p.provider.GetSpec().Version)
 
+	// Providers with the same name in different namespaces can share the manifests namespace.
+	if isCrossNamespaceManifests(p.provider) {
+		configMapName = p.provider.GetNamespace() + "-" + configMapName
+	}
+
 	configMap := &corev1.ConfigMap{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      configMapName,
-			Namespace: p.provider.GetNamespace(),
+			Namespace: manifestsNamespace(p.provider),
 			Labels:    p.prepareConfigMapLabels(),
 		},
 		Data: map[string]string{
@@ -188,22 +592,121 @@ func (p *phaseReconciler) createManifestsConfigMap(ctx context.Context, metadata
 		configMap.SetAnnotations(map[string]string{compressedAnnotation: "true"})
 	}
 
-	gvk := p.provider.GetObjectKind().GroupVersionKind()
+	if p.sourceHash != "" {
+		annotations := configMap.GetAnnotations()
+		if annotations == nil {
+			annotations = map[string]string{}
+		}
 
-	configMap.SetOwnerReferences([]metav1.OwnerReference{
-		{
-			APIVersion: gvk.GroupVersion().String(),
-			Kind:       gvk.Kind,
-			Name:       p.provider.GetName(),
-			UID:        p.provider.GetUID(),
-		},
-	})
+		annotations[sourceHashAnnotation] = p.sourceHash
+		configMap.SetAnnotations(annotations)
+	}
+
+	// Only release tarballs are revalidated, and servers not setting ETags are downloaded in full every time.
+	if p.fetchedETag != "" {
+		annotations := configMap.GetAnnotations()
+		if annotations == nil {
+			annotations = map[string]string{}
+		}
 
-	if err := p.ctrlClient.Create(ctx, configMap); err != nil && !apierrors.IsAlreadyExists(err) {
+		annotations[etagAnnotation] = p.fetchedETag
+		annotations[sourceURLAnnotation] = p.providerConfig.URL()
+		configMap.SetAnnotations(annotations)
+	}
+
+	// Owner references can't cross namespaces, the config maps in another namespace are deleted with the provider instead.
+	if !isCrossNamespaceManifests(p.provider) {
+		gvk := p.provider.GetObjectKind().GroupVersionKind()
+
+		configMap.SetOwnerReferences([]metav1.OwnerReference{
+			{
+				APIVersion: gvk.GroupVersion().String(),
+				Kind:       gvk.Kind,
+				Name:       p.provider.GetName(),
+				UID:        p.provider.GetUID(),
+			},
+		})
+	}
+
+	err := p.ctrlClient.Create(ctx, configMap)
+	if err == nil || !apierrors.IsAlreadyExists(err) {
 		return err
 	}
 
-	return nil
+	// The ConfigMap can be left over by a previous reconcile that didn't complete, or by a previous instance
+	// of the provider, so update it with the downloaded manifests unless it belongs to another provider.
+	existing := &corev1.ConfigMap{}
+	if err := p.ctrlClient.Get(ctx, client.ObjectKeyFromObject(configMap), existing); err != nil {
+		return err
+	}
+
+	if !p.ownsManifestsConfigMap(existing) {
+		return fmt.Errorf("config map %s/%s already exists and doesn't belong to provider %s", existing.Namespace, existing.Name, p.provider.GetName())
+	}
+
+	patchBase := client.MergeFrom(existing.DeepCopy())
+
+	existing.Labels = configMap.Labels
+	existing.Annotations = configMap.Annotations
+	existing.OwnerReferences = configMap.OwnerReferences
+	existing.Data = configMap.Data
+	existing.BinaryData = configMap.BinaryData
+
+	return p.ctrlClient.Patch(ctx, existing, patchBase)
+}
+
+// manifestsConfigMapFromURL returns the most recent ConfigMap with manifests downloaded for the provider from the URL
+// with an ETag, whatever their version, or nil if there is none.
+func (p *phaseReconciler) manifestsConfigMapFromURL(ctx context.Context, url string) (*corev1.ConfigMap, error) {
+	var configMapList corev1.ConfigMapList
+
+	if err := p.ctrlClient.List(ctx, &configMapList, client.InNamespace(manifestsNamespace(p.provider)),
+		client.MatchingLabels(manifestsConfigMapLabels(p.provider))); err != nil {
+		return nil, fmt.Errorf("failed to list ConfigMaps with downloaded manifests: %w", err)
+	}
+
+	var found *corev1.ConfigMap
+
+	for i := range configMapList.Items {
+		cm := &configMapList.Items[i]
+
+		if cm.Annotations[sourceURLAnnotation] != url || cm.Annotations[etagAnnotation] == "" {
+			continue
+		}
+
+		if found == nil || found.CreationTimestamp.Before(&cm.CreationTimestamp) {
+			found = cm
+		}
+	}
+
+	return found, nil
+}
+
+// ownsManifestsConfigMap returns true if the ConfigMap holds manifests downloaded for the provider, and is
+// not owned by another provider.
+func (p *phaseReconciler) ownsManifestsConfigMap(configMap *corev1.ConfigMap) bool {
+	if configMap.Labels[configMapTypeLabel] != p.provider.GetType() || configMap.Labels[configMapNameLabel] != p.provider.GetName() {
+		return false
+	}
+
+	if configMap.Labels[configMapNamespaceLabel] != manifestsConfigMapLabels(p.provider)[configMapNamespaceLabel] {
+		return false
+	}
+
+	gvk := p.provider.GetObjectKind().GroupVersionKind()
+
+	for _, ref := range configMap.OwnerReferences {
+		refGV, err := schema.ParseGroupVersion(ref.APIVersion)
+		if err != nil || refGV.Group != operatorv1.GroupVersion.Group {
+			continue
+		}
+
+		if ref.Kind != gvk.Kind || ref.Name != p.provider.GetName() {
+			return false
+		}
+	}
+
+	return true
 }
 
 // needToCompress checks whether the input data exceeds the maximum configmap
@@ -18,10 +18,17 @@ package controller
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"testing"
+	"time"
 
 	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/cluster-api/cmd/clusterctl/client/repository"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 
 	operatorv1 "sigs.k8s.io/cluster-api-operator/api/v1alpha2"
@@ -70,3 +77,594 @@ func TestManifestsDownloader(t *testing.T) {
 
 	g.Expect(exists).To(BeTrue())
 }
+
+func TestCheckConfigMapExists(t *testing.T) {
+	provider := &genericprovider.CoreProviderWrapper{
+		CoreProvider: &operatorv1.CoreProvider{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "cluster-api",
+				Namespace: "tenant-a",
+			},
+			Spec: operatorv1.CoreProviderSpec{
+				ProviderSpec: operatorv1.ProviderSpec{
+					Version: "v1.4.3",
+				},
+			},
+		},
+	}
+
+	p := &phaseReconciler{provider: provider}
+
+	newConfigMap := func(namespace, name string) *corev1.ConfigMap {
+		return &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: namespace,
+				Labels:    p.prepareConfigMapLabels(),
+			},
+		}
+	}
+
+	testCases := []struct {
+		name        string
+		configMaps  []*corev1.ConfigMap
+		expected    bool
+		expectedErr bool
+	}{
+		{
+			name: "No ConfigMap",
+		},
+		{
+			name:       "ConfigMap in the provider namespace",
+			configMaps: []*corev1.ConfigMap{newConfigMap("tenant-a", "v1.4.3")},
+			expected:   true,
+		},
+		{
+			name:       "ConfigMap of the same provider in another namespace is ignored",
+			configMaps: []*corev1.ConfigMap{newConfigMap("tenant-b", "v1.4.3")},
+		},
+		{
+			name:       "ConfigMaps of the same provider in several namespaces",
+			configMaps: []*corev1.ConfigMap{newConfigMap("tenant-a", "v1.4.3"), newConfigMap("tenant-b", "v1.4.3")},
+			expected:   true,
+		},
+		{
+			name:        "Several ConfigMaps in the provider namespace",
+			configMaps:  []*corev1.ConfigMap{newConfigMap("tenant-a", "v1.4.3"), newConfigMap("tenant-a", "copy")},
+			expectedErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			builder := fake.NewClientBuilder()
+			for _, cm := range tc.configMaps {
+				builder = builder.WithObjects(cm)
+			}
+
+			p.ctrlClient = builder.Build()
+
+			exists, err := p.checkConfigMapExists(context.Background(), metav1.LabelSelector{MatchLabels: p.prepareConfigMapLabels()})
+			if tc.expectedErr {
+				g.Expect(err).To(HaveOccurred())
+
+				return
+			}
+
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(exists).To(Equal(tc.expected))
+		})
+	}
+}
+
+func TestManifestsSourceHash(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	values := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "aws-values", Namespace: "capa-system"},
+		Data:       map[string]string{defaultHelmValuesKey: "replicas: 1"},
+	}
+
+	fakeclient := fake.NewClientBuilder().WithObjects(values).Build()
+
+	sourceHash := func(fetchConfig *operatorv1.FetchConfiguration) string {
+		p := &phaseReconciler{
+			ctrlClient: fakeclient,
+			provider: &genericprovider.InfrastructureProviderWrapper{
+				InfrastructureProvider: &operatorv1.InfrastructureProvider{
+					ObjectMeta: metav1.ObjectMeta{Name: "aws", Namespace: "capa-system"},
+					Spec: operatorv1.InfrastructureProviderSpec{
+						ProviderSpec: operatorv1.ProviderSpec{Version: "v2.1.4", FetchConfig: fetchConfig},
+					},
+				},
+			},
+		}
+
+		hash, err := p.manifestsSourceHash(ctx)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(hash).ToNot(BeEmpty())
+
+		return hash
+	}
+
+	gitHash := sourceHash(&operatorv1.FetchConfiguration{Git: &operatorv1.GitSource{URL: "https://github.com/owner/repo.git", Path: "manifests"}})
+	g.Expect(sourceHash(&operatorv1.FetchConfiguration{Git: &operatorv1.GitSource{URL: "https://github.com/owner/repo.git", Path: "manifests"}})).To(Equal(gitHash))
+	g.Expect(sourceHash(&operatorv1.FetchConfiguration{Git: &operatorv1.GitSource{URL: "https://github.com/owner/repo.git", Ref: "main", Path: "manifests"}})).ToNot(Equal(gitHash))
+	g.Expect(sourceHash(&operatorv1.FetchConfiguration{Git: &operatorv1.GitSource{URL: "https://github.com/owner/repo.git", Path: "custom"}})).ToNot(Equal(gitHash))
+	g.Expect(sourceHash(&operatorv1.FetchConfiguration{Git: &operatorv1.GitSource{URL: "https://github.com/owner/fork.git", Path: "manifests"}})).ToNot(Equal(gitHash))
+
+	helm := func() *operatorv1.FetchConfiguration {
+		return &operatorv1.FetchConfiguration{Helm: &operatorv1.HelmSource{
+			RepoURL:    "https://charts.example.com",
+			Chart:      "aws",
+			ValuesFrom: &operatorv1.HelmValuesReference{ConfigMap: &operatorv1.ConfigmapReference{Name: "aws-values"}},
+		}}
+	}
+
+	helmHash := sourceHash(helm())
+	g.Expect(helmHash).ToNot(Equal(gitHash))
+
+	otherChart := helm()
+	otherChart.Helm.Chart = "aws-fork"
+	g.Expect(sourceHash(otherChart)).ToNot(Equal(helmHash))
+
+	// The values data is part of the source.
+	values.Data[defaultHelmValuesKey] = "replicas: 2"
+	g.Expect(fakeclient.Update(ctx, values)).To(Succeed())
+	g.Expect(sourceHash(helm())).ToNot(Equal(helmHash))
+}
+
+func TestManifestsSourceHashMismatch(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	fakeclient := fake.NewClientBuilder().Build()
+
+	p := &phaseReconciler{
+		ctrlClient: fakeclient,
+		provider: &genericprovider.InfrastructureProviderWrapper{
+			InfrastructureProvider: &operatorv1.InfrastructureProvider{
+				ObjectMeta: metav1.ObjectMeta{Name: "aws", Namespace: "capa-system", UID: "provider-uid"},
+				Spec: operatorv1.InfrastructureProviderSpec{
+					ProviderSpec: operatorv1.ProviderSpec{Version: "v2.1.4"},
+				},
+			},
+		},
+		sourceHash: "old-source",
+	}
+	selector := metav1.LabelSelector{MatchLabels: p.prepareConfigMapLabels()}
+
+	g.Expect(p.createManifestsConfigMap(ctx, []byte("metadata"), []byte("old components"), false)).To(Succeed())
+
+	exists, err := p.checkConfigMapExists(ctx, selector)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(exists).To(BeTrue())
+
+	// The manifests fetched from another source, e.g. another Git ref for the same version, aren't reused...
+	p.sourceHash = "new-source"
+
+	exists, err = p.checkConfigMapExists(ctx, selector)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(exists).To(BeFalse())
+
+	// ...but replaced with the ones fetched from the new source.
+	g.Expect(p.createManifestsConfigMap(ctx, []byte("metadata"), []byte("new components"), false)).To(Succeed())
+
+	configMap := &corev1.ConfigMap{}
+	g.Expect(fakeclient.Get(ctx, client.ObjectKey{Namespace: "capa-system", Name: "infrastructure-aws-v2.1.4"}, configMap)).To(Succeed())
+	g.Expect(configMap.Annotations).To(HaveKeyWithValue(sourceHashAnnotation, "new-source"))
+	g.Expect(configMap.Data).To(HaveKeyWithValue(componentsConfigMapKey, "new components"))
+
+	exists, err = p.checkConfigMapExists(ctx, selector)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(exists).To(BeTrue())
+}
+
+func TestManifestPaths(t *testing.T) {
+	testCases := []struct {
+		name                   string
+		fetchConfig            *operatorv1.FetchConfiguration
+		expectedMetadataPath   string
+		expectedComponentsPath string
+	}{
+		{
+			name:                   "no fetch config",
+			expectedMetadataPath:   "metadata.yaml",
+			expectedComponentsPath: "core-components.yaml",
+		},
+		{
+			name:                   "fetch config without overrides",
+			fetchConfig:            &operatorv1.FetchConfiguration{URL: "https://github.com/owner/repo/releases"},
+			expectedMetadataPath:   "metadata.yaml",
+			expectedComponentsPath: "core-components.yaml",
+		},
+		{
+			name: "fetch config with overrides",
+			fetchConfig: &operatorv1.FetchConfiguration{
+				URL:            "https://github.com/owner/repo/releases",
+				ComponentsPath: "capi-components.yaml",
+				MetadataPath:   "capi-metadata.yaml",
+			},
+			expectedMetadataPath:   "capi-metadata.yaml",
+			expectedComponentsPath: "capi-components.yaml",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			p := &phaseReconciler{
+				provider: &genericprovider.CoreProviderWrapper{
+					CoreProvider: &operatorv1.CoreProvider{
+						Spec: operatorv1.CoreProviderSpec{
+							ProviderSpec: operatorv1.ProviderSpec{
+								FetchConfig: tc.fetchConfig,
+							},
+						},
+					},
+				},
+			}
+
+			repo := repository.NewMemoryRepository().WithPaths("", "core-components.yaml")
+
+			g.Expect(p.metadataPath()).To(Equal(tc.expectedMetadataPath))
+			g.Expect(p.componentsPath(repo)).To(Equal(tc.expectedComponentsPath))
+		})
+	}
+}
+
+func TestIsVersionNotFound(t *testing.T) {
+	g := NewWithT(t)
+
+	g.Expect(isVersionNotFound(fmt.Errorf("failed to get file: %w", errVersionNotFound))).To(BeTrue())
+	g.Expect(isVersionNotFound(errors.New("release not found for version v2.2.0, please retry later or set \"GOPROXY=off\" to get the current stable release: 404 Not Found"))).
+		To(BeTrue())
+	g.Expect(isVersionNotFound(errors.New("failed to get GitHub release v2.2.0: connection refused"))).To(BeFalse())
+}
+
+func TestValidateComponents(t *testing.T) {
+	testCases := []struct {
+		name          string
+		components    string
+		expectedError string
+	}{
+		{
+			name: "valid components",
+			components: `# Provider components
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: capi-system
+---
+---
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: capi-manager
+  namespace: ${NAMESPACE:=capi-system}
+`,
+		},
+		{
+			name: "malformed document",
+			components: `apiVersion: v1
+kind: Namespace
+metadata:
+  name: capi-system
+---
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+	name: capi-manager
+`,
+			expectedError: "failed to parse the document starting at line 6",
+		},
+		{
+			name: "truncated document",
+			components: `apiVersion: v1
+kind: Namespace
+metadata:
+  name: capi-system
+---
+apiVersion: apps/v1
+`,
+			expectedError: "the document starting at line 6 is not a Kubernetes object",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			err := validateComponents([]byte(tc.components))
+			if tc.expectedError == "" {
+				g.Expect(err).ToNot(HaveOccurred())
+
+				return
+			}
+
+			g.Expect(err).To(MatchError(ContainSubstring(tc.expectedError)))
+		})
+	}
+}
+
+func TestPruneManifestHistory(t *testing.T) {
+	namespace := "test-namespace"
+	now := time.Now()
+
+	manifestsConfigMap := func(version string, age time.Duration) *corev1.ConfigMap {
+		return &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              "core-cluster-api-" + version,
+				Namespace:         namespace,
+				CreationTimestamp: metav1.NewTime(now.Add(-age)),
+				Labels: map[string]string{
+					configMapVersionLabel: version,
+					configMapTypeLabel:    "core",
+					configMapNameLabel:    "cluster-api",
+					operatorManagedLabel:  "true",
+				},
+			},
+		}
+	}
+
+	testCases := []struct {
+		name             string
+		retain           *int
+		expectedVersions []string
+	}{
+		{
+			name:             "history is kept when retention is not set",
+			expectedVersions: []string{"v1.4.0", "v1.4.1", "v1.4.2", "v1.4.3"},
+		},
+		{
+			name:             "oldest manifests are deleted",
+			retain:           pointer.Int(1),
+			expectedVersions: []string{"v1.4.2", "v1.4.3"},
+		},
+		{
+			name:             "only the current manifests are kept",
+			retain:           pointer.Int(0),
+			expectedVersions: []string{"v1.4.3"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			ctx := context.Background()
+
+			fakeclient := fake.NewClientBuilder().WithObjects(
+				manifestsConfigMap("v1.4.0", 3*time.Hour),
+				manifestsConfigMap("v1.4.1", 2*time.Hour),
+				manifestsConfigMap("v1.4.2", time.Hour),
+				manifestsConfigMap("v1.4.3", 0),
+			).Build()
+
+			p := &phaseReconciler{
+				ctrlClient: fakeclient,
+				provider: &genericprovider.CoreProviderWrapper{
+					CoreProvider: &operatorv1.CoreProvider{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:      "cluster-api",
+							Namespace: namespace,
+						},
+						Spec: operatorv1.CoreProviderSpec{
+							ProviderSpec: operatorv1.ProviderSpec{
+								Version:               "v1.4.3",
+								RetainManifestHistory: tc.retain,
+							},
+						},
+					},
+				},
+			}
+
+			_, err := p.pruneManifestHistory(ctx)
+			g.Expect(err).ToNot(HaveOccurred())
+
+			configMapList := &corev1.ConfigMapList{}
+			g.Expect(fakeclient.List(ctx, configMapList)).To(Succeed())
+
+			versions := []string{}
+			for _, cm := range configMapList.Items {
+				versions = append(versions, cm.Labels[configMapVersionLabel])
+			}
+
+			g.Expect(versions).To(ConsistOf(tc.expectedVersions))
+		})
+	}
+}
+
+func TestCreateManifestsConfigMap(t *testing.T) {
+	namespace := "test-namespace"
+
+	existingConfigMap := func(labels, annotations map[string]string, owners ...metav1.OwnerReference) *corev1.ConfigMap {
+		return &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:            "core-cluster-api-v1.4.3",
+				Namespace:       namespace,
+				Labels:          labels,
+				Annotations:     annotations,
+				OwnerReferences: owners,
+			},
+			Data: map[string]string{
+				metadataConfigMapKey: "stale metadata",
+			},
+			BinaryData: map[string][]byte{
+				componentsConfigMapKey: []byte("stale components"),
+			},
+		}
+	}
+
+	providerLabels := map[string]string{
+		configMapVersionLabel: "v1.4.3",
+		configMapTypeLabel:    "core",
+		configMapNameLabel:    "cluster-api",
+		operatorManagedLabel:  "true",
+	}
+
+	testCases := []struct {
+		name          string
+		existing      *corev1.ConfigMap
+		expectedError bool
+	}{
+		{
+			name: "config map is created",
+		},
+		{
+			name: "config map left over by a previous instance of the provider is updated",
+			existing: existingConfigMap(providerLabels, map[string]string{compressedAnnotation: "true"}, metav1.OwnerReference{
+				APIVersion: operatorv1.GroupVersion.String(),
+				Kind:       "CoreProvider",
+				Name:       "cluster-api",
+				UID:        "previous-uid",
+			}),
+		},
+		{
+			name: "config map of another provider is not updated",
+			existing: existingConfigMap(map[string]string{
+				configMapTypeLabel: "core",
+				configMapNameLabel: "cluster",
+			}, nil),
+			expectedError: true,
+		},
+		{
+			name: "config map owned by another provider is not updated",
+			existing: existingConfigMap(providerLabels, nil, metav1.OwnerReference{
+				APIVersion: operatorv1.GroupVersion.String(),
+				Kind:       "InfrastructureProvider",
+				Name:       "cluster-api",
+				UID:        "other-uid",
+			}),
+			expectedError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			ctx := context.Background()
+
+			builder := fake.NewClientBuilder()
+			if tc.existing != nil {
+				builder = builder.WithObjects(tc.existing)
+			}
+
+			fakeclient := builder.Build()
+
+			p := &phaseReconciler{
+				ctrlClient: fakeclient,
+				provider: &genericprovider.CoreProviderWrapper{
+					CoreProvider: &operatorv1.CoreProvider{
+						TypeMeta: metav1.TypeMeta{
+							APIVersion: operatorv1.GroupVersion.String(),
+							Kind:       "CoreProvider",
+						},
+						ObjectMeta: metav1.ObjectMeta{
+							Name:      "cluster-api",
+							Namespace: namespace,
+							UID:       "provider-uid",
+						},
+						Spec: operatorv1.CoreProviderSpec{
+							ProviderSpec: operatorv1.ProviderSpec{
+								Version: "v1.4.3",
+							},
+						},
+					},
+				},
+			}
+
+			err := p.createManifestsConfigMap(ctx, []byte("metadata"), []byte("components"), false)
+
+			configMap := &corev1.ConfigMap{}
+			g.Expect(fakeclient.Get(ctx, client.ObjectKey{Namespace: namespace, Name: "core-cluster-api-v1.4.3"}, configMap)).To(Succeed())
+
+			if tc.expectedError {
+				g.Expect(err).To(HaveOccurred())
+				g.Expect(configMap.Data).To(Equal(tc.existing.Data))
+				g.Expect(configMap.BinaryData).To(Equal(tc.existing.BinaryData))
+
+				return
+			}
+
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(configMap.Labels).To(Equal(providerLabels))
+			g.Expect(configMap.Annotations).To(BeEmpty())
+			g.Expect(configMap.Data).To(Equal(map[string]string{
+				metadataConfigMapKey:   "metadata",
+				componentsConfigMapKey: "components",
+			}))
+			g.Expect(configMap.BinaryData).To(BeEmpty())
+			g.Expect(configMap.OwnerReferences).To(HaveLen(1))
+			g.Expect(configMap.OwnerReferences[0].UID).To(BeEquivalentTo("provider-uid"))
+		})
+	}
+}
+
+func TestCrossNamespaceManifestsConfigMaps(t *testing.T) {
+	g := NewWithT(t)
+
+	ctx := context.Background()
+
+	fakeclient := fake.NewClientBuilder().Build()
+
+	newReconciler := func(namespace string) *phaseReconciler {
+		return &phaseReconciler{
+			ctrlClient: fakeclient,
+			provider: &genericprovider.CoreProviderWrapper{
+				CoreProvider: &operatorv1.CoreProvider{
+					TypeMeta: metav1.TypeMeta{
+						APIVersion: operatorv1.GroupVersion.String(),
+						Kind:       "CoreProvider",
+					},
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "cluster-api",
+						Namespace: namespace,
+						UID:       "provider-uid",
+					},
+					Spec: operatorv1.CoreProviderSpec{
+						ProviderSpec: operatorv1.ProviderSpec{
+							Version:     "v1.4.3",
+							FetchConfig: &operatorv1.FetchConfiguration{ConfigMapNamespace: "capi-manifests"},
+						},
+					},
+				},
+			},
+		}
+	}
+
+	tenantA, tenantB := newReconciler("tenant-a"), newReconciler("tenant-b")
+	selector := metav1.LabelSelector{MatchLabels: tenantA.prepareConfigMapLabels()}
+
+	g.Expect(tenantA.createManifestsConfigMap(ctx, []byte("metadata"), []byte("components"), false)).To(Succeed())
+
+	configMap := &corev1.ConfigMap{}
+	g.Expect(fakeclient.Get(ctx, client.ObjectKey{Namespace: "capi-manifests", Name: "tenant-a-core-cluster-api-v1.4.3"}, configMap)).To(Succeed())
+	g.Expect(configMap.Labels).To(HaveKeyWithValue(configMapNamespaceLabel, "tenant-a"))
+	g.Expect(configMap.OwnerReferences).To(BeEmpty())
+
+	exists, err := tenantA.checkConfigMapExists(ctx, selector)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(exists).To(BeTrue())
+
+	// The provider with the same name in another namespace doesn't use the manifests of the first one.
+	exists, err = tenantB.checkConfigMapExists(ctx, metav1.LabelSelector{MatchLabels: tenantB.prepareConfigMapLabels()})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(exists).To(BeFalse())
+
+	g.Expect(tenantB.createManifestsConfigMap(ctx, []byte("metadata"), []byte("components"), false)).To(Succeed())
+
+	// The manifests stored in another namespace are deleted with the provider.
+	_, err = tenantA.deleteManifestsConfigMaps(ctx)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	configMapList := &corev1.ConfigMapList{}
+	g.Expect(fakeclient.List(ctx, configMapList, client.InNamespace("capi-manifests"))).To(Succeed())
+	g.Expect(configMapList.Items).To(HaveLen(1))
+	g.Expect(configMapList.Items[0].Name).To(Equal("tenant-b-core-cluster-api-v1.4.3"))
+}
@@ -0,0 +1,109 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	clusterctlv1 "sigs.k8s.io/cluster-api/cmd/clusterctl/api/v1alpha3"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	operatorv1 "sigs.k8s.io/cluster-api-operator/api/v1alpha2"
+)
+
+// ensureNamespace creates the namespace the provider components are installed in before they are applied, like
+// clusterctl init does, so the namespaced components don't fail one by one. With namespace creation disabled the
+// namespace has to exist instead.
+func (p *phaseReconciler) ensureNamespace(ctx context.Context) (reconcile.Result, error) {
+	log := ctrl.LoggerFrom(ctx)
+
+	name := p.components.TargetNamespace()
+
+	err := p.ctrlClient.Get(ctx, client.ObjectKey{Name: name}, &corev1.Namespace{})
+	if err == nil {
+		return reconcile.Result{}, nil
+	}
+
+	if !apierrors.IsNotFound(err) {
+		return reconcile.Result{}, wrapPhaseError(fmt.Errorf("failed to get namespace %q: %w", name, err), operatorv1.NamespaceCreationFailedReason)
+	}
+
+	if p.disableNamespaceCreation {
+		return reconcile.Result{}, &PhaseError{
+			Err:      fmt.Errorf("namespace %q doesn't exist and namespace creation is disabled", name),
+			Type:     operatorv1.ProviderInstalledCondition,
+			Reason:   operatorv1.NamespaceNotFoundReason,
+			Severity: clusterv1.ConditionSeverityError,
+		}
+	}
+
+	namespace := p.namespaceObject(name)
+
+	log.Info("Creating namespace", "namespace", name)
+
+	if err := p.ctrlClient.Create(ctx, namespace); err != nil && !apierrors.IsAlreadyExists(err) {
+		return reconcile.Result{}, &PhaseError{
+			Err:      fmt.Errorf("failed to create namespace %q: %w", name, err),
+			Type:     operatorv1.ProviderInstalledCondition,
+			Reason:   operatorv1.NamespaceCreationFailedReason,
+			Severity: clusterv1.ConditionSeverityError,
+		}
+	}
+
+	return reconcile.Result{}, nil
+}
+
+// namespaceObject returns the namespace object of the components, carrying the labels clusterctl sets on them,
+// or a namespace labeled the same way if the components don't include one.
+func (p *phaseReconciler) namespaceObject(name string) *unstructured.Unstructured {
+	for _, obj := range p.components.Objs() {
+		if obj.GetKind() == namespaceKind && obj.GetName() == name {
+			return obj.DeepCopy()
+		}
+	}
+
+	namespace := &unstructured.Unstructured{}
+	namespace.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind(namespaceKind))
+	namespace.SetName(name)
+	namespace.SetLabels(map[string]string{
+		clusterctlv1.ClusterctlLabel: "",
+		clusterv1.ProviderNameLabel:  p.components.ManifestLabel(),
+	})
+
+	return namespace
+}
+
+// withoutNamespaces returns the objects except the namespaces, which are left untouched with namespace creation
+// disabled.
+func withoutNamespaces(objs []unstructured.Unstructured) []unstructured.Unstructured {
+	filtered := make([]unstructured.Unstructured, 0, len(objs))
+
+	for _, obj := range objs {
+		if obj.GetKind() != namespaceKind {
+			filtered = append(filtered, obj)
+		}
+	}
+
+	return filtered
+}
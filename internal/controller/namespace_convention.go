@@ -0,0 +1,99 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	utilyaml "sigs.k8s.io/cluster-api/util/yaml"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	operatorv1 "sigs.k8s.io/cluster-api-operator/api/v1alpha2"
+)
+
+var nonConventionalNamespaceMessage = "Provider is installed in namespace %q instead of %q, the namespace its components default to: " +
+	"the components looking up its webhooks or services in %q may not find them"
+
+// conventionalNamespace returns the namespace clusterctl installs the provider components in by default, i.e. the
+// one of their Namespace object, or an empty string if they don't define exactly one, set by a variable, or don't
+// parse before their variables are processed.
+func conventionalNamespace(rawComponents []byte) string {
+	objs, err := utilyaml.ToUnstructured(rawComponents)
+	if err != nil {
+		return ""
+	}
+
+	namespaces := []string{}
+
+	for _, obj := range objs {
+		if obj.GroupVersionKind().Group == "" && obj.GetKind() == "Namespace" {
+			namespaces = append(namespaces, obj.GetName())
+		}
+	}
+
+	if len(namespaces) != 1 || strings.Contains(namespaces[0], "${") {
+		return ""
+	}
+
+	return namespaces[0]
+}
+
+// setConventionalNamespaceCondition reports whether the provider is installed in the namespace its components
+// default to, if the namespace conventions are checked. A provider installed in another namespace is only warned
+// about, and still installed.
+func (p *phaseReconciler) setConventionalNamespaceCondition(ctx context.Context) error {
+	if !p.checkNamespaceConventions {
+		conditions.Delete(p.provider, operatorv1.ConventionalNamespaceCondition)
+
+		return nil
+	}
+
+	rawComponents, err := p.repo.GetFile(p.options.Version, p.repo.ComponentsPath())
+	if err != nil {
+		err = fmt.Errorf("failed to read %q from provider's repository %q: %w", p.repo.ComponentsPath(), p.providerConfig.ManifestLabel(), err)
+
+		return wrapPhaseError(err, operatorv1.DownloadFailedReason)
+	}
+
+	expected := conventionalNamespace(rawComponents)
+	if expected == "" {
+		conditions.Delete(p.provider, operatorv1.ConventionalNamespaceCondition)
+
+		return nil
+	}
+
+	if p.provider.GetNamespace() == expected {
+		conditions.Set(p.provider, &clusterv1.Condition{
+			Type:   operatorv1.ConventionalNamespaceCondition,
+			Status: corev1.ConditionTrue,
+		})
+
+		return nil
+	}
+
+	ctrl.LoggerFrom(ctx).Info("Provider is not installed in the namespace its components default to", "expectedNamespace", expected)
+
+	conditions.Set(p.provider, conditions.FalseCondition(operatorv1.ConventionalNamespaceCondition, operatorv1.NonConventionalNamespaceReason,
+		clusterv1.ConditionSeverityWarning, nonConventionalNamespaceMessage, p.provider.GetNamespace(), expected, expected))
+
+	return nil
+}
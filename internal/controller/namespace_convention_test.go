@@ -0,0 +1,155 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/cmd/clusterctl/client/repository"
+	"sigs.k8s.io/cluster-api/util/conditions"
+
+	operatorv1 "sigs.k8s.io/cluster-api-operator/api/v1alpha2"
+	"sigs.k8s.io/cluster-api-operator/internal/controller/genericprovider"
+)
+
+const namespacedComponents = `apiVersion: v1
+kind: Namespace
+metadata:
+  name: capa-system
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: capa-controller-manager
+  namespace: capa-system
+`
+
+func TestConventionalNamespace(t *testing.T) {
+	tests := []struct {
+		name       string
+		components string
+		expected   string
+	}{
+		{
+			name:       "single namespace",
+			components: namespacedComponents,
+			expected:   "capa-system",
+		},
+		{
+			name: "no namespace",
+			components: `apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: awsclusters.infrastructure.cluster.x-k8s.io
+`,
+		},
+		{
+			name: "several namespaces",
+			components: namespacedComponents + `---
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: capa-webhook-system
+`,
+		},
+		{
+			name: "namespace set by a variable",
+			components: `apiVersion: v1
+kind: Namespace
+metadata:
+  name: ${NAMESPACE}
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			g.Expect(conventionalNamespace([]byte(tt.components))).To(Equal(tt.expected))
+		})
+	}
+}
+
+func TestSetConventionalNamespaceCondition(t *testing.T) {
+	tests := []struct {
+		name            string
+		namespace       string
+		disabled        bool
+		expectedStatus  string
+		expectedReason  string
+		expectedMessage string
+	}{
+		{
+			name:           "conventional namespace",
+			namespace:      "capa-system",
+			expectedStatus: "True",
+		},
+		{
+			name:            "non conventional namespace",
+			namespace:       "capz-system",
+			expectedStatus:  "False",
+			expectedReason:  operatorv1.NonConventionalNamespaceReason,
+			expectedMessage: `Provider is installed in namespace "capz-system" instead of "capa-system", the namespace its components default to: the components looking up its webhooks or services in "capa-system" may not find them`,
+		},
+		{
+			name:      "check disabled",
+			namespace: "capz-system",
+			disabled:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			provider := &genericprovider.InfrastructureProviderWrapper{
+				InfrastructureProvider: &operatorv1.InfrastructureProvider{
+					ObjectMeta: metav1.ObjectMeta{Name: "aws", Namespace: tt.namespace},
+				},
+			}
+
+			// A condition left over from a previous check is removed once disabled.
+			conditions.MarkFalse(provider, operatorv1.ConventionalNamespaceCondition, operatorv1.NonConventionalNamespaceReason, clusterv1.ConditionSeverityWarning, "")
+
+			p := &phaseReconciler{
+				provider:                  provider,
+				repo:                      repository.NewMemoryRepository().WithPaths("", "components.yaml").WithFile("v2.2.0", "components.yaml", []byte(namespacedComponents)),
+				options:                   repository.ComponentsOptions{Version: "v2.2.0"},
+				checkNamespaceConventions: !tt.disabled,
+			}
+
+			g.Expect(p.setConventionalNamespaceCondition(context.Background())).To(Succeed())
+
+			condition := conditions.Get(provider, operatorv1.ConventionalNamespaceCondition)
+			if tt.expectedStatus == "" {
+				g.Expect(condition).To(BeNil())
+
+				return
+			}
+
+			g.Expect(condition).ToNot(BeNil())
+			g.Expect(string(condition.Status)).To(Equal(tt.expectedStatus))
+			g.Expect(condition.Reason).To(Equal(tt.expectedReason))
+			g.Expect(condition.Message).To(Equal(tt.expectedMessage))
+		})
+	}
+}
@@ -0,0 +1,141 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	clusterctlv1 "sigs.k8s.io/cluster-api/cmd/clusterctl/api/v1alpha3"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	operatorv1 "sigs.k8s.io/cluster-api-operator/api/v1alpha2"
+)
+
+func TestEnsureNamespace(t *testing.T) {
+	componentsNamespace := newUnstructured(corev1.SchemeGroupVersion.WithKind("Namespace"), "", "capa-system")
+	componentsNamespace.SetLabels(map[string]string{clusterctlv1.ClusterctlLabel: "", clusterv1.ProviderNameLabel: "infrastructure-aws"})
+
+	testCases := []struct {
+		name                     string
+		objs                     []client.Object
+		componentsObjs           []unstructured.Unstructured
+		disableNamespaceCreation bool
+		createErr                error
+		expectedLabels           map[string]string
+		expectedReason           string
+		expectedError            string
+	}{
+		{
+			name:           "namespace exists",
+			objs:           []client.Object{&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "capa-system", Labels: map[string]string{"team": "a"}}}},
+			expectedLabels: map[string]string{"team": "a"},
+		},
+		{
+			name:           "namespace created from the components",
+			componentsObjs: []unstructured.Unstructured{componentsNamespace},
+			expectedLabels: map[string]string{clusterctlv1.ClusterctlLabel: "", clusterv1.ProviderNameLabel: "infrastructure-aws"},
+		},
+		{
+			name:           "namespace missing from the components",
+			expectedLabels: map[string]string{clusterctlv1.ClusterctlLabel: "", clusterv1.ProviderNameLabel: "infrastructure-aws"},
+		},
+		{
+			name:                     "namespace creation disabled",
+			componentsObjs:           []unstructured.Unstructured{componentsNamespace},
+			disableNamespaceCreation: true,
+			expectedReason:           operatorv1.NamespaceNotFoundReason,
+			expectedError:            "namespace \"capa-system\" doesn't exist and namespace creation is disabled",
+		},
+		{
+			name:           "namespace creation failure",
+			componentsObjs: []unstructured.Unstructured{componentsNamespace},
+			createErr:      errors.New("forbidden"),
+			expectedReason: operatorv1.NamespaceCreationFailedReason,
+			expectedError:  "failed to create namespace \"capa-system\": forbidden",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			fakeClient := fake.NewClientBuilder().WithScheme(setupScheme()).WithObjects(tc.objs...).
+				WithInterceptorFuncs(interceptor.Funcs{
+					Create: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.CreateOption) error {
+						if tc.createErr != nil {
+							return tc.createErr
+						}
+
+						return c.Create(ctx, obj, opts...)
+					},
+				}).Build()
+
+			p := &phaseReconciler{
+				ctrlClient: fakeClient,
+				components: &fakeComponents{
+					objs:            tc.componentsObjs,
+					targetNamespace: "capa-system",
+					manifestLabel:   "infrastructure-aws",
+				},
+				disableNamespaceCreation: tc.disableNamespaceCreation,
+			}
+
+			_, err := p.ensureNamespace(context.Background())
+
+			namespace := &corev1.Namespace{}
+			getErr := fakeClient.Get(context.Background(), client.ObjectKey{Name: "capa-system"}, namespace)
+
+			if tc.expectedError == "" {
+				g.Expect(err).ToNot(HaveOccurred())
+				g.Expect(getErr).ToNot(HaveOccurred())
+				g.Expect(namespace.Labels).To(Equal(tc.expectedLabels))
+
+				return
+			}
+
+			var pe *PhaseError
+			g.Expect(errors.As(err, &pe)).To(BeTrue())
+			g.Expect(pe.Type).To(Equal(operatorv1.ProviderInstalledCondition))
+			g.Expect(pe.Reason).To(Equal(tc.expectedReason))
+			g.Expect(pe.Severity).To(Equal(clusterv1.ConditionSeverityError))
+			g.Expect(err.Error()).To(Equal(tc.expectedError))
+			g.Expect(getErr).To(HaveOccurred())
+		})
+	}
+}
+
+func TestWithoutNamespaces(t *testing.T) {
+	g := NewWithT(t)
+
+	deployment := newUnstructured(appsv1.SchemeGroupVersion.WithKind("Deployment"), "capa-system", "capa-controller-manager")
+
+	objs := withoutNamespaces([]unstructured.Unstructured{
+		newUnstructured(corev1.SchemeGroupVersion.WithKind("Namespace"), "", "capa-system"),
+		deployment,
+	})
+	g.Expect(objs).To(Equal([]unstructured.Unstructured{deployment}))
+}
@@ -0,0 +1,196 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/cluster-api/cmd/clusterctl/client/repository"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// manifestsOverrides are the files of the provider version overridden by the overrides ConfigMap.
+type manifestsOverrides struct {
+	configMap  client.ObjectKey
+	metadata   []byte
+	components []byte
+}
+
+// complete returns true if both the metadata and the components are overridden, so the provider repository
+// isn't needed.
+func (o *manifestsOverrides) complete() bool {
+	return o != nil && o.metadata != nil && o.components != nil
+}
+
+// loadOverrides reads the overrides ConfigMap referenced by the fetch configuration, if any.
+func (p *phaseReconciler) loadOverrides(ctx context.Context) error {
+	p.overrides = nil
+
+	fetchConfig := p.provider.GetSpec().FetchConfig
+	if fetchConfig == nil || fetchConfig.OverridesConfigMapRef == nil {
+		return nil
+	}
+
+	key := client.ObjectKey{Namespace: fetchConfig.OverridesConfigMapRef.Namespace, Name: fetchConfig.OverridesConfigMapRef.Name}
+	if key.Namespace == "" {
+		key.Namespace = p.provider.GetNamespace()
+	}
+
+	cm := &corev1.ConfigMap{}
+	if err := p.ctrlClient.Get(ctx, key, cm); err != nil {
+		return fmt.Errorf("failed to get overrides ConfigMap %s: %w", key, err)
+	}
+
+	overrides := &manifestsOverrides{configMap: key}
+
+	if metadata, ok := cm.Data[metadataConfigMapKey]; ok {
+		overrides.metadata = []byte(metadata)
+	}
+
+	_, inData := cm.Data[componentsConfigMapKey]
+	_, inBinaryData := cm.BinaryData[componentsConfigMapKey]
+
+	if inData || inBinaryData {
+		components, err := getComponentsData(*cm)
+		if err != nil {
+			return err
+		}
+
+		overrides.components = []byte(components)
+	}
+
+	if overrides.metadata == nil && overrides.components == nil {
+		return fmt.Errorf("overrides ConfigMap %s has neither %s nor %s", key, metadataConfigMapKey, componentsConfigMapKey)
+	}
+
+	ctrl.LoggerFrom(ctx).Info("Using overridden provider manifests", "configMap", key,
+		"metadata", overrides.metadata != nil, "components", overrides.components != nil)
+
+	p.overrides = overrides
+
+	return nil
+}
+
+// repository returns a repository holding the files of the overrides ConfigMap for the version, and the
+// other files of the given repository, which is nil if the overrides are complete.
+func (o *manifestsOverrides) repository(repo repository.Repository, version string) repository.Repository {
+	if o.complete() {
+		mr := repository.NewMemoryRepository()
+		mr.WithPaths("", "components.yaml")
+		mr.WithFile(version, metadataFile, o.metadata)
+		mr.WithFile(version, mr.ComponentsPath(), o.components)
+
+		return mr
+	}
+
+	return &overridesRepository{Repository: repo, version: version, overrides: o}
+}
+
+// overridesRepository serves the files of the overrides ConfigMap for the provider version, taking precedence
+// over the ones of the underlying repository.
+type overridesRepository struct {
+	repository.Repository
+	version   string
+	overrides *manifestsOverrides
+}
+
+// GetFile returns the overridden file for the provider version, if any, or the file of the underlying repository.
+func (r *overridesRepository) GetFile(version, path string) ([]byte, error) {
+	if version == r.version {
+		switch {
+		case path == metadataFile && r.overrides.metadata != nil:
+			return r.overrides.metadata, nil
+		case path == r.ComponentsPath() && r.overrides.components != nil:
+			return r.overrides.components, nil
+		}
+	}
+
+	return r.Repository.GetFile(version, path)
+}
+
+// loadMetadataOverride reads the metadata of the metadata override ConfigMap referenced by the fetch configuration,
+// if any, rejecting it unless it's valid clusterctl metadata with at least one release series.
+func (p *phaseReconciler) loadMetadataOverride(ctx context.Context) error {
+	p.metadataOverride = nil
+
+	fetchConfig := p.provider.GetSpec().FetchConfig
+	if fetchConfig == nil || fetchConfig.MetadataOverrideRef == nil {
+		return nil
+	}
+
+	key := client.ObjectKey{Namespace: fetchConfig.MetadataOverrideRef.Namespace, Name: fetchConfig.MetadataOverrideRef.Name}
+	if key.Namespace == "" {
+		key.Namespace = p.provider.GetNamespace()
+	}
+
+	cm := &corev1.ConfigMap{}
+	if err := p.ctrlClient.Get(ctx, key, cm); err != nil {
+		return fmt.Errorf("failed to get metadata override ConfigMap %s: %w", key, err)
+	}
+
+	metadata, ok := cm.Data[metadataConfigMapKey]
+	if !ok {
+		return fmt.Errorf("metadata override ConfigMap %s has no %s", key, metadataConfigMapKey)
+	}
+
+	decoded, err := decodeMetadata([]byte(metadata))
+	if err != nil {
+		return fmt.Errorf("metadata override ConfigMap %s doesn't hold valid clusterctl metadata: %w", key, err)
+	}
+
+	if len(decoded.ReleaseSeries) == 0 {
+		return fmt.Errorf("metadata override ConfigMap %s has no release series", key)
+	}
+
+	// The override hides the published metadata, which is easily forgotten once upstream is fixed.
+	ctrl.LoggerFrom(ctx).Info("WARNING: using overridden provider metadata, the published metadata is ignored for all versions",
+		"configMap", key, "releaseSeries", len(decoded.ReleaseSeries))
+
+	p.metadataOverride = []byte(metadata)
+
+	return nil
+}
+
+// withMetadataOverride returns the repository serving the metadata override for every version, if any.
+func (p *phaseReconciler) withMetadataOverride(repo repository.Repository) repository.Repository {
+	if p.metadataOverride == nil || repo == nil {
+		return repo
+	}
+
+	return &metadataOverrideRepository{Repository: repo, metadata: p.metadataOverride, metadataPath: p.metadataPath()}
+}
+
+// metadataOverrideRepository serves the metadata of the metadata override ConfigMap for every version, and the
+// other files from the underlying repository.
+type metadataOverrideRepository struct {
+	repository.Repository
+	metadata []byte
+	// metadataPath is the name of the metadata file in remote repositories, which may be customized.
+	metadataPath string
+}
+
+// GetFile returns the overridden metadata, or the file of the underlying repository.
+func (r *metadataOverrideRepository) GetFile(version, path string) ([]byte, error) {
+	if path == metadataFile || path == r.metadataPath {
+		return r.metadata, nil
+	}
+
+	return r.Repository.GetFile(version, path)
+}
@@ -0,0 +1,273 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	operatorv1 "sigs.k8s.io/cluster-api-operator/api/v1alpha2"
+	"sigs.k8s.io/cluster-api-operator/internal/controller/genericprovider"
+)
+
+func TestOverridesPrecedence(t *testing.T) {
+	metadata := `
+apiVersion: clusterctl.cluster.x-k8s.io/v1alpha3
+releaseSeries:
+  - major: 1
+    minor: 3
+    contract: v1beta1
+`
+	overriddenMetadata := metadata + "# overridden\n"
+
+	selectorConfigMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "v1.3.0",
+			Namespace: "capa-system",
+			Labels:    map[string]string{"provider-components": "aws"},
+		},
+		Data: map[string]string{"metadata": metadata, "components": "selector components"},
+	}
+
+	newOverrides := func(data map[string]string) *corev1.ConfigMap {
+		return &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "aws-overrides", Namespace: "capa-system"},
+			Data:       data,
+		}
+	}
+
+	testCases := []struct {
+		name                string
+		overrides           *corev1.ConfigMap
+		noSelector          bool
+		expectedMetadata    string
+		expectedComponents  string
+		expectedFetchedFrom string
+		expectedErr         string
+	}{
+		{
+			name:                "selector without overrides",
+			expectedMetadata:    metadata,
+			expectedComponents:  "selector components",
+			expectedFetchedFrom: "ConfigMap capa-system/v1.3.0",
+		},
+		{
+			name:                "overridden components take precedence over the selector",
+			overrides:           newOverrides(map[string]string{"components": "overridden components"}),
+			expectedMetadata:    metadata,
+			expectedComponents:  "overridden components",
+			expectedFetchedFrom: "ConfigMap capa-system/v1.3.0, overridden by ConfigMap capa-system/aws-overrides",
+		},
+		{
+			name:                "overridden metadata take precedence over the selector",
+			overrides:           newOverrides(map[string]string{"metadata": overriddenMetadata}),
+			expectedMetadata:    overriddenMetadata,
+			expectedComponents:  "selector components",
+			expectedFetchedFrom: "ConfigMap capa-system/v1.3.0, overridden by ConfigMap capa-system/aws-overrides",
+		},
+		{
+			name:                "complete overrides replace the selector",
+			overrides:           newOverrides(map[string]string{"metadata": overriddenMetadata, "components": "overridden components"}),
+			expectedMetadata:    overriddenMetadata,
+			expectedComponents:  "overridden components",
+			expectedFetchedFrom: "ConfigMap capa-system/aws-overrides",
+		},
+		{
+			name:                "complete overrides replace the remote fetch",
+			overrides:           newOverrides(map[string]string{"metadata": overriddenMetadata, "components": "overridden components"}),
+			noSelector:          true,
+			expectedMetadata:    overriddenMetadata,
+			expectedComponents:  "overridden components",
+			expectedFetchedFrom: "ConfigMap capa-system/aws-overrides",
+		},
+		{
+			name:        "empty overrides",
+			overrides:   newOverrides(map[string]string{"other": "data"}),
+			expectedErr: "overrides ConfigMap capa-system/aws-overrides has neither metadata nor components",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			objs := []client.Object{selectorConfigMap}
+			fetchConfig := &operatorv1.FetchConfiguration{}
+
+			if !tc.noSelector {
+				fetchConfig.Selector = &metav1.LabelSelector{MatchLabels: map[string]string{"provider-components": "aws"}}
+			}
+
+			if tc.overrides != nil {
+				objs = append(objs, tc.overrides)
+				fetchConfig.OverridesConfigMapRef = &operatorv1.ConfigmapReference{Name: tc.overrides.Name}
+			}
+
+			p := &phaseReconciler{
+				ctrlClient: fake.NewClientBuilder().WithScheme(setupScheme()).WithObjects(objs...).Build(),
+				provider: &genericprovider.InfrastructureProviderWrapper{
+					InfrastructureProvider: &operatorv1.InfrastructureProvider{
+						ObjectMeta: metav1.ObjectMeta{Name: "aws", Namespace: "capa-system"},
+						Spec: operatorv1.InfrastructureProviderSpec{
+							ProviderSpec: operatorv1.ProviderSpec{Version: "v1.3.0", FetchConfig: fetchConfig},
+						},
+					},
+				},
+			}
+
+			// The remote repository isn't configured, so downloading the manifests would fail.
+			_, err := p.downloadProviderManifests(context.Background())
+			if tc.expectedErr != "" {
+				g.Expect(err).To(MatchError(tc.expectedErr))
+
+				return
+			}
+
+			g.Expect(err).ToNot(HaveOccurred())
+
+			_, err = p.load(context.Background())
+			g.Expect(err).ToNot(HaveOccurred())
+
+			file, err := p.repo.GetFile("v1.3.0", metadataFile)
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(string(file)).To(Equal(tc.expectedMetadata))
+
+			file, err = p.repo.GetFile("v1.3.0", p.repo.ComponentsPath())
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(string(file)).To(Equal(tc.expectedComponents))
+
+			g.Expect(p.fetchedFrom).To(Equal(tc.expectedFetchedFrom))
+		})
+	}
+}
+
+func TestMetadataOverride(t *testing.T) {
+	publishedMetadata := `
+apiVersion: clusterctl.cluster.x-k8s.io/v1alpha3
+releaseSeries:
+  - major: 1
+    minor: 3
+    contract: v1beta1
+`
+	// The published metadata is missing the 1.4 release series.
+	fixedMetadata := publishedMetadata + `  - major: 1
+    minor: 4
+    contract: v1beta1
+`
+
+	selectorConfigMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "v1.4.0",
+			Namespace: "capa-system",
+			Labels:    map[string]string{"provider-components": "aws"},
+		},
+		Data: map[string]string{"metadata": publishedMetadata, "components": "selector components"},
+	}
+
+	testCases := []struct {
+		name        string
+		data        map[string]string
+		expectedErr string
+	}{
+		{
+			name: "valid metadata",
+			data: map[string]string{"metadata": fixedMetadata},
+		},
+		{
+			name:        "missing metadata",
+			data:        map[string]string{"components": "components"},
+			expectedErr: "metadata override ConfigMap capa-system/aws-metadata has no metadata",
+		},
+		{
+			name:        "invalid metadata",
+			data:        map[string]string{"metadata": "releaseSeries: {"},
+			expectedErr: "metadata override ConfigMap capa-system/aws-metadata doesn't hold valid clusterctl metadata",
+		},
+		{
+			name:        "metadata without release series",
+			data:        map[string]string{"metadata": "apiVersion: clusterctl.cluster.x-k8s.io/v1alpha3\nkind: Metadata\n"},
+			expectedErr: "metadata override ConfigMap capa-system/aws-metadata has no release series",
+		},
+		{
+			name:        "missing ConfigMap",
+			expectedErr: "failed to get metadata override ConfigMap capa-system/aws-metadata",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			objs := []client.Object{selectorConfigMap}
+			if tc.data != nil {
+				objs = append(objs, &corev1.ConfigMap{
+					ObjectMeta: metav1.ObjectMeta{Name: "aws-metadata", Namespace: "capa-system"},
+					Data:       tc.data,
+				})
+			}
+
+			p := &phaseReconciler{
+				ctrlClient: fake.NewClientBuilder().WithScheme(setupScheme()).WithObjects(objs...).Build(),
+				provider: &genericprovider.InfrastructureProviderWrapper{
+					InfrastructureProvider: &operatorv1.InfrastructureProvider{
+						ObjectMeta: metav1.ObjectMeta{Name: "aws", Namespace: "capa-system"},
+						Spec: operatorv1.InfrastructureProviderSpec{
+							ProviderSpec: operatorv1.ProviderSpec{
+								Version: "v1.4.0",
+								FetchConfig: &operatorv1.FetchConfiguration{
+									Selector:            &metav1.LabelSelector{MatchLabels: map[string]string{"provider-components": "aws"}},
+									MetadataOverrideRef: &operatorv1.ConfigmapReference{Name: "aws-metadata"},
+								},
+							},
+						},
+					},
+				},
+			}
+
+			err := p.loadMetadataOverride(context.Background())
+			if tc.expectedErr != "" {
+				g.Expect(err).To(MatchError(ContainSubstring(tc.expectedErr)))
+
+				return
+			}
+
+			g.Expect(err).ToNot(HaveOccurred())
+
+			// The contract of v1.4.0 can only be resolved with the overridden metadata.
+			_, err = p.load(context.Background())
+			g.Expect(err).ToNot(HaveOccurred())
+
+			file, err := p.repo.GetFile("v1.4.0", metadataFile)
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(string(file)).To(Equal(fixedMetadata))
+
+			file, err = p.repo.GetFile("v1.4.0", p.repo.ComponentsPath())
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(string(file)).To(Equal("selector components"))
+
+			file, err = p.providerMetadata(context.Background())
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(string(file)).To(Equal(fixedMetadata))
+		})
+	}
+}
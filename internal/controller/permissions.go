@@ -0,0 +1,164 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	operatorv1 "sigs.k8s.io/cluster-api-operator/api/v1alpha2"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+const insufficientCRDPermissionsMessage = "Operator is not allowed to %s CustomResourceDefinition %s," +
+	" grant it the %q verb on customresourcedefinitions.apiextensions.k8s.io"
+
+// forbiddenVerbRegexp extracts the verb from the messages of the requests denied by the authorizer, e.g.
+// `User "system:serviceaccount:capi-operator-system:capi-operator-manager" cannot create resource "customresourcedefinitions" ...`.
+var forbiddenVerbRegexp = regexp.MustCompile(`cannot (\S+) resource`)
+
+// checkPermissions verifies that the operator is allowed to create every kind of object of the provider
+// components, so missing permissions are reported up front rather than after a partial install. It is
+// only run if enabled, as it makes an access review per kind and namespace.
+func (p *phaseReconciler) checkPermissions(ctx context.Context) (reconcile.Result, error) {
+	if !p.verifyPermissions {
+		return reconcile.Result{}, nil
+	}
+
+	log := ctrl.LoggerFrom(ctx)
+
+	attributes, err := p.componentsResourceAttributes()
+	if err != nil {
+		return reconcile.Result{}, wrapPhaseError(err, operatorv1.DecodeFailedReason)
+	}
+
+	missing := []string{}
+
+	for _, attrs := range attributes {
+		review := &authorizationv1.SelfSubjectAccessReview{
+			Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+				ResourceAttributes: attrs.DeepCopy(),
+			},
+		}
+
+		if err := p.ctrlClient.Create(ctx, review); err != nil {
+			return reconcile.Result{}, fmt.Errorf("failed to review the permissions for provider %q: %w", p.provider.GetName(), err)
+		}
+
+		if !review.Status.Allowed {
+			missing = append(missing, describeResourceAttributes(attrs))
+		}
+	}
+
+	if len(missing) > 0 {
+		return reconcile.Result{}, &PhaseError{
+			Err:      fmt.Errorf("operator is not allowed to %s", strings.Join(missing, ", ")),
+			Type:     operatorv1.PreflightCheckCondition,
+			Reason:   operatorv1.MissingPermissionsReason,
+			Severity: clusterv1.ConditionSeverityError,
+		}
+	}
+
+	log.V(5).Info("Operator permissions verified", "reviews", len(attributes))
+
+	return reconcile.Result{}, nil
+}
+
+// componentsResourceAttributes returns the create attributes of each resource and namespace of the
+// provider components, in the order they first appear. Kinds unknown to the cluster, e.g. the ones
+// defined by CRDs of the components, are skipped, as they can't be reviewed before the CRDs exist.
+func (p *phaseReconciler) componentsResourceAttributes() ([]authorizationv1.ResourceAttributes, error) {
+	attributes := []authorizationv1.ResourceAttributes{}
+	seen := map[authorizationv1.ResourceAttributes]bool{}
+
+	for _, obj := range p.componentsToInstall() {
+		gvk := obj.GroupVersionKind()
+
+		mapping, err := p.ctrlClient.RESTMapper().RESTMapping(gvk.GroupKind(), gvk.Version)
+		if err != nil {
+			if meta.IsNoMatchError(err) {
+				continue
+			}
+
+			return nil, fmt.Errorf("failed to get the resource of %s %s: %w", gvk.Kind, obj.GetName(), err)
+		}
+
+		attrs := authorizationv1.ResourceAttributes{
+			Verb:     "create",
+			Group:    mapping.Resource.Group,
+			Version:  mapping.Resource.Version,
+			Resource: mapping.Resource.Resource,
+		}
+
+		if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+			attrs.Namespace = obj.GetNamespace()
+		}
+
+		if !seen[attrs] {
+			seen[attrs] = true
+
+			attributes = append(attributes, attrs)
+		}
+	}
+
+	return attributes, nil
+}
+
+// describeResourceAttributes returns a human readable description of the reviewed attributes,
+// e.g. "create clusterroles.rbac.authorization.k8s.io".
+func describeResourceAttributes(attrs authorizationv1.ResourceAttributes) string {
+	resource := attrs.Resource
+	if attrs.Group != "" {
+		resource = resource + "." + attrs.Group
+	}
+
+	if attrs.Namespace != "" {
+		return fmt.Sprintf("%s %s in namespace %s", attrs.Verb, resource, attrs.Namespace)
+	}
+
+	return fmt.Sprintf("%s %s", attrs.Verb, resource)
+}
+
+// crdPermissionDenied returns the verb and the name of the CustomResourceDefinition if the error is a
+// Forbidden one on a CustomResourceDefinition. The verb is "apply" if the message doesn't tell it.
+func crdPermissionDenied(err error) (string, string, bool) {
+	var status apierrors.APIStatus
+	if !apierrors.IsForbidden(err) || !errors.As(err, &status) {
+		return "", "", false
+	}
+
+	details := status.Status().Details
+	if details == nil || details.Group != apiextensionsv1.GroupName || details.Kind != "customresourcedefinitions" {
+		return "", "", false
+	}
+
+	verb := "apply"
+	if match := forbiddenVerbRegexp.FindStringSubmatch(status.Status().Message); match != nil {
+		verb = match[1]
+	}
+
+	return verb, details.Name, true
+}
@@ -0,0 +1,208 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/cmd/clusterctl/client/repository"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	operatorv1 "sigs.k8s.io/cluster-api-operator/api/v1alpha2"
+	"sigs.k8s.io/cluster-api-operator/internal/controller/genericprovider"
+)
+
+// fakeComponents are provider components only exposing their objects, version, target namespace and manifest label.
+type fakeComponents struct {
+	repository.Components
+	objs            []unstructured.Unstructured
+	version         string
+	targetNamespace string
+	manifestLabel   string
+}
+
+func (c *fakeComponents) Objs() []unstructured.Unstructured {
+	return c.objs
+}
+
+func (c *fakeComponents) Version() string {
+	return c.version
+}
+
+func (c *fakeComponents) TargetNamespace() string {
+	return c.targetNamespace
+}
+
+func (c *fakeComponents) ManifestLabel() string {
+	return c.manifestLabel
+}
+
+func newUnstructured(gvk schema.GroupVersionKind, namespace, name string) unstructured.Unstructured {
+	u := unstructured.Unstructured{}
+	u.SetGroupVersionKind(gvk)
+	u.SetNamespace(namespace)
+	u.SetName(name)
+
+	return u
+}
+
+func TestCheckPermissions(t *testing.T) {
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(appsv1.SchemeGroupVersion.WithKind("Deployment"), meta.RESTScopeNamespace)
+	mapper.Add(corev1.SchemeGroupVersion.WithKind("ServiceAccount"), meta.RESTScopeNamespace)
+	mapper.Add(rbacv1.SchemeGroupVersion.WithKind("ClusterRole"), meta.RESTScopeRoot)
+
+	objs := []unstructured.Unstructured{
+		newUnstructured(appsv1.SchemeGroupVersion.WithKind("Deployment"), "capd-system", "controller-manager"),
+		newUnstructured(corev1.SchemeGroupVersion.WithKind("ServiceAccount"), "capd-system", "manager"),
+		newUnstructured(corev1.SchemeGroupVersion.WithKind("ServiceAccount"), "capd-system", "webhook"),
+		newUnstructured(rbacv1.SchemeGroupVersion.WithKind("ClusterRole"), "", "manager-role"),
+		newUnstructured(schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Unknown"}, "capd-system", "unknown"),
+	}
+
+	testCases := []struct {
+		name              string
+		verifyPermissions bool
+		denied            map[string]bool
+		expectedReviews   int
+		expectedError     string
+	}{
+		{
+			name:            "disabled",
+			expectedReviews: 0,
+		},
+		{
+			name:              "all permissions",
+			verifyPermissions: true,
+			expectedReviews:   3,
+		},
+		{
+			name:              "missing permissions",
+			verifyPermissions: true,
+			denied:            map[string]bool{"clusterroles": true, "deployments": true},
+			expectedReviews:   3,
+			expectedError:     "operator is not allowed to create deployments.apps in namespace capd-system, create clusterroles.rbac.authorization.k8s.io",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			reviews := 0
+
+			fakeclient := fake.NewClientBuilder().WithRESTMapper(mapper).WithInterceptorFuncs(interceptor.Funcs{
+				Create: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.CreateOption) error {
+					review, ok := obj.(*authorizationv1.SelfSubjectAccessReview)
+					if !ok {
+						return c.Create(ctx, obj, opts...)
+					}
+
+					reviews++
+
+					review.Status.Allowed = !tc.denied[review.Spec.ResourceAttributes.Resource]
+
+					return nil
+				},
+			}).Build()
+
+			p := &phaseReconciler{
+				ctrlClient:        fakeclient,
+				verifyPermissions: tc.verifyPermissions,
+				components:        &fakeComponents{objs: objs},
+				provider: &genericprovider.InfrastructureProviderWrapper{
+					InfrastructureProvider: &operatorv1.InfrastructureProvider{
+						ObjectMeta: metav1.ObjectMeta{Name: "docker", Namespace: "capd-system"},
+					},
+				},
+			}
+
+			_, err := p.checkPermissions(context.Background())
+			g.Expect(reviews).To(Equal(tc.expectedReviews))
+
+			if tc.expectedError == "" {
+				g.Expect(err).ToNot(HaveOccurred())
+
+				return
+			}
+
+			var pe *PhaseError
+			g.Expect(errors.As(err, &pe)).To(BeTrue())
+			g.Expect(pe.Type).To(Equal(operatorv1.PreflightCheckCondition))
+			g.Expect(pe.Reason).To(Equal(operatorv1.MissingPermissionsReason))
+			g.Expect(err.Error()).To(Equal(tc.expectedError))
+		})
+	}
+}
+
+func TestInstallCRDPermissionDenied(t *testing.T) {
+	g := NewWithT(t)
+
+	crdName := "awsclusters.infrastructure.cluster.x-k8s.io"
+	forbidden := apierrors.NewForbidden(schema.GroupResource{Group: "apiextensions.k8s.io", Resource: "customresourcedefinitions"}, crdName,
+		errors.New(`User "system:serviceaccount:capi-operator-system:capi-operator-manager" cannot patch resource "customresourcedefinitions" `+
+			`in API group "apiextensions.k8s.io" at the cluster scope`))
+
+	fakeclient := fake.NewClientBuilder().WithInterceptorFuncs(interceptor.Funcs{
+		Patch: func(ctx context.Context, c client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+			return forbidden
+		},
+	}).Build()
+
+	p := &phaseReconciler{
+		ctrlClient: fakeclient,
+		provider: &genericprovider.InfrastructureProviderWrapper{
+			InfrastructureProvider: &operatorv1.InfrastructureProvider{
+				ObjectMeta: metav1.ObjectMeta{Name: "aws", Namespace: "capa-system"},
+			},
+		},
+		components: &fakeComponents{
+			objs: []unstructured.Unstructured{newUnstructured(apiextensionsv1.SchemeGroupVersion.WithKind("CustomResourceDefinition"), "", crdName)},
+		},
+		serverSideApply: true,
+	}
+
+	res, err := p.install(context.Background())
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(res.RequeueAfter).To(Equal(insufficientPermissionsRequeueAfter))
+	g.Expect(conditions.GetReason(p.provider, operatorv1.ProviderInstalledCondition)).To(Equal(operatorv1.InsufficientPermissionsReason))
+	g.Expect(conditions.GetSeverity(p.provider, operatorv1.ProviderInstalledCondition)).To(HaveValue(Equal(clusterv1.ConditionSeverityError)))
+	g.Expect(conditions.GetMessage(p.provider, operatorv1.ProviderInstalledCondition)).To(Equal(
+		"Operator is not allowed to patch CustomResourceDefinition awsclusters.infrastructure.cluster.x-k8s.io," +
+			" grant it the \"patch\" verb on customresourcedefinitions.apiextensions.k8s.io"))
+
+	// Forbidden errors on other kinds are reported as apply errors.
+	_, _, ok := crdPermissionDenied(apierrors.NewForbidden(schema.GroupResource{Group: "rbac.authorization.k8s.io", Resource: "clusterroles"}, "aws", errors.New("denied")))
+	g.Expect(ok).To(BeFalse())
+}
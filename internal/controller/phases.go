@@ -20,13 +20,21 @@ import (
 	"bytes"
 	"compress/gzip"
 	"context"
+	"crypto/sha256"
+	"errors"
 	"fmt"
 	"io"
+	"net/http"
 	"net/url"
+	"sort"
 	"strings"
+	"time"
 
 	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/serializer"
 	"k8s.io/apimachinery/pkg/types"
@@ -34,8 +42,10 @@ import (
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/rest"
+	"k8s.io/component-base/featuregate"
 	operatorv1 "sigs.k8s.io/cluster-api-operator/api/v1alpha2"
 	"sigs.k8s.io/cluster-api-operator/internal/controller/genericprovider"
+	"sigs.k8s.io/cluster-api-operator/internal/feature"
 	"sigs.k8s.io/cluster-api-operator/util"
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
 	clusterctlv1 "sigs.k8s.io/cluster-api/cmd/clusterctl/api/v1alpha3"
@@ -66,6 +76,45 @@ type phaseReconciler struct {
 	configClient       configclient.Client
 	components         repository.Components
 	clusterctlProvider *clusterctlv1.Provider
+	reconcileInterval  time.Duration
+	verifyPermissions  bool
+	skipInstanceCheck  bool
+	downloadLimiter    *DownloadLimiter
+	serverSideApply    bool
+	fieldManager       string
+	registryMirror     string
+	watchNamespace     string
+	featureGates       featuregate.FeatureGate
+	operatorVersion    string
+
+	disableNamespaceCreation  bool
+	checkNamespaceConventions bool
+
+	// fetchedFrom is the repository URL, or the ConfigMap, the provider components are fetched from.
+	fetchedFrom string
+	// fetchedETag is the ETag of the downloaded release tarball, stored with its manifests to revalidate it on the next download.
+	fetchedETag string
+	// sourceHash is the hash of the source the manifests are fetched from, stored with them to tell whether
+	// they were fetched from the current source.
+	sourceHash string
+	// manifestsConfigMaps maps the versions loaded from ConfigMaps to the ConfigMaps holding them.
+	manifestsConfigMaps map[string]client.ObjectKey
+	// overrides are the files of the provider version overridden by the overrides ConfigMap, if any.
+	overrides *manifestsOverrides
+	// metadataOverride replaces the metadata file of every provider version, if set by the metadata override ConfigMap.
+	metadataOverride []byte
+	// upgrading is true if the existing components were deleted to install the provider again, e.g. in another version.
+	upgrading bool
+	// previousVersion is the version that was installed before the existing components were deleted for an upgrade.
+	previousVersion string
+	// upgradeApproved is true if the upgrade requires approval and the approve upgrade annotation matches the target version.
+	upgradeApproved bool
+
+	// pinnedImages are the manager images of the rendered components pinned to digests, with spec.requireDigest.
+	pinnedImages []operatorv1.PinnedImage
+
+	// audit records the changes instead of making them, in audit mode. It's also the controller client then.
+	audit *auditClient
 }
 
 // reconcilePhaseFn is a function that represent a phase of the reconciliation.
@@ -83,11 +132,42 @@ func (p *PhaseError) Error() string {
 	return p.Err.Error()
 }
 
+// ReasonError classifies an error with the condition reason reported for it. Helpers running several
+// steps wrap their errors with it, so the phase reports which kind of step failed.
+type ReasonError struct {
+	Reason string
+	Err    error
+}
+
+func (r *ReasonError) Error() string {
+	return r.Err.Error()
+}
+
+func (r *ReasonError) Unwrap() error {
+	return r.Err
+}
+
+// withReason classifies the error with the given condition reason.
+func withReason(err error, reason string) error {
+	if err == nil {
+		return nil
+	}
+
+	return &ReasonError{Reason: reason, Err: err}
+}
+
+// wrapPhaseError wraps the error into a PhaseError for the provider installed condition. The reason of
+// a wrapped ReasonError takes precedence over the given one.
 func wrapPhaseError(err error, reason string) error {
 	if err == nil {
 		return nil
 	}
 
+	var reasonErr *ReasonError
+	if errors.As(err, &reasonErr) {
+		reason = reasonErr.Reason
+	}
+
 	return &PhaseError{
 		Err:      err,
 		Type:     operatorv1.ProviderInstalledCondition,
@@ -104,12 +184,48 @@ func newPhaseReconciler(r GenericProviderReconciler, provider genericprovider.Ge
 		clusterctlProvider: &clusterctlv1.Provider{},
 		provider:           provider,
 		providerList:       providerList,
+		reconcileInterval:  r.ReconcileInterval,
+		verifyPermissions:  r.VerifyPermissions,
+		skipInstanceCheck:  r.SkipSingleInstanceCheck,
+		downloadLimiter:    r.DownloadLimiter,
+		serverSideApply:    r.ServerSideApply,
+		fieldManager:       r.FieldManager,
+		registryMirror:     r.RegistryMirror,
+		watchNamespace:     r.WatchNamespace,
+		featureGates:       r.FeatureGates,
+		operatorVersion:    r.OperatorVersion,
+		audit:              r.audit,
+
+		disableNamespaceCreation:  r.DisableNamespaceCreation,
+		checkNamespaceConventions: r.CheckNamespaceConventions,
 	}
 }
 
+// featureEnabled returns true if the feature gate is enabled, in feature.Gates unless the reconciler has its own gates.
+func (p *phaseReconciler) featureEnabled(f featuregate.Feature) bool {
+	if p.featureGates == nil {
+		return feature.Gates.Enabled(f)
+	}
+
+	return p.featureGates.Enabled(f)
+}
+
 // preflightChecks a wrapper around the preflight checks.
 func (p *phaseReconciler) preflightChecks(ctx context.Context) (reconcile.Result, error) {
-	return preflightChecks(ctx, p.ctrlClient, p.provider, p.providerList)
+	// Objects outside of the watched namespace could belong to other tenants.
+	if outside := referencesOutsideNamespace(p.provider, p.watchNamespace); len(outside) > 0 {
+		conditions.Set(p.provider, conditions.FalseCondition(
+			operatorv1.PreflightCheckCondition,
+			operatorv1.ReferenceOutsideWatchNamespaceReason,
+			clusterv1.ConditionSeverityError,
+			referencesOutsideNamespaceMessage(outside, p.watchNamespace),
+		))
+
+		return reconcile.Result{}, fmt.Errorf("provider %q references objects outside of the watched namespace %q", p.provider.GetName(), p.watchNamespace)
+	}
+
+	return preflightChecks(ctx, p.ctrlClient, p.provider, p.providerList,
+		reconcileInterval(p.provider, p.reconcileInterval, preflightFailedRequeueAfter), p.skipInstanceCheck)
 }
 
 // initializePhaseReconciler initializes phase reconciler.
@@ -133,6 +249,10 @@ func (p *phaseReconciler) initializePhaseReconciler(ctx context.Context) (reconc
 		return reconcile.Result{}, wrapPhaseError(err, operatorv1.UnknownProviderReason)
 	}
 
+	if err := p.loadMetadataOverride(ctx); err != nil {
+		return reconcile.Result{}, wrapPhaseError(err, operatorv1.InvalidMetadataOverrideReason)
+	}
+
 	return reconcile.Result{}, nil
 }
 
@@ -155,14 +275,18 @@ func (p *phaseReconciler) load(ctx context.Context) (reconcile.Result, error) {
 		labelSelector = p.provider.GetSpec().FetchConfig.Selector
 	}
 
-	additionalManifests, err := p.fetchAddionalManifests(ctx)
-	if err != nil {
-		return reconcile.Result{}, wrapPhaseError(err, "failed to load additional manifests")
+	// Nothing is downloaded nor looked up when the overrides provide all the files.
+	if !p.overrides.complete() {
+		p.repo, err = p.configmapRepository(ctx, labelSelector)
+		if err != nil {
+			return reconcile.Result{}, wrapPhaseError(err, "failed to load the repository")
+		}
 	}
 
-	p.repo, err = p.configmapRepository(ctx, labelSelector, additionalManifests)
-	if err != nil {
-		return reconcile.Result{}, wrapPhaseError(err, "failed to load the repository")
+	p.repo = p.withMetadataOverride(p.repo)
+
+	if p.overrides != nil {
+		p.repo = p.overrides.repository(p.repo, spec.Version)
 	}
 
 	if spec.Version == "" {
@@ -177,10 +301,31 @@ func (p *phaseReconciler) load(ctx context.Context) (reconcile.Result, error) {
 			return reconcile.Result{}, wrapPhaseError(err, fmt.Sprintf("failed to get the latest version for provider %q", p.provider.GetName()))
 		}
 
+		log.Info("Using the newest version provided by the ConfigMaps", "version", spec.Version)
+
 		// Add latest version to the provider spec.
 		p.provider.SetSpec(spec)
 	}
 
+	// Components downloaded from a URL are cached in ConfigMaps, so only report the ConfigMap if it's a custom one.
+	if spec.FetchConfig != nil && spec.FetchConfig.Selector != nil && !p.overrides.complete() {
+		key, ok := p.manifestsConfigMaps[spec.Version]
+		if !ok {
+			err := fmt.Errorf("no ConfigMap found with selector %s for version %s", labelSelector.String(), spec.Version)
+
+			return reconcile.Result{}, wrapPhaseError(err, operatorv1.DownloadFailedReason)
+		}
+
+		p.fetchedFrom = fmt.Sprintf("ConfigMap %s", key)
+	}
+
+	switch {
+	case p.overrides.complete():
+		p.fetchedFrom = fmt.Sprintf("ConfigMap %s", p.overrides.configMap)
+	case p.overrides != nil:
+		p.fetchedFrom = fmt.Sprintf("%s, overridden by ConfigMap %s", p.fetchedFrom, p.overrides.configMap)
+	}
+
 	// Store some provider specific inputs for passing it to clusterctl library
 	p.options = repository.ComponentsOptions{
 		TargetNamespace:     p.provider.GetNamespace(),
@@ -188,8 +333,12 @@ func (p *phaseReconciler) load(ctx context.Context) (reconcile.Result, error) {
 		Version:             spec.Version,
 	}
 
-	if err := p.validateRepoCAPIVersion(); err != nil {
-		return reconcile.Result{}, wrapPhaseError(err, operatorv1.CAPIVersionIncompatibilityReason)
+	if err := p.validateRepoCAPIVersion(ctx); err != nil {
+		return reconcile.Result{}, wrapPhaseError(err, operatorv1.ContractMismatchReason)
+	}
+
+	if err := p.checkCoreProviderContract(ctx); err != nil {
+		return reconcile.Result{}, wrapPhaseError(err, operatorv1.ContractMismatchReason)
 	}
 
 	return reconcile.Result{}, nil
@@ -206,6 +355,17 @@ func (p *phaseReconciler) secretReader(ctx context.Context) (configclient.Reader
 		return nil, err
 	}
 
+	// Load the variables of the provider clusterctl configuration file first, so the ones set one by one in the
+	// configuration secret override them. Each provider gets its own reader, so variables never leak across providers.
+	variables, err := p.clusterctlConfigVariables(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for k, v := range variables {
+		mr.Set(k, v)
+	}
+
 	// Fetch configuration variables from the secret. See API field docs for more info.
 	if p.provider.GetSpec().ConfigSecret != nil {
 		secret := &corev1.Secret{}
@@ -222,6 +382,11 @@ func (p *phaseReconciler) secretReader(ctx context.Context) (configclient.Reader
 		log.Info("No configuration secret was specified")
 	}
 
+	// The provider variables are set last, so the manifests always get the values of this provider.
+	for k, v := range providerVariables(p.provider) {
+		mr.Set(k, v)
+	}
+
 	// If provided store fetch config url in memory reader.
 	if p.provider.GetSpec().FetchConfig != nil {
 		if p.provider.GetSpec().FetchConfig.URL != "" {
@@ -240,6 +405,25 @@ func (p *phaseReconciler) secretReader(ctx context.Context) (configclient.Reader
 
 			return mr.AddProvider(p.provider.GetName(), util.ClusterctlProviderType(p.provider), fakeURL)
 		}
+
+		if p.provider.GetSpec().FetchConfig.Git != nil {
+			log.Info("Custom fetch configuration Git repository was provided")
+
+			// Git URLs, e.g. SSH ones, aren't valid repository URLs for clusterctl, and the manifests
+			// are fetched outside of it anyway, so add a fake but well-formatted URL as for config maps.
+			fakeURL := "https://example.com/my-provider"
+
+			return mr.AddProvider(p.provider.GetName(), util.ClusterctlProviderType(p.provider), fakeURL)
+		}
+
+		if p.provider.GetSpec().FetchConfig.Helm != nil {
+			log.Info("Custom fetch configuration Helm chart was provided")
+
+			// The components are rendered from the chart outside of clusterctl, as for Git repositories.
+			fakeURL := "https://example.com/my-provider"
+
+			return mr.AddProvider(p.provider.GetName(), util.ClusterctlProviderType(p.provider), fakeURL)
+		}
 	}
 
 	return mr, nil
@@ -247,10 +431,12 @@ func (p *phaseReconciler) secretReader(ctx context.Context) (configclient.Reader
 
 // configmapRepository use clusterctl NewMemoryRepository structure to store the manifests
 // and metadata from a given configmap.
-func (p *phaseReconciler) configmapRepository(ctx context.Context, labelSelector *metav1.LabelSelector, additionalManifests string) (repository.Repository, error) {
+func (p *phaseReconciler) configmapRepository(ctx context.Context, labelSelector *metav1.LabelSelector) (repository.Repository, error) {
 	mr := repository.NewMemoryRepository()
 	mr.WithPaths("", "components.yaml")
 
+	p.manifestsConfigMaps = map[string]client.ObjectKey{}
+
 	cml := &corev1.ConfigMapList{}
 
 	selector, err := metav1.LabelSelectorAsSelector(labelSelector)
@@ -258,7 +444,14 @@ func (p *phaseReconciler) configmapRepository(ctx context.Context, labelSelector
 		return nil, err
 	}
 
-	if err = p.ctrlClient.List(ctx, cml, &client.ListOptions{LabelSelector: selector}); err != nil {
+	listOpts := &client.ListOptions{LabelSelector: selector}
+
+	// The ConfigMaps are looked up in all the namespaces, unless a namespace is set for them.
+	if fetchConfig := p.provider.GetSpec().FetchConfig; fetchConfig != nil && fetchConfig.ConfigMapNamespace != "" {
+		listOpts.Namespace = fetchConfig.ConfigMapNamespace
+	}
+
+	if err = p.ctrlClient.List(ctx, cml, listOpts); err != nil {
 		return nil, err
 	}
 
@@ -266,7 +459,38 @@ func (p *phaseReconciler) configmapRepository(ctx context.Context, labelSelector
 		return nil, fmt.Errorf("no ConfigMaps found with selector %s", labelSelector.String())
 	}
 
-	for _, cm := range cml.Items {
+	versions, configMaps, err := p.configMapsByVersion(cml.Items, labelSelector)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, version := range versions {
+		cm := configMaps[version]
+
+		metadata, components, err := getManifestsData(cm)
+		if err != nil {
+			return nil, err
+		}
+
+		mr.WithFile(version, metadataFile, []byte(metadata))
+
+		mr.WithFile(version, mr.ComponentsPath(), []byte(components))
+
+		p.manifestsConfigMaps[version] = client.ObjectKeyFromObject(&cm)
+	}
+
+	return mr, nil
+}
+
+// configMapsByVersion returns the versions provided by the ConfigMaps, in the order of the ConfigMaps, and the
+// ConfigMaps by version. The version is taken from the version label or from the ConfigMap name. When several
+// ConfigMaps provide the same version, the one in the manifests namespace, by default the provider namespace,
+// is picked, and it's an error if that doesn't settle it.
+func (p *phaseReconciler) configMapsByVersion(configMaps []corev1.ConfigMap, labelSelector *metav1.LabelSelector) ([]string, map[string]corev1.ConfigMap, error) {
+	versions := []string{}
+	candidates := map[string][]corev1.ConfigMap{}
+
+	for _, cm := range configMaps {
 		version := cm.Name
 		errMsg := "from the Name"
 
@@ -278,70 +502,111 @@ func (p *phaseReconciler) configmapRepository(ctx context.Context, labelSelector
 			}
 		}
 
-		if _, err = versionutil.ParseSemantic(version); err != nil {
-			return nil, fmt.Errorf("ConfigMap %s/%s has invalid version:%s (%s)", cm.Namespace, cm.Name, version, errMsg)
+		if _, err := versionutil.ParseSemantic(version); err != nil {
+			return nil, nil, fmt.Errorf("ConfigMap %s/%s has invalid version:%s (%s)", cm.Namespace, cm.Name, version, errMsg)
 		}
 
-		metadata, ok := cm.Data[metadataConfigMapKey]
-		if !ok {
-			return nil, fmt.Errorf("ConfigMap %s/%s has no metadata", cm.Namespace, cm.Name)
+		if _, ok := candidates[version]; !ok {
+			versions = append(versions, version)
 		}
 
-		mr.WithFile(version, metadataFile, []byte(metadata))
+		candidates[version] = append(candidates[version], cm)
+	}
 
-		components, err := getComponentsData(cm)
-		if err != nil {
-			return nil, err
+	byVersion := make(map[string]corev1.ConfigMap, len(candidates))
+
+	for version, cms := range candidates {
+		inNamespace := []corev1.ConfigMap{}
+
+		for _, cm := range cms {
+			if cm.Namespace == manifestsNamespace(p.provider) {
+				inNamespace = append(inNamespace, cm)
+			}
 		}
 
-		if additionalManifests != "" {
-			components = components + "\n---\n" + additionalManifests
+		if len(inNamespace) > 0 {
+			cms = inNamespace
 		}
 
-		mr.WithFile(version, mr.ComponentsPath(), []byte(components))
+		if len(cms) > 1 {
+			names := make([]string, 0, len(cms))
+			for _, cm := range cms {
+				names = append(names, client.ObjectKeyFromObject(&cm).String())
+			}
+
+			sort.Strings(names)
+
+			return nil, nil, fmt.Errorf("more than one ConfigMap found with selector %s for version %s: %s", labelSelector.String(), version, strings.Join(names, ", "))
+		}
+
+		byVersion[version] = cms[0]
 	}
 
-	return mr, nil
+	return versions, byVersion, nil
 }
 
-func (p *phaseReconciler) fetchAddionalManifests(ctx context.Context) (string, error) {
-	cm := &corev1.ConfigMap{}
+// getManifestsData returns the metadata and components data of the ConfigMap, split from its combined manifest
+// if it has one.
+func getManifestsData(cm corev1.ConfigMap) (string, string, error) {
+	_, inData := cm.Data[manifestConfigMapKey]
+	_, inBinaryData := cm.BinaryData[manifestConfigMapKey]
 
-	if p.provider.GetSpec().AdditionalManifestsRef != nil {
-		key := types.NamespacedName{Namespace: p.provider.GetSpec().AdditionalManifestsRef.Namespace, Name: p.provider.GetSpec().AdditionalManifestsRef.Name}
+	if inData || inBinaryData {
+		manifest, err := getConfigMapData(cm, manifestConfigMapKey)
+		if err != nil {
+			return "", "", err
+		}
 
-		if err := p.ctrlClient.Get(ctx, key, cm); err != nil {
-			return "", fmt.Errorf("failed to get ConfigMap %s/%s: %w", key.Namespace, key.Name, err)
+		metadata, components, err := splitManifest(manifest)
+		if err != nil {
+			return "", "", fmt.Errorf("invalid %s in ConfigMap %s/%s: %w", manifestConfigMapKey, cm.Namespace, cm.Name, err)
 		}
+
+		return metadata, components, nil
+	}
+
+	metadata, ok := cm.Data[metadataConfigMapKey]
+	if !ok {
+		return "", "", fmt.Errorf("ConfigMap %s/%s has no metadata", cm.Namespace, cm.Name)
 	}
 
-	return cm.Data[additionalManifestsConfigMapKey], nil
+	components, err := getComponentsData(cm)
+	if err != nil {
+		return "", "", err
+	}
+
+	return metadata, components, nil
 }
 
 // getComponentsData returns components data based on if it's compressed or not.
 func getComponentsData(cm corev1.ConfigMap) (string, error) {
+	return getConfigMapData(cm, componentsConfigMapKey)
+}
+
+// getConfigMapData returns the data of the key based on if it's compressed or not.
+func getConfigMapData(cm corev1.ConfigMap, key string) (string, error) {
 	// Data is not compressed, return it immediately.
 	if cm.GetAnnotations()[compressedAnnotation] != "true" {
-		components, ok := cm.Data[componentsConfigMapKey]
+		data, ok := cm.Data[key]
 		if !ok {
-			return "", fmt.Errorf("ConfigMap %s/%s Data has no components", cm.Namespace, cm.Name)
+			return "", fmt.Errorf("ConfigMap %s/%s Data has no %s", cm.Namespace, cm.Name, key)
 		}
 
-		return components, nil
+		return data, nil
 	}
 
 	// Otherwise we have to decompress the data first.
-	compressedComponents, ok := cm.BinaryData[componentsConfigMapKey]
+	compressedData, ok := cm.BinaryData[key]
 	if !ok {
-		return "", fmt.Errorf("ConfigMap %s/%s BinaryData has no components", cm.Namespace, cm.Name)
+		return "", fmt.Errorf("ConfigMap %s/%s BinaryData has no %s", cm.Namespace, cm.Name, key)
 	}
 
-	zr, err := gzip.NewReader(bytes.NewReader(compressedComponents))
+	zr, err := gzip.NewReader(bytes.NewReader(compressedData))
 	if err != nil {
 		return "", err
 	}
 
-	components, err := io.ReadAll(zr)
+	data, err := io.ReadAll(zr)
 	if err != nil {
 		return "", fmt.Errorf("cannot decompress data from ConfigMap %s/%s", cm.Namespace, cm.Name)
 	}
@@ -350,24 +615,30 @@ func getComponentsData(cm corev1.ConfigMap) (string, error) {
 		return "", err
 	}
 
-	return string(components), nil
+	return string(data), nil
 }
 
 // validateRepoCAPIVersion checks that the repo is using the correct version.
-func (p *phaseReconciler) validateRepoCAPIVersion() error {
+func (p *phaseReconciler) validateRepoCAPIVersion(ctx context.Context) error {
 	name := p.provider.GetName()
 
 	file, err := p.repo.GetFile(p.options.Version, metadataFile)
 	if err != nil {
-		return fmt.Errorf("failed to read %q from the repository for provider %q: %w", metadataFile, name, err)
+		err = fmt.Errorf("failed to read %q from the repository for provider %q: %w", metadataFile, name, err)
+
+		return withReason(err, operatorv1.DownloadFailedReason)
 	}
 
 	// Convert the yaml into a typed object
-	latestMetadata := &clusterctlv1.Metadata{}
-	codecFactory := serializer.NewCodecFactory(scheme.Scheme)
+	latestMetadata, err := decodeMetadata(file)
+	if err != nil {
+		err = fmt.Errorf("error decoding %q for provider %q: %w", metadataFile, name, err)
 
-	if err := runtime.DecodeInto(codecFactory.UniversalDecoder(), file, latestMetadata); err != nil {
-		return fmt.Errorf("error decoding %q for provider %q: %w", metadataFile, name, err)
+		return withReason(err, operatorv1.DecodeFailedReason)
+	}
+
+	if err := p.checkOperatorVersion(ctx, latestMetadata); err != nil {
+		return withReason(err, operatorv1.OperatorVersionTooOldReason)
 	}
 
 	// Gets the contract for the target release.
@@ -376,18 +647,38 @@ func (p *phaseReconciler) validateRepoCAPIVersion() error {
 		return fmt.Errorf("failed to parse current version for the %s provider: %w", name, err)
 	}
 
-	releaseSeries := latestMetadata.GetReleaseSeriesForVersion(targetVersion)
-	if releaseSeries == nil {
+	contracts := versionContracts(latestMetadata, targetVersion)
+	if len(contracts) == 0 {
 		return fmt.Errorf("invalid provider metadata: version %s for the provider %s does not match any release series", p.options.Version, name)
 	}
 
-	if releaseSeries.Contract != "v1alpha4" && releaseSeries.Contract != "v1beta1" {
-		return fmt.Errorf(capiVersionIncompatibilityMessage, clusterv1.GroupVersion.Version, releaseSeries.Contract, name)
+	supported := []string{}
+
+	for _, contract := range contracts {
+		if contract == "v1alpha4" || contract == "v1beta1" {
+			supported = append(supported, contract)
+		}
 	}
 
-	p.contract = releaseSeries.Contract
+	if len(supported) == 0 {
+		return fmt.Errorf(capiVersionIncompatibilityMessage, clusterv1.GroupVersion.Version, contractsList(contracts), name)
+	}
 
-	return nil
+	p.contract, err = resolveContract(ctx, p.ctrlClient, p.provider, supported)
+
+	return err
+}
+
+// decodeMetadata converts the metadata yaml into a typed object.
+func decodeMetadata(file []byte) (*clusterctlv1.Metadata, error) {
+	metadata := &clusterctlv1.Metadata{}
+	codecFactory := serializer.NewCodecFactory(scheme.Scheme)
+
+	if err := runtime.DecodeInto(codecFactory.UniversalDecoder(), file, metadata); err != nil {
+		return nil, err
+	}
+
+	return metadata, nil
 }
 
 // fetch fetches the provider components from the repository and processes all yaml manifests.
@@ -395,38 +686,113 @@ func (p *phaseReconciler) fetch(ctx context.Context) (reconcile.Result, error) {
 	log := ctrl.LoggerFrom(ctx)
 	log.Info("Fetching provider")
 
+	var err error
+
+	p.components, err = p.newComponents(ctx, p.repo, p.options.Version)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+
+	setImageOverriddenCondition(p.provider)
+
+	if err := p.setConventionalNamespaceCondition(ctx); err != nil {
+		return reconcile.Result{}, err
+	}
+
+	conditions.Set(p.provider, conditions.TrueCondition(operatorv1.ProviderInstalledCondition))
+
+	return reconcile.Result{}, nil
+}
+
+// newComponents reads the provider components of the given version from the repository, and processes
+// and customizes them as configured in the provider spec.
+func (p *phaseReconciler) newComponents(ctx context.Context, repo repository.Repository, version string) (repository.Components, error) {
 	// Fetch the provider components yaml file from the provided repository GitHub/GitLab/ConfigMap.
-	componentsFile, err := p.repo.GetFile(p.options.Version, p.repo.ComponentsPath())
+	componentsFile, err := repo.GetFile(version, repo.ComponentsPath())
 	if err != nil {
-		err = fmt.Errorf("failed to read %q from provider's repository %q: %w", p.repo.ComponentsPath(), p.providerConfig.ManifestLabel(), err)
+		err = fmt.Errorf("failed to read %q from provider's repository %q: %w", repo.ComponentsPath(), p.providerConfig.ManifestLabel(), err)
 
-		return reconcile.Result{}, wrapPhaseError(err, operatorv1.ComponentsFetchErrorReason)
+		return nil, wrapPhaseError(err, operatorv1.DownloadFailedReason)
 	}
 
+	options := p.options
+	options.Version = version
+
 	// Generate a set of new objects using the clusterctl library. NewComponents() will do the yaml processing,
 	// like ensure all the provider components are in proper namespace, replace variables, etc. See the clusterctl
 	// documentation for more details.
-	p.components, err = repository.NewComponents(repository.ComponentsInput{
+	components, err := repository.NewComponents(repository.ComponentsInput{
 		Provider:     p.providerConfig,
 		ConfigClient: p.configClient,
 		Processor:    yamlprocessor.NewSimpleProcessor(),
 		RawYaml:      componentsFile,
-		Options:      p.options,
+		Options:      options,
 	})
 	if err != nil {
-		return reconcile.Result{}, wrapPhaseError(err, operatorv1.ComponentsFetchErrorReason)
+		return nil, wrapPhaseError(err, operatorv1.DecodeFailedReason)
+	}
+
+	// The excluded objects are removed first, so they are neither customized nor installed.
+	if patterns := p.provider.GetSpec().ExcludeObjects; len(patterns) > 0 {
+		if err := repository.AlterComponents(components, excludeObjectsFn(ctx, patterns)); err != nil {
+			return nil, wrapPhaseError(err, operatorv1.DecodeFailedReason)
+		}
+	}
+
+	// The registry mirror applies to all the images, before the images overridden by the provider spec.
+	if p.registryMirror != "" {
+		ctrl.LoggerFrom(ctx).Info("Rewriting provider images to the registry mirror", "registryMirror", p.registryMirror)
+
+		if err := repository.AlterComponents(components, mirrorImagesFn(p.registryMirror)); err != nil {
+			return nil, wrapPhaseError(err, operatorv1.DecodeFailedReason)
+		}
 	}
 
 	// ProviderSpec provides fields for customizing the provider deployment options.
 	// We can use clusterctl library to apply this customizations.
-	err = repository.AlterComponents(p.components, customizeObjectsFn(p.provider))
+	err = repository.AlterComponents(components, customizeObjectsFn(p.provider))
 	if err != nil {
-		return reconcile.Result{}, wrapPhaseError(err, operatorv1.ComponentsFetchErrorReason)
+		var conflictErr *volumeConflictError
+		if errors.As(err, &conflictErr) {
+			return nil, wrapPhaseError(err, operatorv1.VolumeMountConflictReason)
+		}
+
+		var initContainerErr *initContainerConflictError
+		if errors.As(err, &initContainerErr) {
+			return nil, wrapPhaseError(err, operatorv1.InitContainerConflictReason)
+		}
+
+		var portErr *portConflictError
+		if errors.As(err, &portErr) {
+			return nil, wrapPhaseError(err, operatorv1.PortConflictReason)
+		}
+
+		return nil, wrapPhaseError(err, operatorv1.DecodeFailedReason)
 	}
 
-	conditions.Set(p.provider, conditions.TrueCondition(operatorv1.ProviderInstalledCondition))
+	// Multiple instances of the same provider can be installed in one namespace, so make sure
+	// their Deployments don't collide.
+	err = repository.AlterComponents(components, p.disambiguateObjectsFn(ctx))
+	if err != nil {
+		return nil, wrapPhaseError(err, operatorv1.DecodeFailedReason)
+	}
 
-	return reconcile.Result{}, nil
+	// The organization policies may mutate the components, once the operator is done with them.
+	err = repository.AlterComponents(components, p.transformObjectsFn(ctx, version))
+	if err != nil {
+		return nil, wrapPhaseError(err, operatorv1.ManifestTransformFailedReason)
+	}
+
+	// The final images are pinned, so the digests match the images that are applied.
+	p.pinnedImages = nil
+
+	if p.provider.GetSpec().RequireDigest {
+		if err := repository.AlterComponents(components, p.pinImagesFn(ctx, version)); err != nil {
+			return nil, wrapPhaseError(err, operatorv1.ImageDigestResolutionFailedReason)
+		}
+	}
+
+	return components, nil
 }
 
 // preInstall ensure all the clusterctl CRDs are available before installing the provider,
@@ -441,6 +807,9 @@ func (p *phaseReconciler) preInstall(ctx context.Context) (reconcile.Result, err
 
 	log.Info("Changes detected, deleting existing components")
 
+	p.upgrading = true
+	p.previousVersion = *p.provider.GetStatus().InstalledVersion
+
 	return p.delete(ctx)
 }
 
@@ -452,27 +821,312 @@ func (p *phaseReconciler) install(ctx context.Context) (reconcile.Result, error)
 
 	log.Info("Installing provider")
 
-	if err := clusterClient.ProviderComponents().Create(p.components.Objs()); err != nil {
-		reason := "Install failed"
-		if wait.Interrupted(err) {
-			reason = "Timed out waiting for deployment to become ready"
+	objs := p.componentsToInstall()
+
+	// The delete before the upgrade preserves the CRDs, so only reinstall the ones that don't exist yet if requested.
+	if upgrade := p.provider.GetSpec().Upgrade; p.upgrading && upgrade != nil && upgrade.SkipCRDs {
+		var skipped []string
+
+		var err error
+
+		objs, skipped, err = withoutInstalledCRDs(ctx, p.ctrlClient, objs)
+		if err != nil {
+			return reconcile.Result{}, wrapPhaseError(err, operatorv1.ApplyFailedReason)
 		}
 
-		return reconcile.Result{}, wrapPhaseError(err, reason)
+		log.Info("Skipping the upgrade of installed CustomResourceDefinitions", "crds", skipped)
+	}
+
+	// In audit mode, the components are compared with the live ones instead of being applied.
+	if p.audit != nil {
+		return p.auditInstall(ctx, objs)
+	}
+
+	if err := p.applyComponents(ctx, objs); err != nil {
+		// Rolling back would need the same permissions, so the install is retried once the RBAC is fixed instead.
+		if verb, crd, ok := crdPermissionDenied(err); ok {
+			log.Info("Operator is not allowed to apply a CustomResourceDefinition", "verb", verb, "crd", crd)
+			conditions.Set(p.provider, conditions.FalseCondition(operatorv1.ProviderInstalledCondition, operatorv1.InsufficientPermissionsReason,
+				clusterv1.ConditionSeverityError, insufficientCRDPermissionsMessage, verb, crd, verb))
+
+			return reconcile.Result{RequeueAfter: reconcileInterval(p.provider, p.reconcileInterval, insufficientPermissionsRequeueAfter)}, nil
+		}
+
+		return reconcile.Result{}, p.rollbackUpgrade(ctx, wrapPhaseError(err, installErrorReason(err)))
+	}
+
+	if err := p.updateInventory(clusterClient); err != nil {
+		return reconcile.Result{}, wrapPhaseError(err, operatorv1.InventoryUpdateErrorReason)
+	}
+
+	hash, err := componentsHash(p.componentsToInstall())
+	if err != nil {
+		return reconcile.Result{}, wrapPhaseError(err, operatorv1.ApplyFailedReason)
 	}
 
 	status := p.provider.GetStatus()
 	status.Contract = &p.contract
 	installedVersion := p.components.Version()
 	status.InstalledVersion = &installedVersion
+	status.FetchedFrom = &p.fetchedFrom
+	status.InstalledComponents = componentReferences(p.componentsToInstall())
+	status.AppliedComponentsHash = &hash
+	status.PinnedImages = p.pinnedImages
 	p.provider.SetStatus(status)
 
+	// The drift is only detected while the applied components are stored, but the provider is installed anyway.
+	if err := p.storeAppliedComponents(ctx, p.componentsToInstall(), hash); err != nil {
+		log.Error(err, "Failed to store the applied components, skipping the drift detection until the next install")
+	}
+
+	p.clearUpgradeApproval()
+
 	log.Info("Provider successfully installed")
 	conditions.Set(p.provider, conditions.TrueCondition(operatorv1.ProviderInstalledCondition))
 
 	return reconcile.Result{}, nil
 }
 
+// rollbackUpgrade installs the previously installed version again, on a best-effort basis, when installing the
+// target version of an upgrade failed and rollbackOnFailure is enabled. The partially installed components are
+// deleted first, and the CRDs keep the changes applied for the target version. The returned
+// error reports the install error along with the outcome of the rollback, so the upgrade is retried.
+func (p *phaseReconciler) rollbackUpgrade(ctx context.Context, installErr error) error {
+	upgrade := p.provider.GetSpec().Upgrade
+	if !p.upgrading || p.previousVersion == "" || upgrade == nil || !upgrade.RollbackOnFailure {
+		return installErr
+	}
+
+	log := ctrl.LoggerFrom(ctx)
+
+	log.Info("Upgrade failed, rolling back to the previously installed version", "targetVersion", p.options.Version, "previousVersion", p.previousVersion)
+
+	if err := p.reinstallPreviousVersion(ctx); err != nil {
+		log.Error(err, "Failed to roll back the upgrade", "previousVersion", p.previousVersion)
+
+		return &PhaseError{
+			Err:      fmt.Errorf("%w, and the rollback to %s failed: %v", installErr, p.previousVersion, err),
+			Type:     operatorv1.ProviderInstalledCondition,
+			Reason:   operatorv1.RollbackFailedReason,
+			Severity: clusterv1.ConditionSeverityError,
+		}
+	}
+
+	return &PhaseError{
+		Err:      fmt.Errorf("upgrade to %s was rolled back to %s: %w", p.options.Version, p.previousVersion, installErr),
+		Type:     operatorv1.ProviderInstalledCondition,
+		Reason:   operatorv1.UpgradeRolledBackReason,
+		Severity: clusterv1.ConditionSeverityWarning,
+	}
+}
+
+// reinstallPreviousVersion deletes the partially installed components of the target version, except for the
+// CRDs, and installs the components of the previously installed version.
+func (p *phaseReconciler) reinstallPreviousVersion(ctx context.Context) error {
+	repo := p.repo
+
+	// The downloaded manifests are cached in a ConfigMap per version, and only the one of the target version is loaded.
+	if spec := p.provider.GetSpec(); spec.FetchConfig == nil || spec.FetchConfig.Selector == nil {
+		labels := p.prepareConfigMapLabels()
+		labels[configMapVersionLabel] = p.previousVersion
+
+		var err error
+
+		repo, err = p.configmapRepository(ctx, &metav1.LabelSelector{MatchLabels: labels})
+		if err != nil {
+			return fmt.Errorf("failed to load the manifests of version %s: %w", p.previousVersion, err)
+		}
+	}
+
+	components, err := p.newComponents(ctx, repo, p.previousVersion)
+	if err != nil {
+		return err
+	}
+
+	clusterClient := p.newClusterClient()
+
+	p.clusterctlProvider.Name = clusterctlProviderName(p.provider).Name
+	p.clusterctlProvider.Namespace = p.provider.GetNamespace()
+	p.clusterctlProvider.Type = string(util.ClusterctlProviderType(p.provider))
+	p.clusterctlProvider.ProviderName = p.provider.GetName()
+	p.clusterctlProvider.Version = p.options.Version
+
+	deleteOptions := providerDeleteOptions(p.provider, *p.clusterctlProvider)
+	deleteOptions.IncludeCRDs = false
+
+	if err := clusterClient.ProviderComponents().Delete(deleteOptions); err != nil {
+		return fmt.Errorf("failed to delete the components of version %s: %w", p.options.Version, err)
+	}
+
+	p.components = components
+
+	// Applying the CRDs of the previous version would revert the schemas and storage versions the target
+	// version may already rely on, so only the missing ones are installed.
+	objs, _, err := withoutInstalledCRDs(ctx, p.ctrlClient, p.componentsToInstall())
+	if err != nil {
+		return err
+	}
+
+	if err := p.applyComponents(ctx, objs); err != nil {
+		return err
+	}
+
+	if err := p.updateInventory(clusterClient); err != nil {
+		return err
+	}
+
+	hash, err := componentsHash(p.componentsToInstall())
+	if err != nil {
+		return err
+	}
+
+	status := p.provider.GetStatus()
+	status.InstalledVersion = &p.previousVersion
+	status.FetchedFrom = &p.fetchedFrom
+	status.InstalledComponents = componentReferences(p.componentsToInstall())
+	status.AppliedComponentsHash = &hash
+	status.PinnedImages = p.pinnedImages
+	p.provider.SetStatus(status)
+
+	if err := p.storeAppliedComponents(ctx, p.componentsToInstall(), hash); err != nil {
+		ctrl.LoggerFrom(ctx).Error(err, "Failed to store the applied components, skipping the drift detection until the next install")
+	}
+
+	return nil
+}
+
+// installErrorReason returns the condition reason for an error creating the provider components.
+func installErrorReason(err error) string {
+	if wait.Interrupted(err) {
+		return operatorv1.ReadinessTimeoutReason
+	}
+
+	return operatorv1.ApplyFailedReason
+}
+
+// isCRD returns true if the object is a CustomResourceDefinition.
+func isCRD(obj unstructured.Unstructured) bool {
+	return obj.GroupVersionKind().GroupKind() == apiextensionsv1.Kind("CustomResourceDefinition")
+}
+
+// componentsToInstall returns the provider components installed by the operator, i.e. the ones matching the
+// component selector, if any, but the CustomResourceDefinitions if the provider skips them.
+func (p *phaseReconciler) componentsToInstall() []unstructured.Unstructured {
+	objs := p.components.Objs()
+	if selector := p.provider.GetSpec().ComponentSelector; selector != nil {
+		objs = selectComponents(objs, selector)
+	}
+
+	if p.disableNamespaceCreation {
+		objs = withoutNamespaces(objs)
+	}
+
+	if !p.provider.GetSpec().SkipCRDs {
+		return objs
+	}
+
+	filtered := make([]unstructured.Unstructured, 0, len(objs))
+
+	for _, obj := range objs {
+		if !isCRD(obj) {
+			filtered = append(filtered, obj)
+		}
+	}
+
+	return filtered
+}
+
+// checkSkippedCRDs verifies that the CustomResourceDefinitions of a provider installed without them exist,
+// before the installed components are touched, so the provider controllers don't run without them.
+func (p *phaseReconciler) checkSkippedCRDs(ctx context.Context) (reconcile.Result, error) {
+	if !p.provider.GetSpec().SkipCRDs {
+		return reconcile.Result{}, nil
+	}
+
+	missing := []string{}
+
+	for _, obj := range p.components.Objs() {
+		if !isCRD(obj) {
+			continue
+		}
+
+		crd := &apiextensionsv1.CustomResourceDefinition{}
+
+		err := p.ctrlClient.Get(ctx, client.ObjectKey{Name: obj.GetName()}, crd)
+		if apierrors.IsNotFound(err) {
+			missing = append(missing, obj.GetName())
+
+			continue
+		}
+
+		if err != nil {
+			return reconcile.Result{}, fmt.Errorf("failed to get CustomResourceDefinition %q: %w", obj.GetName(), err)
+		}
+	}
+
+	if len(missing) > 0 {
+		sort.Strings(missing)
+
+		return reconcile.Result{}, &PhaseError{
+			Err:      fmt.Errorf("CustomResourceDefinitions of provider %q installed without CRDs don't exist: %s", p.provider.GetName(), strings.Join(missing, ", ")),
+			Type:     operatorv1.PreflightCheckCondition,
+			Reason:   operatorv1.MissingCRDsReason,
+			Severity: clusterv1.ConditionSeverityError,
+		}
+	}
+
+	return reconcile.Result{}, nil
+}
+
+// withoutInstalledCRDs returns the objects without the CustomResourceDefinitions that are already installed,
+// along with the names of the skipped ones.
+func withoutInstalledCRDs(ctx context.Context, c client.Client, objs []unstructured.Unstructured) ([]unstructured.Unstructured, []string, error) {
+	filtered := make([]unstructured.Unstructured, 0, len(objs))
+	skipped := []string{}
+
+	for _, obj := range objs {
+		if !isCRD(obj) {
+			filtered = append(filtered, obj)
+
+			continue
+		}
+
+		crd := &apiextensionsv1.CustomResourceDefinition{}
+
+		err := c.Get(ctx, client.ObjectKey{Name: obj.GetName()}, crd)
+		if apierrors.IsNotFound(err) {
+			filtered = append(filtered, obj)
+
+			continue
+		}
+
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to get CustomResourceDefinition %q: %w", obj.GetName(), err)
+		}
+
+		skipped = append(skipped, obj.GetName())
+	}
+
+	return filtered, skipped, nil
+}
+
+// updateInventory reflects the installed provider into a clusterctl inventory object, so tools
+// relying on the clusterctl inventory see the providers managed by the operator.
+// The inventory object is removed together with the other provider components on delete.
+func (p *phaseReconciler) updateInventory(clusterClient cluster.Client) error {
+	inventoryClient := clusterClient.ProviderInventory()
+
+	if err := inventoryClient.EnsureCustomResourceDefinitions(); err != nil {
+		return fmt.Errorf("failed to ensure clusterctl inventory CRDs: %w", err)
+	}
+
+	if err := inventoryClient.Create(p.components.InventoryObject()); err != nil {
+		return fmt.Errorf("failed to update clusterctl inventory: %w", err)
+	}
+
+	return nil
+}
+
 // delete deletes the provider components using clusterctl library.
 func (p *phaseReconciler) delete(ctx context.Context) (reconcile.Result, error) {
 	log := ctrl.LoggerFrom(ctx)
@@ -491,13 +1145,100 @@ func (p *phaseReconciler) delete(ctx context.Context) (reconcile.Result, error)
 		p.clusterctlProvider.Version = p.options.Version
 	}
 
-	err := clusterClient.ProviderComponents().Delete(cluster.DeleteOptions{
-		Provider:         *p.clusterctlProvider,
+	deleteOptions := providerDeleteOptions(p.provider, *p.clusterctlProvider)
+	if deleteOptions.IncludeCRDs {
+		log.Info("Deleting provider CustomResourceDefinitions", "deletionPolicy", operatorv1.ForegroundDeletionPolicy)
+	}
+
+	err := clusterClient.ProviderComponents().Delete(deleteOptions)
+	if err != nil {
+		return reconcile.Result{}, wrapPhaseError(err, operatorv1.OldComponentsDeletionErrorReason)
+	}
+
+	// Nothing is deleted in audit mode, so there are no pods to wait for and the version is still installed.
+	if p.audit != nil {
+		return reconcile.Result{}, nil
+	}
+
+	// The installed version is kept until the pods are gone, so the deletion is checked again when requeued.
+	if p.upgrading {
+		if res, err := p.waitForPodsDeletion(ctx); !res.IsZero() || err != nil {
+			return res, err
+		}
+	}
+
+	status := p.provider.GetStatus()
+	status.InstalledVersion = nil
+	status.FetchedFrom = nil
+	status.InstalledComponents = nil
+	status.PinnedImages = nil
+	p.provider.SetStatus(status)
+
+	return reconcile.Result{}, nil
+}
+
+// providerDeleteOptions returns the options for deleting the components of the provider. The namespace is
+// always kept, while the CRDs are only deleted with the foreground deletion policy, unless they are skipped.
+func providerDeleteOptions(provider genericprovider.GenericProvider, clusterctlProvider clusterctlv1.Provider) cluster.DeleteOptions {
+	return cluster.DeleteOptions{
+		Provider:         clusterctlProvider,
 		IncludeNamespace: false,
-		IncludeCRDs:      false,
+		IncludeCRDs:      provider.GetSpec().DeletionPolicy == operatorv1.ForegroundDeletionPolicy && !provider.GetSpec().SkipCRDs,
+	}
+}
+
+// componentsHash returns the hex encoded SHA-256 hash of the given objects, in their order.
+func componentsHash(objs []unstructured.Unstructured) (string, error) {
+	hash := sha256.New()
+
+	for _, obj := range objs {
+		data, err := obj.MarshalJSON()
+		if err != nil {
+			return "", fmt.Errorf("cannot calculate the components hash: %w", err)
+		}
+
+		if _, err := hash.Write(data); err != nil {
+			return "", fmt.Errorf("cannot calculate the components hash: %w", err)
+		}
+	}
+
+	return fmt.Sprintf("%x", hash.Sum(nil)), nil
+}
+
+// componentReferences returns the references to the given objects, sorted by group, kind, namespace and name.
+func componentReferences(objs []unstructured.Unstructured) []operatorv1.ComponentReference {
+	refs := make([]operatorv1.ComponentReference, 0, len(objs))
+
+	for _, obj := range objs {
+		gvk := obj.GroupVersionKind()
+		refs = append(refs, operatorv1.ComponentReference{
+			Group:     gvk.Group,
+			Version:   gvk.Version,
+			Kind:      gvk.Kind,
+			Namespace: obj.GetNamespace(),
+			Name:      obj.GetName(),
+		})
+	}
+
+	sort.Slice(refs, func(i, j int) bool {
+		a, b := refs[i], refs[j]
+
+		if a.Group != b.Group {
+			return a.Group < b.Group
+		}
+
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+
+		return a.Name < b.Name
 	})
 
-	return reconcile.Result{}, wrapPhaseError(err, operatorv1.OldComponentsDeletionErrorReason)
+	return refs
 }
 
 func clusterctlProviderName(provider genericprovider.GenericProvider) client.ObjectKey {
@@ -525,8 +1266,9 @@ func (p *phaseReconciler) newClusterClient() cluster.Client {
 }
 
 // repositoryFactory returns the repository implementation corresponding to the provider URL.
+// If httpClient is not nil, it is used for fetching files from GitLab repositories.
 // inspired by https://github.com/kubernetes-sigs/cluster-api/blob/124d9be7035e492f027cdc7a701b6b179451190a/cmd/clusterctl/client/repository/client.go#L170
-func repositoryFactory(providerConfig configclient.Provider, configVariablesClient configclient.VariablesClient) (repository.Repository, error) {
+func repositoryFactory(providerConfig configclient.Provider, configVariablesClient configclient.VariablesClient, httpClient *http.Client) (repository.Repository, error) {
 	// parse the repository url
 	rURL, err := url.Parse(providerConfig.URL())
 	if err != nil {
@@ -549,6 +1291,15 @@ func repositoryFactory(providerConfig configclient.Provider, configVariablesClie
 
 	// if the url is a GitLab repository
 	if strings.HasPrefix(rURL.Host, gitlabHostPrefix) && strings.HasPrefix(rURL.RawPath, gitlabPackagesAPIPrefix) {
+		if httpClient != nil {
+			repo, err := newGitLabRepository(providerConfig, httpClient)
+			if err != nil {
+				return nil, fmt.Errorf("error creating the GitLab repository client: %w", err)
+			}
+
+			return repo, err
+		}
+
 		repo, err := repository.NewGitLabRepository(providerConfig, configVariablesClient)
 		if err != nil {
 			return nil, fmt.Errorf("error creating the GitLab repository client: %w", err)
@@ -564,7 +1315,7 @@ func getLatestVersion(repoVersions []string) (string, error) {
 	if len(repoVersions) == 0 {
 		err := fmt.Errorf("no versions available")
 
-		return "", wrapPhaseError(err, operatorv1.ComponentsFetchErrorReason)
+		return "", wrapPhaseError(err, operatorv1.DownloadFailedReason)
 	}
 
 	// Initialize latest version with the first element value.
@@ -18,14 +18,22 @@ package controller
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"testing"
 
 	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clusterctlv1 "sigs.k8s.io/cluster-api/cmd/clusterctl/api/v1alpha3"
 	configclient "sigs.k8s.io/cluster-api/cmd/clusterctl/client/config"
 	"sigs.k8s.io/cluster-api/cmd/clusterctl/client/repository"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 
 	operatorv1 "sigs.k8s.io/cluster-api-operator/api/v1alpha2"
@@ -100,6 +108,111 @@ func TestSecretReader(t *testing.T) {
 	g.Expect(exptectedProviderData).To(Equal("- name: cluster-api\n  type: CoreProvider\n  url: https://example.com\n"))
 }
 
+func TestSecretReaderClusterctlConfig(t *testing.T) {
+	g := NewWithT(t)
+
+	fakeclient := fake.NewClientBuilder().WithObjects(
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "clusterctl-config", Namespace: "tenant-a"},
+			Data: map[string][]byte{
+				"clusterctl.yaml": []byte("AWS_REGION: eu-west-1\nAWS_B64ENCODED_CREDENTIALS: from-file\nEXP_MACHINE_POOL: true\n"),
+			},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "variables", Namespace: "tenant-a"},
+			Data: map[string][]byte{
+				"AWS_B64ENCODED_CREDENTIALS": []byte("from-secret"),
+			},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "clusterctl-config", Namespace: "tenant-b"},
+			Data: map[string][]byte{
+				"config.yaml": []byte("AWS_REGION: us-east-1\n"),
+			},
+		},
+	).Build()
+
+	newProvider := func(namespace string, spec operatorv1.ProviderSpec) *phaseReconciler {
+		spec.FetchConfig = &operatorv1.FetchConfiguration{URL: "https://example.com"}
+
+		return &phaseReconciler{
+			ctrlClient: fakeclient,
+			provider: &genericprovider.InfrastructureProviderWrapper{
+				InfrastructureProvider: &operatorv1.InfrastructureProvider{
+					ObjectMeta: metav1.ObjectMeta{Name: "aws", Namespace: namespace},
+					Spec:       operatorv1.InfrastructureProviderSpec{ProviderSpec: spec},
+				},
+			},
+		}
+	}
+
+	// Variables of the configuration secret take precedence over the ones of the clusterctl configuration.
+	readerA, err := newProvider("tenant-a", operatorv1.ProviderSpec{
+		ConfigSecretRef: &operatorv1.ClusterctlConfigReference{Name: "clusterctl-config"},
+		ConfigSecret:    &operatorv1.SecretReference{Name: "variables", Namespace: "tenant-a"},
+	}).secretReader(ctx)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	for key, value := range map[string]string{
+		"AWS_REGION":                 "eu-west-1",
+		"AWS_B64ENCODED_CREDENTIALS": "from-secret",
+		"EXP_MACHINE_POOL":           "true",
+	} {
+		v, err := readerA.Get(key)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(v).To(Equal(value))
+	}
+
+	// Another provider only sees its own variables.
+	readerB, err := newProvider("tenant-b", operatorv1.ProviderSpec{
+		ConfigSecretRef: &operatorv1.ClusterctlConfigReference{Name: "clusterctl-config", Key: "config.yaml"},
+	}).secretReader(ctx)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	region, err := readerB.Get("AWS_REGION")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(region).To(Equal("us-east-1"))
+
+	_, err = readerB.Get("AWS_B64ENCODED_CREDENTIALS")
+	g.Expect(err).To(HaveOccurred())
+
+	// A missing key is reported.
+	_, err = newProvider("tenant-b", operatorv1.ProviderSpec{
+		ConfigSecretRef: &operatorv1.ClusterctlConfigReference{Name: "clusterctl-config"},
+	}).secretReader(ctx)
+	g.Expect(err).To(MatchError(ContainSubstring(`key "clusterctl.yaml" not found`)))
+}
+
+func TestParseClusterctlConfig(t *testing.T) {
+	g := NewWithT(t)
+
+	variables, err := parseClusterctlConfig([]byte(`
+providers:
+  - name: my-provider
+    url: https://example.com
+    type: InfrastructureProvider
+images:
+  all:
+    repository: registry.example.com
+CLUSTER_TOPOLOGY: true
+WORKER_MACHINE_COUNT: 3
+KUBERNETES_VERSION: v1.27.3
+UNSET:
+NETWORK:
+  cidr: 10.0.0.0/16
+`))
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(variables).To(Equal(map[string]string{
+		"CLUSTER_TOPOLOGY":     "true",
+		"WORKER_MACHINE_COUNT": "3",
+		"KUBERNETES_VERSION":   "v1.27.3",
+		"NETWORK":              "cidr: 10.0.0.0/16",
+	}))
+
+	_, err = parseClusterctlConfig([]byte("- not a map"))
+	g.Expect(err).To(HaveOccurred())
+}
+
 func TestConfigmapRepository(t *testing.T) {
 	provider := &genericprovider.InfrastructureProviderWrapper{
 		InfrastructureProvider: &operatorv1.InfrastructureProvider{
@@ -150,20 +263,31 @@ metadata:
   name: capi-webhook-system
 ---`
 
-	additionalManifests := `
-apiVersion: v1
-kind: Namespace
-metadata:
-  name: some-other-namespace
----
-`
+	newConfigMap := func(namespace, name, version, components string) corev1.ConfigMap {
+		return corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: namespace,
+				Labels: map[string]string{
+					"provider-components":                "aws",
+					operatorv1.ConfigMapVersionLabelName: version,
+				},
+			},
+			Data: map[string]string{
+				"metadata":   metadata,
+				"components": components,
+			},
+		}
+	}
+
 	tests := []struct {
-		name                string
-		configMaps          []corev1.ConfigMap
-		additionalManifests string
-		want                repository.Repository
-		wantErr             string
-		wantDefaultVersion  string
+		name               string
+		configMaps         []corev1.ConfigMap
+		want               repository.Repository
+		wantErr            string
+		wantDefaultVersion string
+		wantConfigMap      string
+		wantVersions       int
 	}{
 		{
 			name:    "missing configmaps",
@@ -294,6 +418,7 @@ metadata:
 				},
 			},
 			wantDefaultVersion: "v1.2.3",
+			wantConfigMap:      "ns1/test-provider",
 		},
 		{
 			name: "three correct configmaps",
@@ -347,26 +472,42 @@ metadata:
 			wantDefaultVersion: "v1.2.3",
 		},
 		{
-			name: "with additional manifests",
+			name: "multiple versions with version labels",
 			configMaps: []corev1.ConfigMap{
-				{
-					TypeMeta: metav1.TypeMeta{
-						Kind:       "ConfigMap",
-						APIVersion: "v1",
-					},
-					ObjectMeta: metav1.ObjectMeta{
-						Name:      "v1.2.3",
-						Namespace: "ns1",
-						Labels:    map[string]string{"provider-components": "aws"},
-					},
-					Data: map[string]string{
-						"metadata":   metadata,
-						"components": components,
-					},
-				},
+				newConfigMap("ns1", "aws-a", "v1.2.3", components),
+				newConfigMap("ns1", "aws-b", "v1.2.4", "other components"),
+				newConfigMap("ns1", "aws-c", "v1.3.0", "other components"),
+			},
+			wantDefaultVersion: "v1.2.3",
+			wantConfigMap:      "ns1/aws-a",
+		},
+		{
+			name: "same version in the provider namespace and in another one",
+			configMaps: []corev1.ConfigMap{
+				newConfigMap("ns0", "aws-a", "v1.2.3", "other components"),
+				newConfigMap("ns1", "aws-b", "v1.2.3", components),
+				newConfigMap("ns2", "aws-c", "v1.2.3", "other components"),
+			},
+			wantDefaultVersion: "v1.2.3",
+			wantConfigMap:      "ns1/aws-b",
+			wantVersions:       1,
+		},
+		{
+			name: "same version twice in the provider namespace",
+			configMaps: []corev1.ConfigMap{
+				newConfigMap("ns1", "aws-a", "v1.2.3", components),
+				newConfigMap("ns1", "aws-b", "v1.2.3", components),
+				newConfigMap("ns1", "aws-c", "v1.2.4", components),
+			},
+			wantErr: "more than one ConfigMap found with selector &LabelSelector{MatchLabels:map[string]string{provider-components: aws,},MatchExpressions:[]LabelSelectorRequirement{},} for version v1.2.3: ns1/aws-a, ns1/aws-b",
+		},
+		{
+			name: "same version twice in other namespaces",
+			configMaps: []corev1.ConfigMap{
+				newConfigMap("ns0", "aws-a", "v1.2.3", components),
+				newConfigMap("ns2", "aws-b", "v1.2.3", components),
 			},
-			additionalManifests: additionalManifests,
-			wantDefaultVersion:  "v1.2.3",
+			wantErr: "more than one ConfigMap found with selector &LabelSelector{MatchLabels:map[string]string{provider-components: aws,},MatchExpressions:[]LabelSelectorRequirement{},} for version v1.2.3: ns0/aws-a, ns2/aws-b",
 		},
 	}
 
@@ -384,7 +525,7 @@ metadata:
 				g.Expect(fakeclient.Create(ctx, &tt.configMaps[i])).To(Succeed())
 			}
 
-			got, err := p.configmapRepository(context.TODO(), p.provider.GetSpec().FetchConfig.Selector, tt.additionalManifests)
+			got, err := p.configmapRepository(context.TODO(), p.provider.GetSpec().FetchConfig.Selector)
 			if len(tt.wantErr) > 0 {
 				g.Expect(err).Should(MatchError(tt.wantErr))
 				return
@@ -393,17 +534,24 @@ metadata:
 			gotComponents, err := got.GetFile(got.DefaultVersion(), got.ComponentsPath())
 			g.Expect(err).To(Succeed())
 
-			if tt.additionalManifests != "" {
-				g.Expect(string(gotComponents)).To(Equal(components + "\n---\n" + additionalManifests))
-			} else {
-				g.Expect(string(gotComponents)).To(Equal(components))
-			}
+			g.Expect(string(gotComponents)).To(Equal(components))
 
 			gotMetadata, err := got.GetFile(got.DefaultVersion(), "metadata.yaml")
 			g.Expect(err).To(Succeed())
 			g.Expect(string(gotMetadata)).To(Equal(metadata))
 
 			g.Expect(got.DefaultVersion()).To(Equal(tt.wantDefaultVersion))
+
+			wantVersions := tt.wantVersions
+			if wantVersions == 0 {
+				wantVersions = len(tt.configMaps)
+			}
+
+			g.Expect(p.manifestsConfigMaps).To(HaveLen(wantVersions))
+
+			if tt.wantConfigMap != "" {
+				g.Expect(p.manifestsConfigMaps[tt.wantDefaultVersion].String()).To(Equal(tt.wantConfigMap))
+			}
 		})
 	}
 }
@@ -472,7 +620,7 @@ func TestRepositoryFactory(t *testing.T) {
 			providerConfig, err := configClient.Providers().Get(providerName, providerType)
 			g.Expect(err).ToNot(HaveOccurred())
 
-			repo, err := repositoryFactory(providerConfig, configClient.Variables())
+			repo, err := repositoryFactory(providerConfig, configClient.Variables(), nil)
 			if tc.expectedError {
 				g.Expect(err).To(HaveOccurred())
 
@@ -536,3 +684,566 @@ func TestGetLatestVersion(t *testing.T) {
 		})
 	}
 }
+
+func TestComponentReferences(t *testing.T) {
+	g := NewWithT(t)
+
+	newObj := func(apiVersion, kind, namespace, name string) unstructured.Unstructured {
+		obj := unstructured.Unstructured{}
+		obj.SetAPIVersion(apiVersion)
+		obj.SetKind(kind)
+		obj.SetNamespace(namespace)
+		obj.SetName(name)
+
+		return obj
+	}
+
+	objs := []unstructured.Unstructured{
+		newObj("apps/v1", "Deployment", "capi-system", "capi-controller-manager"),
+		newObj("v1", "ServiceAccount", "capi-system", "capi-manager"),
+		newObj("apiextensions.k8s.io/v1", "CustomResourceDefinition", "", "machines.cluster.x-k8s.io"),
+		newObj("apiextensions.k8s.io/v1", "CustomResourceDefinition", "", "clusters.cluster.x-k8s.io"),
+		newObj("v1", "Namespace", "", "capi-system"),
+	}
+
+	g.Expect(componentReferences(objs)).To(Equal([]operatorv1.ComponentReference{
+		{Version: "v1", Kind: "Namespace", Name: "capi-system"},
+		{Version: "v1", Kind: "ServiceAccount", Namespace: "capi-system", Name: "capi-manager"},
+		{Group: "apiextensions.k8s.io", Version: "v1", Kind: "CustomResourceDefinition", Name: "clusters.cluster.x-k8s.io"},
+		{Group: "apiextensions.k8s.io", Version: "v1", Kind: "CustomResourceDefinition", Name: "machines.cluster.x-k8s.io"},
+		{Group: "apps", Version: "v1", Kind: "Deployment", Namespace: "capi-system", Name: "capi-controller-manager"},
+	}))
+}
+
+func TestComponentsHash(t *testing.T) {
+	g := NewWithT(t)
+
+	components := `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: capa-controller-manager
+  namespace: capa-system
+spec:
+  template:
+    spec:
+      containers:
+      - name: manager
+        image: registry.k8s.io/cluster-api-aws/cluster-api-aws-controller:%s
+`
+
+	configClient, err := configclient.New("", configclient.InjectReader(configclient.NewMemoryReader()))
+	g.Expect(err).ToNot(HaveOccurred())
+
+	scheme := setupScheme()
+	utilruntime.Must(appsv1.AddToScheme(scheme))
+
+	mr := repository.NewMemoryRepository().WithPaths("", "components.yaml")
+	mr.WithFile("v2.1.4", "components.yaml", []byte(fmt.Sprintf(components, "v2.1.4")))
+	mr.WithFile("v2.2.0", "components.yaml", []byte(fmt.Sprintf(components, "v2.2.0")))
+
+	p := &phaseReconciler{
+		provider: &genericprovider.InfrastructureProviderWrapper{
+			InfrastructureProvider: &operatorv1.InfrastructureProvider{
+				ObjectMeta: metav1.ObjectMeta{Name: "aws", Namespace: "capa-system"},
+			},
+		},
+		ctrlClient:     fake.NewClientBuilder().WithScheme(scheme).Build(),
+		providerConfig: configclient.NewProvider("aws", "https://example.com/components.yaml", clusterctlv1.InfrastructureProviderType),
+		configClient:   configClient,
+		options:        repository.ComponentsOptions{TargetNamespace: "capa-system"},
+	}
+
+	hash := func(version string) string {
+		var err error
+
+		p.components, err = p.newComponents(context.Background(), mr, version)
+		g.Expect(err).ToNot(HaveOccurred())
+
+		hash, err := componentsHash(p.componentsToInstall())
+		g.Expect(err).ToNot(HaveOccurred())
+
+		return hash
+	}
+
+	installed := hash("v2.1.4")
+	g.Expect(installed).To(HaveLen(64))
+
+	// Rendering the same version again gives the same hash, while upgrading changes it.
+	g.Expect(hash("v2.1.4")).To(Equal(installed))
+	g.Expect(hash("v2.2.0")).ToNot(Equal(installed))
+}
+
+func TestWithoutInstalledCRDs(t *testing.T) {
+	g := NewWithT(t)
+
+	scheme := runtime.NewScheme()
+	utilruntime.Must(apiextensionsv1.AddToScheme(scheme))
+
+	installedCRD := &apiextensionsv1.CustomResourceDefinition{
+		ObjectMeta: metav1.ObjectMeta{Name: "awsclusters.infrastructure.cluster.x-k8s.io"},
+	}
+
+	newObj := func(apiVersion, kind, name string) unstructured.Unstructured {
+		obj := unstructured.Unstructured{}
+		obj.SetAPIVersion(apiVersion)
+		obj.SetKind(kind)
+		obj.SetName(name)
+
+		return obj
+	}
+
+	objs := []unstructured.Unstructured{
+		newObj("apiextensions.k8s.io/v1", "CustomResourceDefinition", "awsclusters.infrastructure.cluster.x-k8s.io"),
+		newObj("apiextensions.k8s.io/v1", "CustomResourceDefinition", "awsmanagedclusters.infrastructure.cluster.x-k8s.io"),
+		newObj("apps/v1", "Deployment", "capa-controller-manager"),
+	}
+
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(installedCRD).Build()
+
+	filtered, skipped, err := withoutInstalledCRDs(context.Background(), c, objs)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(skipped).To(ConsistOf("awsclusters.infrastructure.cluster.x-k8s.io"))
+	g.Expect(filtered).To(HaveLen(2))
+	g.Expect(filtered[0].GetName()).To(Equal("awsmanagedclusters.infrastructure.cluster.x-k8s.io"))
+	g.Expect(filtered[1].GetName()).To(Equal("capa-controller-manager"))
+}
+
+func TestSkipCRDs(t *testing.T) {
+	scheme := runtime.NewScheme()
+	utilruntime.Must(apiextensionsv1.AddToScheme(scheme))
+
+	crdGVK := apiextensionsv1.SchemeGroupVersion.WithKind("CustomResourceDefinition")
+	objs := []unstructured.Unstructured{
+		newUnstructured(crdGVK, "", "awsclusters.infrastructure.cluster.x-k8s.io"),
+		newUnstructured(crdGVK, "", "awsmachines.infrastructure.cluster.x-k8s.io"),
+		newUnstructured(appsv1.SchemeGroupVersion.WithKind("Deployment"), "capa-system", "capa-controller-manager"),
+	}
+
+	testCases := []struct {
+		name          string
+		skipCRDs      bool
+		installedCRDs []string
+		expectedObjs  []string
+		expectedError string
+	}{
+		{
+			name:         "CRDs are installed by default",
+			expectedObjs: []string{"awsclusters.infrastructure.cluster.x-k8s.io", "awsmachines.infrastructure.cluster.x-k8s.io", "capa-controller-manager"},
+		},
+		{
+			name:          "skipped CRDs exist",
+			skipCRDs:      true,
+			installedCRDs: []string{"awsclusters.infrastructure.cluster.x-k8s.io", "awsmachines.infrastructure.cluster.x-k8s.io"},
+			expectedObjs:  []string{"capa-controller-manager"},
+		},
+		{
+			name:          "skipped CRDs are missing",
+			skipCRDs:      true,
+			installedCRDs: []string{"awsclusters.infrastructure.cluster.x-k8s.io"},
+			expectedObjs:  []string{"capa-controller-manager"},
+			expectedError: `CustomResourceDefinitions of provider "aws" installed without CRDs don't exist: awsmachines.infrastructure.cluster.x-k8s.io`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			clientBuilder := fake.NewClientBuilder().WithScheme(scheme)
+			for _, name := range tc.installedCRDs {
+				clientBuilder = clientBuilder.WithObjects(&apiextensionsv1.CustomResourceDefinition{ObjectMeta: metav1.ObjectMeta{Name: name}})
+			}
+
+			p := &phaseReconciler{
+				ctrlClient: clientBuilder.Build(),
+				components: &fakeComponents{objs: objs},
+				provider: &genericprovider.InfrastructureProviderWrapper{
+					InfrastructureProvider: &operatorv1.InfrastructureProvider{
+						ObjectMeta: metav1.ObjectMeta{Name: "aws", Namespace: "capa-system"},
+						Spec: operatorv1.InfrastructureProviderSpec{
+							ProviderSpec: operatorv1.ProviderSpec{SkipCRDs: tc.skipCRDs},
+						},
+					},
+				},
+			}
+
+			names := []string{}
+			for _, obj := range p.componentsToInstall() {
+				names = append(names, obj.GetName())
+			}
+
+			g.Expect(names).To(Equal(tc.expectedObjs))
+
+			_, err := p.checkSkippedCRDs(context.Background())
+			if tc.expectedError == "" {
+				g.Expect(err).ToNot(HaveOccurred())
+
+				return
+			}
+
+			var pe *PhaseError
+			g.Expect(errors.As(err, &pe)).To(BeTrue())
+			g.Expect(pe.Type).To(Equal(operatorv1.PreflightCheckCondition))
+			g.Expect(pe.Reason).To(Equal(operatorv1.MissingCRDsReason))
+			g.Expect(err.Error()).To(Equal(tc.expectedError))
+		})
+	}
+}
+
+func TestPhaseErrorReasons(t *testing.T) {
+	metadata := `
+apiVersion: clusterctl.cluster.x-k8s.io/v1alpha3
+releaseSeries:
+  - major: 1
+    minor: 0
+    contract: %s
+`
+	components := `
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: capa-controller-manager
+`
+
+	newTestReconciler := func(t *testing.T, files map[string]string) *phaseReconciler {
+		t.Helper()
+
+		g := NewWithT(t)
+
+		configClient, err := configclient.New("", configclient.InjectReader(configclient.NewMemoryReader()))
+		g.Expect(err).ToNot(HaveOccurred())
+
+		mr := repository.NewMemoryRepository().WithPaths("", "components.yaml").WithDefaultVersion("v1.0.0")
+		for name, content := range files {
+			mr.WithFile("v1.0.0", name, []byte(content))
+		}
+
+		return &phaseReconciler{
+			provider: &genericprovider.InfrastructureProviderWrapper{
+				InfrastructureProvider: &operatorv1.InfrastructureProvider{
+					ObjectMeta: metav1.ObjectMeta{Name: "aws", Namespace: "capa-system"},
+				},
+			},
+			providerConfig: configclient.NewProvider("aws", "https://example.com/components.yaml", clusterctlv1.InfrastructureProviderType),
+			configClient:   configClient,
+			repo:           mr,
+			options:        repository.ComponentsOptions{Version: "v1.0.0", TargetNamespace: "capa-system"},
+		}
+	}
+
+	fetchErr := func(files map[string]string) func(t *testing.T) error {
+		return func(t *testing.T) error {
+			_, err := newTestReconciler(t, files).fetch(context.TODO())
+
+			return err
+		}
+	}
+
+	validateErr := func(files map[string]string) func(t *testing.T) error {
+		return func(t *testing.T) error {
+			return wrapPhaseError(newTestReconciler(t, files).validateRepoCAPIVersion(context.TODO()), operatorv1.ContractMismatchReason)
+		}
+	}
+
+	rollbackErr := func(rollbackOnFailure bool) func(t *testing.T) error {
+		return func(t *testing.T) error {
+			p := newTestReconciler(t, nil)
+			p.provider.SetSpec(operatorv1.ProviderSpec{Upgrade: &operatorv1.UpgradeOptions{RollbackOnFailure: rollbackOnFailure}})
+			p.ctrlClient = fake.NewClientBuilder().Build()
+			p.upgrading = true
+			p.previousVersion = "v0.9.0"
+
+			return p.rollbackUpgrade(context.TODO(), wrapPhaseError(errors.New("admission webhook denied the request"), operatorv1.ApplyFailedReason))
+		}
+	}
+
+	testCases := []struct {
+		name           string
+		err            func(t *testing.T) error
+		expectedReason string
+	}{
+		{
+			name: "Reason is kept for unclassified errors",
+			err: func(*testing.T) error {
+				return wrapPhaseError(errors.New("failed"), operatorv1.DownloadFailedReason)
+			},
+			expectedReason: operatorv1.DownloadFailedReason,
+		},
+		{
+			name: "Classified reason takes precedence",
+			err: func(*testing.T) error {
+				err := fmt.Errorf("wrapped: %w", withReason(errors.New("failed"), operatorv1.DecodeFailedReason))
+
+				return wrapPhaseError(err, operatorv1.ContractMismatchReason)
+			},
+			expectedReason: operatorv1.DecodeFailedReason,
+		},
+		{
+			name: "No versions available",
+			err: func(*testing.T) error {
+				_, err := getLatestVersion(nil)
+
+				return err
+			},
+			expectedReason: operatorv1.DownloadFailedReason,
+		},
+		{
+			name:           "Missing metadata",
+			err:            validateErr(nil),
+			expectedReason: operatorv1.DownloadFailedReason,
+		},
+		{
+			name:           "Corrupt metadata",
+			err:            validateErr(map[string]string{"metadata.yaml": "releaseSeries: ["}),
+			expectedReason: operatorv1.DecodeFailedReason,
+		},
+		{
+			name:           "Unsupported contract",
+			err:            validateErr(map[string]string{"metadata.yaml": fmt.Sprintf(metadata, "v1alpha3")}),
+			expectedReason: operatorv1.ContractMismatchReason,
+		},
+		{
+			name:           "Missing components",
+			err:            fetchErr(nil),
+			expectedReason: operatorv1.DownloadFailedReason,
+		},
+		{
+			name:           "Corrupt components",
+			err:            fetchErr(map[string]string{"components.yaml": "kind: ["}),
+			expectedReason: operatorv1.DecodeFailedReason,
+		},
+		{
+			name: "Install failure",
+			err: func(*testing.T) error {
+				err := errors.New("admission webhook denied the request")
+
+				return wrapPhaseError(err, installErrorReason(err))
+			},
+			expectedReason: operatorv1.ApplyFailedReason,
+		},
+		{
+			name: "Install timeout",
+			err: func(*testing.T) error {
+				err := fmt.Errorf("waiting for deployment: %w", context.DeadlineExceeded)
+
+				return wrapPhaseError(err, installErrorReason(err))
+			},
+			expectedReason: operatorv1.ReadinessTimeoutReason,
+		},
+		{
+			name:           "Install failure without rollback",
+			err:            rollbackErr(false),
+			expectedReason: operatorv1.ApplyFailedReason,
+		},
+		{
+			name:           "Rollback to a version missing from the repository",
+			err:            rollbackErr(true),
+			expectedReason: operatorv1.RollbackFailedReason,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			err := tc.err(t)
+			g.Expect(err).To(HaveOccurred())
+
+			var phaseErr *PhaseError
+			g.Expect(errors.As(err, &phaseErr)).To(BeTrue())
+			g.Expect(phaseErr.Type).To(Equal(operatorv1.ProviderInstalledCondition))
+			g.Expect(phaseErr.Reason).To(Equal(tc.expectedReason))
+		})
+	}
+
+	g := NewWithT(t)
+
+	// The fetch succeeds with valid components, so the failing cases above are not false positives.
+	p := newTestReconciler(t, map[string]string{"components.yaml": components, "metadata.yaml": fmt.Sprintf(metadata, "v1beta1")})
+	g.Expect(p.validateRepoCAPIVersion(context.TODO())).To(Succeed())
+
+	_, err := p.fetch(context.TODO())
+	g.Expect(err).ToNot(HaveOccurred())
+
+	// A transitional release series abiding by a contract the operator doesn't support yet picks the supported one.
+	transitional := fmt.Sprintf(metadata, "v1beta2") + "  - major: 1\n    minor: 0\n    contract: v1beta1\n"
+	p = newTestReconciler(t, map[string]string{"metadata.yaml": transitional})
+	g.Expect(p.validateRepoCAPIVersion(context.TODO())).To(Succeed())
+	g.Expect(p.contract).To(Equal("v1beta1"))
+}
+
+func TestProviderDeleteOptions(t *testing.T) {
+	testCases := []struct {
+		name           string
+		deletionPolicy operatorv1.DeletionPolicyType
+		skipCRDs       bool
+		expectedCRDs   bool
+	}{
+		{
+			name: "CRDs are kept by default",
+		},
+		{
+			name:           "CRDs are kept with orphan deletion policy",
+			deletionPolicy: operatorv1.OrphanDeletionPolicy,
+		},
+		{
+			name:           "CRDs are deleted with foreground deletion policy",
+			deletionPolicy: operatorv1.ForegroundDeletionPolicy,
+			expectedCRDs:   true,
+		},
+		{
+			name:           "skipped CRDs are kept with foreground deletion policy",
+			deletionPolicy: operatorv1.ForegroundDeletionPolicy,
+			skipCRDs:       true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			provider := &genericprovider.InfrastructureProviderWrapper{
+				InfrastructureProvider: &operatorv1.InfrastructureProvider{
+					ObjectMeta: metav1.ObjectMeta{Name: "aws", Namespace: "capa-system"},
+					Spec: operatorv1.InfrastructureProviderSpec{
+						ProviderSpec: operatorv1.ProviderSpec{
+							DeletionPolicy: tc.deletionPolicy,
+							SkipCRDs:       tc.skipCRDs,
+						},
+					},
+				},
+			}
+			clusterctlProvider := clusterctlv1.Provider{ProviderName: "aws", Type: string(clusterctlv1.InfrastructureProviderType)}
+
+			options := providerDeleteOptions(provider, clusterctlProvider)
+			g.Expect(options.Provider).To(Equal(clusterctlProvider))
+			g.Expect(options.IncludeNamespace).To(BeFalse())
+			g.Expect(options.IncludeCRDs).To(Equal(tc.expectedCRDs))
+		})
+	}
+}
+
+func TestLoadFromConfigMaps(t *testing.T) {
+	metadata := `
+apiVersion: clusterctl.cluster.x-k8s.io/v1alpha3
+releaseSeries:
+  - major: 1
+    minor: 3
+    contract: v1beta1
+  - major: 1
+    minor: 2
+    contract: v1beta1
+`
+
+	newConfigMap := func(name string, labels map[string]string) *corev1.ConfigMap {
+		labels["provider-components"] = "aws"
+
+		return &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: "capa-system",
+				Labels:    labels,
+			},
+			Data: map[string]string{
+				"metadata":   metadata,
+				"components": "components",
+			},
+		}
+	}
+
+	testCases := []struct {
+		name                string
+		version             string
+		configMaps          []*corev1.ConfigMap
+		expectedVersion     string
+		expectedFetchedFrom string
+		expectedErr         string
+	}{
+		{
+			name: "Version is derived from the version labels",
+			configMaps: []*corev1.ConfigMap{
+				newConfigMap("aws-old", map[string]string{operatorv1.ConfigMapVersionLabelName: "v1.2.3"}),
+				newConfigMap("aws-new", map[string]string{operatorv1.ConfigMapVersionLabelName: "v1.3.0"}),
+			},
+			expectedVersion:     "v1.3.0",
+			expectedFetchedFrom: "ConfigMap capa-system/aws-new",
+		},
+		{
+			name: "Version is derived from the names",
+			configMaps: []*corev1.ConfigMap{
+				newConfigMap("v1.2.3", map[string]string{}),
+				newConfigMap("v1.3.0", map[string]string{}),
+			},
+			expectedVersion:     "v1.3.0",
+			expectedFetchedFrom: "ConfigMap capa-system/v1.3.0",
+		},
+		{
+			name:    "Requested version is picked",
+			version: "v1.2.3",
+			configMaps: []*corev1.ConfigMap{
+				newConfigMap("aws-old", map[string]string{operatorv1.ConfigMapVersionLabelName: "v1.2.3"}),
+				newConfigMap("aws-new", map[string]string{operatorv1.ConfigMapVersionLabelName: "v1.3.0"}),
+			},
+			expectedVersion:     "v1.2.3",
+			expectedFetchedFrom: "ConfigMap capa-system/aws-old",
+		},
+		{
+			name:    "Requested version is not provided",
+			version: "v1.2.4",
+			configMaps: []*corev1.ConfigMap{
+				newConfigMap("aws-old", map[string]string{operatorv1.ConfigMapVersionLabelName: "v1.2.3"}),
+			},
+			expectedErr: "no ConfigMap found with selector &LabelSelector{MatchLabels:map[string]string{provider-components: aws,},MatchExpressions:[]LabelSelectorRequirement{},} for version v1.2.4",
+		},
+		{
+			name: "Version label is invalid",
+			configMaps: []*corev1.ConfigMap{
+				newConfigMap("aws", map[string]string{operatorv1.ConfigMapVersionLabelName: "latest"}),
+			},
+			expectedErr: "ConfigMap capa-system/aws has invalid version:latest (from the Label provider.cluster.x-k8s.io/version)",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			objs := []client.Object{}
+			for _, cm := range tc.configMaps {
+				objs = append(objs, cm)
+			}
+
+			p := &phaseReconciler{
+				ctrlClient: fake.NewClientBuilder().WithScheme(setupScheme()).WithObjects(objs...).Build(),
+				provider: &genericprovider.InfrastructureProviderWrapper{
+					InfrastructureProvider: &operatorv1.InfrastructureProvider{
+						ObjectMeta: metav1.ObjectMeta{Name: "aws", Namespace: "capa-system"},
+						Spec: operatorv1.InfrastructureProviderSpec{
+							ProviderSpec: operatorv1.ProviderSpec{
+								Version: tc.version,
+								FetchConfig: &operatorv1.FetchConfiguration{
+									Selector: &metav1.LabelSelector{
+										MatchLabels: map[string]string{"provider-components": "aws"},
+									},
+								},
+							},
+						},
+					},
+				},
+			}
+
+			_, err := p.load(context.TODO())
+			if tc.expectedErr != "" {
+				g.Expect(err).To(MatchError(tc.expectedErr))
+
+				return
+			}
+
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(p.provider.GetSpec().Version).To(Equal(tc.expectedVersion))
+			g.Expect(p.fetchedFrom).To(Equal(tc.expectedFetchedFrom))
+			g.Expect(p.contract).To(Equal("v1beta1"))
+		})
+	}
+}
@@ -0,0 +1,106 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	operatorv1 "sigs.k8s.io/cluster-api-operator/api/v1alpha2"
+)
+
+// waitForPodsDeletion requeues until no pod matching the selector of a provider Deployment remains, including
+// the terminating ones, so the controllers of the previous version can't keep serving, e.g. conversion webhooks
+// with an outdated schema, while the provider components are installed again. The Deployment status is not
+// relied on, as it may lag behind the actual pods.
+func (p *phaseReconciler) waitForPodsDeletion(ctx context.Context) (reconcile.Result, error) {
+	log := ctrl.LoggerFrom(ctx)
+
+	pods, err := remainingPods(ctx, p.ctrlClient, p.componentsToInstall())
+	if err != nil {
+		return reconcile.Result{}, wrapPhaseError(err, operatorv1.OldComponentsDeletionErrorReason)
+	}
+
+	if len(pods) == 0 {
+		return reconcile.Result{}, nil
+	}
+
+	log.Info("Waiting for the pods of the previous version to be deleted", "pods", pods)
+	conditions.Set(p.provider, conditions.FalseCondition(operatorv1.ProviderInstalledCondition, operatorv1.WaitingForPodsDeletionReason,
+		clusterv1.ConditionSeverityInfo, "Waiting for the pods of the previous version to be deleted: %s", strings.Join(pods, ", ")))
+
+	return reconcile.Result{RequeueAfter: podsDeletionRequeueAfter}, nil
+}
+
+// remainingPods returns the namespaced names of the pods matching the selector of one of the Deployments
+// in the objects, sorted, with the terminating ones marked as such.
+func remainingPods(ctx context.Context, c client.Client, objs []unstructured.Unstructured) ([]string, error) {
+	pods := []string{}
+
+	for _, obj := range objs {
+		if obj.GroupVersionKind().GroupKind() != appsv1.SchemeGroupVersion.WithKind("Deployment").GroupKind() {
+			continue
+		}
+
+		deployment := &appsv1.Deployment{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, deployment); err != nil {
+			return nil, fmt.Errorf("failed to convert %s: %w", describeObject(obj), err)
+		}
+
+		if deployment.Spec.Selector == nil {
+			continue
+		}
+
+		selector, err := metav1.LabelSelectorAsSelector(deployment.Spec.Selector)
+		if err != nil {
+			return nil, fmt.Errorf("invalid selector in %s: %w", describeObject(obj), err)
+		}
+
+		podList := &corev1.PodList{}
+		if err := c.List(ctx, podList, client.InNamespace(deployment.Namespace), client.MatchingLabelsSelector{Selector: selector}); err != nil {
+			return nil, fmt.Errorf("failed to list the pods of %s: %w", describeObject(obj), err)
+		}
+
+		for i := range podList.Items {
+			pod := &podList.Items[i]
+
+			name := client.ObjectKeyFromObject(pod).String()
+			if !pod.DeletionTimestamp.IsZero() {
+				name += " (terminating)"
+			}
+
+			pods = append(pods, name)
+		}
+	}
+
+	sort.Strings(pods)
+
+	return pods, nil
+}
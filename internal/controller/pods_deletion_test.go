@@ -0,0 +1,129 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/utils/pointer"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	operatorv1 "sigs.k8s.io/cluster-api-operator/api/v1alpha2"
+	"sigs.k8s.io/cluster-api-operator/internal/controller/genericprovider"
+)
+
+func TestWaitForPodsDeletion(t *testing.T) {
+	deployment := newUnstructured(appsv1.SchemeGroupVersion.WithKind("Deployment"), "capa-system", "capa-controller-manager")
+	NewWithT(t).Expect(unstructured.SetNestedStringMap(deployment.Object, map[string]string{"control-plane": "capa-controller-manager"},
+		"spec", "selector", "matchLabels")).To(Succeed())
+
+	objs := []unstructured.Unstructured{
+		deployment,
+		newUnstructured(corev1.SchemeGroupVersion.WithKind("ServiceAccount"), "capa-system", "capa-manager"),
+	}
+
+	newPod := func(namespace, name string, labels map[string]string) *corev1.Pod {
+		return &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace, Labels: labels}}
+	}
+
+	terminatingPod := newPod("capa-system", "capa-controller-manager-6d4b9", map[string]string{"control-plane": "capa-controller-manager"})
+	terminatingPod.DeletionTimestamp = &metav1.Time{Time: metav1.Now().Time}
+	terminatingPod.Finalizers = []string{"example.com/stuck"}
+
+	// The API server sets the deletion timestamp to the end of the grace period, an hour later here.
+	drainingPod := newPod("capa-system", "capa-controller-manager-8c5f2", map[string]string{"control-plane": "capa-controller-manager"})
+	drainingPod.Spec.TerminationGracePeriodSeconds = pointer.Int64(3600)
+	drainingPod.DeletionTimestamp = &metav1.Time{Time: metav1.Now().Add(time.Hour)}
+	drainingPod.DeletionGracePeriodSeconds = pointer.Int64(3600)
+	drainingPod.Finalizers = []string{"example.com/draining"}
+
+	testCases := []struct {
+		name            string
+		pods            []client.Object
+		expectedMessage string
+	}{
+		{
+			name: "no pods remain",
+		},
+		{
+			name: "pods not matching the deployment selector are ignored",
+			pods: []client.Object{
+				newPod("capa-system", "other", map[string]string{"control-plane": "other"}),
+				newPod("capz-system", "capz-controller-manager-5f7c8", map[string]string{"control-plane": "capa-controller-manager"}),
+			},
+		},
+		{
+			name: "running pod",
+			pods: []client.Object{
+				newPod("capa-system", "capa-controller-manager-7f9d8", map[string]string{"control-plane": "capa-controller-manager"}),
+			},
+			expectedMessage: "Waiting for the pods of the previous version to be deleted: capa-system/capa-controller-manager-7f9d8",
+		},
+		{
+			name:            "stuck terminating pod",
+			pods:            []client.Object{terminatingPod},
+			expectedMessage: "Waiting for the pods of the previous version to be deleted: capa-system/capa-controller-manager-6d4b9 (terminating)",
+		},
+		{
+			name:            "pod terminating within a long grace period",
+			pods:            []client.Object{drainingPod},
+			expectedMessage: "Waiting for the pods of the previous version to be deleted: capa-system/capa-controller-manager-8c5f2 (terminating)",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			p := &phaseReconciler{
+				ctrlClient: fake.NewClientBuilder().WithObjects(tc.pods...).Build(),
+				components: &fakeComponents{objs: objs},
+				provider: &genericprovider.InfrastructureProviderWrapper{
+					InfrastructureProvider: &operatorv1.InfrastructureProvider{
+						ObjectMeta: metav1.ObjectMeta{Name: "aws", Namespace: "capa-system"},
+					},
+				},
+			}
+
+			res, err := p.waitForPodsDeletion(context.Background())
+			g.Expect(err).ToNot(HaveOccurred())
+
+			if tc.expectedMessage == "" {
+				g.Expect(res.IsZero()).To(BeTrue())
+				g.Expect(conditions.Has(p.provider, operatorv1.ProviderInstalledCondition)).To(BeFalse())
+
+				return
+			}
+
+			g.Expect(res.RequeueAfter).To(Equal(podsDeletionRequeueAfter))
+			g.Expect(conditions.IsFalse(p.provider, operatorv1.ProviderInstalledCondition)).To(BeTrue())
+			g.Expect(conditions.GetReason(p.provider, operatorv1.ProviderInstalledCondition)).To(Equal(operatorv1.WaitingForPodsDeletionReason))
+			g.Expect(conditions.GetSeverity(p.provider, operatorv1.ProviderInstalledCondition)).To(HaveValue(Equal(clusterv1.ConditionSeverityInfo)))
+			g.Expect(conditions.GetMessage(p.provider, operatorv1.ProviderInstalledCondition)).To(Equal(tc.expectedMessage))
+		})
+	}
+}
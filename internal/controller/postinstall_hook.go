@@ -0,0 +1,248 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/pointer"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	operatorv1 "sigs.k8s.io/cluster-api-operator/api/v1alpha2"
+	"sigs.k8s.io/cluster-api-operator/internal/controller/genericprovider"
+)
+
+const (
+	// postInstallHookAnnotation records the name of the last post-install Job that completed, so that it isn't
+	// run again once deleted after the retention period.
+	postInstallHookAnnotation = "operator.cluster.x-k8s.io/post-install-hook"
+
+	// postInstallHookLabel is set to the provider name on its post-install Jobs.
+	postInstallHookLabel = "operator.cluster.x-k8s.io/post-install-hook"
+
+	// maxJobNameLength keeps the name of the Jobs short enough to be used as the job-name label of their pods.
+	maxJobNameLength = 63
+)
+
+// reconcilePostInstallHook runs the spec.hooks.postInstall Job once the provider is installed and available, and
+// reflects its completion into the PostInstallHookCompleted condition, requeuing while it runs. The Job is named
+// after the installed version and its template, so it runs again when either changes. Failed Jobs are only run
+// again once deleted, e.g. after the retention period.
+func (r *GenericProviderReconciler) reconcilePostInstallHook(ctx context.Context, provider genericprovider.GenericProvider) (ctrl.Result, error) {
+	log := ctrl.LoggerFrom(ctx)
+
+	hooks := provider.GetSpec().Hooks
+	if hooks == nil || hooks.PostInstall == nil {
+		conditions.Delete(provider, operatorv1.PostInstallHookCompletedCondition)
+
+		return ctrl.Result{}, nil
+	}
+
+	hook := hooks.PostInstall
+
+	if err := r.deleteExpiredHookJobs(ctx, provider, hook); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	name, err := postInstallHookJobName(provider, hook)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if provider.GetAnnotations()[postInstallHookAnnotation] == name {
+		conditions.MarkTrue(provider, operatorv1.PostInstallHookCompletedCondition)
+
+		return ctrl.Result{}, nil
+	}
+
+	requeue := ctrl.Result{RequeueAfter: reconcileInterval(provider, r.ReconcileInterval, healthCheckRequeueAfter)}
+
+	job := &batchv1.Job{}
+
+	err = r.Client.Get(ctx, client.ObjectKey{Namespace: provider.GetNamespace(), Name: name}, job)
+	if apierrors.IsNotFound(err) {
+		log.Info("Creating post-install hook job", "job", name)
+
+		if err := r.Client.Create(ctx, newPostInstallHookJob(provider, hook, name)); err != nil {
+			return ctrl.Result{}, fmt.Errorf("failed to create post-install hook job %q: %w", name, err)
+		}
+
+		conditions.Set(provider, conditions.FalseCondition(operatorv1.PostInstallHookCompletedCondition, operatorv1.PostInstallHookRunningReason,
+			clusterv1.ConditionSeverityInfo, "Job %s is running", name))
+
+		return requeue, nil
+	}
+
+	if err != nil {
+		return ctrl.Result{}, fmt.Errorf("failed to get post-install hook job %q: %w", name, err)
+	}
+
+	if cond := jobFinishedCondition(job); cond != nil {
+		if cond.Type == batchv1.JobComplete {
+			log.Info("Post-install hook job completed", "job", name)
+
+			annotations := provider.GetAnnotations()
+			if annotations == nil {
+				annotations = map[string]string{}
+			}
+
+			annotations[postInstallHookAnnotation] = name
+			provider.SetAnnotations(annotations)
+
+			conditions.MarkTrue(provider, operatorv1.PostInstallHookCompletedCondition)
+
+			return ctrl.Result{}, nil
+		}
+
+		reason := operatorv1.PostInstallHookFailedReason
+		if cond.Reason == "DeadlineExceeded" {
+			reason = operatorv1.PostInstallHookTimeoutReason
+		}
+
+		log.Info("Post-install hook job failed", "job", name, "reason", cond.Reason)
+		conditions.Set(provider, conditions.FalseCondition(operatorv1.PostInstallHookCompletedCondition, reason,
+			clusterv1.ConditionSeverityError, "Job %s failed: %s", name, cond.Message))
+
+		return ctrl.Result{}, nil
+	}
+
+	log.Info("Waiting for post-install hook job to complete", "job", name)
+	conditions.Set(provider, conditions.FalseCondition(operatorv1.PostInstallHookCompletedCondition, operatorv1.PostInstallHookRunningReason,
+		clusterv1.ConditionSeverityInfo, "Job %s is running", name))
+
+	return requeue, nil
+}
+
+// postInstallHookJobName returns the name of the post-install Job for the installed version of the provider and
+// the hook template.
+func postInstallHookJobName(provider genericprovider.GenericProvider, hook *operatorv1.JobHook) (string, error) {
+	installedVersion := ""
+	if v := provider.GetStatus().InstalledVersion; v != nil {
+		installedVersion = *v
+	}
+
+	hash, err := calculateHash(struct {
+		Version  string                  `json:"version"`
+		Template batchv1.JobTemplateSpec `json:"template"`
+	}{installedVersion, hook.Template})
+	if err != nil {
+		return "", err
+	}
+
+	suffix := "-post-install-" + hash[:8]
+
+	prefix := provider.GetName()
+	if len(prefix)+len(suffix) > maxJobNameLength {
+		prefix = prefix[:maxJobNameLength-len(suffix)]
+	}
+
+	return prefix + suffix, nil
+}
+
+// newPostInstallHookJob returns the post-install Job of the provider, owned by it. The hook timeout is the Job
+// active deadline, unless the template sets one.
+func newPostInstallHookJob(provider genericprovider.GenericProvider, hook *operatorv1.JobHook, name string) *batchv1.Job {
+	job := &batchv1.Job{
+		ObjectMeta: *hook.Template.ObjectMeta.DeepCopy(),
+		Spec:       *hook.Template.Spec.DeepCopy(),
+	}
+
+	job.Name = name
+	job.Namespace = provider.GetNamespace()
+
+	if job.Labels == nil {
+		job.Labels = map[string]string{}
+	}
+
+	job.Labels[postInstallHookLabel] = provider.GetName()
+
+	job.SetOwnerReferences(util.EnsureOwnerRef(job.GetOwnerReferences(),
+		metav1.OwnerReference{
+			APIVersion: operatorv1.GroupVersion.String(),
+			Kind:       providerKind(provider),
+			Name:       provider.GetName(),
+			UID:        provider.GetUID(),
+		}))
+
+	if job.Spec.ActiveDeadlineSeconds == nil {
+		timeout := postInstallHookDefaultTimeout
+		if hook.Timeout != nil {
+			timeout = hook.Timeout.Duration
+		}
+
+		job.Spec.ActiveDeadlineSeconds = pointer.Int64(int64(timeout.Seconds()))
+	}
+
+	return job
+}
+
+// deleteExpiredHookJobs deletes the post-install Jobs of the provider, along with their pods, which finished
+// longer than the retention period ago.
+func (r *GenericProviderReconciler) deleteExpiredHookJobs(ctx context.Context, provider genericprovider.GenericProvider, hook *operatorv1.JobHook) error {
+	retention := postInstallHookDefaultRetention
+	if hook.RetentionPeriod != nil {
+		retention = hook.RetentionPeriod.Duration
+	}
+
+	jobs := &batchv1.JobList{}
+	if err := r.Client.List(ctx, jobs,
+		client.InNamespace(provider.GetNamespace()),
+		client.MatchingLabels{postInstallHookLabel: provider.GetName()},
+	); err != nil {
+		return fmt.Errorf("failed to list post-install hook jobs: %w", err)
+	}
+
+	for i := range jobs.Items {
+		job := &jobs.Items[i]
+
+		cond := jobFinishedCondition(job)
+		if cond == nil || time.Since(cond.LastTransitionTime.Time) < retention {
+			continue
+		}
+
+		ctrl.LoggerFrom(ctx).Info("Deleting expired post-install hook job", "job", job.Name)
+
+		if err := r.Client.Delete(ctx, job, client.PropagationPolicy(metav1.DeletePropagationBackground)); client.IgnoreNotFound(err) != nil {
+			return fmt.Errorf("failed to delete post-install hook job %q: %w", job.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// jobFinishedCondition returns the Complete or Failed condition of the Job, or nil if it's still running.
+func jobFinishedCondition(job *batchv1.Job) *batchv1.JobCondition {
+	for i := range job.Status.Conditions {
+		cond := &job.Status.Conditions[i]
+
+		if (cond.Type == batchv1.JobComplete || cond.Type == batchv1.JobFailed) && cond.Status == corev1.ConditionTrue {
+			return cond
+		}
+	}
+
+	return nil
+}
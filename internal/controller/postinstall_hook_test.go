@@ -0,0 +1,141 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/utils/pointer"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	operatorv1 "sigs.k8s.io/cluster-api-operator/api/v1alpha2"
+	"sigs.k8s.io/cluster-api-operator/internal/controller/genericprovider"
+)
+
+func TestReconcilePostInstallHook(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	hook := &operatorv1.JobHook{
+		Template: batchv1.JobTemplateSpec{
+			Spec: batchv1.JobSpec{
+				Template: corev1.PodTemplateSpec{
+					Spec: corev1.PodSpec{
+						RestartPolicy: corev1.RestartPolicyNever,
+						Containers:    []corev1.Container{{Name: "migrate", Image: "registry.example.com/migrate:v1"}},
+					},
+				},
+			},
+		},
+		Timeout: &metav1.Duration{Duration: 5 * time.Minute},
+	}
+
+	provider := &genericprovider.InfrastructureProviderWrapper{
+		InfrastructureProvider: &operatorv1.InfrastructureProvider{
+			ObjectMeta: metav1.ObjectMeta{Name: "aws", Namespace: "capa-system"},
+			Spec: operatorv1.InfrastructureProviderSpec{
+				ProviderSpec: operatorv1.ProviderSpec{Hooks: &operatorv1.ProviderHooks{PostInstall: hook}},
+			},
+			Status: operatorv1.InfrastructureProviderStatus{
+				ProviderStatus: operatorv1.ProviderStatus{InstalledVersion: pointer.String("v2.2.0")},
+			},
+		},
+	}
+
+	scheme := setupScheme()
+	utilruntime.Must(batchv1.AddToScheme(scheme))
+
+	c := fake.NewClientBuilder().WithScheme(scheme).WithStatusSubresource(&batchv1.Job{}).Build()
+	r := &GenericProviderReconciler{Client: c}
+
+	name, err := postInstallHookJobName(provider, hook)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(name).To(HavePrefix("aws-post-install-"))
+
+	// The first reconciliation creates the Job.
+	res, err := r.reconcilePostInstallHook(ctx, provider)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(res.RequeueAfter).To(Equal(healthCheckRequeueAfter))
+	g.Expect(conditions.GetReason(provider, operatorv1.PostInstallHookCompletedCondition)).To(Equal(operatorv1.PostInstallHookRunningReason))
+
+	job := &batchv1.Job{}
+	g.Expect(c.Get(ctx, client.ObjectKey{Namespace: "capa-system", Name: name}, job)).To(Succeed())
+	g.Expect(job.Labels).To(HaveKeyWithValue(postInstallHookLabel, "aws"))
+	g.Expect(job.OwnerReferences).To(HaveLen(1))
+	g.Expect(job.OwnerReferences[0].Kind).To(Equal("InfrastructureProvider"))
+	g.Expect(job.Spec.ActiveDeadlineSeconds).To(HaveValue(Equal(int64(300))))
+
+	// A Job exceeding its deadline reports the timeout.
+	job.Status.Conditions = []batchv1.JobCondition{{
+		Type: batchv1.JobFailed, Status: corev1.ConditionTrue, Reason: "DeadlineExceeded",
+		Message: "Job was active longer than specified deadline", LastTransitionTime: metav1.Now(),
+	}}
+	g.Expect(c.Status().Update(ctx, job)).To(Succeed())
+
+	res, err = r.reconcilePostInstallHook(ctx, provider)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(res.IsZero()).To(BeTrue())
+	g.Expect(conditions.GetReason(provider, operatorv1.PostInstallHookCompletedCondition)).To(Equal(operatorv1.PostInstallHookTimeoutReason))
+	g.Expect(conditions.GetSeverity(provider, operatorv1.PostInstallHookCompletedCondition)).To(HaveValue(Equal(clusterv1.ConditionSeverityError)))
+
+	// A completed Job marks the condition true and is recorded in the provider annotations.
+	job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue, LastTransitionTime: metav1.Now()}}
+	g.Expect(c.Status().Update(ctx, job)).To(Succeed())
+
+	res, err = r.reconcilePostInstallHook(ctx, provider)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(res.IsZero()).To(BeTrue())
+	g.Expect(conditions.IsTrue(provider, operatorv1.PostInstallHookCompletedCondition)).To(BeTrue())
+	g.Expect(provider.GetAnnotations()).To(HaveKeyWithValue(postInstallHookAnnotation, name))
+
+	// The Job is deleted after the retention period, and not run again.
+	job.Status.Conditions[0].LastTransitionTime = metav1.NewTime(time.Now().Add(-25 * time.Hour))
+	g.Expect(c.Status().Update(ctx, job)).To(Succeed())
+
+	res, err = r.reconcilePostInstallHook(ctx, provider)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(res.IsZero()).To(BeTrue())
+	g.Expect(apierrors.IsNotFound(c.Get(ctx, client.ObjectKeyFromObject(job), &batchv1.Job{}))).To(BeTrue())
+	g.Expect(conditions.IsTrue(provider, operatorv1.PostInstallHookCompletedCondition)).To(BeTrue())
+
+	// Upgrading the provider runs a new Job.
+	provider.Status.InstalledVersion = pointer.String("v2.3.0")
+
+	res, err = r.reconcilePostInstallHook(ctx, provider)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(res.RequeueAfter).To(Equal(healthCheckRequeueAfter))
+	g.Expect(conditions.GetReason(provider, operatorv1.PostInstallHookCompletedCondition)).To(Equal(operatorv1.PostInstallHookRunningReason))
+
+	// Removing the hook removes the condition.
+	provider.Spec.Hooks = nil
+
+	res, err = r.reconcilePostInstallHook(ctx, provider)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(res.IsZero()).To(BeTrue())
+	g.Expect(conditions.Has(provider, operatorv1.PostInstallHookCompletedCondition)).To(BeFalse())
+}
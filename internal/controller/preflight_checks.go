@@ -19,7 +19,10 @@ package controller
 import (
 	"context"
 	"fmt"
+	"strings"
+	"time"
 
+	"github.com/Masterminds/semver/v3"
 	"github.com/google/go-github/v52/github"
 	"golang.org/x/oauth2"
 	corev1 "k8s.io/api/core/v1"
@@ -29,7 +32,6 @@ import (
 	"sigs.k8s.io/cluster-api-operator/internal/controller/genericprovider"
 	"sigs.k8s.io/cluster-api-operator/util"
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
-	clusterctlv1 "sigs.k8s.io/cluster-api/cmd/clusterctl/api/v1alpha3"
 	configclient "sigs.k8s.io/cluster-api/cmd/clusterctl/client/config"
 	"sigs.k8s.io/cluster-api/util/conditions"
 	ctrl "sigs.k8s.io/controller-runtime"
@@ -45,12 +47,26 @@ var (
 	moreThanOneProviderInstanceExistsMessage     = "There is already a %s with name %s in the cluster. Only one is allowed."
 	capiVersionIncompatibilityMessage            = "CAPI operator is only compatible with %s providers, detected %s for provider %s."
 	invalidGithubTokenMessage                    = "Invalid github token, please check your github token value and its permissions" //nolint:gosec
+	waitingForCoreProviderMessage                = "Waiting for a CoreProvider to be created."
 	waitingForCoreProviderReadyMessage           = "Waiting for the core provider to be installed."
+	moreThanOneCoreProviderFoundMessage          = "Found %d CoreProviders in the cluster. Only one is allowed."
 	incorrectCoreProviderNameMessage             = "Incorrect CoreProvider name: %s. It should be %s"
+	reconcileIntervalTooShortMessage             = "Reconcile interval %s is shorter than the minimum %s"
+	invalidReplicasMessage                       = "Deployment replicas must be at least 1, got %d"
+	tarballVersionRequiredMessage                = "Version must be set, and Channel and VersionConstraint can't be used, when fetching from a tarball URL"
+	gitVersionRequiredMessage                    = "Version must be set, and Channel and VersionConstraint can't be used, when fetching from Git"
+	waitingForDependenciesMessage                = "Waiting for the dependencies to be ready: %s"
+	dependencyCycleMessage                       = "Dependency cycle: %s"
+	helmVersionRequiredMessage                   = "Version must be set, and Channel and VersionConstraint can't be used, when rendering a Helm chart"
+	overridesVersionRequiredMessage              = "Version must be set, and Channel and VersionConstraint can't be used, when overriding the provider manifests"
 )
 
-// preflightChecks performs preflight checks before installing provider.
-func preflightChecks(ctx context.Context, c client.Client, provider genericprovider.GenericProvider, providerList genericprovider.GenericProviderList) (ctrl.Result, error) {
+// preflightChecks performs preflight checks before installing provider. If a check needs waiting,
+// the provider is requeued after the given interval. skipSingleInstanceCheck allows providers of the same
+// type and name in several namespaces, though there's still a single core provider.
+func preflightChecks(ctx context.Context, c client.Client, provider genericprovider.GenericProvider, providerList genericprovider.GenericProviderList,
+	requeueAfter time.Duration, skipSingleInstanceCheck bool,
+) (ctrl.Result, error) {
 	log := ctrl.LoggerFrom(ctx)
 
 	log.Info("Performing preflight checks")
@@ -72,6 +88,33 @@ func preflightChecks(ctx context.Context, c client.Client, provider genericprovi
 		}
 	}
 
+	// Check that provider version constraint contains a valid value if it's not empty.
+	if spec.VersionConstraint != "" {
+		if _, err := semver.NewConstraint(spec.VersionConstraint); err != nil {
+			log.Info("Version constraint contains invalid value")
+			conditions.Set(provider, conditions.FalseCondition(
+				operatorv1.PreflightCheckCondition,
+				operatorv1.IncorrectVersionFormatReason,
+				clusterv1.ConditionSeverityError,
+				err.Error(),
+			))
+
+			return ctrl.Result{}, fmt.Errorf("version constraint contains invalid value for provider %q", provider.GetName())
+		}
+	}
+
+	// Check that provider reconcile interval is not too short if it's set.
+	if spec.ReconcileInterval != nil && spec.ReconcileInterval.Duration < MinReconcileInterval {
+		conditions.Set(provider, conditions.FalseCondition(
+			operatorv1.PreflightCheckCondition,
+			operatorv1.InvalidReconcileIntervalReason,
+			clusterv1.ConditionSeverityError,
+			fmt.Sprintf(reconcileIntervalTooShortMessage, spec.ReconcileInterval.Duration, MinReconcileInterval),
+		))
+
+		return ctrl.Result{}, fmt.Errorf("reconcile interval is too short for provider %q", provider.GetName())
+	}
+
 	// Ensure that the CoreProvider is called "cluster-api".
 	if util.IsCoreProvider(provider) {
 		if provider.GetName() != configclient.ClusterAPIProviderName {
@@ -87,21 +130,78 @@ func preflightChecks(ctx context.Context, c client.Client, provider genericprovi
 	}
 
 	// Check that if a predefined provider is being installed, and if it's not - ensure that FetchConfig is specified.
-	isPredefinedProvider, err := isPredefinedProvider(provider.GetName(), util.ClusterctlProviderType(provider))
+	reason, msg, err := ValidateProviderName(provider)
 	if err != nil {
-		return ctrl.Result{}, fmt.Errorf("failed to generate a list of predefined providers: %w", err)
+		return ctrl.Result{}, err
+	}
+
+	if msg != "" {
+		conditions.Set(provider, conditions.FalseCondition(
+			operatorv1.PreflightCheckCondition,
+			reason,
+			clusterv1.ConditionSeverityError,
+			msg,
+		))
+
+		return ctrl.Result{}, fmt.Errorf("invalid name for provider %s: %s", provider.GetName(), msg)
+	}
+
+	if isHelmSource(spec) && (spec.FetchConfig.Selector != nil || spec.FetchConfig.URL != "" || spec.FetchConfig.Git != nil) {
+		conditions.Set(provider, conditions.FalseCondition(
+			operatorv1.PreflightCheckCondition,
+			operatorv1.FetchConfigValidationErrorReason,
+			clusterv1.ConditionSeverityError,
+			"Helm can't be provided together with Selector, URL or Git",
+		))
+
+		return ctrl.Result{}, fmt.Errorf("helm can't be provided together with selector, URL or Git for provider %s", provider.GetName())
 	}
 
-	if !isPredefinedProvider {
-		if spec.FetchConfig == nil || spec.FetchConfig.Selector == nil && spec.FetchConfig.URL == "" {
+	if isHelmSource(spec) {
+		if msg := validateHelmSource(spec.FetchConfig); msg != "" {
 			conditions.Set(provider, conditions.FalseCondition(
 				operatorv1.PreflightCheckCondition,
 				operatorv1.FetchConfigValidationErrorReason,
 				clusterv1.ConditionSeverityError,
-				"Either Selector or URL must be provided for a not predefined provider",
+				msg,
 			))
 
-			return ctrl.Result{}, fmt.Errorf("either selector or URL must be provided for a not predefined provider %s", provider.GetName())
+			return ctrl.Result{}, fmt.Errorf("invalid Helm source for provider %s: %s", provider.GetName(), msg)
+		}
+
+		if msg := ValidateHelmSource(spec); msg != "" {
+			conditions.Set(provider, conditions.FalseCondition(
+				operatorv1.PreflightCheckCondition,
+				operatorv1.FetchConfigValidationErrorReason,
+				clusterv1.ConditionSeverityError,
+				msg,
+			))
+
+			return ctrl.Result{}, fmt.Errorf("invalid Helm source for provider %s: %s", provider.GetName(), msg)
+		}
+	}
+
+	if isGitSource(spec) && (spec.FetchConfig.Selector != nil || spec.FetchConfig.URL != "") {
+		conditions.Set(provider, conditions.FalseCondition(
+			operatorv1.PreflightCheckCondition,
+			operatorv1.FetchConfigValidationErrorReason,
+			clusterv1.ConditionSeverityError,
+			"Git can't be provided together with Selector or URL",
+		))
+
+		return ctrl.Result{}, fmt.Errorf("git can't be provided together with selector or URL for provider %s", provider.GetName())
+	}
+
+	if isGitSource(spec) {
+		if msg := ValidateGitSource(spec); msg != "" {
+			conditions.Set(provider, conditions.FalseCondition(
+				operatorv1.PreflightCheckCondition,
+				operatorv1.FetchConfigValidationErrorReason,
+				clusterv1.ConditionSeverityError,
+				msg,
+			))
+
+			return ctrl.Result{}, fmt.Errorf("invalid Git source for provider %s: %s", provider.GetName(), msg)
 		}
 	}
 
@@ -117,6 +217,210 @@ func preflightChecks(ctx context.Context, c client.Client, provider genericprovi
 		return ctrl.Result{}, fmt.Errorf("only one of Selector and URL must be provided for provider %s", provider.GetName())
 	}
 
+	if spec.FetchConfig != nil && spec.FetchConfig.Selector != nil &&
+		(spec.FetchConfig.ComponentsPath != "" || spec.FetchConfig.MetadataPath != "") {
+		// File name overrides only apply to manifests fetched from a URL.
+		conditions.Set(provider, conditions.FalseCondition(
+			operatorv1.PreflightCheckCondition,
+			operatorv1.FetchConfigValidationErrorReason,
+			clusterv1.ConditionSeverityError,
+			"ComponentsPath and MetadataPath can only be used with URL, not Selector",
+		))
+
+		return ctrl.Result{}, fmt.Errorf("componentsPath and metadataPath can only be used with URL for provider %s", provider.GetName())
+	}
+
+	if spec.FetchConfig != nil && spec.FetchConfig.CABundleRef != nil {
+		if msg := validateCABundleRef(spec.FetchConfig.CABundleRef, provider.GetNamespace()); msg != "" {
+			conditions.Set(provider, conditions.FalseCondition(
+				operatorv1.PreflightCheckCondition,
+				operatorv1.FetchConfigValidationErrorReason,
+				clusterv1.ConditionSeverityError,
+				msg,
+			))
+
+			return ctrl.Result{}, fmt.Errorf("invalid CA bundle reference for provider %s: %s", provider.GetName(), msg)
+		}
+	}
+
+	if spec.Manager != nil && spec.Manager.LeaderElection != nil {
+		if msg := validateLeaderElection(spec.Manager.LeaderElection); msg != "" {
+			conditions.Set(provider, conditions.FalseCondition(
+				operatorv1.PreflightCheckCondition,
+				operatorv1.InvalidLeaderElectionReason,
+				clusterv1.ConditionSeverityError,
+				msg,
+			))
+
+			return ctrl.Result{}, fmt.Errorf("invalid leader election configuration for provider %s: %s", provider.GetName(), msg)
+		}
+	}
+
+	if spec.Manager != nil {
+		msg := validateBindAddress("Metrics bind address", spec.Manager.Metrics.BindAddress)
+		if msg == "" {
+			msg = validateBindAddress("Health probe bind address", spec.Manager.Health.HealthProbeBindAddress)
+		}
+
+		if msg != "" {
+			conditions.Set(provider, conditions.FalseCondition(
+				operatorv1.PreflightCheckCondition,
+				operatorv1.InvalidBindAddressReason,
+				clusterv1.ConditionSeverityError,
+				msg,
+			))
+
+			return ctrl.Result{}, fmt.Errorf("invalid manager bind address for provider %s: %s", provider.GetName(), msg)
+		}
+	}
+
+	if spec.ManifestTransformWebhook != nil {
+		if msg := validateManifestTransformWebhook(spec.ManifestTransformWebhook, provider.GetNamespace()); msg != "" {
+			conditions.Set(provider, conditions.FalseCondition(
+				operatorv1.PreflightCheckCondition,
+				operatorv1.InvalidManifestTransformWebhookReason,
+				clusterv1.ConditionSeverityError,
+				msg,
+			))
+
+			return ctrl.Result{}, fmt.Errorf("invalid manifest transform webhook for provider %s: %s", provider.GetName(), msg)
+		}
+	}
+
+	if spec.ComponentSelector != nil {
+		if msg := validateComponentSelector(spec.ComponentSelector); msg != "" {
+			conditions.Set(provider, conditions.FalseCondition(
+				operatorv1.PreflightCheckCondition,
+				operatorv1.InvalidComponentSelectorReason,
+				clusterv1.ConditionSeverityError,
+				msg,
+			))
+
+			return ctrl.Result{}, fmt.Errorf("invalid component selector for provider %s: %s", provider.GetName(), msg)
+		}
+	}
+
+	if msg := validateExcludedObjects(spec.ExcludeObjects); msg != "" {
+		conditions.Set(provider, conditions.FalseCondition(
+			operatorv1.PreflightCheckCondition,
+			operatorv1.InvalidExcludeObjectsReason,
+			clusterv1.ConditionSeverityError,
+			msg,
+		))
+
+		return ctrl.Result{}, fmt.Errorf("invalid excluded objects for provider %s: %s", provider.GetName(), msg)
+	}
+
+	// Objects converted from v1alpha1 are not rejected by the v1alpha2 schema, so check replicas here too.
+	if spec.Deployment != nil && spec.Deployment.Replicas != nil && *spec.Deployment.Replicas < 1 {
+		conditions.Set(provider, conditions.FalseCondition(
+			operatorv1.PreflightCheckCondition,
+			operatorv1.InvalidReplicasReason,
+			clusterv1.ConditionSeverityError,
+			fmt.Sprintf(invalidReplicasMessage, *spec.Deployment.Replicas),
+		))
+
+		return ctrl.Result{}, fmt.Errorf("invalid deployment replicas for provider %s: %d", provider.GetName(), *spec.Deployment.Replicas)
+	}
+
+	if spec.Deployment != nil && spec.Deployment.Image != nil {
+		if msg := validateImageReference(spec.Deployment.Image); msg != "" {
+			conditions.Set(provider, conditions.FalseCondition(
+				operatorv1.PreflightCheckCondition,
+				operatorv1.InvalidImageReferenceReason,
+				clusterv1.ConditionSeverityError,
+				msg,
+			))
+
+			return ctrl.Result{}, fmt.Errorf("invalid image reference for provider %s: %s", provider.GetName(), msg)
+		}
+	}
+
+	if spec.Deployment != nil {
+		if msg := validateVolumes(spec.Deployment); msg != "" {
+			conditions.Set(provider, conditions.FalseCondition(
+				operatorv1.PreflightCheckCondition,
+				operatorv1.VolumeMountConflictReason,
+				clusterv1.ConditionSeverityError,
+				msg,
+			))
+
+			return ctrl.Result{}, fmt.Errorf("invalid volumes for provider %s: %s", provider.GetName(), msg)
+		}
+
+		if msg := validateInitContainers(spec.Deployment); msg != "" {
+			conditions.Set(provider, conditions.FalseCondition(
+				operatorv1.PreflightCheckCondition,
+				operatorv1.InitContainerConflictReason,
+				clusterv1.ConditionSeverityError,
+				msg,
+			))
+
+			return ctrl.Result{}, fmt.Errorf("invalid init containers for provider %s: %s", provider.GetName(), msg)
+		}
+
+		if msg := validateAdditionalPorts(spec.Deployment); msg != "" {
+			conditions.Set(provider, conditions.FalseCondition(
+				operatorv1.PreflightCheckCondition,
+				operatorv1.PortConflictReason,
+				clusterv1.ConditionSeverityError,
+				msg,
+			))
+
+			return ctrl.Result{}, fmt.Errorf("invalid additional ports for provider %s: %s", provider.GetName(), msg)
+		}
+	}
+
+	// Tarballs don't carry a list of versions, so the version must be set explicitly.
+	if spec.FetchConfig != nil && isTarballURL(spec.FetchConfig.URL) &&
+		(spec.Version == "" || isVersionResolutionEnabled(provider)) {
+		conditions.Set(provider, conditions.FalseCondition(
+			operatorv1.PreflightCheckCondition,
+			operatorv1.FetchConfigValidationErrorReason,
+			clusterv1.ConditionSeverityError,
+			tarballVersionRequiredMessage,
+		))
+
+		return ctrl.Result{}, fmt.Errorf("version must be set when fetching from a tarball URL for provider %s", provider.GetName())
+	}
+
+	// Git repositories don't carry a list of versions either.
+	if isGitSource(spec) && (spec.Version == "" || isVersionResolutionEnabled(provider)) {
+		conditions.Set(provider, conditions.FalseCondition(
+			operatorv1.PreflightCheckCondition,
+			operatorv1.FetchConfigValidationErrorReason,
+			clusterv1.ConditionSeverityError,
+			gitVersionRequiredMessage,
+		))
+
+		return ctrl.Result{}, fmt.Errorf("version must be set when fetching from Git for provider %s", provider.GetName())
+	}
+
+	// Neither do Helm charts rendered into the provider components.
+	if isHelmSource(spec) && (spec.Version == "" || isVersionResolutionEnabled(provider)) {
+		conditions.Set(provider, conditions.FalseCondition(
+			operatorv1.PreflightCheckCondition,
+			operatorv1.FetchConfigValidationErrorReason,
+			clusterv1.ConditionSeverityError,
+			helmVersionRequiredMessage,
+		))
+
+		return ctrl.Result{}, fmt.Errorf("version must be set when rendering a Helm chart for provider %s", provider.GetName())
+	}
+
+	// The overrides are for a single version.
+	if spec.FetchConfig != nil && spec.FetchConfig.OverridesConfigMapRef != nil &&
+		(spec.Version == "" || isVersionResolutionEnabled(provider)) {
+		conditions.Set(provider, conditions.FalseCondition(
+			operatorv1.PreflightCheckCondition,
+			operatorv1.FetchConfigValidationErrorReason,
+			clusterv1.ConditionSeverityError,
+			overridesVersionRequiredMessage,
+		))
+
+		return ctrl.Result{}, fmt.Errorf("version must be set when overriding the manifests for provider %s", provider.GetName())
+	}
+
 	// Validate that provided github token works and has repository access.
 	if spec.ConfigSecret != nil {
 		secret := &corev1.Secret{}
@@ -170,8 +474,9 @@ func preflightChecks(ctx context.Context, c client.Client, provider genericprovi
 			return ctrl.Result{}, fmt.Errorf("only one instance of CoreProvider is allowed")
 		}
 
-		// For any other provider we should check that instances with similar name exist in any namespace
-		if p.GetObjectKind().GroupVersionKind().Kind != coreProvider && p.GetName() == provider.GetName() {
+		// For any other provider we should check that instances with similar name exist in any namespace.
+		// Providers with different names, e.g. several infrastructure providers, are always allowed.
+		if !skipSingleInstanceCheck && p.GetObjectKind().GroupVersionKind().Kind != coreProvider && p.GetName() == provider.GetName() {
 			preflightFalseCondition.Message = fmt.Sprintf(moreThanOneProviderInstanceExistsMessage, p.GetName(), p.GetNamespace())
 			log.Info(preflightFalseCondition.Message)
 			conditions.Set(provider, preflightFalseCondition)
@@ -182,12 +487,38 @@ func preflightChecks(ctx context.Context, c client.Client, provider genericprovi
 
 	// Wait for core provider to be ready before we install other providers.
 	if !util.IsCoreProvider(provider) {
-		ready, err := coreProviderIsReady(ctx, c)
-		if err != nil {
-			return ctrl.Result{}, fmt.Errorf("failed to get coreProvider ready condition: %w", err)
+		cpl := &operatorv1.CoreProviderList{}
+
+		if err := c.List(ctx, cpl); err != nil {
+			return ctrl.Result{}, fmt.Errorf("failed to list core providers: %w", err)
 		}
 
-		if !ready {
+		// Providers can be created before the core provider while the cluster is being brought up,
+		// so a missing core provider is waited for, while several of them are an error.
+		switch len(cpl.Items) {
+		case 0:
+			log.Info(waitingForCoreProviderMessage)
+			conditions.Set(provider, conditions.FalseCondition(
+				operatorv1.PreflightCheckCondition,
+				operatorv1.WaitingForCoreProviderReason,
+				clusterv1.ConditionSeverityInfo,
+				waitingForCoreProviderMessage,
+			))
+
+			return ctrl.Result{RequeueAfter: requeueAfter}, nil
+		case 1:
+		default:
+			conditions.Set(provider, conditions.FalseCondition(
+				operatorv1.PreflightCheckCondition,
+				operatorv1.MoreThanOneProviderInstanceExistsReason,
+				clusterv1.ConditionSeverityError,
+				fmt.Sprintf(moreThanOneCoreProviderFoundMessage, len(cpl.Items)),
+			))
+
+			return ctrl.Result{}, fmt.Errorf("found %d core providers in the cluster, only one is allowed", len(cpl.Items))
+		}
+
+		if !coreProviderIsReady(&cpl.Items[0]) {
 			log.Info(waitingForCoreProviderReadyMessage)
 			conditions.Set(provider, conditions.FalseCondition(
 				operatorv1.PreflightCheckCondition,
@@ -196,7 +527,43 @@ func preflightChecks(ctx context.Context, c client.Client, provider genericprovi
 				waitingForCoreProviderReadyMessage,
 			))
 
-			return ctrl.Result{RequeueAfter: preflightFailedRequeueAfter}, nil
+			return ctrl.Result{RequeueAfter: requeueAfter}, nil
+		}
+	}
+
+	// Wait for the providers the provider explicitly depends on.
+	if len(spec.DependsOn) > 0 {
+		cycle, err := findDependencyCycle(ctx, c, provider)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+
+		if cycle != nil {
+			conditions.Set(provider, conditions.FalseCondition(
+				operatorv1.PreflightCheckCondition,
+				operatorv1.DependencyCycleReason,
+				clusterv1.ConditionSeverityError,
+				dependencyCycleMessage, strings.Join(cycle, " -> "),
+			))
+
+			return ctrl.Result{}, fmt.Errorf("provider %s depends on itself: %s", provider.GetName(), strings.Join(cycle, " -> "))
+		}
+
+		notReady, err := notReadyDependencies(ctx, c, provider)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+
+		if len(notReady) > 0 {
+			log.Info("Waiting for the provider dependencies to be ready", "dependencies", notReady)
+			conditions.Set(provider, conditions.FalseCondition(
+				operatorv1.PreflightCheckCondition,
+				operatorv1.WaitingForDependenciesReason,
+				clusterv1.ConditionSeverityInfo,
+				waitingForDependenciesMessage, strings.Join(notReady, ", "),
+			))
+
+			return ctrl.Result{RequeueAfter: requeueAfter}, nil
 		}
 	}
 
@@ -208,36 +575,30 @@ func preflightChecks(ctx context.Context, c client.Client, provider genericprovi
 }
 
 // coreProviderIsReady returns true if the core provider is ready.
-func coreProviderIsReady(ctx context.Context, c client.Client) (bool, error) {
+func coreProviderIsReady(cp *operatorv1.CoreProvider) bool {
+	for _, cond := range cp.Status.Conditions {
+		if cond.Type == clusterv1.ReadyCondition && cond.Status == corev1.ConditionTrue {
+			return true
+		}
+	}
+
+	return false
+}
+
+// getCoreProviderContract returns the contract of the installed core provider, or an empty string
+// if it's not installed yet.
+func getCoreProviderContract(ctx context.Context, c client.Client) (string, error) {
 	cpl := &operatorv1.CoreProviderList{}
 
 	if err := c.List(ctx, cpl); err != nil {
-		return false, err
+		return "", err
 	}
 
 	for _, cp := range cpl.Items {
-		for _, cond := range cp.Status.Conditions {
-			if cond.Type == clusterv1.ReadyCondition && cond.Status == corev1.ConditionTrue {
-				return true, nil
-			}
+		if cp.Status.Contract != nil {
+			return *cp.Status.Contract, nil
 		}
 	}
 
-	return false, nil
-}
-
-// isPredefinedProvider checks if a given provider is known for Cluster API.
-// The list of known providers can be found here:
-// https://github.com/kubernetes-sigs/cluster-api/blob/main/cmd/clusterctl/client/config/providers_client.go
-func isPredefinedProvider(providerName string, providerType clusterctlv1.ProviderType) (bool, error) {
-	// Initialize a client that contains predefined providers only.
-	configClient, err := configclient.New("")
-	if err != nil {
-		return false, err
-	}
-
-	// Try to find given provider in the predefined ones. If there is nothing, the function returns an error.
-	_, err = configClient.Providers().Get(providerName, providerType)
-
-	return err == nil, nil
+	return "", nil
 }
@@ -20,11 +20,15 @@ import (
 	"context"
 	"fmt"
 	"testing"
+	"time"
 
 	. "github.com/onsi/gomega"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	configv1alpha1 "k8s.io/component-base/config/v1alpha1"
+	"k8s.io/utils/pointer"
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 
 	operatorv1 "sigs.k8s.io/cluster-api-operator/api/v1alpha2"
@@ -341,6 +345,83 @@ func TestPreflightChecks(t *testing.T) {
 				InfrastructureProviderList: &operatorv1.InfrastructureProviderList{},
 			},
 		},
+		{
+			name: "two instances of the same infra provider with distinct names exist in same namespace, preflight check passed",
+			providers: []genericprovider.GenericProvider{
+				&genericprovider.InfrastructureProviderWrapper{
+					InfrastructureProvider: &operatorv1.InfrastructureProvider{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:      "aws-east",
+							Namespace: namespaceName1,
+						},
+						TypeMeta: metav1.TypeMeta{
+							Kind:       "InfrastructureProvider",
+							APIVersion: "operator.cluster.x-k8s.io/v1alpha1",
+						},
+						Spec: operatorv1.InfrastructureProviderSpec{
+							ProviderSpec: operatorv1.ProviderSpec{
+								Version: "v1.0.0",
+								FetchConfig: &operatorv1.FetchConfiguration{
+									URL: "https://github.com/kubernetes-sigs/cluster-api-provider-aws/releases",
+								},
+							},
+						},
+					},
+				},
+				&genericprovider.InfrastructureProviderWrapper{
+					InfrastructureProvider: &operatorv1.InfrastructureProvider{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:      "aws",
+							Namespace: namespaceName1,
+						},
+						TypeMeta: metav1.TypeMeta{
+							Kind:       "InfrastructureProvider",
+							APIVersion: "operator.cluster.x-k8s.io/v1alpha1",
+						},
+						Spec: operatorv1.InfrastructureProviderSpec{
+							ProviderSpec: operatorv1.ProviderSpec{
+								Version: "v1.0.0",
+							},
+						},
+					},
+				},
+				&genericprovider.CoreProviderWrapper{
+					CoreProvider: &operatorv1.CoreProvider{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:      "cluster-api",
+							Namespace: namespaceName2,
+						},
+						TypeMeta: metav1.TypeMeta{
+							Kind:       "CoreProvider",
+							APIVersion: "operator.cluster.x-k8s.io/v1alpha4",
+						},
+						Spec: operatorv1.CoreProviderSpec{
+							ProviderSpec: operatorv1.ProviderSpec{
+								Version: "v1.0.0",
+							},
+						},
+						Status: operatorv1.CoreProviderStatus{
+							ProviderStatus: operatorv1.ProviderStatus{
+								Conditions: []clusterv1.Condition{
+									{
+										Type:               clusterv1.ReadyCondition,
+										Status:             corev1.ConditionTrue,
+										LastTransitionTime: metav1.Now(),
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			expectedCondition: clusterv1.Condition{
+				Type:   operatorv1.PreflightCheckCondition,
+				Status: corev1.ConditionTrue,
+			},
+			providerList: &genericprovider.InfrastructureProviderListWrapper{
+				InfrastructureProviderList: &operatorv1.InfrastructureProviderList{},
+			},
+		},
 		{
 			name: "two different infra providers exist in different namespaces, preflight check passed",
 			providers: []genericprovider.GenericProvider{
@@ -499,22 +580,95 @@ func TestPreflightChecks(t *testing.T) {
 			},
 		},
 		{
-			name: "missing version, preflight check passed",
+			name:          "wrong version constraint, preflight check failed",
+			expectedError: true,
 			providers: []genericprovider.GenericProvider{
-				&genericprovider.CoreProviderWrapper{
-					CoreProvider: &operatorv1.CoreProvider{
+				&genericprovider.InfrastructureProviderWrapper{
+					InfrastructureProvider: &operatorv1.InfrastructureProvider{
 						ObjectMeta: metav1.ObjectMeta{
-							Name:      "cluster-api",
+							Name:      "aws",
 							Namespace: namespaceName1,
 						},
 						TypeMeta: metav1.TypeMeta{
-							Kind:       "CoreProvider",
+							Kind:       "InfrastructureProvider",
 							APIVersion: "operator.cluster.x-k8s.io/v1alpha1",
 						},
-						Spec: operatorv1.CoreProviderSpec{
+						Spec: operatorv1.InfrastructureProviderSpec{
 							ProviderSpec: operatorv1.ProviderSpec{
-								FetchConfig: &operatorv1.FetchConfiguration{
-									URL: "https://example.com",
+								VersionConstraint: "one",
+							},
+						},
+					},
+				},
+			},
+			expectedCondition: clusterv1.Condition{
+				Type:     operatorv1.PreflightCheckCondition,
+				Reason:   operatorv1.IncorrectVersionFormatReason,
+				Severity: clusterv1.ConditionSeverityError,
+				Message:  "improper constraint: one",
+				Status:   corev1.ConditionFalse,
+			},
+			providerList: &genericprovider.InfrastructureProviderListWrapper{
+				InfrastructureProviderList: &operatorv1.InfrastructureProviderList{},
+			},
+		},
+		{
+			name:          "reconcile interval too short, preflight check failed",
+			expectedError: true,
+			providers: []genericprovider.GenericProvider{
+				&genericprovider.InfrastructureProviderWrapper{
+					InfrastructureProvider: &operatorv1.InfrastructureProvider{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:      "aws",
+							Namespace: namespaceName1,
+						},
+						TypeMeta: metav1.TypeMeta{
+							Kind:       "InfrastructureProvider",
+							APIVersion: "operator.cluster.x-k8s.io/v1alpha1",
+						},
+						Spec: operatorv1.InfrastructureProviderSpec{
+							ProviderSpec: operatorv1.ProviderSpec{
+								Version:           "v1.0.0",
+								ReconcileInterval: &metav1.Duration{Duration: time.Second},
+							},
+						},
+					},
+				},
+			},
+			expectedCondition: clusterv1.Condition{
+				Type:     operatorv1.PreflightCheckCondition,
+				Reason:   operatorv1.InvalidReconcileIntervalReason,
+				Severity: clusterv1.ConditionSeverityError,
+				Message:  "Reconcile interval 1s is shorter than the minimum 5s",
+				Status:   corev1.ConditionFalse,
+			},
+			providerList: &genericprovider.InfrastructureProviderListWrapper{
+				InfrastructureProviderList: &operatorv1.InfrastructureProviderList{},
+			},
+		},
+		{
+			name:          "invalid leader election configuration, preflight check failed",
+			expectedError: true,
+			providers: []genericprovider.GenericProvider{
+				&genericprovider.InfrastructureProviderWrapper{
+					InfrastructureProvider: &operatorv1.InfrastructureProvider{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:      "aws",
+							Namespace: namespaceName1,
+						},
+						TypeMeta: metav1.TypeMeta{
+							Kind:       "InfrastructureProvider",
+							APIVersion: "operator.cluster.x-k8s.io/v1alpha1",
+						},
+						Spec: operatorv1.InfrastructureProviderSpec{
+							ProviderSpec: operatorv1.ProviderSpec{
+								Version: "v1.0.0",
+								Manager: &operatorv1.ManagerSpec{
+									ControllerManagerConfiguration: operatorv1.ControllerManagerConfiguration{
+										LeaderElection: &configv1alpha1.LeaderElectionConfiguration{
+											LeaseDuration: metav1.Duration{Duration: -time.Second},
+										},
+									},
 								},
 							},
 						},
@@ -522,15 +676,18 @@ func TestPreflightChecks(t *testing.T) {
 				},
 			},
 			expectedCondition: clusterv1.Condition{
-				Type:   operatorv1.PreflightCheckCondition,
-				Status: corev1.ConditionTrue,
+				Type:     operatorv1.PreflightCheckCondition,
+				Reason:   operatorv1.InvalidLeaderElectionReason,
+				Severity: clusterv1.ConditionSeverityError,
+				Message:  "Leader election leaseDuration must be positive, got -1s",
+				Status:   corev1.ConditionFalse,
 			},
-			providerList: &genericprovider.CoreProviderListWrapper{
-				CoreProviderList: &operatorv1.CoreProviderList{},
+			providerList: &genericprovider.InfrastructureProviderListWrapper{
+				InfrastructureProviderList: &operatorv1.InfrastructureProviderList{},
 			},
 		},
 		{
-			name:          "incorrect fetchConfig, preflight check failed",
+			name:          "invalid manager metrics bind address, preflight check failed",
 			expectedError: true,
 			providers: []genericprovider.GenericProvider{
 				&genericprovider.InfrastructureProviderWrapper{
@@ -546,10 +703,9 @@ func TestPreflightChecks(t *testing.T) {
 						Spec: operatorv1.InfrastructureProviderSpec{
 							ProviderSpec: operatorv1.ProviderSpec{
 								Version: "v1.0.0",
-								FetchConfig: &operatorv1.FetchConfiguration{
-									URL: "https://example.com",
-									Selector: &metav1.LabelSelector{
-										MatchLabels: map[string]string{"provider-components": "aws"},
+								Manager: &operatorv1.ManagerSpec{
+									ControllerManagerConfiguration: operatorv1.ControllerManagerConfiguration{
+										Metrics: operatorv1.ControllerMetrics{BindAddress: "8080"},
 									},
 								},
 							},
@@ -559,9 +715,9 @@ func TestPreflightChecks(t *testing.T) {
 			},
 			expectedCondition: clusterv1.Condition{
 				Type:     operatorv1.PreflightCheckCondition,
-				Reason:   operatorv1.FetchConfigValidationErrorReason,
+				Reason:   operatorv1.InvalidBindAddressReason,
 				Severity: clusterv1.ConditionSeverityError,
-				Message:  "Only one of Selector and URL must be provided, not both",
+				Message:  "Metrics bind address \"8080\" must be in the host:port format, e.g. \":8080\"",
 				Status:   corev1.ConditionFalse,
 			},
 			providerList: &genericprovider.InfrastructureProviderListWrapper{
@@ -569,42 +725,86 @@ func TestPreflightChecks(t *testing.T) {
 			},
 		},
 		{
-			name: "predefined Core Provider without fetch config, preflight check passed",
+			name:          "invalid manager image override, preflight check failed",
+			expectedError: true,
 			providers: []genericprovider.GenericProvider{
-				&genericprovider.CoreProviderWrapper{
-					CoreProvider: &operatorv1.CoreProvider{
+				&genericprovider.InfrastructureProviderWrapper{
+					InfrastructureProvider: &operatorv1.InfrastructureProvider{
 						ObjectMeta: metav1.ObjectMeta{
-							Name:      "cluster-api",
+							Name:      "aws",
 							Namespace: namespaceName1,
 						},
 						TypeMeta: metav1.TypeMeta{
-							Kind:       "CoreProvider",
+							Kind:       "InfrastructureProvider",
 							APIVersion: "operator.cluster.x-k8s.io/v1alpha1",
 						},
-						Spec: operatorv1.CoreProviderSpec{
+						Spec: operatorv1.InfrastructureProviderSpec{
 							ProviderSpec: operatorv1.ProviderSpec{
 								Version: "v1.0.0",
+								Deployment: &operatorv1.DeploymentSpec{
+									Image: &operatorv1.ImageReference{
+										Repository: "registry.k8s.io/cluster-api-aws/cluster-api-aws-controller",
+									},
+								},
 							},
 						},
 					},
 				},
 			},
 			expectedCondition: clusterv1.Condition{
-				Type:   operatorv1.PreflightCheckCondition,
-				Status: corev1.ConditionTrue,
+				Type:     operatorv1.PreflightCheckCondition,
+				Reason:   operatorv1.InvalidImageReferenceReason,
+				Severity: clusterv1.ConditionSeverityError,
+				Message:  "At least one of image tag and digest must be provided",
+				Status:   corev1.ConditionFalse,
 			},
-			providerList: &genericprovider.CoreProviderListWrapper{
-				CoreProviderList: &operatorv1.CoreProviderList{},
+			providerList: &genericprovider.InfrastructureProviderListWrapper{
+				InfrastructureProviderList: &operatorv1.InfrastructureProviderList{},
 			},
 		},
 		{
-			name:          "custom Infrastructure Provider without fetch config, preflight check failed",
+			name:          "git source without version, preflight check failed",
 			expectedError: true,
 			providers: []genericprovider.GenericProvider{
 				&genericprovider.InfrastructureProviderWrapper{
 					InfrastructureProvider: &operatorv1.InfrastructureProvider{
 						ObjectMeta: metav1.ObjectMeta{
-							Name:      "my-custom-aws",
+							Name:      "my-infra",
+							Namespace: namespaceName1,
+						},
+						TypeMeta: metav1.TypeMeta{
+							Kind:       "InfrastructureProvider",
+							APIVersion: "operator.cluster.x-k8s.io/v1alpha1",
+						},
+						Spec: operatorv1.InfrastructureProviderSpec{
+							ProviderSpec: operatorv1.ProviderSpec{
+								FetchConfig: &operatorv1.FetchConfiguration{
+									Git: &operatorv1.GitSource{URL: "https://github.com/owner/repo.git"},
+								},
+							},
+						},
+					},
+				},
+			},
+			expectedCondition: clusterv1.Condition{
+				Type:     operatorv1.PreflightCheckCondition,
+				Reason:   operatorv1.FetchConfigValidationErrorReason,
+				Severity: clusterv1.ConditionSeverityError,
+				Message:  "Version must be set, and Channel and VersionConstraint can't be used, when fetching from Git",
+				Status:   corev1.ConditionFalse,
+			},
+			providerList: &genericprovider.InfrastructureProviderListWrapper{
+				InfrastructureProviderList: &operatorv1.InfrastructureProviderList{},
+			},
+		},
+		{
+			name:          "git source together with URL, preflight check failed",
+			expectedError: true,
+			providers: []genericprovider.GenericProvider{
+				&genericprovider.InfrastructureProviderWrapper{
+					InfrastructureProvider: &operatorv1.InfrastructureProvider{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:      "my-infra",
 							Namespace: namespaceName1,
 						},
 						TypeMeta: metav1.TypeMeta{
@@ -614,6 +814,10 @@ func TestPreflightChecks(t *testing.T) {
 						Spec: operatorv1.InfrastructureProviderSpec{
 							ProviderSpec: operatorv1.ProviderSpec{
 								Version: "v1.0.0",
+								FetchConfig: &operatorv1.FetchConfiguration{
+									URL: "https://github.com/owner/repo/releases",
+									Git: &operatorv1.GitSource{URL: "https://github.com/owner/repo.git"},
+								},
 							},
 						},
 					},
@@ -623,21 +827,21 @@ func TestPreflightChecks(t *testing.T) {
 				Type:     operatorv1.PreflightCheckCondition,
 				Reason:   operatorv1.FetchConfigValidationErrorReason,
 				Severity: clusterv1.ConditionSeverityError,
-				Message:  "Either Selector or URL must be provided for a not predefined provider",
+				Message:  "Git can't be provided together with Selector or URL",
 				Status:   corev1.ConditionFalse,
 			},
-			providerList: &genericprovider.CoreProviderListWrapper{
-				CoreProviderList: &operatorv1.CoreProviderList{},
+			providerList: &genericprovider.InfrastructureProviderListWrapper{
+				InfrastructureProviderList: &operatorv1.InfrastructureProviderList{},
 			},
 		},
 		{
-			name:          "custom Infrastructure Provider with fetch config with empty values, preflight check failed",
+			name:          "git source with a file URL, preflight check failed",
 			expectedError: true,
 			providers: []genericprovider.GenericProvider{
 				&genericprovider.InfrastructureProviderWrapper{
 					InfrastructureProvider: &operatorv1.InfrastructureProvider{
 						ObjectMeta: metav1.ObjectMeta{
-							Name:      "my-custom-aws",
+							Name:      "my-infra",
 							Namespace: namespaceName1,
 						},
 						TypeMeta: metav1.TypeMeta{
@@ -648,8 +852,7 @@ func TestPreflightChecks(t *testing.T) {
 							ProviderSpec: operatorv1.ProviderSpec{
 								Version: "v1.0.0",
 								FetchConfig: &operatorv1.FetchConfiguration{
-									URL:      "",
-									Selector: nil,
+									Git: &operatorv1.GitSource{URL: "file:///var/run/secrets"},
 								},
 							},
 						},
@@ -660,38 +863,1013 @@ func TestPreflightChecks(t *testing.T) {
 				Type:     operatorv1.PreflightCheckCondition,
 				Reason:   operatorv1.FetchConfigValidationErrorReason,
 				Severity: clusterv1.ConditionSeverityError,
-				Message:  "Either Selector or URL must be provided for a not predefined provider",
+				Message:  `Git URL "file:///var/run/secrets" uses protocol "file", only https and ssh are allowed`,
 				Status:   corev1.ConditionFalse,
 			},
-			providerList: &genericprovider.CoreProviderListWrapper{
-				CoreProviderList: &operatorv1.CoreProviderList{},
+			providerList: &genericprovider.InfrastructureProviderListWrapper{
+				InfrastructureProviderList: &operatorv1.InfrastructureProviderList{},
 			},
 		},
-	}
-
-	for _, tc := range testCases {
-		t.Run(tc.name, func(t *testing.T) {
-			gs := NewWithT(t)
-
-			fakeclient := fake.NewClientBuilder().WithObjects().Build()
-
-			for _, c := range tc.providers {
-				gs.Expect(fakeclient.Create(ctx, c.GetObject())).To(Succeed())
-			}
-
-			_, err := preflightChecks(context.Background(), fakeclient, tc.providers[0], tc.providerList)
-			if tc.expectedError {
-				gs.Expect(err).To(HaveOccurred())
-			} else {
-				gs.Expect(err).ToNot(HaveOccurred())
-			}
-
-			// Check if proper condition is returned
-			gs.Expect(tc.providers[0].GetStatus().Conditions).To(HaveLen(1))
-			gs.Expect(tc.providers[0].GetStatus().Conditions[0].Type).To(Equal(tc.expectedCondition.Type))
+		{
+			name:          "helm source without version, preflight check failed",
+			expectedError: true,
+			providers: []genericprovider.GenericProvider{
+				&genericprovider.InfrastructureProviderWrapper{
+					InfrastructureProvider: &operatorv1.InfrastructureProvider{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:      "my-infra",
+							Namespace: namespaceName1,
+						},
+						TypeMeta: metav1.TypeMeta{
+							Kind:       "InfrastructureProvider",
+							APIVersion: "operator.cluster.x-k8s.io/v1alpha1",
+						},
+						Spec: operatorv1.InfrastructureProviderSpec{
+							ProviderSpec: operatorv1.ProviderSpec{
+								FetchConfig: &operatorv1.FetchConfiguration{
+									Helm: &operatorv1.HelmSource{RepoURL: "https://owner.github.io/charts", Chart: "my-infra"},
+								},
+							},
+						},
+					},
+				},
+			},
+			expectedCondition: clusterv1.Condition{
+				Type:     operatorv1.PreflightCheckCondition,
+				Reason:   operatorv1.FetchConfigValidationErrorReason,
+				Severity: clusterv1.ConditionSeverityError,
+				Message:  "Version must be set, and Channel and VersionConstraint can't be used, when rendering a Helm chart",
+				Status:   corev1.ConditionFalse,
+			},
+			providerList: &genericprovider.InfrastructureProviderListWrapper{
+				InfrastructureProviderList: &operatorv1.InfrastructureProviderList{},
+			},
+		},
+		{
+			name:          "overrides without version, preflight check failed",
+			expectedError: true,
+			providers: []genericprovider.GenericProvider{
+				&genericprovider.InfrastructureProviderWrapper{
+					InfrastructureProvider: &operatorv1.InfrastructureProvider{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:      "aws",
+							Namespace: namespaceName1,
+						},
+						TypeMeta: metav1.TypeMeta{
+							Kind:       "InfrastructureProvider",
+							APIVersion: "operator.cluster.x-k8s.io/v1alpha1",
+						},
+						Spec: operatorv1.InfrastructureProviderSpec{
+							ProviderSpec: operatorv1.ProviderSpec{
+								FetchConfig: &operatorv1.FetchConfiguration{
+									OverridesConfigMapRef: &operatorv1.ConfigmapReference{Name: "aws-overrides"},
+								},
+							},
+						},
+					},
+				},
+			},
+			expectedCondition: clusterv1.Condition{
+				Type:     operatorv1.PreflightCheckCondition,
+				Reason:   operatorv1.FetchConfigValidationErrorReason,
+				Severity: clusterv1.ConditionSeverityError,
+				Message:  "Version must be set, and Channel and VersionConstraint can't be used, when overriding the provider manifests",
+				Status:   corev1.ConditionFalse,
+			},
+			providerList: &genericprovider.InfrastructureProviderListWrapper{
+				InfrastructureProviderList: &operatorv1.InfrastructureProviderList{},
+			},
+		},
+		{
+			name:          "helm values from both a config map and a secret, preflight check failed",
+			expectedError: true,
+			providers: []genericprovider.GenericProvider{
+				&genericprovider.InfrastructureProviderWrapper{
+					InfrastructureProvider: &operatorv1.InfrastructureProvider{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:      "my-infra",
+							Namespace: namespaceName1,
+						},
+						TypeMeta: metav1.TypeMeta{
+							Kind:       "InfrastructureProvider",
+							APIVersion: "operator.cluster.x-k8s.io/v1alpha1",
+						},
+						Spec: operatorv1.InfrastructureProviderSpec{
+							ProviderSpec: operatorv1.ProviderSpec{
+								Version: "v1.0.0",
+								FetchConfig: &operatorv1.FetchConfiguration{
+									Helm: &operatorv1.HelmSource{
+										RepoURL: "https://owner.github.io/charts",
+										Chart:   "my-infra",
+										ValuesFrom: &operatorv1.HelmValuesReference{
+											ConfigMap: &operatorv1.ConfigmapReference{Name: "values"},
+											Secret:    &operatorv1.SecretReference{Name: "values"},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			expectedCondition: clusterv1.Condition{
+				Type:     operatorv1.PreflightCheckCondition,
+				Reason:   operatorv1.FetchConfigValidationErrorReason,
+				Severity: clusterv1.ConditionSeverityError,
+				Message:  "Exactly one of ConfigMap and Secret must be provided for the Helm values",
+				Status:   corev1.ConditionFalse,
+			},
+			providerList: &genericprovider.InfrastructureProviderListWrapper{
+				InfrastructureProviderList: &operatorv1.InfrastructureProviderList{},
+			},
+		},
+		{
+			name:          "helm chart mistaken for an option, preflight check failed",
+			expectedError: true,
+			providers: []genericprovider.GenericProvider{
+				&genericprovider.InfrastructureProviderWrapper{
+					InfrastructureProvider: &operatorv1.InfrastructureProvider{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:      "my-infra",
+							Namespace: namespaceName1,
+						},
+						TypeMeta: metav1.TypeMeta{
+							Kind:       "InfrastructureProvider",
+							APIVersion: "operator.cluster.x-k8s.io/v1alpha1",
+						},
+						Spec: operatorv1.InfrastructureProviderSpec{
+							ProviderSpec: operatorv1.ProviderSpec{
+								Version: "v1.0.0",
+								FetchConfig: &operatorv1.FetchConfiguration{
+									Helm: &operatorv1.HelmSource{
+										RepoURL: "https://owner.github.io/charts",
+										Chart:   "--post-renderer=/bin/sh",
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			expectedCondition: clusterv1.Condition{
+				Type:     operatorv1.PreflightCheckCondition,
+				Reason:   operatorv1.FetchConfigValidationErrorReason,
+				Severity: clusterv1.ConditionSeverityError,
+				Message:  `Helm chart "--post-renderer=/bin/sh" can't start with "-"`,
+				Status:   corev1.ConditionFalse,
+			},
+			providerList: &genericprovider.InfrastructureProviderListWrapper{
+				InfrastructureProviderList: &operatorv1.InfrastructureProviderList{},
+			},
+		},
+		{
+			name:          "zero deployment replicas, preflight check failed",
+			expectedError: true,
+			providers: []genericprovider.GenericProvider{
+				&genericprovider.InfrastructureProviderWrapper{
+					InfrastructureProvider: &operatorv1.InfrastructureProvider{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:      "aws",
+							Namespace: namespaceName1,
+						},
+						TypeMeta: metav1.TypeMeta{
+							Kind:       "InfrastructureProvider",
+							APIVersion: "operator.cluster.x-k8s.io/v1alpha1",
+						},
+						Spec: operatorv1.InfrastructureProviderSpec{
+							ProviderSpec: operatorv1.ProviderSpec{
+								Version: "v1.0.0",
+								Deployment: &operatorv1.DeploymentSpec{
+									Replicas: pointer.Int(0),
+								},
+							},
+						},
+					},
+				},
+			},
+			expectedCondition: clusterv1.Condition{
+				Type:     operatorv1.PreflightCheckCondition,
+				Reason:   operatorv1.InvalidReplicasReason,
+				Severity: clusterv1.ConditionSeverityError,
+				Message:  "Deployment replicas must be at least 1, got 0",
+				Status:   corev1.ConditionFalse,
+			},
+			providerList: &genericprovider.InfrastructureProviderListWrapper{
+				InfrastructureProviderList: &operatorv1.InfrastructureProviderList{},
+			},
+		},
+		{
+			name:          "malformed component selector, preflight check failed",
+			expectedError: true,
+			providers: []genericprovider.GenericProvider{
+				&genericprovider.InfrastructureProviderWrapper{
+					InfrastructureProvider: &operatorv1.InfrastructureProvider{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:      "aws",
+							Namespace: namespaceName1,
+						},
+						TypeMeta: metav1.TypeMeta{
+							Kind:       "InfrastructureProvider",
+							APIVersion: "operator.cluster.x-k8s.io/v1alpha1",
+						},
+						Spec: operatorv1.InfrastructureProviderSpec{
+							ProviderSpec: operatorv1.ProviderSpec{
+								Version: "v1.0.0",
+								ComponentSelector: &operatorv1.ComponentSelector{
+									LabelSelector: &metav1.LabelSelector{
+										MatchExpressions: []metav1.LabelSelectorRequirement{
+											{Key: "component", Operator: "Equals", Values: []string{"crds"}},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			expectedCondition: clusterv1.Condition{
+				Type:     operatorv1.PreflightCheckCondition,
+				Reason:   operatorv1.InvalidComponentSelectorReason,
+				Severity: clusterv1.ConditionSeverityError,
+				Message:  `Invalid label selector in the component selector: "Equals" is not a valid label selector operator`,
+				Status:   corev1.ConditionFalse,
+			},
+			providerList: &genericprovider.InfrastructureProviderListWrapper{
+				InfrastructureProviderList: &operatorv1.InfrastructureProviderList{},
+			},
+		},
+		{
+			name:          "malformed excluded object pattern, preflight check failed",
+			expectedError: true,
+			providers: []genericprovider.GenericProvider{
+				&genericprovider.InfrastructureProviderWrapper{
+					InfrastructureProvider: &operatorv1.InfrastructureProvider{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:      "aws",
+							Namespace: namespaceName1,
+						},
+						TypeMeta: metav1.TypeMeta{
+							Kind:       "InfrastructureProvider",
+							APIVersion: "operator.cluster.x-k8s.io/v1alpha1",
+						},
+						Spec: operatorv1.InfrastructureProviderSpec{
+							ProviderSpec: operatorv1.ProviderSpec{
+								Version: "v1.0.0",
+								ExcludeObjects: []operatorv1.ExcludedObject{
+									{Kind: "ClusterClass", Name: "quick-start-["},
+								},
+							},
+						},
+					},
+				},
+			},
+			expectedCondition: clusterv1.Condition{
+				Type:     operatorv1.PreflightCheckCondition,
+				Reason:   operatorv1.InvalidExcludeObjectsReason,
+				Severity: clusterv1.ConditionSeverityError,
+				Message:  `Invalid name pattern "quick-start-[" of excluded object 0: syntax error in pattern`,
+				Status:   corev1.ConditionFalse,
+			},
+			providerList: &genericprovider.InfrastructureProviderListWrapper{
+				InfrastructureProviderList: &operatorv1.InfrastructureProviderList{},
+			},
+		},
+		{
+			name:          "colliding volume mounts, preflight check failed",
+			expectedError: true,
+			providers: []genericprovider.GenericProvider{
+				&genericprovider.InfrastructureProviderWrapper{
+					InfrastructureProvider: &operatorv1.InfrastructureProvider{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:      "aws",
+							Namespace: namespaceName1,
+						},
+						TypeMeta: metav1.TypeMeta{
+							Kind:       "InfrastructureProvider",
+							APIVersion: "operator.cluster.x-k8s.io/v1alpha1",
+						},
+						Spec: operatorv1.InfrastructureProviderSpec{
+							ProviderSpec: operatorv1.ProviderSpec{
+								Version: "v1.0.0",
+								Deployment: &operatorv1.DeploymentSpec{
+									Containers: []operatorv1.ContainerSpec{{
+										Name: "manager",
+										VolumeMounts: []corev1.VolumeMount{
+											{Name: "credentials", MountPath: "/home/.aws"},
+											{Name: "config", MountPath: "/home/.aws"},
+										},
+									}},
+								},
+							},
+						},
+					},
+				},
+			},
+			expectedCondition: clusterv1.Condition{
+				Type:     operatorv1.PreflightCheckCondition,
+				Reason:   operatorv1.VolumeMountConflictReason,
+				Severity: clusterv1.ConditionSeverityError,
+				Message:  `mount path "/home/.aws" of volume "config" collides with volume "credentials" in container "manager"`,
+				Status:   corev1.ConditionFalse,
+			},
+			providerList: &genericprovider.InfrastructureProviderListWrapper{
+				InfrastructureProviderList: &operatorv1.InfrastructureProviderList{},
+			},
+		},
+		{
+			name: "missing version, preflight check passed",
+			providers: []genericprovider.GenericProvider{
+				&genericprovider.CoreProviderWrapper{
+					CoreProvider: &operatorv1.CoreProvider{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:      "cluster-api",
+							Namespace: namespaceName1,
+						},
+						TypeMeta: metav1.TypeMeta{
+							Kind:       "CoreProvider",
+							APIVersion: "operator.cluster.x-k8s.io/v1alpha1",
+						},
+						Spec: operatorv1.CoreProviderSpec{
+							ProviderSpec: operatorv1.ProviderSpec{
+								FetchConfig: &operatorv1.FetchConfiguration{
+									URL: "https://example.com",
+								},
+							},
+						},
+					},
+				},
+			},
+			expectedCondition: clusterv1.Condition{
+				Type:   operatorv1.PreflightCheckCondition,
+				Status: corev1.ConditionTrue,
+			},
+			providerList: &genericprovider.CoreProviderListWrapper{
+				CoreProviderList: &operatorv1.CoreProviderList{},
+			},
+		},
+		{
+			name:          "incorrect fetchConfig, preflight check failed",
+			expectedError: true,
+			providers: []genericprovider.GenericProvider{
+				&genericprovider.InfrastructureProviderWrapper{
+					InfrastructureProvider: &operatorv1.InfrastructureProvider{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:      "aws",
+							Namespace: namespaceName1,
+						},
+						TypeMeta: metav1.TypeMeta{
+							Kind:       "InfrastructureProvider",
+							APIVersion: "operator.cluster.x-k8s.io/v1alpha1",
+						},
+						Spec: operatorv1.InfrastructureProviderSpec{
+							ProviderSpec: operatorv1.ProviderSpec{
+								Version: "v1.0.0",
+								FetchConfig: &operatorv1.FetchConfiguration{
+									URL: "https://example.com",
+									Selector: &metav1.LabelSelector{
+										MatchLabels: map[string]string{"provider-components": "aws"},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			expectedCondition: clusterv1.Condition{
+				Type:     operatorv1.PreflightCheckCondition,
+				Reason:   operatorv1.FetchConfigValidationErrorReason,
+				Severity: clusterv1.ConditionSeverityError,
+				Message:  "Only one of Selector and URL must be provided, not both",
+				Status:   corev1.ConditionFalse,
+			},
+			providerList: &genericprovider.InfrastructureProviderListWrapper{
+				InfrastructureProviderList: &operatorv1.InfrastructureProviderList{},
+			},
+		},
+		{
+			name:          "fetchConfig with selector and components path, preflight check failed",
+			expectedError: true,
+			providers: []genericprovider.GenericProvider{
+				&genericprovider.InfrastructureProviderWrapper{
+					InfrastructureProvider: &operatorv1.InfrastructureProvider{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:      "aws",
+							Namespace: namespaceName1,
+						},
+						TypeMeta: metav1.TypeMeta{
+							Kind:       "InfrastructureProvider",
+							APIVersion: "operator.cluster.x-k8s.io/v1alpha1",
+						},
+						Spec: operatorv1.InfrastructureProviderSpec{
+							ProviderSpec: operatorv1.ProviderSpec{
+								Version: "v1.0.0",
+								FetchConfig: &operatorv1.FetchConfiguration{
+									Selector: &metav1.LabelSelector{
+										MatchLabels: map[string]string{"provider-components": "aws"},
+									},
+									ComponentsPath: "aws-components.yaml",
+								},
+							},
+						},
+					},
+				},
+			},
+			expectedCondition: clusterv1.Condition{
+				Type:     operatorv1.PreflightCheckCondition,
+				Reason:   operatorv1.FetchConfigValidationErrorReason,
+				Severity: clusterv1.ConditionSeverityError,
+				Message:  "ComponentsPath and MetadataPath can only be used with URL, not Selector",
+				Status:   corev1.ConditionFalse,
+			},
+			providerList: &genericprovider.InfrastructureProviderListWrapper{
+				InfrastructureProviderList: &operatorv1.InfrastructureProviderList{},
+			},
+		},
+		{
+			name:          "tarball fetchConfig without version, preflight check failed",
+			expectedError: true,
+			providers: []genericprovider.GenericProvider{
+				&genericprovider.InfrastructureProviderWrapper{
+					InfrastructureProvider: &operatorv1.InfrastructureProvider{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:      "my-provider",
+							Namespace: namespaceName1,
+						},
+						TypeMeta: metav1.TypeMeta{
+							Kind:       "InfrastructureProvider",
+							APIVersion: "operator.cluster.x-k8s.io/v1alpha1",
+						},
+						Spec: operatorv1.InfrastructureProviderSpec{
+							ProviderSpec: operatorv1.ProviderSpec{
+								FetchConfig: &operatorv1.FetchConfiguration{
+									URL: "https://example.com/releases/my-provider.tar.gz",
+								},
+							},
+						},
+					},
+				},
+			},
+			expectedCondition: clusterv1.Condition{
+				Type:     operatorv1.PreflightCheckCondition,
+				Reason:   operatorv1.FetchConfigValidationErrorReason,
+				Severity: clusterv1.ConditionSeverityError,
+				Message:  tarballVersionRequiredMessage,
+				Status:   corev1.ConditionFalse,
+			},
+			providerList: &genericprovider.InfrastructureProviderListWrapper{
+				InfrastructureProviderList: &operatorv1.InfrastructureProviderList{},
+			},
+		},
+		{
+			name: "predefined Core Provider without fetch config, preflight check passed",
+			providers: []genericprovider.GenericProvider{
+				&genericprovider.CoreProviderWrapper{
+					CoreProvider: &operatorv1.CoreProvider{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:      "cluster-api",
+							Namespace: namespaceName1,
+						},
+						TypeMeta: metav1.TypeMeta{
+							Kind:       "CoreProvider",
+							APIVersion: "operator.cluster.x-k8s.io/v1alpha1",
+						},
+						Spec: operatorv1.CoreProviderSpec{
+							ProviderSpec: operatorv1.ProviderSpec{
+								Version: "v1.0.0",
+							},
+						},
+					},
+				},
+			},
+			expectedCondition: clusterv1.Condition{
+				Type:   operatorv1.PreflightCheckCondition,
+				Status: corev1.ConditionTrue,
+			},
+			providerList: &genericprovider.CoreProviderListWrapper{
+				CoreProviderList: &operatorv1.CoreProviderList{},
+			},
+		},
+		{
+			name:          "custom Infrastructure Provider without fetch config, preflight check failed",
+			expectedError: true,
+			providers: []genericprovider.GenericProvider{
+				&genericprovider.InfrastructureProviderWrapper{
+					InfrastructureProvider: &operatorv1.InfrastructureProvider{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:      "my-custom-aws",
+							Namespace: namespaceName1,
+						},
+						TypeMeta: metav1.TypeMeta{
+							Kind:       "InfrastructureProvider",
+							APIVersion: "operator.cluster.x-k8s.io/v1alpha1",
+						},
+						Spec: operatorv1.InfrastructureProviderSpec{
+							ProviderSpec: operatorv1.ProviderSpec{
+								Version: "v1.0.0",
+							},
+						},
+					},
+				},
+			},
+			expectedCondition: clusterv1.Condition{
+				Type:     operatorv1.PreflightCheckCondition,
+				Reason:   operatorv1.FetchConfigValidationErrorReason,
+				Severity: clusterv1.ConditionSeverityError,
+				Message:  "Either Selector, URL, Git or Helm must be provided for a not predefined provider",
+				Status:   corev1.ConditionFalse,
+			},
+			providerList: &genericprovider.CoreProviderListWrapper{
+				CoreProviderList: &operatorv1.CoreProviderList{},
+			},
+		},
+		{
+			name:          "Infrastructure Provider named after a known provider of another type, preflight check failed",
+			expectedError: true,
+			providers: []genericprovider.GenericProvider{
+				&genericprovider.InfrastructureProviderWrapper{
+					InfrastructureProvider: &operatorv1.InfrastructureProvider{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:      "kubeadm",
+							Namespace: namespaceName1,
+						},
+						TypeMeta: metav1.TypeMeta{
+							Kind:       "InfrastructureProvider",
+							APIVersion: "operator.cluster.x-k8s.io/v1alpha1",
+						},
+						Spec: operatorv1.InfrastructureProviderSpec{
+							ProviderSpec: operatorv1.ProviderSpec{
+								Version: "v1.0.0",
+							},
+						},
+					},
+				},
+			},
+			expectedCondition: clusterv1.Condition{
+				Type:     operatorv1.PreflightCheckCondition,
+				Reason:   operatorv1.ProviderTypeMismatchReason,
+				Severity: clusterv1.ConditionSeverityError,
+				Message:  "\"kubeadm\" is not a known InfrastructureProvider but a known BootstrapProvider, ControlPlaneProvider: check the kind of the provider, or set spec.fetchConfig for a custom provider",
+				Status:   corev1.ConditionFalse,
+			},
+			providerList: &genericprovider.InfrastructureProviderListWrapper{
+				InfrastructureProviderList: &operatorv1.InfrastructureProviderList{},
+			},
+		},
+		{
+			name:          "custom Infrastructure Provider with fetch config with empty values, preflight check failed",
+			expectedError: true,
+			providers: []genericprovider.GenericProvider{
+				&genericprovider.InfrastructureProviderWrapper{
+					InfrastructureProvider: &operatorv1.InfrastructureProvider{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:      "my-custom-aws",
+							Namespace: namespaceName1,
+						},
+						TypeMeta: metav1.TypeMeta{
+							Kind:       "InfrastructureProvider",
+							APIVersion: "operator.cluster.x-k8s.io/v1alpha1",
+						},
+						Spec: operatorv1.InfrastructureProviderSpec{
+							ProviderSpec: operatorv1.ProviderSpec{
+								Version: "v1.0.0",
+								FetchConfig: &operatorv1.FetchConfiguration{
+									URL:      "",
+									Selector: nil,
+								},
+							},
+						},
+					},
+				},
+			},
+			expectedCondition: clusterv1.Condition{
+				Type:     operatorv1.PreflightCheckCondition,
+				Reason:   operatorv1.FetchConfigValidationErrorReason,
+				Severity: clusterv1.ConditionSeverityError,
+				Message:  "Either Selector, URL, Git or Helm must be provided for a not predefined provider",
+				Status:   corev1.ConditionFalse,
+			},
+			providerList: &genericprovider.CoreProviderListWrapper{
+				CoreProviderList: &operatorv1.CoreProviderList{},
+			},
+		},
+		{
+			name: "core provider doesn't exist yet, waiting for it",
+			providers: []genericprovider.GenericProvider{
+				&genericprovider.InfrastructureProviderWrapper{
+					InfrastructureProvider: &operatorv1.InfrastructureProvider{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:      "aws",
+							Namespace: namespaceName1,
+						},
+						TypeMeta: metav1.TypeMeta{
+							Kind:       "InfrastructureProvider",
+							APIVersion: "operator.cluster.x-k8s.io/v1alpha1",
+						},
+						Spec: operatorv1.InfrastructureProviderSpec{
+							ProviderSpec: operatorv1.ProviderSpec{
+								Version: "v1.0.0",
+							},
+						},
+					},
+				},
+			},
+			expectedCondition: clusterv1.Condition{
+				Type:     operatorv1.PreflightCheckCondition,
+				Reason:   operatorv1.WaitingForCoreProviderReason,
+				Severity: clusterv1.ConditionSeverityInfo,
+				Message:  "Waiting for a CoreProvider to be created.",
+				Status:   corev1.ConditionFalse,
+			},
+			providerList: &genericprovider.InfrastructureProviderListWrapper{
+				InfrastructureProviderList: &operatorv1.InfrastructureProviderList{},
+			},
+		},
+		{
+			name: "core provider isn't ready yet, waiting for it",
+			providers: []genericprovider.GenericProvider{
+				&genericprovider.InfrastructureProviderWrapper{
+					InfrastructureProvider: &operatorv1.InfrastructureProvider{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:      "aws",
+							Namespace: namespaceName1,
+						},
+						TypeMeta: metav1.TypeMeta{
+							Kind:       "InfrastructureProvider",
+							APIVersion: "operator.cluster.x-k8s.io/v1alpha1",
+						},
+						Spec: operatorv1.InfrastructureProviderSpec{
+							ProviderSpec: operatorv1.ProviderSpec{
+								Version: "v1.0.0",
+							},
+						},
+					},
+				},
+				&genericprovider.CoreProviderWrapper{
+					CoreProvider: &operatorv1.CoreProvider{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:      "cluster-api",
+							Namespace: namespaceName2,
+						},
+						TypeMeta: metav1.TypeMeta{
+							Kind:       "CoreProvider",
+							APIVersion: "operator.cluster.x-k8s.io/v1alpha1",
+						},
+						Spec: operatorv1.CoreProviderSpec{
+							ProviderSpec: operatorv1.ProviderSpec{
+								Version: "v1.0.0",
+							},
+						},
+					},
+				},
+			},
+			expectedCondition: clusterv1.Condition{
+				Type:     operatorv1.PreflightCheckCondition,
+				Reason:   operatorv1.WaitingForCoreProviderReadyReason,
+				Severity: clusterv1.ConditionSeverityInfo,
+				Message:  "Waiting for the core provider to be installed.",
+				Status:   corev1.ConditionFalse,
+			},
+			providerList: &genericprovider.InfrastructureProviderListWrapper{
+				InfrastructureProviderList: &operatorv1.InfrastructureProviderList{},
+			},
+		},
+		{
+			name: "dependency isn't ready yet, waiting for it",
+			providers: []genericprovider.GenericProvider{
+				&genericprovider.InfrastructureProviderWrapper{
+					InfrastructureProvider: &operatorv1.InfrastructureProvider{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:      "aws",
+							Namespace: namespaceName1,
+						},
+						TypeMeta: metav1.TypeMeta{
+							Kind:       "InfrastructureProvider",
+							APIVersion: "operator.cluster.x-k8s.io/v1alpha1",
+						},
+						Spec: operatorv1.InfrastructureProviderSpec{
+							ProviderSpec: operatorv1.ProviderSpec{
+								Version:   "v1.0.0",
+								DependsOn: []operatorv1.ProviderDependency{{Kind: "BootstrapProvider", Name: "kubeadm", Namespace: namespaceName2}},
+							},
+						},
+					},
+				},
+				&genericprovider.CoreProviderWrapper{
+					CoreProvider: &operatorv1.CoreProvider{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:      "cluster-api",
+							Namespace: namespaceName2,
+						},
+						TypeMeta: metav1.TypeMeta{
+							Kind:       "CoreProvider",
+							APIVersion: "operator.cluster.x-k8s.io/v1alpha1",
+						},
+						Spec: operatorv1.CoreProviderSpec{
+							ProviderSpec: operatorv1.ProviderSpec{
+								Version: "v1.0.0",
+							},
+						},
+						Status: operatorv1.CoreProviderStatus{
+							ProviderStatus: operatorv1.ProviderStatus{
+								Conditions: clusterv1.Conditions{
+									{Type: clusterv1.ReadyCondition, Status: corev1.ConditionTrue},
+								},
+							},
+						},
+					},
+				},
+				&genericprovider.BootstrapProviderWrapper{
+					BootstrapProvider: &operatorv1.BootstrapProvider{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:      "kubeadm",
+							Namespace: namespaceName2,
+						},
+						TypeMeta: metav1.TypeMeta{
+							Kind:       "BootstrapProvider",
+							APIVersion: "operator.cluster.x-k8s.io/v1alpha1",
+						},
+						Spec: operatorv1.BootstrapProviderSpec{
+							ProviderSpec: operatorv1.ProviderSpec{
+								Version:   "v1.0.0",
+								DependsOn: []operatorv1.ProviderDependency{},
+							},
+						},
+					},
+				},
+			},
+			expectedCondition: clusterv1.Condition{
+				Type:     operatorv1.PreflightCheckCondition,
+				Reason:   operatorv1.WaitingForDependenciesReason,
+				Severity: clusterv1.ConditionSeverityInfo,
+				Message:  "Waiting for the dependencies to be ready: BootstrapProvider provider-test-ns-2/kubeadm",
+				Status:   corev1.ConditionFalse,
+			},
+			providerList: &genericprovider.InfrastructureProviderListWrapper{
+				InfrastructureProviderList: &operatorv1.InfrastructureProviderList{},
+			},
+		},
+		{
+			name:          "dependency cycle, preflight check failed",
+			expectedError: true,
+			providers: []genericprovider.GenericProvider{
+				&genericprovider.InfrastructureProviderWrapper{
+					InfrastructureProvider: &operatorv1.InfrastructureProvider{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:      "aws",
+							Namespace: namespaceName1,
+						},
+						TypeMeta: metav1.TypeMeta{
+							Kind:       "InfrastructureProvider",
+							APIVersion: "operator.cluster.x-k8s.io/v1alpha1",
+						},
+						Spec: operatorv1.InfrastructureProviderSpec{
+							ProviderSpec: operatorv1.ProviderSpec{
+								Version:   "v1.0.0",
+								DependsOn: []operatorv1.ProviderDependency{{Kind: "BootstrapProvider", Name: "kubeadm", Namespace: namespaceName2}},
+							},
+						},
+					},
+				},
+				&genericprovider.CoreProviderWrapper{
+					CoreProvider: &operatorv1.CoreProvider{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:      "cluster-api",
+							Namespace: namespaceName2,
+						},
+						TypeMeta: metav1.TypeMeta{
+							Kind:       "CoreProvider",
+							APIVersion: "operator.cluster.x-k8s.io/v1alpha1",
+						},
+						Spec: operatorv1.CoreProviderSpec{
+							ProviderSpec: operatorv1.ProviderSpec{
+								Version: "v1.0.0",
+							},
+						},
+						Status: operatorv1.CoreProviderStatus{
+							ProviderStatus: operatorv1.ProviderStatus{
+								Conditions: clusterv1.Conditions{
+									{Type: clusterv1.ReadyCondition, Status: corev1.ConditionTrue},
+								},
+							},
+						},
+					},
+				},
+				&genericprovider.BootstrapProviderWrapper{
+					BootstrapProvider: &operatorv1.BootstrapProvider{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:      "kubeadm",
+							Namespace: namespaceName2,
+						},
+						TypeMeta: metav1.TypeMeta{
+							Kind:       "BootstrapProvider",
+							APIVersion: "operator.cluster.x-k8s.io/v1alpha1",
+						},
+						Spec: operatorv1.BootstrapProviderSpec{
+							ProviderSpec: operatorv1.ProviderSpec{
+								Version:   "v1.0.0",
+								DependsOn: []operatorv1.ProviderDependency{{Kind: "InfrastructureProvider", Name: "aws", Namespace: namespaceName1}},
+							},
+						},
+					},
+				},
+			},
+			expectedCondition: clusterv1.Condition{
+				Type:     operatorv1.PreflightCheckCondition,
+				Reason:   operatorv1.DependencyCycleReason,
+				Severity: clusterv1.ConditionSeverityError,
+				Message:  "Dependency cycle: InfrastructureProvider provider-test-ns-1/aws -> BootstrapProvider provider-test-ns-2/kubeadm -> InfrastructureProvider provider-test-ns-1/aws",
+				Status:   corev1.ConditionFalse,
+			},
+			providerList: &genericprovider.InfrastructureProviderListWrapper{
+				InfrastructureProviderList: &operatorv1.InfrastructureProviderList{},
+			},
+		},
+		{
+			name:          "more than one core provider exists, preflight check failed",
+			expectedError: true,
+			providers: []genericprovider.GenericProvider{
+				&genericprovider.InfrastructureProviderWrapper{
+					InfrastructureProvider: &operatorv1.InfrastructureProvider{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:      "aws",
+							Namespace: namespaceName1,
+						},
+						TypeMeta: metav1.TypeMeta{
+							Kind:       "InfrastructureProvider",
+							APIVersion: "operator.cluster.x-k8s.io/v1alpha1",
+						},
+						Spec: operatorv1.InfrastructureProviderSpec{
+							ProviderSpec: operatorv1.ProviderSpec{
+								Version: "v1.0.0",
+							},
+						},
+					},
+				},
+				&genericprovider.CoreProviderWrapper{
+					CoreProvider: &operatorv1.CoreProvider{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:      "cluster-api",
+							Namespace: namespaceName1,
+						},
+						TypeMeta: metav1.TypeMeta{
+							Kind:       "CoreProvider",
+							APIVersion: "operator.cluster.x-k8s.io/v1alpha1",
+						},
+						Spec: operatorv1.CoreProviderSpec{
+							ProviderSpec: operatorv1.ProviderSpec{
+								Version: "v1.0.0",
+							},
+						},
+					},
+				},
+				&genericprovider.CoreProviderWrapper{
+					CoreProvider: &operatorv1.CoreProvider{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:      "cluster-api",
+							Namespace: namespaceName2,
+						},
+						TypeMeta: metav1.TypeMeta{
+							Kind:       "CoreProvider",
+							APIVersion: "operator.cluster.x-k8s.io/v1alpha1",
+						},
+						Spec: operatorv1.CoreProviderSpec{
+							ProviderSpec: operatorv1.ProviderSpec{
+								Version: "v1.0.0",
+							},
+						},
+					},
+				},
+			},
+			expectedCondition: clusterv1.Condition{
+				Type:     operatorv1.PreflightCheckCondition,
+				Reason:   operatorv1.MoreThanOneProviderInstanceExistsReason,
+				Severity: clusterv1.ConditionSeverityError,
+				Message:  "Found 2 CoreProviders in the cluster. Only one is allowed.",
+				Status:   corev1.ConditionFalse,
+			},
+			providerList: &genericprovider.InfrastructureProviderListWrapper{
+				InfrastructureProviderList: &operatorv1.InfrastructureProviderList{},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			gs := NewWithT(t)
+
+			fakeclient := fake.NewClientBuilder().WithObjects().Build()
+
+			for _, c := range tc.providers {
+				gs.Expect(fakeclient.Create(ctx, c.GetObject())).To(Succeed())
+			}
+
+			_, err := preflightChecks(context.Background(), fakeclient, tc.providers[0], tc.providerList, preflightFailedRequeueAfter, false)
+			if tc.expectedError {
+				gs.Expect(err).To(HaveOccurred())
+			} else {
+				gs.Expect(err).ToNot(HaveOccurred())
+			}
+
+			// Check if proper condition is returned
+			gs.Expect(tc.providers[0].GetStatus().Conditions).To(HaveLen(1))
+			gs.Expect(tc.providers[0].GetStatus().Conditions[0].Type).To(Equal(tc.expectedCondition.Type))
 			gs.Expect(tc.providers[0].GetStatus().Conditions[0].Status).To(Equal(tc.expectedCondition.Status))
 			gs.Expect(tc.providers[0].GetStatus().Conditions[0].Message).To(Equal(tc.expectedCondition.Message))
 			gs.Expect(tc.providers[0].GetStatus().Conditions[0].Severity).To(Equal(tc.expectedCondition.Severity))
 		})
 	}
 }
+
+func TestPreflightChecksMultipleInstances(t *testing.T) {
+	coreProvider := &operatorv1.CoreProvider{
+		ObjectMeta: metav1.ObjectMeta{Name: "cluster-api", Namespace: "capi-system"},
+		TypeMeta:   metav1.TypeMeta{Kind: "CoreProvider", APIVersion: operatorv1.GroupVersion.String()},
+		Spec:       operatorv1.CoreProviderSpec{ProviderSpec: operatorv1.ProviderSpec{Version: "v1.5.1"}},
+		Status: operatorv1.CoreProviderStatus{
+			ProviderStatus: operatorv1.ProviderStatus{
+				Conditions: []clusterv1.Condition{{Type: clusterv1.ReadyCondition, Status: corev1.ConditionTrue, LastTransitionTime: metav1.Now()}},
+			},
+		},
+	}
+
+	// newUpgradingProvider returns an infrastructure provider upgrading from v1.0.0 to v1.1.0.
+	newUpgradingProvider := func(name, namespace string) *genericprovider.InfrastructureProviderWrapper {
+		return &genericprovider.InfrastructureProviderWrapper{
+			InfrastructureProvider: &operatorv1.InfrastructureProvider{
+				ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+				TypeMeta:   metav1.TypeMeta{Kind: "InfrastructureProvider", APIVersion: operatorv1.GroupVersion.String()},
+				Spec:       operatorv1.InfrastructureProviderSpec{ProviderSpec: operatorv1.ProviderSpec{Version: "v1.1.0"}},
+				Status: operatorv1.InfrastructureProviderStatus{
+					ProviderStatus: operatorv1.ProviderStatus{InstalledVersion: pointer.String("v1.0.0")},
+				},
+			},
+		}
+	}
+
+	testCases := []struct {
+		name                    string
+		providers               []*genericprovider.InfrastructureProviderWrapper
+		skipSingleInstanceCheck bool
+		expectedError           bool
+	}{
+		{
+			name:      "two infra providers upgrading",
+			providers: []*genericprovider.InfrastructureProviderWrapper{newUpgradingProvider("aws", "capa-system"), newUpgradingProvider("vsphere", "capv-system")},
+		},
+		{
+			name:          "two instances of the same infra provider upgrading",
+			providers:     []*genericprovider.InfrastructureProviderWrapper{newUpgradingProvider("aws", "tenant-a"), newUpgradingProvider("aws", "tenant-b")},
+			expectedError: true,
+		},
+		{
+			name:                    "two instances of the same infra provider upgrading with the check skipped",
+			providers:               []*genericprovider.InfrastructureProviderWrapper{newUpgradingProvider("aws", "tenant-a"), newUpgradingProvider("aws", "tenant-b")},
+			skipSingleInstanceCheck: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			fakeclient := fake.NewClientBuilder().WithObjects(coreProvider.DeepCopy()).Build()
+
+			for _, p := range tc.providers {
+				g.Expect(fakeclient.Create(ctx, p.GetObject())).To(Succeed())
+			}
+
+			for _, p := range tc.providers {
+				_, err := preflightChecks(context.Background(), fakeclient, p, &genericprovider.InfrastructureProviderListWrapper{
+					InfrastructureProviderList: &operatorv1.InfrastructureProviderList{},
+				}, preflightFailedRequeueAfter, tc.skipSingleInstanceCheck)
+
+				if tc.expectedError {
+					g.Expect(err).To(HaveOccurred())
+					g.Expect(conditions.GetReason(p, operatorv1.PreflightCheckCondition)).To(Equal(operatorv1.MoreThanOneProviderInstanceExistsReason))
+
+					continue
+				}
+
+				g.Expect(err).ToNot(HaveOccurred())
+				g.Expect(conditions.IsTrue(p, operatorv1.PreflightCheckCondition)).To(BeTrue())
+			}
+		})
+	}
+
+	t.Run("two core providers with the check skipped", func(t *testing.T) {
+		g := NewWithT(t)
+
+		other := coreProvider.DeepCopy()
+		other.Namespace = "tenant-a"
+
+		fakeclient := fake.NewClientBuilder().WithObjects(coreProvider.DeepCopy(), other).Build()
+
+		provider := &genericprovider.CoreProviderWrapper{CoreProvider: other}
+
+		_, err := preflightChecks(context.Background(), fakeclient, provider, &genericprovider.CoreProviderListWrapper{
+			CoreProviderList: &operatorv1.CoreProviderList{},
+		}, preflightFailedRequeueAfter, true)
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(conditions.GetReason(provider, operatorv1.PreflightCheckCondition)).To(Equal(operatorv1.MoreThanOneProviderInstanceExistsReason))
+	})
+}
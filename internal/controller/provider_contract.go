@@ -0,0 +1,313 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	versionutil "k8s.io/apimachinery/pkg/util/version"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	clusterctlv1 "sigs.k8s.io/cluster-api/cmd/clusterctl/api/v1alpha3"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	operatorv1 "sigs.k8s.io/cluster-api-operator/api/v1alpha2"
+	"sigs.k8s.io/cluster-api-operator/internal/controller/genericprovider"
+	"sigs.k8s.io/cluster-api-operator/util"
+)
+
+// errMetadataNotFetched is returned by providerMetadata if the metadata of the provider version wasn't fetched yet.
+var errMetadataNotFetched = errors.New("metadata not fetched yet")
+
+const (
+	contractSkewToleratedMessage = "Provider abides by contract %s, tolerated by its contract policy, while the core provider abides by contract %s."
+	contractMismatchMessage      = "Provider %s version %s requires contract %s, while the core provider abides by contract %s." +
+		" Add %s to spec.contractPolicy.toleratedContracts, or set the %s annotation to \"true\", to install it anyway"
+	operatorVersionTooOldMessage = "Provider %s version %s requires operator version %s or later, while the running operator is version %s." +
+		" Upgrade the operator, or pick an older provider version"
+)
+
+// IsContractAllowed returns true if a provider abiding by the contract can run next to a core provider abiding
+// by coreContract, i.e. if the contracts match or the contract is tolerated by the provider contract policy.
+func IsContractAllowed(provider genericprovider.GenericProvider, contract, coreContract string) bool {
+	return contract == coreContract || isToleratedContract(provider, contract)
+}
+
+// isToleratedContract returns true if the contract is listed in the provider contract policy.
+func isToleratedContract(provider genericprovider.GenericProvider, contract string) bool {
+	policy := provider.GetSpec().ContractPolicy
+	if policy == nil {
+		return false
+	}
+
+	for _, c := range policy.ToleratedContracts {
+		if c == contract {
+			return true
+		}
+	}
+
+	return false
+}
+
+// checkCoreProviderContract validates the contract of the provider against the one of the core provider, as the
+// webhook does when the provider is applied. A mismatch fails with both contracts in the error, unless the contract
+// is tolerated by the provider contract policy, which is reported with the ContractSkewTolerated condition, or the
+// skip contract validation annotation is set.
+func (p *phaseReconciler) checkCoreProviderContract(ctx context.Context) error {
+	if util.IsCoreProvider(p.provider) {
+		conditions.Delete(p.provider, operatorv1.ContractSkewToleratedCondition)
+
+		return nil
+	}
+
+	coreContract, err := getCoreProviderContract(ctx, p.ctrlClient)
+	if err != nil {
+		return fmt.Errorf("failed to get the core provider contract: %w", err)
+	}
+
+	if coreContract == "" || coreContract == p.contract {
+		conditions.Delete(p.provider, operatorv1.ContractSkewToleratedCondition)
+
+		return nil
+	}
+
+	if !isToleratedContract(p.provider, p.contract) {
+		conditions.Delete(p.provider, operatorv1.ContractSkewToleratedCondition)
+
+		if p.provider.GetAnnotations()[operatorv1.SkipContractValidationAnnotation] == "true" {
+			ctrl.LoggerFrom(ctx).Info("Provider contract doesn't match the core provider one, validation skipped", "contract", p.contract, "coreContract", coreContract)
+
+			return nil
+		}
+
+		return fmt.Errorf(contractMismatchMessage, p.provider.GetName(), p.options.Version, p.contract, coreContract,
+			p.contract, operatorv1.SkipContractValidationAnnotation)
+	}
+
+	ctrl.LoggerFrom(ctx).Info("Provider contract doesn't match the core provider one, but is tolerated", "contract", p.contract, "coreContract", coreContract)
+
+	conditions.Set(p.provider, &clusterv1.Condition{
+		Type:    operatorv1.ContractSkewToleratedCondition,
+		Status:  corev1.ConditionTrue,
+		Reason:  operatorv1.ToleratedContractReason,
+		Message: fmt.Sprintf(contractSkewToleratedMessage, p.contract, coreContract),
+	})
+
+	return nil
+}
+
+// checkOperatorVersion returns an error if the metadata of the provider version requires a newer operator than the
+// running one, with the minimum operator version annotation. The check is skipped if the operator version isn't a
+// semantic version, e.g. in development builds.
+func (p *phaseReconciler) checkOperatorVersion(ctx context.Context, metadata *clusterctlv1.Metadata) error {
+	required := metadata.GetAnnotations()[operatorv1.MinimumOperatorVersionAnnotation]
+	if required == "" {
+		return nil
+	}
+
+	minimum, err := versionutil.ParseSemantic(required)
+	if err != nil {
+		return fmt.Errorf("invalid minimum operator version %q in the metadata of provider %q: %w", required, p.provider.GetName(), err)
+	}
+
+	running, err := versionutil.ParseSemantic(p.operatorVersion)
+	if err != nil {
+		ctrl.LoggerFrom(ctx).Info("Operator version is not a semantic version, skipping the minimum operator version check",
+			"operatorVersion", p.operatorVersion, "minimumOperatorVersion", required)
+
+		return nil
+	}
+
+	if running.LessThan(minimum) {
+		return fmt.Errorf(operatorVersionTooOldMessage, p.provider.GetName(), p.options.Version, required, p.operatorVersion)
+	}
+
+	return nil
+}
+
+// CoreProviderContract returns the contract of the installed core provider, or an empty string
+// if it's not installed yet.
+func CoreProviderContract(ctx context.Context, c client.Client) (string, error) {
+	return getCoreProviderContract(ctx, c)
+}
+
+// ProviderContract returns the contract the provider version abides by, so it can be validated before the
+// provider is reconciled. Nothing is fetched, e.g. from Git, Helm or a release URL, so an empty string is returned
+// if the metadata of the version wasn't fetched yet, as well as if the version is not set or is a patch wildcard.
+// The contract is then validated at reconcile time.
+func ProviderContract(ctx context.Context, c client.Client, provider genericprovider.GenericProvider) (string, error) {
+	spec := provider.GetSpec()
+
+	if spec.Version == "" || isVersionWildcard(spec.Version) {
+		return "", nil
+	}
+
+	version, err := versionutil.ParseSemantic(spec.Version)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse version %q of provider %q: %w", spec.Version, provider.GetName(), err)
+	}
+
+	p := newPhaseReconciler(GenericProviderReconciler{Client: c}, provider, nil)
+
+	if _, err := p.initializePhaseReconciler(ctx); err != nil {
+		return "", err
+	}
+
+	file, err := p.providerMetadata(ctx)
+	if errors.Is(err, errMetadataNotFetched) {
+		return "", nil
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	metadata, err := decodeMetadata(file)
+	if err != nil {
+		return "", fmt.Errorf("error decoding metadata for provider %q: %w", provider.GetName(), err)
+	}
+
+	contracts := versionContracts(metadata, version)
+	if len(contracts) == 0 {
+		return "", fmt.Errorf("version %s of provider %q is not part of any release series in its metadata", spec.Version, provider.GetName())
+	}
+
+	return resolveContract(ctx, c, provider, contracts)
+}
+
+// versionContracts returns the contracts the version abides by according to the metadata, in the order they are
+// listed. Transitional release series may be listed once per contract, e.g. when a minor release abides by both
+// the previous and the next contract.
+func versionContracts(metadata *clusterctlv1.Metadata, version *versionutil.Version) []string {
+	contracts := []string{}
+
+	for _, releaseSeries := range metadata.ReleaseSeries {
+		if releaseSeries.Major != version.Major() || releaseSeries.Minor != version.Minor() {
+			continue
+		}
+
+		if !slices.Contains(contracts, releaseSeries.Contract) {
+			contracts = append(contracts, releaseSeries.Contract)
+		}
+	}
+
+	return contracts
+}
+
+// resolveContract picks the contract the provider abides by among the ones its version claims. The management
+// cluster is only looked up when the version claims more than one contract.
+func resolveContract(ctx context.Context, c client.Client, provider genericprovider.GenericProvider, contracts []string) (string, error) {
+	if len(contracts) == 1 {
+		return contracts[0], nil
+	}
+
+	managementContract := clusterv1.GroupVersion.Version
+
+	if !util.IsCoreProvider(provider) {
+		coreContract, err := getCoreProviderContract(ctx, c)
+		if err != nil {
+			return "", fmt.Errorf("failed to get the core provider contract: %w", err)
+		}
+
+		if coreContract != "" {
+			managementContract = coreContract
+		}
+	}
+
+	return pickContract(provider, contracts, managementContract), nil
+}
+
+// pickContract returns the contract of the management cluster if it's one of the contracts, i.e. the one of the core
+// provider or, for the core provider itself and while it's not installed, the one of the operator. Otherwise the
+// first contract tolerated by the provider contract policy, or the first one listed, is returned.
+func pickContract(provider genericprovider.GenericProvider, contracts []string, managementContract string) string {
+	if slices.Contains(contracts, managementContract) {
+		return managementContract
+	}
+
+	for _, contract := range contracts {
+		if isToleratedContract(provider, contract) {
+			return contract
+		}
+	}
+
+	return contracts[0]
+}
+
+// contractsList returns the contracts as a comma separated list.
+func contractsList(contracts []string) string {
+	return strings.Join(contracts, ", ")
+}
+
+// providerMetadata returns the metadata of the provider version, if it's available without fetching anything:
+// from the metadata override, the custom ConfigMaps, or the manifests cached in memory or in ConfigMaps. Otherwise
+// errMetadataNotFetched is returned, as the metadata is only fetched by the reconciliation.
+func (p *phaseReconciler) providerMetadata(ctx context.Context) ([]byte, error) {
+	spec := p.provider.GetSpec()
+
+	if p.metadataOverride != nil {
+		return p.metadataOverride, nil
+	}
+
+	// Custom ConfigMaps are the only source of the manifests.
+	if spec.FetchConfig != nil && spec.FetchConfig.Selector != nil {
+		return p.configMapMetadata(ctx, spec.FetchConfig.Selector)
+	}
+
+	var err error
+
+	p.sourceHash, err = p.manifestsSourceHash(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if metadata, _, ok := sharedManifestsCache.get(p.manifestsCacheKey()); ok {
+		return metadata, nil
+	}
+
+	labelSelector := metav1.LabelSelector{
+		MatchLabels: p.prepareConfigMapLabels(),
+	}
+
+	exists, err := p.checkConfigMapExists(ctx, labelSelector)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check that config map with manifests exists: %w", err)
+	}
+
+	if !exists {
+		return nil, errMetadataNotFetched
+	}
+
+	return p.configMapMetadata(ctx, &labelSelector)
+}
+
+// configMapMetadata returns the metadata of the provider version from the ConfigMaps matching the selector.
+func (p *phaseReconciler) configMapMetadata(ctx context.Context, labelSelector *metav1.LabelSelector) ([]byte, error) {
+	repo, err := p.configmapRepository(ctx, labelSelector)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the repository for provider %q: %w", p.provider.GetName(), err)
+	}
+
+	return repo.GetFile(p.provider.GetSpec().Version, metadataFile)
+}
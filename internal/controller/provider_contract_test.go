@@ -0,0 +1,506 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	versionutil "k8s.io/apimachinery/pkg/util/version"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/cluster-api/cmd/clusterctl/client/repository"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	operatorv1 "sigs.k8s.io/cluster-api-operator/api/v1alpha2"
+	"sigs.k8s.io/cluster-api-operator/internal/controller/genericprovider"
+)
+
+// testTransitionalContractMetadata lists the 2.2 release series once per contract it abides by.
+const testTransitionalContractMetadata = `apiVersion: clusterctl.cluster.x-k8s.io/v1alpha3
+kind: Metadata
+releaseSeries:
+- major: 2
+  minor: 2
+  contract: v1beta2
+- major: 2
+  minor: 2
+  contract: v1beta1
+- major: 2
+  minor: 1
+  contract: v1beta1
+`
+
+const testContractMetadata = `apiVersion: clusterctl.cluster.x-k8s.io/v1alpha3
+kind: Metadata
+releaseSeries:
+- major: 2
+  minor: 1
+  contract: v1beta1
+- major: 0
+  minor: 7
+  contract: v1alpha4
+`
+
+func TestProviderContract(t *testing.T) {
+	scheme := runtime.NewScheme()
+	utilruntime.Must(corev1.AddToScheme(scheme))
+	utilruntime.Must(operatorv1.AddToScheme(scheme))
+
+	newProvider := func(version string) *genericprovider.InfrastructureProviderWrapper {
+		return &genericprovider.InfrastructureProviderWrapper{
+			InfrastructureProvider: &operatorv1.InfrastructureProvider{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "aws",
+					Namespace: "capa-system",
+				},
+				Spec: operatorv1.InfrastructureProviderSpec{
+					ProviderSpec: operatorv1.ProviderSpec{
+						Version: version,
+					},
+				},
+			},
+		}
+	}
+
+	t.Run("version not set", func(t *testing.T) {
+		g := NewWithT(t)
+
+		c := fake.NewClientBuilder().WithScheme(scheme).Build()
+
+		contract, err := ProviderContract(context.Background(), c, newProvider(""))
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(contract).To(BeEmpty())
+	})
+
+	t.Run("metadata from the downloaded manifests ConfigMap", func(t *testing.T) {
+		g := NewWithT(t)
+
+		provider := newProvider("v0.7.2")
+
+		p := newPhaseReconciler(GenericProviderReconciler{Client: fake.NewClientBuilder().WithScheme(scheme).Build()}, provider, nil)
+		_, err := p.initializePhaseReconciler(context.Background())
+		g.Expect(err).ToNot(HaveOccurred())
+
+		sourceHash, err := p.manifestsSourceHash(context.Background())
+		g.Expect(err).ToNot(HaveOccurred())
+
+		configMap := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "infrastructure-aws-v0.7.2",
+				Namespace:   "capa-system",
+				Labels:      p.prepareConfigMapLabels(),
+				Annotations: map[string]string{sourceHashAnnotation: sourceHash},
+			},
+			Data: map[string]string{
+				metadataConfigMapKey:   testContractMetadata,
+				componentsConfigMapKey: "",
+			},
+		}
+
+		c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(configMap).Build()
+
+		contract, err := ProviderContract(context.Background(), c, provider)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(contract).To(Equal("v1alpha4"))
+	})
+
+	t.Run("metadata from the manifests cache", func(t *testing.T) {
+		g := NewWithT(t)
+
+		provider := newProvider("v2.1.4")
+		c := fake.NewClientBuilder().WithScheme(scheme).Build()
+
+		p := newPhaseReconciler(GenericProviderReconciler{Client: c}, provider, nil)
+		_, err := p.initializePhaseReconciler(context.Background())
+		g.Expect(err).ToNot(HaveOccurred())
+
+		key := p.manifestsCacheKey()
+		sharedManifestsCache.set(key, []byte(testContractMetadata), []byte(""))
+
+		defer func() {
+			sharedManifestsCache.mu.Lock()
+			delete(sharedManifestsCache.entries, key)
+			sharedManifestsCache.mu.Unlock()
+		}()
+
+		contract, err := ProviderContract(context.Background(), c, provider)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(contract).To(Equal("v1beta1"))
+	})
+
+	t.Run("metadata not fetched yet", func(t *testing.T) {
+		g := NewWithT(t)
+
+		c := fake.NewClientBuilder().WithScheme(scheme).Build()
+
+		// Neither the Git repository nor the release URL are fetched.
+		gitProvider := newProvider("v2.1.4")
+		gitProvider.Spec.FetchConfig = &operatorv1.FetchConfiguration{
+			Git: &operatorv1.GitSource{URL: "https://github.com/owner/repo.git"},
+		}
+
+		urlProvider := newProvider("v2.1.4")
+		urlProvider.Spec.FetchConfig = &operatorv1.FetchConfiguration{
+			URL: "https://example.com/releases/v2.1.4/infrastructure-components.tar.gz",
+		}
+
+		for _, provider := range []*genericprovider.InfrastructureProviderWrapper{gitProvider, urlProvider, newProvider("v2.1.4")} {
+			contract, err := ProviderContract(context.Background(), c, provider)
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(contract).To(BeEmpty())
+		}
+	})
+
+	t.Run("version not in the release series", func(t *testing.T) {
+		g := NewWithT(t)
+
+		provider := newProvider("v1.5.0")
+		provider.Spec.FetchConfig = &operatorv1.FetchConfiguration{
+			Selector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{"provider-components": "aws"},
+			},
+		}
+		configMap := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "v1.5.0",
+				Namespace: "capa-system",
+				Labels:    map[string]string{"provider-components": "aws"},
+			},
+			Data: map[string]string{
+				metadataConfigMapKey:   testContractMetadata,
+				componentsConfigMapKey: "",
+			},
+		}
+
+		c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(configMap).Build()
+
+		_, err := ProviderContract(context.Background(), c, provider)
+		g.Expect(err).To(HaveOccurred())
+	})
+}
+
+func TestResolveContract(t *testing.T) {
+	metadata, err := decodeMetadata([]byte(testTransitionalContractMetadata))
+	NewWithT(t).Expect(err).ToNot(HaveOccurred())
+
+	testCases := []struct {
+		name               string
+		version            string
+		core               bool
+		coreContract       string
+		toleratedContracts []string
+		expectedContracts  []string
+		expectedContract   string
+	}{
+		{
+			name:              "single contract",
+			version:           "v2.1.3",
+			expectedContracts: []string{"v1beta1"},
+			expectedContract:  "v1beta1",
+		},
+		{
+			name:              "transitional series matching the core provider",
+			version:           "v2.2.0",
+			coreContract:      "v1beta2",
+			expectedContracts: []string{"v1beta2", "v1beta1"},
+			expectedContract:  "v1beta2",
+		},
+		{
+			name:              "transitional series matching the previous contract of the core provider",
+			version:           "v2.2.0",
+			coreContract:      "v1beta1",
+			expectedContracts: []string{"v1beta2", "v1beta1"},
+			expectedContract:  "v1beta1",
+		},
+		{
+			name:              "transitional series without core provider defaults to the operator contract",
+			version:           "v2.2.0",
+			expectedContracts: []string{"v1beta2", "v1beta1"},
+			expectedContract:  "v1beta1",
+		},
+		{
+			name:              "core provider with a transitional series",
+			version:           "v2.2.0",
+			core:              true,
+			coreContract:      "v1beta2",
+			expectedContracts: []string{"v1beta2", "v1beta1"},
+			expectedContract:  "v1beta1",
+		},
+		{
+			name:               "transitional series with a tolerated contract",
+			version:            "v2.2.0",
+			coreContract:       "v1alpha4",
+			toleratedContracts: []string{"v1beta1"},
+			expectedContracts:  []string{"v1beta2", "v1beta1"},
+			expectedContract:   "v1beta1",
+		},
+		{
+			name:              "transitional series matching no contract",
+			version:           "v2.2.0",
+			coreContract:      "v1alpha4",
+			expectedContracts: []string{"v1beta2", "v1beta1"},
+			expectedContract:  "v1beta2",
+		},
+		{
+			name:              "version not in the release series",
+			version:           "v1.0.0",
+			expectedContracts: []string{},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			objs := []client.Object{}
+			if tc.coreContract != "" {
+				objs = append(objs, &operatorv1.CoreProvider{
+					ObjectMeta: metav1.ObjectMeta{Name: "cluster-api", Namespace: "capi-system"},
+					Status: operatorv1.CoreProviderStatus{
+						ProviderStatus: operatorv1.ProviderStatus{Contract: pointer.String(tc.coreContract)},
+					},
+				})
+			}
+
+			c := fake.NewClientBuilder().WithScheme(setupScheme()).WithObjects(objs...).Build()
+
+			var provider genericprovider.GenericProvider = &genericprovider.InfrastructureProviderWrapper{
+				InfrastructureProvider: &operatorv1.InfrastructureProvider{
+					ObjectMeta: metav1.ObjectMeta{Name: "aws", Namespace: "capa-system"},
+				},
+			}
+			if tc.core {
+				provider = &genericprovider.CoreProviderWrapper{
+					CoreProvider: &operatorv1.CoreProvider{
+						ObjectMeta: metav1.ObjectMeta{Name: "cluster-api", Namespace: "capi-system"},
+					},
+				}
+			}
+
+			if tc.toleratedContracts != nil {
+				spec := provider.GetSpec()
+				spec.ContractPolicy = &operatorv1.ContractPolicy{ToleratedContracts: tc.toleratedContracts}
+				provider.SetSpec(spec)
+			}
+
+			contracts := versionContracts(metadata, versionutil.MustParseSemantic(tc.version))
+			g.Expect(contracts).To(Equal(tc.expectedContracts))
+
+			if len(contracts) == 0 {
+				return
+			}
+
+			contract, err := resolveContract(context.Background(), c, provider, contracts)
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(contract).To(Equal(tc.expectedContract))
+		})
+	}
+}
+
+func TestCheckCoreProviderContract(t *testing.T) {
+	scheme := runtime.NewScheme()
+	utilruntime.Must(operatorv1.AddToScheme(scheme))
+
+	coreProvider := &operatorv1.CoreProvider{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "cluster-api",
+			Namespace: "capi-system",
+		},
+		Status: operatorv1.CoreProviderStatus{
+			ProviderStatus: operatorv1.ProviderStatus{
+				Contract: pointer.String("v1alpha4"),
+			},
+		},
+	}
+
+	testCases := []struct {
+		name              string
+		objs              []client.Object
+		contract          string
+		tolerated         []string
+		annotations       map[string]string
+		expectedCondition bool
+		expectedError     string
+	}{
+		{
+			name:      "contract matches the core provider one",
+			objs:      []client.Object{coreProvider},
+			contract:  "v1alpha4",
+			tolerated: []string{"v1alpha4", "v1beta1"},
+		},
+		{
+			name:              "contract tolerated by the contract policy",
+			objs:              []client.Object{coreProvider},
+			contract:          "v1beta1",
+			tolerated:         []string{"v1beta1"},
+			expectedCondition: true,
+		},
+		{
+			name:     "contract not tolerated by the contract policy",
+			objs:     []client.Object{coreProvider},
+			contract: "v1beta1",
+			expectedError: "Provider aws version v2.2.0 requires contract v1beta1, while the core provider abides by contract v1alpha4." +
+				" Add v1beta1 to spec.contractPolicy.toleratedContracts, or set the operator.cluster.x-k8s.io/skip-contract-validation" +
+				" annotation to \"true\", to install it anyway",
+		},
+		{
+			name:        "contract validation skipped",
+			objs:        []client.Object{coreProvider},
+			contract:    "v1beta1",
+			annotations: map[string]string{operatorv1.SkipContractValidationAnnotation: "true"},
+		},
+		{
+			name:      "core provider not installed yet",
+			contract:  "v1beta1",
+			tolerated: []string{"v1beta1"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			p := &phaseReconciler{
+				ctrlClient: fake.NewClientBuilder().WithScheme(scheme).WithObjects(tc.objs...).Build(),
+				provider: &genericprovider.InfrastructureProviderWrapper{
+					InfrastructureProvider: &operatorv1.InfrastructureProvider{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:        "aws",
+							Namespace:   "capa-system",
+							Annotations: tc.annotations,
+						},
+						Spec: operatorv1.InfrastructureProviderSpec{
+							ProviderSpec: operatorv1.ProviderSpec{
+								ContractPolicy: &operatorv1.ContractPolicy{ToleratedContracts: tc.tolerated},
+							},
+						},
+					},
+				},
+				contract: tc.contract,
+				options:  repository.ComponentsOptions{Version: "v2.2.0"},
+			}
+
+			// A stale condition is removed when the contract is not tolerated anymore.
+			conditions.MarkTrue(p.provider, operatorv1.ContractSkewToleratedCondition)
+
+			err := p.checkCoreProviderContract(context.Background())
+			if tc.expectedError != "" {
+				g.Expect(err).To(MatchError(tc.expectedError))
+			} else {
+				g.Expect(err).ToNot(HaveOccurred())
+			}
+
+			g.Expect(conditions.Has(p.provider, operatorv1.ContractSkewToleratedCondition)).To(Equal(tc.expectedCondition))
+
+			if tc.expectedCondition {
+				g.Expect(conditions.GetReason(p.provider, operatorv1.ContractSkewToleratedCondition)).To(Equal(operatorv1.ToleratedContractReason))
+				g.Expect(conditions.GetMessage(p.provider, operatorv1.ContractSkewToleratedCondition)).To(ContainSubstring("contract v1alpha4"))
+			}
+		})
+	}
+}
+
+func TestCheckOperatorVersion(t *testing.T) {
+	metadata := `apiVersion: clusterctl.cluster.x-k8s.io/v1alpha3
+kind: Metadata
+metadata:
+  annotations:
+    operator.cluster.x-k8s.io/minimum-operator-version: %s
+releaseSeries:
+- major: 2
+  minor: 2
+  contract: v1beta1
+`
+
+	testCases := []struct {
+		name            string
+		metadata        string
+		operatorVersion string
+		expectedErr     string
+	}{
+		{
+			name:            "no minimum operator version",
+			metadata:        testTransitionalContractMetadata,
+			operatorVersion: "v0.4.0",
+		},
+		{
+			name:            "operator is recent enough",
+			metadata:        fmt.Sprintf(metadata, "v0.5.0"),
+			operatorVersion: "v0.5.1",
+		},
+		{
+			name:            "operator is too old",
+			metadata:        fmt.Sprintf(metadata, "v0.5.0"),
+			operatorVersion: "v0.4.0",
+			expectedErr: "Provider aws version v2.2.0 requires operator version v0.5.0 or later, while the running operator is version v0.4.0." +
+				" Upgrade the operator, or pick an older provider version",
+		},
+		{
+			name:            "pre-release of the minimum operator version is too old",
+			metadata:        fmt.Sprintf(metadata, "v0.5.0"),
+			operatorVersion: "v0.5.0-rc.1",
+			expectedErr: "Provider aws version v2.2.0 requires operator version v0.5.0 or later, while the running operator is version v0.5.0-rc.1." +
+				" Upgrade the operator, or pick an older provider version",
+		},
+		{
+			name:     "development builds are not checked",
+			metadata: fmt.Sprintf(metadata, "v0.5.0"),
+		},
+		{
+			name:            "invalid minimum operator version",
+			metadata:        fmt.Sprintf(metadata, "latest"),
+			operatorVersion: "v0.4.0",
+			expectedErr:     `invalid minimum operator version "latest" in the metadata of provider "aws": could not parse "latest" as version`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			p := &phaseReconciler{
+				ctrlClient: fake.NewClientBuilder().Build(),
+				provider: &genericprovider.InfrastructureProviderWrapper{
+					InfrastructureProvider: &operatorv1.InfrastructureProvider{
+						ObjectMeta: metav1.ObjectMeta{Name: "aws", Namespace: "capa-system"},
+					},
+				},
+				repo:            repository.NewMemoryRepository().WithFile("v2.2.0", metadataFile, []byte(tc.metadata)),
+				options:         repository.ComponentsOptions{Version: "v2.2.0"},
+				operatorVersion: tc.operatorVersion,
+			}
+
+			err := p.validateRepoCAPIVersion(context.Background())
+			if tc.expectedErr == "" {
+				g.Expect(err).ToNot(HaveOccurred())
+
+				return
+			}
+
+			g.Expect(err).To(MatchError(tc.expectedErr))
+			g.Expect(wrapPhaseError(err, operatorv1.ContractMismatchReason).(*PhaseError).Reason).To(Equal(operatorv1.OperatorVersionTooOldReason))
+		})
+	}
+}
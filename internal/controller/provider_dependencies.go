@@ -0,0 +1,165 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	operatorv1 "sigs.k8s.io/cluster-api-operator/api/v1alpha2"
+	"sigs.k8s.io/cluster-api-operator/internal/controller/genericprovider"
+)
+
+// newProviderOfKind returns an empty provider of the given kind.
+func newProviderOfKind(kind string) (genericprovider.GenericProvider, error) {
+	switch kind {
+	case "CoreProvider":
+		return &genericprovider.CoreProviderWrapper{CoreProvider: &operatorv1.CoreProvider{}}, nil
+	case "BootstrapProvider":
+		return &genericprovider.BootstrapProviderWrapper{BootstrapProvider: &operatorv1.BootstrapProvider{}}, nil
+	case "ControlPlaneProvider":
+		return &genericprovider.ControlPlaneProviderWrapper{ControlPlaneProvider: &operatorv1.ControlPlaneProvider{}}, nil
+	case "InfrastructureProvider":
+		return &genericprovider.InfrastructureProviderWrapper{InfrastructureProvider: &operatorv1.InfrastructureProvider{}}, nil
+	case "AddonProvider":
+		return &genericprovider.AddonProviderWrapper{AddonProvider: &operatorv1.AddonProvider{}}, nil
+	default:
+		return nil, fmt.Errorf("unknown provider kind %q", kind)
+	}
+}
+
+// dependencyKey returns the key of the dependency, defaulting its namespace to the one of the dependent provider.
+func dependencyKey(dependency operatorv1.ProviderDependency, dependentNamespace string) types.NamespacedName {
+	key := types.NamespacedName{Namespace: dependency.Namespace, Name: dependency.Name}
+	if key.Namespace == "" {
+		key.Namespace = dependentNamespace
+	}
+
+	return key
+}
+
+// describeProvider returns the kind, namespace and name of the provider, e.g. "BootstrapProvider capi-system/kubeadm".
+func describeProvider(kind string, key types.NamespacedName) string {
+	return fmt.Sprintf("%s %s", kind, key)
+}
+
+// getDependency returns the provider the dependency references, or nil if it doesn't exist.
+func getDependency(ctx context.Context, c client.Client, dependency operatorv1.ProviderDependency, dependentNamespace string) (genericprovider.GenericProvider, error) {
+	provider, err := newProviderOfKind(dependency.Kind)
+	if err != nil {
+		return nil, err
+	}
+
+	key := dependencyKey(dependency, dependentNamespace)
+
+	if err := c.Get(ctx, key, provider.GetObject()); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("failed to get %s: %w", describeProvider(dependency.Kind, key), err)
+	}
+
+	return provider, nil
+}
+
+// findDependencyCycle follows the dependencies of the provider, returning the providers of a cycle leading
+// back to it, starting and ending with the provider, or nil if there is none. Cycles that don't go through
+// the provider are left to be reported by the providers they go through.
+func findDependencyCycle(ctx context.Context, c client.Client, provider genericprovider.GenericProvider) ([]string, error) {
+	start := describeProvider(providerKind(provider), client.ObjectKeyFromObject(provider.GetObject()))
+
+	visited := map[string]bool{}
+
+	var visit func(p genericprovider.GenericProvider, path []string) ([]string, error)
+
+	visit = func(p genericprovider.GenericProvider, path []string) ([]string, error) {
+		for _, dependency := range p.GetSpec().DependsOn {
+			name := describeProvider(dependency.Kind, dependencyKey(dependency, p.GetNamespace()))
+
+			if name == start {
+				return append(path, name), nil
+			}
+
+			if visited[name] {
+				continue
+			}
+
+			visited[name] = true
+
+			next, err := getDependency(ctx, c, dependency, p.GetNamespace())
+			if err != nil {
+				return nil, err
+			}
+
+			if next == nil {
+				continue
+			}
+
+			cycle, err := visit(next, append(path, name))
+			if err != nil || cycle != nil {
+				return cycle, err
+			}
+		}
+
+		return nil, nil
+	}
+
+	return visit(provider, []string{start})
+}
+
+// notReadyDependencies returns the dependencies of the provider that don't exist or aren't Ready yet.
+func notReadyDependencies(ctx context.Context, c client.Client, provider genericprovider.GenericProvider) ([]string, error) {
+	notReady := []string{}
+
+	for _, dependency := range provider.GetSpec().DependsOn {
+		p, err := getDependency(ctx, c, dependency, provider.GetNamespace())
+		if err != nil {
+			return nil, err
+		}
+
+		if p == nil || !conditions.IsTrue(p, clusterv1.ReadyCondition) {
+			notReady = append(notReady, describeProvider(dependency.Kind, dependencyKey(dependency, provider.GetNamespace())))
+		}
+	}
+
+	return notReady, nil
+}
+
+// providerKind returns the kind of the provider.
+func providerKind(provider genericprovider.GenericProvider) string {
+	switch provider.GetObject().(type) {
+	case *operatorv1.CoreProvider:
+		return "CoreProvider"
+	case *operatorv1.BootstrapProvider:
+		return "BootstrapProvider"
+	case *operatorv1.ControlPlaneProvider:
+		return "ControlPlaneProvider"
+	case *operatorv1.InfrastructureProvider:
+		return "InfrastructureProvider"
+	case *operatorv1.AddonProvider:
+		return "AddonProvider"
+	default:
+		return ""
+	}
+}
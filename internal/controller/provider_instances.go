@@ -0,0 +1,106 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/kubernetes/scheme"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// disambiguateObjectsFn renames the provider Deployments colliding with the Deployments of another provider
+// installed in the same namespace, e.g. a second InfrastructureProvider instance of the same type.
+// The first installed instance keeps the original names, while the others get their Deployments
+// prefixed with the provider name.
+func (p *phaseReconciler) disambiguateObjectsFn(ctx context.Context) func(objs []unstructured.Unstructured) ([]unstructured.Unstructured, error) {
+	return func(objs []unstructured.Unstructured) ([]unstructured.Unstructured, error) {
+		providerLabel := clusterctlProviderName(p.provider).Name
+
+		for i := range objs {
+			o := &objs[i]
+
+			if o.GetKind() != deploymentKind {
+				continue
+			}
+
+			collides, err := p.deploymentCollides(ctx, client.ObjectKey{Namespace: o.GetNamespace(), Name: o.GetName()}, providerLabel)
+			if err != nil {
+				return nil, err
+			}
+
+			if !collides {
+				continue
+			}
+
+			d := &appsv1.Deployment{}
+			if err := scheme.Scheme.Convert(o, d, nil); err != nil {
+				return nil, err
+			}
+
+			disambiguateDeployment(d, p.provider.GetName(), providerLabel)
+
+			if err := scheme.Scheme.Convert(d, o, nil); err != nil {
+				return nil, err
+			}
+		}
+
+		return objs, nil
+	}
+}
+
+// deploymentCollides returns true if a Deployment with the given key exists and belongs to another provider.
+func (p *phaseReconciler) deploymentCollides(ctx context.Context, key client.ObjectKey, providerLabel string) (bool, error) {
+	existing := &appsv1.Deployment{}
+	if err := p.ctrlClient.Get(ctx, key, existing); err != nil {
+		if apierrors.IsNotFound(err) {
+			return false, nil
+		}
+
+		return false, fmt.Errorf("failed to get Deployment %s: %w", key, err)
+	}
+
+	return existing.Labels[clusterv1.ProviderNameLabel] != providerLabel, nil
+}
+
+// disambiguateDeployment prefixes the Deployment name with the provider name, and adds the provider label
+// to its selector so it doesn't select the pods of the colliding Deployment.
+func disambiguateDeployment(d *appsv1.Deployment, providerName, providerLabel string) {
+	d.Name = fmt.Sprintf("%s-%s", providerName, d.Name)
+
+	if d.Spec.Selector == nil {
+		d.Spec.Selector = &metav1.LabelSelector{}
+	}
+
+	if d.Spec.Selector.MatchLabels == nil {
+		d.Spec.Selector.MatchLabels = map[string]string{}
+	}
+
+	d.Spec.Selector.MatchLabels[clusterv1.ProviderNameLabel] = providerLabel
+
+	if d.Spec.Template.Labels == nil {
+		d.Spec.Template.Labels = map[string]string{}
+	}
+
+	d.Spec.Template.Labels[clusterv1.ProviderNameLabel] = providerLabel
+}
@@ -0,0 +1,119 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/kubernetes/scheme"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	operatorv1 "sigs.k8s.io/cluster-api-operator/api/v1alpha2"
+	"sigs.k8s.io/cluster-api-operator/internal/controller/genericprovider"
+)
+
+func TestDisambiguateObjects(t *testing.T) {
+	const namespace = "capa-system"
+
+	podLabels := map[string]string{"control-plane": "capa-controller-manager"}
+
+	newDeployment := func(providerLabel string) *appsv1.Deployment {
+		return &appsv1.Deployment{
+			TypeMeta: metav1.TypeMeta{
+				APIVersion: "apps/v1",
+				Kind:       deploymentKind,
+			},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "capa-controller-manager",
+				Namespace: namespace,
+				Labels:    map[string]string{clusterv1.ProviderNameLabel: providerLabel},
+			},
+			Spec: appsv1.DeploymentSpec{
+				Selector: &metav1.LabelSelector{MatchLabels: podLabels},
+			},
+		}
+	}
+
+	testCases := []struct {
+		name                   string
+		providerName           string
+		objs                   []client.Object
+		expectedName           string
+		expectedSelectorLabels map[string]string
+	}{
+		{
+			name:                   "first instance keeps the deployment name",
+			providerName:           "aws",
+			expectedName:           "capa-controller-manager",
+			expectedSelectorLabels: podLabels,
+		},
+		{
+			name:                   "reinstalling an instance keeps its deployment name",
+			providerName:           "aws",
+			objs:                   []client.Object{newDeployment("infrastructure-aws")},
+			expectedName:           "capa-controller-manager",
+			expectedSelectorLabels: podLabels,
+		},
+		{
+			name:         "second instance of the same type gets a distinct deployment name",
+			providerName: "aws-east",
+			objs:         []client.Object{newDeployment("infrastructure-aws")},
+			expectedName: "aws-east-capa-controller-manager",
+			expectedSelectorLabels: map[string]string{
+				"control-plane":             "capa-controller-manager",
+				clusterv1.ProviderNameLabel: "infrastructure-aws-east",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			p := &phaseReconciler{
+				ctrlClient: fake.NewClientBuilder().WithObjects(tc.objs...).Build(),
+				provider: &genericprovider.InfrastructureProviderWrapper{
+					InfrastructureProvider: &operatorv1.InfrastructureProvider{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:      tc.providerName,
+							Namespace: namespace,
+						},
+					},
+				},
+			}
+
+			obj := unstructured.Unstructured{}
+			g.Expect(scheme.Scheme.Convert(newDeployment(clusterctlProviderName(p.provider).Name), &obj, nil)).To(Succeed())
+
+			objs, err := p.disambiguateObjectsFn(context.TODO())([]unstructured.Unstructured{obj})
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(objs).To(HaveLen(1))
+
+			d := &appsv1.Deployment{}
+			g.Expect(scheme.Scheme.Convert(&objs[0], d, nil)).To(Succeed())
+			g.Expect(d.Name).To(Equal(tc.expectedName))
+			g.Expect(d.Spec.Selector.MatchLabels).To(Equal(tc.expectedSelectorLabels))
+		})
+	}
+}
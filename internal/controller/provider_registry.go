@@ -0,0 +1,96 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"strings"
+
+	configclient "sigs.k8s.io/cluster-api/cmd/clusterctl/client/config"
+
+	operatorv1 "sigs.k8s.io/cluster-api-operator/api/v1alpha2"
+	"sigs.k8s.io/cluster-api-operator/internal/controller/genericprovider"
+	"sigs.k8s.io/cluster-api-operator/util"
+)
+
+var (
+	notPredefinedProviderMessage = "Either Selector, URL, Git or Helm must be provided for a not predefined provider"
+	providerTypeMismatchMessage  = "%q is not a known %s but a known %s: check the kind of the provider, or set spec.fetchConfig for a custom provider"
+)
+
+// hasCustomSource returns true if the provider components are fetched from an explicit source rather than
+// from the repository of a predefined provider.
+func hasCustomSource(spec operatorv1.ProviderSpec) bool {
+	return spec.FetchConfig != nil && (spec.FetchConfig.Selector != nil || spec.FetchConfig.URL != "" ||
+		spec.FetchConfig.Git != nil || spec.FetchConfig.Helm != nil)
+}
+
+// knownProviderTypes returns the types of the predefined providers with the given name.
+// The list of known providers can be found here:
+// https://github.com/kubernetes-sigs/cluster-api/blob/main/cmd/clusterctl/client/config/providers_client.go
+func knownProviderTypes(providerName string) ([]string, error) {
+	// Initialize a client that contains predefined providers only.
+	configClient, err := configclient.New("")
+	if err != nil {
+		return nil, err
+	}
+
+	providers, err := configClient.Providers().List()
+	if err != nil {
+		return nil, err
+	}
+
+	types := []string{}
+
+	for _, p := range providers {
+		if p.Name() == providerName {
+			types = append(types, string(p.Type()))
+		}
+	}
+
+	return types, nil
+}
+
+// ValidateProviderName checks that the provider name is the one of a predefined provider of the same type,
+// unless the provider components are fetched from a custom source. It returns the condition reason and the
+// message describing the problem, or empty strings if the name is valid. Names of predefined providers of
+// other types are reported separately, as they usually come from copying a provider of another kind.
+func ValidateProviderName(provider genericprovider.GenericProvider) (string, string, error) {
+	if hasCustomSource(provider.GetSpec()) {
+		return "", "", nil
+	}
+
+	providerType := util.ClusterctlProviderType(provider)
+
+	types, err := knownProviderTypes(provider.GetName())
+	if err != nil {
+		return "", "", fmt.Errorf("failed to generate a list of predefined providers: %w", err)
+	}
+
+	if len(types) == 0 {
+		return operatorv1.FetchConfigValidationErrorReason, notPredefinedProviderMessage, nil
+	}
+
+	for _, t := range types {
+		if t == string(providerType) {
+			return "", "", nil
+		}
+	}
+
+	return operatorv1.ProviderTypeMismatchReason,
+		fmt.Sprintf(providerTypeMismatchMessage, provider.GetName(), providerType, strings.Join(types, ", ")), nil
+}
@@ -0,0 +1,168 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+
+	operatorv1 "sigs.k8s.io/cluster-api-operator/api/v1alpha2"
+	"sigs.k8s.io/cluster-api-operator/internal/controller/genericprovider"
+)
+
+// providerSummaryKey is the key of the provider summary ConfigMap holding the list of providers.
+const providerSummaryKey = "providers.yaml"
+
+// providerSummary describes a provider in the provider summary ConfigMap.
+type providerSummary struct {
+	Type      string                 `json:"type"`
+	Namespace string                 `json:"namespace"`
+	Name      string                 `json:"name"`
+	Version   string                 `json:"version,omitempty"`
+	Contract  string                 `json:"contract,omitempty"`
+	Ready     corev1.ConditionStatus `json:"ready"`
+}
+
+// updateProviderSummary writes the type, installed version, contract and readiness of all the providers
+// managed by the operator to the provider summary ConfigMap, creating it if needed. The whole summary is
+// rebuilt from the providers every time, so it is eventually consistent with them. The reconciled provider,
+// if any, is reported as it was just patched, as the cache may not reflect its new status yet.
+func updateProviderSummary(ctx context.Context, c client.Client, key types.NamespacedName, reconciled genericprovider.GenericProvider) error {
+	summary, err := providerSummaries(ctx, c, reconciled)
+	if err != nil {
+		return err
+	}
+
+	data, err := yaml.Marshal(summary)
+	if err != nil {
+		return fmt.Errorf("failed to encode the provider summary: %w", err)
+	}
+
+	// Providers of all the types are reconciled concurrently, so retry if another reconcile wrote the
+	// summary in the meantime.
+	return retry.OnError(retry.DefaultRetry, func(err error) bool {
+		return apierrors.IsConflict(err) || apierrors.IsAlreadyExists(err)
+	}, func() error {
+		configMap := &corev1.ConfigMap{}
+
+		if err := c.Get(ctx, key, configMap); err != nil {
+			if !apierrors.IsNotFound(err) {
+				return err
+			}
+
+			return c.Create(ctx, &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      key.Name,
+					Namespace: key.Namespace,
+					Labels:    map[string]string{operatorManagedLabel: "true"},
+				},
+				Data: map[string]string{providerSummaryKey: string(data)},
+			})
+		}
+
+		if configMap.Data[providerSummaryKey] == string(data) {
+			return nil
+		}
+
+		if configMap.Data == nil {
+			configMap.Data = map[string]string{}
+		}
+
+		configMap.Data[providerSummaryKey] = string(data)
+
+		return c.Update(ctx, configMap)
+	})
+}
+
+// providerSummaries lists the providers of all the types, sorted by type, namespace and name.
+func providerSummaries(ctx context.Context, c client.Client, reconciled genericprovider.GenericProvider) ([]providerSummary, error) {
+	lists := []genericprovider.GenericProviderList{
+		&genericprovider.CoreProviderListWrapper{CoreProviderList: &operatorv1.CoreProviderList{}},
+		&genericprovider.BootstrapProviderListWrapper{BootstrapProviderList: &operatorv1.BootstrapProviderList{}},
+		&genericprovider.ControlPlaneProviderListWrapper{ControlPlaneProviderList: &operatorv1.ControlPlaneProviderList{}},
+		&genericprovider.InfrastructureProviderListWrapper{InfrastructureProviderList: &operatorv1.InfrastructureProviderList{}},
+		&genericprovider.AddonProviderListWrapper{AddonProviderList: &operatorv1.AddonProviderList{}},
+	}
+
+	summary := []providerSummary{}
+
+	for _, list := range lists {
+		if err := c.List(ctx, list.GetObject()); err != nil {
+			return nil, fmt.Errorf("failed to list providers: %w", err)
+		}
+
+		for _, provider := range list.GetItems() {
+			if reconciled != nil && provider.GetType() == reconciled.GetType() &&
+				provider.GetNamespace() == reconciled.GetNamespace() && provider.GetName() == reconciled.GetName() {
+				provider = reconciled
+			}
+
+			summary = append(summary, newProviderSummary(provider))
+		}
+	}
+
+	sort.Slice(summary, func(i, j int) bool {
+		if summary[i].Type != summary[j].Type {
+			return summary[i].Type < summary[j].Type
+		}
+
+		if summary[i].Namespace != summary[j].Namespace {
+			return summary[i].Namespace < summary[j].Namespace
+		}
+
+		return summary[i].Name < summary[j].Name
+	})
+
+	return summary, nil
+}
+
+// newProviderSummary returns the summary of the provider.
+func newProviderSummary(provider genericprovider.GenericProvider) providerSummary {
+	status := provider.GetStatus()
+
+	s := providerSummary{
+		Type:      provider.GetType(),
+		Namespace: provider.GetNamespace(),
+		Name:      provider.GetName(),
+		Ready:     corev1.ConditionUnknown,
+	}
+
+	if status.InstalledVersion != nil {
+		s.Version = *status.InstalledVersion
+	}
+
+	if status.Contract != nil {
+		s.Contract = *status.Contract
+	}
+
+	if ready := conditions.Get(provider, clusterv1.ReadyCondition); ready != nil {
+		s.Ready = ready.Status
+	}
+
+	return s
+}
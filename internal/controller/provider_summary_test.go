@@ -0,0 +1,103 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/pointer"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/yaml"
+
+	operatorv1 "sigs.k8s.io/cluster-api-operator/api/v1alpha2"
+	"sigs.k8s.io/cluster-api-operator/internal/controller/genericprovider"
+)
+
+func TestUpdateProviderSummary(t *testing.T) {
+	g := NewWithT(t)
+
+	ctx := context.Background()
+	key := types.NamespacedName{Namespace: "capi-operator-system", Name: "provider-summary"}
+
+	coreProvider := &operatorv1.CoreProvider{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "cluster-api",
+			Namespace: "capi-system",
+		},
+		Status: operatorv1.CoreProviderStatus{
+			ProviderStatus: operatorv1.ProviderStatus{
+				InstalledVersion: pointer.String("v1.5.1"),
+				Contract:         pointer.String("v1beta1"),
+				Conditions: clusterv1.Conditions{
+					{Type: clusterv1.ReadyCondition, Status: corev1.ConditionTrue},
+				},
+			},
+		},
+	}
+
+	infraProvider := &operatorv1.InfrastructureProvider{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "aws",
+			Namespace: "capa-system",
+		},
+	}
+
+	fakeclient := fake.NewClientBuilder().WithScheme(setupScheme()).WithObjects(coreProvider, infraProvider).Build()
+
+	readSummary := func() []providerSummary {
+		configMap := &corev1.ConfigMap{}
+		g.Expect(fakeclient.Get(ctx, key, configMap)).To(Succeed())
+
+		summary := []providerSummary{}
+		g.Expect(yaml.Unmarshal([]byte(configMap.Data[providerSummaryKey]), &summary)).To(Succeed())
+
+		return summary
+	}
+
+	// The ConfigMap is created with all the providers.
+	g.Expect(updateProviderSummary(ctx, fakeclient, key, nil)).To(Succeed())
+	g.Expect(readSummary()).To(Equal([]providerSummary{
+		{Type: "core", Namespace: "capi-system", Name: "cluster-api", Version: "v1.5.1", Contract: "v1beta1", Ready: corev1.ConditionTrue},
+		{Type: "infrastructure", Namespace: "capa-system", Name: "aws", Ready: corev1.ConditionUnknown},
+	}))
+
+	// The reconciled provider is reported as patched, even if the cache doesn't reflect it yet.
+	reconciled := &genericprovider.InfrastructureProviderWrapper{InfrastructureProvider: infraProvider.DeepCopy()}
+	reconciled.Status.InstalledVersion = pointer.String("v2.1.4")
+	reconciled.Status.Contract = pointer.String("v1beta1")
+	conditions.MarkFalse(reconciled, clusterv1.ReadyCondition, operatorv1.DeploymentUnavailableReason, clusterv1.ConditionSeverityWarning, "")
+
+	g.Expect(updateProviderSummary(ctx, fakeclient, key, reconciled)).To(Succeed())
+	g.Expect(readSummary()).To(Equal([]providerSummary{
+		{Type: "core", Namespace: "capi-system", Name: "cluster-api", Version: "v1.5.1", Contract: "v1beta1", Ready: corev1.ConditionTrue},
+		{Type: "infrastructure", Namespace: "capa-system", Name: "aws", Version: "v2.1.4", Contract: "v1beta1", Ready: corev1.ConditionFalse},
+	}))
+
+	// Deleted providers are removed from the summary.
+	g.Expect(fakeclient.Delete(ctx, coreProvider)).To(Succeed())
+	g.Expect(updateProviderSummary(ctx, fakeclient, key, nil)).To(Succeed())
+	g.Expect(readSummary()).To(Equal([]providerSummary{
+		{Type: "infrastructure", Namespace: "capa-system", Name: "aws", Ready: corev1.ConditionUnknown},
+	}))
+}
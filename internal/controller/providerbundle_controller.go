@@ -0,0 +1,352 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kerrors "k8s.io/apimachinery/pkg/util/errors"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/cluster-api/util/patch"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	operatorv1 "sigs.k8s.io/cluster-api-operator/api/v1alpha2"
+	"sigs.k8s.io/cluster-api-operator/internal/controller/genericprovider"
+)
+
+// ProviderBundleReconciler expands the ProviderBundles into the providers they declare, owned by the bundle, and
+// reports their status in the bundle.
+type ProviderBundleReconciler struct {
+	Client client.Client
+
+	// DisableNamespaceCreation prevents the operator from creating the namespaces of the bundle providers, which
+	// must exist then.
+	DisableNamespaceCreation bool
+
+	// AuditMode makes the reconciler report the providers it would create, update or delete in the PendingChanges
+	// condition, without changing them. Only the bundle status is updated.
+	AuditMode bool
+
+	// CacheSync delays the reconciliation of the bundles until the operator caches are synced. The bundles are
+	// reconciled right away if nil.
+	CacheSync *CacheSyncGate
+}
+
+func (r *ProviderBundleReconciler) SetupWithManager(mgr ctrl.Manager, options controller.Options) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&operatorv1.ProviderBundle{}).
+		Owns(&operatorv1.CoreProvider{}).
+		Owns(&operatorv1.BootstrapProvider{}).
+		Owns(&operatorv1.ControlPlaneProvider{}).
+		Owns(&operatorv1.InfrastructureProvider{}).
+		WithOptions(options).
+		Complete(r)
+}
+
+func (r *ProviderBundleReconciler) Reconcile(ctx context.Context, req reconcile.Request) (_ reconcile.Result, reterr error) {
+	if !r.CacheSync.Synced() {
+		return ctrl.Result{RequeueAfter: cacheSyncRequeueAfter}, nil
+	}
+
+	bundle := &operatorv1.ProviderBundle{}
+	if err := r.Client.Get(ctx, req.NamespacedName, bundle); err != nil {
+		// The providers of a deleted bundle are garbage collected, as it owns them.
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	if !bundle.DeletionTimestamp.IsZero() {
+		return ctrl.Result{}, nil
+	}
+
+	ctx = ctrl.LoggerInto(ctx, ctrl.LoggerFrom(ctx).WithValues("providerBundle", bundle.Name))
+
+	patchHelper, err := patch.NewHelper(bundle, r.Client)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	defer func() {
+		patchOpts := []patch.Option{
+			patch.WithOwnedConditions{Conditions: []clusterv1.ConditionType{clusterv1.ReadyCondition, operatorv1.ProvidersSyncedCondition, operatorv1.PendingChangesCondition}},
+		}
+		if reterr == nil {
+			patchOpts = append(patchOpts, patch.WithStatusObservedGeneration{})
+		}
+
+		if err := patchHelper.Patch(ctx, bundle, patchOpts...); err != nil {
+			reterr = kerrors.NewAggregate([]error{reterr, err})
+		}
+	}()
+
+	// The changes recorded in audit mode are reported before the bundle is patched, with the original client.
+	if r.AuditMode {
+		audit := newAuditClient(r.Client)
+
+		audited := *r
+		audited.Client = audit
+		r = &audited
+
+		defer func() {
+			setPendingChanges(bundle, audit.pendingChanges())
+		}()
+	}
+
+	if err := r.reconcile(ctx, bundle); err != nil {
+		conditions.MarkFalse(bundle, operatorv1.ProvidersSyncedCondition, operatorv1.ProvidersSyncFailedReason,
+			clusterv1.ConditionSeverityError, "%s", err.Error())
+		conditions.MarkFalse(bundle, clusterv1.ReadyCondition, operatorv1.ProvidersSyncFailedReason,
+			clusterv1.ConditionSeverityError, "%s", err.Error())
+
+		return ctrl.Result{}, err
+	}
+
+	return ctrl.Result{}, nil
+}
+
+// reconcile creates or updates the providers of the bundle stage by stage, in the order clusterctl installs them
+// (Core, Bootstrap, ControlPlane, Infrastructure), holding each stage until the providers of the earlier ones are
+// Ready, and deletes the providers removed from the bundle. The bundle watches the providers it owns, so it's
+// reconciled again when they become Ready.
+func (r *ProviderBundleReconciler) reconcile(ctx context.Context, bundle *operatorv1.ProviderBundle) error {
+	if err := r.pruneProviders(ctx, bundle); err != nil {
+		return err
+	}
+
+	statuses := []operatorv1.BundledProviderStatus{}
+	notReady := []string{}
+
+	// blocking are the providers that aren't Ready when a later stage is reached, the existing providers of the
+	// held stages are only reported.
+	var blocking []string
+
+	for _, stage := range bundleStages(bundle) {
+		if blocking == nil && len(notReady) > 0 && len(stage) > 0 {
+			blocking = append([]string{}, notReady...)
+		}
+
+		for _, provider := range stage {
+			var err error
+			if blocking != nil {
+				err = r.getProvider(ctx, provider)
+			} else {
+				err = r.syncProvider(ctx, bundle, provider)
+			}
+
+			if err != nil {
+				return err
+			}
+
+			statuses = append(statuses, bundledProviderStatus(provider))
+
+			if !conditions.IsTrue(provider, clusterv1.ReadyCondition) {
+				notReady = append(notReady, describeProvider(providerKind(provider), client.ObjectKeyFromObject(provider.GetObject())))
+			}
+		}
+	}
+
+	bundle.Status.Providers = statuses
+
+	if blocking != nil {
+		ctrl.LoggerFrom(ctx).Info("Waiting for the providers of the earlier stages to be Ready", "providers", blocking)
+		conditions.MarkFalse(bundle, operatorv1.ProvidersSyncedCondition, operatorv1.WaitingForEarlierProvidersReason,
+			clusterv1.ConditionSeverityInfo, "Waiting for the providers of the earlier stages to be Ready: %s", strings.Join(blocking, ", "))
+	} else {
+		conditions.MarkTrue(bundle, operatorv1.ProvidersSyncedCondition)
+	}
+
+	if len(notReady) > 0 {
+		conditions.MarkFalse(bundle, clusterv1.ReadyCondition, operatorv1.ProvidersNotReadyReason,
+			clusterv1.ConditionSeverityInfo, "Providers not Ready: %s", strings.Join(notReady, ", "))
+
+		return nil
+	}
+
+	conditions.MarkTrue(bundle, clusterv1.ReadyCondition)
+
+	return nil
+}
+
+// bundleStages returns the providers declared by the bundle, grouped by install stage.
+func bundleStages(bundle *operatorv1.ProviderBundle) [][]genericprovider.GenericProvider {
+	newProviders := func(entries []operatorv1.BundledProvider, newProvider func() genericprovider.GenericProvider) []genericprovider.GenericProvider {
+		providers := []genericprovider.GenericProvider{}
+
+		for _, entry := range entries {
+			provider := newProvider()
+			provider.SetName(entry.Name)
+			provider.SetNamespace(entry.Namespace)
+			provider.SetSpec(entry.Spec)
+
+			providers = append(providers, provider)
+		}
+
+		return providers
+	}
+
+	core := []operatorv1.BundledProvider{}
+	if bundle.Spec.Core != nil {
+		core = append(core, *bundle.Spec.Core)
+	}
+
+	return [][]genericprovider.GenericProvider{
+		newProviders(core, func() genericprovider.GenericProvider {
+			return &genericprovider.CoreProviderWrapper{CoreProvider: &operatorv1.CoreProvider{}}
+		}),
+		newProviders(bundle.Spec.Bootstrap, func() genericprovider.GenericProvider {
+			return &genericprovider.BootstrapProviderWrapper{BootstrapProvider: &operatorv1.BootstrapProvider{}}
+		}),
+		newProviders(bundle.Spec.ControlPlane, func() genericprovider.GenericProvider {
+			return &genericprovider.ControlPlaneProviderWrapper{ControlPlaneProvider: &operatorv1.ControlPlaneProvider{}}
+		}),
+		newProviders(bundle.Spec.Infrastructure, func() genericprovider.GenericProvider {
+			return &genericprovider.InfrastructureProviderWrapper{InfrastructureProvider: &operatorv1.InfrastructureProvider{}}
+		}),
+	}
+}
+
+// syncProvider creates the provider, or updates it to the spec of the bundle, labeled with and owned by the bundle.
+// The provider is updated in place with the stored object.
+func (r *ProviderBundleReconciler) syncProvider(ctx context.Context, bundle *operatorv1.ProviderBundle, provider genericprovider.GenericProvider) error {
+	if err := r.ensureNamespace(ctx, provider.GetNamespace()); err != nil {
+		return err
+	}
+
+	spec := provider.GetSpec()
+
+	result, err := controllerutil.CreateOrUpdate(ctx, r.Client, provider.GetObject(), func() error {
+		labels := provider.GetLabels()
+		if labels == nil {
+			labels = map[string]string{}
+		}
+
+		labels[operatorv1.ProviderBundleLabel] = bundle.Name
+		provider.SetLabels(labels)
+		provider.SetSpec(spec)
+
+		return controllerutil.SetControllerReference(bundle, provider.GetObject(), r.Client.Scheme())
+	})
+	if err != nil {
+		return fmt.Errorf("failed to sync %s: %w", describeProvider(providerKind(provider), client.ObjectKeyFromObject(provider.GetObject())), err)
+	}
+
+	if result != controllerutil.OperationResultNone {
+		ctrl.LoggerFrom(ctx).Info("Synced bundle provider", "kind", providerKind(provider),
+			"provider", client.ObjectKeyFromObject(provider.GetObject()), "operation", result)
+	}
+
+	return nil
+}
+
+// getProvider reads the provider held by an earlier stage, if it exists.
+func (r *ProviderBundleReconciler) getProvider(ctx context.Context, provider genericprovider.GenericProvider) error {
+	key := client.ObjectKeyFromObject(provider.GetObject())
+
+	if err := r.Client.Get(ctx, key, provider.GetObject()); err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to get %s: %w", describeProvider(providerKind(provider), key), err)
+	}
+
+	return nil
+}
+
+// ensureNamespace creates the namespace of a bundle provider if it doesn't exist.
+func (r *ProviderBundleReconciler) ensureNamespace(ctx context.Context, name string) error {
+	err := r.Client.Get(ctx, client.ObjectKey{Name: name}, &corev1.Namespace{})
+	if err == nil {
+		return nil
+	}
+
+	if !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to get namespace %q: %w", name, err)
+	}
+
+	if r.DisableNamespaceCreation {
+		return fmt.Errorf("namespace %q doesn't exist and namespace creation is disabled", name)
+	}
+
+	ctrl.LoggerFrom(ctx).Info("Creating namespace", "namespace", name)
+
+	if err := r.Client.Create(ctx, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name}}); err != nil && !apierrors.IsAlreadyExists(err) {
+		return fmt.Errorf("failed to create namespace %q: %w", name, err)
+	}
+
+	return nil
+}
+
+// pruneProviders deletes the providers owned by the bundle that it no longer declares.
+func (r *ProviderBundleReconciler) pruneProviders(ctx context.Context, bundle *operatorv1.ProviderBundle) error {
+	desired := map[string]bool{}
+
+	for _, stage := range bundleStages(bundle) {
+		for _, provider := range stage {
+			desired[describeProvider(providerKind(provider), client.ObjectKeyFromObject(provider.GetObject()))] = true
+		}
+	}
+
+	lists := []genericprovider.GenericProviderList{
+		&genericprovider.CoreProviderListWrapper{CoreProviderList: &operatorv1.CoreProviderList{}},
+		&genericprovider.BootstrapProviderListWrapper{BootstrapProviderList: &operatorv1.BootstrapProviderList{}},
+		&genericprovider.ControlPlaneProviderListWrapper{ControlPlaneProviderList: &operatorv1.ControlPlaneProviderList{}},
+		&genericprovider.InfrastructureProviderListWrapper{InfrastructureProviderList: &operatorv1.InfrastructureProviderList{}},
+	}
+
+	for _, list := range lists {
+		if err := r.Client.List(ctx, list.GetObject(), client.MatchingLabels{operatorv1.ProviderBundleLabel: bundle.Name}); err != nil {
+			return fmt.Errorf("failed to list providers: %w", err)
+		}
+
+		for _, provider := range list.GetItems() {
+			description := describeProvider(providerKind(provider), client.ObjectKeyFromObject(provider.GetObject()))
+			if desired[description] || !metav1.IsControlledBy(provider.GetObject(), bundle) {
+				continue
+			}
+
+			ctrl.LoggerFrom(ctx).Info("Deleting provider removed from the bundle", "provider", description)
+
+			if err := r.Client.Delete(ctx, provider.GetObject()); client.IgnoreNotFound(err) != nil {
+				return fmt.Errorf("failed to delete %s: %w", description, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// bundledProviderStatus reports the provider in the status of the bundle.
+func bundledProviderStatus(provider genericprovider.GenericProvider) operatorv1.BundledProviderStatus {
+	ready := corev1.ConditionUnknown
+	if condition := conditions.Get(provider, clusterv1.ReadyCondition); condition != nil {
+		ready = condition.Status
+	}
+
+	return operatorv1.BundledProviderStatus{
+		Kind:             providerKind(provider),
+		Name:             provider.GetName(),
+		Namespace:        provider.GetNamespace(),
+		InstalledVersion: provider.GetStatus().InstalledVersion,
+		Ready:            ready,
+	}
+}
@@ -0,0 +1,146 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	operatorv1 "sigs.k8s.io/cluster-api-operator/api/v1alpha2"
+	"sigs.k8s.io/cluster-api-operator/internal/controller/genericprovider"
+)
+
+func TestProviderBundleReconcile(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	bundle := &operatorv1.ProviderBundle{
+		ObjectMeta: metav1.ObjectMeta{Name: "management", UID: "bundle-uid"},
+		Spec: operatorv1.ProviderBundleSpec{
+			Core: &operatorv1.BundledProvider{
+				Name: "cluster-api", Namespace: "capi-system", Spec: operatorv1.ProviderSpec{Version: "v1.5.1"},
+			},
+			Bootstrap: []operatorv1.BundledProvider{
+				{Name: "kubeadm", Namespace: "capi-kubeadm-bootstrap-system", Spec: operatorv1.ProviderSpec{Version: "v1.5.1"}},
+			},
+			Infrastructure: []operatorv1.BundledProvider{
+				{Name: "aws", Namespace: "capa-system", Spec: operatorv1.ProviderSpec{Version: "v2.2.0"}},
+			},
+		},
+	}
+
+	fakeClient := fake.NewClientBuilder().WithScheme(setupScheme()).
+		WithObjects(bundle).
+		WithStatusSubresource(&operatorv1.ProviderBundle{}, &operatorv1.CoreProvider{}, &operatorv1.BootstrapProvider{}, &operatorv1.InfrastructureProvider{}).
+		Build()
+
+	r := &ProviderBundleReconciler{Client: fakeClient}
+
+	reconcileBundle := func() *operatorv1.ProviderBundle {
+		_, err := r.Reconcile(ctx, reconcile.Request{NamespacedName: types.NamespacedName{Name: bundle.Name}})
+		g.Expect(err).ToNot(HaveOccurred())
+
+		current := &operatorv1.ProviderBundle{}
+		g.Expect(fakeClient.Get(ctx, client.ObjectKeyFromObject(bundle), current)).To(Succeed())
+
+		return current
+	}
+
+	markReady := func(provider genericprovider.GenericProvider) {
+		g.Expect(fakeClient.Get(ctx, client.ObjectKeyFromObject(provider.GetObject()), provider.GetObject())).To(Succeed())
+
+		version := provider.GetSpec().Version
+
+		status := provider.GetStatus()
+		status.InstalledVersion = &version
+		provider.SetStatus(status)
+		conditions.MarkTrue(provider, clusterv1.ReadyCondition)
+
+		g.Expect(fakeClient.Status().Update(ctx, provider.GetObject())).To(Succeed())
+	}
+
+	exists := func(provider client.Object, namespace, name string) bool {
+		return fakeClient.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, provider) == nil
+	}
+
+	// Only the core provider is created until it's Ready.
+	current := reconcileBundle()
+	g.Expect(exists(&operatorv1.CoreProvider{}, "capi-system", "cluster-api")).To(BeTrue())
+	g.Expect(exists(&corev1.Namespace{}, "", "capi-system")).To(BeTrue())
+	g.Expect(exists(&operatorv1.BootstrapProvider{}, "capi-kubeadm-bootstrap-system", "kubeadm")).To(BeFalse())
+	g.Expect(conditions.GetReason(current, operatorv1.ProvidersSyncedCondition)).To(Equal(operatorv1.WaitingForEarlierProvidersReason))
+	g.Expect(conditions.GetMessage(current, operatorv1.ProvidersSyncedCondition)).To(Equal(
+		"Waiting for the providers of the earlier stages to be Ready: CoreProvider capi-system/cluster-api"))
+	g.Expect(conditions.IsFalse(current, clusterv1.ReadyCondition)).To(BeTrue())
+	g.Expect(current.Status.Providers).To(Equal([]operatorv1.BundledProviderStatus{
+		{Kind: "CoreProvider", Name: "cluster-api", Namespace: "capi-system", Ready: corev1.ConditionUnknown},
+		{Kind: "BootstrapProvider", Name: "kubeadm", Namespace: "capi-kubeadm-bootstrap-system", Ready: corev1.ConditionUnknown},
+		{Kind: "InfrastructureProvider", Name: "aws", Namespace: "capa-system", Ready: corev1.ConditionUnknown},
+	}))
+
+	coreProvider := &genericprovider.CoreProviderWrapper{CoreProvider: &operatorv1.CoreProvider{}}
+	g.Expect(fakeClient.Get(ctx, types.NamespacedName{Namespace: "capi-system", Name: "cluster-api"}, coreProvider.CoreProvider)).To(Succeed())
+	g.Expect(coreProvider.Spec.Version).To(Equal("v1.5.1"))
+	g.Expect(coreProvider.Labels).To(HaveKeyWithValue(operatorv1.ProviderBundleLabel, "management"))
+	g.Expect(metav1.IsControlledBy(coreProvider.CoreProvider, bundle)).To(BeTrue())
+
+	// The stages are created one after the other as the earlier ones become Ready.
+	markReady(coreProvider)
+
+	current = reconcileBundle()
+	g.Expect(exists(&operatorv1.BootstrapProvider{}, "capi-kubeadm-bootstrap-system", "kubeadm")).To(BeTrue())
+	g.Expect(exists(&operatorv1.InfrastructureProvider{}, "capa-system", "aws")).To(BeFalse())
+	g.Expect(current.Status.Providers[0].Ready).To(Equal(corev1.ConditionTrue))
+	g.Expect(current.Status.Providers[0].InstalledVersion).To(HaveValue(Equal("v1.5.1")))
+
+	markReady(&genericprovider.BootstrapProviderWrapper{BootstrapProvider: &operatorv1.BootstrapProvider{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "capi-kubeadm-bootstrap-system", Name: "kubeadm"},
+	}})
+
+	current = reconcileBundle()
+	g.Expect(exists(&operatorv1.InfrastructureProvider{}, "capa-system", "aws")).To(BeTrue())
+	g.Expect(conditions.IsTrue(current, operatorv1.ProvidersSyncedCondition)).To(BeTrue())
+	g.Expect(conditions.GetMessage(current, clusterv1.ReadyCondition)).To(Equal("Providers not Ready: InfrastructureProvider capa-system/aws"))
+
+	markReady(&genericprovider.InfrastructureProviderWrapper{InfrastructureProvider: &operatorv1.InfrastructureProvider{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "capa-system", Name: "aws"},
+	}})
+
+	current = reconcileBundle()
+	g.Expect(conditions.IsTrue(current, clusterv1.ReadyCondition)).To(BeTrue())
+
+	// Spec changes are propagated, and the providers removed from the bundle are deleted.
+	current.Spec.Core.Spec.Version = "v1.5.2"
+	current.Spec.Bootstrap = nil
+	g.Expect(fakeClient.Update(ctx, current)).To(Succeed())
+
+	reconcileBundle()
+	g.Expect(fakeClient.Get(ctx, types.NamespacedName{Namespace: "capi-system", Name: "cluster-api"}, coreProvider.CoreProvider)).To(Succeed())
+	g.Expect(coreProvider.Spec.Version).To(Equal("v1.5.2"))
+	g.Expect(exists(&operatorv1.BootstrapProvider{}, "capi-kubeadm-bootstrap-system", "kubeadm")).To(BeFalse())
+	g.Expect(exists(&operatorv1.InfrastructureProvider{}, "capa-system", "aws")).To(BeTrue())
+}
@@ -0,0 +1,179 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const githubAPIDomain = "api.github.com"
+
+var (
+	// sharedRateLimits holds the rate limits last reported by each repository host, across all the providers.
+	sharedRateLimits = &rateLimits{observed: map[string]rateLimit{}}
+
+	repositoryRateLimitRemaining = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "capi_operator_repository_rate_limit_remaining",
+		Help: "Number of requests remaining in the current rate limit window of a provider repository API, by host, as reported by its last response.",
+	}, []string{"host"})
+
+	repositoryRateLimitReset = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "capi_operator_repository_rate_limit_reset_timestamp_seconds",
+		Help: "Time at which the current rate limit window of a provider repository API resets, in seconds since the Unix epoch, by host.",
+	}, []string{"host"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(repositoryRateLimitRemaining, repositoryRateLimitReset)
+}
+
+// rateLimitHeaders are the names of the headers reporting the remaining requests and the reset time, as a Unix
+// timestamp, used by GitHub and GitLab respectively.
+var rateLimitHeaders = [][2]string{
+	{"X-RateLimit-Remaining", "X-RateLimit-Reset"},
+	{"RateLimit-Remaining", "RateLimit-Reset"},
+}
+
+// rateLimit is the rate limit status reported by a repository host.
+type rateLimit struct {
+	remaining int
+	reset     time.Time
+	// exceeded is true if the last response was rejected because of the rate limit.
+	exceeded bool
+}
+
+// String describes the rate limit for the conditions, e.g. "0 requests remaining until 2023-09-01T15:04:05Z".
+func (r rateLimit) String() string {
+	if r.reset.IsZero() {
+		return fmt.Sprintf("%d requests remaining", r.remaining)
+	}
+
+	return fmt.Sprintf("%d requests remaining until %s", r.remaining, r.reset.UTC().Format(time.RFC3339))
+}
+
+// rateLimits records the rate limits last reported by each repository host.
+type rateLimits struct {
+	mu       sync.Mutex
+	observed map[string]rateLimit
+}
+
+// observe records the rate limit reported by the response headers, if any, for the host.
+func (r *rateLimits) observe(host string, response *http.Response) {
+	limit, ok := parseRateLimit(response)
+	if !ok {
+		return
+	}
+
+	repositoryRateLimitRemaining.WithLabelValues(host).Set(float64(limit.remaining))
+
+	if !limit.reset.IsZero() {
+		repositoryRateLimitReset.WithLabelValues(host).Set(float64(limit.reset.Unix()))
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.observed[host] = limit
+}
+
+// exceeded returns the rate limit of the host if its last response was rejected because of it.
+func (r *rateLimits) exceeded(host string) (rateLimit, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	limit, ok := r.observed[host]
+
+	return limit, ok && limit.exceeded
+}
+
+// parseRateLimit reads the GitHub or GitLab rate limit headers of the response. A 403 or 429 response with no
+// request remaining is considered rejected because of the rate limit.
+func parseRateLimit(response *http.Response) (rateLimit, bool) {
+	for _, headers := range rateLimitHeaders {
+		remaining, err := strconv.Atoi(response.Header.Get(headers[0]))
+		if err != nil {
+			continue
+		}
+
+		limit := rateLimit{remaining: remaining}
+
+		if reset, err := strconv.ParseInt(response.Header.Get(headers[1]), 10, 64); err == nil {
+			limit.reset = time.Unix(reset, 0)
+		}
+
+		limit.exceeded = remaining == 0 &&
+			(response.StatusCode == http.StatusForbidden || response.StatusCode == http.StatusTooManyRequests)
+
+		return limit, true
+	}
+
+	return rateLimit{}, false
+}
+
+// rateLimitTransport records the rate limits reported by the responses of the wrapped transport.
+type rateLimitTransport struct {
+	base http.RoundTripper
+}
+
+// NewRateLimitTransport returns a transport recording the GitHub and GitLab rate limits reported by the responses
+// of the base transport. The clusterctl GitHub repository can't be given an http client, so the operator wraps
+// the default transport with it.
+func NewRateLimitTransport(base http.RoundTripper) http.RoundTripper {
+	return &rateLimitTransport{base: base}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *rateLimitTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	response, err := t.base.RoundTrip(request)
+	if err == nil {
+		sharedRateLimits.observe(request.URL.Host, response)
+	}
+
+	return response, err
+}
+
+// defaultTransport returns a clone of the default transport, without the rate limit transport wrapping it.
+func defaultTransport() *http.Transport {
+	transport := http.DefaultTransport
+	if t, ok := transport.(*rateLimitTransport); ok {
+		transport = t.base
+	}
+
+	return transport.(*http.Transport).Clone()
+}
+
+// rateLimitHost returns the host of the API serving the provider URL, e.g. api.github.com for GitHub releases.
+func rateLimitHost(providerURL string) string {
+	rURL, err := url.Parse(providerURL)
+	if err != nil {
+		return ""
+	}
+
+	if rURL.Host == githubDomain {
+		return githubAPIDomain
+	}
+
+	return rURL.Host
+}
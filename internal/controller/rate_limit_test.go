@@ -0,0 +1,177 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	clusterctlv1 "sigs.k8s.io/cluster-api/cmd/clusterctl/api/v1alpha3"
+	configclient "sigs.k8s.io/cluster-api/cmd/clusterctl/client/config"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	operatorv1 "sigs.k8s.io/cluster-api-operator/api/v1alpha2"
+	"sigs.k8s.io/cluster-api-operator/internal/controller/genericprovider"
+)
+
+func gaugeValue(g *WithT, gauge prometheus.Gauge) float64 {
+	m := &dto.Metric{}
+	g.Expect(gauge.Write(m)).To(Succeed())
+
+	return m.GetGauge().GetValue()
+}
+
+func TestParseRateLimit(t *testing.T) {
+	reset := time.Unix(1693580645, 0)
+
+	testCases := []struct {
+		name     string
+		status   int
+		headers  map[string]string
+		expected *rateLimit
+	}{
+		{
+			name:   "no rate limit headers",
+			status: http.StatusOK,
+		},
+		{
+			name:     "GitHub quota left",
+			status:   http.StatusOK,
+			headers:  map[string]string{"X-RateLimit-Remaining": "42", "X-RateLimit-Reset": "1693580645"},
+			expected: &rateLimit{remaining: 42, reset: reset},
+		},
+		{
+			name:     "GitHub quota exhausted",
+			status:   http.StatusForbidden,
+			headers:  map[string]string{"X-RateLimit-Remaining": "0", "X-RateLimit-Reset": "1693580645"},
+			expected: &rateLimit{remaining: 0, reset: reset, exceeded: true},
+		},
+		{
+			name:     "forbidden with quota left",
+			status:   http.StatusForbidden,
+			headers:  map[string]string{"X-RateLimit-Remaining": "10"},
+			expected: &rateLimit{remaining: 10},
+		},
+		{
+			name:     "GitLab quota exhausted",
+			status:   http.StatusTooManyRequests,
+			headers:  map[string]string{"RateLimit-Remaining": "0", "RateLimit-Reset": "1693580645"},
+			expected: &rateLimit{remaining: 0, reset: reset, exceeded: true},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			response := &http.Response{StatusCode: tc.status, Header: http.Header{}}
+			for k, v := range tc.headers {
+				response.Header.Set(k, v)
+			}
+
+			limit, ok := parseRateLimit(response)
+			if tc.expected == nil {
+				g.Expect(ok).To(BeFalse())
+
+				return
+			}
+
+			g.Expect(ok).To(BeTrue())
+			g.Expect(limit).To(Equal(*tc.expected))
+		})
+	}
+}
+
+func TestRateLimitTransport(t *testing.T) {
+	g := NewWithT(t)
+
+	remaining := "0"
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("RateLimit-Remaining", remaining)
+		w.Header().Set("RateLimit-Reset", "1693580645")
+
+		if remaining == "0" {
+			w.WriteHeader(http.StatusTooManyRequests)
+		}
+	}))
+	defer server.Close()
+
+	host := server.Listener.Addr().String()
+	httpClient := &http.Client{Transport: NewRateLimitTransport(http.DefaultTransport)}
+
+	response, err := httpClient.Get(server.URL)
+	g.Expect(err).ToNot(HaveOccurred())
+	response.Body.Close()
+
+	limit, ok := sharedRateLimits.exceeded(host)
+	g.Expect(ok).To(BeTrue())
+	g.Expect(limit.String()).To(Equal("0 requests remaining until 2023-09-01T15:04:05Z"))
+	g.Expect(gaugeValue(g, repositoryRateLimitRemaining.WithLabelValues(host))).To(Equal(0.0))
+	g.Expect(gaugeValue(g, repositoryRateLimitReset.WithLabelValues(host))).To(Equal(1693580645.0))
+
+	// A download failing while the rate limit is exceeded reports it in the condition.
+	p := &phaseReconciler{
+		provider: &genericprovider.InfrastructureProviderWrapper{
+			InfrastructureProvider: &operatorv1.InfrastructureProvider{
+				ObjectMeta: metav1.ObjectMeta{Name: "rate-limit", Namespace: "capa-system"},
+			},
+		},
+		providerConfig: configclient.NewProvider("aws", server.URL+"/infrastructure-components.yaml", clusterctlv1.InfrastructureProviderType),
+	}
+
+	defer sharedDownloadBackoff.reset(providerKey(p.provider))
+
+	_, err = p.scheduleDownloadRetry(context.Background(), reconcile.Result{}, &PhaseError{
+		Err:      errors.New("failed to download"),
+		Type:     operatorv1.ProviderInstalledCondition,
+		Reason:   operatorv1.DownloadFailedReason,
+		Severity: clusterv1.ConditionSeverityWarning,
+	})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(conditions.GetMessage(p.provider, operatorv1.ProviderInstalledCondition)).To(Equal(
+		"failed to download, rate limit of " + host + " exceeded: 0 requests remaining until 2023-09-01T15:04:05Z, retry scheduled in 10s"))
+
+	// The next successful response clears it.
+	remaining = "4999"
+
+	response, err = httpClient.Get(server.URL)
+	g.Expect(err).ToNot(HaveOccurred())
+	response.Body.Close()
+
+	_, ok = sharedRateLimits.exceeded(host)
+	g.Expect(ok).To(BeFalse())
+	g.Expect(gaugeValue(g, repositoryRateLimitRemaining.WithLabelValues(host))).To(Equal(4999.0))
+}
+
+func TestRateLimitHost(t *testing.T) {
+	g := NewWithT(t)
+
+	g.Expect(rateLimitHost("https://github.com/kubernetes-sigs/cluster-api/releases/latest/core-components.yaml")).To(Equal("api.github.com"))
+	g.Expect(rateLimitHost("https://gitlab.example.com/api/v4/projects/group%2Fproject/packages/generic/capa/v2.1.4/infrastructure-components.yaml")).
+		To(Equal("gitlab.example.com"))
+}
@@ -0,0 +1,105 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/cluster-api/util/container"
+)
+
+// workloadPodSpecPaths are the paths of the pod specs of the workload kinds whose images are mirrored.
+var workloadPodSpecPaths = map[string][]string{
+	"Deployment":  {"spec", "template", "spec"},
+	"DaemonSet":   {"spec", "template", "spec"},
+	"StatefulSet": {"spec", "template", "spec"},
+	"Job":         {"spec", "template", "spec"},
+	"CronJob":     {"spec", "jobTemplate", "spec", "template", "spec"},
+}
+
+// validateRegistryMirror returns an error if the registry mirror, e.g. "mirror.example.com" or
+// "mirror.example.com/cluster-api", can't prefix image references.
+func validateRegistryMirror(mirror string) error {
+	if mirror == "" {
+		return nil
+	}
+
+	if strings.Contains(mirror, "://") {
+		return fmt.Errorf("registry mirror %q must not have a scheme", mirror)
+	}
+
+	if _, err := container.ImageFromString(mirror + "/image:tag"); err != nil {
+		return fmt.Errorf("invalid registry mirror %q: %w", mirror, err)
+	}
+
+	return nil
+}
+
+// mirrorImagesFn rewrites the registry of the container and init container images of the workloads to the mirror.
+func mirrorImagesFn(mirror string) func(objs []unstructured.Unstructured) ([]unstructured.Unstructured, error) {
+	return func(objs []unstructured.Unstructured) ([]unstructured.Unstructured, error) {
+		for i := range objs {
+			path, ok := workloadPodSpecPaths[objs[i].GetKind()]
+			if !ok {
+				continue
+			}
+
+			for _, field := range []string{"containers", "initContainers"} {
+				containersPath := append(append([]string{}, path...), field)
+
+				containers, found, err := unstructured.NestedSlice(objs[i].Object, containersPath...)
+				if err != nil {
+					return nil, fmt.Errorf("failed to get the %s of %s %s: %w", field, objs[i].GetKind(), objs[i].GetName(), err)
+				}
+
+				if !found {
+					continue
+				}
+
+				for _, c := range containers {
+					if c, ok := c.(map[string]interface{}); ok {
+						if image, ok := c["image"].(string); ok && image != "" {
+							c["image"] = mirrorImage(image, mirror)
+						}
+					}
+				}
+
+				if err := unstructured.SetNestedSlice(objs[i].Object, containers, containersPath...); err != nil {
+					return nil, fmt.Errorf("failed to set the %s of %s %s: %w", field, objs[i].GetKind(), objs[i].GetName(), err)
+				}
+			}
+		}
+
+		return objs, nil
+	}
+}
+
+// mirrorImage replaces the registry of the image with the mirror, keeping its path, e.g.
+// "registry.k8s.io/cluster-api/cluster-api-controller:v1.5.1" becomes
+// "mirror.example.com/cluster-api/cluster-api-controller:v1.5.1". Images without a registry are Docker Hub ones.
+func mirrorImage(image, mirror string) string {
+	mirror = strings.TrimSuffix(mirror, "/")
+
+	registry, path, found := strings.Cut(image, "/")
+	if found && (strings.ContainsAny(registry, ".:") || registry == "localhost") {
+		return mirror + "/" + path
+	}
+
+	return mirror + "/" + image
+}
@@ -0,0 +1,160 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/utils/pointer"
+	clusterctlv1 "sigs.k8s.io/cluster-api/cmd/clusterctl/api/v1alpha3"
+	configclient "sigs.k8s.io/cluster-api/cmd/clusterctl/client/config"
+	"sigs.k8s.io/cluster-api/cmd/clusterctl/client/repository"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	operatorv1 "sigs.k8s.io/cluster-api-operator/api/v1alpha2"
+	"sigs.k8s.io/cluster-api-operator/internal/controller/genericprovider"
+)
+
+func TestMirrorImage(t *testing.T) {
+	g := NewWithT(t)
+
+	g.Expect(mirrorImage("registry.k8s.io/cluster-api-aws/cluster-api-aws-controller:v2.2.0", "mirror.example.com")).
+		To(Equal("mirror.example.com/cluster-api-aws/cluster-api-aws-controller:v2.2.0"))
+	g.Expect(mirrorImage("localhost:5000/manager:dev", "mirror.example.com/")).To(Equal("mirror.example.com/manager:dev"))
+	g.Expect(mirrorImage("nginx:1.25", "mirror.example.com/docker")).To(Equal("mirror.example.com/docker/nginx:1.25"))
+	g.Expect(mirrorImage("bitnami/kubectl@sha256:0123", "mirror.example.com")).To(Equal("mirror.example.com/bitnami/kubectl@sha256:0123"))
+
+	g.Expect(validateRegistryMirror("mirror.example.com:5000/cluster-api")).To(Succeed())
+	g.Expect(validateRegistryMirror("https://mirror.example.com")).ToNot(Succeed())
+}
+
+func TestRegistryMirrorPrecedence(t *testing.T) {
+	components := `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: capa-controller-manager
+  namespace: capa-system
+spec:
+  selector:
+    matchLabels:
+      control-plane: capa-controller-manager
+  template:
+    metadata:
+      labels:
+        control-plane: capa-controller-manager
+    spec:
+      initContainers:
+      - name: wait
+        image: docker.io/library/busybox:1.36
+      containers:
+      - name: manager
+        image: registry.k8s.io/cluster-api-aws/cluster-api-aws-controller:v2.2.0
+      - name: kube-rbac-proxy
+        image: gcr.io/kubebuilder/kube-rbac-proxy:v0.13.1
+`
+
+	testCases := []struct {
+		name           string
+		deployment     *operatorv1.DeploymentSpec
+		registryMirror string
+		expectedImages []string
+	}{
+		{
+			name:           "no registry mirror",
+			expectedImages: []string{"docker.io/library/busybox:1.36", "registry.k8s.io/cluster-api-aws/cluster-api-aws-controller:v2.2.0", "gcr.io/kubebuilder/kube-rbac-proxy:v0.13.1"},
+		},
+		{
+			name:           "registry mirror",
+			registryMirror: "mirror.example.com",
+			expectedImages: []string{
+				"mirror.example.com/library/busybox:1.36",
+				"mirror.example.com/cluster-api-aws/cluster-api-aws-controller:v2.2.0",
+				"mirror.example.com/kubebuilder/kube-rbac-proxy:v0.13.1",
+			},
+		},
+		{
+			name:           "images overridden by the provider take precedence",
+			registryMirror: "mirror.example.com",
+			deployment: &operatorv1.DeploymentSpec{
+				Image:      &operatorv1.ImageReference{Repository: "registry.example.com/capa/manager", Tag: "v2.2.0-patched"},
+				Containers: []operatorv1.ContainerSpec{{Name: "kube-rbac-proxy", ImageURL: pointer.String("quay.io/brancz/kube-rbac-proxy:v0.14.0")}},
+			},
+			expectedImages: []string{
+				"mirror.example.com/library/busybox:1.36",
+				"registry.example.com/capa/manager:v2.2.0-patched",
+				"quay.io/brancz/kube-rbac-proxy:v0.14.0",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			configClient, err := configclient.New("", configclient.InjectReader(configclient.NewMemoryReader()))
+			g.Expect(err).ToNot(HaveOccurred())
+
+			repo := repository.NewMemoryRepository().WithPaths("", "components.yaml").WithDefaultVersion("v2.2.0").
+				WithFile("v2.2.0", "components.yaml", []byte(components))
+
+			scheme := setupScheme()
+			utilruntime.Must(appsv1.AddToScheme(scheme))
+
+			p := &phaseReconciler{
+				ctrlClient: fake.NewClientBuilder().WithScheme(scheme).Build(),
+				provider: &genericprovider.InfrastructureProviderWrapper{
+					InfrastructureProvider: &operatorv1.InfrastructureProvider{
+						ObjectMeta: metav1.ObjectMeta{Name: "aws", Namespace: "capa-system"},
+						Spec: operatorv1.InfrastructureProviderSpec{
+							ProviderSpec: operatorv1.ProviderSpec{Deployment: tc.deployment},
+						},
+					},
+				},
+				providerConfig: configclient.NewProvider("aws", "https://example.com/components.yaml", clusterctlv1.InfrastructureProviderType),
+				configClient:   configClient,
+				options:        repository.ComponentsOptions{Version: "v2.2.0", TargetNamespace: "capa-system"},
+				registryMirror: tc.registryMirror,
+			}
+
+			c, err := p.newComponents(context.Background(), repo, "v2.2.0")
+			g.Expect(err).ToNot(HaveOccurred())
+
+			images := []string{}
+
+			for _, obj := range c.Objs() {
+				if obj.GetKind() != deploymentKind {
+					continue
+				}
+
+				d := &appsv1.Deployment{}
+				g.Expect(runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, d)).To(Succeed())
+
+				for _, c := range append(d.Spec.Template.Spec.InitContainers, d.Spec.Template.Spec.Containers...) {
+					images = append(images, c.Image)
+				}
+			}
+
+			g.Expect(images).To(Equal(tc.expectedImages))
+		})
+	}
+}
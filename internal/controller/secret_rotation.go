@@ -0,0 +1,289 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	operatorv1 "sigs.k8s.io/cluster-api-operator/api/v1alpha2"
+	"sigs.k8s.io/cluster-api-operator/internal/controller/genericprovider"
+)
+
+const (
+	// appliedSecretsHashAnnotation records the hash of the secrets referenced by the provider variables when its
+	// components were last installed.
+	appliedSecretsHashAnnotation = "operator.cluster.x-k8s.io/applied-secrets-hash"
+
+	// restartedAtAnnotation is bumped on the pod template of the provider Deployments to restart them when the
+	// components are applied again with the rotated secrets.
+	restartedAtAnnotation = "operator.cluster.x-k8s.io/restarted-at"
+
+	// secretRotationRestartInterval is the minimum time between two applies of the provider components for
+	// rotated secrets, so several secret changes in a row, e.g. one key at a time, only restart them once.
+	secretRotationRestartInterval = time.Minute
+)
+
+// referencedSecrets returns the secrets the provider variables are read from. The secrets without namespace are
+// in the provider one.
+func referencedSecrets(provider genericprovider.GenericProvider) []types.NamespacedName {
+	keys := []types.NamespacedName{}
+
+	spec := provider.GetSpec()
+
+	if spec.ConfigSecret != nil {
+		keys = append(keys, types.NamespacedName{Namespace: spec.ConfigSecret.Namespace, Name: spec.ConfigSecret.Name})
+	}
+
+	if spec.ConfigSecretRef != nil {
+		keys = append(keys, types.NamespacedName{Namespace: spec.ConfigSecretRef.Namespace, Name: spec.ConfigSecretRef.Name})
+	}
+
+	for i := range keys {
+		if keys[i].Namespace == "" {
+			keys[i].Namespace = provider.GetNamespace()
+		}
+	}
+
+	return keys
+}
+
+// referencedSecretsHash returns the hash of the data of the secrets referenced by the provider, or an empty string
+// if it references none. Missing secrets are hashed as such, so deleting one is a change too.
+func referencedSecretsHash(ctx context.Context, c client.Client, provider genericprovider.GenericProvider) (string, error) {
+	keys := referencedSecrets(provider)
+	if len(keys) == 0 {
+		return "", nil
+	}
+
+	type secretData struct {
+		Key  string
+		Data map[string][]byte
+	}
+
+	secrets := make([]secretData, 0, len(keys))
+
+	for _, key := range keys {
+		secret := &corev1.Secret{}
+		if err := c.Get(ctx, key, secret); err != nil && !apierrors.IsNotFound(err) {
+			return "", fmt.Errorf("failed to get secret %s: %w", key, err)
+		}
+
+		secrets = append(secrets, secretData{Key: key.String(), Data: secret.Data})
+	}
+
+	return calculateHash(secrets)
+}
+
+// setSecretsHashAnnotation records the hash of the referenced secrets the provider components are installed with,
+// removing it if the provider references none.
+func setSecretsHashAnnotation(provider genericprovider.GenericProvider, hash string) {
+	annotations := provider.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+
+	if hash == "" {
+		delete(annotations, appliedSecretsHashAnnotation)
+	} else {
+		annotations[appliedSecretsHashAnnotation] = hash
+	}
+
+	provider.SetAnnotations(annotations)
+}
+
+// secretToProviders maps a secret to the providers whose variables are read from it, so they are reconciled,
+// and if needed restarted, when it is rotated.
+func (r *GenericProviderReconciler) secretToProviders(ctx context.Context, secret client.Object) []reconcile.Request {
+	providers, err := r.newGenericProviderList()
+	if err != nil {
+		return nil
+	}
+
+	if err := r.Client.List(ctx, providers.GetObject()); err != nil {
+		ctrl.LoggerFrom(ctx).Error(err, "Failed to list providers referencing secret", "secret", client.ObjectKeyFromObject(secret))
+
+		return nil
+	}
+
+	requests := []reconcile.Request{}
+
+	for _, provider := range providers.GetItems() {
+		for _, key := range referencedSecrets(provider) {
+			if key == client.ObjectKeyFromObject(secret) {
+				requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(provider)})
+
+				break
+			}
+		}
+	}
+
+	return requests
+}
+
+// providerDeployments returns the Deployments of the provider components.
+func providerDeployments(ctx context.Context, c client.Client, provider genericprovider.GenericProvider) ([]appsv1.Deployment, error) {
+	deployments := &appsv1.DeploymentList{}
+	if err := c.List(ctx, deployments,
+		client.InNamespace(provider.GetNamespace()),
+		client.MatchingLabels{clusterv1.ProviderNameLabel: clusterctlProviderName(provider).Name},
+	); err != nil {
+		return nil, fmt.Errorf("failed to list provider deployments: %w", err)
+	}
+
+	return deployments.Items, nil
+}
+
+// secretRotationDelay returns how long to wait before the provider components may be applied again for rotated
+// secrets, restarting the Deployments, or zero if they may be applied now.
+func secretRotationDelay(ctx context.Context, c client.Client, provider genericprovider.GenericProvider, now time.Time) (time.Duration, error) {
+	deployments, err := providerDeployments(ctx, c, provider)
+	if err != nil {
+		return 0, err
+	}
+
+	delay := time.Duration(0)
+
+	for _, deployment := range deployments {
+		restartedAt, err := time.Parse(time.RFC3339, deployment.Spec.Template.Annotations[restartedAtAnnotation])
+		if err != nil {
+			continue
+		}
+
+		if wait := restartedAt.Add(secretRotationRestartInterval).Sub(now); wait > delay {
+			delay = wait
+		}
+	}
+
+	return delay, nil
+}
+
+// reconcileSecretRotation applies the provider components again with the variables of the rotated secrets. Unlike
+// a spec change, the installed components are not deleted first, and the provider Deployments roll out new pods once.
+func (r *GenericProviderReconciler) reconcileSecretRotation(ctx context.Context, provider genericprovider.GenericProvider, genericProviderList genericprovider.GenericProviderList) (ctrl.Result, error) {
+	reconciler := newPhaseReconciler(*r, provider, genericProviderList)
+	phases := []reconcilePhaseFn{
+		reconciler.preflightChecks,
+		reconciler.initializePhaseReconciler,
+		reconciler.resolveVersion,
+		reconciler.downloadManifests,
+		reconciler.load,
+		reconciler.fetch,
+		reconciler.checkPermissions,
+		reconciler.reapplyComponents,
+	}
+
+	res := reconcile.Result{}
+
+	var err error
+
+	for _, phase := range phases {
+		res, err = phase(ctx)
+		if err != nil {
+			var pe *PhaseError
+			if errors.As(err, &pe) {
+				conditions.Set(provider, conditions.FalseCondition(pe.Type, pe.Reason, pe.Severity, err.Error()))
+			}
+		}
+
+		if !res.IsZero() || err != nil {
+			return res, err
+		}
+	}
+
+	return res, nil
+}
+
+// reapplyComponents applies the components rendered with the rotated secrets over the installed ones, with the
+// restart annotation set on the pod template of the Deployments, so they roll out new pods even if only the
+// secrets read by the provider controllers changed.
+func (p *phaseReconciler) reapplyComponents(ctx context.Context) (reconcile.Result, error) {
+	objs, err := withRestartedAt(p.componentsToInstall(), time.Now())
+	if err != nil {
+		return reconcile.Result{}, wrapPhaseError(err, operatorv1.ApplyFailedReason)
+	}
+
+	// In audit mode, the components are compared with the live ones instead of being applied.
+	if p.audit != nil {
+		return p.auditInstall(ctx, objs)
+	}
+
+	if err := p.applyComponents(ctx, objs); err != nil {
+		return reconcile.Result{}, wrapPhaseError(err, installErrorReason(err))
+	}
+
+	hash, err := componentsHash(objs)
+	if err != nil {
+		return reconcile.Result{}, wrapPhaseError(err, operatorv1.ApplyFailedReason)
+	}
+
+	status := p.provider.GetStatus()
+	status.AppliedComponentsHash = &hash
+	p.provider.SetStatus(status)
+
+	if err := p.storeAppliedComponents(ctx, objs, hash); err != nil {
+		ctrl.LoggerFrom(ctx).Error(err, "Failed to store the applied components, skipping the drift detection until the next install")
+	}
+
+	ctrl.LoggerFrom(ctx).Info("Applied provider components again for rotated secrets")
+
+	return reconcile.Result{}, nil
+}
+
+// withRestartedAt returns a copy of the components with the restart annotation of the pod template of the
+// Deployments set to now.
+func withRestartedAt(objs []unstructured.Unstructured, now time.Time) ([]unstructured.Unstructured, error) {
+	restarted := make([]unstructured.Unstructured, 0, len(objs))
+
+	for _, obj := range objs {
+		obj = *obj.DeepCopy()
+
+		if obj.GetKind() == deploymentKind {
+			annotations, _, err := unstructured.NestedStringMap(obj.Object, "spec", "template", "metadata", "annotations")
+			if err != nil {
+				return nil, fmt.Errorf("failed to get the pod template annotations of deployment %s: %w", describeObject(obj), err)
+			}
+
+			if annotations == nil {
+				annotations = map[string]string{}
+			}
+
+			annotations[restartedAtAnnotation] = now.UTC().Format(time.RFC3339)
+
+			if err := unstructured.SetNestedStringMap(obj.Object, annotations, "spec", "template", "metadata", "annotations"); err != nil {
+				return nil, fmt.Errorf("failed to set the pod template annotations of deployment %s: %w", describeObject(obj), err)
+			}
+		}
+
+		restarted = append(restarted, obj)
+	}
+
+	return restarted, nil
+}
@@ -0,0 +1,188 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	operatorv1 "sigs.k8s.io/cluster-api-operator/api/v1alpha2"
+	"sigs.k8s.io/cluster-api-operator/internal/controller/genericprovider"
+)
+
+func TestSecretToProviders(t *testing.T) {
+	g := NewWithT(t)
+
+	aws := &operatorv1.InfrastructureProvider{
+		ObjectMeta: metav1.ObjectMeta{Name: "aws", Namespace: "capa-system"},
+		Spec: operatorv1.InfrastructureProviderSpec{
+			ProviderSpec: operatorv1.ProviderSpec{
+				ConfigSecret: &operatorv1.SecretReference{Name: "aws-variables", Namespace: "capa-system"},
+			},
+		},
+	}
+	azure := &operatorv1.InfrastructureProvider{
+		ObjectMeta: metav1.ObjectMeta{Name: "azure", Namespace: "capz-system"},
+		Spec: operatorv1.InfrastructureProviderSpec{
+			ProviderSpec: operatorv1.ProviderSpec{
+				ConfigSecretRef: &operatorv1.ClusterctlConfigReference{Name: "clusterctl-config"},
+			},
+		},
+	}
+
+	r := &GenericProviderReconciler{
+		Provider:     &operatorv1.InfrastructureProvider{},
+		ProviderList: &operatorv1.InfrastructureProviderList{},
+		Client:       fake.NewClientBuilder().WithScheme(setupScheme()).WithObjects(aws, azure).Build(),
+	}
+
+	newSecret := func(namespace, name string) client.Object {
+		return &metav1.PartialObjectMetadata{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace}}
+	}
+
+	g.Expect(r.secretToProviders(context.Background(), newSecret("capa-system", "aws-variables"))).To(Equal([]reconcile.Request{
+		{NamespacedName: client.ObjectKeyFromObject(aws)},
+	}))
+	// The clusterctl configuration secret defaults to the provider namespace.
+	g.Expect(r.secretToProviders(context.Background(), newSecret("capz-system", "clusterctl-config"))).To(Equal([]reconcile.Request{
+		{NamespacedName: client.ObjectKeyFromObject(azure)},
+	}))
+	g.Expect(r.secretToProviders(context.Background(), newSecret("capa-system", "clusterctl-config"))).To(BeEmpty())
+}
+
+func TestSecretRotation(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	provider := &genericprovider.InfrastructureProviderWrapper{
+		InfrastructureProvider: &operatorv1.InfrastructureProvider{
+			ObjectMeta: metav1.ObjectMeta{Name: "aws", Namespace: "capa-system"},
+			Spec: operatorv1.InfrastructureProviderSpec{
+				ProviderSpec: operatorv1.ProviderSpec{
+					ConfigSecret: &operatorv1.SecretReference{Name: "aws-variables", Namespace: "capa-system"},
+				},
+			},
+		},
+	}
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "aws-variables", Namespace: "capa-system"},
+		Data:       map[string][]byte{"AWS_B64ENCODED_CREDENTIALS": []byte("old")},
+	}
+
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "capa-controller-manager",
+			Namespace: "capa-system",
+			Labels:    map[string]string{clusterv1.ProviderNameLabel: "infrastructure-aws"},
+		},
+	}
+
+	scheme := setupScheme()
+	utilruntime.Must(appsv1.AddToScheme(scheme))
+
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(secret, deployment).WithInterceptorFuncs(interceptor.Funcs{
+		// The fake client doesn't support server-side apply, so the applied components are updated instead.
+		Patch: func(ctx context.Context, c client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+			return c.Update(ctx, obj)
+		},
+	}).Build()
+
+	applied, err := referencedSecretsHash(ctx, c, provider)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(applied).ToNot(BeEmpty())
+
+	// Rotating the secret changes its hash.
+	secret.Data["AWS_B64ENCODED_CREDENTIALS"] = []byte("new")
+	g.Expect(c.Update(ctx, secret)).To(Succeed())
+
+	rotated, err := referencedSecretsHash(ctx, c, provider)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(rotated).ToNot(Equal(applied))
+
+	// A deployment never restarted may be restarted right away.
+	now := time.Date(2023, 9, 1, 12, 0, 0, 0, time.UTC)
+
+	delay, err := secretRotationDelay(ctx, c, provider, now)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(delay).To(BeZero())
+
+	// The components are applied again in place, with the restart annotation on the Deployment pod templates.
+	desired := newUnstructured(appsv1.SchemeGroupVersion.WithKind("Deployment"), "capa-system", "capa-controller-manager")
+	desired.SetLabels(map[string]string{clusterv1.ProviderNameLabel: "infrastructure-aws"})
+
+	restarted, err := withRestartedAt([]unstructured.Unstructured{desired}, now)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(restarted).To(HaveLen(1))
+	g.Expect(restarted[0].Object).To(HaveKeyWithValue("spec", HaveKeyWithValue("template", HaveKeyWithValue("metadata",
+		HaveKeyWithValue("annotations", HaveKeyWithValue(restartedAtAnnotation, "2023-09-01T12:00:00Z"))))))
+	g.Expect(desired.Object).ToNot(HaveKey("spec"))
+
+	p := &phaseReconciler{
+		ctrlClient:      c,
+		serverSideApply: true,
+		components:      &fakeComponents{objs: []unstructured.Unstructured{desired}},
+		provider:        provider,
+	}
+
+	_, err = p.reapplyComponents(ctx)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(c.Get(ctx, client.ObjectKeyFromObject(deployment), deployment)).To(Succeed())
+	g.Expect(deployment.Spec.Template.Annotations).To(HaveKey(restartedAtAnnotation))
+	g.Expect(provider.Status.AppliedComponentsHash).ToNot(BeNil())
+
+	restartedAt, err := time.Parse(time.RFC3339, deployment.Spec.Template.Annotations[restartedAtAnnotation])
+	g.Expect(err).ToNot(HaveOccurred())
+
+	// Another rotation shortly after waits for the restart interval.
+	delay, err = secretRotationDelay(ctx, c, provider, restartedAt.Add(10*time.Second))
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(delay).To(Equal(50 * time.Second))
+
+	delay, err = secretRotationDelay(ctx, c, provider, restartedAt.Add(secretRotationRestartInterval))
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(delay).To(BeZero())
+
+	// The components are stored as applied, so the restart annotation isn't reported as drift.
+	stored, err := p.appliedComponents(ctx)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(stored).To(HaveLen(1))
+
+	drifts, err := componentsDrift(ctx, c, stored)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(drifts).To(BeEmpty())
+
+	// Providers without referenced secrets have no hash.
+	provider.Spec.ConfigSecret = nil
+
+	hash, err := referencedSecretsHash(ctx, c, provider)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(hash).To(BeEmpty())
+}
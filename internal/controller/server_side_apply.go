@@ -0,0 +1,71 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	operatorv1 "sigs.k8s.io/cluster-api-operator/api/v1alpha2"
+)
+
+// DefaultFieldManager is the field manager owning the fields of the objects applied with server-side apply.
+const DefaultFieldManager = "capi-operator"
+
+// applyObjects applies the objects with server-side apply, in order. Ownership is not forced, so fields
+// owned by another field manager, e.g. a GitOps tool, are reported as conflicts instead of being overwritten.
+func applyObjects(ctx context.Context, c client.Client, fieldManager string, objs []unstructured.Unstructured) error {
+	if fieldManager == "" {
+		fieldManager = DefaultFieldManager
+	}
+
+	for i := range objs {
+		obj := objs[i].DeepCopy()
+
+		// Applied configurations must not carry these.
+		obj.SetResourceVersion("")
+		obj.SetManagedFields(nil)
+
+		if err := c.Patch(ctx, obj, client.Apply, client.FieldOwner(fieldManager)); err != nil {
+			err = fmt.Errorf("failed to apply %s %s: %w", obj.GetKind(), client.ObjectKeyFromObject(obj), err)
+
+			if apierrors.IsConflict(err) {
+				return withReason(err, operatorv1.ApplyConflictReason)
+			}
+
+			return err
+		}
+	}
+
+	return nil
+}
+
+// applyComponents applies the objects with server-side apply if enabled, or creates or updates them otherwise,
+// in the apply order of the provider.
+func (p *phaseReconciler) applyComponents(ctx context.Context, objs []unstructured.Unstructured) error {
+	objs = sortForApply(objs, p.provider.GetSpec().ApplyOrder)
+
+	if p.serverSideApply {
+		return applyObjects(ctx, p.ctrlClient, p.fieldManager, objs)
+	}
+
+	return p.newClusterClient().ProviderComponents().Create(objs)
+}
@@ -0,0 +1,101 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	operatorv1 "sigs.k8s.io/cluster-api-operator/api/v1alpha2"
+)
+
+func TestApplyObjects(t *testing.T) {
+	testCases := []struct {
+		name                 string
+		fieldManager         string
+		conflict             bool
+		expectedFieldManager string
+	}{
+		{
+			name:                 "default field manager",
+			expectedFieldManager: DefaultFieldManager,
+		},
+		{
+			name:                 "custom field manager",
+			fieldManager:         "flux",
+			expectedFieldManager: "flux",
+		},
+		{
+			name:     "conflict with another field manager",
+			conflict: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			obj := newUnstructured(corev1.SchemeGroupVersion.WithKind("ServiceAccount"), "capi-system", "capi-manager")
+			obj.SetResourceVersion("1")
+
+			patches := []*client.PatchOptions{}
+
+			fakeclient := fake.NewClientBuilder().WithInterceptorFuncs(interceptor.Funcs{
+				Patch: func(ctx context.Context, c client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+					g.Expect(patch.Type()).To(Equal(types.ApplyPatchType))
+					g.Expect(obj.GetResourceVersion()).To(BeEmpty())
+
+					if tc.conflict {
+						return apierrors.NewConflict(schema.GroupResource{Resource: "serviceaccounts"}, obj.GetName(), errors.New("field is owned by flux"))
+					}
+
+					patchOptions := &client.PatchOptions{}
+					patchOptions.ApplyOptions(opts)
+					patches = append(patches, patchOptions)
+
+					return nil
+				},
+			}).Build()
+
+			err := applyObjects(context.Background(), fakeclient, tc.fieldManager, []unstructured.Unstructured{obj})
+			if tc.conflict {
+				var reasonErr *ReasonError
+				g.Expect(errors.As(err, &reasonErr)).To(BeTrue())
+				g.Expect(reasonErr.Reason).To(Equal(operatorv1.ApplyConflictReason))
+
+				return
+			}
+
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(patches).To(HaveLen(1))
+			g.Expect(patches[0].FieldManager).To(Equal(tc.expectedFieldManager))
+			// Conflicts must be explicit, ownership is never forced.
+			g.Expect(patches[0].Force).To(BeNil())
+		})
+	}
+}
@@ -0,0 +1,104 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	operatorv1 "sigs.k8s.io/cluster-api-operator/api/v1alpha2"
+)
+
+// checkServiceAccount waits for the ServiceAccount set by spec.deployment.serviceAccountName to exist before
+// installing the components, unless they include it, as it's usually created by another tool along with its
+// cloud IAM bindings, e.g. for IRSA or Workload Identity. The spec.deployment.serviceAccountAnnotations are then
+// set on the external ServiceAccount, at each reconciliation so they are restored if they're removed.
+func (p *phaseReconciler) checkServiceAccount(ctx context.Context) (reconcile.Result, error) {
+	dSpec := p.provider.GetSpec().Deployment
+	if dSpec == nil || dSpec.ServiceAccountName == "" {
+		return reconcile.Result{}, nil
+	}
+
+	key := client.ObjectKey{Namespace: p.components.TargetNamespace(), Name: dSpec.ServiceAccountName}
+
+	for _, obj := range p.componentsToInstall() {
+		if obj.GetKind() == serviceAccountKind && obj.GetNamespace() == key.Namespace && obj.GetName() == key.Name {
+			return reconcile.Result{}, nil
+		}
+	}
+
+	sa := &corev1.ServiceAccount{}
+
+	err := p.ctrlClient.Get(ctx, key, sa)
+	if err == nil {
+		if err := p.annotateServiceAccount(ctx, sa); err != nil {
+			return reconcile.Result{}, wrapPhaseError(err, operatorv1.ServiceAccountAnnotationFailedReason)
+		}
+
+		return reconcile.Result{}, nil
+	}
+
+	if !apierrors.IsNotFound(err) {
+		return reconcile.Result{}, wrapPhaseError(fmt.Errorf("failed to get ServiceAccount %s: %w", key, err), operatorv1.ServiceAccountNotFoundReason)
+	}
+
+	ctrl.LoggerFrom(ctx).Info("Waiting for the ServiceAccount to be created", "serviceAccount", key)
+	conditions.Set(p.provider, conditions.FalseCondition(operatorv1.PreflightCheckCondition, operatorv1.ServiceAccountNotFoundReason,
+		clusterv1.ConditionSeverityWarning, "ServiceAccount %s doesn't exist, it must be created before the provider is installed", key))
+
+	// The ServiceAccounts are not watched, so check again later.
+	return reconcile.Result{RequeueAfter: reconcileInterval(p.provider, p.reconcileInterval, preflightFailedRequeueAfter)}, nil
+}
+
+// annotateServiceAccount patches the external ServiceAccount with the spec.deployment.serviceAccountAnnotations
+// that are missing or have another value, leaving its other annotations untouched.
+func (p *phaseReconciler) annotateServiceAccount(ctx context.Context, sa *corev1.ServiceAccount) error {
+	annotations := p.provider.GetSpec().Deployment.ServiceAccountAnnotations
+
+	upToDate := true
+
+	for k, v := range annotations {
+		if current, ok := sa.Annotations[k]; !ok || current != v {
+			upToDate = false
+
+			break
+		}
+	}
+
+	if upToDate {
+		return nil
+	}
+
+	patchBase := client.MergeFrom(sa.DeepCopy())
+	sa.Annotations = mergeAnnotations(sa.Annotations, annotations)
+
+	ctrl.LoggerFrom(ctx).Info("Annotating the ServiceAccount", "serviceAccount", client.ObjectKeyFromObject(sa))
+
+	if err := p.ctrlClient.Patch(ctx, sa, patchBase); err != nil {
+		return fmt.Errorf("failed to annotate ServiceAccount %s: %w", client.ObjectKeyFromObject(sa), err)
+	}
+
+	return nil
+}
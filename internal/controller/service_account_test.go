@@ -0,0 +1,132 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	operatorv1 "sigs.k8s.io/cluster-api-operator/api/v1alpha2"
+	"sigs.k8s.io/cluster-api-operator/internal/controller/genericprovider"
+)
+
+func TestCheckServiceAccount(t *testing.T) {
+	externalServiceAccount := &corev1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "capa-irsa",
+			Namespace:   "capa-system",
+			Annotations: map[string]string{"eks.amazonaws.com/role-arn": "arn:aws:iam::123456789012:role/old", "team": "a"},
+		},
+	}
+
+	testCases := []struct {
+		name           string
+		deployment     *operatorv1.DeploymentSpec
+		objs           []client.Object
+		componentsObjs []unstructured.Unstructured
+		expectWaiting  bool
+		// expectedAnnotations are the annotations of the external ServiceAccount after the check.
+		expectedAnnotations map[string]string
+	}{
+		{
+			name: "no service account override",
+		},
+		{
+			name:          "external service account missing",
+			deployment:    &operatorv1.DeploymentSpec{ServiceAccountName: "capa-irsa"},
+			expectWaiting: true,
+		},
+		{
+			name:       "external service account exists",
+			deployment: &operatorv1.DeploymentSpec{ServiceAccountName: "capa-irsa"},
+			objs:       []client.Object{externalServiceAccount},
+			expectedAnnotations: map[string]string{
+				"eks.amazonaws.com/role-arn": "arn:aws:iam::123456789012:role/old",
+				"team":                       "a",
+			},
+		},
+		{
+			name: "external service account annotated",
+			deployment: &operatorv1.DeploymentSpec{
+				ServiceAccountName:        "capa-irsa",
+				ServiceAccountAnnotations: map[string]string{"eks.amazonaws.com/role-arn": "arn:aws:iam::123456789012:role/capa"},
+			},
+			objs: []client.Object{externalServiceAccount},
+			expectedAnnotations: map[string]string{
+				"eks.amazonaws.com/role-arn": "arn:aws:iam::123456789012:role/capa",
+				"team":                       "a",
+			},
+		},
+		{
+			name:       "service account of the components",
+			deployment: &operatorv1.DeploymentSpec{ServiceAccountName: "capa-irsa"},
+			componentsObjs: []unstructured.Unstructured{
+				newUnstructured(corev1.SchemeGroupVersion.WithKind("ServiceAccount"), "capa-system", "capa-irsa"),
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			p := &phaseReconciler{
+				ctrlClient: fake.NewClientBuilder().WithScheme(setupScheme()).WithObjects(tc.objs...).Build(),
+				provider: &genericprovider.InfrastructureProviderWrapper{
+					InfrastructureProvider: &operatorv1.InfrastructureProvider{
+						ObjectMeta: metav1.ObjectMeta{Name: "aws", Namespace: "capa-system"},
+						Spec: operatorv1.InfrastructureProviderSpec{
+							ProviderSpec: operatorv1.ProviderSpec{Deployment: tc.deployment},
+						},
+					},
+				},
+				components: &fakeComponents{objs: tc.componentsObjs, targetNamespace: "capa-system"},
+			}
+
+			res, err := p.checkServiceAccount(context.Background())
+			g.Expect(err).ToNot(HaveOccurred())
+
+			if tc.expectedAnnotations != nil {
+				sa := &corev1.ServiceAccount{}
+				g.Expect(p.ctrlClient.Get(context.Background(), client.ObjectKeyFromObject(externalServiceAccount), sa)).To(Succeed())
+				g.Expect(sa.Annotations).To(Equal(tc.expectedAnnotations))
+			}
+
+			if !tc.expectWaiting {
+				g.Expect(res.IsZero()).To(BeTrue())
+				g.Expect(conditions.Has(p.provider, operatorv1.PreflightCheckCondition)).To(BeFalse())
+
+				return
+			}
+
+			g.Expect(res.RequeueAfter).To(Equal(preflightFailedRequeueAfter))
+			g.Expect(conditions.GetReason(p.provider, operatorv1.PreflightCheckCondition)).To(Equal(operatorv1.ServiceAccountNotFoundReason))
+			g.Expect(conditions.GetSeverity(p.provider, operatorv1.PreflightCheckCondition)).To(HaveValue(Equal(clusterv1.ConditionSeverityWarning)))
+			g.Expect(conditions.GetMessage(p.provider, operatorv1.PreflightCheckCondition)).To(Equal(
+				"ServiceAccount capa-system/capa-irsa doesn't exist, it must be created before the provider is installed"))
+		})
+	}
+}
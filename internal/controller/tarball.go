@@ -0,0 +1,311 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	operatorv1 "sigs.k8s.io/cluster-api-operator/api/v1alpha2"
+	"sigs.k8s.io/cluster-api-operator/internal/controller/genericprovider"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// maxTarballSize is the maximum size of a release tarball, and of the files extracted from it.
+	maxTarballSize = 50 * 1024 * 1024
+
+	defaultComponentsFileName = "components.yaml"
+)
+
+var tarballExtensions = []string{".tar.gz", ".tgz", ".tar"}
+
+// isTarballURL returns true if the url points to a release tarball.
+func isTarballURL(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+
+	for _, ext := range tarballExtensions {
+		if strings.HasSuffix(u.Path, ext) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// fetchTarballManifests downloads the provider release tarball and extracts the metadata and components
+// files from it. Extraction errors are reported in the preflight check condition.
+func (p *phaseReconciler) fetchTarballManifests(ctx context.Context, httpClient *http.Client) ([]byte, []byte, error) {
+	tarballURL := p.providerConfig.URL()
+
+	// The manifests stored from the same tarball are revalidated instead of downloading it again. Unlike the
+	// repository files, e.g. on GitHub or GitLab, whose URLs include the version, the same tarball URL can
+	// serve several versions, and the version stored last is the one revalidated.
+	previous, err := p.manifestsConfigMapFromURL(ctx, tarballURL)
+	if err != nil {
+		return nil, nil, wrapPhaseError(err, operatorv1.DownloadFailedReason)
+	}
+
+	etag := ""
+	if previous != nil {
+		etag = previous.Annotations[etagAnnotation]
+	}
+
+	data, etag, err := downloadTarball(ctx, httpClient, tarballURL, etag)
+	if errors.Is(err, errNotModified) {
+		ctrl.LoggerFrom(ctx).Info("Tarball not modified, using the stored provider manifests", "configMap", client.ObjectKeyFromObject(previous))
+
+		metadata, components, err := getManifestsData(*previous)
+		if err != nil {
+			return nil, nil, wrapPhaseError(err, operatorv1.DownloadFailedReason)
+		}
+
+		p.fetchedETag = etag
+
+		return []byte(metadata), []byte(components), nil
+	}
+
+	if err != nil {
+		err = fmt.Errorf("failed to download tarball %q for provider %q: %w", tarballURL, p.provider.GetName(), err)
+
+		return nil, nil, wrapPhaseError(err, operatorv1.DownloadFailedReason)
+	}
+
+	p.fetchedETag = etag
+
+	metadataNames := []string{p.metadataPath()}
+	componentsNames := []string{tarballComponentsFileName(p.provider), defaultComponentsFileName}
+
+	if fetchConfig := p.provider.GetSpec().FetchConfig; fetchConfig != nil && fetchConfig.ComponentsPath != "" {
+		componentsNames = []string{fetchConfig.ComponentsPath}
+	}
+
+	files, err := extractTarball(data, append(metadataNames, componentsNames...))
+	if err != nil {
+		err = fmt.Errorf("failed to extract tarball %q for provider %q: %w", tarballURL, p.provider.GetName(), err)
+
+		return nil, nil, wrapTarballError(err)
+	}
+
+	metadata := findTarballFile(files, metadataNames)
+	if metadata == nil {
+		err := fmt.Errorf("tarball %q for provider %q contains none of %q", tarballURL, p.provider.GetName(), metadataNames)
+
+		return nil, nil, wrapTarballError(err)
+	}
+
+	components := findTarballFile(files, componentsNames)
+	if components == nil {
+		err := fmt.Errorf("tarball %q for provider %q contains none of %q", tarballURL, p.provider.GetName(), componentsNames)
+
+		return nil, nil, wrapTarballError(err)
+	}
+
+	return metadata, components, nil
+}
+
+// wrapTarballError wraps a tarball extraction error so it's reported in the preflight check condition.
+func wrapTarballError(err error) error {
+	return &PhaseError{
+		Err:      err,
+		Type:     operatorv1.PreflightCheckCondition,
+		Reason:   operatorv1.TarballExtractionErrorReason,
+		Severity: clusterv1.ConditionSeverityError,
+	}
+}
+
+// tarballComponentsFileName returns the clusterctl components file name for the provider type,
+// e.g. infrastructure-components.yaml.
+func tarballComponentsFileName(provider genericprovider.GenericProvider) string {
+	prefix := "core-"
+	switch provider.GetObject().(type) {
+	case *operatorv1.BootstrapProvider:
+		prefix = "bootstrap-"
+	case *operatorv1.ControlPlaneProvider:
+		prefix = "control-plane-"
+	case *operatorv1.InfrastructureProvider:
+		prefix = "infrastructure-"
+	case *operatorv1.AddonProvider:
+		prefix = "addon-"
+	}
+
+	return prefix + defaultComponentsFileName
+}
+
+// downloadTarball downloads a tarball, failing if it exceeds maxTarballSize. It returns the ETag of the tarball, if
+// the server sets one. If an ETag is given, the tarball is only downloaded if it changed, or errNotModified is
+// returned.
+func downloadTarball(ctx context.Context, httpClient *http.Client, tarballURL, etag string) ([]byte, string, error) {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, tarballURL, http.NoBody)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if etag != "" {
+		request.Header.Set("If-None-Match", etag)
+	}
+
+	response, err := httpClient.Do(request)
+	if err != nil {
+		return nil, "", err
+	}
+
+	defer response.Body.Close()
+
+	if etag != "" && response.StatusCode == http.StatusNotModified {
+		return nil, etag, errNotModified
+	}
+
+	if response.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("got status %d", response.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(response.Body, maxTarballSize+1))
+	if err != nil {
+		return nil, "", err
+	}
+
+	if len(data) > maxTarballSize {
+		return nil, "", fmt.Errorf("tarball exceeds the maximum size of %d bytes", maxTarballSize)
+	}
+
+	return data, response.Header.Get("ETag"), nil
+}
+
+// extractTarball extracts the regular files with one of the given names from a gzip compressed
+// or plain tarball, keyed by their path. Extraction fails if the extracted files exceed maxTarballSize.
+func extractTarball(data []byte, names []string) (map[string][]byte, error) {
+	var reader io.Reader = bytes.NewReader(data)
+
+	br := bufio.NewReader(reader)
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gzr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		defer gzr.Close()
+
+		reader = gzr
+	} else {
+		reader = br
+	}
+
+	files := map[string][]byte{}
+	remaining := int64(maxTarballSize)
+	tr := tar.NewReader(reader)
+
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		name := path.Clean(strings.TrimPrefix(header.Name, "./"))
+		if !matchesTarballFile(name, names) {
+			continue
+		}
+
+		content, err := io.ReadAll(io.LimitReader(tr, remaining+1))
+		if err != nil {
+			return nil, err
+		}
+
+		remaining -= int64(len(content))
+		if remaining < 0 {
+			return nil, fmt.Errorf("extracted files exceed the maximum size of %d bytes", maxTarballSize)
+		}
+
+		files[name] = content
+	}
+
+	return files, nil
+}
+
+// matchesTarballFile returns true if the file path has one of the given names.
+func matchesTarballFile(filePath string, names []string) bool {
+	for _, name := range names {
+		if filePath == name || strings.HasSuffix(filePath, "/"+name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// findTarballFile returns the content of the file with the first matching name, preferring the files
+// closest to the tarball root, or nil if there is none.
+func findTarballFile(files map[string][]byte, names []string) []byte {
+	for _, name := range names {
+		var (
+			found     []byte
+			foundPath string
+		)
+
+		for filePath, content := range files {
+			if !matchesTarballFile(filePath, []string{name}) {
+				continue
+			}
+
+			if found == nil || isShallowerPath(filePath, foundPath) {
+				found, foundPath = content, filePath
+			}
+		}
+
+		if found != nil {
+			return found
+		}
+	}
+
+	return nil
+}
+
+// isShallowerPath returns true if path a is closer to the root than path b, or at the same depth
+// but sorted before it.
+func isShallowerPath(a, b string) bool {
+	if da, db := strings.Count(a, "/"), strings.Count(b, "/"); da != db {
+		return da < db
+	}
+
+	return a < b
+}
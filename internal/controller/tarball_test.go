@@ -0,0 +1,315 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterctlv1 "sigs.k8s.io/cluster-api/cmd/clusterctl/api/v1alpha3"
+	configclient "sigs.k8s.io/cluster-api/cmd/clusterctl/client/config"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	operatorv1 "sigs.k8s.io/cluster-api-operator/api/v1alpha2"
+	"sigs.k8s.io/cluster-api-operator/internal/controller/genericprovider"
+)
+
+func newTarball(t *testing.T, compress bool, files map[string]string) []byte {
+	t.Helper()
+
+	var (
+		buf bytes.Buffer
+		gzw *gzip.Writer
+		w   io.Writer = &buf
+	)
+
+	if compress {
+		gzw = gzip.NewWriter(&buf)
+		w = gzw
+	}
+
+	tw := tar.NewWriter(w)
+
+	for name, content := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0o600, Size: int64(len(content)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if gzw != nil {
+		if err := gzw.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return buf.Bytes()
+}
+
+func TestIsTarballURL(t *testing.T) {
+	g := NewWithT(t)
+
+	g.Expect(isTarballURL("https://example.com/releases/v1.0.0/provider.tar.gz")).To(BeTrue())
+	g.Expect(isTarballURL("https://example.com/releases/v1.0.0/provider.tgz?token=abc")).To(BeTrue())
+	g.Expect(isTarballURL("https://example.com/releases/v1.0.0/provider.tar")).To(BeTrue())
+	g.Expect(isTarballURL("https://github.com/owner/repo/releases")).To(BeFalse())
+	g.Expect(isTarballURL("https://example.com/releases/v1.0.0/components.yaml")).To(BeFalse())
+}
+
+func TestFetchTarballManifests(t *testing.T) {
+	testCases := []struct {
+		name               string
+		tarball            []byte
+		componentsPath     string
+		expectedMetadata   string
+		expectedComponents string
+		expectedReason     string
+	}{
+		{
+			name: "gzip tarball with files in a directory",
+			tarball: newTarball(t, true, map[string]string{
+				"provider-v1.0.0/metadata.yaml":                  "metadata",
+				"provider-v1.0.0/infrastructure-components.yaml": "components",
+				"provider-v1.0.0/README.md":                      "readme",
+			}),
+			expectedMetadata:   "metadata",
+			expectedComponents: "components",
+		},
+		{
+			name: "plain tarball with generic components file name",
+			tarball: newTarball(t, false, map[string]string{
+				"./metadata.yaml":   "metadata",
+				"./components.yaml": "components",
+			}),
+			expectedMetadata:   "metadata",
+			expectedComponents: "components",
+		},
+		{
+			name: "files closest to the root are preferred",
+			tarball: newTarball(t, true, map[string]string{
+				"metadata.yaml":                           "metadata",
+				"infrastructure-components.yaml":          "components",
+				"test/infrastructure-components.yaml":     "test components",
+				"test/e2e/infrastructure-components.yaml": "e2e components",
+			}),
+			expectedMetadata:   "metadata",
+			expectedComponents: "components",
+		},
+		{
+			name: "custom components path",
+			tarball: newTarball(t, true, map[string]string{
+				"metadata.yaml":               "metadata",
+				"components.yaml":             "components",
+				"my-provider-components.yaml": "custom components",
+			}),
+			componentsPath:     "my-provider-components.yaml",
+			expectedMetadata:   "metadata",
+			expectedComponents: "custom components",
+		},
+		{
+			name: "missing components file",
+			tarball: newTarball(t, true, map[string]string{
+				"metadata.yaml": "metadata",
+			}),
+			expectedReason: operatorv1.TarballExtractionErrorReason,
+		},
+		{
+			name:           "not a tarball",
+			tarball:        []byte("not a tarball"),
+			expectedReason: operatorv1.TarballExtractionErrorReason,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				_, _ = w.Write(tc.tarball)
+			}))
+			defer server.Close()
+
+			tarballURL := server.URL + "/provider.tar.gz"
+
+			p := &phaseReconciler{
+				provider: &genericprovider.InfrastructureProviderWrapper{
+					InfrastructureProvider: &operatorv1.InfrastructureProvider{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:      "my-provider",
+							Namespace: "test-namespace",
+						},
+						Spec: operatorv1.InfrastructureProviderSpec{
+							ProviderSpec: operatorv1.ProviderSpec{
+								Version: "v1.0.0",
+								FetchConfig: &operatorv1.FetchConfiguration{
+									URL:            tarballURL,
+									ComponentsPath: tc.componentsPath,
+								},
+							},
+						},
+					},
+				},
+				providerConfig: configclient.NewProvider("my-provider", tarballURL, clusterctlv1.InfrastructureProviderType),
+				ctrlClient:     fake.NewClientBuilder().WithScheme(setupScheme()).Build(),
+			}
+
+			metadata, components, err := p.fetchTarballManifests(context.TODO(), server.Client())
+			if tc.expectedReason != "" {
+				var pe *PhaseError
+				g.Expect(errors.As(err, &pe)).To(BeTrue())
+				g.Expect(pe.Type).To(Equal(operatorv1.PreflightCheckCondition))
+				g.Expect(pe.Reason).To(Equal(tc.expectedReason))
+
+				return
+			}
+
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(string(metadata)).To(Equal(tc.expectedMetadata))
+			g.Expect(string(components)).To(Equal(tc.expectedComponents))
+		})
+	}
+}
+
+func TestFetchTarballManifestsETag(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	tarball := newTarball(t, true, map[string]string{
+		"metadata.yaml":                  "metadata",
+		"infrastructure-components.yaml": "components",
+	})
+
+	etag := `"v1"`
+	downloads := 0
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if etag != "" {
+			if r.Header.Get("If-None-Match") == etag {
+				w.WriteHeader(http.StatusNotModified)
+
+				return
+			}
+
+			w.Header().Set("ETag", etag)
+		}
+
+		downloads++
+		_, _ = w.Write(tarball)
+	}))
+	defer server.Close()
+
+	tarballURL := server.URL + "/provider.tar.gz"
+
+	provider := &genericprovider.InfrastructureProviderWrapper{
+		InfrastructureProvider: &operatorv1.InfrastructureProvider{
+			TypeMeta:   metav1.TypeMeta{Kind: "InfrastructureProvider", APIVersion: operatorv1.GroupVersion.String()},
+			ObjectMeta: metav1.ObjectMeta{Name: "my-provider", Namespace: "test-namespace"},
+			Spec: operatorv1.InfrastructureProviderSpec{
+				ProviderSpec: operatorv1.ProviderSpec{
+					Version:     "v1.0.0",
+					FetchConfig: &operatorv1.FetchConfiguration{URL: tarballURL},
+				},
+			},
+		},
+	}
+
+	fakeClient := fake.NewClientBuilder().WithScheme(setupScheme()).Build()
+
+	newPhaseReconciler := func() *phaseReconciler {
+		return &phaseReconciler{
+			provider:       provider,
+			providerConfig: configclient.NewProvider("my-provider", tarballURL, clusterctlv1.InfrastructureProviderType),
+			ctrlClient:     fakeClient,
+		}
+	}
+
+	// The first download stores the ETag with the manifests.
+	p := newPhaseReconciler()
+
+	metadata, components, err := p.fetchTarballManifests(ctx, server.Client())
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(p.createManifestsConfigMap(ctx, metadata, components, false)).To(Succeed())
+	g.Expect(downloads).To(Equal(1))
+
+	stored := &corev1.ConfigMap{}
+	g.Expect(fakeClient.Get(ctx, client.ObjectKey{Namespace: "test-namespace", Name: "infrastructure-my-provider-v1.0.0"}, stored)).To(Succeed())
+	g.Expect(stored.Annotations).To(HaveKeyWithValue(etagAnnotation, etag))
+	g.Expect(stored.Annotations).To(HaveKeyWithValue(sourceURLAnnotation, tarballURL))
+
+	// Another version from the same unchanged tarball reuses the stored manifests.
+	provider.Spec.Version = "v1.0.1"
+	p = newPhaseReconciler()
+
+	metadata, components, err = p.fetchTarballManifests(ctx, server.Client())
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(downloads).To(Equal(1))
+	g.Expect(string(metadata)).To(Equal("metadata"))
+	g.Expect(string(components)).To(Equal("components"))
+	g.Expect(p.fetchedETag).To(Equal(etag))
+
+	// A changed tarball is downloaded again.
+	etag = `"v2"`
+	p = newPhaseReconciler()
+
+	_, _, err = p.fetchTarballManifests(ctx, server.Client())
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(downloads).To(Equal(2))
+	g.Expect(p.fetchedETag).To(Equal(etag))
+
+	// Without ETag, the tarball is downloaded in full and no ETag is stored.
+	etag = ""
+	provider.Spec.Version = "v1.0.2"
+	p = newPhaseReconciler()
+
+	metadata, components, err = p.fetchTarballManifests(ctx, server.Client())
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(downloads).To(Equal(3))
+	g.Expect(p.createManifestsConfigMap(ctx, metadata, components, false)).To(Succeed())
+
+	g.Expect(fakeClient.Get(ctx, client.ObjectKey{Namespace: "test-namespace", Name: "infrastructure-my-provider-v1.0.2"}, stored)).To(Succeed())
+	g.Expect(stored.Annotations).ToNot(HaveKey(etagAnnotation))
+}
+
+func TestExtractTarballSizeLimit(t *testing.T) {
+	g := NewWithT(t)
+
+	tarball := newTarball(t, true, map[string]string{
+		"metadata.yaml":   "metadata",
+		"components.yaml": string(make([]byte, maxTarballSize+1)),
+	})
+
+	_, err := extractTarball(tarball, []string{"metadata.yaml", "components.yaml"})
+	g.Expect(err).To(MatchError(ContainSubstring("exceed the maximum size")))
+}
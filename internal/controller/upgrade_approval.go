@@ -0,0 +1,86 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	operatorv1 "sigs.k8s.io/cluster-api-operator/api/v1alpha2"
+)
+
+const (
+	upgradeReadyMessage    = "Upgrade from %s to %s is ready, set the %s annotation to %q to apply it"
+	upgradeApprovedMessage = "Upgrade from %s to %s is approved, applying it"
+)
+
+// checkUpgradeApproval holds the upgrade of a provider with spec.upgrade.requireApproval once the manifests of the
+// target version are fetched, before the installed components are deleted, until the approve upgrade annotation is
+// set to the target version. The UpgradeAwaitingApproval condition reports the upgrade waiting for approval
+// meanwhile, and the approved upgrade until it's applied.
+func (p *phaseReconciler) checkUpgradeApproval(ctx context.Context) (reconcile.Result, error) {
+	installedVersion := p.provider.GetStatus().InstalledVersion
+	targetVersion := p.components.Version()
+
+	upgrade := p.provider.GetSpec().Upgrade
+	if upgrade == nil || !upgrade.RequireApproval || installedVersion == nil || *installedVersion == targetVersion {
+		conditions.Delete(p.provider, operatorv1.UpgradeAwaitingApprovalCondition)
+
+		return reconcile.Result{}, nil
+	}
+
+	if p.provider.GetAnnotations()[operatorv1.ApproveUpgradeAnnotation] == targetVersion {
+		ctrl.LoggerFrom(ctx).Info("Upgrade approved", "installedVersion", *installedVersion, "targetVersion", targetVersion)
+		conditions.Set(p.provider, conditions.FalseCondition(operatorv1.UpgradeAwaitingApprovalCondition, operatorv1.UpgradeApprovedReason,
+			clusterv1.ConditionSeverityInfo, upgradeApprovedMessage, *installedVersion, targetVersion))
+
+		p.upgradeApproved = true
+
+		return reconcile.Result{}, nil
+	}
+
+	ctrl.LoggerFrom(ctx).Info("Upgrade ready, waiting for approval", "installedVersion", *installedVersion, "targetVersion", targetVersion)
+	conditions.Set(p.provider, &clusterv1.Condition{
+		Type:    operatorv1.UpgradeAwaitingApprovalCondition,
+		Status:  corev1.ConditionTrue,
+		Reason:  operatorv1.WaitingForApprovalReason,
+		Message: fmt.Sprintf(upgradeReadyMessage, *installedVersion, targetVersion, operatorv1.ApproveUpgradeAnnotation, targetVersion),
+	})
+
+	// Setting the annotation triggers a reconciliation, the requeue only picks up newer target versions.
+	return reconcile.Result{RequeueAfter: autoUpgradeResyncPeriod}, nil
+}
+
+// clearUpgradeApproval removes the approve upgrade annotation and the UpgradeAwaitingApproval condition once the
+// approved upgrade is applied, so the next upgrade requires a new approval.
+func (p *phaseReconciler) clearUpgradeApproval() {
+	if !p.upgradeApproved {
+		return
+	}
+
+	annotations := p.provider.GetAnnotations()
+	delete(annotations, operatorv1.ApproveUpgradeAnnotation)
+	p.provider.SetAnnotations(annotations)
+
+	conditions.Delete(p.provider, operatorv1.UpgradeAwaitingApprovalCondition)
+}
@@ -0,0 +1,195 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/cluster-api/util/conditions"
+
+	operatorv1 "sigs.k8s.io/cluster-api-operator/api/v1alpha2"
+	"sigs.k8s.io/cluster-api-operator/internal/controller/genericprovider"
+)
+
+func TestCheckUpgradeApproval(t *testing.T) {
+	testCases := []struct {
+		name             string
+		upgrade          *operatorv1.UpgradeOptions
+		installedVersion *string
+		approvedVersion  string
+		expectReason     string
+		expectApproved   bool
+	}{
+		{
+			name:             "approval not required",
+			installedVersion: pointer.String("v2.1.4"),
+		},
+		{
+			name:    "fresh installation",
+			upgrade: &operatorv1.UpgradeOptions{RequireApproval: true},
+		},
+		{
+			name:             "reinstall of the installed version",
+			upgrade:          &operatorv1.UpgradeOptions{RequireApproval: true},
+			installedVersion: pointer.String("v2.2.0"),
+		},
+		{
+			name:             "upgrade waiting for approval",
+			upgrade:          &operatorv1.UpgradeOptions{RequireApproval: true},
+			installedVersion: pointer.String("v2.1.4"),
+			expectReason:     operatorv1.WaitingForApprovalReason,
+		},
+		{
+			name:             "approval of another version",
+			upgrade:          &operatorv1.UpgradeOptions{RequireApproval: true},
+			installedVersion: pointer.String("v2.1.4"),
+			approvedVersion:  "v2.1.5",
+			expectReason:     operatorv1.WaitingForApprovalReason,
+		},
+		{
+			name:             "approved upgrade",
+			upgrade:          &operatorv1.UpgradeOptions{RequireApproval: true},
+			installedVersion: pointer.String("v2.1.4"),
+			approvedVersion:  "v2.2.0",
+			expectReason:     operatorv1.UpgradeApprovedReason,
+			expectApproved:   true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			provider := &operatorv1.InfrastructureProvider{
+				ObjectMeta: metav1.ObjectMeta{Name: "aws", Namespace: "capa-system", Annotations: map[string]string{}},
+				Spec: operatorv1.InfrastructureProviderSpec{
+					ProviderSpec: operatorv1.ProviderSpec{Version: "v2.2.0", Upgrade: tc.upgrade},
+				},
+				Status: operatorv1.InfrastructureProviderStatus{
+					ProviderStatus: operatorv1.ProviderStatus{InstalledVersion: tc.installedVersion},
+				},
+			}
+
+			if tc.approvedVersion != "" {
+				provider.Annotations[operatorv1.ApproveUpgradeAnnotation] = tc.approvedVersion
+			}
+
+			p := &phaseReconciler{
+				provider:   &genericprovider.InfrastructureProviderWrapper{InfrastructureProvider: provider},
+				components: &fakeComponents{version: "v2.2.0"},
+			}
+
+			res, err := p.checkUpgradeApproval(context.Background())
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(p.upgradeApproved).To(Equal(tc.expectApproved))
+
+			switch tc.expectReason {
+			case "":
+				g.Expect(res.IsZero()).To(BeTrue())
+				g.Expect(conditions.Has(p.provider, operatorv1.UpgradeAwaitingApprovalCondition)).To(BeFalse())
+			case operatorv1.UpgradeApprovedReason:
+				g.Expect(res.IsZero()).To(BeTrue())
+				g.Expect(conditions.IsFalse(p.provider, operatorv1.UpgradeAwaitingApprovalCondition)).To(BeTrue())
+				g.Expect(conditions.GetReason(p.provider, operatorv1.UpgradeAwaitingApprovalCondition)).To(Equal(operatorv1.UpgradeApprovedReason))
+				g.Expect(conditions.GetMessage(p.provider, operatorv1.UpgradeAwaitingApprovalCondition)).To(Equal(
+					"Upgrade from v2.1.4 to v2.2.0 is approved, applying it"))
+			default:
+				g.Expect(res.RequeueAfter).To(Equal(autoUpgradeResyncPeriod))
+				g.Expect(conditions.IsTrue(p.provider, operatorv1.UpgradeAwaitingApprovalCondition)).To(BeTrue())
+				g.Expect(conditions.GetReason(p.provider, operatorv1.UpgradeAwaitingApprovalCondition)).To(Equal(operatorv1.WaitingForApprovalReason))
+				g.Expect(conditions.GetMessage(p.provider, operatorv1.UpgradeAwaitingApprovalCondition)).To(Equal(
+					"Upgrade from v2.1.4 to v2.2.0 is ready, set the operator.cluster.x-k8s.io/approve-upgrade annotation to \"v2.2.0\" to apply it"))
+			}
+		})
+	}
+}
+
+func TestClearUpgradeApproval(t *testing.T) {
+	g := NewWithT(t)
+
+	p := &phaseReconciler{
+		provider: &genericprovider.InfrastructureProviderWrapper{
+			InfrastructureProvider: &operatorv1.InfrastructureProvider{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "aws",
+					Namespace:   "capa-system",
+					Annotations: map[string]string{operatorv1.ApproveUpgradeAnnotation: "v2.2.0", "team": "a"},
+				},
+			},
+		},
+	}
+
+	// The annotation is only removed once the approved upgrade is applied.
+	p.clearUpgradeApproval()
+	g.Expect(p.provider.GetAnnotations()).To(HaveKey(operatorv1.ApproveUpgradeAnnotation))
+
+	p.upgradeApproved = true
+	p.clearUpgradeApproval()
+	g.Expect(p.provider.GetAnnotations()).To(Equal(map[string]string{"team": "a"}))
+}
+
+func TestUpgradeAwaitingApprovalTransitions(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	provider := &genericprovider.InfrastructureProviderWrapper{
+		InfrastructureProvider: &operatorv1.InfrastructureProvider{
+			ObjectMeta: metav1.ObjectMeta{Name: "aws", Namespace: "capa-system", Annotations: map[string]string{}},
+			Spec: operatorv1.InfrastructureProviderSpec{
+				ProviderSpec: operatorv1.ProviderSpec{Version: "v2.2.0", Upgrade: &operatorv1.UpgradeOptions{RequireApproval: true}},
+			},
+			Status: operatorv1.InfrastructureProviderStatus{
+				ProviderStatus: operatorv1.ProviderStatus{InstalledVersion: pointer.String("v2.1.4")},
+			},
+		},
+	}
+
+	newReconciler := func(version string) *phaseReconciler {
+		return &phaseReconciler{provider: provider, components: &fakeComponents{version: version}}
+	}
+
+	// The prepared upgrade waits for approval.
+	_, err := newReconciler("v2.2.0").checkUpgradeApproval(ctx)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(conditions.GetReason(provider, operatorv1.UpgradeAwaitingApprovalCondition)).To(Equal(operatorv1.WaitingForApprovalReason))
+
+	// Reverting the target version to the installed one clears the condition.
+	_, err = newReconciler("v2.1.4").checkUpgradeApproval(ctx)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(conditions.Has(provider, operatorv1.UpgradeAwaitingApprovalCondition)).To(BeFalse())
+
+	_, err = newReconciler("v2.2.0").checkUpgradeApproval(ctx)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(conditions.IsTrue(provider, operatorv1.UpgradeAwaitingApprovalCondition)).To(BeTrue())
+
+	// The approved upgrade is reported until it's applied.
+	provider.Annotations[operatorv1.ApproveUpgradeAnnotation] = "v2.2.0"
+
+	p := newReconciler("v2.2.0")
+	_, err = p.checkUpgradeApproval(ctx)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(conditions.IsFalse(provider, operatorv1.UpgradeAwaitingApprovalCondition)).To(BeTrue())
+	g.Expect(conditions.GetReason(provider, operatorv1.UpgradeAwaitingApprovalCondition)).To(Equal(operatorv1.UpgradeApprovedReason))
+
+	p.clearUpgradeApproval()
+	g.Expect(conditions.Has(provider, operatorv1.UpgradeAwaitingApprovalCondition)).To(BeFalse())
+	g.Expect(provider.GetAnnotations()).ToNot(HaveKey(operatorv1.ApproveUpgradeAnnotation))
+}
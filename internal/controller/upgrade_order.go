@@ -0,0 +1,122 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/utils/pointer"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	operatorv1 "sigs.k8s.io/cluster-api-operator/api/v1alpha2"
+	"sigs.k8s.io/cluster-api-operator/internal/controller/genericprovider"
+	"sigs.k8s.io/cluster-api-operator/internal/feature"
+	"sigs.k8s.io/cluster-api-operator/util"
+)
+
+const upgradeQueuedMessage = "Upgrade from %s to %s waits for the providers of the earlier stages to be upgraded and Ready: %s"
+
+// checkUpgradeOrder holds the upgrade of a provider, before the installed components are deleted, while providers
+// of an earlier stage, in the order clusterctl upgrades them (Core, Bootstrap, ControlPlane, Infrastructure, Addon),
+// have a pending upgrade or aren't Ready, so a provider never runs against the conversion webhooks and CRDs of
+// older providers it relies on. Providers reaching Ready are not watched across kinds, so the check is requeued.
+// It's guarded by the UpgradeOrdering feature gate.
+func (p *phaseReconciler) checkUpgradeOrder(ctx context.Context) (reconcile.Result, error) {
+	installedVersion := p.provider.GetStatus().InstalledVersion
+	targetVersion := p.components.Version()
+
+	if !p.featureEnabled(feature.UpgradeOrdering) || installedVersion == nil || *installedVersion == targetVersion {
+		conditions.Delete(p.provider, operatorv1.UpgradeQueuedCondition)
+
+		return reconcile.Result{}, nil
+	}
+
+	blocking, err := earlierStageProviders(ctx, p.ctrlClient, p.provider)
+	if err != nil {
+		return reconcile.Result{}, wrapPhaseError(err, operatorv1.WaitingForEarlierStagesReason)
+	}
+
+	if len(blocking) == 0 {
+		conditions.Delete(p.provider, operatorv1.UpgradeQueuedCondition)
+
+		return reconcile.Result{}, nil
+	}
+
+	ctrl.LoggerFrom(ctx).Info("Upgrade waiting for the providers of the earlier stages", "targetVersion", targetVersion, "providers", blocking)
+	conditions.Set(p.provider, &clusterv1.Condition{
+		Type:    operatorv1.UpgradeQueuedCondition,
+		Status:  corev1.ConditionTrue,
+		Reason:  operatorv1.WaitingForEarlierStagesReason,
+		Message: fmt.Sprintf(upgradeQueuedMessage, *installedVersion, targetVersion, strings.Join(blocking, ", ")),
+	})
+
+	return reconcile.Result{RequeueAfter: upgradeOrderRequeueAfter}, nil
+}
+
+// earlierStageProviders returns the sorted descriptions of the installed providers of an earlier upgrade stage than
+// the provider that have a pending upgrade or aren't Ready.
+func earlierStageProviders(ctx context.Context, c client.Client, provider genericprovider.GenericProvider) ([]string, error) {
+	lists := []genericprovider.GenericProviderList{
+		&genericprovider.CoreProviderListWrapper{CoreProviderList: &operatorv1.CoreProviderList{}},
+		&genericprovider.BootstrapProviderListWrapper{BootstrapProviderList: &operatorv1.BootstrapProviderList{}},
+		&genericprovider.ControlPlaneProviderListWrapper{ControlPlaneProviderList: &operatorv1.ControlPlaneProviderList{}},
+		&genericprovider.InfrastructureProviderListWrapper{InfrastructureProviderList: &operatorv1.InfrastructureProviderList{}},
+	}
+
+	stage := util.ClusterctlProviderType(provider).Order()
+	blocking := []string{}
+
+	for _, list := range lists {
+		if err := c.List(ctx, list.GetObject()); err != nil {
+			return nil, fmt.Errorf("failed to list providers: %w", err)
+		}
+
+		for _, other := range list.GetItems() {
+			if util.ClusterctlProviderType(other).Order() >= stage || other.GetStatus().InstalledVersion == nil {
+				continue
+			}
+
+			if hasPendingUpgrade(other) || !conditions.IsTrue(other, clusterv1.ReadyCondition) {
+				blocking = append(blocking, describeProvider(providerKind(other), client.ObjectKeyFromObject(other.GetObject())))
+			}
+		}
+	}
+
+	sort.Strings(blocking)
+
+	return blocking, nil
+}
+
+// hasPendingUpgrade returns true if the version the provider targets, the resolved version of a spec.version
+// wildcard, differs from its installed version. Providers without a version, which install the latest one,
+// only upgrade automatically and are not considered pending.
+func hasPendingUpgrade(provider genericprovider.GenericProvider) bool {
+	target := provider.GetSpec().Version
+	if isVersionWildcard(target) {
+		target = pointer.StringDeref(provider.GetStatus().ResolvedVersion, "")
+	}
+
+	return target != "" && target != pointer.StringDeref(provider.GetStatus().InstalledVersion, "")
+}
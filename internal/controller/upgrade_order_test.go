@@ -0,0 +1,228 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/pointer"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	operatorv1 "sigs.k8s.io/cluster-api-operator/api/v1alpha2"
+	"sigs.k8s.io/cluster-api-operator/internal/controller/genericprovider"
+	"sigs.k8s.io/cluster-api-operator/internal/feature"
+)
+
+func TestCheckUpgradeOrder(t *testing.T) {
+	g := NewWithT(t)
+
+	status := func(installedVersion string) operatorv1.ProviderStatus {
+		return operatorv1.ProviderStatus{
+			InstalledVersion: pointer.String(installedVersion),
+			Conditions:       clusterv1.Conditions{*conditions.TrueCondition(clusterv1.ReadyCondition)},
+		}
+	}
+
+	// All four providers have a pending upgrade.
+	providers := []genericprovider.GenericProvider{
+		&genericprovider.InfrastructureProviderWrapper{InfrastructureProvider: &operatorv1.InfrastructureProvider{
+			ObjectMeta: metav1.ObjectMeta{Name: "aws", Namespace: "capa-system"},
+			Spec:       operatorv1.InfrastructureProviderSpec{ProviderSpec: operatorv1.ProviderSpec{Version: "v2.2.0"}},
+			Status:     operatorv1.InfrastructureProviderStatus{ProviderStatus: status("v2.1.4")},
+		}},
+		&genericprovider.ControlPlaneProviderWrapper{ControlPlaneProvider: &operatorv1.ControlPlaneProvider{
+			ObjectMeta: metav1.ObjectMeta{Name: "kubeadm", Namespace: "capi-kubeadm-control-plane-system"},
+			Spec:       operatorv1.ControlPlaneProviderSpec{ProviderSpec: operatorv1.ProviderSpec{Version: "v1.5.1"}},
+			Status:     operatorv1.ControlPlaneProviderStatus{ProviderStatus: status("v1.4.4")},
+		}},
+		&genericprovider.BootstrapProviderWrapper{BootstrapProvider: &operatorv1.BootstrapProvider{
+			ObjectMeta: metav1.ObjectMeta{Name: "kubeadm", Namespace: "capi-kubeadm-bootstrap-system"},
+			Spec:       operatorv1.BootstrapProviderSpec{ProviderSpec: operatorv1.ProviderSpec{Version: "v1.5.1"}},
+			Status:     operatorv1.BootstrapProviderStatus{ProviderStatus: status("v1.4.4")},
+		}},
+		&genericprovider.CoreProviderWrapper{CoreProvider: &operatorv1.CoreProvider{
+			ObjectMeta: metav1.ObjectMeta{Name: "cluster-api", Namespace: "capi-system"},
+			Spec:       operatorv1.CoreProviderSpec{ProviderSpec: operatorv1.ProviderSpec{Version: "v1.5.x"}},
+			Status: operatorv1.CoreProviderStatus{ProviderStatus: operatorv1.ProviderStatus{
+				InstalledVersion: pointer.String("v1.4.4"),
+				ResolvedVersion:  pointer.String("v1.5.1"),
+				Conditions:       clusterv1.Conditions{*conditions.TrueCondition(clusterv1.ReadyCondition)},
+			}},
+		}},
+	}
+
+	objs := []client.Object{}
+	for _, p := range providers {
+		objs = append(objs, p.GetObject())
+	}
+
+	c := fake.NewClientBuilder().WithScheme(setupScheme()).WithObjects(objs...).WithStatusSubresource(objs...).Build()
+
+	targetVersion := func(p genericprovider.GenericProvider) string {
+		return pointer.StringDeref(p.GetStatus().ResolvedVersion, p.GetSpec().Version)
+	}
+
+	// Each round upgrades the providers whose upgrade isn't held, and leaves them not Ready until the next round.
+	upgraded := [][]string{}
+
+	for round := 0; round < len(providers) && len(upgraded) < len(providers); round++ {
+		upgrading := []genericprovider.GenericProvider{}
+
+		for _, provider := range providers {
+			g.Expect(c.Get(context.Background(), client.ObjectKeyFromObject(provider.GetObject()), provider.GetObject())).To(Succeed())
+
+			if !hasPendingUpgrade(provider) {
+				continue
+			}
+
+			p := &phaseReconciler{
+				ctrlClient: c,
+				provider:   provider,
+				components: &fakeComponents{version: targetVersion(provider)},
+			}
+
+			res, err := p.checkUpgradeOrder(context.Background())
+			g.Expect(err).ToNot(HaveOccurred())
+
+			if !res.IsZero() {
+				g.Expect(res.RequeueAfter).To(Equal(upgradeOrderRequeueAfter))
+				g.Expect(conditions.GetReason(provider, operatorv1.UpgradeQueuedCondition)).To(Equal(operatorv1.WaitingForEarlierStagesReason))
+
+				continue
+			}
+
+			g.Expect(conditions.Has(provider, operatorv1.UpgradeQueuedCondition)).To(BeFalse())
+
+			upgrading = append(upgrading, provider)
+		}
+
+		stage := []string{}
+
+		for _, provider := range upgrading {
+			s := provider.GetStatus()
+			s.InstalledVersion = pointer.String(targetVersion(provider))
+			provider.SetStatus(s)
+			conditions.MarkFalse(provider, clusterv1.ReadyCondition, operatorv1.DeploymentUnavailableReason, clusterv1.ConditionSeverityInfo, "")
+			g.Expect(c.Status().Update(context.Background(), provider.GetObject())).To(Succeed())
+
+			stage = append(stage, providerKind(provider))
+		}
+
+		upgraded = append(upgraded, stage)
+
+		// The providers of the stage become Ready once their new version is rolled out.
+		for _, provider := range upgrading {
+			conditions.MarkTrue(provider, clusterv1.ReadyCondition)
+			g.Expect(c.Status().Update(context.Background(), provider.GetObject())).To(Succeed())
+		}
+	}
+
+	g.Expect(upgraded).To(Equal([][]string{{"CoreProvider"}, {"BootstrapProvider"}, {"ControlPlaneProvider"}, {"InfrastructureProvider"}}))
+}
+
+func TestCheckUpgradeOrderNotReady(t *testing.T) {
+	g := NewWithT(t)
+
+	coreProvider := &operatorv1.CoreProvider{
+		ObjectMeta: metav1.ObjectMeta{Name: "cluster-api", Namespace: "capi-system"},
+		Spec:       operatorv1.CoreProviderSpec{ProviderSpec: operatorv1.ProviderSpec{Version: "v1.5.1"}},
+		Status: operatorv1.CoreProviderStatus{ProviderStatus: operatorv1.ProviderStatus{
+			InstalledVersion: pointer.String("v1.5.1"),
+			Conditions:       clusterv1.Conditions{*conditions.FalseCondition(clusterv1.ReadyCondition, operatorv1.DeploymentUnavailableReason, clusterv1.ConditionSeverityInfo, "")},
+		}},
+	}
+
+	p := &phaseReconciler{
+		ctrlClient: fake.NewClientBuilder().WithScheme(setupScheme()).WithObjects(coreProvider).Build(),
+		provider: &genericprovider.InfrastructureProviderWrapper{InfrastructureProvider: &operatorv1.InfrastructureProvider{
+			ObjectMeta: metav1.ObjectMeta{Name: "aws", Namespace: "capa-system"},
+			Spec:       operatorv1.InfrastructureProviderSpec{ProviderSpec: operatorv1.ProviderSpec{Version: "v2.2.0"}},
+			Status: operatorv1.InfrastructureProviderStatus{ProviderStatus: operatorv1.ProviderStatus{
+				InstalledVersion: pointer.String("v2.1.4"),
+			}},
+		}},
+		components: &fakeComponents{version: "v2.2.0"},
+	}
+
+	res, err := p.checkUpgradeOrder(context.Background())
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(res.RequeueAfter).To(Equal(upgradeOrderRequeueAfter))
+	g.Expect(conditions.IsTrue(p.provider, operatorv1.UpgradeQueuedCondition)).To(BeTrue())
+	g.Expect(conditions.GetMessage(p.provider, operatorv1.UpgradeQueuedCondition)).To(Equal(
+		"Upgrade from v2.1.4 to v2.2.0 waits for the providers of the earlier stages to be upgraded and Ready: CoreProvider capi-system/cluster-api"))
+
+	// A fresh installation is not held.
+	status := p.provider.GetStatus()
+	status.InstalledVersion = nil
+	p.provider.SetStatus(status)
+
+	res, err = p.checkUpgradeOrder(context.Background())
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(res.IsZero()).To(BeTrue())
+	g.Expect(conditions.Has(p.provider, operatorv1.UpgradeQueuedCondition)).To(BeFalse())
+}
+
+func TestCheckUpgradeOrderFeatureGate(t *testing.T) {
+	g := NewWithT(t)
+
+	coreProvider := &operatorv1.CoreProvider{
+		ObjectMeta: metav1.ObjectMeta{Name: "cluster-api", Namespace: "capi-system"},
+		Spec:       operatorv1.CoreProviderSpec{ProviderSpec: operatorv1.ProviderSpec{Version: "v1.5.1"}},
+		Status: operatorv1.CoreProviderStatus{ProviderStatus: operatorv1.ProviderStatus{
+			InstalledVersion: pointer.String("v1.4.4"),
+		}},
+	}
+
+	gates := feature.MutableGates.DeepCopy()
+
+	p := &phaseReconciler{
+		ctrlClient: fake.NewClientBuilder().WithScheme(setupScheme()).WithObjects(coreProvider).Build(),
+		provider: &genericprovider.InfrastructureProviderWrapper{InfrastructureProvider: &operatorv1.InfrastructureProvider{
+			ObjectMeta: metav1.ObjectMeta{Name: "aws", Namespace: "capa-system"},
+			Status: operatorv1.InfrastructureProviderStatus{ProviderStatus: operatorv1.ProviderStatus{
+				InstalledVersion: pointer.String("v2.1.4"),
+			}},
+		}},
+		components:   &fakeComponents{version: "v2.2.0"},
+		featureGates: gates,
+	}
+
+	// The gate is enabled by default.
+	res, err := p.checkUpgradeOrder(context.Background())
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(res.RequeueAfter).To(Equal(upgradeOrderRequeueAfter))
+	g.Expect(conditions.Has(p.provider, operatorv1.UpgradeQueuedCondition)).To(BeTrue())
+
+	g.Expect(gates.Set("UpgradeOrdering=false")).To(Succeed())
+
+	res, err = p.checkUpgradeOrder(context.Background())
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(res.IsZero()).To(BeTrue())
+	g.Expect(conditions.Has(p.provider, operatorv1.UpgradeQueuedCondition)).To(BeFalse())
+
+	g.Expect(gates.Set("UpgradeOrdering=true")).To(Succeed())
+
+	res, err = p.checkUpgradeOrder(context.Background())
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(res.RequeueAfter).To(Equal(upgradeOrderRequeueAfter))
+}
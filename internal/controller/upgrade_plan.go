@@ -0,0 +1,206 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	versionutil "k8s.io/apimachinery/pkg/util/version"
+	"k8s.io/utils/pointer"
+	clusterctlv1 "sigs.k8s.io/cluster-api/cmd/clusterctl/api/v1alpha3"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	operatorv1 "sigs.k8s.io/cluster-api-operator/api/v1alpha2"
+	"sigs.k8s.io/cluster-api-operator/internal/controller/genericprovider"
+	"sigs.k8s.io/cluster-api-operator/util"
+)
+
+// UpgradeTarget is the newest version of a provider abiding by a contract.
+type UpgradeTarget struct {
+	// Contract is the Cluster API contract the version abides by, e.g. v1beta1.
+	Contract string
+	// Version is the newest version abiding by the contract.
+	Version string
+	// Allowed is true if the contract matches the one of the core provider, or is tolerated by the provider
+	// contract policy, so the operator would upgrade to the version.
+	Allowed bool
+}
+
+// ProviderUpgradePlan lists the versions a provider can be upgraded to, like `clusterctl upgrade plan`.
+type ProviderUpgradePlan struct {
+	Kind      string
+	Namespace string
+	Name      string
+	// CurrentVersion is the installed version, or the spec version if the provider is not installed yet.
+	CurrentVersion string
+	// CurrentContract is the contract of the installed version, if any.
+	CurrentContract string
+	// Targets lists the newest version newer than the current one for each contract, from the newest version
+	// to the oldest. It's empty if the provider is up to date.
+	Targets []UpgradeTarget
+	// Err is set if the versions available for the provider couldn't be listed.
+	Err error
+}
+
+// UpgradePlans returns the upgrade plans of all the providers, sorted by type, namespace and name, along with the
+// contract of the core provider. Failing to compute the plan of a provider doesn't prevent computing the other ones,
+// the error is reported in its plan instead.
+func UpgradePlans(ctx context.Context, c client.Client) ([]ProviderUpgradePlan, string, error) {
+	coreContract, err := getCoreProviderContract(ctx, c)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get the core provider contract: %w", err)
+	}
+
+	lists := []genericprovider.GenericProviderList{
+		&genericprovider.CoreProviderListWrapper{CoreProviderList: &operatorv1.CoreProviderList{}},
+		&genericprovider.BootstrapProviderListWrapper{BootstrapProviderList: &operatorv1.BootstrapProviderList{}},
+		&genericprovider.ControlPlaneProviderListWrapper{ControlPlaneProviderList: &operatorv1.ControlPlaneProviderList{}},
+		&genericprovider.InfrastructureProviderListWrapper{InfrastructureProviderList: &operatorv1.InfrastructureProviderList{}},
+		&genericprovider.AddonProviderListWrapper{AddonProviderList: &operatorv1.AddonProviderList{}},
+	}
+
+	plans := []ProviderUpgradePlan{}
+
+	for _, list := range lists {
+		if err := c.List(ctx, list.GetObject()); err != nil {
+			return nil, "", fmt.Errorf("failed to list providers: %w", err)
+		}
+
+		for _, provider := range list.GetItems() {
+			plan, err := upgradePlan(ctx, c, provider, coreContract)
+			plan.Err = err
+
+			plans = append(plans, plan)
+		}
+	}
+
+	sort.SliceStable(plans, func(i, j int) bool {
+		if plans[i].Kind != plans[j].Kind {
+			return plans[i].Kind < plans[j].Kind
+		}
+
+		if plans[i].Namespace != plans[j].Namespace {
+			return plans[i].Namespace < plans[j].Namespace
+		}
+
+		return plans[i].Name < plans[j].Name
+	})
+
+	return plans, coreContract, nil
+}
+
+// upgradePlan computes the upgrade plan of the provider from the versions available in its repository and the
+// release series of its metadata. Pre-releases are only considered in the beta channel, while the version
+// constraint is ignored, so the plan also shows the versions it holds back.
+func upgradePlan(ctx context.Context, c client.Client, provider genericprovider.GenericProvider, coreContract string) (ProviderUpgradePlan, error) {
+	status := provider.GetStatus()
+
+	plan := ProviderUpgradePlan{
+		Kind:            providerKind(provider),
+		Namespace:       provider.GetNamespace(),
+		Name:            provider.GetName(),
+		CurrentVersion:  pointer.StringDeref(status.InstalledVersion, provider.GetSpec().Version),
+		CurrentContract: pointer.StringDeref(status.Contract, ""),
+	}
+
+	var current *versionutil.Version
+
+	if plan.CurrentVersion != "" && !isVersionWildcard(plan.CurrentVersion) {
+		var err error
+
+		current, err = versionutil.ParseSemantic(plan.CurrentVersion)
+		if err != nil {
+			return plan, fmt.Errorf("failed to parse version %q: %w", plan.CurrentVersion, err)
+		}
+	}
+
+	p := newPhaseReconciler(GenericProviderReconciler{Client: c}, provider, nil)
+
+	if _, err := p.initializePhaseReconciler(ctx); err != nil {
+		return plan, err
+	}
+
+	repo, err := p.versionsRepository(ctx)
+	if err != nil {
+		return plan, fmt.Errorf("failed to create repo: %w", err)
+	}
+
+	repoVersions, err := repo.GetVersions()
+	if err != nil {
+		return plan, fmt.Errorf("failed to get a list of available versions: %w", err)
+	}
+
+	channel := provider.GetSpec().Channel
+	if channel != operatorv1.BetaChannel {
+		channel = operatorv1.StableChannel
+	}
+
+	candidates, err := getCandidateVersions(repoVersions, channel, "")
+	if err != nil {
+		return plan, err
+	}
+
+	// The metadata of the newest version contains the release series of all the previous ones too.
+	metadataPath := p.metadataPath()
+
+	file, err := repo.GetFile(candidates[0], metadataPath)
+	if err != nil {
+		return plan, fmt.Errorf("failed to read %q from the repository: %w", metadataPath, err)
+	}
+
+	metadata, err := decodeMetadata(file)
+	if err != nil {
+		return plan, fmt.Errorf("error decoding %q: %w", metadataPath, err)
+	}
+
+	plan.Targets = upgradeTargets(provider, metadata, candidates, current, coreContract)
+
+	return plan, nil
+}
+
+// upgradeTargets returns the newest candidate newer than the current version for each contract found in the
+// release series, from the newest version to the oldest. Candidates must be sorted from the newest to the oldest.
+func upgradeTargets(provider genericprovider.GenericProvider, metadata *clusterctlv1.Metadata, candidates []string,
+	current *versionutil.Version, coreContract string,
+) []UpgradeTarget {
+	targets := []UpgradeTarget{}
+	contracts := map[string]bool{}
+
+	for _, v := range candidates {
+		version := versionutil.MustParseSemantic(v)
+		if current != nil && !current.LessThan(version) {
+			break
+		}
+
+		for _, contract := range versionContracts(metadata, version) {
+			if contracts[contract] {
+				continue
+			}
+
+			contracts[contract] = true
+
+			// The core provider defines the contract, and every contract is allowed until it's installed.
+			allowed := util.IsCoreProvider(provider) || coreContract == "" || IsContractAllowed(provider, contract, coreContract)
+
+			targets = append(targets, UpgradeTarget{Contract: contract, Version: v, Allowed: allowed})
+		}
+	}
+
+	return targets
+}
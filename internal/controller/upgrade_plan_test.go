@@ -0,0 +1,143 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	operatorv1 "sigs.k8s.io/cluster-api-operator/api/v1alpha2"
+)
+
+const testCoreUpgradePlanMetadata = `apiVersion: clusterctl.cluster.x-k8s.io/v1alpha3
+kind: Metadata
+releaseSeries:
+- major: 2
+  minor: 0
+  contract: v1beta2
+- major: 1
+  minor: 5
+  contract: v1beta1
+- major: 1
+  minor: 4
+  contract: v1beta1
+`
+
+func TestUpgradePlans(t *testing.T) {
+	g := NewWithT(t)
+
+	manifestsConfigMap := func(namespace, version, metadata string) client.Object {
+		return &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      namespace + "-" + version,
+				Namespace: namespace,
+				Labels: map[string]string{
+					"provider-components":                namespace,
+					operatorv1.ConfigMapVersionLabelName: version,
+				},
+			},
+			Data: map[string]string{
+				metadataConfigMapKey:   metadata,
+				componentsConfigMapKey: "",
+			},
+		}
+	}
+
+	fetchConfig := func(namespace string) *operatorv1.FetchConfiguration {
+		return &operatorv1.FetchConfiguration{
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"provider-components": namespace}},
+		}
+	}
+
+	coreProvider := &operatorv1.CoreProvider{
+		ObjectMeta: metav1.ObjectMeta{Name: "cluster-api", Namespace: "capi-system"},
+		Spec: operatorv1.CoreProviderSpec{
+			ProviderSpec: operatorv1.ProviderSpec{Version: "v1.4.3", FetchConfig: fetchConfig("capi-system")},
+		},
+		Status: operatorv1.CoreProviderStatus{
+			ProviderStatus: operatorv1.ProviderStatus{InstalledVersion: pointer.String("v1.4.3"), Contract: pointer.String("v1beta1")},
+		},
+	}
+
+	awsProvider := &operatorv1.InfrastructureProvider{
+		ObjectMeta: metav1.ObjectMeta{Name: "aws", Namespace: "capa-system"},
+		Spec: operatorv1.InfrastructureProviderSpec{
+			ProviderSpec: operatorv1.ProviderSpec{Version: "v2.1.4", FetchConfig: fetchConfig("capa-system")},
+		},
+		Status: operatorv1.InfrastructureProviderStatus{
+			ProviderStatus: operatorv1.ProviderStatus{InstalledVersion: pointer.String("v2.1.4"), Contract: pointer.String("v1beta1")},
+		},
+	}
+
+	kubeadmProvider := &operatorv1.BootstrapProvider{
+		ObjectMeta: metav1.ObjectMeta{Name: "kubeadm", Namespace: "capi-kubeadm-bootstrap-system"},
+		Spec: operatorv1.BootstrapProviderSpec{
+			ProviderSpec: operatorv1.ProviderSpec{Version: "v1.5.2", FetchConfig: fetchConfig("capi-kubeadm-bootstrap-system")},
+		},
+	}
+
+	unknownProvider := &operatorv1.InfrastructureProvider{
+		ObjectMeta: metav1.ObjectMeta{Name: "unknown", Namespace: "unknown-system"},
+	}
+
+	c := fake.NewClientBuilder().WithScheme(setupScheme()).WithObjects(
+		coreProvider, awsProvider, kubeadmProvider, unknownProvider,
+		manifestsConfigMap("capi-system", "v1.4.3", testCoreUpgradePlanMetadata),
+		manifestsConfigMap("capi-system", "v1.5.2", testCoreUpgradePlanMetadata),
+		manifestsConfigMap("capi-system", "v2.0.0", testCoreUpgradePlanMetadata),
+		manifestsConfigMap("capi-system", "v2.1.0-rc.0", testCoreUpgradePlanMetadata),
+		manifestsConfigMap("capa-system", "v2.1.4", testTransitionalContractMetadata),
+		manifestsConfigMap("capa-system", "v2.1.5", testTransitionalContractMetadata),
+		manifestsConfigMap("capa-system", "v2.2.0", testTransitionalContractMetadata),
+		manifestsConfigMap("capi-kubeadm-bootstrap-system", "v1.5.2", testCoreUpgradePlanMetadata),
+	).Build()
+
+	plans, coreContract, err := UpgradePlans(context.Background(), c)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(coreContract).To(Equal("v1beta1"))
+	g.Expect(plans).To(HaveLen(4))
+
+	g.Expect(plans[0].Name).To(Equal("kubeadm"))
+	g.Expect(plans[0].Err).ToNot(HaveOccurred())
+	g.Expect(plans[0].CurrentVersion).To(Equal("v1.5.2"))
+	g.Expect(plans[0].Targets).To(BeEmpty())
+
+	g.Expect(plans[1].Name).To(Equal("cluster-api"))
+	g.Expect(plans[1].Err).ToNot(HaveOccurred())
+	g.Expect(plans[1].CurrentContract).To(Equal("v1beta1"))
+	g.Expect(plans[1].Targets).To(Equal([]UpgradeTarget{
+		{Contract: "v1beta2", Version: "v2.0.0", Allowed: true},
+		{Contract: "v1beta1", Version: "v1.5.2", Allowed: true},
+	}))
+
+	g.Expect(plans[2].Name).To(Equal("aws"))
+	g.Expect(plans[2].Err).ToNot(HaveOccurred())
+	g.Expect(plans[2].Targets).To(Equal([]UpgradeTarget{
+		{Contract: "v1beta2", Version: "v2.2.0", Allowed: false},
+		{Contract: "v1beta1", Version: "v2.2.0", Allowed: true},
+	}))
+
+	g.Expect(plans[3].Name).To(Equal("unknown"))
+	g.Expect(plans[3].Err).To(HaveOccurred())
+}
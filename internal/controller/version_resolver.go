@@ -0,0 +1,407 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	versionutil "k8s.io/apimachinery/pkg/util/version"
+	operatorv1 "sigs.k8s.io/cluster-api-operator/api/v1alpha2"
+	"sigs.k8s.io/cluster-api-operator/internal/controller/genericprovider"
+	"sigs.k8s.io/cluster-api-operator/util"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/cmd/clusterctl/client/repository"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+var (
+	autoUpgradeHeldBackMessage = "Upgrade to %s is held back until the core provider moves to its contract."
+	upgradeAvailableMessage    = "Version %s is available, set spec.version to upgrade."
+	// upgradeTargetUnavailableMessage lists the closest versions, e.g. "v2.0.0 (contract v1beta2)".
+	upgradeTargetUnavailableMessage = "No version abides by the contract of the core provider, closest available versions: %s."
+)
+
+// isVersionResolutionEnabled returns true if the provider version is picked from a channel or a version constraint.
+func isVersionResolutionEnabled(provider genericprovider.GenericProvider) bool {
+	spec := provider.GetSpec()
+
+	return spec.Channel != "" || spec.VersionConstraint != ""
+}
+
+// isAutoUpgradeEnabled returns true if the provider should be automatically upgraded within its channel
+// or version constraint.
+func isAutoUpgradeEnabled(provider genericprovider.GenericProvider) bool {
+	return provider.GetSpec().AutoUpgrade && !isManualUpgradeStrategy(provider) && isVersionResolutionEnabled(provider)
+}
+
+// isManualUpgradeStrategy returns true if the provider version must only be changed by the user.
+func isManualUpgradeStrategy(provider genericprovider.GenericProvider) bool {
+	return provider.GetSpec().UpgradeStrategy == operatorv1.ManualUpgradeStrategy
+}
+
+// isUpgradeCheckEnabled returns true if new versions should be periodically checked for, either to
+// upgrade the provider automatically or to report them with the manual upgrade strategy.
+func isUpgradeCheckEnabled(provider genericprovider.GenericProvider) bool {
+	return isAutoUpgradeEnabled(provider) || (isManualUpgradeStrategy(provider) && isVersionResolutionEnabled(provider))
+}
+
+// resolveVersion picks the newest version available in the provider channel and satisfying the provider
+// version constraint, records it to the provider status and sets it as provider version if no version is set
+// or if auto upgrade is enabled. Versions that would change the provider contract without the core provider
+// also moving to the new contract are held back. With the manual upgrade strategy the version is kept, and
+// newer versions are reported in the upgrade available condition.
+func (p *phaseReconciler) resolveVersion(ctx context.Context) (reconcile.Result, error) {
+	log := ctrl.LoggerFrom(ctx)
+
+	spec := p.provider.GetSpec()
+
+	if !isManualUpgradeStrategy(p.provider) || !isVersionResolutionEnabled(p.provider) {
+		conditions.Delete(p.provider, operatorv1.UpgradeAvailableCondition)
+	}
+
+	// Nothing to do if the version is pinned.
+	if !isVersionResolutionEnabled(p.provider) || (spec.Version != "" && !spec.AutoUpgrade && !isManualUpgradeStrategy(p.provider)) {
+		conditions.Delete(p.provider, operatorv1.UpgradeTargetUnavailableCondition)
+		conditions.Delete(p.provider, operatorv1.UpgradeCheckFailedCondition)
+
+		return reconcile.Result{}, nil
+	}
+
+	// Listing the versions is a check for a newer one too, so the periodic check waits for the next resync.
+	status := p.provider.GetStatus()
+	status.LastUpgradeCheckTime = &metav1.Time{Time: time.Now()}
+	p.provider.SetStatus(status)
+
+	repo, err := p.versionsRepository(ctx)
+	if err != nil {
+		err = fmt.Errorf("failed to create repo for provider %q: %w", p.provider.GetName(), err)
+
+		return reconcile.Result{}, wrapPhaseError(err, operatorv1.DownloadFailedReason)
+	}
+
+	repoVersions, err := repo.GetVersions()
+	if err != nil {
+		err = fmt.Errorf("failed to get a list of available versions for provider %q: %w", p.provider.GetName(), err)
+
+		return reconcile.Result{}, wrapPhaseError(err, operatorv1.DownloadFailedReason)
+	}
+
+	candidates, err := getCandidateVersions(repoVersions, spec.Channel, spec.VersionConstraint)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+
+	latestVersion := candidates[0]
+
+	status = p.provider.GetStatus()
+	status.LatestVersion = &latestVersion
+	p.provider.SetStatus(status)
+
+	selectedVersion, closestVersions, err := p.selectContractCompatibleVersion(ctx, repo, candidates)
+	if err != nil {
+		return reconcile.Result{}, wrapPhaseError(err, operatorv1.DownloadFailedReason)
+	}
+
+	if selectedVersion != latestVersion && isAutoUpgradeEnabled(p.provider) {
+		log.Info("Automatic upgrade is held back because of contract change", "version", latestVersion)
+		conditions.Set(p.provider, &clusterv1.Condition{
+			Type:    operatorv1.AutoUpgradePendingCondition,
+			Status:  corev1.ConditionTrue,
+			Reason:  operatorv1.ContractChangeHeldBackReason,
+			Message: fmt.Sprintf(autoUpgradeHeldBackMessage, latestVersion),
+		})
+	} else {
+		conditions.Delete(p.provider, operatorv1.AutoUpgradePendingCondition)
+	}
+
+	if selectedVersion == "" {
+		log.Info("No version abides by the core provider contract", "closestVersions", closestVersions)
+		conditions.Set(p.provider, &clusterv1.Condition{
+			Type:    operatorv1.UpgradeTargetUnavailableCondition,
+			Status:  corev1.ConditionTrue,
+			Reason:  operatorv1.NoMatchingReleaseSeriesReason,
+			Message: fmt.Sprintf(upgradeTargetUnavailableMessage, closestVersionsList(closestVersions)),
+		})
+
+		if spec.Version == "" {
+			err := fmt.Errorf("no version compatible with the core provider contract is available for provider %q", p.provider.GetName())
+
+			return reconcile.Result{}, wrapPhaseError(err, operatorv1.ContractMismatchReason)
+		}
+
+		conditions.Delete(p.provider, operatorv1.UpgradeAvailableCondition)
+
+		return reconcile.Result{}, nil
+	}
+
+	conditions.Delete(p.provider, operatorv1.UpgradeTargetUnavailableCondition)
+
+	if spec.Version != "" {
+		currentVersion, err := versionutil.ParseSemantic(spec.Version)
+		if err != nil {
+			return reconcile.Result{}, wrapPhaseError(err, fmt.Sprintf("cannot parse version string: %s", spec.Version))
+		}
+
+		// Never downgrade the provider, even if the newest matching version is older.
+		if !currentVersion.LessThan(versionutil.MustParseSemantic(selectedVersion)) {
+			conditions.Delete(p.provider, operatorv1.UpgradeAvailableCondition)
+
+			return reconcile.Result{}, nil
+		}
+
+		if isManualUpgradeStrategy(p.provider) {
+			log.Info("Newer version available, waiting for a manual upgrade", "targetVersion", selectedVersion)
+			conditions.Set(p.provider, &clusterv1.Condition{
+				Type:    operatorv1.UpgradeAvailableCondition,
+				Status:  corev1.ConditionTrue,
+				Reason:  operatorv1.NewerVersionAvailableReason,
+				Message: fmt.Sprintf(upgradeAvailableMessage, selectedVersion),
+			})
+
+			return reconcile.Result{}, nil
+		}
+	}
+
+	log.Info("Selecting provider version", "channel", spec.Channel, "constraint", spec.VersionConstraint, "version", selectedVersion)
+
+	spec.Version = selectedVersion
+	p.provider.SetSpec(spec)
+
+	return reconcile.Result{}, nil
+}
+
+// selectContractCompatibleVersion returns the newest candidate version abiding by the same contract as the
+// core provider, or by a contract tolerated by the provider contract policy. If there are none, an empty
+// string is returned along with the closest versions available, i.e. the newest candidate of each contract
+// found in the release series of the provider metadata. Candidates must be sorted from the newest to the oldest.
+func (p *phaseReconciler) selectContractCompatibleVersion(ctx context.Context, repo repository.Repository, candidates []string) (string, []string, error) {
+	// The core provider defines the contract, so it's never held back.
+	if util.IsCoreProvider(p.provider) {
+		return candidates[0], nil, nil
+	}
+
+	coreContract, err := getCoreProviderContract(ctx, p.ctrlClient)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to get the core provider contract: %w", err)
+	}
+
+	// Nothing to compare with if the core provider is not installed yet.
+	if coreContract == "" {
+		return candidates[0], nil, nil
+	}
+
+	// The metadata of the newest version contains the release series of all the previous ones too.
+	metadataPath := p.metadataPath()
+
+	file, err := repo.GetFile(candidates[0], metadataPath)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to read %q from the repository for provider %q: %w", metadataPath, p.provider.GetName(), err)
+	}
+
+	metadata, err := decodeMetadata(file)
+	if err != nil {
+		err = fmt.Errorf("error decoding %q for provider %q: %w", metadataPath, p.provider.GetName(), err)
+
+		return "", nil, withReason(err, operatorv1.DecodeFailedReason)
+	}
+
+	closestVersions := []string{}
+	contracts := map[string]bool{}
+
+	for _, v := range candidates {
+		// Versions of transitional release series may claim several contracts, any of them allowed will do.
+		claimed := versionContracts(metadata, versionutil.MustParseSemantic(v))
+
+		for _, contract := range claimed {
+			if IsContractAllowed(p.provider, contract, coreContract) {
+				return v, nil, nil
+			}
+		}
+
+		for _, contract := range claimed {
+			if !contracts[contract] {
+				contracts[contract] = true
+				closestVersions = append(closestVersions, fmt.Sprintf("%s (contract %s)", v, contract))
+			}
+		}
+	}
+
+	return "", closestVersions, nil
+}
+
+// closestVersionsList returns the closest versions as a comma separated list, or "none" if there are none.
+func closestVersionsList(closestVersions []string) string {
+	if len(closestVersions) == 0 {
+		return "none"
+	}
+
+	return strings.Join(closestVersions, ", ")
+}
+
+// checkVersionUpgrade resolves the newest version in the provider channel and version constraint, updating
+// the provider spec if a newer version is available. The versions are listed at most once per
+// autoUpgradeResyncPeriod, sharing the download slots with the manifests downloads, and the failures are
+// reported in the UpgradeCheckFailed condition instead, so they don't fail the reconciliation of the
+// installed provider.
+func (r *GenericProviderReconciler) checkVersionUpgrade(ctx context.Context, provider genericprovider.GenericProvider, now time.Time) {
+	log := ctrl.LoggerFrom(ctx)
+
+	if upgradeCheckDelay(provider, now) > 0 {
+		return
+	}
+
+	// The check is retried once a slot is free, see reconcileInstalled.
+	if !r.DownloadLimiter.tryAcquire(providerKey(provider)) {
+		log.Info("Too many concurrent downloads, postponing the check for a newer version")
+
+		return
+	}
+	defer r.DownloadLimiter.release()
+
+	reconciler := newPhaseReconciler(*r, provider, nil)
+	phases := []reconcilePhaseFn{
+		reconciler.initializePhaseReconciler,
+		reconciler.resolveVersion,
+	}
+
+	var err error
+
+	for _, phase := range phases {
+		if _, err = phase(ctx); err != nil {
+			break
+		}
+	}
+
+	// The check time is recorded whatever the outcome, so a failing check isn't retried on every reconciliation.
+	status := provider.GetStatus()
+	status.LastUpgradeCheckTime = &metav1.Time{Time: now}
+	provider.SetStatus(status)
+
+	if err != nil {
+		log.Error(err, "Failed to check for a newer version")
+
+		reason := operatorv1.UpgradeCheckErrorReason
+
+		var pe *PhaseError
+		if errors.As(err, &pe) {
+			reason = pe.Reason
+		}
+
+		conditions.Set(provider, &clusterv1.Condition{
+			Type:     operatorv1.UpgradeCheckFailedCondition,
+			Status:   corev1.ConditionTrue,
+			Severity: clusterv1.ConditionSeverityWarning,
+			Reason:   reason,
+			Message:  err.Error(),
+		})
+
+		return
+	}
+
+	conditions.Delete(provider, operatorv1.UpgradeCheckFailedCondition)
+}
+
+// upgradeCheckDelay returns how long to wait before checking for a newer version of the provider again, or
+// zero if the check is due.
+func upgradeCheckDelay(provider genericprovider.GenericProvider, now time.Time) time.Duration {
+	last := provider.GetStatus().LastUpgradeCheckTime
+	if last == nil {
+		return 0
+	}
+
+	return max(last.Add(autoUpgradeResyncPeriod).Sub(now), 0)
+}
+
+// versionsRepository returns the repository to list the provider versions from.
+func (p *phaseReconciler) versionsRepository(ctx context.Context) (repository.Repository, error) {
+	spec := p.provider.GetSpec()
+
+	if spec.FetchConfig != nil && spec.FetchConfig.Selector != nil {
+		repo, err := p.configmapRepository(ctx, spec.FetchConfig.Selector)
+
+		return p.withMetadataOverride(repo), err
+	}
+
+	httpClient, err := p.newRepositoryHTTPClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	repo, err := repositoryFactory(p.providerConfig, p.configClient.Variables(), httpClient)
+
+	return p.withMetadataOverride(repo), err
+}
+
+// getCandidateVersions returns the versions matching the channel rules and the version constraint,
+// sorted from the newest to the oldest. The stable channel excludes pre-releases, while the beta
+// channel includes them.
+func getCandidateVersions(repoVersions []string, channel, versionConstraint string) ([]string, error) {
+	var constraint *semver.Constraints
+
+	if versionConstraint != "" {
+		var err error
+
+		constraint, err = semver.NewConstraint(versionConstraint)
+		if err != nil {
+			return nil, wrapPhaseError(err, operatorv1.IncorrectVersionFormatReason)
+		}
+	}
+
+	candidates := []string{}
+
+	for _, v := range repoVersions {
+		parsedVersion, err := versionutil.ParseSemantic(v)
+		if err != nil {
+			continue
+		}
+
+		if channel == operatorv1.StableChannel && parsedVersion.PreRelease() != "" {
+			continue
+		}
+
+		if constraint != nil {
+			constraintVersion, err := semver.NewVersion(v)
+			if err != nil || !constraint.Check(constraintVersion) {
+				continue
+			}
+		}
+
+		candidates = append(candidates, v)
+	}
+
+	if len(candidates) == 0 {
+		err := fmt.Errorf("no versions available matching channel %q and version constraint %q", channel, versionConstraint)
+
+		return nil, wrapPhaseError(err, operatorv1.DownloadFailedReason)
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		return versionutil.MustParseSemantic(candidates[j]).LessThan(versionutil.MustParseSemantic(candidates[i]))
+	})
+
+	return candidates, nil
+}
@@ -0,0 +1,500 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	operatorv1 "sigs.k8s.io/cluster-api-operator/api/v1alpha2"
+	"sigs.k8s.io/cluster-api-operator/internal/controller/genericprovider"
+)
+
+func TestGetCandidateVersions(t *testing.T) {
+	testCases := []struct {
+		name        string
+		versions    []string
+		channel     string
+		constraint  string
+		expected    []string
+		expectError bool
+	}{
+		{
+			name:     "Stable channel excludes pre-releases",
+			versions: []string{"v1.0.0", "v1.2.0-beta.0", "v1.1.0"},
+			channel:  operatorv1.StableChannel,
+			expected: []string{"v1.1.0", "v1.0.0"},
+		},
+		{
+			name:     "Beta channel includes pre-releases",
+			versions: []string{"v1.0.0", "v1.2.0-beta.0", "v1.1.0"},
+			channel:  operatorv1.BetaChannel,
+			expected: []string{"v1.2.0-beta.0", "v1.1.0", "v1.0.0"},
+		},
+		{
+			name:     "Beta channel prefers final release over its pre-releases",
+			versions: []string{"v1.2.0-beta.0", "v1.2.0"},
+			channel:  operatorv1.BetaChannel,
+			expected: []string{"v1.2.0", "v1.2.0-beta.0"},
+		},
+		{
+			name:     "Incorrect versions are ignored",
+			versions: []string{"v1.0.0", "NOT_A_VERSION"},
+			channel:  operatorv1.StableChannel,
+			expected: []string{"v1.0.0"},
+		},
+		{
+			name:       "Version constraint without channel",
+			versions:   []string{"v1.4.0", "v1.5.2", "v1.5.3", "v1.6.0"},
+			constraint: "~1.5",
+			expected:   []string{"v1.5.3", "v1.5.2"},
+		},
+		{
+			name:       "Version constraint with channel",
+			versions:   []string{"v1.4.0", "v1.5.0", "v1.6.0"},
+			channel:    operatorv1.StableChannel,
+			constraint: ">= 1.4.0, < 1.6.0",
+			expected:   []string{"v1.5.0", "v1.4.0"},
+		},
+		{
+			name:        "Invalid version constraint",
+			versions:    []string{"v1.4.0"},
+			constraint:  "NOT_A_CONSTRAINT",
+			expectError: true,
+		},
+		{
+			name:        "No versions in channel",
+			versions:    []string{"v1.2.0-beta.0"},
+			channel:     operatorv1.StableChannel,
+			expectError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			got, err := getCandidateVersions(tc.versions, tc.channel, tc.constraint)
+			if tc.expectError {
+				g.Expect(err).To(HaveOccurred())
+
+				return
+			}
+
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(got).To(Equal(tc.expected))
+		})
+	}
+}
+
+func TestResolveVersion(t *testing.T) {
+	testCases := []struct {
+		name              string
+		version           string
+		channel           string
+		constraint        string
+		autoUpgrade       bool
+		strategy          operatorv1.UpgradeStrategyType
+		coreContract      string
+		tolerated         []string
+		expectedVersion   string
+		expectedLatest    string
+		expectedPending   bool
+		expectedAvailable string
+		expectedClosest   string
+		metadata          string
+	}{
+		{
+			name:            "Version is picked from stable channel",
+			channel:         operatorv1.StableChannel,
+			expectedVersion: "v1.1.0",
+			expectedLatest:  "v1.1.0",
+		},
+		{
+			name:            "Version is picked from beta channel",
+			channel:         operatorv1.BetaChannel,
+			expectedVersion: "v1.2.0-beta.0",
+			expectedLatest:  "v1.2.0-beta.0",
+		},
+		{
+			name:            "Pinned version is kept without auto upgrade",
+			version:         "v1.0.0",
+			channel:         operatorv1.StableChannel,
+			expectedVersion: "v1.0.0",
+		},
+		{
+			name:            "Version is upgraded within channel with auto upgrade",
+			version:         "v1.0.0",
+			channel:         operatorv1.StableChannel,
+			autoUpgrade:     true,
+			expectedVersion: "v1.1.0",
+			expectedLatest:  "v1.1.0",
+		},
+		{
+			name:            "Version is never downgraded",
+			version:         "v1.2.0-beta.0",
+			channel:         operatorv1.StableChannel,
+			autoUpgrade:     true,
+			expectedVersion: "v1.2.0-beta.0",
+			expectedLatest:  "v1.1.0",
+		},
+		{
+			name:            "Nothing happens without channel and version constraint",
+			version:         "v1.0.0",
+			autoUpgrade:     true,
+			expectedVersion: "v1.0.0",
+		},
+		{
+			name:            "Version is upgraded within version constraint with auto upgrade",
+			version:         "v1.0.0",
+			constraint:      "< 1.1.0",
+			autoUpgrade:     true,
+			expectedVersion: "v1.0.1",
+			expectedLatest:  "v1.0.1",
+		},
+		{
+			name:            "Version is upgraded if core provider uses the same contract",
+			version:         "v1.0.0",
+			channel:         operatorv1.StableChannel,
+			autoUpgrade:     true,
+			coreContract:    "v1beta1",
+			expectedVersion: "v1.1.0",
+			expectedLatest:  "v1.1.0",
+		},
+		{
+			name:            "Contract change is held back until core provider moves",
+			version:         "v1.0.0",
+			channel:         operatorv1.StableChannel,
+			autoUpgrade:     true,
+			coreContract:    "v1alpha4",
+			expectedVersion: "v1.0.1",
+			expectedLatest:  "v1.1.0",
+			expectedPending: true,
+		},
+		{
+			name:            "Contract change tolerated by the contract policy is not held back",
+			version:         "v1.0.0",
+			channel:         operatorv1.StableChannel,
+			autoUpgrade:     true,
+			coreContract:    "v1alpha4",
+			tolerated:       []string{"v1beta1"},
+			expectedVersion: "v1.1.0",
+			expectedLatest:  "v1.1.0",
+		},
+		{
+			name:              "Version is frozen with manual upgrade strategy",
+			version:           "v1.0.0",
+			channel:           operatorv1.StableChannel,
+			autoUpgrade:       true,
+			strategy:          operatorv1.ManualUpgradeStrategy,
+			expectedVersion:   "v1.0.0",
+			expectedLatest:    "v1.1.0",
+			expectedAvailable: "v1.1.0",
+		},
+		{
+			name:              "Available upgrade is contract compatible with manual upgrade strategy",
+			version:           "v1.0.0",
+			channel:           operatorv1.StableChannel,
+			strategy:          operatorv1.ManualUpgradeStrategy,
+			coreContract:      "v1alpha4",
+			expectedVersion:   "v1.0.0",
+			expectedLatest:    "v1.1.0",
+			expectedAvailable: "v1.0.1",
+		},
+		{
+			name:            "No upgrade is available with manual upgrade strategy on the newest version",
+			version:         "v1.1.0",
+			channel:         operatorv1.StableChannel,
+			strategy:        operatorv1.ManualUpgradeStrategy,
+			expectedVersion: "v1.1.0",
+			expectedLatest:  "v1.1.0",
+		},
+		{
+			name:            "Initial version is picked with manual upgrade strategy",
+			channel:         operatorv1.StableChannel,
+			strategy:        operatorv1.ManualUpgradeStrategy,
+			expectedVersion: "v1.1.0",
+			expectedLatest:  "v1.1.0",
+		},
+		{
+			name:            "No version abides by the core provider contract",
+			version:         "v1.0.0",
+			channel:         operatorv1.StableChannel,
+			autoUpgrade:     true,
+			coreContract:    "v1alpha3",
+			expectedVersion: "v1.0.0",
+			expectedLatest:  "v1.1.0",
+			expectedPending: true,
+			expectedClosest: "v1.1.0 (contract v1beta1), v1.0.1 (contract v1alpha4)",
+		},
+		{
+			name:            "Transitional release series abiding by the core provider contract too",
+			version:         "v1.0.0",
+			channel:         operatorv1.StableChannel,
+			autoUpgrade:     true,
+			coreContract:    "v1alpha4",
+			metadata:        testTransitionalVersionResolverMetadata,
+			expectedVersion: "v1.1.0",
+			expectedLatest:  "v1.1.0",
+		},
+		{
+			name:            "Transitional release series listed in the closest versions",
+			version:         "v1.0.0",
+			channel:         operatorv1.StableChannel,
+			autoUpgrade:     true,
+			coreContract:    "v1alpha3",
+			metadata:        testTransitionalVersionResolverMetadata,
+			expectedVersion: "v1.0.0",
+			expectedLatest:  "v1.1.0",
+			expectedPending: true,
+			expectedClosest: "v1.1.0 (contract v1beta1), v1.1.0 (contract v1alpha4)",
+		},
+		{
+			name:            "Version is upgraded with auto upgrade strategy",
+			version:         "v1.0.0",
+			channel:         operatorv1.StableChannel,
+			autoUpgrade:     true,
+			strategy:        operatorv1.AutoUpgradeStrategy,
+			expectedVersion: "v1.1.0",
+			expectedLatest:  "v1.1.0",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			objs := []client.Object{}
+
+			if tc.coreContract != "" {
+				objs = append(objs, &operatorv1.CoreProvider{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "cluster-api",
+						Namespace: "capi-system",
+					},
+					Status: operatorv1.CoreProviderStatus{
+						ProviderStatus: operatorv1.ProviderStatus{
+							Contract: &tc.coreContract,
+						},
+					},
+				})
+			}
+
+			metadata := tc.metadata
+			if metadata == "" {
+				metadata = testVersionResolverMetadata
+			}
+
+			for _, version := range []string{"v1.0.0", "v1.0.1", "v1.1.0", "v1.2.0-beta.0"} {
+				objs = append(objs, &corev1.ConfigMap{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      version,
+						Namespace: "ns1",
+						Labels:    map[string]string{"provider-components": "aws"},
+					},
+					Data: map[string]string{
+						metadataConfigMapKey:   metadata,
+						componentsConfigMapKey: "components",
+					},
+				})
+			}
+
+			p := &phaseReconciler{
+				ctrlClient: fake.NewClientBuilder().WithScheme(setupScheme()).WithObjects(objs...).Build(),
+				provider: &genericprovider.InfrastructureProviderWrapper{
+					InfrastructureProvider: &operatorv1.InfrastructureProvider{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:      "aws",
+							Namespace: "ns1",
+						},
+						Spec: operatorv1.InfrastructureProviderSpec{
+							ProviderSpec: operatorv1.ProviderSpec{
+								Version:           tc.version,
+								Channel:           tc.channel,
+								VersionConstraint: tc.constraint,
+								AutoUpgrade:       tc.autoUpgrade,
+								UpgradeStrategy:   tc.strategy,
+								ContractPolicy:    &operatorv1.ContractPolicy{ToleratedContracts: tc.tolerated},
+								FetchConfig: &operatorv1.FetchConfiguration{
+									Selector: &metav1.LabelSelector{
+										MatchLabels: map[string]string{"provider-components": "aws"},
+									},
+								},
+							},
+						},
+					},
+				},
+			}
+
+			_, err := p.resolveVersion(context.TODO())
+			g.Expect(err).ToNot(HaveOccurred())
+
+			g.Expect(p.provider.GetSpec().Version).To(Equal(tc.expectedVersion))
+
+			if tc.expectedLatest == "" {
+				g.Expect(p.provider.GetStatus().LatestVersion).To(BeNil())
+			} else {
+				g.Expect(p.provider.GetStatus().LatestVersion).To(HaveValue(Equal(tc.expectedLatest)))
+			}
+
+			g.Expect(conditions.Has(p.provider, operatorv1.AutoUpgradePendingCondition)).To(Equal(tc.expectedPending))
+
+			if tc.expectedAvailable == "" {
+				g.Expect(conditions.Has(p.provider, operatorv1.UpgradeAvailableCondition)).To(BeFalse())
+			} else {
+				g.Expect(conditions.IsTrue(p.provider, operatorv1.UpgradeAvailableCondition)).To(BeTrue())
+				g.Expect(conditions.GetMessage(p.provider, operatorv1.UpgradeAvailableCondition)).To(ContainSubstring(tc.expectedAvailable))
+			}
+
+			if tc.expectedClosest == "" {
+				g.Expect(conditions.Has(p.provider, operatorv1.UpgradeTargetUnavailableCondition)).To(BeFalse())
+			} else {
+				g.Expect(conditions.IsTrue(p.provider, operatorv1.UpgradeTargetUnavailableCondition)).To(BeTrue())
+				g.Expect(conditions.GetReason(p.provider, operatorv1.UpgradeTargetUnavailableCondition)).To(Equal(operatorv1.NoMatchingReleaseSeriesReason))
+				g.Expect(conditions.GetMessage(p.provider, operatorv1.UpgradeTargetUnavailableCondition)).To(ContainSubstring(tc.expectedClosest))
+			}
+		})
+	}
+}
+
+var testVersionResolverMetadata = `
+apiVersion: clusterctl.cluster.x-k8s.io/v1alpha3
+releaseSeries:
+  - major: 1
+    minor: 2
+    contract: v1beta1
+  - major: 1
+    minor: 1
+    contract: v1beta1
+  - major: 1
+    minor: 0
+    contract: v1alpha4
+`
+
+// testTransitionalVersionResolverMetadata lists the 1.1 release series once per contract it abides by.
+var testTransitionalVersionResolverMetadata = `
+apiVersion: clusterctl.cluster.x-k8s.io/v1alpha3
+releaseSeries:
+  - major: 1
+    minor: 2
+    contract: v1beta1
+  - major: 1
+    minor: 1
+    contract: v1beta1
+  - major: 1
+    minor: 1
+    contract: v1alpha4
+  - major: 1
+    minor: 0
+    contract: v1alpha4
+`
+
+func TestCheckVersionUpgrade(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	objs := []client.Object{}
+
+	for _, version := range []string{"v1.0.0", "v1.1.0"} {
+		objs = append(objs, &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      version,
+				Namespace: "ns1",
+				Labels:    map[string]string{"provider-components": "aws"},
+			},
+			Data: map[string]string{
+				metadataConfigMapKey:   testVersionResolverMetadata,
+				componentsConfigMapKey: "components",
+			},
+		})
+	}
+
+	provider := &genericprovider.InfrastructureProviderWrapper{
+		InfrastructureProvider: &operatorv1.InfrastructureProvider{
+			ObjectMeta: metav1.ObjectMeta{Name: "aws", Namespace: "ns1"},
+			Spec: operatorv1.InfrastructureProviderSpec{
+				ProviderSpec: operatorv1.ProviderSpec{
+					Version:     "v1.0.0",
+					Channel:     operatorv1.StableChannel,
+					AutoUpgrade: true,
+					FetchConfig: &operatorv1.FetchConfiguration{
+						Selector: &metav1.LabelSelector{
+							MatchLabels: map[string]string{"provider-components": "aws"},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	r := &GenericProviderReconciler{
+		Provider:        &operatorv1.InfrastructureProvider{},
+		ProviderList:    &operatorv1.InfrastructureProviderList{},
+		Client:          fake.NewClientBuilder().WithScheme(setupScheme()).WithObjects(objs...).Build(),
+		DownloadLimiter: NewDownloadLimiter(1),
+	}
+
+	now := time.Date(2023, 9, 1, 12, 0, 0, 0, time.UTC)
+
+	r.checkVersionUpgrade(ctx, provider, now)
+	g.Expect(provider.Spec.Version).To(Equal("v1.1.0"))
+	g.Expect(provider.Status.LastUpgradeCheckTime).To(HaveValue(Equal(metav1.Time{Time: now})))
+	g.Expect(conditions.Has(provider, operatorv1.UpgradeCheckFailedCondition)).To(BeFalse())
+
+	// The versions aren't listed again until the resync period has passed.
+	provider.Spec.Version = "v1.0.0"
+	now = now.Add(time.Minute)
+
+	g.Expect(upgradeCheckDelay(provider, now)).To(Equal(9 * time.Minute))
+
+	r.checkVersionUpgrade(ctx, provider, now)
+	g.Expect(provider.Spec.Version).To(Equal("v1.0.0"))
+
+	// The check waits for a download slot.
+	now = now.Add(autoUpgradeResyncPeriod)
+
+	g.Expect(r.DownloadLimiter.tryAcquire("other")).To(BeTrue())
+	r.checkVersionUpgrade(ctx, provider, now)
+	g.Expect(provider.Spec.Version).To(Equal("v1.0.0"))
+	g.Expect(upgradeCheckDelay(provider, now)).To(BeZero())
+	r.DownloadLimiter.release()
+
+	// Listing failures are reported in the condition instead of failing the reconciliation.
+	provider.Spec.FetchConfig.Selector.MatchLabels = map[string]string{"provider-components": "missing"}
+
+	r.checkVersionUpgrade(ctx, provider, now)
+	g.Expect(provider.Spec.Version).To(Equal("v1.0.0"))
+	g.Expect(provider.Status.LastUpgradeCheckTime).To(HaveValue(Equal(metav1.Time{Time: now})))
+	g.Expect(conditions.IsTrue(provider, operatorv1.UpgradeCheckFailedCondition)).To(BeTrue())
+	g.Expect(conditions.GetReason(provider, operatorv1.UpgradeCheckFailedCondition)).To(Equal(operatorv1.DownloadFailedReason))
+
+	// The condition is removed once the check succeeds again.
+	provider.Spec.FetchConfig.Selector.MatchLabels = map[string]string{"provider-components": "aws"}
+	now = now.Add(autoUpgradeResyncPeriod)
+
+	r.checkVersionUpgrade(ctx, provider, now)
+	g.Expect(provider.Spec.Version).To(Equal("v1.1.0"))
+	g.Expect(conditions.Has(provider, operatorv1.UpgradeCheckFailedCondition)).To(BeFalse())
+}
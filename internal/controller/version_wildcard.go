@@ -0,0 +1,99 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"github.com/Masterminds/semver/v3"
+	"k8s.io/utils/pointer"
+
+	operatorv1 "sigs.k8s.io/cluster-api-operator/api/v1alpha2"
+	"sigs.k8s.io/cluster-api-operator/internal/controller/genericprovider"
+)
+
+// versionWildcardRegexp matches the patch wildcards of a minor version, e.g. v0.4.x.
+var versionWildcardRegexp = regexp.MustCompile(`^v?(\d+)\.(\d+)\.[xX*]$`)
+
+// isVersionWildcard returns true if the version is a patch wildcard, e.g. v0.4.x.
+func isVersionWildcard(version string) bool {
+	return versionWildcardRegexp.MatchString(version)
+}
+
+// versionWildcardConstraint returns the version constraint matching the patch releases of the wildcard minor
+// version. Pre-releases are only included in the beta channel.
+func versionWildcardConstraint(wildcard, channel string) string {
+	match := versionWildcardRegexp.FindStringSubmatch(wildcard)
+	major, minor := match[1], match[2]
+
+	if channel == operatorv1.BetaChannel {
+		nextMinor, _ := strconv.Atoi(minor)
+
+		return fmt.Sprintf(">= %s.%s.0-0, < %s.%d.0-0", major, minor, major, nextMinor+1)
+	}
+
+	return fmt.Sprintf("%s.%s.x", major, minor)
+}
+
+// resolveVersionWildcard replaces a spec.version patch wildcard, e.g. v0.4.x, with the version it last resolved to,
+// and with the equivalent version constraint and automatic upgrades, so the version is resolved as with a channel.
+// The returned function records the resolved version in the status and puts the original fields back into the spec,
+// before the provider is patched.
+func resolveVersionWildcard(provider genericprovider.GenericProvider) func() {
+	original := provider.GetSpec()
+	if !isVersionWildcard(original.Version) {
+		return func() {}
+	}
+
+	constraint := versionWildcardConstraint(original.Version, original.Channel)
+	if original.VersionConstraint != "" {
+		constraint = original.VersionConstraint + ", " + constraint
+	}
+
+	spec := original
+	spec.Version = ""
+	spec.VersionConstraint = constraint
+	spec.AutoUpgrade = true
+
+	// A version resolved for another wildcard is not kept, as it would never be downgraded.
+	if resolved := pointer.StringDeref(provider.GetStatus().ResolvedVersion, ""); resolved != "" {
+		if c, err := semver.NewConstraint(constraint); err == nil {
+			if v, err := semver.NewVersion(resolved); err == nil && c.Check(v) {
+				spec.Version = resolved
+			}
+		}
+	}
+
+	provider.SetSpec(spec)
+
+	return func() {
+		spec := provider.GetSpec()
+
+		if spec.Version != "" {
+			status := provider.GetStatus()
+			status.ResolvedVersion = pointer.String(spec.Version)
+			provider.SetStatus(status)
+		}
+
+		spec.Version = original.Version
+		spec.VersionConstraint = original.VersionConstraint
+		spec.AutoUpgrade = original.AutoUpgrade
+		provider.SetSpec(spec)
+	}
+}
@@ -0,0 +1,175 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/pointer"
+
+	operatorv1 "sigs.k8s.io/cluster-api-operator/api/v1alpha2"
+	"sigs.k8s.io/cluster-api-operator/internal/controller/genericprovider"
+)
+
+func TestVersionWildcardConstraint(t *testing.T) {
+	repoVersions := []string{"v0.3.9", "v0.4.0", "v0.4.1", "v0.4.2-rc.0", "v0.5.0-beta.0", "v0.5.0"}
+
+	testCases := []struct {
+		name               string
+		version            string
+		channel            string
+		expectedWildcard   bool
+		expectedCandidates []string
+	}{
+		{
+			name:    "pinned version",
+			version: "v0.4.1",
+		},
+		{
+			name:    "minor wildcard",
+			version: "v0.x",
+		},
+		{
+			name:               "patch wildcard excludes pre-releases",
+			version:            "v0.4.x",
+			expectedWildcard:   true,
+			expectedCandidates: []string{"v0.4.1", "v0.4.0"},
+		},
+		{
+			name:               "patch wildcard without prefix",
+			version:            "0.4.*",
+			channel:            operatorv1.StableChannel,
+			expectedWildcard:   true,
+			expectedCandidates: []string{"v0.4.1", "v0.4.0"},
+		},
+		{
+			name:               "patch wildcard includes pre-releases in the beta channel",
+			version:            "v0.4.X",
+			channel:            operatorv1.BetaChannel,
+			expectedWildcard:   true,
+			expectedCandidates: []string{"v0.4.2-rc.0", "v0.4.1", "v0.4.0"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			g.Expect(isVersionWildcard(tc.version)).To(Equal(tc.expectedWildcard))
+
+			if !tc.expectedWildcard {
+				return
+			}
+
+			candidates, err := getCandidateVersions(repoVersions, tc.channel, versionWildcardConstraint(tc.version, tc.channel))
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(candidates).To(Equal(tc.expectedCandidates))
+		})
+	}
+}
+
+func TestResolveVersionWildcard(t *testing.T) {
+	testCases := []struct {
+		name                      string
+		spec                      operatorv1.ProviderSpec
+		resolvedVersion           *string
+		expectedVersion           string
+		expectedVersionConstraint string
+		expectedAutoUpgrade       bool
+	}{
+		{
+			name:            "pinned version is left unchanged",
+			spec:            operatorv1.ProviderSpec{Version: "v0.4.1"},
+			resolvedVersion: pointer.String("v0.4.0"),
+			expectedVersion: "v0.4.1",
+		},
+		{
+			name:                      "wildcard is resolved for the first time",
+			spec:                      operatorv1.ProviderSpec{Version: "v0.4.x"},
+			expectedVersionConstraint: "0.4.x",
+			expectedAutoUpgrade:       true,
+		},
+		{
+			name:                      "wildcard is replaced with the version it resolved to",
+			spec:                      operatorv1.ProviderSpec{Version: "v0.4.x"},
+			resolvedVersion:           pointer.String("v0.4.1"),
+			expectedVersion:           "v0.4.1",
+			expectedVersionConstraint: "0.4.x",
+			expectedAutoUpgrade:       true,
+		},
+		{
+			name:                      "version resolved for another wildcard is resolved again",
+			spec:                      operatorv1.ProviderSpec{Version: "v0.5.x"},
+			resolvedVersion:           pointer.String("v0.4.1"),
+			expectedVersionConstraint: "0.5.x",
+			expectedAutoUpgrade:       true,
+		},
+		{
+			name:                      "wildcard is combined with the version constraint",
+			spec:                      operatorv1.ProviderSpec{Version: "v0.4.x", VersionConstraint: "!= 0.4.2"},
+			resolvedVersion:           pointer.String("v0.4.2"),
+			expectedVersionConstraint: "!= 0.4.2, 0.4.x",
+			expectedAutoUpgrade:       true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			provider := &genericprovider.InfrastructureProviderWrapper{
+				InfrastructureProvider: &operatorv1.InfrastructureProvider{
+					ObjectMeta: metav1.ObjectMeta{Name: "aws", Namespace: "capa-system"},
+					Spec:       operatorv1.InfrastructureProviderSpec{ProviderSpec: tc.spec},
+					Status: operatorv1.InfrastructureProviderStatus{
+						ProviderStatus: operatorv1.ProviderStatus{ResolvedVersion: tc.resolvedVersion},
+					},
+				},
+			}
+
+			restore := resolveVersionWildcard(provider)
+
+			spec := provider.GetSpec()
+			g.Expect(spec.Version).To(Equal(tc.expectedVersion))
+			g.Expect(spec.AutoUpgrade).To(Equal(tc.expectedAutoUpgrade))
+
+			if tc.expectedVersionConstraint != "" {
+				g.Expect(spec.VersionConstraint).To(Equal(tc.expectedVersionConstraint))
+			}
+
+			if !isVersionWildcard(tc.spec.Version) {
+				restore()
+
+				g.Expect(provider.GetSpec()).To(Equal(tc.spec))
+				g.Expect(provider.GetStatus().ResolvedVersion).To(Equal(tc.resolvedVersion))
+
+				return
+			}
+
+			// The version resolved during the reconciliation is recorded in the status.
+			spec.Version = "v0.4.3"
+			provider.SetSpec(spec)
+
+			restore()
+
+			g.Expect(provider.GetSpec()).To(Equal(tc.spec))
+			g.Expect(provider.GetStatus().ResolvedVersion).To(Equal(pointer.String("v0.4.3")))
+		})
+	}
+}
@@ -0,0 +1,129 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"strings"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	"sigs.k8s.io/cluster-api-operator/internal/controller/genericprovider"
+)
+
+// inWatchNamespacePredicate filters out the providers outside of the watched namespace, if any. The manager cache
+// is expected to be restricted to the namespace as well, this guards against a cache watching more namespaces.
+func inWatchNamespacePredicate(namespace string) predicate.Predicate {
+	return predicate.NewPredicateFuncs(func(obj client.Object) bool {
+		return namespace == "" || obj.GetNamespace() == namespace
+	})
+}
+
+// referencesOutsideNamespace returns the fields of the provider spec referencing objects in another namespace
+// than the watched one, e.g. "spec.configSecret (tenant-b)". References without namespace default to the
+// provider namespace. Nothing is returned if all the namespaces are watched.
+func referencesOutsideNamespace(provider genericprovider.GenericProvider, namespace string) []string {
+	if namespace == "" {
+		return nil
+	}
+
+	spec := provider.GetSpec()
+	outside := []string{}
+
+	check := func(field, refNamespace string) {
+		if refNamespace == "" {
+			refNamespace = provider.GetNamespace()
+		}
+
+		if refNamespace != namespace {
+			outside = append(outside, fmt.Sprintf("%s (%s)", field, refNamespace))
+		}
+	}
+
+	if spec.ConfigSecret != nil {
+		check("spec.configSecret", spec.ConfigSecret.Namespace)
+	}
+
+	if spec.ConfigSecretRef != nil {
+		check("spec.configSecretRef", spec.ConfigSecretRef.Namespace)
+	}
+
+	if spec.AdditionalManifestsRef != nil {
+		check("spec.additionalManifests", spec.AdditionalManifestsRef.Namespace)
+	}
+
+	if spec.AdditionalRBAC != nil && spec.AdditionalRBAC.ManifestsRef != nil {
+		check("spec.additionalRBAC.manifestsRef", spec.AdditionalRBAC.ManifestsRef.Namespace)
+	}
+
+	if webhook := spec.ManifestTransformWebhook; webhook != nil && webhook.CABundleRef != nil && webhook.CABundleRef.ConfigMap != nil {
+		check("spec.manifestTransformWebhook.caBundleRef.configMap", webhook.CABundleRef.ConfigMap.Namespace)
+	}
+
+	if fetchConfig := spec.FetchConfig; fetchConfig != nil {
+		if fetchConfig.OverridesConfigMapRef != nil {
+			check("spec.fetchConfig.overridesConfigMapRef", fetchConfig.OverridesConfigMapRef.Namespace)
+		}
+
+		if fetchConfig.MetadataOverrideRef != nil {
+			check("spec.fetchConfig.metadataOverrideRef", fetchConfig.MetadataOverrideRef.Namespace)
+		}
+
+		if fetchConfig.ConfigMapNamespace != "" {
+			check("spec.fetchConfig.configMapNamespace", fetchConfig.ConfigMapNamespace)
+		}
+
+		if fetchConfig.CABundleRef != nil && fetchConfig.CABundleRef.ConfigMap != nil {
+			check("spec.fetchConfig.caBundleRef.configMap", fetchConfig.CABundleRef.ConfigMap.Namespace)
+		}
+
+		if fetchConfig.Git != nil && fetchConfig.Git.SecretRef != nil {
+			check("spec.fetchConfig.git.secretRef", fetchConfig.Git.SecretRef.Namespace)
+		}
+
+		if fetchConfig.Helm != nil && fetchConfig.Helm.ValuesFrom != nil {
+			if fetchConfig.Helm.ValuesFrom.ConfigMap != nil {
+				check("spec.fetchConfig.helm.valuesFrom.configMap", fetchConfig.Helm.ValuesFrom.ConfigMap.Namespace)
+			}
+
+			if fetchConfig.Helm.ValuesFrom.Secret != nil {
+				check("spec.fetchConfig.helm.valuesFrom.secret", fetchConfig.Helm.ValuesFrom.Secret.Namespace)
+			}
+		}
+	}
+
+	for i, dependency := range spec.DependsOn {
+		check(fmt.Sprintf("spec.dependsOn[%d]", i), dependency.Namespace)
+	}
+
+	return outside
+}
+
+// referencesOutsideNamespaceMessage describes the references of a provider to objects outside of the watched namespace.
+func referencesOutsideNamespaceMessage(outside []string, namespace string) string {
+	return fmt.Sprintf("The operator only watches namespace %q, the provider can't reference objects in other namespaces: %s", namespace, strings.Join(outside, ", "))
+}
+
+// validateSummaryConfigMapNamespace checks that the provider summary ConfigMap is in the watched namespace, if any.
+func validateSummaryConfigMapNamespace(summaryConfigMap client.ObjectKey, namespace string) error {
+	if namespace == "" || summaryConfigMap.Name == "" || summaryConfigMap.Namespace == namespace {
+		return nil
+	}
+
+	return fmt.Errorf("provider summary ConfigMap %s is not in the watched namespace %q", summaryConfigMap, namespace)
+}
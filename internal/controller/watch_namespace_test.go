@@ -0,0 +1,139 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+
+	operatorv1 "sigs.k8s.io/cluster-api-operator/api/v1alpha2"
+	"sigs.k8s.io/cluster-api-operator/internal/controller/genericprovider"
+)
+
+func TestReferencesOutsideNamespace(t *testing.T) {
+	testCases := []struct {
+		name            string
+		watchNamespace  string
+		spec            operatorv1.ProviderSpec
+		expectedOutside []string
+	}{
+		{
+			name: "all namespaces are watched",
+			spec: operatorv1.ProviderSpec{
+				ConfigSecret: &operatorv1.SecretReference{Name: "variables", Namespace: "tenant-b"},
+			},
+		},
+		{
+			name:           "references in the watched namespace",
+			watchNamespace: "tenant-a",
+			spec: operatorv1.ProviderSpec{
+				ConfigSecret:           &operatorv1.SecretReference{Name: "variables", Namespace: "tenant-a"},
+				AdditionalManifestsRef: &operatorv1.ConfigmapReference{Name: "manifests"},
+				DependsOn:              []operatorv1.ProviderDependency{{Kind: "BootstrapProvider", Name: "kubeadm"}},
+			},
+		},
+		{
+			name:           "references in other namespaces",
+			watchNamespace: "tenant-a",
+			spec: operatorv1.ProviderSpec{
+				ConfigSecret:           &operatorv1.SecretReference{Name: "variables", Namespace: "tenant-b"},
+				AdditionalManifestsRef: &operatorv1.ConfigmapReference{Name: "manifests", Namespace: "tenant-a"},
+				AdditionalRBAC: &operatorv1.AdditionalRBAC{
+					ManifestsRef: &operatorv1.ConfigmapReference{Name: "rbac", Namespace: "tenant-c"},
+				},
+				FetchConfig: &operatorv1.FetchConfiguration{
+					OverridesConfigMapRef: &operatorv1.ConfigmapReference{Name: "overrides", Namespace: "tenant-d"},
+					MetadataOverrideRef:   &operatorv1.ConfigmapReference{Name: "metadata", Namespace: "tenant-e"},
+					ConfigMapNamespace:    "capi-manifests",
+					Helm: &operatorv1.HelmSource{
+						ValuesFrom: &operatorv1.HelmValuesReference{
+							Secret: &operatorv1.SecretReference{Name: "values", Namespace: "tenant-b"},
+						},
+					},
+				},
+				DependsOn: []operatorv1.ProviderDependency{{Kind: "BootstrapProvider", Name: "kubeadm", Namespace: "capi-kubeadm-bootstrap-system"}},
+			},
+			expectedOutside: []string{
+				"spec.configSecret (tenant-b)",
+				"spec.additionalRBAC.manifestsRef (tenant-c)",
+				"spec.fetchConfig.overridesConfigMapRef (tenant-d)",
+				"spec.fetchConfig.metadataOverrideRef (tenant-e)",
+				"spec.fetchConfig.configMapNamespace (capi-manifests)",
+				"spec.fetchConfig.helm.valuesFrom.secret (tenant-b)",
+				"spec.dependsOn[0] (capi-kubeadm-bootstrap-system)",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			p := &phaseReconciler{
+				watchNamespace: tc.watchNamespace,
+				provider: &genericprovider.InfrastructureProviderWrapper{
+					InfrastructureProvider: &operatorv1.InfrastructureProvider{
+						ObjectMeta: metav1.ObjectMeta{Name: "aws", Namespace: "tenant-a"},
+						Spec:       operatorv1.InfrastructureProviderSpec{ProviderSpec: tc.spec},
+					},
+				},
+			}
+
+			outside := referencesOutsideNamespace(p.provider, tc.watchNamespace)
+			if len(tc.expectedOutside) == 0 {
+				g.Expect(outside).To(BeEmpty())
+
+				return
+			}
+
+			g.Expect(outside).To(Equal(tc.expectedOutside))
+
+			// The preflight checks stop before looking for the core provider.
+			_, err := p.preflightChecks(context.Background())
+			g.Expect(err).To(HaveOccurred())
+			g.Expect(conditions.GetReason(p.provider, operatorv1.PreflightCheckCondition)).To(Equal(operatorv1.ReferenceOutsideWatchNamespaceReason))
+		})
+	}
+}
+
+func TestInWatchNamespacePredicate(t *testing.T) {
+	g := NewWithT(t)
+
+	provider := &operatorv1.InfrastructureProvider{ObjectMeta: metav1.ObjectMeta{Name: "aws", Namespace: "tenant-a"}}
+	other := &operatorv1.InfrastructureProvider{ObjectMeta: metav1.ObjectMeta{Name: "aws", Namespace: "tenant-b"}}
+
+	g.Expect(inWatchNamespacePredicate("").Create(event.CreateEvent{Object: other})).To(BeTrue())
+	g.Expect(inWatchNamespacePredicate("tenant-a").Create(event.CreateEvent{Object: provider})).To(BeTrue())
+	g.Expect(inWatchNamespacePredicate("tenant-a").Create(event.CreateEvent{Object: other})).To(BeFalse())
+}
+
+func TestValidateSummaryConfigMapNamespace(t *testing.T) {
+	g := NewWithT(t)
+
+	summary := types.NamespacedName{Namespace: "tenant-a", Name: "provider-summary"}
+
+	g.Expect(validateSummaryConfigMapNamespace(summary, "")).To(Succeed())
+	g.Expect(validateSummaryConfigMapNamespace(summary, "tenant-a")).To(Succeed())
+	g.Expect(validateSummaryConfigMapNamespace(types.NamespacedName{}, "tenant-b")).To(Succeed())
+	g.Expect(validateSummaryConfigMapNamespace(summary, "tenant-b")).ToNot(Succeed())
+}
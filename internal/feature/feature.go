@@ -0,0 +1,48 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package feature defines the feature gates of the operator, set with the --feature-gates flag, which guard
+// behaviors that are rolled out gradually.
+package feature
+
+import (
+	"k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/component-base/featuregate"
+)
+
+const (
+	// UpgradeOrdering holds the upgrade of a provider while the providers of the earlier upgrade stages have a
+	// pending upgrade or aren't Ready.
+	UpgradeOrdering featuregate.Feature = "UpgradeOrdering"
+)
+
+var (
+	// MutableGates is a mutable version of Gates, to be set from the --feature-gates flag.
+	MutableGates featuregate.MutableFeatureGate = featuregate.NewFeatureGate()
+
+	// Gates is a shared global FeatureGate. Top-level commands should use MutableGates.AddFlag.
+	Gates featuregate.FeatureGate = MutableGates
+)
+
+func init() {
+	runtime.Must(MutableGates.Add(defaultFeatureGates))
+}
+
+// defaultFeatureGates consists of all known operator feature keys. To add a new feature, define a key for it above
+// and add it here.
+var defaultFeatureGates = map[featuregate.Feature]featuregate.FeatureSpec{
+	UpgradeOrdering: {Default: true, PreRelease: featuregate.Beta},
+}
@@ -23,15 +23,25 @@ import (
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
 	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
 
 	operatorv1 "sigs.k8s.io/cluster-api-operator/api/v1alpha2"
+	"sigs.k8s.io/cluster-api-operator/internal/controller/genericprovider"
 )
 
-type AddonProviderWebhook struct{}
+type AddonProviderWebhook struct {
+	// Client is used to validate the provider contract against the core provider one.
+	// Defaults to the manager client.
+	Client client.Client
+}
 
 func (r *AddonProviderWebhook) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	if r.Client == nil {
+		r.Client = mgr.GetClient()
+	}
+
 	return ctrl.NewWebhookManagedBy(mgr).
 		For(&operatorv1.AddonProvider{}).
 		WithValidator(r).
@@ -49,12 +59,31 @@ var (
 
 // ValidateCreate implements webhook.Validator so a webhook will be registered for the type.
 func (r *AddonProviderWebhook) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
-	return nil, nil
+	addonProvider, ok := obj.(*operatorv1.AddonProvider)
+	if !ok {
+		return nil, apierrors.NewBadRequest(fmt.Sprintf("expected a AddonProvider but got a %T", obj))
+	}
+
+	return validateProvider(ctx, r.Client, &genericprovider.AddonProviderWrapper{AddonProvider: addonProvider})
 }
 
 // ValidateUpdate implements webhook.Validator so a webhook will be registered for the type.
 func (r *AddonProviderWebhook) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
-	return nil, nil
+	oldAddonProvider, ok := oldObj.(*operatorv1.AddonProvider)
+	if !ok {
+		return nil, apierrors.NewBadRequest(fmt.Sprintf("expected a AddonProvider but got a %T", oldObj))
+	}
+
+	addonProvider, ok := newObj.(*operatorv1.AddonProvider)
+	if !ok {
+		return nil, apierrors.NewBadRequest(fmt.Sprintf("expected a AddonProvider but got a %T", newObj))
+	}
+
+	if !contractMayChange(&genericprovider.AddonProviderWrapper{AddonProvider: oldAddonProvider}, &genericprovider.AddonProviderWrapper{AddonProvider: addonProvider}) {
+		return nil, nil
+	}
+
+	return validateProvider(ctx, r.Client, &genericprovider.AddonProviderWrapper{AddonProvider: addonProvider})
 }
 
 // ValidateDelete implements webhook.Validator so a webhook will be registered for the type.
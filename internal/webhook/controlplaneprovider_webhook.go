@@ -23,15 +23,25 @@ import (
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
 	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
 
 	operatorv1 "sigs.k8s.io/cluster-api-operator/api/v1alpha2"
+	"sigs.k8s.io/cluster-api-operator/internal/controller/genericprovider"
 )
 
-type ControlPlaneProviderWebhook struct{}
+type ControlPlaneProviderWebhook struct {
+	// Client is used to validate the provider contract against the core provider one.
+	// Defaults to the manager client.
+	Client client.Client
+}
 
 func (r *ControlPlaneProviderWebhook) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	if r.Client == nil {
+		r.Client = mgr.GetClient()
+	}
+
 	return ctrl.NewWebhookManagedBy(mgr).
 		For(&operatorv1.ControlPlaneProvider{}).
 		WithValidator(r).
@@ -49,12 +59,31 @@ var (
 
 // ValidateCreate implements webhook.Validator so a webhook will be registered for the type.
 func (r *ControlPlaneProviderWebhook) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
-	return nil, nil
+	controlPlaneProvider, ok := obj.(*operatorv1.ControlPlaneProvider)
+	if !ok {
+		return nil, apierrors.NewBadRequest(fmt.Sprintf("expected a ControlPlaneProvider but got a %T", obj))
+	}
+
+	return validateProvider(ctx, r.Client, &genericprovider.ControlPlaneProviderWrapper{ControlPlaneProvider: controlPlaneProvider})
 }
 
 // ValidateUpdate implements webhook.Validator so a webhook will be registered for the type.
 func (r *ControlPlaneProviderWebhook) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
-	return nil, nil
+	oldControlPlaneProvider, ok := oldObj.(*operatorv1.ControlPlaneProvider)
+	if !ok {
+		return nil, apierrors.NewBadRequest(fmt.Sprintf("expected a ControlPlaneProvider but got a %T", oldObj))
+	}
+
+	controlPlaneProvider, ok := newObj.(*operatorv1.ControlPlaneProvider)
+	if !ok {
+		return nil, apierrors.NewBadRequest(fmt.Sprintf("expected a ControlPlaneProvider but got a %T", newObj))
+	}
+
+	if !contractMayChange(&genericprovider.ControlPlaneProviderWrapper{ControlPlaneProvider: oldControlPlaneProvider}, &genericprovider.ControlPlaneProviderWrapper{ControlPlaneProvider: controlPlaneProvider}) {
+		return nil, nil
+	}
+
+	return validateProvider(ctx, r.Client, &genericprovider.ControlPlaneProviderWrapper{ControlPlaneProvider: controlPlaneProvider})
 }
 
 // ValidateDelete implements webhook.Validator so a webhook will be registered for the type.
@@ -19,19 +19,33 @@ package webhook
 import (
 	"context"
 	"fmt"
+	"reflect"
 
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
 	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
 
 	operatorv1 "sigs.k8s.io/cluster-api-operator/api/v1alpha2"
+	"sigs.k8s.io/cluster-api-operator/internal/controller/genericprovider"
 )
 
-type CoreProviderWebhook struct{}
+type CoreProviderWebhook struct {
+	// Client is used to look for another core provider. Defaults to the manager client.
+	Client client.Client
+
+	// WatchNamespace restricts the look for another core provider to this namespace, like the operator only
+	// reconciles the providers in it.
+	WatchNamespace string
+}
 
 func (r *CoreProviderWebhook) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	if r.Client == nil {
+		r.Client = mgr.GetClient()
+	}
+
 	return ctrl.NewWebhookManagedBy(mgr).
 		WithValidator(r).
 		WithDefaulter(r).
@@ -49,12 +63,51 @@ var (
 
 // ValidateCreate implements webhook.Validator so a webhook will be registered for the type.
 func (r *CoreProviderWebhook) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
-	return nil, nil
+	coreProvider, ok := obj.(*operatorv1.CoreProvider)
+	if !ok {
+		return nil, apierrors.NewBadRequest(fmt.Sprintf("expected a CoreProvider but got a %T", obj))
+	}
+
+	if err := validateProviderName(&genericprovider.CoreProviderWrapper{CoreProvider: coreProvider}); err != nil {
+		return nil, err
+	}
+
+	if err := validateGitSource(&genericprovider.CoreProviderWrapper{CoreProvider: coreProvider}); err != nil {
+		return nil, err
+	}
+
+	if err := validateHelmSource(&genericprovider.CoreProviderWrapper{CoreProvider: coreProvider}); err != nil {
+		return nil, err
+	}
+
+	return validateSingleCoreProvider(ctx, r.Client, r.WatchNamespace, coreProvider)
 }
 
 // ValidateUpdate implements webhook.Validator so a webhook will be registered for the type.
 func (r *CoreProviderWebhook) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
-	return nil, nil
+	oldCoreProvider, ok := oldObj.(*operatorv1.CoreProvider)
+	if !ok {
+		return nil, apierrors.NewBadRequest(fmt.Sprintf("expected a CoreProvider but got a %T", oldObj))
+	}
+
+	coreProvider, ok := newObj.(*operatorv1.CoreProvider)
+	if !ok {
+		return nil, apierrors.NewBadRequest(fmt.Sprintf("expected a CoreProvider but got a %T", newObj))
+	}
+
+	if reflect.DeepEqual(oldCoreProvider.Spec.FetchConfig, coreProvider.Spec.FetchConfig) {
+		return nil, nil
+	}
+
+	if err := validateProviderName(&genericprovider.CoreProviderWrapper{CoreProvider: coreProvider}); err != nil {
+		return nil, err
+	}
+
+	if err := validateGitSource(&genericprovider.CoreProviderWrapper{CoreProvider: coreProvider}); err != nil {
+		return nil, err
+	}
+
+	return nil, validateHelmSource(&genericprovider.CoreProviderWrapper{CoreProvider: coreProvider})
 }
 
 // ValidateDelete implements webhook.Validator so a webhook will be registered for the type.
@@ -73,3 +126,24 @@ func (r *CoreProviderWebhook) Default(ctx context.Context, obj runtime.Object) e
 
 	return nil
 }
+
+// validateSingleCoreProvider rejects the core provider if another one exists, in the watch namespace when set, as
+// the core provider is a singleton. Failing to list the core providers doesn't reject it, as it's checked again
+// at reconcile time, but is returned as a warning.
+func validateSingleCoreProvider(ctx context.Context, c client.Client, watchNamespace string, coreProvider *operatorv1.CoreProvider) (admission.Warnings, error) {
+	coreProviders := &operatorv1.CoreProviderList{}
+	if err := c.List(ctx, coreProviders, client.InNamespace(watchNamespace)); err != nil {
+		return admission.Warnings{fmt.Sprintf("failed to list the core providers: %v", err)}, nil
+	}
+
+	for _, existing := range coreProviders.Items {
+		if existing.Namespace == coreProvider.Namespace && existing.Name == coreProvider.Name {
+			continue
+		}
+
+		return nil, apierrors.NewForbidden(operatorv1.GroupVersion.WithResource("coreproviders").GroupResource(), coreProvider.Name,
+			fmt.Errorf("CoreProvider %s/%s already exists, only one is allowed", existing.Namespace, existing.Name))
+	}
+
+	return nil, nil
+}
@@ -23,15 +23,25 @@ import (
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
 	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
 
 	operatorv1 "sigs.k8s.io/cluster-api-operator/api/v1alpha2"
+	"sigs.k8s.io/cluster-api-operator/internal/controller/genericprovider"
 )
 
-type InfrastructureProviderWebhook struct{}
+type InfrastructureProviderWebhook struct {
+	// Client is used to validate the provider contract against the core provider one.
+	// Defaults to the manager client.
+	Client client.Client
+}
 
 func (r *InfrastructureProviderWebhook) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	if r.Client == nil {
+		r.Client = mgr.GetClient()
+	}
+
 	return ctrl.NewWebhookManagedBy(mgr).
 		WithValidator(r).
 		WithDefaulter(r).
@@ -49,12 +59,31 @@ var (
 
 // ValidateCreate implements webhook.Validator so a webhook will be registered for the type.
 func (r *InfrastructureProviderWebhook) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
-	return nil, nil
+	infrastructureProvider, ok := obj.(*operatorv1.InfrastructureProvider)
+	if !ok {
+		return nil, apierrors.NewBadRequest(fmt.Sprintf("expected a InfrastructureProvider but got a %T", obj))
+	}
+
+	return validateProvider(ctx, r.Client, &genericprovider.InfrastructureProviderWrapper{InfrastructureProvider: infrastructureProvider})
 }
 
 // ValidateUpdate implements webhook.Validator so a webhook will be registered for the type.
 func (r *InfrastructureProviderWebhook) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
-	return nil, nil
+	oldInfrastructureProvider, ok := oldObj.(*operatorv1.InfrastructureProvider)
+	if !ok {
+		return nil, apierrors.NewBadRequest(fmt.Sprintf("expected a InfrastructureProvider but got a %T", oldObj))
+	}
+
+	infrastructureProvider, ok := newObj.(*operatorv1.InfrastructureProvider)
+	if !ok {
+		return nil, apierrors.NewBadRequest(fmt.Sprintf("expected a InfrastructureProvider but got a %T", newObj))
+	}
+
+	if !contractMayChange(&genericprovider.InfrastructureProviderWrapper{InfrastructureProvider: oldInfrastructureProvider}, &genericprovider.InfrastructureProviderWrapper{InfrastructureProvider: infrastructureProvider}) {
+		return nil, nil
+	}
+
+	return validateProvider(ctx, r.Client, &genericprovider.InfrastructureProviderWrapper{InfrastructureProvider: infrastructureProvider})
 }
 
 // ValidateDelete implements webhook.Validator so a webhook will be registered for the type.
@@ -17,7 +17,18 @@ limitations under the License.
 package webhook
 
 import (
+	"context"
+	"fmt"
+	"reflect"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
 	operatorv1 "sigs.k8s.io/cluster-api-operator/api/v1alpha2"
+	providercontroller "sigs.k8s.io/cluster-api-operator/internal/controller"
+	"sigs.k8s.io/cluster-api-operator/internal/controller/genericprovider"
 )
 
 // setDefaultProviderSpec sets the default values for the provider spec.
@@ -26,7 +37,145 @@ func setDefaultProviderSpec(providerSpec *operatorv1.ProviderSpec, providerNames
 		providerSpec.ConfigSecret.Namespace = providerNamespace
 	}
 
+	if providerSpec.ConfigSecretRef != nil && providerSpec.ConfigSecretRef.Namespace == "" {
+		providerSpec.ConfigSecretRef.Namespace = providerNamespace
+	}
+
 	if providerSpec.AdditionalManifestsRef != nil && providerSpec.AdditionalManifestsRef.Namespace == "" {
 		providerSpec.AdditionalManifestsRef.Namespace = providerNamespace
 	}
+
+	if webhook := providerSpec.ManifestTransformWebhook; webhook != nil && webhook.CABundleRef != nil {
+		if webhook.CABundleRef.ConfigMap != nil && webhook.CABundleRef.ConfigMap.Namespace == "" {
+			webhook.CABundleRef.ConfigMap.Namespace = providerNamespace
+		}
+	}
+
+	if providerSpec.FetchConfig != nil && providerSpec.FetchConfig.CABundleRef != nil {
+		caBundleRef := providerSpec.FetchConfig.CABundleRef
+		if caBundleRef.ConfigMap != nil && caBundleRef.ConfigMap.Namespace == "" {
+			caBundleRef.ConfigMap.Namespace = providerNamespace
+		}
+	}
+}
+
+// validateProvider rejects the provider if its name, its Git or Helm source or its contract are invalid.
+func validateProvider(ctx context.Context, c client.Client, provider genericprovider.GenericProvider) (admission.Warnings, error) {
+	if err := validateProviderName(provider); err != nil {
+		return nil, err
+	}
+
+	if err := validateGitSource(provider); err != nil {
+		return nil, err
+	}
+
+	if err := validateHelmSource(provider); err != nil {
+		return nil, err
+	}
+
+	return validateProviderContract(ctx, c, provider)
+}
+
+// validateProviderName rejects the provider if its name is not the one of a predefined provider of the same
+// type, unless spec.fetchConfig sets a custom source, e.g. an infrastructure provider copied from a bootstrap
+// provider. Failing to list the predefined providers doesn't reject the provider, as the name is checked again
+// at reconcile time.
+func validateProviderName(provider genericprovider.GenericProvider) error {
+	reason, msg, err := providercontroller.ValidateProviderName(provider)
+	if err != nil || msg == "" {
+		return nil
+	}
+
+	fieldErr := field.Invalid(field.NewPath("metadata", "name"), provider.GetName(), msg)
+	if reason == operatorv1.FetchConfigValidationErrorReason {
+		fieldErr = field.Required(field.NewPath("spec", "fetchConfig"), msg)
+	}
+
+	return apierrors.NewInvalid(provider.GetObjectKind().GroupVersionKind().GroupKind(), provider.GetName(), field.ErrorList{fieldErr})
+}
+
+// validateGitSource rejects the provider if its Git source could be mistaken for git options, or uses a protocol
+// other than HTTPS or SSH. The source is checked again at reconcile time.
+func validateGitSource(provider genericprovider.GenericProvider) error {
+	spec := provider.GetSpec()
+	if spec.FetchConfig == nil || spec.FetchConfig.Git == nil {
+		return nil
+	}
+
+	msg := providercontroller.ValidateGitSource(spec)
+	if msg == "" {
+		return nil
+	}
+
+	return apierrors.NewInvalid(provider.GetObjectKind().GroupVersionKind().GroupKind(), provider.GetName(), field.ErrorList{
+		field.Invalid(field.NewPath("spec", "fetchConfig", "git"), spec.FetchConfig.Git.URL, msg),
+	})
+}
+
+// validateHelmSource rejects the provider if its Helm source could be mistaken for helm options, or its repository
+// isn't an HTTPS or OCI one. The source is checked again at reconcile time.
+func validateHelmSource(provider genericprovider.GenericProvider) error {
+	spec := provider.GetSpec()
+	if spec.FetchConfig == nil || spec.FetchConfig.Helm == nil {
+		return nil
+	}
+
+	msg := providercontroller.ValidateHelmSource(spec)
+	if msg == "" {
+		return nil
+	}
+
+	return apierrors.NewInvalid(provider.GetObjectKind().GroupVersionKind().GroupKind(), provider.GetName(), field.ErrorList{
+		field.Invalid(field.NewPath("spec", "fetchConfig", "helm"), spec.FetchConfig.Helm.RepoURL, msg),
+	})
+}
+
+// validateProviderContract rejects the provider if its contract doesn't match the one of the installed core provider,
+// so the mismatch is reported when the provider is applied rather than at reconcile time. Failing to resolve the
+// contracts doesn't reject the provider, as they are checked again at reconcile time, but is returned as a warning.
+func validateProviderContract(ctx context.Context, c client.Client, provider genericprovider.GenericProvider) (admission.Warnings, error) {
+	if provider.GetAnnotations()[operatorv1.SkipContractValidationAnnotation] == "true" {
+		return nil, nil
+	}
+
+	coreContract, err := providercontroller.CoreProviderContract(ctx, c)
+	if err != nil {
+		return admission.Warnings{fmt.Sprintf("failed to get the core provider contract: %v", err)}, nil
+	}
+
+	// Nothing to compare with until the core provider is installed.
+	if coreContract == "" {
+		return nil, nil
+	}
+
+	contract, err := providercontroller.ProviderContract(ctx, c, provider)
+	if err != nil {
+		return admission.Warnings{fmt.Sprintf("failed to get the provider contract: %v", err)}, nil
+	}
+
+	if contract == "" || contract == coreContract {
+		return nil, nil
+	}
+
+	if providercontroller.IsContractAllowed(provider, contract, coreContract) {
+		return admission.Warnings{fmt.Sprintf("provider abides by contract %s, tolerated by spec.contractPolicy, while the core provider abides by contract %s",
+			contract, coreContract)}, nil
+	}
+
+	return nil, apierrors.NewInvalid(provider.GetObjectKind().GroupVersionKind().GroupKind(), provider.GetName(), field.ErrorList{
+		field.Invalid(field.NewPath("spec", "version"), provider.GetSpec().Version,
+			fmt.Sprintf("provider abides by contract %s, while the core provider abides by contract %s; set the %s annotation to \"true\" to skip this validation",
+				contract, coreContract, operatorv1.SkipContractValidationAnnotation)),
+	})
+}
+
+// contractMayChange returns true if the provider update can change the contract it abides by, or the contracts
+// it may abide by, or re-enables the contract validation.
+func contractMayChange(oldProvider, newProvider genericprovider.GenericProvider) bool {
+	oldSpec, newSpec := oldProvider.GetSpec(), newProvider.GetSpec()
+
+	return oldSpec.Version != newSpec.Version ||
+		!reflect.DeepEqual(oldSpec.FetchConfig, newSpec.FetchConfig) ||
+		!reflect.DeepEqual(oldSpec.ContractPolicy, newSpec.ContractPolicy) ||
+		oldProvider.GetAnnotations()[operatorv1.SkipContractValidationAnnotation] != newProvider.GetAnnotations()[operatorv1.SkipContractValidationAnnotation]
 }
@@ -17,12 +17,21 @@ limitations under the License.
 package webhook
 
 import (
+	"context"
 	"reflect"
 	"testing"
 
 	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 
 	operatorv1 "sigs.k8s.io/cluster-api-operator/api/v1alpha2"
+	"sigs.k8s.io/cluster-api-operator/internal/controller/genericprovider"
 )
 
 func TestSetDefaultProviderSpec(t *testing.T) {
@@ -63,6 +72,21 @@ func TestSetDefaultProviderSpec(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "shoud default clusterctl config secret namespace if not specified",
+			providerSpec: &operatorv1.ProviderSpec{
+				ConfigSecretRef: &operatorv1.ClusterctlConfigReference{
+					Name: "test-secret",
+				},
+			},
+			namespace: "test-namespace",
+			expectedProviderSpec: &operatorv1.ProviderSpec{
+				ConfigSecretRef: &operatorv1.ClusterctlConfigReference{
+					Name:      "test-secret",
+					Namespace: "test-namespace",
+				},
+			},
+		},
 		{
 			name: "shoud default additional manifests namespace if not specified",
 			providerSpec: &operatorv1.ProviderSpec{
@@ -94,6 +118,54 @@ func TestSetDefaultProviderSpec(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "shoud default CA bundle config map namespace if not specified",
+			providerSpec: &operatorv1.ProviderSpec{
+				FetchConfig: &operatorv1.FetchConfiguration{
+					CABundleRef: &operatorv1.CABundleReference{
+						ConfigMap: &operatorv1.ConfigmapReference{
+							Name: "test-ca-bundle",
+						},
+					},
+				},
+			},
+			namespace: "test-namespace",
+			expectedProviderSpec: &operatorv1.ProviderSpec{
+				FetchConfig: &operatorv1.FetchConfiguration{
+					CABundleRef: &operatorv1.CABundleReference{
+						ConfigMap: &operatorv1.ConfigmapReference{
+							Name:      "test-ca-bundle",
+							Namespace: "test-namespace",
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "shoud default manifest transform webhook CA bundle config map namespace if not specified",
+			providerSpec: &operatorv1.ProviderSpec{
+				ManifestTransformWebhook: &operatorv1.ManifestTransformWebhook{
+					URL: "https://policy.example.com/transform",
+					CABundleRef: &operatorv1.CABundleReference{
+						ConfigMap: &operatorv1.ConfigmapReference{
+							Name: "test-ca-bundle",
+						},
+					},
+				},
+			},
+			namespace: "test-namespace",
+			expectedProviderSpec: &operatorv1.ProviderSpec{
+				ManifestTransformWebhook: &operatorv1.ManifestTransformWebhook{
+					URL: "https://policy.example.com/transform",
+					CABundleRef: &operatorv1.CABundleReference{
+						ConfigMap: &operatorv1.ConfigmapReference{
+							Name:      "test-ca-bundle",
+							Namespace: "test-namespace",
+						},
+					},
+				},
+			},
+		},
 	}
 
 	for _, tc := range testCases {
@@ -104,3 +176,422 @@ func TestSetDefaultProviderSpec(t *testing.T) {
 		})
 	}
 }
+
+func TestValidateProviderContract(t *testing.T) {
+	scheme := runtime.NewScheme()
+	utilruntime.Must(corev1.AddToScheme(scheme))
+	utilruntime.Must(operatorv1.AddToScheme(scheme))
+
+	metadata := `apiVersion: clusterctl.cluster.x-k8s.io/v1alpha3
+kind: Metadata
+releaseSeries:
+- major: 2
+  minor: 1
+  contract: v1beta1
+- major: 0
+  minor: 7
+  contract: v1alpha4
+`
+
+	manifests := func(version string) *corev1.ConfigMap {
+		return &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      version,
+				Namespace: "capa-system",
+				Labels:    map[string]string{"provider-components": "aws"},
+			},
+			Data: map[string]string{
+				"metadata":   metadata,
+				"components": "",
+			},
+		}
+	}
+
+	coreProvider := &operatorv1.CoreProvider{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "cluster-api",
+			Namespace: "capi-system",
+		},
+		Status: operatorv1.CoreProviderStatus{
+			ProviderStatus: operatorv1.ProviderStatus{
+				Contract: pointer.String("v1beta1"),
+			},
+		},
+	}
+
+	infraProvider := func(version string, annotations map[string]string) *operatorv1.InfrastructureProvider {
+		return &operatorv1.InfrastructureProvider{
+			TypeMeta: metav1.TypeMeta{
+				Kind:       "InfrastructureProvider",
+				APIVersion: operatorv1.GroupVersion.String(),
+			},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "aws",
+				Namespace:   "capa-system",
+				Annotations: annotations,
+			},
+			Spec: operatorv1.InfrastructureProviderSpec{
+				ProviderSpec: operatorv1.ProviderSpec{
+					Version: version,
+					FetchConfig: &operatorv1.FetchConfiguration{
+						Selector: &metav1.LabelSelector{
+							MatchLabels: map[string]string{"provider-components": "aws"},
+						},
+					},
+				},
+			},
+		}
+	}
+
+	tolerating := func(provider *operatorv1.InfrastructureProvider, contracts ...string) *operatorv1.InfrastructureProvider {
+		provider.Spec.ContractPolicy = &operatorv1.ContractPolicy{ToleratedContracts: contracts}
+
+		return provider
+	}
+
+	testCases := []struct {
+		name            string
+		objs            []client.Object
+		provider        *operatorv1.InfrastructureProvider
+		expectedError   bool
+		expectedWarning bool
+	}{
+		{
+			name:     "contract matches the core provider one",
+			objs:     []client.Object{coreProvider, manifests("v2.1.4")},
+			provider: infraProvider("v2.1.4", nil),
+		},
+		{
+			name:          "contract doesn't match the core provider one",
+			objs:          []client.Object{coreProvider, manifests("v0.7.0")},
+			provider:      infraProvider("v0.7.0", nil),
+			expectedError: true,
+		},
+		{
+			name:            "contract tolerated by the contract policy",
+			objs:            []client.Object{coreProvider, manifests("v0.7.0")},
+			provider:        tolerating(infraProvider("v0.7.0", nil), "v1alpha4"),
+			expectedWarning: true,
+		},
+		{
+			name:          "contract not tolerated by the contract policy",
+			objs:          []client.Object{coreProvider, manifests("v0.7.0")},
+			provider:      tolerating(infraProvider("v0.7.0", nil), "v1alpha3"),
+			expectedError: true,
+		},
+		{
+			name:     "contract validation skipped",
+			objs:     []client.Object{coreProvider, manifests("v0.7.0")},
+			provider: infraProvider("v0.7.0", map[string]string{operatorv1.SkipContractValidationAnnotation: "true"}),
+		},
+		{
+			name:     "core provider not installed yet",
+			objs:     []client.Object{manifests("v0.7.0")},
+			provider: infraProvider("v0.7.0", nil),
+		},
+		{
+			name:     "version resolved at reconcile time",
+			objs:     []client.Object{coreProvider, manifests("v0.7.0")},
+			provider: infraProvider("", nil),
+		},
+		{
+			name:            "provider metadata not available",
+			objs:            []client.Object{coreProvider},
+			provider:        infraProvider("v0.7.0", nil),
+			expectedWarning: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(tc.objs...).Build()
+
+			warnings, err := validateProviderContract(context.Background(), c, &genericprovider.InfrastructureProviderWrapper{InfrastructureProvider: tc.provider})
+			if tc.expectedError {
+				g.Expect(err).To(HaveOccurred())
+				g.Expect(err.Error()).To(ContainSubstring("contract v1alpha4"))
+			} else {
+				g.Expect(err).ToNot(HaveOccurred())
+			}
+
+			if tc.expectedWarning {
+				g.Expect(warnings).To(HaveLen(1))
+			} else {
+				g.Expect(warnings).To(BeEmpty())
+			}
+		})
+	}
+}
+
+func TestContractMayChange(t *testing.T) {
+	g := NewWithT(t)
+
+	provider := &genericprovider.InfrastructureProviderWrapper{
+		InfrastructureProvider: &operatorv1.InfrastructureProvider{
+			Spec: operatorv1.InfrastructureProviderSpec{
+				ProviderSpec: operatorv1.ProviderSpec{
+					Version: "v2.1.4",
+				},
+			},
+		},
+	}
+
+	replicasChanged := &genericprovider.InfrastructureProviderWrapper{InfrastructureProvider: provider.DeepCopy()}
+	replicasChanged.Spec.Deployment = &operatorv1.DeploymentSpec{Replicas: pointer.Int(2)}
+	g.Expect(contractMayChange(provider, replicasChanged)).To(BeFalse())
+
+	versionChanged := &genericprovider.InfrastructureProviderWrapper{InfrastructureProvider: provider.DeepCopy()}
+	versionChanged.Spec.Version = "v2.2.0"
+	g.Expect(contractMayChange(provider, versionChanged)).To(BeTrue())
+
+	fetchConfigChanged := &genericprovider.InfrastructureProviderWrapper{InfrastructureProvider: provider.DeepCopy()}
+	fetchConfigChanged.Spec.FetchConfig = &operatorv1.FetchConfiguration{URL: "https://github.com/myorg/awesome-aws-provider/releases"}
+	g.Expect(contractMayChange(provider, fetchConfigChanged)).To(BeTrue())
+
+	contractPolicyChanged := &genericprovider.InfrastructureProviderWrapper{InfrastructureProvider: provider.DeepCopy()}
+	contractPolicyChanged.Spec.ContractPolicy = &operatorv1.ContractPolicy{ToleratedContracts: []string{"v1alpha4"}}
+	g.Expect(contractMayChange(contractPolicyChanged, provider)).To(BeTrue())
+
+	validationReenabled := &genericprovider.InfrastructureProviderWrapper{InfrastructureProvider: provider.DeepCopy()}
+	provider.Annotations = map[string]string{operatorv1.SkipContractValidationAnnotation: "true"}
+	g.Expect(contractMayChange(provider, validationReenabled)).To(BeTrue())
+}
+
+func TestValidateProviderName(t *testing.T) {
+	testCases := []struct {
+		name          string
+		provider      genericprovider.GenericProvider
+		expectedError string
+	}{
+		{
+			name: "predefined provider",
+			provider: &genericprovider.InfrastructureProviderWrapper{
+				InfrastructureProvider: &operatorv1.InfrastructureProvider{ObjectMeta: metav1.ObjectMeta{Name: "aws"}},
+			},
+		},
+		{
+			name: "predefined provider of another type",
+			provider: &genericprovider.InfrastructureProviderWrapper{
+				InfrastructureProvider: &operatorv1.InfrastructureProvider{ObjectMeta: metav1.ObjectMeta{Name: "kubeadm"}},
+			},
+			expectedError: "metadata.name",
+		},
+		{
+			name: "core provider named after an infrastructure provider",
+			provider: &genericprovider.CoreProviderWrapper{
+				CoreProvider: &operatorv1.CoreProvider{ObjectMeta: metav1.ObjectMeta{Name: "aws"}},
+			},
+			expectedError: "metadata.name",
+		},
+		{
+			name: "custom provider without fetch config",
+			provider: &genericprovider.InfrastructureProviderWrapper{
+				InfrastructureProvider: &operatorv1.InfrastructureProvider{ObjectMeta: metav1.ObjectMeta{Name: "my-custom-aws"}},
+			},
+			expectedError: "spec.fetchConfig",
+		},
+		{
+			name: "custom provider with fetch config bypasses the registry",
+			provider: &genericprovider.InfrastructureProviderWrapper{
+				InfrastructureProvider: &operatorv1.InfrastructureProvider{
+					ObjectMeta: metav1.ObjectMeta{Name: "kubeadm"},
+					Spec: operatorv1.InfrastructureProviderSpec{
+						ProviderSpec: operatorv1.ProviderSpec{
+							FetchConfig: &operatorv1.FetchConfiguration{URL: "https://github.com/owner/repo/releases"},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			err := validateProviderName(tc.provider)
+			if tc.expectedError == "" {
+				g.Expect(err).ToNot(HaveOccurred())
+
+				return
+			}
+
+			g.Expect(err).To(MatchError(ContainSubstring(tc.expectedError)))
+		})
+	}
+}
+
+func TestValidateGitSource(t *testing.T) {
+	gitProvider := func(url string) genericprovider.GenericProvider {
+		return &genericprovider.InfrastructureProviderWrapper{
+			InfrastructureProvider: &operatorv1.InfrastructureProvider{
+				ObjectMeta: metav1.ObjectMeta{Name: "my-infra"},
+				Spec: operatorv1.InfrastructureProviderSpec{
+					ProviderSpec: operatorv1.ProviderSpec{
+						Version:     "v1.0.0",
+						FetchConfig: &operatorv1.FetchConfiguration{Git: &operatorv1.GitSource{URL: url}},
+					},
+				},
+			},
+		}
+	}
+
+	testCases := []struct {
+		name          string
+		provider      genericprovider.GenericProvider
+		expectedError string
+	}{
+		{
+			name: "no Git source",
+			provider: &genericprovider.InfrastructureProviderWrapper{
+				InfrastructureProvider: &operatorv1.InfrastructureProvider{ObjectMeta: metav1.ObjectMeta{Name: "aws"}},
+			},
+		},
+		{
+			name:     "https URL",
+			provider: gitProvider("https://github.com/owner/repo.git"),
+		},
+		{
+			name:          "URL mistaken for an option",
+			provider:      gitProvider("--upload-pack=touch /tmp/pwned"),
+			expectedError: "spec.fetchConfig.git",
+		},
+		{
+			name:          "file URL",
+			provider:      gitProvider("file:///var/run/secrets"),
+			expectedError: "spec.fetchConfig.git",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			err := validateGitSource(tc.provider)
+			if tc.expectedError == "" {
+				g.Expect(err).ToNot(HaveOccurred())
+
+				return
+			}
+
+			g.Expect(err).To(MatchError(ContainSubstring(tc.expectedError)))
+		})
+	}
+}
+
+func TestValidateHelmSource(t *testing.T) {
+	helmProvider := func(repoURL, chart string) genericprovider.GenericProvider {
+		return &genericprovider.InfrastructureProviderWrapper{
+			InfrastructureProvider: &operatorv1.InfrastructureProvider{
+				ObjectMeta: metav1.ObjectMeta{Name: "my-infra"},
+				Spec: operatorv1.InfrastructureProviderSpec{
+					ProviderSpec: operatorv1.ProviderSpec{
+						Version:     "v1.0.0",
+						FetchConfig: &operatorv1.FetchConfiguration{Helm: &operatorv1.HelmSource{RepoURL: repoURL, Chart: chart}},
+					},
+				},
+			},
+		}
+	}
+
+	testCases := []struct {
+		name          string
+		provider      genericprovider.GenericProvider
+		expectedError string
+	}{
+		{
+			name: "no Helm source",
+			provider: &genericprovider.InfrastructureProviderWrapper{
+				InfrastructureProvider: &operatorv1.InfrastructureProvider{ObjectMeta: metav1.ObjectMeta{Name: "aws"}},
+			},
+		},
+		{
+			name:     "https repository",
+			provider: helmProvider("https://owner.github.io/charts", "my-chart"),
+		},
+		{
+			name:     "OCI registry",
+			provider: helmProvider("oci://ghcr.io/owner/charts", "my-chart"),
+		},
+		{
+			name:          "chart mistaken for an option",
+			provider:      helmProvider("https://owner.github.io/charts", "--post-renderer=/bin/sh"),
+			expectedError: "spec.fetchConfig.helm",
+		},
+		{
+			name:          "plain http repository",
+			provider:      helmProvider("http://owner.github.io/charts", "my-chart"),
+			expectedError: "spec.fetchConfig.helm",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			err := validateHelmSource(tc.provider)
+			if tc.expectedError == "" {
+				g.Expect(err).ToNot(HaveOccurred())
+
+				return
+			}
+
+			g.Expect(err).To(MatchError(ContainSubstring(tc.expectedError)))
+		})
+	}
+}
+
+func TestValidateSingleCoreProvider(t *testing.T) {
+	scheme := runtime.NewScheme()
+	utilruntime.Must(operatorv1.AddToScheme(scheme))
+
+	coreProvider := func(namespace string) *operatorv1.CoreProvider {
+		return &operatorv1.CoreProvider{ObjectMeta: metav1.ObjectMeta{Name: "cluster-api", Namespace: namespace}}
+	}
+
+	testCases := []struct {
+		name           string
+		objs           []client.Object
+		watchNamespace string
+		expectedError  string
+	}{
+		{
+			name: "first core provider",
+		},
+		{
+			name: "same core provider",
+			objs: []client.Object{coreProvider("capi-system")},
+		},
+		{
+			name:          "another core provider",
+			objs:          []client.Object{coreProvider("capi-other")},
+			expectedError: "CoreProvider capi-other/cluster-api already exists, only one is allowed",
+		},
+		{
+			name:           "another core provider outside the watch namespace",
+			objs:           []client.Object{coreProvider("capi-other")},
+			watchNamespace: "capi-system",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(tc.objs...).Build()
+
+			warnings, err := validateSingleCoreProvider(context.Background(), c, tc.watchNamespace, coreProvider("capi-system"))
+			g.Expect(warnings).To(BeEmpty())
+
+			if tc.expectedError == "" {
+				g.Expect(err).ToNot(HaveOccurred())
+
+				return
+			}
+
+			g.Expect(err).To(MatchError(ContainSubstring(tc.expectedError)))
+		})
+	}
+}
@@ -0,0 +1,216 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"context"
+	"fmt"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+	"sigs.k8s.io/json"
+
+	operatorv1 "sigs.k8s.io/cluster-api-operator/api/v1alpha2"
+	"sigs.k8s.io/cluster-api-operator/internal/controller/genericprovider"
+)
+
+type ProviderBundleWebhook struct {
+	// Client is used to validate the contracts of the bundled providers against the core provider one.
+	// Defaults to the manager client.
+	Client client.Client
+}
+
+func (r *ProviderBundleWebhook) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	if r.Client == nil {
+		r.Client = mgr.GetClient()
+	}
+
+	return ctrl.NewWebhookManagedBy(mgr).
+		WithValidator(r).
+		For(&operatorv1.ProviderBundle{}).
+		Complete()
+}
+
+//+kubebuilder:webhook:verbs=create;update,path=/validate-operator-cluster-x-k8s-io-v1alpha2-providerbundle,mutating=false,failurePolicy=fail,matchPolicy=Equivalent,groups=operator.cluster.x-k8s.io,resources=providerbundles,versions=v1alpha2,name=vproviderbundle.kb.io,sideEffects=None,admissionReviewVersions=v1;v1beta1
+
+var _ webhook.CustomValidator = &ProviderBundleWebhook{}
+
+// ValidateCreate implements webhook.Validator so a webhook will be registered for the type.
+func (r *ProviderBundleWebhook) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	bundle, ok := obj.(*operatorv1.ProviderBundle)
+	if !ok {
+		return nil, apierrors.NewBadRequest(fmt.Sprintf("expected a ProviderBundle but got a %T", obj))
+	}
+
+	return validateProviderBundle(ctx, r.Client, nil, bundle)
+}
+
+// ValidateUpdate implements webhook.Validator so a webhook will be registered for the type.
+func (r *ProviderBundleWebhook) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	oldBundle, ok := oldObj.(*operatorv1.ProviderBundle)
+	if !ok {
+		return nil, apierrors.NewBadRequest(fmt.Sprintf("expected a ProviderBundle but got a %T", oldObj))
+	}
+
+	bundle, ok := newObj.(*operatorv1.ProviderBundle)
+	if !ok {
+		return nil, apierrors.NewBadRequest(fmt.Sprintf("expected a ProviderBundle but got a %T", newObj))
+	}
+
+	return validateProviderBundle(ctx, r.Client, oldBundle, bundle)
+}
+
+// ValidateDelete implements webhook.Validator so a webhook will be registered for the type.
+func (r *ProviderBundleWebhook) ValidateDelete(_ context.Context, obj runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+// bundledProvider is a provider declared by a ProviderBundle, with the path of its entry.
+type bundledProvider struct {
+	path     *field.Path
+	provider genericprovider.GenericProvider
+}
+
+// bundledProviders returns the providers declared by the bundle, like the ProviderBundle controller creates them.
+func bundledProviders(bundle *operatorv1.ProviderBundle) []bundledProvider {
+	providers := []bundledProvider{}
+
+	add := func(path *field.Path, entry operatorv1.BundledProvider, provider genericprovider.GenericProvider, kind string) {
+		provider.GetObjectKind().SetGroupVersionKind(operatorv1.GroupVersion.WithKind(kind))
+		provider.SetName(entry.Name)
+		provider.SetNamespace(entry.Namespace)
+		provider.SetSpec(entry.Spec)
+
+		providers = append(providers, bundledProvider{path: path, provider: provider})
+	}
+
+	specPath := field.NewPath("spec")
+
+	if bundle.Spec.Core != nil {
+		add(specPath.Child("core"), *bundle.Spec.Core,
+			&genericprovider.CoreProviderWrapper{CoreProvider: &operatorv1.CoreProvider{}}, "CoreProvider")
+	}
+
+	for i, entry := range bundle.Spec.Bootstrap {
+		add(specPath.Child("bootstrap").Index(i), entry,
+			&genericprovider.BootstrapProviderWrapper{BootstrapProvider: &operatorv1.BootstrapProvider{}}, "BootstrapProvider")
+	}
+
+	for i, entry := range bundle.Spec.ControlPlane {
+		add(specPath.Child("controlPlane").Index(i), entry,
+			&genericprovider.ControlPlaneProviderWrapper{ControlPlaneProvider: &operatorv1.ControlPlaneProvider{}}, "ControlPlaneProvider")
+	}
+
+	for i, entry := range bundle.Spec.Infrastructure {
+		add(specPath.Child("infrastructure").Index(i), entry,
+			&genericprovider.InfrastructureProviderWrapper{InfrastructureProvider: &operatorv1.InfrastructureProvider{}}, "InfrastructureProvider")
+	}
+
+	return providers
+}
+
+// validateProviderBundle rejects the bundle if the specs of its providers have unknown fields, which the schemaless
+// specs don't prune, or if its providers would be rejected by their own webhooks, e.g. for their name or Git
+// source. The contract of a provider is only validated if it may have changed since the old bundle, if any. The
+// rest of the provider schema is validated by the provider CRDs, when the ProviderBundle controller creates the
+// providers.
+func validateProviderBundle(ctx context.Context, c client.Client, oldBundle, bundle *operatorv1.ProviderBundle) (admission.Warnings, error) {
+	fieldErrs := validateBundledSpecFields(ctx)
+
+	oldProviders := map[string]genericprovider.GenericProvider{}
+
+	if oldBundle != nil {
+		for _, old := range bundledProviders(oldBundle) {
+			oldProviders[bundledProviderKey(old.provider)] = old.provider
+		}
+	}
+
+	var warnings admission.Warnings
+
+	for _, bundled := range bundledProviders(bundle) {
+		if err := validateProviderName(bundled.provider); err != nil {
+			fieldErrs = append(fieldErrs, field.Invalid(bundled.path, bundled.provider.GetName(), err.Error()))
+
+			continue
+		}
+
+		if err := validateGitSource(bundled.provider); err != nil {
+			fieldErrs = append(fieldErrs, field.Invalid(bundled.path, bundled.provider.GetName(), err.Error()))
+
+			continue
+		}
+
+		if err := validateHelmSource(bundled.provider); err != nil {
+			fieldErrs = append(fieldErrs, field.Invalid(bundled.path, bundled.provider.GetName(), err.Error()))
+
+			continue
+		}
+
+		// The single core provider is checked when the bundled core provider is created.
+		if _, ok := bundled.provider.(*genericprovider.CoreProviderWrapper); ok {
+			continue
+		}
+
+		if old, ok := oldProviders[bundledProviderKey(bundled.provider)]; ok && !contractMayChange(old, bundled.provider) {
+			continue
+		}
+
+		providerWarnings, err := validateProviderContract(ctx, c, bundled.provider)
+		if err != nil {
+			fieldErrs = append(fieldErrs, field.Invalid(bundled.path, bundled.provider.GetName(), err.Error()))
+		}
+
+		for _, warning := range providerWarnings {
+			warnings = append(warnings, fmt.Sprintf("%s: %s", bundled.path, warning))
+		}
+	}
+
+	if len(fieldErrs) > 0 {
+		return warnings, apierrors.NewInvalid(operatorv1.GroupVersion.WithKind("ProviderBundle").GroupKind(), bundle.GetName(), fieldErrs)
+	}
+
+	return warnings, nil
+}
+
+// validateBundledSpecFields returns an error for each unknown or duplicate field of the admitted bundle, which the
+// decoded bundle silently drops. Nothing is returned if the request isn't available.
+func validateBundledSpecFields(ctx context.Context) field.ErrorList {
+	req, err := admission.RequestFromContext(ctx)
+	if err != nil || len(req.Object.Raw) == 0 {
+		return nil
+	}
+
+	// The bundle was already decoded, only the strict errors are relevant.
+	strictErrs, _ := json.UnmarshalStrict(req.Object.Raw, &operatorv1.ProviderBundle{})
+
+	fieldErrs := field.ErrorList{}
+	for _, strictErr := range strictErrs {
+		fieldErrs = append(fieldErrs, field.Forbidden(field.NewPath("spec"), strictErr.Error()))
+	}
+
+	return fieldErrs
+}
+
+// bundledProviderKey identifies a bundled provider across the versions of a bundle.
+func bundledProviderKey(provider genericprovider.GenericProvider) string {
+	return fmt.Sprintf("%s/%s/%s", provider.GetObjectKind().GroupVersionKind().Kind, provider.GetNamespace(), provider.GetName())
+}
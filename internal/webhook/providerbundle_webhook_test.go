@@ -0,0 +1,155 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	operatorv1 "sigs.k8s.io/cluster-api-operator/api/v1alpha2"
+)
+
+func TestValidateProviderBundle(t *testing.T) {
+	scheme := runtime.NewScheme()
+	utilruntime.Must(corev1.AddToScheme(scheme))
+	utilruntime.Must(operatorv1.AddToScheme(scheme))
+
+	coreProvider := &operatorv1.CoreProvider{
+		ObjectMeta: metav1.ObjectMeta{Name: "cluster-api", Namespace: "capi-system"},
+		Status: operatorv1.CoreProviderStatus{
+			ProviderStatus: operatorv1.ProviderStatus{Contract: pointer.String("v1beta1")},
+		},
+	}
+
+	manifests := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "v0.7.0",
+			Namespace: "capa-system",
+			Labels:    map[string]string{"provider-components": "aws"},
+		},
+		Data: map[string]string{
+			"metadata": `apiVersion: clusterctl.cluster.x-k8s.io/v1alpha3
+kind: Metadata
+releaseSeries:
+- major: 0
+  minor: 7
+  contract: v1alpha4
+`,
+			"components": "",
+		},
+	}
+
+	bundle := func(infraName, version string) *operatorv1.ProviderBundle {
+		return &operatorv1.ProviderBundle{
+			ObjectMeta: metav1.ObjectMeta{Name: "management"},
+			Spec: operatorv1.ProviderBundleSpec{
+				Core: &operatorv1.BundledProvider{Name: "cluster-api", Namespace: "capi-system"},
+				Infrastructure: []operatorv1.BundledProvider{
+					{
+						Name:      infraName,
+						Namespace: "capa-system",
+						Spec: operatorv1.ProviderSpec{
+							Version: version,
+							FetchConfig: &operatorv1.FetchConfiguration{
+								Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"provider-components": "aws"}},
+							},
+						},
+					},
+				},
+			},
+		}
+	}
+
+	withoutFetchConfig := func(bundle *operatorv1.ProviderBundle) *operatorv1.ProviderBundle {
+		bundle.Spec.Infrastructure[0].Spec.FetchConfig = nil
+
+		return bundle
+	}
+
+	testCases := []struct {
+		name          string
+		objs          []client.Object
+		oldBundle     *operatorv1.ProviderBundle
+		bundle        *operatorv1.ProviderBundle
+		raw           string
+		expectedError string
+	}{
+		{
+			name:   "valid bundle",
+			bundle: bundle("aws", "v0.7.0"),
+			raw:    `{"spec":{"core":{"name":"cluster-api","namespace":"capi-system"},"infrastructure":[{"name":"aws","namespace":"capa-system","spec":{"version":"v0.7.0"}}]}}`,
+		},
+		{
+			name:          "unknown field in a bundled spec",
+			bundle:        bundle("aws", "v0.7.0"),
+			raw:           `{"spec":{"infrastructure":[{"name":"aws","namespace":"capa-system","spec":{"vresion":"v0.7.0"}}]}}`,
+			expectedError: `unknown field "spec.infrastructure[0].spec.vresion"`,
+		},
+		{
+			name:          "bundled provider named after a provider of another type",
+			bundle:        withoutFetchConfig(bundle("kubeadm", "")),
+			expectedError: "spec.infrastructure[0]",
+		},
+		{
+			name:          "bundled provider contract doesn't match the core provider one",
+			objs:          []client.Object{coreProvider, manifests},
+			bundle:        bundle("aws", "v0.7.0"),
+			expectedError: "spec.infrastructure[0]: Invalid value: \"aws\": InfrastructureProvider.operator.cluster.x-k8s.io \"aws\" is invalid: spec.version",
+		},
+		{
+			name:      "bundled provider contract unchanged",
+			objs:      []client.Object{coreProvider, manifests},
+			oldBundle: bundle("aws", "v0.7.0"),
+			bundle:    bundle("aws", "v0.7.0"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			ctx := context.Background()
+			if tc.raw != "" {
+				ctx = admission.NewContextWithRequest(ctx, admission.Request{
+					AdmissionRequest: admissionv1.AdmissionRequest{Object: runtime.RawExtension{Raw: []byte(tc.raw)}},
+				})
+			}
+
+			c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(tc.objs...).Build()
+
+			_, err := validateProviderBundle(ctx, c, tc.oldBundle, tc.bundle)
+			if tc.expectedError == "" {
+				g.Expect(err).ToNot(HaveOccurred())
+
+				return
+			}
+
+			g.Expect(err).To(MatchError(ContainSubstring(tc.expectedError)))
+		})
+	}
+}